@@ -11,6 +11,8 @@ import (
 	"github.com/chadweimer/gomp/db"
 	"github.com/chadweimer/gomp/fileaccess"
 	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/jobs"
+	"github.com/chadweimer/gomp/nutrition"
 )
 
 // ---- Begin Standard Errors ----
@@ -30,16 +32,25 @@ type apiHandler struct {
 	fs         fileaccess.Driver
 	upl        *fileaccess.ImageUploader
 	db         db.Driver
+	similar    *similarityIndex
+	nutrition  *nutrition.Database
+	jobs       *jobs.Queue
 }
 
-// NewHandler returns a new instance of http.Handler
-func NewHandler(secureKeys []string, upl *fileaccess.ImageUploader, drDriver db.Driver, fs fileaccess.Driver) http.Handler {
+// NewHandler returns a new instance of http.Handler.
+// The handlers of the jobs the API queues up are registered with the job queue,
+// which must be started after calling this.
+func NewHandler(secureKeys []string, upl *fileaccess.ImageUploader, drDriver db.Driver, fs fileaccess.Driver, nutritionDb *nutrition.Database, jobQueue *jobs.Queue) http.Handler {
 	h := apiHandler{
 		secureKeys: secureKeys,
 		fs:         fs,
 		upl:        upl,
 		db:         drDriver,
+		similar:    newSimilarityIndex(),
+		nutrition:  nutritionDb,
+		jobs:       jobQueue,
 	}
+	h.registerJobHandlers()
 
 	return HandlerWithOptions(NewStrictHandlerWithOptions(
 		h,
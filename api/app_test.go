@@ -113,7 +113,7 @@ func getMockAppConfigurationAPI(ctrl *gomock.Controller) (apiHandler, *db.MockAp
 		ThumbnailQuality: models.ImageQualityMedium,
 		ThumbnailSize:    500,
 	}
-	upl, _ := fileaccess.CreateImageUploader(uplDriver, imgCfg)
+	upl, _ := fileaccess.CreateImageUploader(uplDriver, fileaccessmock.NewMockImageReferences(ctrl), imgCfg)
 
 	api := apiHandler{
 		secureKeys: []string{},
@@ -15,6 +15,7 @@ import (
 
 	"github.com/chadweimer/gomp/fileaccess"
 	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/jobs"
 	"github.com/chadweimer/gomp/metadata"
 	"github.com/chadweimer/gomp/models"
 )
@@ -25,37 +26,69 @@ const (
 	databaseFileName         = "database.json"
 )
 
+var errInvalidBackupMetadata = errors.New("invalid backup metadata")
+
 func (h apiHandler) CreateBackup(ctx context.Context, request CreateBackupRequestObject) (CreateBackupResponseObject, error) {
 	logger := infra.GetLoggerFromContext(ctx)
 
-	var backupFilePath string
 	name := time.Now().Format(backupFileNameTimeFormat)
 
 	// If the request includes file content, use it as the source for the backup instead of exporting from the database.
 	// This allows for restoring from a backup by uploading the backup file as the content of the request.
 	uploadedFileData, _, err := readFile(request.Body)
 	if err == nil {
-		backupFilePath, err = h.uploadBackup(ctx, logger, name, uploadedFileData, err)
+		// Reject anything that isn't a backup right away, rather than once the job runs
+		err = fileaccess.ReadZip(bytes.NewReader(uploadedFileData), int64(len(uploadedFileData)), func(reader *zip.Reader) error {
+			_, err := getMetadata(ctx, logger, reader, name)
+			return err
+		})
 		if err != nil {
+			logger.ErrorContext(ctx, "Uploaded backup is not valid", "error", err)
 			return CreateBackup400Response{}, nil
 		}
-	} else if errors.Is(err, io.EOF) {
-		backupFilePath, err = h.generateNewBackup(ctx, logger, name)
-		if err != nil {
-			return CreateBackup500Response{}, nil
-		}
-	} else {
+	} else if !errors.Is(err, io.EOF) {
 		logger.ErrorContext(ctx, "Failed to read uploaded backup file content", "error", err)
 		return CreateBackup500Response{}, nil
 	}
 
-	return CreateBackup201Response{
-		Headers: CreateBackup201ResponseHeaders{
-			Location: filepath.ToSlash(filepath.Join("/", backupFilePath)),
+	// Exporting the database and copying all the uploads can take a while, so it's done in the background
+	job, err := h.enqueueJob(ctx, models.JobCreateBackup, backupJobPayload{Name: name}, uploadedFileData)
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateBackup202JSONResponse{
+		Body: *job,
+		Headers: CreateBackup202ResponseHeaders{
+			Location: getJobLocation(job),
 		},
 	}, nil
 }
 
+// runCreateBackup creates a backup, either by exporting from the database or from the uploaded backup file,
+// as the work of a job. The result is the URL of the backup file.
+func (h apiHandler) runCreateBackup(ctx context.Context, task *jobs.Task) (string, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	var payload backupJobPayload
+	if err := task.Decode(&payload); err != nil {
+		return "", err
+	}
+
+	var backupFilePath string
+	var err error
+	if len(task.Data) > 0 {
+		backupFilePath, err = h.uploadBackup(ctx, logger, payload.Name, task.Data)
+	} else {
+		backupFilePath, err = h.generateNewBackup(ctx, logger, payload.Name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	return filepath.ToSlash(filepath.Join("/", backupFilePath)), nil
+}
+
 func (h apiHandler) GetBackups(ctx context.Context, _ GetBackupsRequestObject) (GetBackupsResponseObject, error) {
 	logger := infra.GetLoggerFromContext(ctx)
 
@@ -109,14 +142,45 @@ func (h apiHandler) RestoreFromBackup(ctx context.Context, request RestoreFromBa
 		return RestoreFromBackup400Response{}, nil
 	}
 
-	file, err := h.fs.Open(filepath.Join(fileaccess.BackupDirectoryName, info.Name()))
+	// Importing the database and copying all the uploads can take a while, so it's done in the background
+	job, err := h.enqueueJob(ctx, models.JobRestoreFromBackup, backupJobPayload{Name: request.Name}, nil)
 	if err != nil {
-		return RestoreFromBackup400Response{}, nil
+		return nil, err
+	}
+
+	return RestoreFromBackup202JSONResponse{
+		Body: *job,
+		Headers: RestoreFromBackup202ResponseHeaders{
+			Location: getJobLocation(job),
+		},
+	}, nil
+}
+
+// runRestoreFromBackup replaces the database and uploads with those from a backup file, as the work of a job
+func (h apiHandler) runRestoreFromBackup(ctx context.Context, task *jobs.Task) (string, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	var payload backupJobPayload
+	if err := task.Decode(&payload); err != nil {
+		return "", err
+	}
+
+	backupFilePath := filepath.Join(fileaccess.BackupDirectoryName, payload.Name)
+
+	// The backup may have been deleted since the job was queued
+	info, err := h.fs.Stat(backupFilePath)
+	if err != nil {
+		return "", asPermanentJobError(fmt.Errorf("failed to stat backup file: %w", err), fs.ErrNotExist)
+	}
+
+	file, err := h.fs.Open(backupFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup file: %w", err)
 	}
 	defer file.Close()
 
 	err = fileaccess.ReadZip(file, info.Size(), func(reader *zip.Reader) error {
-		_, err := getMetadata(ctx, logger, reader, request.Name)
+		_, err := getMetadata(ctx, logger, reader, payload.Name)
 		if err != nil {
 			return err
 		}
@@ -128,14 +192,15 @@ func (h apiHandler) RestoreFromBackup(ctx context.Context, request RestoreFromBa
 		// the file copy won't be attempted and the database won't be left in a partially restored state.
 		databaseData, err := readJSONFileFromZip[models.BackupData](reader, databaseFileName)
 		if err != nil {
-			logger.ErrorContext(ctx, "Failed to read backup data", "error", err, "name", request.Name)
+			logger.ErrorContext(ctx, "Failed to read backup data", "error", err, "name", payload.Name)
 			return err
 		}
 		err = h.db.Backups().Import(ctx, databaseData)
 		if err != nil {
-			logger.ErrorContext(ctx, "Failed to import backup data", "error", err, "name", request.Name)
+			logger.ErrorContext(ctx, "Failed to import backup data", "error", err, "name", payload.Name)
 			return err
 		}
+		task.SetProgress(50)
 
 		// If the database restore succeeded, copy all the files from the backup to the upload directory.
 		if err := h.fs.DeleteAll(fileaccess.UploadDirectoryName); err != nil {
@@ -144,18 +209,18 @@ func (h apiHandler) RestoreFromBackup(ctx context.Context, request RestoreFromBa
 		}
 		err = fileaccess.CopyDirectoryFromZip(h.fs, fileaccess.UploadDirectoryName, fileaccess.UploadDirectoryName, reader)
 		if err != nil {
-			logger.ErrorContext(ctx, "Failed to copy files from backup", "error", err, "name", request.Name)
+			logger.ErrorContext(ctx, "Failed to copy files from backup", "error", err, "name", payload.Name)
 			return err
 		}
 
 		return nil
 	})
 	if err != nil {
-		logger.ErrorContext(ctx, "Failed to read backup zip file", "error", err, "name", request.Name)
-		return RestoreFromBackup400Response{}, nil
+		// Trying again won't help if the backup itself isn't valid
+		return "", asPermanentJobError(fmt.Errorf("failed to restore from backup '%s': %w", payload.Name, err), zip.ErrFormat, errInvalidBackupMetadata)
 	}
 
-	return RestoreFromBackup204Response{}, nil
+	return "", nil
 }
 
 func (h apiHandler) DeleteBackup(ctx context.Context, request DeleteBackupRequestObject) (DeleteBackupResponseObject, error) {
@@ -208,7 +273,7 @@ func (h apiHandler) generateNewBackup(ctx context.Context, logger *slog.Logger,
 	return backupFilePath, nil
 }
 
-func (h apiHandler) uploadBackup(ctx context.Context, logger *slog.Logger, name string, uploadedFileData []byte, err error) (string, error) {
+func (h apiHandler) uploadBackup(ctx context.Context, logger *slog.Logger, name string, uploadedFileData []byte) (string, error) {
 	logger.DebugContext(ctx, "Creating backup from uploaded file content")
 
 	backupFileName := fmt.Sprintf("gomp-backup-upload-%s.zip", name)
@@ -324,7 +389,7 @@ func getMetadata(ctx context.Context, logger *slog.Logger, reader *zip.Reader, f
 
 	if !metadataContent.IsValid() {
 		logger.ErrorContext(ctx, "Backup file has invalid metadata", "name", fileName, "metadata", metadataContent)
-		return nil, errors.New("invalid backup metadata")
+		return nil, errInvalidBackupMetadata
 	}
 
 	return metadataContent, nil
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/chadweimer/gomp/fileaccess"
+	"github.com/chadweimer/gomp/jobs"
 	"github.com/chadweimer/gomp/mocks/db"
 	fileaccessmock "github.com/chadweimer/gomp/mocks/fileaccess"
 	"github.com/chadweimer/gomp/models"
@@ -22,36 +23,98 @@ import (
 
 func TestCreateBackup(t *testing.T) {
 	tests := []struct {
-		name           string
-		body           *multipart.Reader
-		setupMocks     func(*fileaccessmock.MockDriver, *db.MockBackupDriver, *bytes.Buffer)
-		expectError    bool
-		expectResponse any
+		name         string
+		body         *multipart.Reader
+		expectData   []byte
+		expectQueued bool
+		expectStatus int
 	}{
 		{
-			name: "Success - generate from database with nil body",
-			body: nil,
+			name:         "Success - generate from database with nil body",
+			body:         nil,
+			expectData:   nil,
+			expectQueued: true,
+		},
+		{
+			name:         "Success - upload backup file with multipart body",
+			body:         createMultipartBackupReader("test-backup"),
+			expectData:   createTestBackupZip("test-backup").Bytes(),
+			expectQueued: true,
+		},
+		{
+			name:         "Error - upload invalid backup file",
+			body:         createMultipartReader("backup.zip", []byte("not a valid zip file")),
+			expectQueued: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			queue, jobDriver := getMockJobQueue(t, ctrl)
+			if tt.expectQueued {
+				expectJobQueued(jobDriver, models.JobCreateBackup, gomock.Any(), tt.expectData)
+			}
+
+			api := apiHandler{
+				secureKeys: []string{},
+				db:         db.NewMockDriver(ctrl),
+				fs:         fileaccessmock.NewMockDriver(ctrl),
+				jobs:       queue,
+			}
+
+			request := CreateBackupRequestObject{
+				Body: tt.body,
+			}
+
+			// Act
+			resp, err := api.CreateBackup(t.Context(), request)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.expectQueued {
+				got, ok := resp.(CreateBackup202JSONResponse)
+				if !ok {
+					t.Fatalf("expected CreateBackup202JSONResponse, got %T", resp)
+				}
+				if got.Headers.Location != "/api/v1/jobs/7" {
+					t.Errorf("unexpected location: %s", got.Headers.Location)
+				}
+			} else if _, ok := resp.(CreateBackup400Response); !ok {
+				t.Fatalf("expected CreateBackup400Response, got %T", resp)
+			}
+		})
+	}
+}
+
+func Test_runCreateBackup(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         []byte
+		setupMocks   func(*fileaccessmock.MockDriver, *db.MockBackupDriver, *bytes.Buffer)
+		expectResult string
+	}{
+		{
+			name: "Success - generate from database",
+			data: nil,
 			setupMocks: func(mockFS *fileaccessmock.MockDriver, mockBackupDriver *db.MockBackupDriver, _ *bytes.Buffer) {
 				mockBackupDriver.EXPECT().Export(gomock.Any()).Return(&models.BackupData{}, nil)
 
-				mapFS := fstest.MapFS{
-					"foo.zip": &fstest.MapFile{
-						Data:    []byte{},
-						Mode:    fs.ModeAppend,
-						ModTime: time.Now(),
-					},
-				}
 				mockWriter := bytes.NewBuffer([]byte{})
 				mockFS.EXPECT().Create(gomock.Any()).Return(bufferCloser{mockWriter}, nil)
-				mockFS.EXPECT().Stat(gomock.Any()).Return(createMockFileInfo(int64(mockWriter.Len())), nil).MinTimes(1)
-				mockFS.EXPECT().Open(gomock.Any()).Return(mapFS.Open("foo.zip"))
+				mockFS.EXPECT().Stat(gomock.Any()).Return(nil, fs.ErrNotExist).AnyTimes()
 			},
-			expectError:    false,
-			expectResponse: CreateBackup201Response{},
+			expectResult: "/backups/gomp-backup-test-backup.zip",
 		},
 		{
-			name: "Success - upload backup file with multipart body",
-			body: createMultipartBackupReader("test-backup"),
+			name: "Success - upload backup file",
+			data: createTestBackupZip("test-backup").Bytes(),
 			setupMocks: func(mockFS *fileaccessmock.MockDriver, _ *db.MockBackupDriver, backupZip *bytes.Buffer) {
 				mapFS := fstest.MapFS{
 					"foo.zip": &fstest.MapFile{
@@ -70,8 +133,7 @@ func TestCreateBackup(t *testing.T) {
 					mockFS.EXPECT().Open(gomock.Any()).Return(mapFS.Open("foo.zip")),
 				)
 			},
-			expectError:    false,
-			expectResponse: CreateBackup201Response{},
+			expectResult: "/backups/gomp-backup-upload-test-backup.zip",
 		},
 	}
 
@@ -95,24 +157,21 @@ func TestCreateBackup(t *testing.T) {
 				fs:         mockFS,
 			}
 
-			request := CreateBackupRequestObject{
-				Body: tt.body,
+			task := &jobs.Task{
+				Job:     models.Job{ID: new(int64(7)), Kind: models.JobCreateBackup},
+				Payload: `{"name":"test-backup"}`,
+				Data:    tt.data,
 			}
 
 			// Act
-			resp, err := api.CreateBackup(t.Context(), request)
+			result, err := api.runCreateBackup(t.Context(), task)
 
 			// Assert
-			if (err != nil) != tt.expectError {
-				t.Errorf("expected error: %v, got error: %v", tt.expectError, err)
-			}
-
-			if resp == nil {
-				t.Fatal("response is nil")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
 			}
-
-			if _, ok := resp.(CreateBackup201Response); !ok {
-				t.Fatalf("expected CreateBackup201Response, got %T", resp)
+			if result != tt.expectResult {
+				t.Errorf("expected result: %s, got: %s", tt.expectResult, result)
 			}
 		})
 	}
@@ -282,10 +341,101 @@ func TestGetBackups(t *testing.T) {
 
 func TestRestoreFromBackup(t *testing.T) {
 	tests := []struct {
-		name        string
-		fileName    string
-		setupMocks  func(*fileaccessmock.MockDriver, *db.MockBackupDriver)
-		expectError bool
+		name           string
+		fileName       string
+		statInfo       fs.FileInfo
+		statErr        error
+		expectResponse RestoreFromBackupResponseObject
+	}{
+		{
+			name:           "Success - restore valid backup",
+			fileName:       "test-backup.zip",
+			statInfo:       createMockFileInfo(1024),
+			expectResponse: RestoreFromBackup202JSONResponse{},
+		},
+		{
+			name:           "Error - unsafe name",
+			fileName:       "../test-backup.zip",
+			expectResponse: RestoreFromBackup400Response{},
+		},
+		{
+			name:           "Error - file not found",
+			fileName:       "nonexistent.zip",
+			statErr:        fs.ErrNotExist,
+			expectResponse: RestoreFromBackup404Response{},
+		},
+		{
+			name:           "Error - failed to stat file",
+			fileName:       "test-backup.zip",
+			statErr:        errors.New("permission denied"),
+			expectResponse: RestoreFromBackup400Response{},
+		},
+		{
+			name:     "Error - target is a directory",
+			fileName: "backups",
+			statInfo: &mockFileInfo{
+				name:  "backups",
+				size:  0,
+				isDir: true,
+			},
+			expectResponse: RestoreFromBackup400Response{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockFS := fileaccessmock.NewMockDriver(ctrl)
+			queue, jobDriver := getMockJobQueue(t, ctrl)
+			if tt.statInfo != nil || tt.statErr != nil {
+				mockFS.EXPECT().Stat(filepath.Join(fileaccess.BackupDirectoryName, tt.fileName)).Return(tt.statInfo, tt.statErr)
+			}
+			if _, ok := tt.expectResponse.(RestoreFromBackup202JSONResponse); ok {
+				expectJobQueued(jobDriver, models.JobRestoreFromBackup, gomock.Eq(`{"name":"`+tt.fileName+`"}`), nil)
+			}
+
+			api := apiHandler{
+				secureKeys: []string{},
+				db:         db.NewMockDriver(ctrl),
+				fs:         mockFS,
+				jobs:       queue,
+			}
+
+			request := RestoreFromBackupRequestObject{
+				Name: tt.fileName,
+			}
+
+			// Act
+			resp, err := api.RestoreFromBackup(t.Context(), request)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, ok := resp.(RestoreFromBackup202JSONResponse); ok {
+				if _, ok := tt.expectResponse.(RestoreFromBackup202JSONResponse); !ok {
+					t.Fatalf("expected %T, got %T", tt.expectResponse, resp)
+				}
+				if got.Headers.Location != "/api/v1/jobs/7" {
+					t.Errorf("unexpected location: %s", got.Headers.Location)
+				}
+			} else if resp != tt.expectResponse {
+				t.Errorf("expected %T, got %T", tt.expectResponse, resp)
+			}
+		})
+	}
+}
+
+func Test_runRestoreFromBackup(t *testing.T) {
+	tests := []struct {
+		name            string
+		fileName        string
+		setupMocks      func(*fileaccessmock.MockDriver, *db.MockBackupDriver)
+		expectError     bool
+		expectPermanent bool
 	}{
 		{
 			name:     "Success - restore valid backup",
@@ -315,25 +465,13 @@ func TestRestoreFromBackup(t *testing.T) {
 			expectError: false,
 		},
 		{
-			name:     "Error - file not found",
+			name:     "Error - file deleted",
 			fileName: "nonexistent.zip",
 			setupMocks: func(mockFS *fileaccessmock.MockDriver, _ *db.MockBackupDriver) {
-				mockFS.EXPECT().Stat(gomock.Any()).Return(nil, errors.New("file not found"))
+				mockFS.EXPECT().Stat(gomock.Any()).Return(nil, fs.ErrNotExist)
 			},
-			expectError: true,
-		},
-		{
-			name:     "Error - target is a directory",
-			fileName: "backups",
-			setupMocks: func(mockFS *fileaccessmock.MockDriver, _ *db.MockBackupDriver) {
-				dirInfo := &mockFileInfo{
-					name:  "backups",
-					size:  0,
-					isDir: true,
-				}
-				mockFS.EXPECT().Stat(gomock.Any()).Return(dirInfo, nil)
-			},
-			expectError: true,
+			expectError:     true,
+			expectPermanent: true,
 		},
 		{
 			name:     "Error - failed to open file",
@@ -359,7 +497,8 @@ func TestRestoreFromBackup(t *testing.T) {
 				mockFS.EXPECT().Stat(gomock.Any()).Return(createMockFileInfo(20), nil)
 				mockFS.EXPECT().Open(gomock.Any()).Return(mapFS.Open("corrupted.zip"))
 			},
-			expectError: true,
+			expectError:     true,
+			expectPermanent: true,
 		},
 		{
 			name:     "Error - missing metadata in backup",
@@ -427,29 +566,20 @@ func TestRestoreFromBackup(t *testing.T) {
 				fs:         mockFS,
 			}
 
-			request := RestoreFromBackupRequestObject{
-				Name: tt.fileName,
+			task := &jobs.Task{
+				Job:     models.Job{ID: new(int64(7)), Kind: models.JobRestoreFromBackup},
+				Payload: `{"name":"` + tt.fileName + `"}`,
 			}
 
 			// Act
-			resp, err := api.RestoreFromBackup(t.Context(), request)
+			_, err := api.runRestoreFromBackup(t.Context(), task)
 
 			// Assert
-			if err != nil {
-				t.Errorf("unexpected error: %v", err)
-			}
-			if resp == nil {
-				t.Fatal("response is nil")
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error: %v, got error: %v", tt.expectError, err)
 			}
-
-			if !tt.expectError {
-				if _, ok := resp.(RestoreFromBackup204Response); !ok {
-					t.Fatalf("expected RestoreFromBackup204Response, got %T", resp)
-				}
-			} else {
-				if _, ok := resp.(RestoreFromBackup400Response); !ok {
-					t.Fatalf("expected RestoreFromBackup400Response, got %T", resp)
-				}
+			if err != nil && jobs.IsPermanent(err) != tt.expectPermanent {
+				t.Errorf("expected permanent error: %v, got error: %v", tt.expectPermanent, err)
 			}
 		})
 	}
@@ -570,12 +700,14 @@ func createTestBackupZip(name string) *bytes.Buffer {
 }
 
 func createMultipartBackupReader(name string) *multipart.Reader {
-	backupZip := createTestBackupZip(name)
+	return createMultipartReader("backup.zip", createTestBackupZip(name).Bytes())
+}
 
+func createMultipartReader(fileName string, content []byte) *multipart.Reader {
 	body := new(bytes.Buffer)
 	w := multipart.NewWriter(body)
-	part, _ := w.CreateFormFile("file", "backup.zip")
-	_, _ = io.Copy(part, backupZip)
+	part, _ := w.CreateFormFile("file", fileName)
+	_, _ = io.Copy(part, bytes.NewReader(content))
 	_ = w.Close()
 
 	return multipart.NewReader(body, w.Boundary())
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/models"
+	"github.com/chadweimer/gomp/plaintext"
+)
+
+// How much the ingredients of two recipes must overlap for them to be considered duplicates
+const duplicateIngredientThreshold = 0.8
+
+// The fewest ingredient words a recipe must have for its ingredients to be compared,
+// since recipes with only a couple ingredients overlap too easily
+const duplicateIngredientMinWords = 3
+
+func (h apiHandler) FindDuplicateRecipes(ctx context.Context, _ FindDuplicateRecipesRequestObject) (FindDuplicateRecipesResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	recipes, err := h.db.Recipes().List(ctx)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to list recipes", "error", err)
+		return nil, err
+	}
+
+	return FindDuplicateRecipes200JSONResponse(findDuplicates(*recipes)), nil
+}
+
+func (h apiHandler) MergeRecipes(ctx context.Context, request MergeRecipesRequestObject) (MergeRecipesResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx).With("recipe-id", request.RecipeID, "duplicate-recipe-id", request.DuplicateRecipeID)
+
+	if request.RecipeID == request.DuplicateRecipeID {
+		logger.WarnContext(ctx, "cannot merge a recipe with itself")
+		return MergeRecipes400Response{}, nil
+	}
+
+	// Copy the images first, so that nothing is lost if the database changes fail.
+	// They're only removed from the duplicate once the merge has been committed.
+	copied, err := h.upl.CopyAll(ctx, request.DuplicateRecipeID, request.RecipeID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to copy images of duplicate recipe", "error", err)
+		return nil, err
+	}
+
+	if err := h.db.Recipes().Merge(ctx, request.RecipeID, request.DuplicateRecipeID, copied); err != nil {
+		for _, name := range copied {
+			if err := h.upl.Delete(ctx, request.RecipeID, name); err != nil {
+				logger.ErrorContext(ctx, "Failed to remove copied image after failed merge", "error", err, "image-name", name)
+			}
+		}
+		if errors.Is(err, db.ErrNotFound) {
+			return MergeRecipes404Response{}, nil
+		}
+		logger.ErrorContext(ctx, "Failed to merge recipes", "error", err)
+		return nil, err
+	}
+
+	// The merge has been committed, so failing to clean up only leaves files behind for the upload check to find
+	if err := h.upl.DeleteAll(ctx, request.DuplicateRecipeID); err != nil {
+		logger.ErrorContext(ctx, "Failed to delete files of merged recipe",
+			"error", err,
+			"recipe-id", request.DuplicateRecipeID)
+	}
+
+	// In case the surviving recipe had no main image and the duplicate didn't either
+	if err := h.setMainImageIfNecessary(ctx, request.RecipeID, nil); err != nil {
+		return nil, fmt.Errorf("failed to update main image after merge: %w", err)
+	}
+
+	return MergeRecipes204Response{}, nil
+}
+
+// duplicateCandidate is a recipe along with the normalized values used to compare it with other recipes
+type duplicateCandidate struct {
+	recipe          models.RecipeCompact
+	name            string
+	sourceURL       string
+	ingredientWords map[string]bool
+}
+
+func findDuplicates(recipes []models.Recipe) []RecipeDuplicate {
+	candidates := make([]duplicateCandidate, 0, len(recipes))
+	for _, recipe := range recipes {
+		words := make(map[string]bool)
+		for _, word := range getSimilarityWords(recipe.Ingredients) {
+			words[word] = true
+		}
+		candidates = append(candidates, duplicateCandidate{
+			recipe: models.RecipeCompact{
+				ID:            recipe.ID,
+				Name:          recipe.Name,
+				State:         recipe.State,
+				CreatedAt:     recipe.CreatedAt,
+				ModifiedAt:    recipe.ModifiedAt,
+				Rating:        recipe.Rating,
+				MainImageName: recipe.MainImageName,
+			},
+			name:            strings.Join(plaintext.Words(recipe.Name), " "),
+			sourceURL:       normalizeSourceURL(recipe.SourceURL),
+			ingredientWords: words,
+		})
+	}
+
+	duplicates := make([]RecipeDuplicate, 0)
+	for i, candidate := range candidates {
+		for _, other := range candidates[i+1:] {
+			reasons := make([]DuplicateReason, 0)
+			if candidate.name != "" && candidate.name == other.name {
+				reasons = append(reasons, DuplicateName)
+			}
+			if candidate.sourceURL != "" && candidate.sourceURL == other.sourceURL {
+				reasons = append(reasons, DuplicateSourceURL)
+			}
+			score := jaccard(candidate.ingredientWords, other.ingredientWords)
+			if len(candidate.ingredientWords) >= duplicateIngredientMinWords &&
+				len(other.ingredientWords) >= duplicateIngredientMinWords &&
+				score >= duplicateIngredientThreshold {
+				reasons = append(reasons, DuplicateIngredients)
+			}
+
+			if len(reasons) > 0 {
+				duplicates = append(duplicates, RecipeDuplicate{
+					Recipe:    candidate.recipe,
+					Duplicate: other.recipe,
+					Reasons:   reasons,
+					Score:     score,
+				})
+			}
+		}
+	}
+
+	// The most likely duplicates first
+	slices.SortStableFunc(duplicates, func(a, b RecipeDuplicate) int {
+		return cmp.Or(
+			cmp.Compare(len(b.Reasons), len(a.Reasons)),
+			cmp.Compare(b.Score, a.Score))
+	})
+
+	return duplicates
+}
+
+// normalizeSourceURL reduces the URL to its host and path, so that trivial
+// differences like the scheme or tracking parameters don't prevent a match
+func normalizeSourceURL(sourceURL string) string {
+	u, err := url.Parse(strings.TrimSpace(sourceURL))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	return host + strings.TrimSuffix(u.Path, "/")
+}
+
+// jaccard returns the size of the intersection of the sets relative to the size of their union
+func jaccard(a map[string]bool, b map[string]bool) float32 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+
+	intersection := 0
+	for word := range a {
+		if b[word] {
+			intersection++
+		}
+	}
+	return float32(intersection) / float32(len(a)+len(b)-intersection)
+}
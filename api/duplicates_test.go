@@ -0,0 +1,142 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/models"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_FindDuplicateRecipes(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	api, recipesDriver, _ := getMockRecipesAPI(ctrl)
+
+	chicken := recipeFixtureLemonGarlicChicken()
+	chicken.ID = new(int64(1))
+	chickenCopy := recipeFixtureLemonGarlicChicken()
+	chickenCopy.ID = new(int64(2))
+	chickenCopy.Name = "Lemon-Garlic  chicken"
+	chickenCopy.SourceURL = "http://www.example.com/recipes/lemon-garlic-chicken/?utm_source=feed"
+	chickenCopy.Ingredients = "1.5 lb chicken thighs\n2 tbsp olive oil\n3 cloves garlic\n1 lemon\nsalt"
+	sameSource := recipeFixtureSheetPanSausage()
+	sameSource.ID = new(int64(3))
+	sameSource.SourceURL = chicken.SourceURL
+	unrelated := recipeFixtureChickpeaSaladWraps()
+	unrelated.ID = new(int64(4))
+	recipes := []models.Recipe{*chicken, *chickenCopy, *sameSource, *unrelated}
+	recipesDriver.EXPECT().List(t.Context()).Return(&recipes, nil)
+
+	// Act
+	resp, err := api.FindDuplicateRecipes(t.Context(), FindDuplicateRecipesRequestObject{})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, ok := resp.(FindDuplicateRecipes200JSONResponse)
+	if !ok {
+		t.Fatalf("expected FindDuplicateRecipes200JSONResponse, got %T", resp)
+	}
+	type pair struct {
+		recipeID    int64
+		duplicateID int64
+		reasons     []DuplicateReason
+	}
+	expected := []pair{
+		{1, 2, []DuplicateReason{DuplicateName, DuplicateSourceURL, DuplicateIngredients}},
+		{1, 3, []DuplicateReason{DuplicateSourceURL}},
+		{2, 3, []DuplicateReason{DuplicateSourceURL}},
+	}
+	actual := make([]pair, 0, len(got))
+	for _, duplicate := range got {
+		actual = append(actual, pair{*duplicate.Recipe.ID, *duplicate.Duplicate.ID, duplicate.Reasons})
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected duplicates: %v, got: %v", expected, actual)
+	}
+}
+
+func Test_MergeRecipes(t *testing.T) {
+	type testArgs struct {
+		name             string
+		recipeID         int64
+		duplicateID      int64
+		dbError          error
+		deleteAllError   error
+		expectedError    error
+		expectedResponse MergeRecipesResponseObject
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name:             "Success",
+			recipeID:         1,
+			duplicateID:      2,
+			expectedResponse: MergeRecipes204Response{},
+		},
+		{
+			name:             "Files of duplicate not deleted",
+			recipeID:         1,
+			duplicateID:      2,
+			deleteAllError:   io.ErrClosedPipe,
+			expectedResponse: MergeRecipes204Response{},
+		},
+		{
+			name:             "Same recipe",
+			recipeID:         1,
+			duplicateID:      1,
+			expectedResponse: MergeRecipes400Response{},
+		},
+		{
+			name:             "Recipe not found",
+			recipeID:         1,
+			duplicateID:      2,
+			dbError:          db.ErrNotFound,
+			expectedResponse: MergeRecipes404Response{},
+		},
+		{
+			name:          "Database error",
+			recipeID:      1,
+			duplicateID:   2,
+			dbError:       sql.ErrConnDone,
+			expectedError: sql.ErrConnDone,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			api, recipesDriver, uplDriver := getMockRecipesAPI(ctrl)
+
+			if test.recipeID != test.duplicateID {
+				// Neither recipe has any images
+				uplDriver.EXPECT().List(gomock.Any()).AnyTimes().Return(nil, fs.ErrNotExist)
+				recipesDriver.EXPECT().Merge(t.Context(), test.recipeID, test.duplicateID, map[string]string{}).Return(test.dbError)
+				if test.dbError == nil {
+					uplDriver.EXPECT().DeleteAll("uploads/recipes/2").Return(test.deleteAllError)
+					recipesDriver.EXPECT().Read(t.Context(), test.recipeID).Return(&models.Recipe{ID: &test.recipeID}, nil)
+				}
+			}
+
+			// Act
+			resp, err := api.MergeRecipes(t.Context(), MergeRecipesRequestObject{RecipeID: test.recipeID, DuplicateRecipeID: test.duplicateID})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if resp != test.expectedResponse {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
@@ -1,20 +1,28 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
 	"io/fs"
 	"path/filepath"
+	"slices"
 
 	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/fileaccess"
 	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/jobs"
+	"github.com/chadweimer/gomp/models"
+	"github.com/samber/lo"
 )
 
 func (h apiHandler) GetImages(ctx context.Context, request GetImagesRequestObject) (GetImagesResponseObject, error) {
 	logger := infra.GetLoggerFromContext(ctx)
 
-	images, err := h.upl.List(request.RecipeID)
+	images, _, err := h.listImages(ctx, request.RecipeID)
 	if err != nil {
 		logger.ErrorContext(ctx, "Failed to get images for recipe",
 			"error", err,
@@ -25,38 +33,147 @@ func (h apiHandler) GetImages(ctx context.Context, request GetImagesRequestObjec
 	return GetImages200JSONResponse(images), nil
 }
 
-func (h apiHandler) UploadImage(ctx context.Context, request UploadImageRequestObject) (UploadImageResponseObject, error) {
+func (h apiHandler) ReorderImages(ctx context.Context, request ReorderImagesRequestObject) (ReorderImagesResponseObject, error) {
 	logger := infra.GetLoggerFromContext(ctx)
 
-	uploadedFileData, imageName, err := readFile(request.Body)
+	images, _, err := h.listImages(ctx, request.RecipeID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
+		return nil, fmt.Errorf("failed to list images for recipe %d: %w", request.RecipeID, err)
+	}
+	if len(images) == 0 {
+		return ReorderImages404Response{}, nil
 	}
 
-	// Save the image itself
-	res, err := h.upl.Save(request.RecipeID, imageName, uploadedFileData)
+	// Every image must be included exactly once
+	names := *request.Body
+	current := lo.Map(images, func(image models.RecipeImage, _ int) string { return image.Name })
+	if len(names) != len(current) || len(lo.Uniq(names)) != len(names) || len(lo.Intersect(names, current)) != len(current) {
+		logger.WarnContext(ctx, "Image order doesn't match the images of the recipe",
+			"recipe-id", request.RecipeID,
+			"names", names)
+		return ReorderImages400Response{}, nil
+	}
+
+	if err := h.db.Images().Reorder(ctx, request.RecipeID, names); err != nil {
+		logger.ErrorContext(ctx, "Failed to reorder images for recipe",
+			"error", err,
+			"recipe-id", request.RecipeID)
+		return nil, err
+	}
+
+	return ReorderImages204Response{}, nil
+}
+
+func (h apiHandler) UpdateImage(ctx context.Context, request UpdateImageRequestObject) (UpdateImageResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	// Validate the image name to prevent path traversal attacks
+	if !isNameSafe(request.Name) {
+		logger.WarnContext(ctx, "invalid image name", "name", request.Name)
+		return UpdateImage400Response{}, nil
+	}
+
+	images, missingDetails, err := h.listImages(ctx, request.RecipeID)
 	if err != nil {
-		if errors.Is(err, db.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
-			return UploadImage404Response{}, nil
+		return nil, fmt.Errorf("failed to list images for recipe %d: %w", request.RecipeID, err)
+	}
+	if !slices.ContainsFunc(images, func(image models.RecipeImage) bool { return image.Name == request.Name }) {
+		return UpdateImage404Response{}, nil
+	}
+	if missingDetails {
+		// Otherwise, the image would move after all the others once its details are stored
+		if err := h.saveImageOrder(ctx, request.RecipeID, images); err != nil {
+			return nil, err
 		}
-		logger.ErrorContext(ctx, "Failed to save image for recipe",
+	}
+
+	if err := h.db.Images().Update(ctx, request.RecipeID, request.Name, request.Body); err != nil {
+		logger.ErrorContext(ctx, "Failed to update image for recipe",
 			"error", err,
-			"recipe-id", request.RecipeID)
+			"recipe-id", request.RecipeID,
+			"image-name", request.Name)
 		return nil, err
 	}
 
-	// Update main image if necessary
-	if err := h.setMainImageIfNecessary(ctx, request.RecipeID, nil); err != nil {
-		return nil, fmt.Errorf("failed to update main image after upload: %w", err)
+	return UpdateImage204Response{}, nil
+}
+
+func (h apiHandler) UploadImage(ctx context.Context, request UploadImageRequestObject) (UploadImageResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	uploadedFileData, _, err := readFile(request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
 	}
 
-	return UploadImage201Response{
-		Headers: UploadImage201ResponseHeaders{
-			Location: res.URL,
+	// Reject anything that isn't an image right away, rather than once the job runs
+	if _, _, err := image.DecodeConfig(bytes.NewReader(uploadedFileData)); err != nil {
+		logger.WarnContext(ctx, "Uploaded file is not a supported image",
+			"error", err,
+			"recipe-id", request.RecipeID)
+		return UploadImage400Response{}, nil
+	}
+	if _, err := h.db.Recipes().Read(ctx, request.RecipeID); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return UploadImage404Response{}, nil
+		}
+		return nil, fmt.Errorf("failed to get recipe %d: %w", request.RecipeID, err)
+	}
+
+	// Decoding and resizing the image can take a while, so it's saved in the background
+	job, err := h.enqueueJob(ctx, models.JobUploadImage, imageJobPayload{RecipeID: request.RecipeID}, uploadedFileData)
+	if err != nil {
+		return nil, err
+	}
+
+	return UploadImage202JSONResponse{
+		Body: *job,
+		Headers: UploadImage202ResponseHeaders{
+			Location: getJobLocation(job),
 		},
 	}, nil
 }
 
+// runUploadImage saves an image uploaded to a recipe, as the work of a job.
+// The result is the URL of the saved image.
+func (h apiHandler) runUploadImage(ctx context.Context, task *jobs.Task) (string, error) {
+	var payload imageJobPayload
+	if err := task.Decode(&payload); err != nil {
+		return "", err
+	}
+
+	// The recipe may have been deleted since the image was uploaded
+	if _, err := h.db.Recipes().Read(ctx, payload.RecipeID); err != nil {
+		return "", asPermanentJobError(fmt.Errorf("failed to get recipe %d: %w", payload.RecipeID, err), db.ErrNotFound)
+	}
+
+	// Keep any existing images without details ahead of the new one
+	if err := h.saveImageOrderIfNecessary(ctx, payload.RecipeID); err != nil {
+		return "", err
+	}
+	task.SetProgress(10)
+
+	// Save the image itself
+	res, err := h.upl.Save(ctx, payload.RecipeID, task.Data)
+	if err != nil {
+		return "", asPermanentJobError(fmt.Errorf("failed to save image for recipe %d: %w", payload.RecipeID, err), fileaccess.ErrInvalidContentType)
+	}
+	task.SetProgress(80)
+
+	// Along with its details
+	image := &models.RecipeImage{Name: res.Name, Width: &res.Width, Height: &res.Height, UploadedBy: task.Job.CreatedBy}
+	if err := h.db.Images().Create(ctx, payload.RecipeID, image); err != nil {
+		return "", fmt.Errorf("failed to save details of image: %w", err)
+	}
+
+	// Update main image if necessary
+	if err := h.setMainImageIfNecessary(ctx, payload.RecipeID, nil); err != nil {
+		return "", fmt.Errorf("failed to update main image after upload: %w", err)
+	}
+
+	return res.URL, nil
+}
+
 func (h apiHandler) DeleteImage(ctx context.Context, request DeleteImageRequestObject) (DeleteImageResponseObject, error) {
 	logger := infra.GetLoggerFromContext(ctx)
 
@@ -66,7 +183,7 @@ func (h apiHandler) DeleteImage(ctx context.Context, request DeleteImageRequestO
 		return DeleteImage400Response{}, nil
 	}
 
-	if err := h.upl.Delete(request.RecipeID, request.Name); err != nil {
+	if err := h.upl.Delete(ctx, request.RecipeID, request.Name); err != nil {
 		if errors.Is(err, db.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
 			return DeleteImage404Response{}, nil
 		}
@@ -76,6 +193,10 @@ func (h apiHandler) DeleteImage(ctx context.Context, request DeleteImageRequestO
 			"image-name", request.Name)
 		return nil, err
 	}
+	// This also detaches the image from any notes and steps that use it
+	if err := h.db.Images().Delete(ctx, request.RecipeID, request.Name); err != nil {
+		return nil, fmt.Errorf("failed to delete details of image: %w", err)
+	}
 
 	// Update main image if necessary
 	if err := h.setMainImageIfNecessary(ctx, request.RecipeID, &request.Name); err != nil {
@@ -94,55 +215,236 @@ func (h apiHandler) OptimizeImage(ctx context.Context, request OptimizeImageRequ
 		return OptimizeImage400Response{}, nil
 	}
 
-	// Load the current original
-	data, err := h.upl.Load(request.RecipeID, request.Name)
+	names, err := h.upl.List(request.RecipeID)
 	if err != nil {
-		if errors.Is(err, db.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
-			return OptimizeImage404Response{}, nil
+		return nil, err
+	}
+	if !slices.Contains(names, request.Name) {
+		return OptimizeImage404Response{}, nil
+	}
+
+	job, err := h.enqueueJob(ctx, models.JobOptimizeImage, imageJobPayload{RecipeID: request.RecipeID, Name: request.Name}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return OptimizeImage202JSONResponse{
+		Body: *job,
+		Headers: OptimizeImage202ResponseHeaders{
+			Location: getJobLocation(job),
+		},
+	}, nil
+}
+
+// runOptimizeImage optimizes an existing image of a recipe, as the work of a job.
+// The result is the URL of the optimized image.
+func (h apiHandler) runOptimizeImage(ctx context.Context, task *jobs.Task) (string, error) {
+	var payload imageJobPayload
+	if err := task.Decode(&payload); err != nil {
+		return "", err
+	}
+
+	res, err := h.optimizeImage(ctx, payload.RecipeID, payload.Name)
+	if err != nil {
+		// The image may have been deleted since the job was queued
+		return "", asPermanentJobError(err, db.ErrNotFound, fs.ErrNotExist, fileaccess.ErrInvalidContentType)
+	}
+
+	return res.URL, nil
+}
+
+func (h apiHandler) OptimizeAllImages(ctx context.Context, _ OptimizeAllImagesRequestObject) (OptimizeAllImagesResponseObject, error) {
+	job, err := h.enqueueJob(ctx, models.JobOptimizeAllImages, struct{}{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return OptimizeAllImages202JSONResponse{
+		Body: *job,
+		Headers: OptimizeAllImages202ResponseHeaders{
+			Location: getJobLocation(job),
+		},
+	}, nil
+}
+
+// runOptimizeAllImages optimizes all the images of all recipes, as the work of a job.
+// Images that fail to optimize are skipped, and the result is a JSON encoded report of what was done.
+func (h apiHandler) runOptimizeAllImages(ctx context.Context, task *jobs.Task) (string, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	// Only recipes that have a directory in the upload store can have images,
+	// and those of deleted recipes are left to the upload check
+	uploadedRecipeIDs, err := h.upl.ListRecipeIDs()
+	if err != nil {
+		return "", err
+	}
+	allRecipeIDs, err := h.db.Recipes().ListIDs(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list recipes: %w", err)
+	}
+	recipeIDs := lo.Intersect(uploadedRecipeIDs, allRecipeIDs)
+
+	// Find all the images up front, so that progress can be reported as they're optimized
+	type recipeImage struct {
+		recipeID int64
+		name     string
+	}
+	images := make([]recipeImage, 0)
+	for _, recipeID := range recipeIDs {
+		names, err := h.upl.List(recipeID)
+		if err != nil {
+			return "", err
 		}
-		logger.ErrorContext(ctx, "Failed to optimize image",
-			"error", err,
-			"recipe-id", request.RecipeID,
-			"image-name", request.Name)
+		for _, name := range names {
+			images = append(images, recipeImage{recipeID, name})
+		}
+	}
+
+	report := models.ImageOptimizationReport{
+		Total:    len(images),
+		Failures: make([]models.ImageOptimizationFailure, 0),
+	}
+	for i, image := range images {
+		res, err := h.optimizeImage(ctx, image.recipeID, image.name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			logger.WarnContext(ctx, "Failed to optimize image. Skipping...",
+				"error", err,
+				"recipe-id", image.recipeID,
+				"image-name", image.name)
+			report.Failures = append(report.Failures, models.ImageOptimizationFailure{
+				RecipeID: image.recipeID,
+				Name:     image.name,
+				Error:    err.Error(),
+			})
+		} else {
+			report.Optimized++
+			if res.Name != image.name {
+				report.Renamed++
+			}
+		}
+		task.SetProgress((i + 1) * 100 / len(images))
+	}
+
+	result, err := json.Marshal(report)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode report: %w", err)
+	}
+	return string(result), nil
+}
+
+// optimizeImage re-saves an existing image of a recipe using the current image settings,
+// and updates anything that refers to it if its name changes as a result
+func (h apiHandler) optimizeImage(ctx context.Context, recipeID int64, name string) (*fileaccess.SaveResult, error) {
+	// Load the current original
+	data, err := h.upl.Load(recipeID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load image '%s' of recipe %d: %w", name, recipeID, err)
+	}
+
+	// Keep the image in its place, even if it didn't have details
+	if err := h.saveImageOrderIfNecessary(ctx, recipeID); err != nil {
 		return nil, err
 	}
 
 	// Resave it, which will downscale if larger than the threshold,
 	// as well as regenerate the thumbnail
-	res, err := h.upl.Save(request.RecipeID, request.Name, data)
+	res, err := h.upl.Save(ctx, recipeID, data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to re-save image data: %w", err)
 	}
 
-	// The name may have changed if the original was not in the current optimized format
-	if request.Name != res.Name {
+	// The name changes along with the content, e.g., if the original was not in the current optimized format
+	if name != res.Name {
 		// Delete the original image
-		if err := h.upl.Delete(request.RecipeID, request.Name); err != nil {
+		if err := h.upl.Delete(ctx, recipeID, name); err != nil {
 			return nil, fmt.Errorf("failed to delete original image file: %w", err)
 		}
+		// This also renames the image in any notes and steps that use it
+		if err := h.db.Images().Rename(ctx, recipeID, name, res.Name); err != nil {
+			return nil, fmt.Errorf("failed to rename details of image: %w", err)
+		}
 
-		recipe, err := h.db.Recipes().Read(ctx, request.RecipeID)
+		recipe, err := h.db.Recipes().Read(ctx, recipeID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get recipe %d: %w", request.RecipeID, err)
+			return nil, fmt.Errorf("failed to get recipe %d: %w", recipeID, err)
 		}
-		if recipe.MainImageName == request.Name {
+		if recipe.MainImageName == name {
 			// Update the main image name if it was pointing to the original
-			recipe.MainImageName = res.Name
-			if err := h.db.Recipes().Update(ctx, recipe); err != nil {
-				return nil, fmt.Errorf("failed to update recipe %d with new main image name: %w", request.RecipeID, err)
+			if err := h.db.Recipes().Patch(ctx, recipeID, &models.RecipePatch{MainImageName: &res.Name}); err != nil {
+				return nil, fmt.Errorf("failed to update recipe %d with new image name: %w", recipeID, err)
 			}
 		}
 	}
 
-	return OptimizeImage204Response{
-		Headers: OptimizeImage204ResponseHeaders{
-			Location: res.URL,
-		},
-	}, nil
+	if err := h.db.Images().Create(ctx, recipeID, &models.RecipeImage{Name: res.Name, Width: &res.Width, Height: &res.Height}); err != nil {
+		return nil, fmt.Errorf("failed to save details of image: %w", err)
+	}
+
+	return res, nil
+}
+
+// listImages returns the images of the recipe along with their details, in order.
+// Images without details, e.g., those uploaded before details were recorded, follow the others
+// in the order they are listed in the upload store, and missingDetails is true if there are any.
+func (h apiHandler) listImages(ctx context.Context, recipeID int64) (images []models.RecipeImage, missingDetails bool, err error) {
+	files, err := h.upl.ListImages(recipeID)
+	if err != nil {
+		return nil, false, err
+	}
+	details, err := h.db.Images().List(ctx, recipeID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list details of images: %w", err)
+	}
+
+	images = make([]models.RecipeImage, 0, len(files))
+	for _, detail := range *details {
+		// Details may remain for files that were removed outside of the application
+		index := slices.IndexFunc(files, func(file models.RecipeImage) bool { return file.Name == detail.Name })
+		if index < 0 {
+			continue
+		}
+		detail.URL = files[index].URL
+		detail.ThumbnailURL = files[index].ThumbnailURL
+		detail.Variants = files[index].Variants
+		images = append(images, detail)
+		files = slices.Delete(files, index, index+1)
+	}
+	images = append(images, files...)
+
+	// The order is reported as it is, regardless of any gaps in what's stored
+	for i := range images {
+		images[i].SortOrder = new(i)
+	}
+
+	return images, len(files) > 0, nil
+}
+
+// saveImageOrderIfNecessary stores the current order of the images of the recipe
+// if any of them are missing details, so that they keep their place as the images change
+func (h apiHandler) saveImageOrderIfNecessary(ctx context.Context, recipeID int64) error {
+	images, missingDetails, err := h.listImages(ctx, recipeID)
+	if err != nil {
+		return fmt.Errorf("failed to list images for recipe %d: %w", recipeID, err)
+	}
+	if !missingDetails {
+		return nil
+	}
+	return h.saveImageOrder(ctx, recipeID, images)
+}
+
+func (h apiHandler) saveImageOrder(ctx context.Context, recipeID int64, images []models.RecipeImage) error {
+	names := lo.Map(images, func(image models.RecipeImage, _ int) string { return image.Name })
+	if err := h.db.Images().Reorder(ctx, recipeID, names); err != nil {
+		return fmt.Errorf("failed to save order of images for recipe %d: %w", recipeID, err)
+	}
+	return nil
 }
 
 func (h apiHandler) setMainImageIfNecessary(ctx context.Context, recipeID int64, justDeletedImageName *string) error {
-	images, err := h.upl.List(recipeID)
+	images, _, err := h.listImages(ctx, recipeID)
 	if err != nil {
 		return fmt.Errorf("failed to list images for recipe %d: %w", recipeID, err)
 	}
@@ -156,7 +458,7 @@ func (h apiHandler) setMainImageIfNecessary(ctx context.Context, recipeID int64,
 		recipe.MainImageName = ""
 		saveNeeded = true
 	} else if len(images) > 0 && (recipe.MainImageName == "" || (justDeletedImageName != nil && recipe.MainImageName == *justDeletedImageName)) {
-		recipe.MainImageName = images[0]
+		recipe.MainImageName = images[0].Name
 		saveNeeded = true
 	}
 
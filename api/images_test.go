@@ -2,21 +2,28 @@ package api
 
 import (
 	"bytes"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"image"
 	"image/jpeg"
 	"io"
 	"io/fs"
 	"mime/multipart"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"testing"
 	"testing/fstest"
 	"time"
 
+	"github.com/chadweimer/gomp/db"
 	"github.com/chadweimer/gomp/fileaccess"
+	"github.com/chadweimer/gomp/jobs"
 	dbmock "github.com/chadweimer/gomp/mocks/db"
 	fileaccessmock "github.com/chadweimer/gomp/mocks/fileaccess"
 	"github.com/chadweimer/gomp/models"
-	"github.com/samber/lo"
 	"go.uber.org/mock/gomock"
 )
 
@@ -24,9 +31,11 @@ func Test_GetImages(t *testing.T) {
 	type testArgs struct {
 		name             string
 		recipeID         int64
-		images           []string
 		mockFS           fstest.MapFS
+		mockRefs         fstest.MapFS
 		fsError          error
+		variants         fstest.MapFS
+		details          []models.RecipeImage
 		expectedError    error
 		expectedResponse GetImagesResponseObject
 	}
@@ -35,17 +44,95 @@ func Test_GetImages(t *testing.T) {
 		{
 			name:     "Nominal",
 			recipeID: 1,
-			images:   []string{"plated-dish.jpg"},
 			mockFS: fstest.MapFS{
 				"plated-dish.jpg": &fstest.MapFile{
-					Data:    []byte{},
+					Data:    []byte("image"),
 					Mode:    fs.ModeAppend,
 					ModTime: time.Now(),
 				},
 			},
-			fsError:          nil,
-			expectedError:    nil,
-			expectedResponse: GetImages200JSONResponse([]string{"plated-dish.jpg"}),
+			fsError:       nil,
+			expectedError: nil,
+			expectedResponse: GetImages200JSONResponse([]models.RecipeImage{
+				{
+					Name:         "plated-dish.jpg",
+					URL:          "/uploads/recipes/1/images/plated-dish.jpg",
+					ThumbnailURL: "/uploads/recipes/1/thumbs/plated-dish.jpg",
+					Variants:     []models.ImageVariant{},
+					SortOrder:    new(0),
+				},
+			}),
+		},
+		{
+			name:     "With Variants",
+			recipeID: 1,
+			mockRefs: fstest.MapFS{
+				"0123.jpeg": &fstest.MapFile{
+					Data:    []byte{},
+					ModTime: time.Now(),
+				},
+			},
+			variants: fstest.MapFS{
+				"640.webp": &fstest.MapFile{Data: []byte("webp")},
+				"320.webp": &fstest.MapFile{Data: []byte("webp")},
+			},
+			fsError:       nil,
+			expectedError: nil,
+			expectedResponse: GetImages200JSONResponse([]models.RecipeImage{
+				{
+					Name:         "0123.jpeg",
+					URL:          "/uploads/recipes/1/images/0123.jpeg",
+					ThumbnailURL: "/uploads/recipes/1/thumbs/0123.jpeg",
+					Variants: []models.ImageVariant{
+						{URL: "/uploads/recipes/1/variants/0123.jpeg/320.webp", Width: 320, Type: "image/webp"},
+						{URL: "/uploads/recipes/1/variants/0123.jpeg/640.webp", Width: 640, Type: "image/webp"},
+					},
+					SortOrder: new(0),
+				},
+			}),
+		},
+		{
+			name:     "With Details",
+			recipeID: 1,
+			mockFS: fstest.MapFS{
+				"a.jpg": &fstest.MapFile{Data: []byte("image")},
+				"b.jpg": &fstest.MapFile{Data: []byte("image")},
+				"c.jpg": &fstest.MapFile{Data: []byte("image")},
+			},
+			details: []models.RecipeImage{
+				{Name: "c.jpg", Caption: "Plated", AltText: "A plate of food", SortOrder: new(0), Width: new(640), Height: new(480)},
+				{Name: "removed.jpg", SortOrder: new(1)},
+				{Name: "a.jpg", SortOrder: new(2)},
+			},
+			fsError:       nil,
+			expectedError: nil,
+			expectedResponse: GetImages200JSONResponse([]models.RecipeImage{
+				{
+					Name:         "c.jpg",
+					URL:          "/uploads/recipes/1/images/c.jpg",
+					ThumbnailURL: "/uploads/recipes/1/thumbs/c.jpg",
+					Variants:     []models.ImageVariant{},
+					Caption:      "Plated",
+					AltText:      "A plate of food",
+					SortOrder:    new(0),
+					Width:        new(640),
+					Height:       new(480),
+				},
+				{
+					Name:         "a.jpg",
+					URL:          "/uploads/recipes/1/images/a.jpg",
+					ThumbnailURL: "/uploads/recipes/1/thumbs/a.jpg",
+					Variants:     []models.ImageVariant{},
+					SortOrder:    new(1),
+				},
+				{
+					Name:         "b.jpg",
+					URL:          "/uploads/recipes/1/images/b.jpg",
+					ThumbnailURL: "/uploads/recipes/1/thumbs/b.jpg",
+					Variants:     []models.ImageVariant{},
+					SortOrder:    new(2),
+				},
+			}),
 		},
 		{
 			name:             "Not Found",
@@ -53,7 +140,7 @@ func Test_GetImages(t *testing.T) {
 			mockFS:           nil,
 			fsError:          fs.ErrNotExist,
 			expectedError:    nil,
-			expectedResponse: GetImages200JSONResponse([]string{}),
+			expectedResponse: GetImages200JSONResponse([]models.RecipeImage{}),
 		},
 		{
 			name:             "FS Error",
@@ -70,12 +157,30 @@ func Test_GetImages(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			api, _, uplDriver := getMockImagesAPI(ctrl)
+			api, _, imageDriver, uplDriver, _ := getMockImagesAPI(ctrl)
+			if test.fsError == nil || errors.Is(test.fsError, fs.ErrNotExist) {
+				details := test.details
+				if details == nil {
+					details = []models.RecipeImage{}
+				}
+				imageDriver.EXPECT().List(gomock.Any(), test.recipeID).Return(&details, nil)
+			}
+			recipeDir := filepath.Join("uploads", "recipes", strconv.FormatInt(test.recipeID, 10))
 			if test.fsError != nil {
-				uplDriver.EXPECT().List(gomock.Any()).Return(nil, test.fsError)
+				uplDriver.EXPECT().List(filepath.Join(recipeDir, "images")).Return(nil, test.fsError)
+				if errors.Is(test.fsError, fs.ErrNotExist) {
+					uplDriver.EXPECT().List(filepath.Join(recipeDir, "refs")).Return(nil, test.fsError)
+				}
 			} else {
 				entries, _ := test.mockFS.ReadDir(".")
-				uplDriver.EXPECT().List(gomock.Any()).Return(entries, nil)
+				uplDriver.EXPECT().List(filepath.Join(recipeDir, "images")).Return(entries, nil)
+				refEntries, _ := test.mockRefs.ReadDir(".")
+				uplDriver.EXPECT().List(filepath.Join(recipeDir, "refs")).Return(refEntries, nil)
+				// Only referenced images have variants, and no image is checked for a reference separately
+				variants, _ := test.variants.ReadDir(".")
+				for _, entry := range refEntries {
+					uplDriver.EXPECT().List(filepath.Join("uploads", "content", "variants", entry.Name())).Return(variants, nil)
+				}
 			}
 
 			// Act
@@ -84,44 +189,203 @@ func Test_GetImages(t *testing.T) {
 			// Assert
 			if !errors.Is(err, test.expectedError) {
 				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
-			} else if err == nil {
-				switch expected := test.expectedResponse.(type) {
-				case GetImages200JSONResponse:
-					got, ok := resp.(GetImages200JSONResponse)
-					if !ok {
-						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
-					}
-					if len(got) != len(expected) {
-						t.Errorf("expected length: %d, actual length: %d", len(expected), len(got))
-					}
-					missingImages, unexpectedImages := lo.Difference(got, expected)
-					if len(missingImages) > 0 {
-						t.Errorf("missing images: %v", missingImages)
-					}
-					if len(unexpectedImages) > 0 {
-						t.Errorf("unexpected images: %v", unexpectedImages)
-					}
-				case GetImages404Response:
-					if _, ok := resp.(GetImages404Response); !ok {
-						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
-					}
-				default:
-					t.Errorf("unexpected response type %T", resp)
-				}
+			} else if err == nil && !reflect.DeepEqual(resp, test.expectedResponse) {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
+
+func Test_ReorderImages(t *testing.T) {
+	type testArgs struct {
+		name             string
+		images           []string
+		names            []string
+		dbError          error
+		expectedError    error
+		expectedResponse ReorderImagesResponseObject
+	}
+
+	tests := []testArgs{
+		{"Nominal", []string{"a.jpeg", "b.jpeg", "c.jpeg"}, []string{"c.jpeg", "a.jpeg", "b.jpeg"}, nil, nil, ReorderImages204Response{}},
+		{"Missing Image", []string{"a.jpeg", "b.jpeg"}, []string{"b.jpeg"}, nil, nil, ReorderImages400Response{}},
+		{"Unknown Image", []string{"a.jpeg", "b.jpeg"}, []string{"b.jpeg", "x.jpeg"}, nil, nil, ReorderImages400Response{}},
+		{"Duplicate Image", []string{"a.jpeg", "b.jpeg"}, []string{"b.jpeg", "b.jpeg"}, nil, nil, ReorderImages400Response{}},
+		{"No Images", []string{}, []string{}, nil, nil, ReorderImages404Response{}},
+		{"DB Error", []string{"a.jpeg", "b.jpeg"}, []string{"b.jpeg", "a.jpeg"}, sql.ErrConnDone, sql.ErrConnDone, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, _, imageDriver, uplDriver, _ := getMockImagesAPI(ctrl)
+			expectMockImages(t, uplDriver, 1, test.images...)
+			imageDriver.EXPECT().List(gomock.Any(), int64(1)).Return(&[]models.RecipeImage{}, nil)
+			if _, ok := test.expectedResponse.(ReorderImages204Response); ok || test.dbError != nil {
+				imageDriver.EXPECT().Reorder(gomock.Any(), int64(1), test.names).Return(test.dbError)
+			}
+
+			// Act
+			resp, err := api.ReorderImages(t.Context(), ReorderImagesRequestObject{RecipeID: 1, Body: &test.names})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			} else if err == nil && !reflect.DeepEqual(resp, test.expectedResponse) {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
+
+func Test_UpdateImage(t *testing.T) {
+	type testArgs struct {
+		name             string
+		imageName        string
+		details          []models.RecipeImage
+		expectReorder    bool
+		dbError          error
+		expectedError    error
+		expectedResponse UpdateImageResponseObject
+	}
+
+	tests := []testArgs{
+		{
+			name:             "Nominal",
+			imageName:        "b.jpeg",
+			details:          []models.RecipeImage{{Name: "b.jpeg"}, {Name: "a.jpeg"}},
+			expectedResponse: UpdateImage204Response{},
+		},
+		{
+			name:             "Missing Details",
+			imageName:        "b.jpeg",
+			details:          []models.RecipeImage{{Name: "b.jpeg"}},
+			expectReorder:    true,
+			expectedResponse: UpdateImage204Response{},
+		},
+		{
+			name:             "Not Found",
+			imageName:        "x.jpeg",
+			details:          []models.RecipeImage{},
+			expectedResponse: UpdateImage404Response{},
+		},
+		{
+			name:             "Unsafe Name",
+			imageName:        "../a.jpeg",
+			expectedResponse: UpdateImage400Response{},
+		},
+		{
+			name:          "DB Error",
+			imageName:     "a.jpeg",
+			details:       []models.RecipeImage{{Name: "b.jpeg"}, {Name: "a.jpeg"}},
+			dbError:       sql.ErrConnDone,
+			expectedError: sql.ErrConnDone,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, _, imageDriver, uplDriver, _ := getMockImagesAPI(ctrl)
+			info := models.RecipeImageInfo{Caption: "Caption", AltText: "Alt text"}
+			if test.details != nil {
+				expectMockImages(t, uplDriver, 1, "a.jpeg", "b.jpeg")
+				imageDriver.EXPECT().List(gomock.Any(), int64(1)).Return(&test.details, nil)
+			}
+			if test.expectReorder {
+				// The image without details keeps its place after the others
+				imageDriver.EXPECT().Reorder(gomock.Any(), int64(1), []string{"b.jpeg", "a.jpeg"}).Return(nil)
+			}
+			if _, ok := test.expectedResponse.(UpdateImage204Response); ok || test.dbError != nil {
+				imageDriver.EXPECT().Update(gomock.Any(), int64(1), test.imageName, &info).Return(test.dbError)
+			}
+
+			// Act
+			resp, err := api.UpdateImage(t.Context(), UpdateImageRequestObject{RecipeID: 1, Name: test.imageName, Body: &info})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			} else if err == nil && !reflect.DeepEqual(resp, test.expectedResponse) {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
 			}
 		})
 	}
 }
 
 func Test_UploadImage(t *testing.T) {
+	type testArgs struct {
+		name             string
+		content          []byte
+		readError        error
+		expectQueued     bool
+		expectedResponse UploadImageResponseObject
+	}
+
+	imageBuf := bytes.NewBuffer([]byte{})
+	jpeg.Encode(imageBuf, image.NewGray(image.Rect(0, 0, 1, 1)), nil)
+
+	tests := []testArgs{
+		{"Nominal", imageBuf.Bytes(), nil, true, UploadImage202JSONResponse{}},
+		{"Not an Image", []byte("not an image"), nil, false, UploadImage400Response{}},
+		{"Recipe Not Found", imageBuf.Bytes(), db.ErrNotFound, false, UploadImage404Response{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, dbDriver, _, _, _ := getMockImagesAPI(ctrl)
+			queue, jobDriver := getMockJobQueue(t, ctrl)
+			api.jobs = queue
+			if test.expectedResponse != (UploadImage400Response{}) {
+				dbDriver.EXPECT().Read(gomock.Any(), int64(1)).Return(&models.Recipe{ID: new(int64(1))}, test.readError)
+			}
+			if test.expectQueued {
+				expectJobQueued(jobDriver, models.JobUploadImage, gomock.Eq(`{"recipeId":1}`), test.content)
+			}
+			buf := bytes.NewBuffer([]byte{})
+			writer := multipart.NewWriter(buf)
+			part, _ := writer.CreateFormFile("fileupload", "img.jpeg")
+			part.Write(test.content)
+			writer.Close()
+
+			// Act
+			resp, err := api.UploadImage(t.Context(), UploadImageRequestObject{RecipeID: 1, Body: multipart.NewReader(buf, writer.Boundary())})
+
+			// Assert
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if got, ok := resp.(UploadImage202JSONResponse); ok {
+				if _, ok := test.expectedResponse.(UploadImage202JSONResponse); !ok {
+					t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
+				}
+				if got.Headers.Location != "/api/v1/jobs/7" || *got.Body.ID != 7 {
+					t.Errorf("unexpected job: %v, %v", got.Headers.Location, got.Body)
+				}
+			} else if !reflect.DeepEqual(resp, test.expectedResponse) {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
+
+func Test_runUploadImage(t *testing.T) {
 	type testArgs struct {
 		name                  string
 		recipe                models.Recipe
+		userID                *int64
 		mockFS                fstest.MapFS
 		expectUpdateMainImage bool
+		readError             error
 		saveError             error
 		expectedError         error
-		expectedResponse      UploadImageResponseObject
+		expectPermanent       bool
 	}
 
 	tests := []testArgs{
@@ -131,6 +395,7 @@ func Test_UploadImage(t *testing.T) {
 				ID:            new(int64(1)),
 				MainImageName: "some-image.jpeg",
 			},
+			userID: new(int64(5)),
 			mockFS: fstest.MapFS{
 				"new-image.jpg": &fstest.MapFile{
 					Data:    []byte{},
@@ -139,9 +404,6 @@ func Test_UploadImage(t *testing.T) {
 				},
 			},
 			expectUpdateMainImage: false,
-			saveError:             nil,
-			expectedError:         nil,
-			expectedResponse:      UploadImage201Response{},
 		},
 		{
 			name: "No Main Image",
@@ -156,29 +418,23 @@ func Test_UploadImage(t *testing.T) {
 				},
 			},
 			expectUpdateMainImage: true,
-			saveError:             nil,
-			expectedError:         nil,
-			expectedResponse:      UploadImage201Response{},
 		},
 		{
-			name: "Not Found",
+			name: "Recipe Deleted",
 			recipe: models.Recipe{
 				ID: new(int64(2)),
 			},
-			expectUpdateMainImage: false,
-			saveError:             fs.ErrNotExist,
-			expectedError:         nil,
-			expectedResponse:      UploadImage404Response{},
+			readError:       db.ErrNotFound,
+			expectedError:   db.ErrNotFound,
+			expectPermanent: true,
 		},
 		{
 			name: "Save Error",
 			recipe: models.Recipe{
 				ID: new(int64(3)),
 			},
-			expectUpdateMainImage: false,
-			saveError:             io.ErrClosedPipe,
-			expectedError:         io.ErrClosedPipe,
-			expectedResponse:      nil,
+			saveError:     io.ErrClosedPipe,
+			expectedError: io.ErrClosedPipe,
 		},
 	}
 	for _, test := range tests {
@@ -187,47 +443,66 @@ func Test_UploadImage(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			api, dbDriver, uplDriver := getMockImagesAPI(ctrl)
+			api, dbDriver, imageDriver, uplDriver, imageRefs := getMockImagesAPI(ctrl)
+			if test.readError != nil {
+				dbDriver.EXPECT().Read(gomock.Any(), *test.recipe.ID).Return(nil, test.readError)
+			} else {
+				dbDriver.EXPECT().Read(gomock.Any(), *test.recipe.ID).Return(&test.recipe, nil)
+
+				// Any existing images are stored in the recipe's directories, and don't have details
+				entries, _ := test.mockFS.ReadDir(".")
+				names := make([]string, 0, len(entries))
+				for _, entry := range entries {
+					names = append(names, entry.Name())
+				}
+				uplDriver.EXPECT().List(filepath.Join("uploads", "recipes", strconv.FormatInt(*test.recipe.ID, 10), "images")).
+					AnyTimes().Return(entries, nil)
+				uplDriver.EXPECT().List(gomock.Any()).AnyTimes().Return(nil, fs.ErrNotExist)
+				imageDriver.EXPECT().List(gomock.Any(), *test.recipe.ID).AnyTimes().Return(&[]models.RecipeImage{}, nil)
+				if len(names) > 0 {
+					imageDriver.EXPECT().Reorder(gomock.Any(), *test.recipe.ID, names).Return(nil)
+				}
+				// Nothing is stored yet
+				uplDriver.EXPECT().Stat(gomock.Any()).AnyTimes().Return(nil, fs.ErrNotExist)
+			}
+			if test.readError == nil {
+				imageRefs.EXPECT().Lock(gomock.Any(), gomock.Any()).Return(func() {}, nil)
+			}
 			if test.saveError != nil {
 				uplDriver.EXPECT().Save(gomock.Any(), gomock.Any()).Return(test.saveError)
-			} else {
+			} else if test.readError == nil {
+				imageRefs.EXPECT().Add(gomock.Any(), gomock.Any(), *test.recipe.ID).Return(nil)
+				uplDriver.EXPECT().Open(gomock.Any()).AnyTimes().Return(nil, fs.ErrNotExist)
 				uplDriver.EXPECT().Save(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
-				entries, _ := test.mockFS.ReadDir(".")
-				uplDriver.EXPECT().List(gomock.Any()).Return(entries, nil)
+				// Any existing variants are replaced
+				uplDriver.EXPECT().DeleteAll(gomock.Any()).Return(nil)
+				imageDriver.EXPECT().Create(gomock.Any(), *test.recipe.ID, gomock.Cond(func(image *models.RecipeImage) bool {
+					return image.Name != "" && *image.Width == 1 && *image.Height == 1 && reflect.DeepEqual(image.UploadedBy, test.userID)
+				})).Return(nil)
 				dbDriver.EXPECT().Read(gomock.Any(), gomock.Any()).Return(&test.recipe, nil)
 				if test.expectUpdateMainImage {
 					dbDriver.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
 				}
 			}
 			buf := bytes.NewBuffer([]byte{})
-			writer := multipart.NewWriter(buf)
-			part, err := writer.CreateFormFile("fileupload", "img.jpeg")
-			jpeg.Encode(part, image.NewGray(image.Rect(0, 0, 1, 1)), nil)
-			writer.Close()
+			jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 1, 1)), nil)
+			task := &jobs.Task{
+				Job:     models.Job{ID: new(int64(7)), Kind: models.JobUploadImage, CreatedBy: test.userID},
+				Payload: fmt.Sprintf(`{"recipeId":%d}`, *test.recipe.ID),
+				Data:    buf.Bytes(),
+			}
 
 			// Act
-			resp, err := api.UploadImage(t.Context(), UploadImageRequestObject{RecipeID: *test.recipe.ID, Body: multipart.NewReader(buf, writer.Boundary())})
+			result, err := api.runUploadImage(t.Context(), task)
 
 			// Assert
 			if !errors.Is(err, test.expectedError) {
 				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
-			} else if err == nil {
-				switch test.expectedResponse.(type) {
-				case UploadImage201Response:
-					got, ok := resp.(UploadImage201Response)
-					if !ok {
-						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
-					}
-					if got.Headers.Location == "" {
-						t.Error("expected non-empty Location header")
-					}
-				case UploadImage404Response:
-					if _, ok := resp.(UploadImage404Response); !ok {
-						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
-					}
-				default:
-					t.Errorf("unexpected response type %T", resp)
-				}
+			} else if err == nil && result == "" {
+				t.Error("expected the URL of the image")
+			}
+			if err != nil && jobs.IsPermanent(err) != test.expectPermanent {
+				t.Errorf("expected permanent error: %v, received error: %v", test.expectPermanent, err)
 			}
 		})
 	}
@@ -238,6 +513,7 @@ func Test_DeleteImage(t *testing.T) {
 		name                  string
 		recipe                models.Recipe
 		imageName             string
+		referenced            bool
 		expectDelete          bool
 		expectUpdateMainImage bool
 		deleteError           error
@@ -256,6 +532,17 @@ func Test_DeleteImage(t *testing.T) {
 			expectedError:         nil,
 			expectedResponse:      DeleteImage204Response{},
 		},
+		{
+			name:                  "Referenced",
+			recipe:                models.Recipe{ID: new(int64(1))},
+			imageName:             "0123.jpeg",
+			referenced:            true,
+			expectDelete:          true,
+			expectUpdateMainImage: false,
+			deleteError:           nil,
+			expectedError:         nil,
+			expectedResponse:      DeleteImage204Response{},
+		},
 		{
 			name:                  "Not Found",
 			recipe:                models.Recipe{ID: new(int64(2))},
@@ -308,14 +595,28 @@ func Test_DeleteImage(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			api, dbDriver, uplDriver := getMockImagesAPI(ctrl)
+			api, dbDriver, imageDriver, uplDriver, imageRefs := getMockImagesAPI(ctrl)
+			refPath := filepath.Join("uploads", "recipes", strconv.FormatInt(*test.recipe.ID, 10), "refs", test.imageName)
 			if test.deleteError != nil {
+				uplDriver.EXPECT().Stat(refPath).Return(nil, fs.ErrNotExist)
 				uplDriver.EXPECT().Delete(gomock.Any()).Return(test.deleteError)
 			} else {
 				if test.expectDelete {
-					// 2 times; once for original, once for thumbnail
-					uplDriver.EXPECT().Delete(gomock.Any()).Times(2).Return(nil)
-					uplDriver.EXPECT().List(gomock.Any())
+					if test.referenced {
+						// Other recipes still reference the image, so only the reference is removed
+						uplDriver.EXPECT().Stat(refPath).Return(getMockImageInfo(t), nil)
+						imageRefs.EXPECT().Lock(gomock.Any(), test.imageName).Return(func() {}, nil)
+						uplDriver.EXPECT().Delete(refPath).Return(nil)
+						imageRefs.EXPECT().Remove(gomock.Any(), test.imageName, *test.recipe.ID).Return(int64(1), nil)
+					} else {
+						// Stored in the recipe's directories, rather than referenced
+						uplDriver.EXPECT().Stat(refPath).Return(nil, fs.ErrNotExist)
+						// 2 times; once for original, once for thumbnail
+						uplDriver.EXPECT().Delete(gomock.Any()).Times(2).Return(nil)
+					}
+					imageDriver.EXPECT().Delete(gomock.Any(), *test.recipe.ID, test.imageName).Return(nil)
+					uplDriver.EXPECT().List(gomock.Any()).Times(2)
+					imageDriver.EXPECT().List(gomock.Any(), *test.recipe.ID).Return(&[]models.RecipeImage{}, nil)
 					dbDriver.EXPECT().Read(gomock.Any(), gomock.Any()).Return(&test.recipe, nil)
 				}
 				if test.expectUpdateMainImage {
@@ -352,18 +653,67 @@ func Test_DeleteImage(t *testing.T) {
 }
 
 func Test_OptimizeImage(t *testing.T) {
+	type testArgs struct {
+		name             string
+		imageName        string
+		expectQueued     bool
+		expectedResponse OptimizeImageResponseObject
+	}
+
+	tests := []testArgs{
+		{"Nominal", "img.jpeg", true, OptimizeImage202JSONResponse{}},
+		{"Unsafe Name", "../img.jpeg", false, OptimizeImage400Response{}},
+		{"Not Found", "other.jpeg", false, OptimizeImage404Response{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, _, _, uplDriver, _ := getMockImagesAPI(ctrl)
+			queue, jobDriver := getMockJobQueue(t, ctrl)
+			api.jobs = queue
+			if test.expectedResponse != (OptimizeImage400Response{}) {
+				expectMockImages(t, uplDriver, 1, "img.jpeg")
+			}
+			if test.expectQueued {
+				expectJobQueued(jobDriver, models.JobOptimizeImage, gomock.Eq(`{"recipeId":1,"name":"img.jpeg"}`), nil)
+			}
+
+			// Act
+			resp, err := api.OptimizeImage(t.Context(), OptimizeImageRequestObject{RecipeID: 1, Name: test.imageName})
+
+			// Assert
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if got, ok := resp.(OptimizeImage202JSONResponse); ok {
+				if _, ok := test.expectedResponse.(OptimizeImage202JSONResponse); !ok {
+					t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
+				}
+				if got.Headers.Location != "/api/v1/jobs/7" || *got.Body.ID != 7 {
+					t.Errorf("unexpected job: %v, %v", got.Headers.Location, got.Body)
+				}
+			} else if !reflect.DeepEqual(resp, test.expectedResponse) {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
+
+func Test_runOptimizeImage(t *testing.T) {
 	type testArgs struct {
 		name               string
 		recipeID           int64
 		originalName       string
-		expectedName       string
 		expectOpen         bool
 		expectSave         bool
 		expectRecipeUpdate bool
+		notMainImage       bool
 		openError          error
 		saveError          error
 		expectedError      error
-		expectedResponse   OptimizeImageResponseObject
+		expectPermanent    bool
 	}
 
 	tests := []testArgs{
@@ -371,92 +721,80 @@ func Test_OptimizeImage(t *testing.T) {
 			name:               "Nominal",
 			recipeID:           1,
 			originalName:       "img.jpeg",
-			expectedName:       "img.jpeg",
 			expectOpen:         true,
 			expectSave:         true,
-			expectRecipeUpdate: false,
+			expectRecipeUpdate: true,
 			openError:          nil,
 			saveError:          nil,
 			expectedError:      nil,
-			expectedResponse:   OptimizeImage204Response{},
 		},
 		{
 			name:               "JPG Extension",
 			recipeID:           1,
 			originalName:       "img.jpg",
-			expectedName:       "img.jpg",
 			expectOpen:         true,
 			expectSave:         true,
-			expectRecipeUpdate: false,
+			expectRecipeUpdate: true,
 			openError:          nil,
 			saveError:          nil,
 			expectedError:      nil,
-			expectedResponse:   OptimizeImage204Response{},
 		},
 		{
 			name:               "PNG Format",
 			recipeID:           1,
 			originalName:       "img.png",
-			expectedName:       "img.jpeg",
 			expectOpen:         true,
 			expectSave:         true,
 			expectRecipeUpdate: true,
 			openError:          nil,
 			saveError:          nil,
 			expectedError:      nil,
-			expectedResponse:   OptimizeImage204Response{},
+		},
+		{
+			name:               "Not Main Image",
+			recipeID:           1,
+			originalName:       "img.png",
+			expectOpen:         true,
+			expectSave:         true,
+			expectRecipeUpdate: true,
+			notMainImage:       true,
+			openError:          nil,
+			saveError:          nil,
+			expectedError:      nil,
 		},
 		{
 			name:               "EOF on Open",
 			recipeID:           1,
 			originalName:       "img.jpeg",
-			expectedName:       "img.jpeg",
 			expectOpen:         true,
 			expectSave:         false,
 			expectRecipeUpdate: false,
 			openError:          io.ErrUnexpectedEOF,
 			saveError:          nil,
 			expectedError:      io.ErrUnexpectedEOF,
-			expectedResponse:   nil,
 		},
 		{
 			name:               "Closed Pipe on Save",
 			recipeID:           1,
 			originalName:       "img.jpeg",
-			expectedName:       "img.jpeg",
 			expectOpen:         true,
 			expectSave:         true,
 			expectRecipeUpdate: false,
 			openError:          nil,
 			saveError:          io.ErrClosedPipe,
 			expectedError:      io.ErrClosedPipe,
-			expectedResponse:   nil,
-		},
-		{
-			name:               "Unsafe Name",
-			recipeID:           1,
-			originalName:       "../img.jpeg",
-			expectedName:       "../img.jpeg",
-			expectOpen:         false,
-			expectSave:         false,
-			expectRecipeUpdate: false,
-			openError:          nil,
-			saveError:          nil,
-			expectedError:      nil,
-			expectedResponse:   OptimizeImage400Response{},
 		},
 		{
 			name:               "Not Found",
 			recipeID:           1,
 			originalName:       "img.jpeg",
-			expectedName:       "img.jpeg",
 			expectOpen:         true,
 			expectSave:         false,
 			expectRecipeUpdate: false,
 			openError:          fs.ErrNotExist,
 			saveError:          nil,
-			expectedError:      nil,
-			expectedResponse:   OptimizeImage404Response{},
+			expectedError:      fs.ErrNotExist,
+			expectPermanent:    true,
 		},
 	}
 	for _, test := range tests {
@@ -465,13 +803,18 @@ func Test_OptimizeImage(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			api, dbDriver, uplDriver := getMockImagesAPI(ctrl)
+			api, dbDriver, imageDriver, uplDriver, imageRefs := getMockImagesAPI(ctrl)
+			imagePath := "uploads/recipes/1/images/" + test.originalName
+			if test.expectOpen {
+				// The original is stored in the recipe's directories, rather than referenced
+				uplDriver.EXPECT().Stat("uploads/recipes/1/refs/"+test.originalName).Return(nil, fs.ErrNotExist).MinTimes(1)
+			}
 			if test.expectOpen && test.openError != nil {
-				uplDriver.EXPECT().Open(gomock.Any()).Return(nil, test.openError)
+				uplDriver.EXPECT().Open(imagePath).Return(nil, test.openError)
 			} else {
 				buf := bytes.NewBuffer([]byte{})
 				jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 1, 1)), nil)
-				fs := fstest.MapFS{
+				mockFS := fstest.MapFS{
 					test.originalName: &fstest.MapFile{
 						Data:    buf.Bytes(),
 						Mode:    fs.ModeAppend,
@@ -479,64 +822,216 @@ func Test_OptimizeImage(t *testing.T) {
 					},
 				}
 				if test.expectOpen {
-					uplDriver.EXPECT().Open(gomock.Any()).Return(fs.Open(test.originalName))
-				}
+					uplDriver.EXPECT().Open(imagePath).Return(mockFS.Open(test.originalName))
 
-				if test.originalName != test.expectedName {
-					uplDriver.EXPECT().Delete(gomock.Any()).Return(nil).Times(2)
+					// The original doesn't have details, so the order of the images is saved first
+					uplDriver.EXPECT().List("uploads/recipes/1/images").Return(mockFS.ReadDir("."))
+					uplDriver.EXPECT().List("uploads/recipes/1/refs").Return(nil, fs.ErrNotExist)
+					imageDriver.EXPECT().List(gomock.Any(), test.recipeID).Return(&[]models.RecipeImage{}, nil)
+					imageDriver.EXPECT().Reorder(gomock.Any(), test.recipeID, []string{test.originalName}).Return(nil)
 				}
 
 				if test.expectSave {
+					// The optimized image isn't stored yet
+					imageRefs.EXPECT().Lock(gomock.Any(), gomock.Not(test.originalName)).Return(func() {}, nil)
+					uplDriver.EXPECT().Stat(gomock.Any()).Return(nil, fs.ErrNotExist)
 					if test.saveError != nil {
 						uplDriver.EXPECT().Save(gomock.Any(), gomock.Any()).Return(test.saveError)
 					} else {
-						// 2 times; once for original, once for thumbnail
-						uplDriver.EXPECT().Save(gomock.Any(), gomock.Any()).Times(2).Return(nil)
+						// The image, its thumbnail, and the reference from the recipe
+						uplDriver.EXPECT().Save(gomock.Any(), gomock.Any()).Times(3).Return(nil)
+						uplDriver.EXPECT().DeleteAll(gomock.Any()).Return(nil)
+						imageRefs.EXPECT().Add(gomock.Any(), gomock.Not(test.originalName), test.recipeID).Return(nil)
 					}
 				}
 
 				if test.expectRecipeUpdate {
-					dbDriver.EXPECT().Read(gomock.Any(), gomock.Any()).Return(&models.Recipe{ID: new(test.recipeID), MainImageName: test.originalName}, nil)
-					dbDriver.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+					// The original is replaced by the optimized image, which is named by its content
+					uplDriver.EXPECT().Delete(gomock.Any()).Return(nil).Times(2)
+					// Renaming the details also renames the image in the notes and steps that use it
+					imageDriver.EXPECT().Rename(gomock.Any(), test.recipeID, test.originalName, gomock.Not(test.originalName)).Return(nil)
+					imageDriver.EXPECT().Create(gomock.Any(), test.recipeID, gomock.Cond(func(image *models.RecipeImage) bool {
+						return image.Name != test.originalName && *image.Width == 1 && *image.Height == 1
+					})).Return(nil)
+					mainImageName := test.originalName
+					if test.notMainImage {
+						mainImageName = "other.jpeg"
+					}
+					dbDriver.EXPECT().Read(gomock.Any(), gomock.Any()).Return(&models.Recipe{
+						ID:            new(test.recipeID),
+						MainImageName: mainImageName,
+					}, nil)
+					if !test.notMainImage {
+						dbDriver.EXPECT().Patch(gomock.Any(), test.recipeID, gomock.Cond(func(patch *models.RecipePatch) bool {
+							return patch.MainImageName != nil && *patch.MainImageName != test.originalName && patch.State == nil && patch.Rating == nil
+						})).Return(nil)
+					}
 				}
 			}
 
+			task := &jobs.Task{
+				Job:     models.Job{ID: new(int64(7)), Kind: models.JobOptimizeImage},
+				Payload: fmt.Sprintf(`{"recipeId":%d,"name":"%s"}`, test.recipeID, test.originalName),
+			}
+
 			// Act
-			resp, err := api.OptimizeImage(t.Context(), OptimizeImageRequestObject{RecipeID: test.recipeID, Name: test.originalName})
+			result, err := api.runOptimizeImage(t.Context(), task)
 
 			// Assert
 			if !errors.Is(err, test.expectedError) {
 				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
-			} else if err == nil {
-				switch test.expectedResponse.(type) {
-				case OptimizeImage204Response:
-					got, ok := resp.(OptimizeImage204Response)
-					if !ok {
-						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
-					}
-					if got.Headers.Location == "" {
-						t.Error("expected non-empty Location header")
-					}
-				case OptimizeImage400Response:
-					if _, ok := resp.(OptimizeImage400Response); !ok {
-						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
-					}
-				case OptimizeImage404Response:
-					if _, ok := resp.(OptimizeImage404Response); !ok {
-						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
-					}
-				default:
-					t.Errorf("unexpected response type %T", resp)
-				}
+			} else if err == nil && result == "" {
+				t.Error("expected the URL of the image")
+			}
+			if err != nil && jobs.IsPermanent(err) != test.expectPermanent {
+				t.Errorf("expected permanent error: %v, received error: %v", test.expectPermanent, err)
 			}
 		})
 	}
 }
 
-func getMockImagesAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockRecipeDriver, *fileaccessmock.MockDriver) {
+func Test_OptimizeAllImages(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api, _, _, _, _ := getMockImagesAPI(ctrl)
+	queue, jobDriver := getMockJobQueue(t, ctrl)
+	api.jobs = queue
+	expectJobQueued(jobDriver, models.JobOptimizeAllImages, gomock.Eq(`{}`), nil)
+
+	// Act
+	resp, err := api.OptimizeAllImages(t.Context(), OptimizeAllImagesRequestObject{})
+
+	// Assert
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if got, ok := resp.(OptimizeAllImages202JSONResponse); !ok {
+		t.Errorf("unexpected response type %T", resp)
+	} else if got.Headers.Location != "/api/v1/jobs/7" || *got.Body.ID != 7 {
+		t.Errorf("unexpected job: %v, %v", got.Headers.Location, got.Body)
+	}
+}
+
+func Test_runOptimizeAllImages(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api, dbDriver, imageDriver, uplDriver, imageRefs := getMockImagesAPI(ctrl)
+	// The fourth recipe was deleted, and the third doesn't have any uploads, so neither are listed
+	uplDriver.EXPECT().Open("uploads/recipes").Return(fstest.MapFS{
+		"uploads/recipes/1/images/img.jpeg": &fstest.MapFile{},
+		"uploads/recipes/2/images/bad.jpeg": &fstest.MapFile{},
+		"uploads/recipes/4/images/old.jpeg": &fstest.MapFile{},
+	}.Open("uploads/recipes"))
+	dbDriver.EXPECT().ListIDs(gomock.Any()).Return([]int64{1, 2, 3}, nil)
+
+	buf := bytes.NewBuffer([]byte{})
+	jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 1, 1)), nil)
+	mockFS := fstest.MapFS{
+		"img.jpeg": &fstest.MapFile{Data: buf.Bytes(), Mode: fs.ModeAppend, ModTime: time.Now()},
+		"bad.jpeg": &fstest.MapFile{Data: []byte("image"), Mode: fs.ModeAppend, ModTime: time.Now()},
+	}
+	goodEntries, _ := fstest.MapFS{"img.jpeg": mockFS["img.jpeg"]}.ReadDir(".")
+	badEntries, _ := fstest.MapFS{"bad.jpeg": mockFS["bad.jpeg"]}.ReadDir(".")
+
+	// The first recipe has an image that is optimized, and renamed since it's named by its content
+	uplDriver.EXPECT().List("uploads/recipes/1/images").Return(goodEntries, nil).Times(2)
+	uplDriver.EXPECT().List("uploads/recipes/1/refs").Return(nil, fs.ErrNotExist).Times(2)
+	uplDriver.EXPECT().Stat("uploads/recipes/1/refs/img.jpeg").Return(nil, fs.ErrNotExist).MinTimes(1)
+	uplDriver.EXPECT().Open("uploads/recipes/1/images/img.jpeg").Return(mockFS.Open("img.jpeg"))
+	imageDriver.EXPECT().List(gomock.Any(), int64(1)).Return(&[]models.RecipeImage{}, nil)
+	imageDriver.EXPECT().Reorder(gomock.Any(), int64(1), []string{"img.jpeg"}).Return(nil)
+	imageRefs.EXPECT().Lock(gomock.Any(), gomock.Not("img.jpeg")).Return(func() {}, nil)
+	uplDriver.EXPECT().Save(gomock.Any(), gomock.Any()).Times(3).Return(nil)
+	uplDriver.EXPECT().DeleteAll(gomock.Any()).Return(nil)
+	imageRefs.EXPECT().Add(gomock.Any(), gomock.Not("img.jpeg"), int64(1)).Return(nil)
+	uplDriver.EXPECT().Delete(gomock.Any()).Return(nil).Times(2)
+	imageDriver.EXPECT().Rename(gomock.Any(), int64(1), "img.jpeg", gomock.Not("img.jpeg")).Return(nil)
+	imageDriver.EXPECT().Create(gomock.Any(), int64(1), gomock.Any()).Return(nil)
+	dbDriver.EXPECT().Read(gomock.Any(), int64(1)).Return(&models.Recipe{ID: new(int64(1)), MainImageName: "img.jpeg"}, nil)
+	dbDriver.EXPECT().Patch(gomock.Any(), int64(1), gomock.Cond(func(patch *models.RecipePatch) bool {
+		return patch.MainImageName != nil && *patch.MainImageName != "img.jpeg"
+	})).Return(nil)
+
+	// The second has an image that fails to load
+	uplDriver.EXPECT().List("uploads/recipes/2/images").Return(badEntries, nil)
+	uplDriver.EXPECT().List("uploads/recipes/2/refs").Return(nil, fs.ErrNotExist)
+	uplDriver.EXPECT().Stat("uploads/recipes/2/refs/bad.jpeg").Return(nil, fs.ErrNotExist)
+	uplDriver.EXPECT().Open("uploads/recipes/2/images/bad.jpeg").Return(nil, io.ErrUnexpectedEOF)
+
+	// The optimized image isn't stored yet
+	uplDriver.EXPECT().Stat(gomock.Any()).Return(nil, fs.ErrNotExist)
+
+	task := &jobs.Task{
+		Job:     models.Job{ID: new(int64(7)), Kind: models.JobOptimizeAllImages},
+		Payload: `{}`,
+	}
+
+	// Act
+	result, err := api.runOptimizeAllImages(t.Context(), task)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var report models.ImageOptimizationReport
+	if err := json.Unmarshal([]byte(result), &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if report.Total != 2 || report.Optimized != 1 || report.Renamed != 1 || len(report.Failures) != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	} else if failure := report.Failures[0]; failure.RecipeID != 2 || failure.Name != "bad.jpeg" || failure.Error == "" {
+		t.Errorf("unexpected failure: %+v", failure)
+	}
+}
+
+func Test_runOptimizeAllImages_ListError(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api, dbDriver, _, uplDriver, _ := getMockImagesAPI(ctrl)
+	uplDriver.EXPECT().Open("uploads/recipes").Return(nil, fs.ErrNotExist)
+	dbDriver.EXPECT().ListIDs(gomock.Any()).Return(nil, sql.ErrConnDone)
+
+	// Act
+	_, err := api.runOptimizeAllImages(t.Context(), &jobs.Task{Payload: `{}`})
+
+	// Assert
+	if !errors.Is(err, sql.ErrConnDone) {
+		t.Errorf("expected error: %v, received error: %v", sql.ErrConnDone, err)
+	}
+}
+
+// expectMockImages sets up the recipe to have the images, stored in the recipe's directories, in the upload store
+func expectMockImages(t *testing.T, uplDriver *fileaccessmock.MockDriver, recipeID int64, names ...string) {
+	mockFS := fstest.MapFS{}
+	recipeDir := filepath.Join("uploads", "recipes", strconv.FormatInt(recipeID, 10))
+	for _, name := range names {
+		mockFS[name] = &fstest.MapFile{Data: []byte("image")}
+		uplDriver.EXPECT().Stat(filepath.Join(recipeDir, "refs", name)).AnyTimes().Return(nil, fs.ErrNotExist)
+	}
+	entries, _ := mockFS.ReadDir(".")
+	uplDriver.EXPECT().List(filepath.Join(recipeDir, "images")).Return(entries, nil)
+	uplDriver.EXPECT().List(filepath.Join(recipeDir, "refs")).Return(nil, fs.ErrNotExist)
+}
+
+func getMockImageInfo(t *testing.T) fs.FileInfo {
+	info, err := fstest.MapFS{"img.jpeg": &fstest.MapFile{Data: []byte("image")}}.Stat("img.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func getMockImagesAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockRecipeDriver, *dbmock.MockImageDriver, *fileaccessmock.MockDriver, *fileaccessmock.MockImageReferences) {
 	dbDriver := dbmock.NewMockDriver(ctrl)
 	recipeDriver := dbmock.NewMockRecipeDriver(ctrl)
 	dbDriver.EXPECT().Recipes().AnyTimes().Return(recipeDriver)
+	imageDriver := dbmock.NewMockImageDriver(ctrl)
+	dbDriver.EXPECT().Images().AnyTimes().Return(imageDriver)
 	uplDriver := fileaccessmock.NewMockDriver(ctrl)
 	imgCfg := fileaccess.ImageConfig{
 		ImageQuality:     models.ImageQualityOriginal,
@@ -544,12 +1039,13 @@ func getMockImagesAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockRecipeDr
 		ThumbnailQuality: models.ImageQualityMedium,
 		ThumbnailSize:    500,
 	}
-	upl, _ := fileaccess.CreateImageUploader(uplDriver, imgCfg)
+	imageRefs := fileaccessmock.NewMockImageReferences(ctrl)
+	upl, _ := fileaccess.CreateImageUploader(uplDriver, imageRefs, imgCfg)
 
 	api := apiHandler{
 		secureKeys: []string{"secure-key"},
 		upl:        upl,
 		db:         dbDriver,
 	}
-	return api, recipeDriver, uplDriver
+	return api, recipeDriver, imageDriver, uplDriver, imageRefs
 }
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/models"
+	"github.com/chadweimer/gomp/plaintext"
+)
+
+// The number of candidate recipes to retrieve from the database at a time
+const ingredientMatchBatchSize = 100
+
+func (h apiHandler) MatchIngredients(ctx context.Context, request MatchIngredientsRequestObject) (MatchIngredientsResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	page := int64(1)
+	if request.Params.Page != nil {
+		page = *request.Params.Page
+	}
+	if page < 1 || request.Params.Count < 1 {
+		logger.ErrorContext(ctx, "invalid page or count", "page", page, "count", request.Params.Count)
+		return MatchIngredients400Response{}, nil
+	}
+
+	pantry := make([]pantryItem, 0)
+	for _, ingredient := range request.Body.Ingredients {
+		if item := newPantryItem(ingredient); len(item.words) > 0 {
+			pantry = append(pantry, item)
+		}
+	}
+	if len(pantry) == 0 {
+		logger.Error("no valid ingredients specified")
+		return MatchIngredients400Response{}, nil
+	}
+
+	states := []models.RecipeState{models.Active}
+	if request.Body.States != nil && len(*request.Body.States) > 0 {
+		states = *request.Body.States
+	}
+
+	// Only consider recipes that mention at least one of the ingredients on hand
+	terms := make([]string, 0, len(pantry))
+	for _, item := range pantry {
+		terms = append(terms, "ingredients:\""+item.text+"\"")
+	}
+	filter := models.SearchFilter{
+		Query:    strings.Join(terms, " OR "),
+		Fields:   []models.SearchField{models.SearchFieldIngredients},
+		States:   states,
+		TagMatch: models.Any,
+		SortBy:   models.SortByID,
+		SortDir:  models.Asc,
+	}
+
+	// Load the ingredients of all recipes at once, rather than one query per candidate
+	recipes, err := h.db.Recipes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ingredientsByID := make(map[int64]string, len(*recipes))
+	for _, recipe := range *recipes {
+		ingredientsByID[*recipe.ID] = recipe.Ingredients
+	}
+
+	matches := make([]IngredientMatch, 0)
+	for batch := int64(1); ; batch++ {
+		candidates, total, err := h.db.Recipes().Find(ctx, &filter, false, batch, ingredientMatchBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, candidate := range *candidates {
+			// Skip any recipe added since the ingredients were loaded
+			ingredients, ok := ingredientsByID[*candidate.ID]
+			if !ok {
+				continue
+			}
+
+			if match, ok := matchIngredients(candidate, ingredients, pantry); ok {
+				matches = append(matches, match)
+			}
+		}
+
+		if batch*ingredientMatchBatchSize >= total {
+			break
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b IngredientMatch) int {
+		return cmp.Or(
+			cmp.Compare(b.Coverage, a.Coverage),
+			cmp.Compare(b.MatchedCount, a.MatchedCount),
+			cmp.Compare(len(a.MissingIngredients), len(b.MissingIngredients)),
+			strings.Compare(a.Recipe.Name, b.Recipe.Name))
+	})
+
+	start := min(request.Params.Count*(page-1), int64(len(matches)))
+	end := min(start+request.Params.Count, int64(len(matches)))
+
+	return MatchIngredients200JSONResponse{
+		Recipes: matches[start:end],
+		Total:   int64(len(matches)),
+	}, nil
+}
+
+// pantryItem is an ingredient on hand, normalized for comparing against recipe ingredients
+type pantryItem struct {
+	text  string
+	words []string
+}
+
+func newPantryItem(ingredient string) pantryItem {
+	// Quotes would break the search query the text is used in
+	text := strings.Join(strings.Fields(strings.ReplaceAll(ingredient, "\"", " ")), " ")
+	return pantryItem{text: text, words: plaintext.Words(text)}
+}
+
+// covers returns whether all the words of the pantry item appear in the ingredient
+func (p pantryItem) covers(ingredientWords []string) bool {
+	for _, word := range p.words {
+		if !slices.Contains(ingredientWords, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchIngredients(recipe models.RecipeCompact, ingredients string, pantry []pantryItem) (IngredientMatch, bool) {
+	match := IngredientMatch{
+		Recipe:             recipe,
+		MissingIngredients: make([]string, 0),
+	}
+
+	for _, line := range plaintext.Lines(ingredients) {
+		// Skip section headings, e.g., "For the sauce:"
+		if strings.HasSuffix(line, ":") {
+			continue
+		}
+
+		match.TotalCount++
+		words := plaintext.Words(line)
+		if slices.ContainsFunc(pantry, func(item pantryItem) bool { return item.covers(words) }) {
+			match.MatchedCount++
+		} else {
+			match.MissingIngredients = append(match.MissingIngredients, line)
+		}
+	}
+
+	if match.MatchedCount == 0 {
+		return match, false
+	}
+
+	match.Coverage = float32(match.MatchedCount) / float32(match.TotalCount)
+	return match, true
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chadweimer/gomp/models"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_MatchIngredients(t *testing.T) {
+	type testArgs struct {
+		name             string
+		ingredients      []string
+		page             int64
+		count            int64
+		expectedQuery    string
+		expectedResponse MatchIngredientsResponseObject
+	}
+
+	chicken := recipeFixtureLemonGarlicChicken()
+	chicken.ID = new(int64(1))
+	sausage := recipeFixtureSheetPanSausage()
+	sausage.ID = new(int64(2))
+	// As saved by the editor
+	sausage.Ingredients = "<ul><li>12 oz smoked sausage</li><li>2 bell peppers</li><li>1 red&nbsp;onion</li><li><b>2 tbsp</b> olive oil</li></ul>"
+	wraps := recipeFixtureChickpeaSaladWraps()
+	wraps.ID = new(int64(3))
+	recipes := []models.Recipe{*chicken, *sausage, *wraps}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name:          "Ranked by coverage",
+			ingredients:   []string{"Chicken Thigh", "olive oil", "lemons", "onion"},
+			count:         10,
+			expectedQuery: `ingredients:"Chicken Thigh" OR ingredients:"olive oil" OR ingredients:"lemons" OR ingredients:"onion"`,
+			expectedResponse: MatchIngredients200JSONResponse{
+				Total: 2,
+				Recipes: []IngredientMatch{
+					{
+						Recipe:             models.RecipeCompact{ID: chicken.ID, Name: chicken.Name},
+						MatchedCount:       3,
+						TotalCount:         4,
+						Coverage:           0.75,
+						MissingIngredients: []string{"3 cloves garlic"},
+					},
+					{
+						Recipe:             models.RecipeCompact{ID: sausage.ID, Name: sausage.Name},
+						MatchedCount:       2,
+						TotalCount:         4,
+						Coverage:           0.5,
+						MissingIngredients: []string{"12 oz smoked sausage", "2 bell peppers"},
+					},
+				},
+			},
+		},
+		{
+			name:          "Paged",
+			ingredients:   []string{"chicken thigh", "olive oil", "lemon", "onion"},
+			page:          2,
+			count:         1,
+			expectedQuery: `ingredients:"chicken thigh" OR ingredients:"olive oil" OR ingredients:"lemon" OR ingredients:"onion"`,
+			expectedResponse: MatchIngredients200JSONResponse{
+				Total: 2,
+				Recipes: []IngredientMatch{
+					{
+						Recipe:             models.RecipeCompact{ID: sausage.ID, Name: sausage.Name},
+						MatchedCount:       2,
+						TotalCount:         4,
+						Coverage:           0.5,
+						MissingIngredients: []string{"12 oz smoked sausage", "2 bell peppers"},
+					},
+				},
+			},
+		},
+		{
+			name:             "No valid ingredients",
+			ingredients:      []string{"", " - "},
+			count:            10,
+			expectedResponse: MatchIngredients400Response{},
+		},
+		{
+			name:             "Invalid page",
+			ingredients:      []string{"onion"},
+			page:             -1,
+			count:            10,
+			expectedResponse: MatchIngredients400Response{},
+		},
+		{
+			name:             "Invalid count",
+			ingredients:      []string{"onion"},
+			count:            -1,
+			expectedResponse: MatchIngredients400Response{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			api, recipesDriver, _ := getMockRecipesAPI(ctrl)
+
+			if test.expectedQuery != "" {
+				candidates := make([]models.RecipeCompact, 0, len(recipes))
+				for _, recipe := range recipes {
+					candidates = append(candidates, models.RecipeCompact{ID: recipe.ID, Name: recipe.Name})
+				}
+				recipesDriver.EXPECT().List(t.Context()).Return(&recipes, nil)
+				recipesDriver.EXPECT().
+					Find(t.Context(), gomock.Any(), false, int64(1), int64(ingredientMatchBatchSize)).
+					DoAndReturn(func(_ any, filter *models.SearchFilter, _ bool, _ int64, _ int64) (*[]models.RecipeCompact, int64, error) {
+						if filter.Query != test.expectedQuery {
+							t.Errorf("expected query: %s, received query: %s", test.expectedQuery, filter.Query)
+						}
+						if !reflect.DeepEqual(filter.States, []models.RecipeState{models.Active}) {
+							t.Errorf("expected active recipes, received %v", filter.States)
+						}
+						return &candidates, int64(len(candidates)), nil
+					})
+			}
+
+			params := MatchIngredientsParams{Count: test.count}
+			if test.page != 0 {
+				params.Page = &test.page
+			}
+
+			// Act
+			resp, err := api.MatchIngredients(t.Context(), MatchIngredientsRequestObject{
+				Params: params,
+				Body:   &IngredientMatchRequest{Ingredients: test.ingredients},
+			})
+
+			// Assert
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(resp, test.expectedResponse) {
+				t.Errorf("expected response: %+v, received response: %+v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/jobs"
+	"github.com/chadweimer/gomp/models"
+)
+
+// imageJobPayload is the payload of jobs that operate on a recipe image
+type imageJobPayload struct {
+	RecipeID int64  `json:"recipeId"`
+	Name     string `json:"name,omitempty"`
+}
+
+// backupJobPayload is the payload of jobs that operate on a backup
+type backupJobPayload struct {
+	Name string `json:"name"`
+}
+
+// uploadCheckJobPayload is the payload of jobs that check the uploads
+type uploadCheckJobPayload struct {
+	Repair bool `json:"repair"`
+}
+
+func (h apiHandler) registerJobHandlers() {
+	h.jobs.Register(models.JobUploadImage, h.runUploadImage)
+	h.jobs.Register(models.JobOptimizeImage, h.runOptimizeImage)
+	h.jobs.Register(models.JobCreateBackup, h.runCreateBackup)
+	h.jobs.Register(models.JobRestoreFromBackup, h.runRestoreFromBackup)
+	h.jobs.Register(models.JobOptimizeAllImages, h.runOptimizeAllImages)
+	h.jobs.Register(models.JobCheckUploads, h.runCheckUploads)
+}
+
+func (h apiHandler) GetJobs(ctx context.Context, _ GetJobsRequestObject) (GetJobsResponseObject, error) {
+	allJobs, err := h.db.Jobs().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing jobs: %w", err)
+	}
+
+	return GetJobs200JSONResponse(*allJobs), nil
+}
+
+func (h apiHandler) GetJob(ctx context.Context, request GetJobRequestObject) (GetJobResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	return withCurrentUser[GetJobResponseObject](ctx, GetJob404Response{}, func(userID int64) (GetJobResponseObject, error) {
+		job, err := h.db.Jobs().Read(ctx, request.JobID)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return GetJob404Response{}, nil
+			}
+			return nil, fmt.Errorf("reading job: %w", err)
+		}
+
+		// Only the user that started the job, or an admin, can see it
+		if job.CreatedBy == nil || *job.CreatedBy != userID {
+			user, err := h.db.Users().Read(ctx, userID)
+			if err != nil {
+				return nil, fmt.Errorf("reading user: %w", err)
+			}
+			if user.AccessLevel != models.Admin {
+				logger.WarnContext(ctx, "User is not allowed to see job",
+					"user-id", userID,
+					"job-id", request.JobID)
+				return GetJob404Response{}, nil
+			}
+		}
+
+		return GetJob200JSONResponse(*job), nil
+	})
+}
+
+func (h apiHandler) DeleteJob(ctx context.Context, request DeleteJobRequestObject) (DeleteJobResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	job, err := h.db.Jobs().Read(ctx, request.JobID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return DeleteJob404Response{}, nil
+		}
+		return nil, fmt.Errorf("reading job: %w", err)
+	}
+	if job.State == models.JobRunning {
+		logger.WarnContext(ctx, "Cannot delete a running job", "job-id", request.JobID)
+		return DeleteJob409Response{}, nil
+	}
+
+	if err := h.db.Jobs().Delete(ctx, request.JobID); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return DeleteJob404Response{}, nil
+		}
+		if errors.Is(err, db.ErrJobRunning) {
+			// The job was claimed after it was read
+			logger.WarnContext(ctx, "Cannot delete a running job", "job-id", request.JobID)
+			return DeleteJob409Response{}, nil
+		}
+		return nil, fmt.Errorf("deleting job: %w", err)
+	}
+
+	return DeleteJob204Response{}, nil
+}
+
+// enqueueJob queues up a job of the specified kind on behalf of the current user
+func (h apiHandler) enqueueJob(ctx context.Context, kind models.JobKind, payload any, data []byte) (*models.Job, error) {
+	var createdBy *int64
+	if userID, err := getResourceIDFromCtx(ctx, currentUserIDCtxKey); err == nil {
+		createdBy = &userID
+	}
+
+	job, err := h.jobs.Enqueue(ctx, kind, createdBy, payload, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue %s job: %w", kind, err)
+	}
+	return job, nil
+}
+
+// getJobLocation returns the location of the job in the API
+func getJobLocation(job *models.Job) string {
+	return fmt.Sprintf("/api/v1/jobs/%d", *job.ID)
+}
+
+// asPermanentJobError marks the error as one that retrying the job won't fix,
+// if it is one of the specified errors
+func asPermanentJobError(err error, permanentErrs ...error) error {
+	for _, permanentErr := range permanentErrs {
+		if errors.Is(err, permanentErr) {
+			return jobs.Permanent(err)
+		}
+	}
+	return err
+}
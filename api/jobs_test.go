@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/jobs"
+	dbmock "github.com/chadweimer/gomp/mocks/db"
+	"github.com/chadweimer/gomp/models"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_GetJobs(t *testing.T) {
+	tests := []bool{false, true}
+	for _, expectError := range tests {
+		// Arrange
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		api, jobDriver, _ := getMockJobsAPI(t, ctrl)
+		expected := []models.Job{
+			{ID: new(int64(2)), Kind: models.JobCreateBackup, State: models.JobRunning},
+			{ID: new(int64(1)), Kind: models.JobUploadImage, State: models.JobSucceeded},
+		}
+		if expectError {
+			jobDriver.EXPECT().List(gomock.Any()).Return(nil, errors.New("an error"))
+		} else {
+			jobDriver.EXPECT().List(gomock.Any()).Return(&expected, nil)
+		}
+
+		// Act
+		resp, err := api.GetJobs(t.Context(), GetJobsRequestObject{})
+
+		// Assert
+		if (err != nil) != expectError {
+			t.Errorf("error expected?: %v, received error: %v", expectError, err)
+		} else if err == nil && !reflect.DeepEqual(resp, GetJobs200JSONResponse(expected)) {
+			t.Errorf("expected response: %v, received response: %v", expected, resp)
+		}
+	}
+}
+
+func Test_GetJob(t *testing.T) {
+	type testArgs struct {
+		name             string
+		createdBy        *int64
+		accessLevel      models.AccessLevel
+		dbError          error
+		expectedError    bool
+		expectedResponse GetJobResponseObject
+	}
+
+	job := models.Job{ID: new(int64(1)), Kind: models.JobUploadImage, State: models.JobPending}
+
+	// Arrange
+	tests := []testArgs{
+		{"Creator", new(int64(5)), models.Editor, nil, false, GetJob200JSONResponse(job)},
+		{"Admin", new(int64(6)), models.Admin, nil, false, GetJob200JSONResponse(job)},
+		{"Other User", new(int64(6)), models.Editor, nil, false, GetJob404Response{}},
+		{"Creator Deleted", nil, models.Editor, nil, false, GetJob404Response{}},
+		{"Not Found", new(int64(5)), models.Editor, db.ErrNotFound, false, GetJob404Response{}},
+		{"DB Error", new(int64(5)), models.Editor, errors.New("an error"), true, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, jobDriver, userDriver := getMockJobsAPI(t, ctrl)
+			const userID int64 = 5
+			if test.dbError != nil {
+				jobDriver.EXPECT().Read(gomock.Any(), *job.ID).Return(nil, test.dbError)
+			} else {
+				found := job
+				found.CreatedBy = test.createdBy
+				jobDriver.EXPECT().Read(gomock.Any(), *job.ID).Return(&found, nil)
+				if test.createdBy == nil || *test.createdBy != userID {
+					userDriver.EXPECT().Read(gomock.Any(), userID).Return(&db.UserWithPasswordHash{
+						User: models.User{ID: new(userID), AccessLevel: test.accessLevel},
+					}, nil)
+				}
+			}
+			ctx := context.WithValue(t.Context(), currentUserIDCtxKey, userID)
+
+			// Act
+			resp, err := api.GetJob(ctx, GetJobRequestObject{JobID: *job.ID})
+
+			// Assert
+			if (err != nil) != test.expectedError {
+				t.Errorf("error expected?: %v, received error: %v", test.expectedError, err)
+			} else if err == nil {
+				if got, ok := resp.(GetJob200JSONResponse); ok {
+					got.CreatedBy = nil
+					resp = got
+				}
+				if !reflect.DeepEqual(resp, test.expectedResponse) {
+					t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+				}
+			}
+		})
+	}
+}
+
+func Test_DeleteJob(t *testing.T) {
+	type testArgs struct {
+		name             string
+		state            models.JobState
+		readError        error
+		expectDelete     bool
+		deleteError      error
+		expectedResponse DeleteJobResponseObject
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Pending", models.JobPending, nil, true, nil, DeleteJob204Response{}},
+		{"Failed", models.JobFailed, nil, true, nil, DeleteJob204Response{}},
+		{"Running", models.JobRunning, nil, false, nil, DeleteJob409Response{}},
+		{"Claimed After Read", models.JobPending, nil, true, db.ErrJobRunning, DeleteJob409Response{}},
+		{"Deleted After Read", models.JobPending, nil, true, db.ErrNotFound, DeleteJob404Response{}},
+		{"Not Found", "", db.ErrNotFound, false, nil, DeleteJob404Response{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, jobDriver, _ := getMockJobsAPI(t, ctrl)
+			if test.readError != nil {
+				jobDriver.EXPECT().Read(gomock.Any(), int64(1)).Return(nil, test.readError)
+			} else {
+				jobDriver.EXPECT().Read(gomock.Any(), int64(1)).Return(&models.Job{ID: new(int64(1)), State: test.state}, nil)
+			}
+			if test.expectDelete {
+				jobDriver.EXPECT().Delete(gomock.Any(), int64(1)).Return(test.deleteError)
+			}
+
+			// Act
+			resp, err := api.DeleteJob(t.Context(), DeleteJobRequestObject{JobID: 1})
+
+			// Assert
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if !reflect.DeepEqual(resp, test.expectedResponse) {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
+
+// expectJobQueued sets up the driver to store a job of the specified kind, with the specified input
+func expectJobQueued(jobDriver *dbmock.MockJobDriver, kind models.JobKind, payload gomock.Matcher, data []byte) {
+	jobDriver.EXPECT().Create(gomock.Any(), gomock.Cond(func(job *db.JobWithInput) bool {
+		return job.Kind == kind && payload.Matches(job.Payload) && bytes.Equal(job.Data, data)
+	})).DoAndReturn(func(_ context.Context, job *db.JobWithInput) error {
+		job.ID = new(int64(7))
+		job.State = models.JobPending
+		return nil
+	})
+}
+
+// getMockJobQueue returns a queue that stores its jobs using the returned driver
+func getMockJobQueue(t *testing.T, ctrl *gomock.Controller) (*jobs.Queue, *dbmock.MockJobDriver) {
+	t.Helper()
+
+	jobDriver := dbmock.NewMockJobDriver(ctrl)
+	queue, err := jobs.CreateQueue(jobDriver, jobs.Config{Workers: 1, MaxAttempts: 3})
+	if err != nil {
+		t.Fatalf("failed to create job queue: %v", err)
+	}
+	return queue, jobDriver
+}
+
+func getMockJobsAPI(t *testing.T, ctrl *gomock.Controller) (apiHandler, *dbmock.MockJobDriver, *dbmock.MockUserDriver) {
+	queue, jobDriver := getMockJobQueue(t, ctrl)
+	dbDriver := dbmock.NewMockDriver(ctrl)
+	dbDriver.EXPECT().Jobs().AnyTimes().Return(jobDriver)
+	userDriver := dbmock.NewMockUserDriver(ctrl)
+	dbDriver.EXPECT().Users().AnyTimes().Return(userDriver)
+
+	api := apiHandler{
+		secureKeys: []string{"secure-key"},
+		db:         dbDriver,
+		jobs:       queue,
+	}
+	return api, jobDriver, userDriver
+}
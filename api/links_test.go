@@ -251,7 +251,7 @@ func getMockLinkAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockLinkDriver
 		ThumbnailQuality: models.ImageQualityMedium,
 		ThumbnailSize:    500,
 	}
-	upl, _ := fileaccess.CreateImageUploader(uplDriver, imgCfg)
+	upl, _ := fileaccess.CreateImageUploader(uplDriver, fileaccessmock.NewMockImageReferences(ctrl), imgCfg)
 
 	api := apiHandler{
 		secureKeys: []string{},
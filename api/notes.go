@@ -3,9 +3,12 @@ package api
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
 
 	"github.com/chadweimer/gomp/db"
 	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/models"
 )
 
 func (h apiHandler) GetNotes(ctx context.Context, request GetNotesRequestObject) (GetNotesResponseObject, error) {
@@ -28,78 +31,178 @@ func (h apiHandler) GetNotes(ctx context.Context, request GetNotesRequestObject)
 func (h apiHandler) AddNote(ctx context.Context, request AddNoteRequestObject) (AddNoteResponseObject, error) {
 	logger := infra.GetLoggerFromContext(ctx)
 
-	note := request.Body
-	if note.RecipeID == nil {
-		note.RecipeID = &request.RecipeID
-	} else if *note.RecipeID != request.RecipeID {
-		logger.ErrorContext(ctx, "Request ID does not match recipe ID",
-			"request-id", request.RecipeID,
-			"recipe-id", *note.RecipeID)
-		return AddNote400Response{}, nil
-	}
+	return withCurrentUser[AddNoteResponseObject](ctx, AddNote401Response{}, func(userID int64) (AddNoteResponseObject, error) {
+		note := request.Body
+		if note.RecipeID == nil {
+			note.RecipeID = &request.RecipeID
+		} else if *note.RecipeID != request.RecipeID {
+			logger.ErrorContext(ctx, "Request ID does not match recipe ID",
+				"request-id", request.RecipeID,
+				"recipe-id", *note.RecipeID)
+			return AddNote400Response{}, nil
+		}
 
-	if err := h.db.Notes().Create(ctx, note); err != nil {
-		if errors.Is(err, db.ErrNotFound) {
-			return AddNote404Response{}, nil
+		if ok, err := h.areRecipeImagesValid(ctx, request.RecipeID, note.ImageName); err != nil {
+			return nil, err
+		} else if !ok {
+			return AddNote400Response{}, nil
+		}
+
+		note.CreatedBy = &userID
+		note.ModifiedBy = &userID
+		if err := h.db.Notes().Create(ctx, note); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return AddNote404Response{}, nil
+			}
+			logger.ErrorContext(ctx, "Failed to add note to recipe",
+				"error", err,
+				"recipe-id", request.RecipeID)
+			return nil, err
 		}
-		logger.ErrorContext(ctx, "Failed to add note to recipe",
-			"error", err,
-			"recipe-id", request.RecipeID)
-		return nil, err
-	}
 
-	return AddNote201JSONResponse(*note), nil
+		return AddNote201JSONResponse(*note), nil
+	})
 }
 
 func (h apiHandler) SaveNote(ctx context.Context, request SaveNoteRequestObject) (SaveNoteResponseObject, error) {
 	logger := infra.GetLoggerFromContext(ctx)
 
-	note := request.Body
-	if note.ID == nil {
-		note.ID = &request.NoteID
-	} else if *note.ID != request.NoteID {
-		logger.ErrorContext(ctx, "Request ID does not match note ID",
-			"request-id", request.NoteID,
-			"note-id", *note.ID)
-		return SaveNote400Response{}, nil
-	}
+	return withCurrentUser[SaveNoteResponseObject](ctx, SaveNote401Response{}, func(userID int64) (SaveNoteResponseObject, error) {
+		note := request.Body
+		if note.ID == nil {
+			note.ID = &request.NoteID
+		} else if *note.ID != request.NoteID {
+			logger.ErrorContext(ctx, "Request ID does not match note ID",
+				"request-id", request.NoteID,
+				"note-id", *note.ID)
+			return SaveNote400Response{}, nil
+		}
 
-	if note.RecipeID == nil {
-		note.RecipeID = &request.RecipeID
-	} else if *note.RecipeID != request.RecipeID {
-		logger.ErrorContext(ctx, "Request ID does not match recipe ID",
-			"request-id", request.RecipeID,
-			"recipe-id", *note.RecipeID)
-		return SaveNote400Response{}, nil
-	}
+		if note.RecipeID == nil {
+			note.RecipeID = &request.RecipeID
+		} else if *note.RecipeID != request.RecipeID {
+			logger.ErrorContext(ctx, "Request ID does not match recipe ID",
+				"request-id", request.RecipeID,
+				"recipe-id", *note.RecipeID)
+			return SaveNote400Response{}, nil
+		}
 
-	if err := h.db.Notes().Update(ctx, note); err != nil {
-		if errors.Is(err, db.ErrNotFound) {
-			return SaveNote404Response{}, nil
+		allowed, err := h.canModifyNote(ctx, userID, request.RecipeID, request.NoteID)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return SaveNote404Response{}, nil
+			}
+			return nil, err
+		}
+		if !allowed {
+			logger.WarnContext(ctx, "User is not allowed to modify note",
+				"user-id", userID,
+				"note-id", request.NoteID)
+			return SaveNote403Response{}, nil
 		}
-		logger.ErrorContext(ctx, "Failed to update note",
-			"error", err,
-			"recipe-id", request.RecipeID,
-			"note-id", request.NoteID)
-		return nil, err
-	}
 
-	return SaveNote204Response{}, nil
+		if ok, err := h.areRecipeImagesValid(ctx, request.RecipeID, note.ImageName); err != nil {
+			return nil, err
+		} else if !ok {
+			return SaveNote400Response{}, nil
+		}
+
+		note.ModifiedBy = &userID
+		if err := h.db.Notes().Update(ctx, note); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return SaveNote404Response{}, nil
+			}
+			logger.ErrorContext(ctx, "Failed to update note",
+				"error", err,
+				"recipe-id", request.RecipeID,
+				"note-id", request.NoteID)
+			return nil, err
+		}
+
+		return SaveNote204Response{}, nil
+	})
 }
 
 func (h apiHandler) DeleteNote(ctx context.Context, request DeleteNoteRequestObject) (DeleteNoteResponseObject, error) {
 	logger := infra.GetLoggerFromContext(ctx)
 
-	if err := h.db.Notes().Delete(ctx, request.RecipeID, request.NoteID); err != nil {
-		if errors.Is(err, db.ErrNotFound) {
-			return DeleteNote404Response{}, nil
+	return withCurrentUser[DeleteNoteResponseObject](ctx, DeleteNote401Response{}, func(userID int64) (DeleteNoteResponseObject, error) {
+		allowed, err := h.canModifyNote(ctx, userID, request.RecipeID, request.NoteID)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return DeleteNote404Response{}, nil
+			}
+			return nil, err
+		}
+		if !allowed {
+			logger.WarnContext(ctx, "User is not allowed to delete note",
+				"user-id", userID,
+				"note-id", request.NoteID)
+			return DeleteNote403Response{}, nil
+		}
+
+		if err := h.db.Notes().Delete(ctx, request.RecipeID, request.NoteID); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return DeleteNote404Response{}, nil
+			}
+			logger.ErrorContext(ctx, "Failed to delete note",
+				"error", err,
+				"recipe-id", request.RecipeID,
+				"note-id", request.NoteID)
+			return nil, err
+		}
+
+		return DeleteNote204Response{}, nil
+	})
+}
+
+// canModifyNote determines whether the specified user is allowed to modify the note,
+// which is only the case for the user that created the note or an admin.
+func (h apiHandler) canModifyNote(ctx context.Context, userID, recipeID, noteID int64) (bool, error) {
+	existing, err := h.db.Notes().Read(ctx, recipeID, noteID)
+	if err != nil {
+		return false, fmt.Errorf("reading note: %w", err)
+	}
+	if existing.CreatedBy != nil && *existing.CreatedBy == userID {
+		return true, nil
+	}
+
+	user, err := h.db.Users().Read(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("reading user: %w", err)
+	}
+
+	return user.AccessLevel == models.Admin, nil
+}
+
+// areRecipeImagesValid determines whether the images attached to notes or steps, if any,
+// are safe names of images that have been uploaded for the recipe.
+// The images of the recipe are only listed once, however many names there are.
+func (h apiHandler) areRecipeImagesValid(ctx context.Context, recipeID int64, imageNames ...*string) (bool, error) {
+	var images []string
+	listed := false
+	for _, imageName := range imageNames {
+		if imageName == nil || *imageName == "" {
+			continue
+		}
+
+		if !isNameSafe(*imageName) {
+			infra.GetLoggerFromContext(ctx).WarnContext(ctx, "invalid image name", "name", *imageName)
+			return false, nil
+		}
+
+		if !listed {
+			var err error
+			if images, err = h.upl.List(recipeID); err != nil {
+				return false, fmt.Errorf("listing images for recipe: %w", err)
+			}
+			listed = true
+		}
+
+		if !slices.Contains(images, *imageName) {
+			return false, nil
 		}
-		logger.ErrorContext(ctx, "Failed to delete note",
-			"error", err,
-			"recipe-id", request.RecipeID,
-			"note-id", request.NoteID)
-		return nil, err
 	}
 
-	return DeleteNote204Response{}, nil
+	return true, nil
 }
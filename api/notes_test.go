@@ -1,10 +1,15 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"testing/fstest"
 
 	"github.com/chadweimer/gomp/db"
 	"github.com/chadweimer/gomp/fileaccess"
@@ -55,7 +60,7 @@ func Test_GetNotes(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			api, notesDriver := getMockNotesAPI(ctrl)
+			api, notesDriver, _, _ := getMockNotesAPI(ctrl)
 			if test.dbError != nil {
 				notesDriver.EXPECT().List(t.Context(), test.recipeID).Return(nil, test.dbError)
 			} else {
@@ -101,7 +106,9 @@ func Test_AddNote(t *testing.T) {
 	type addNoteTest struct {
 		name             string
 		recipeID         int64
+		userID           any
 		note             models.Note
+		images           []string
 		expectCreate     bool
 		dbError          error
 		expectedError    error
@@ -112,33 +119,69 @@ func Test_AddNote(t *testing.T) {
 		{
 			name:             "Valid note with matching recipe ID",
 			recipeID:         1,
+			userID:           int64(5),
 			note:             models.Note{RecipeID: new(int64(1)), Text: "Add chopped parsley right before serving."},
 			expectCreate:     true,
 			dbError:          nil,
 			expectedError:    nil,
-			expectedResponse: AddNote201JSONResponse{RecipeID: new(int64(1)), Text: "Add chopped parsley right before serving."},
+			expectedResponse: AddNote201JSONResponse{RecipeID: new(int64(1)), Text: "Add chopped parsley right before serving.", CreatedBy: new(int64(5))},
 		},
 		{
 			name:             "Valid note without recipe ID",
 			recipeID:         2,
+			userID:           int64(5),
 			note:             models.Note{Text: "Refrigerate leftovers within 2 hours."},
 			expectCreate:     true,
 			dbError:          nil,
 			expectedError:    nil,
-			expectedResponse: AddNote201JSONResponse{RecipeID: new(int64(2)), Text: "Refrigerate leftovers within 2 hours."},
+			expectedResponse: AddNote201JSONResponse{RecipeID: new(int64(2)), Text: "Refrigerate leftovers within 2 hours.", CreatedBy: new(int64(5))},
+		},
+		{
+			name:             "Valid reply with attached image",
+			recipeID:         2,
+			userID:           int64(6),
+			note:             models.Note{ParentID: new(int64(3)), Text: "Agreed!", ImageName: new("plated-dish.jpeg")},
+			images:           []string{"plated-dish.jpeg"},
+			expectCreate:     true,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: AddNote201JSONResponse{RecipeID: new(int64(2)), Text: "Agreed!", CreatedBy: new(int64(6))},
+		},
+		{
+			name:             "Attached image not found",
+			recipeID:         2,
+			userID:           int64(6),
+			note:             models.Note{Text: "Missing image fixture.", ImageName: new("missing.jpeg")},
+			images:           []string{"plated-dish.jpeg"},
+			expectCreate:     false,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: AddNote400Response{},
 		},
 		{
 			name:             "Mismatched recipe ID",
 			recipeID:         3,
+			userID:           int64(5),
 			note:             models.Note{RecipeID: new(int64(4)), Text: "Mismatched recipe ID note fixture."},
 			expectCreate:     false,
 			dbError:          nil,
 			expectedError:    nil,
 			expectedResponse: AddNote400Response{},
 		},
+		{
+			name:             "No current user",
+			recipeID:         3,
+			userID:           nil,
+			note:             models.Note{Text: "Anonymous note fixture."},
+			expectCreate:     false,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: AddNote401Response{},
+		},
 		{
 			name:             "Recipe not found",
 			recipeID:         4,
+			userID:           int64(5),
 			note:             models.Note{Text: "Recipe not found note fixture."},
 			expectCreate:     true,
 			dbError:          db.ErrNotFound,
@@ -148,6 +191,7 @@ func Test_AddNote(t *testing.T) {
 		{
 			name:             "Database error",
 			recipeID:         4,
+			userID:           int64(5),
 			note:             models.Note{Text: "Intentional failing note fixture."},
 			expectCreate:     true,
 			dbError:          sql.ErrConnDone,
@@ -161,17 +205,30 @@ func Test_AddNote(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			api, notesDriver := getMockNotesAPI(ctrl)
+			ctx := t.Context()
+			if test.userID != nil {
+				ctx = context.WithValue(ctx, currentUserIDCtxKey, test.userID)
+			}
+
+			api, notesDriver, _, uplDriver := getMockNotesAPI(ctrl)
+			if test.images != nil {
+				// Uploaded images are referenced by the recipe, rather than stored in its directories
+				recipeDir := filepath.Join("uploads", "recipes", strconv.FormatInt(test.recipeID, 10))
+				uplDriver.EXPECT().List(filepath.Join(recipeDir, "images")).Return(nil, fs.ErrNotExist)
+				uplDriver.EXPECT().List(filepath.Join(recipeDir, "refs")).Return(createMockDirEntries(lo.SliceToMap(test.images, func(name string) (string, *fstest.MapFile) {
+					return name, &fstest.MapFile{}
+				})), nil)
+			}
 			if test.expectCreate {
 				if test.dbError != nil {
-					notesDriver.EXPECT().Create(t.Context(), gomock.Any()).Return(test.dbError)
+					notesDriver.EXPECT().Create(ctx, gomock.Any()).Return(test.dbError)
 				} else {
-					notesDriver.EXPECT().Create(t.Context(), &test.note).Return(nil)
+					notesDriver.EXPECT().Create(ctx, &test.note).Return(nil)
 				}
 			}
 
 			// Act
-			resp, err := api.AddNote(t.Context(), AddNoteRequestObject{RecipeID: test.recipeID, Body: &test.note})
+			resp, err := api.AddNote(ctx, AddNoteRequestObject{RecipeID: test.recipeID, Body: &test.note})
 
 			// Assert
 			if !errors.Is(err, test.expectedError) {
@@ -189,10 +246,20 @@ func Test_AddNote(t *testing.T) {
 					if (got.RecipeID == nil) != (expected.RecipeID == nil) || (got.RecipeID != nil && *got.RecipeID != *expected.RecipeID) {
 						t.Errorf("expected recipe ID: %v, actual recipe ID: %v", expected.RecipeID, got.RecipeID)
 					}
+					if got.CreatedBy == nil || *got.CreatedBy != *expected.CreatedBy {
+						t.Errorf("expected created by: %v, actual created by: %v", *expected.CreatedBy, got.CreatedBy)
+					}
+					if got.ModifiedBy == nil || *got.ModifiedBy != *expected.CreatedBy {
+						t.Errorf("expected modified by: %v, actual modified by: %v", *expected.CreatedBy, got.ModifiedBy)
+					}
 				case AddNote400Response:
 					if _, ok := resp.(AddNote400Response); !ok {
 						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
 					}
+				case AddNote401Response:
+					if _, ok := resp.(AddNote401Response); !ok {
+						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
+					}
 				case AddNote404Response:
 					if _, ok := resp.(AddNote404Response); !ok {
 						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
@@ -206,35 +273,89 @@ func Test_AddNote(t *testing.T) {
 }
 
 func Test_SaveNote(t *testing.T) {
-	type addNoteTest struct {
+	type saveNoteTest struct {
 		name             string
 		recipeID         int64
 		noteID           int64
+		userID           int64
+		accessLevel      models.AccessLevel
+		existingAuthor   *int64
 		note             models.Note
+		expectRead       bool
+		readError        error
 		expectUpdate     bool
 		dbError          error
 		expectedError    error
 		expectedResponse SaveNoteResponseObject
 	}
 
-	tests := []addNoteTest{
+	tests := []saveNoteTest{
 		{
-			name:             "Valid note update",
+			name:             "Valid note update by author",
 			recipeID:         1,
 			noteID:           2,
+			userID:           5,
+			accessLevel:      models.Editor,
+			existingAuthor:   new(int64(5)),
 			note:             models.Note{ID: new(int64(2)), RecipeID: new(int64(1)), Text: "Updated note text."},
+			expectRead:       true,
 			expectUpdate:     true,
 			dbError:          nil,
 			expectedError:    nil,
 			expectedResponse: SaveNote204Response{},
 		},
+		{
+			name:             "Valid note update by admin",
+			recipeID:         1,
+			noteID:           2,
+			userID:           6,
+			accessLevel:      models.Admin,
+			existingAuthor:   new(int64(5)),
+			note:             models.Note{ID: new(int64(2)), RecipeID: new(int64(1)), Text: "Updated note text."},
+			expectRead:       true,
+			expectUpdate:     true,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: SaveNote204Response{},
+		},
+		{
+			name:             "Note update by another editor",
+			recipeID:         1,
+			noteID:           2,
+			userID:           6,
+			accessLevel:      models.Editor,
+			existingAuthor:   new(int64(5)),
+			note:             models.Note{ID: new(int64(2)), RecipeID: new(int64(1)), Text: "Updated note text."},
+			expectRead:       true,
+			expectUpdate:     false,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: SaveNote403Response{},
+		},
+		{
+			name:             "Authorless note update by editor",
+			recipeID:         1,
+			noteID:           2,
+			userID:           6,
+			accessLevel:      models.Editor,
+			existingAuthor:   nil,
+			note:             models.Note{ID: new(int64(2)), RecipeID: new(int64(1)), Text: "Updated note text."},
+			expectRead:       true,
+			expectUpdate:     false,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: SaveNote403Response{},
+		},
 		{
 			name:             "Recipe or note not found",
 			recipeID:         1,
 			noteID:           2,
+			userID:           5,
 			note:             models.Note{ID: new(int64(2)), RecipeID: new(int64(1)), Text: "Note fixture for not found case."},
-			expectUpdate:     true,
-			dbError:          db.ErrNotFound,
+			expectRead:       true,
+			readError:        db.ErrNotFound,
+			expectUpdate:     false,
+			dbError:          nil,
 			expectedError:    nil,
 			expectedResponse: SaveNote404Response{},
 		},
@@ -242,7 +363,9 @@ func Test_SaveNote(t *testing.T) {
 			name:             "Mismatched note ID",
 			recipeID:         1,
 			noteID:           2,
+			userID:           5,
 			note:             models.Note{ID: new(int64(3)), RecipeID: new(int64(1)), Text: "Mismatched note ID fixture."},
+			expectRead:       false,
 			expectUpdate:     false,
 			dbError:          nil,
 			expectedError:    nil,
@@ -252,7 +375,9 @@ func Test_SaveNote(t *testing.T) {
 			name:             "Mismatched recipe ID",
 			recipeID:         1,
 			noteID:           2,
+			userID:           5,
 			note:             models.Note{ID: new(int64(2)), RecipeID: new(int64(3)), Text: "Mismatched recipe ID fixture."},
+			expectRead:       false,
 			expectUpdate:     false,
 			dbError:          nil,
 			expectedError:    nil,
@@ -262,7 +387,11 @@ func Test_SaveNote(t *testing.T) {
 			name:             "Database error",
 			recipeID:         1,
 			noteID:           2,
+			userID:           5,
+			accessLevel:      models.Editor,
+			existingAuthor:   new(int64(5)),
 			note:             models.Note{ID: new(int64(2)), RecipeID: new(int64(1)), Text: "Intentional failing note fixture."},
+			expectRead:       true,
 			expectUpdate:     true,
 			dbError:          sql.ErrConnDone,
 			expectedError:    sql.ErrConnDone,
@@ -275,17 +404,20 @@ func Test_SaveNote(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			api, notesDriver := getMockNotesAPI(ctrl)
+			ctx := context.WithValue(t.Context(), currentUserIDCtxKey, test.userID)
+
+			api, notesDriver, usersDriver, _ := getMockNotesAPI(ctrl)
+			expectNoteAuthorization(ctx, notesDriver, usersDriver, test.expectRead, test.readError, test.recipeID, test.noteID, test.userID, test.existingAuthor, test.accessLevel)
 			if test.expectUpdate {
 				if test.dbError != nil {
-					notesDriver.EXPECT().Update(t.Context(), gomock.Any()).Return(test.dbError)
+					notesDriver.EXPECT().Update(ctx, gomock.Any()).Return(test.dbError)
 				} else {
-					notesDriver.EXPECT().Update(t.Context(), &test.note).Return(nil)
+					notesDriver.EXPECT().Update(ctx, &test.note).Return(nil)
 				}
 			}
 
 			// Act
-			resp, err := api.SaveNote(t.Context(), SaveNoteRequestObject{RecipeID: test.recipeID, NoteID: test.noteID, Body: &test.note})
+			resp, err := api.SaveNote(ctx, SaveNoteRequestObject{RecipeID: test.recipeID, NoteID: test.noteID, Body: &test.note})
 
 			// Assert
 			if !errors.Is(err, test.expectedError) {
@@ -296,10 +428,17 @@ func Test_SaveNote(t *testing.T) {
 					if _, ok := resp.(SaveNote204Response); !ok {
 						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
 					}
+					if test.note.ModifiedBy == nil || *test.note.ModifiedBy != test.userID {
+						t.Errorf("expected modified by: %d, actual modified by: %v", test.userID, test.note.ModifiedBy)
+					}
 				case SaveNote400Response:
 					if _, ok := resp.(SaveNote400Response); !ok {
 						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
 					}
+				case SaveNote403Response:
+					if _, ok := resp.(SaveNote403Response); !ok {
+						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
+					}
 				case SaveNote404Response:
 					if _, ok := resp.(SaveNote404Response); !ok {
 						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
@@ -313,29 +452,65 @@ func Test_SaveNote(t *testing.T) {
 }
 
 func Test_DeleteNote(t *testing.T) {
-	type deleteLinkTest struct {
+	type deleteNoteTest struct {
 		name             string
 		recipeID         int64
 		noteID           int64
+		userID           int64
+		accessLevel      models.AccessLevel
+		existingAuthor   *int64
+		readError        error
+		expectDelete     bool
 		dbError          error
 		expectedError    error
 		expectedResponse DeleteNoteResponseObject
 	}
 
-	tests := []deleteLinkTest{
+	tests := []deleteNoteTest{
 		{
-			name:             "Valid note deletion",
+			name:             "Valid note deletion by author",
 			recipeID:         1,
 			noteID:           2,
+			userID:           5,
+			accessLevel:      models.Viewer,
+			existingAuthor:   new(int64(5)),
+			expectDelete:     true,
 			dbError:          nil,
 			expectedError:    nil,
 			expectedResponse: DeleteNote204Response{},
 		},
+		{
+			name:             "Valid authorless note deletion by admin",
+			recipeID:         1,
+			noteID:           2,
+			userID:           6,
+			accessLevel:      models.Admin,
+			existingAuthor:   nil,
+			expectDelete:     true,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: DeleteNote204Response{},
+		},
+		{
+			name:             "Note deletion by another editor",
+			recipeID:         1,
+			noteID:           2,
+			userID:           6,
+			accessLevel:      models.Editor,
+			existingAuthor:   new(int64(5)),
+			expectDelete:     false,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: DeleteNote403Response{},
+		},
 		{
 			name:             "Note not found",
 			recipeID:         1,
 			noteID:           2,
-			dbError:          db.ErrNotFound,
+			userID:           5,
+			readError:        db.ErrNotFound,
+			expectDelete:     false,
+			dbError:          nil,
 			expectedError:    nil,
 			expectedResponse: DeleteNote404Response{},
 		},
@@ -343,26 +518,31 @@ func Test_DeleteNote(t *testing.T) {
 			name:             "Database error",
 			recipeID:         1,
 			noteID:           2,
+			userID:           5,
+			accessLevel:      models.Editor,
+			existingAuthor:   new(int64(5)),
+			expectDelete:     true,
 			dbError:          sql.ErrConnDone,
 			expectedError:    sql.ErrConnDone,
 			expectedResponse: nil,
 		},
 	}
-	for i, test := range tests {
-		t.Run(fmt.Sprint(i), func(t *testing.T) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
 			// Arrange
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			api, notesDriver := getMockNotesAPI(ctrl)
-			if test.dbError != nil {
-				notesDriver.EXPECT().Delete(t.Context(), gomock.Any(), gomock.Any()).Return(test.dbError)
-			} else {
-				notesDriver.EXPECT().Delete(t.Context(), test.recipeID, test.noteID).Return(nil)
+			ctx := context.WithValue(t.Context(), currentUserIDCtxKey, test.userID)
+
+			api, notesDriver, usersDriver, _ := getMockNotesAPI(ctrl)
+			expectNoteAuthorization(ctx, notesDriver, usersDriver, true, test.readError, test.recipeID, test.noteID, test.userID, test.existingAuthor, test.accessLevel)
+			if test.expectDelete {
+				notesDriver.EXPECT().Delete(ctx, test.recipeID, test.noteID).Return(test.dbError)
 			}
 
 			// Act
-			resp, err := api.DeleteNote(t.Context(), DeleteNoteRequestObject{RecipeID: test.recipeID, NoteID: test.noteID})
+			resp, err := api.DeleteNote(ctx, DeleteNoteRequestObject{RecipeID: test.recipeID, NoteID: test.noteID})
 
 			// Assert
 			if !errors.Is(err, test.expectedError) {
@@ -373,6 +553,10 @@ func Test_DeleteNote(t *testing.T) {
 					if _, ok := resp.(DeleteNote204Response); !ok {
 						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
 					}
+				case DeleteNote403Response:
+					if _, ok := resp.(DeleteNote403Response); !ok {
+						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
+					}
 				case DeleteNote404Response:
 					if _, ok := resp.(DeleteNote404Response); !ok {
 						t.Fatalf("expected %T, got %T", test.expectedResponse, resp)
@@ -385,10 +569,35 @@ func Test_DeleteNote(t *testing.T) {
 	}
 }
 
-func getMockNotesAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockNoteDriver) {
+func expectNoteAuthorization(
+	ctx context.Context,
+	notesDriver *dbmock.MockNoteDriver,
+	usersDriver *dbmock.MockUserDriver,
+	expectRead bool,
+	readError error,
+	recipeID, noteID, userID int64,
+	existingAuthor *int64,
+	accessLevel models.AccessLevel) {
+	if !expectRead {
+		return
+	}
+	if readError != nil {
+		notesDriver.EXPECT().Read(ctx, recipeID, noteID).Return(nil, readError)
+		return
+	}
+
+	notesDriver.EXPECT().Read(ctx, recipeID, noteID).Return(&models.Note{ID: &noteID, RecipeID: &recipeID, CreatedBy: existingAuthor}, nil)
+	if existingAuthor == nil || *existingAuthor != userID {
+		usersDriver.EXPECT().Read(ctx, userID).Return(&db.UserWithPasswordHash{User: models.User{ID: &userID, AccessLevel: accessLevel}}, nil)
+	}
+}
+
+func getMockNotesAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockNoteDriver, *dbmock.MockUserDriver, *fileaccessmock.MockDriver) {
 	dbDriver := dbmock.NewMockDriver(ctrl)
 	notesDriver := dbmock.NewMockNoteDriver(ctrl)
 	dbDriver.EXPECT().Notes().AnyTimes().Return(notesDriver)
+	usersDriver := dbmock.NewMockUserDriver(ctrl)
+	dbDriver.EXPECT().Users().AnyTimes().Return(usersDriver)
 	uplDriver := fileaccessmock.NewMockDriver(ctrl)
 	imgCfg := fileaccess.ImageConfig{
 		ImageQuality:     models.ImageQualityOriginal,
@@ -396,12 +605,12 @@ func getMockNotesAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockNoteDrive
 		ThumbnailQuality: models.ImageQualityMedium,
 		ThumbnailSize:    500,
 	}
-	upl, _ := fileaccess.CreateImageUploader(uplDriver, imgCfg)
+	upl, _ := fileaccess.CreateImageUploader(uplDriver, fileaccessmock.NewMockImageReferences(ctrl), imgCfg)
 
 	api := apiHandler{
 		secureKeys: []string{},
 		upl:        upl,
 		db:         dbDriver,
 	}
-	return api, notesDriver
+	return api, notesDriver, usersDriver, uplDriver
 }
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/infra"
+)
+
+func (h apiHandler) EstimateRecipeNutrition(ctx context.Context, request EstimateRecipeNutritionRequestObject) (EstimateRecipeNutritionResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx).With("recipe-id", request.RecipeID)
+
+	if h.nutrition == nil {
+		logger.WarnContext(ctx, "nutrition estimates are disabled")
+		return EstimateRecipeNutrition404Response{}, nil
+	}
+
+	recipe, err := h.db.Recipes().Read(ctx, request.RecipeID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return EstimateRecipeNutrition404Response{}, nil
+		}
+		logger.ErrorContext(ctx, "Failed to read recipe", "error", err)
+		return nil, err
+	}
+
+	return EstimateRecipeNutrition200JSONResponse(h.nutrition.Estimate(recipe.Ingredients, recipe.ServingSize)), nil
+}
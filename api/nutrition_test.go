@@ -0,0 +1,81 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/nutrition"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_EstimateRecipeNutrition(t *testing.T) {
+	type testArgs struct {
+		name          string
+		disabled      bool
+		dbError       error
+		expectedError error
+		expectedFound bool
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{name: "Success", expectedFound: true},
+		{name: "Disabled", disabled: true},
+		{name: "Recipe not found", dbError: db.ErrNotFound},
+		{name: "Database error", dbError: sql.ErrConnDone, expectedError: sql.ErrConnDone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			api, recipesDriver, _ := getMockRecipesAPI(ctrl)
+
+			if !test.disabled {
+				nutritionDb, err := nutrition.LoadDatabase(strings.NewReader(
+					"name,calories,protein,fat,carbohydrates,fiber,sodium,sugar,grams_per_each\n" +
+						"lemon,29,1.1,0.3,9.3,2.8,2,2.5,58\n"))
+				if err != nil {
+					t.Fatalf("failed to load nutrient database: %v", err)
+				}
+				api.nutrition = nutritionDb
+
+				recipe := recipeFixtureLemonGarlicChicken()
+				if test.dbError != nil {
+					recipesDriver.EXPECT().Read(t.Context(), int64(1)).Return(nil, test.dbError)
+				} else {
+					recipesDriver.EXPECT().Read(t.Context(), int64(1)).Return(recipe, nil)
+				}
+			}
+
+			// Act
+			resp, err := api.EstimateRecipeNutrition(t.Context(), EstimateRecipeNutritionRequestObject{RecipeID: 1})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if test.expectedError != nil {
+				return
+			}
+			if !test.expectedFound {
+				if _, ok := resp.(EstimateRecipeNutrition404Response); !ok {
+					t.Errorf("expected EstimateRecipeNutrition404Response, got %T", resp)
+				}
+				return
+			}
+			estimate, ok := resp.(EstimateRecipeNutrition200JSONResponse)
+			if !ok {
+				t.Fatalf("expected EstimateRecipeNutrition200JSONResponse, got %T", resp)
+			}
+			if len(estimate.Ingredients) != 1 || estimate.Ingredients[0].Food != "lemon" {
+				t.Errorf("expected only the lemon to be matched, received: %v", estimate.Ingredients)
+			}
+			if len(estimate.Unmatched) != 3 {
+				t.Errorf("expected 3 unmatched ingredients, received: %v", estimate.Unmatched)
+			}
+		})
+	}
+}
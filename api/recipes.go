@@ -3,6 +3,8 @@ package api
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
 
 	"github.com/chadweimer/gomp/db"
 	"github.com/chadweimer/gomp/infra"
@@ -24,8 +26,19 @@ func (h apiHandler) Find(ctx context.Context, request FindRequestObject) (FindRe
 		states = *params.States
 	}
 	tags := make([]string, 0)
+	excludedTags := make([]string, 0)
 	if params.Tags != nil {
-		tags = *params.Tags
+		for _, tag := range *params.Tags {
+			if excludedTag, ok := strings.CutPrefix(tag, "-"); ok {
+				excludedTags = append(excludedTags, excludedTag)
+			} else {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	tagMatch := models.Any
+	if params.TagMatch != nil {
+		tagMatch = *params.TagMatch
 	}
 	var withPictures *bool
 	if params.Pictures != nil {
@@ -45,10 +58,18 @@ func (h apiHandler) Find(ctx context.Context, request FindRequestObject) (FindRe
 	if params.Sort != nil {
 		sortBy = *params.Sort
 	}
+	// Higher relevance is better, so the most relevant recipes come first unless asked otherwise
 	sortDir := models.Asc
-	if params.Sort != nil {
+	if sortBy == models.SortByRelevance {
+		sortDir = models.Desc
+	}
+	if params.Dir != nil {
 		sortDir = *params.Dir
 	}
+	withHighlights := false
+	if params.Highlight != nil {
+		withHighlights = *params.Highlight
+	}
 	page := int64(1)
 	if params.Page != nil {
 		page = *params.Page
@@ -58,18 +79,31 @@ func (h apiHandler) Find(ctx context.Context, request FindRequestObject) (FindRe
 		Query:        query,
 		Fields:       fields,
 		Tags:         tags,
+		TagMatch:     tagMatch,
+		ExcludedTags: excludedTags,
 		WithPictures: withPictures,
 		States:       states,
+		MaxTotalTime: params.MaxTotalTime,
 		SortBy:       sortBy,
 		SortDir:      sortDir,
 	}
 
-	recipes, total, err := h.db.Recipes().Find(ctx, &filter, page, params.Count)
+	recipes, total, err := h.db.Recipes().Find(ctx, &filter, withHighlights, page, params.Count)
 	if err != nil {
+		if errors.Is(err, db.ErrInvalidQuery) {
+			return Find400TextResponse(err.Error()), nil
+		}
 		return nil, err
 	}
 
-	return Find200JSONResponse{Recipes: recipes, Total: total}, nil
+	var facets *models.SearchFacets
+	if params.Facets != nil && *params.Facets {
+		if facets, err = h.db.Recipes().GetFacets(ctx, &filter); err != nil {
+			return nil, err
+		}
+	}
+
+	return Find200JSONResponse{Recipes: recipes, Total: total, Facets: facets}, nil
 }
 
 func (h apiHandler) GetRecipe(ctx context.Context, request GetRecipeRequestObject) (GetRecipeResponseObject, error) {
@@ -93,6 +127,15 @@ func (h apiHandler) AddRecipe(ctx context.Context, request AddRecipeRequestObjec
 	logger := infra.GetLoggerFromContext(ctx)
 
 	recipe := request.Body
+
+	// A new recipe doesn't have any images yet for its steps to use
+	if recipe.Steps != nil && slices.ContainsFunc(*recipe.Steps, func(step models.RecipeStep) bool {
+		return step.ImageName != nil && *step.ImageName != ""
+	}) {
+		logger.ErrorContext(ctx, "New recipe cannot have step images")
+		return AddRecipe400Response{}, nil
+	}
+
 	if err := h.db.Recipes().Create(ctx, recipe); err != nil {
 		logger.ErrorContext(ctx, "Failed to add recipe", "error", err)
 		return nil, err
@@ -114,6 +157,18 @@ func (h apiHandler) SaveRecipe(ctx context.Context, request SaveRecipeRequestObj
 		return SaveRecipe400Response{}, nil
 	}
 
+	if recipe.Steps != nil {
+		imageNames := make([]*string, 0, len(*recipe.Steps))
+		for _, step := range *recipe.Steps {
+			imageNames = append(imageNames, step.ImageName)
+		}
+		if ok, err := h.areRecipeImagesValid(ctx, request.RecipeID, imageNames...); err != nil {
+			return nil, err
+		} else if !ok {
+			return SaveRecipe400Response{}, nil
+		}
+	}
+
 	if err := h.db.Recipes().Update(ctx, recipe); err != nil {
 		if errors.Is(err, db.ErrNotFound) {
 			return SaveRecipe404Response{}, nil
@@ -158,7 +213,7 @@ func (h apiHandler) DeleteRecipe(ctx context.Context, request DeleteRecipeReques
 	}
 
 	// Delete all the uploaded image files associated with the recipe also
-	if err := h.upl.DeleteAll(request.RecipeID); err != nil {
+	if err := h.upl.DeleteAll(ctx, request.RecipeID); err != nil {
 		return nil, err
 	}
 
@@ -4,14 +4,20 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io/fs"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/chadweimer/gomp/db"
 	"github.com/chadweimer/gomp/fileaccess"
 	dbmock "github.com/chadweimer/gomp/mocks/db"
 	fileaccessmock "github.com/chadweimer/gomp/mocks/fileaccess"
 	"github.com/chadweimer/gomp/models"
+	"github.com/samber/lo"
 	"go.uber.org/mock/gomock"
 )
 
@@ -148,16 +154,24 @@ func Test_GetRecipe(t *testing.T) {
 
 func Test_AddRecipe(t *testing.T) {
 	type testArgs struct {
-		recipe        *models.Recipe
-		expectedError error
+		recipe             *models.Recipe
+		expectedError      error
+		expectedBadRequest bool
 	}
 
 	// Arrange
 	tests := []testArgs{
 		{
-			recipeFixtureLemonGarlicChicken(), nil,
+			recipeFixtureLemonGarlicChicken(), nil, false,
+		},
+		{recipeFixtureSheetPanSausage(), db.ErrNotFound, false},
+		{
+			func() *models.Recipe {
+				recipe := recipeFixtureChickpeaSaladWraps()
+				recipe.Steps = &[]models.RecipeStep{{Text: "Mash the chickpeas.", ImageName: new("chickpeas.jpeg")}}
+				return recipe
+			}(), nil, true,
 		},
-		{nil, db.ErrNotFound},
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprint(i), func(t *testing.T) {
@@ -167,7 +181,7 @@ func Test_AddRecipe(t *testing.T) {
 			api, recipesDriver, _ := getMockRecipesAPI(ctrl)
 			if test.expectedError != nil {
 				recipesDriver.EXPECT().Create(t.Context(), gomock.Any()).Return(test.expectedError)
-			} else {
+			} else if !test.expectedBadRequest {
 				recipesDriver.EXPECT().Create(t.Context(), test.recipe).Return(nil)
 			}
 
@@ -177,6 +191,10 @@ func Test_AddRecipe(t *testing.T) {
 			// Assert
 			if !errors.Is(err, test.expectedError) {
 				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			} else if err == nil && test.expectedBadRequest {
+				if _, ok := resp.(AddRecipe400Response); !ok {
+					t.Fatalf("expected AddRecipe400Response, got %T", resp)
+				}
 			} else if err == nil {
 				got, ok := resp.(AddRecipe201JSONResponse)
 				if !ok {
@@ -195,6 +213,8 @@ func Test_SaveRecipe(t *testing.T) {
 		name             string
 		recipeID         int64
 		recipe           *models.Recipe
+		images           []string
+		expectUpdate     bool
 		dbError          error
 		expectedError    error
 		expectedResponse SaveRecipeResponseObject
@@ -206,6 +226,7 @@ func Test_SaveRecipe(t *testing.T) {
 			name:             "Recipe exists with matching ID in body",
 			recipeID:         1,
 			recipe:           recipeFixtureLemonGarlicChicken(),
+			expectUpdate:     true,
 			dbError:          nil,
 			expectedError:    nil,
 			expectedResponse: SaveRecipe204Response{},
@@ -218,6 +239,7 @@ func Test_SaveRecipe(t *testing.T) {
 				recipe.ID = new(int64(1))
 				return recipe
 			}(),
+			expectUpdate:     true,
 			dbError:          nil,
 			expectedError:    nil,
 			expectedResponse: SaveRecipe204Response{},
@@ -234,10 +256,70 @@ func Test_SaveRecipe(t *testing.T) {
 			expectedError:    nil,
 			expectedResponse: SaveRecipe400Response{},
 		},
+		{
+			name:     "Step with uploaded image",
+			recipeID: 1,
+			recipe: func() *models.Recipe {
+				recipe := recipeFixtureLemonGarlicChicken()
+				recipe.Steps = &[]models.RecipeStep{{Text: "Roast at 400F.", ImageName: new("roasted.jpeg")}}
+				return recipe
+			}(),
+			images:           []string{"roasted.jpeg"},
+			expectUpdate:     true,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: SaveRecipe204Response{},
+		},
+		{
+			name:     "Steps with uploaded images",
+			recipeID: 1,
+			recipe: func() *models.Recipe {
+				recipe := recipeFixtureLemonGarlicChicken()
+				recipe.Steps = &[]models.RecipeStep{
+					{Text: "Marinate the chicken.", ImageName: new("marinated.jpeg")},
+					{Text: "Slice the lemons."},
+					{Text: "Roast at 400F.", ImageName: new("roasted.jpeg")},
+				}
+				return recipe
+			}(),
+			images:           []string{"marinated.jpeg", "roasted.jpeg"},
+			expectUpdate:     true,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: SaveRecipe204Response{},
+		},
+		{
+			name:     "Step with missing image",
+			recipeID: 1,
+			recipe: func() *models.Recipe {
+				recipe := recipeFixtureLemonGarlicChicken()
+				recipe.Steps = &[]models.RecipeStep{{Text: "Roast at 400F.", ImageName: new("missing.jpeg")}}
+				return recipe
+			}(),
+			images:           []string{"roasted.jpeg"},
+			expectUpdate:     false,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: SaveRecipe400Response{},
+		},
+		{
+			name:     "Step with unsafe image name",
+			recipeID: 1,
+			recipe: func() *models.Recipe {
+				recipe := recipeFixtureLemonGarlicChicken()
+				recipe.Steps = &[]models.RecipeStep{{Text: "Roast at 400F.", ImageName: new("../roasted.jpeg")}}
+				return recipe
+			}(),
+			expectUpdate:     false,
+			dbError:          nil,
+			expectedError:    nil,
+			expectedResponse: SaveRecipe400Response{},
+		},
 		{
 			name:             "Recipe does not exist",
 			recipeID:         2,
 			recipe:           recipeFixtureSheetPanSausage(),
+			expectUpdate:     true,
 			dbError:          db.ErrNotFound,
 			expectedError:    nil,
 			expectedResponse: SaveRecipe404Response{},
@@ -246,6 +328,7 @@ func Test_SaveRecipe(t *testing.T) {
 			name:             "DB error",
 			recipeID:         2,
 			recipe:           recipeFixtureSheetPanSausage(),
+			expectUpdate:     true,
 			dbError:          sql.ErrConnDone,
 			expectedError:    sql.ErrConnDone,
 			expectedResponse: nil,
@@ -256,11 +339,21 @@ func Test_SaveRecipe(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			api, recipesDriver, _ := getMockRecipesAPI(ctrl)
-			if test.dbError != nil {
-				recipesDriver.EXPECT().Update(t.Context(), gomock.Any()).Return(test.dbError)
-			} else {
-				recipesDriver.EXPECT().Update(t.Context(), test.recipe).MaxTimes(1).Return(nil)
+			api, recipesDriver, uplDriver := getMockRecipesAPI(ctrl)
+			if test.images != nil {
+				// Uploaded images are referenced by the recipe, rather than stored in its directories
+				recipeDir := filepath.Join("uploads", "recipes", strconv.FormatInt(test.recipeID, 10))
+				uplDriver.EXPECT().List(filepath.Join(recipeDir, "images")).Return(nil, fs.ErrNotExist)
+				uplDriver.EXPECT().List(filepath.Join(recipeDir, "refs")).Return(createMockDirEntries(lo.SliceToMap(test.images, func(name string) (string, *fstest.MapFile) {
+					return name, &fstest.MapFile{}
+				})), nil)
+			}
+			if test.expectUpdate {
+				if test.dbError != nil {
+					recipesDriver.EXPECT().Update(t.Context(), gomock.Any()).Return(test.dbError)
+				} else {
+					recipesDriver.EXPECT().Update(t.Context(), test.recipe).Return(nil)
+				}
 			}
 
 			// Act
@@ -412,6 +505,7 @@ func Test_DeleteRecipe(t *testing.T) {
 				recipesDriver.EXPECT().Delete(t.Context(), gomock.Any()).Return(test.dbError)
 			} else {
 				recipesDriver.EXPECT().Delete(t.Context(), test.recipeID).Return(nil)
+				uplDriver.EXPECT().List(gomock.Any()).Return(nil, fs.ErrNotExist)
 				uplDriver.EXPECT().DeleteAll(gomock.Any()).Return(nil)
 			}
 
@@ -445,10 +539,14 @@ func Test_Find(t *testing.T) {
 		expectedQuery        string
 		expectedFields       []models.SearchField
 		expectedTags         []string
+		expectedTagMatch     models.TagMatch
+		expectedExcludedTags []string
 		expectedStates       []models.RecipeState
 		expectedWithPictures *bool
+		expectedMaxTotalTime *models.Duration
 		expectedSortBy       models.SortBy
 		expectedSortDir      models.SortDir
+		expectedHighlights   bool
 		expectedPage         int64
 		expectedCount        int64
 		recipes              *[]models.RecipeCompact
@@ -464,10 +562,14 @@ func Test_Find(t *testing.T) {
 	pageVal := int64(2)
 	qVal := "chicken"
 	fieldsVal := []models.SearchField{models.SearchFieldName, models.SearchFieldIngredients}
-	tagsVal := []string{"easy", "dinner"}
+	tagsVal := []string{"easy", "-spicy", "dinner*"}
+	tagMatchVal := models.All
 	statesVal := []models.RecipeState{models.Active, models.Archived}
 	sortByVal := models.SortByName
 	sortDirVal := models.Desc
+	sortByRelevanceVal := models.SortByRelevance
+	sortByTotalTimeVal := models.SortByTotalTime
+	maxTotalTimeVal := models.Duration(30 * time.Minute)
 
 	tests := []testArgs{
 		{
@@ -475,6 +577,8 @@ func Test_Find(t *testing.T) {
 			expectedQuery:        "",
 			expectedFields:       []models.SearchField{},
 			expectedTags:         []string{},
+			expectedTagMatch:     models.Any,
+			expectedExcludedTags: []string{},
 			expectedStates:       []models.RecipeState{},
 			expectedWithPictures: nil,
 			expectedSortBy:       models.SortByID,
@@ -490,6 +594,7 @@ func Test_Find(t *testing.T) {
 				Q:        &qVal,
 				Fields:   &fieldsVal,
 				Tags:     &tagsVal,
+				TagMatch: &tagMatchVal,
 				States:   &statesVal,
 				Pictures: &yesVal,
 				Sort:     &sortByVal,
@@ -499,7 +604,9 @@ func Test_Find(t *testing.T) {
 			},
 			expectedQuery:        qVal,
 			expectedFields:       fieldsVal,
-			expectedTags:         tagsVal,
+			expectedTags:         []string{"easy", "dinner*"},
+			expectedTagMatch:     tagMatchVal,
+			expectedExcludedTags: []string{"spicy"},
 			expectedStates:       statesVal,
 			expectedWithPictures: &trueVal,
 			expectedSortBy:       sortByVal,
@@ -510,6 +617,77 @@ func Test_Find(t *testing.T) {
 			total:                5,
 			expectedError:        nil,
 		},
+		{
+			params: FindParams{
+				Q:         &qVal,
+				Sort:      &sortByRelevanceVal,
+				Highlight: &trueVal,
+				Count:     countVal,
+			},
+			expectedQuery:        qVal,
+			expectedFields:       []models.SearchField{},
+			expectedTags:         []string{},
+			expectedTagMatch:     models.Any,
+			expectedExcludedTags: []string{},
+			expectedStates:       []models.RecipeState{},
+			expectedWithPictures: nil,
+			expectedSortBy:       sortByRelevanceVal,
+			expectedSortDir:      models.Desc,
+			expectedHighlights:   true,
+			expectedPage:         1,
+			expectedCount:        countVal,
+			recipes: &[]models.RecipeCompact{{
+				Name:       "Recipe3",
+				Relevance:  new(float32(0.5)),
+				Highlights: &[]models.SearchHighlight{{Field: models.SearchFieldName, Snippet: "<mark>chicken</mark>"}},
+			}},
+			total:         1,
+			expectedError: nil,
+		},
+		{
+			params: FindParams{
+				Q:     &qVal,
+				Sort:  &sortByRelevanceVal,
+				Dir:   new(models.Asc),
+				Count: countVal,
+			},
+			expectedQuery:        qVal,
+			expectedFields:       []models.SearchField{},
+			expectedTags:         []string{},
+			expectedTagMatch:     models.Any,
+			expectedExcludedTags: []string{},
+			expectedStates:       []models.RecipeState{},
+			expectedWithPictures: nil,
+			expectedSortBy:       sortByRelevanceVal,
+			expectedSortDir:      models.Asc,
+			expectedPage:         1,
+			expectedCount:        countVal,
+			recipes:              &[]models.RecipeCompact{{Name: "Recipe3"}},
+			total:                1,
+			expectedError:        nil,
+		},
+		{
+			params: FindParams{
+				MaxTotalTime: &maxTotalTimeVal,
+				Sort:         &sortByTotalTimeVal,
+				Count:        countVal,
+			},
+			expectedQuery:        "",
+			expectedFields:       []models.SearchField{},
+			expectedTags:         []string{},
+			expectedTagMatch:     models.Any,
+			expectedExcludedTags: []string{},
+			expectedStates:       []models.RecipeState{},
+			expectedWithPictures: nil,
+			expectedMaxTotalTime: &maxTotalTimeVal,
+			expectedSortBy:       sortByTotalTimeVal,
+			expectedSortDir:      models.Asc,
+			expectedPage:         1,
+			expectedCount:        countVal,
+			recipes:              &[]models.RecipeCompact{{Name: "Recipe4"}},
+			total:                1,
+			expectedError:        nil,
+		},
 		{
 			params: FindParams{
 				Pictures: &noVal,
@@ -517,6 +695,8 @@ func Test_Find(t *testing.T) {
 			expectedQuery:        "",
 			expectedFields:       []models.SearchField{},
 			expectedTags:         []string{},
+			expectedTagMatch:     models.Any,
+			expectedExcludedTags: []string{},
 			expectedStates:       []models.RecipeState{},
 			expectedWithPictures: &falseVal,
 			expectedSortBy:       models.SortByID,
@@ -532,6 +712,8 @@ func Test_Find(t *testing.T) {
 			expectedQuery:        "",
 			expectedFields:       []models.SearchField{},
 			expectedTags:         []string{},
+			expectedTagMatch:     models.Any,
+			expectedExcludedTags: []string{},
 			expectedStates:       []models.RecipeState{},
 			expectedWithPictures: nil,
 			expectedSortBy:       models.SortByID,
@@ -554,19 +736,22 @@ func Test_Find(t *testing.T) {
 				Query:        test.expectedQuery,
 				Fields:       test.expectedFields,
 				Tags:         test.expectedTags,
+				TagMatch:     test.expectedTagMatch,
+				ExcludedTags: test.expectedExcludedTags,
 				WithPictures: test.expectedWithPictures,
 				States:       test.expectedStates,
+				MaxTotalTime: test.expectedMaxTotalTime,
 				SortBy:       test.expectedSortBy,
 				SortDir:      test.expectedSortDir,
 			}
 
 			if test.expectedError != nil {
 				recipesDriver.EXPECT().
-					Find(t.Context(), &expectedFilter, test.expectedPage, test.expectedCount).
+					Find(t.Context(), &expectedFilter, test.expectedHighlights, test.expectedPage, test.expectedCount).
 					Return(nil, int64(0), test.expectedError)
 			} else {
 				recipesDriver.EXPECT().
-					Find(t.Context(), &expectedFilter, test.expectedPage, test.expectedCount).
+					Find(t.Context(), &expectedFilter, test.expectedHighlights, test.expectedPage, test.expectedCount).
 					Return(test.recipes, test.total, nil)
 			}
 
@@ -595,10 +780,79 @@ func Test_Find(t *testing.T) {
 	}
 }
 
+func Test_Find_InvalidQuery(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	api, recipesDriver, _ := getMockRecipesAPI(ctrl)
+
+	query := `name:"soup`
+	queryErr := fmt.Errorf("%w: unterminated quote at position 6", db.ErrInvalidQuery)
+	recipesDriver.EXPECT().
+		Find(t.Context(), gomock.Any(), false, int64(1), int64(10)).
+		Return(nil, int64(0), queryErr)
+
+	// Act
+	resp, err := api.Find(t.Context(), FindRequestObject{Params: FindParams{Q: &query, Count: 10}})
+
+	// Assert
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	got, ok := resp.(Find400TextResponse)
+	if !ok {
+		t.Fatalf("expected Find400TextResponse, got %T", resp)
+	}
+	if string(got) != queryErr.Error() {
+		t.Errorf("expected message: %s, got: %s", queryErr.Error(), got)
+	}
+}
+
+func Test_Find_WithFacets(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	api, recipesDriver, _ := getMockRecipesAPI(ctrl)
+
+	recipes := &[]models.RecipeCompact{{Name: "Recipe1"}}
+	facets := &models.SearchFacets{
+		Tags:      []models.FacetCount{{Value: "chicken", Count: 1}},
+		States:    []models.FacetCount{{Value: string(models.Active), Count: 1}},
+		Pictures:  []models.FacetCount{{Value: "without", Count: 1}},
+		Ratings:   []models.FacetCount{{Value: "0", Count: 1}},
+		CookTimes: []models.FacetCount{{Value: "unknown", Count: 1}},
+	}
+	recipesDriver.EXPECT().
+		Find(t.Context(), gomock.Any(), false, int64(1), int64(10)).
+		Return(recipes, int64(1), nil)
+	recipesDriver.EXPECT().
+		GetFacets(t.Context(), gomock.Any()).
+		Return(facets, nil)
+
+	// Act
+	resp, err := api.Find(t.Context(), FindRequestObject{Params: FindParams{Facets: new(true), Count: 10}})
+
+	// Assert
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	got, ok := resp.(Find200JSONResponse)
+	if !ok {
+		t.Fatalf("expected Find200JSONResponse, got %T", resp)
+	}
+	if got.Facets != facets {
+		t.Errorf("expected facets: %v, got: %v", facets, got.Facets)
+	}
+}
+
 func getMockRecipesAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockRecipeDriver, *fileaccessmock.MockDriver) {
 	dbDriver := dbmock.NewMockDriver(ctrl)
 	recipeDriver := dbmock.NewMockRecipeDriver(ctrl)
 	dbDriver.EXPECT().Recipes().AnyTimes().Return(recipeDriver)
+	// None of the images have details
+	imageDriver := dbmock.NewMockImageDriver(ctrl)
+	imageDriver.EXPECT().List(gomock.Any(), gomock.Any()).AnyTimes().Return(&[]models.RecipeImage{}, nil)
+	dbDriver.EXPECT().Images().AnyTimes().Return(imageDriver)
 	uplDriver := fileaccessmock.NewMockDriver(ctrl)
 	imgCfg := fileaccess.ImageConfig{
 		ImageQuality:     models.ImageQualityOriginal,
@@ -606,12 +860,13 @@ func getMockRecipesAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockRecipeD
 		ThumbnailQuality: models.ImageQualityMedium,
 		ThumbnailSize:    500,
 	}
-	upl, _ := fileaccess.CreateImageUploader(uplDriver, imgCfg)
+	upl, _ := fileaccess.CreateImageUploader(uplDriver, fileaccessmock.NewMockImageReferences(ctrl), imgCfg)
 
 	api := apiHandler{
 		secureKeys: []string{"secure-key"},
 		upl:        upl,
 		db:         dbDriver,
+		similar:    newSimilarityIndex(),
 	}
 	return api, recipeDriver, uplDriver
 }
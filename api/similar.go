@@ -0,0 +1,222 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/models"
+	"github.com/chadweimer/gomp/plaintext"
+)
+
+const defaultSimilarRecipeCount = 10
+
+// How much each kind of term contributes to the similarity of recipes, relative to an ingredient
+const (
+	similarityNameWeight = 2.0
+	similarityTagWeight  = 3.0
+)
+
+// Words that are too common in recipes to say anything about how similar they are
+var similarityStopWords = map[string]bool{
+	"and": true, "the": true, "for": true, "with": true, "into": true, "from": true, "about": true,
+	"cup": true, "tbsp": true, "tsp": true, "tablespoon": true, "teaspoon": true, "pound": true, "ounce": true,
+	"pinch": true, "dash": true, "package": true, "large": true, "medium": true, "small": true,
+	"chopped": true, "diced": true, "minced": true, "sliced": true, "fresh": true, "taste": true, "optional": true,
+}
+
+func (h apiHandler) GetSimilarRecipes(ctx context.Context, request GetSimilarRecipesRequestObject) (GetSimilarRecipesResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	count := int64(defaultSimilarRecipeCount)
+	if request.Params.Count != nil {
+		count = *request.Params.Count
+	}
+	if count < 1 {
+		logger.ErrorContext(ctx, "invalid count", "count", count)
+		return GetSimilarRecipes400Response{}, nil
+	}
+
+	documents, err := h.similar.getDocuments(ctx, h.db)
+	if err != nil {
+		logger.Error("Failed to build recipe similarity index", "error", err)
+		return nil, err
+	}
+
+	targetIndex := slices.IndexFunc(documents, func(doc similarityDocument) bool {
+		return *doc.recipe.ID == request.RecipeID
+	})
+	if targetIndex < 0 {
+		return GetSimilarRecipes404Response{}, nil
+	}
+	target := documents[targetIndex]
+
+	similar := make([]SimilarRecipe, 0)
+	for i, doc := range documents {
+		if i == targetIndex {
+			continue
+		}
+		if score := target.similarity(doc); score > 0 {
+			similar = append(similar, SimilarRecipe{Recipe: doc.recipe, Score: score})
+		}
+	}
+	slices.SortStableFunc(similar, func(a, b SimilarRecipe) int {
+		return cmp.Or(
+			cmp.Compare(b.Score, a.Score),
+			strings.Compare(a.Recipe.Name, b.Recipe.Name))
+	})
+
+	if int64(len(similar)) > count {
+		similar = similar[:count]
+	}
+
+	return GetSimilarRecipes200JSONResponse(similar), nil
+}
+
+// similarityIndex caches the term weights used to compare recipes,
+// so that they only need to be recomputed when the recipes change.
+type similarityIndex struct {
+	mu         sync.Mutex
+	total      int64
+	modifiedAt time.Time
+	tags       map[string]int
+	documents  []similarityDocument
+}
+
+func newSimilarityIndex() *similarityIndex {
+	return &similarityIndex{}
+}
+
+// getDocuments returns the similarity documents for all recipes, rebuilding them
+// if any recipes or tags have been added, removed, or modified since they were last built.
+func (idx *similarityIndex) getDocuments(ctx context.Context, driver db.Driver) ([]similarityDocument, error) {
+	// The total and the most recently modified recipe are enough to detect when recipes have changed
+	filter := models.SearchFilter{TagMatch: models.Any, SortBy: models.SortByModified, SortDir: models.Desc}
+	latest, total, err := driver.Recipes().Find(ctx, &filter, false, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	var modifiedAt time.Time
+	if len(*latest) > 0 && (*latest)[0].ModifiedAt != nil {
+		modifiedAt = *(*latest)[0].ModifiedAt
+	}
+
+	// Renaming, merging, and deleting tags doesn't modify the recipes, but does change the tags in use
+	tags, err := driver.Tags().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.documents != nil && idx.total == total && idx.modifiedAt.Equal(modifiedAt) && maps.Equal(idx.tags, *tags) {
+		return idx.documents, nil
+	}
+
+	all, err := driver.Recipes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.documents = buildSimilarityDocuments(*all)
+	idx.total = total
+	idx.modifiedAt = modifiedAt
+	idx.tags = *tags
+	return idx.documents, nil
+}
+
+// similarityDocument is a recipe along with the TF-IDF weights of its terms, normalized to unit length
+type similarityDocument struct {
+	recipe  models.RecipeCompact
+	weights map[string]float64
+}
+
+// similarity returns the cosine similarity of the documents
+func (d similarityDocument) similarity(other similarityDocument) float32 {
+	small, large := d.weights, other.weights
+	if len(small) > len(large) {
+		small, large = large, small
+	}
+
+	score := 0.0
+	for term, weight := range small {
+		score += weight * large[term]
+	}
+	return float32(min(score, 1))
+}
+
+func buildSimilarityDocuments(recipes []models.Recipe) []similarityDocument {
+	termFrequencies := make([]map[string]float64, 0, len(recipes))
+	documentFrequencies := make(map[string]int)
+	for _, recipe := range recipes {
+		terms := getSimilarityTerms(recipe)
+		termFrequencies = append(termFrequencies, terms)
+		for term := range terms {
+			documentFrequencies[term]++
+		}
+	}
+
+	numDocuments := float64(len(recipes))
+	documents := make([]similarityDocument, 0, len(recipes))
+	for i, recipe := range recipes {
+		weights := make(map[string]float64, len(termFrequencies[i]))
+		norm := 0.0
+		for term, frequency := range termFrequencies[i] {
+			weight := frequency * math.Log(1+numDocuments/float64(documentFrequencies[term]))
+			weights[term] = weight
+			norm += weight * weight
+		}
+		norm = math.Sqrt(norm)
+		for term := range weights {
+			weights[term] /= norm
+		}
+
+		documents = append(documents, similarityDocument{
+			recipe: models.RecipeCompact{
+				ID:            recipe.ID,
+				Name:          recipe.Name,
+				State:         recipe.State,
+				CreatedAt:     recipe.CreatedAt,
+				ModifiedAt:    recipe.ModifiedAt,
+				Rating:        recipe.Rating,
+				MainImageName: recipe.MainImageName,
+			},
+			weights: weights,
+		})
+	}
+
+	return documents
+}
+
+// getSimilarityTerms returns the weighted frequency of each term in the name, ingredients, and tags of the recipe.
+// Terms are prefixed with where they came from, so that, e.g., a tag only matches other tags.
+func getSimilarityTerms(recipe models.Recipe) map[string]float64 {
+	terms := make(map[string]float64)
+	for _, word := range getSimilarityWords(recipe.Name) {
+		terms["name:"+word] += similarityNameWeight
+	}
+	for _, word := range getSimilarityWords(recipe.Ingredients) {
+		terms["ingredient:"+word]++
+	}
+	for _, tag := range recipe.Tags {
+		terms["tag:"+strings.ToLower(strings.TrimSpace(tag))] += similarityTagWeight
+	}
+	return terms
+}
+
+// getSimilarityWords returns the words of the text that are meaningful for comparing recipes,
+// ignoring any markup, e.g., of ingredients saved by the editor
+func getSimilarityWords(text string) []string {
+	return slices.DeleteFunc(plaintext.Words(plaintext.Plain(text)), func(word string) bool {
+		return len(word) < 3 || similarityStopWords[word] || strings.ContainsFunc(word, unicode.IsDigit)
+	})
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	dbmock "github.com/chadweimer/gomp/mocks/db"
+	"github.com/chadweimer/gomp/models"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_GetSimilarRecipes(t *testing.T) {
+	type testArgs struct {
+		name          string
+		recipeID      int64
+		count         *int64
+		expectedNames []string
+		expectedError error
+		listError     error
+		badRequest    bool
+	}
+
+	lemonChicken := recipeFixtureLemonGarlicChicken()
+	lemonChicken.ID = new(int64(1))
+	herbChicken := &models.Recipe{
+		ID:          new(int64(2)),
+		Name:        "Lemon Herb Chicken",
+		Ingredients: "4 chicken thighs\n1 lemon\n2 tbsp olive oil\n1 tbsp thyme",
+		Tags:        []string{"chicken", "weeknight"},
+	}
+	sausage := recipeFixtureSheetPanSausage()
+	sausage.ID = new(int64(3))
+	wraps := recipeFixtureChickpeaSaladWraps()
+	wraps.ID = new(int64(4))
+	recipes := []models.Recipe{*lemonChicken, *herbChicken, *sausage, *wraps}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name:          "Ranked by similarity",
+			recipeID:      1,
+			expectedNames: []string{"Lemon Herb Chicken", "Sheet Pan Sausage and Peppers"},
+		},
+		{
+			name:          "Limited to count",
+			recipeID:      1,
+			count:         new(int64(1)),
+			expectedNames: []string{"Lemon Herb Chicken"},
+		},
+		{
+			name:          "Nothing in common",
+			recipeID:      4,
+			expectedNames: []string{},
+		},
+		{
+			name:     "Recipe not found",
+			recipeID: 5,
+		},
+		{
+			name:       "Invalid count",
+			recipeID:   1,
+			count:      new(int64(-1)),
+			badRequest: true,
+		},
+		{
+			name:          "Error listing recipes",
+			recipeID:      1,
+			listError:     sql.ErrConnDone,
+			expectedError: sql.ErrConnDone,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			api, recipesDriver, tagsDriver := getMockSimilarRecipesAPI(ctrl)
+
+			if !test.badRequest {
+				recipesDriver.EXPECT().
+					Find(t.Context(), gomock.Any(), false, int64(1), int64(1)).
+					Return(&[]models.RecipeCompact{{ModifiedAt: new(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))}}, int64(len(recipes)), nil)
+				tagsDriver.EXPECT().List(t.Context()).Return(&map[string]int{"chicken": 2}, nil)
+				if test.listError != nil {
+					recipesDriver.EXPECT().List(t.Context()).Return(nil, test.listError)
+				} else {
+					recipesDriver.EXPECT().List(t.Context()).Return(&recipes, nil)
+				}
+			}
+
+			// Act
+			resp, err := api.GetSimilarRecipes(t.Context(), GetSimilarRecipesRequestObject{
+				RecipeID: test.recipeID,
+				Params:   GetSimilarRecipesParams{Count: test.count},
+			})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if test.expectedError != nil {
+				return
+			}
+			if test.badRequest {
+				if _, ok := resp.(GetSimilarRecipes400Response); !ok {
+					t.Errorf("expected GetSimilarRecipes400Response, got %T", resp)
+				}
+				return
+			}
+			if test.expectedNames == nil {
+				if _, ok := resp.(GetSimilarRecipes404Response); !ok {
+					t.Errorf("expected GetSimilarRecipes404Response, got %T", resp)
+				}
+				return
+			}
+			got, ok := resp.(GetSimilarRecipes200JSONResponse)
+			if !ok {
+				t.Fatalf("expected GetSimilarRecipes200JSONResponse, got %T", resp)
+			}
+			names := make([]string, 0, len(got))
+			for i, similar := range got {
+				names = append(names, similar.Recipe.Name)
+				if similar.Score <= 0 || similar.Score > 1 {
+					t.Errorf("score out of range: %f", similar.Score)
+				}
+				if i > 0 && similar.Score > got[i-1].Score {
+					t.Errorf("scores not in descending order: %f > %f", similar.Score, got[i-1].Score)
+				}
+			}
+			if len(names) != len(test.expectedNames) {
+				t.Fatalf("expected recipes: %v, got: %v", test.expectedNames, names)
+			}
+			for i := range names {
+				if names[i] != test.expectedNames[i] {
+					t.Errorf("expected recipes: %v, got: %v", test.expectedNames, names)
+					break
+				}
+			}
+		})
+	}
+}
+
+func Test_getSimilarityWords(t *testing.T) {
+	// Arrange
+	plain := "1 can chickpeas\nsalt & pepper"
+	html := "<ul><li>1 can <b>chickpeas</b></li><li>salt &amp; pepper&nbsp;</li></ul>"
+
+	// Act
+	plainWords := getSimilarityWords(plain)
+	htmlWords := getSimilarityWords(html)
+
+	// Assert
+	if expected := []string{"can", "chickpea", "salt", "pepper"}; !reflect.DeepEqual(plainWords, expected) {
+		t.Errorf("expected %v, received %v", expected, plainWords)
+	}
+	if !reflect.DeepEqual(htmlWords, plainWords) {
+		t.Errorf("expected the same words as plain text %v, received %v", plainWords, htmlWords)
+	}
+}
+
+func Test_GetSimilarRecipes_Cached(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	api, recipesDriver, tagsDriver := getMockSimilarRecipesAPI(ctrl)
+
+	modifiedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	recipes := []models.Recipe{
+		{ID: new(int64(1)), Name: "Chicken Soup", Tags: []string{"soup"}},
+		{ID: new(int64(2)), Name: "Chicken Stew", Tags: []string{"stew"}},
+	}
+	gomock.InOrder(
+		recipesDriver.EXPECT().
+			Find(t.Context(), gomock.Any(), false, int64(1), int64(1)).
+			Times(3).
+			Return(&[]models.RecipeCompact{{ModifiedAt: &modifiedAt}}, int64(2), nil),
+		recipesDriver.EXPECT().
+			Find(t.Context(), gomock.Any(), false, int64(1), int64(1)).
+			Return(&[]models.RecipeCompact{{ModifiedAt: new(modifiedAt.Add(time.Second))}}, int64(2), nil),
+	)
+	gomock.InOrder(
+		tagsDriver.EXPECT().List(t.Context()).Times(2).Return(&map[string]int{"soup": 1, "stew": 1}, nil),
+		tagsDriver.EXPECT().List(t.Context()).Times(2).Return(&map[string]int{"soup": 1, "stews": 1}, nil),
+	)
+	// Only rebuilt when the most recently modified recipe or the tags change
+	recipesDriver.EXPECT().List(t.Context()).Times(3).Return(&recipes, nil)
+
+	for range 4 {
+		// Act
+		resp, err := api.GetSimilarRecipes(t.Context(), GetSimilarRecipesRequestObject{RecipeID: 1})
+
+		// Assert
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got, ok := resp.(GetSimilarRecipes200JSONResponse); !ok || len(got) != 1 {
+			t.Errorf("expected a single similar recipe, got %v", resp)
+		}
+	}
+}
+
+func getMockSimilarRecipesAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockRecipeDriver, *dbmock.MockTagDriver) {
+	dbDriver := dbmock.NewMockDriver(ctrl)
+	recipeDriver := dbmock.NewMockRecipeDriver(ctrl)
+	dbDriver.EXPECT().Recipes().AnyTimes().Return(recipeDriver)
+	tagDriver := dbmock.NewMockTagDriver(ctrl)
+	dbDriver.EXPECT().Tags().AnyTimes().Return(tagDriver)
+
+	api := apiHandler{
+		secureKeys: []string{"secure-key"},
+		db:         dbDriver,
+		similar:    newSimilarityIndex(),
+	}
+	return api, recipeDriver, tagDriver
+}
@@ -1,6 +1,14 @@
 package api
 
-import "context"
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/models"
+)
 
 func (h apiHandler) GetAllTags(ctx context.Context, _ GetAllTagsRequestObject) (GetAllTagsResponseObject, error) {
 	tags, err := h.db.Tags().List(ctx)
@@ -10,3 +18,111 @@ func (h apiHandler) GetAllTags(ctx context.Context, _ GetAllTagsRequestObject) (
 
 	return GetAllTags200JSONResponse(*tags), nil
 }
+
+func (h apiHandler) GetTagTree(ctx context.Context, _ GetTagTreeRequestObject) (GetTagTreeResponseObject, error) {
+	tags, err := h.db.Tags().Tree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetTagTree200JSONResponse(*tags), nil
+}
+
+func (h apiHandler) SaveTagInfo(ctx context.Context, request SaveTagInfoRequestObject) (SaveTagInfoResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	tag := strings.TrimSpace(request.Tag)
+	if tag == "" {
+		logger.WarnContext(ctx, "tag is required")
+		return SaveTagInfo400Response{}, nil
+	}
+
+	info := models.TagInfo{
+		ParentTag:   trimSpace(request.Body.ParentTag),
+		Description: trimSpace(request.Body.Description),
+		Color:       trimSpace(request.Body.Color),
+		Icon:        trimSpace(request.Body.Icon),
+	}
+	if err := h.db.Tags().SaveInfo(ctx, tag, &info); err != nil {
+		if errors.Is(err, db.ErrTagCycle) {
+			logger.WarnContext(ctx, "tag cannot be nested under itself", "tag", tag)
+			return SaveTagInfo400Response{}, nil
+		}
+		logger.ErrorContext(ctx, "Failed to save tag info",
+			"error", err,
+			"tag", tag)
+		return nil, err
+	}
+
+	return SaveTagInfo204Response{}, nil
+}
+
+func (h apiHandler) RenameTag(ctx context.Context, request RenameTagRequestObject) (RenameTagResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	newTag := strings.TrimSpace(request.Body.Name)
+	if newTag == "" {
+		logger.WarnContext(ctx, "tag name is required", "tag", request.Tag)
+		return RenameTag400Response{}, nil
+	}
+
+	if err := h.db.Tags().Rename(ctx, request.Tag, newTag); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return RenameTag404Response{}, nil
+		}
+		logger.ErrorContext(ctx, "Failed to rename tag",
+			"error", err,
+			"tag", request.Tag,
+			"new-tag", newTag)
+		return nil, err
+	}
+
+	return RenameTag204Response{}, nil
+}
+
+func (h apiHandler) MergeTags(ctx context.Context, request MergeTagsRequestObject) (MergeTagsResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	intoTag := strings.TrimSpace(request.Body.Into)
+	if intoTag == "" || len(request.Body.Tags) == 0 {
+		logger.WarnContext(ctx, "tags to merge and tag to merge into are required")
+		return MergeTags400Response{}, nil
+	}
+
+	if err := h.db.Tags().Merge(ctx, request.Body.Tags, intoTag); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return MergeTags404Response{}, nil
+		}
+		logger.ErrorContext(ctx, "Failed to merge tags",
+			"error", err,
+			"tags", request.Body.Tags,
+			"into-tag", intoTag)
+		return nil, err
+	}
+
+	return MergeTags204Response{}, nil
+}
+
+func (h apiHandler) DeleteTag(ctx context.Context, request DeleteTagRequestObject) (DeleteTagResponseObject, error) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	if err := h.db.Tags().Delete(ctx, request.Tag); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return DeleteTag404Response{}, nil
+		}
+		logger.ErrorContext(ctx, "Failed to delete tag",
+			"error", err,
+			"tag", request.Tag)
+		return nil, err
+	}
+
+	return DeleteTag204Response{}, nil
+}
+
+func trimSpace(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	return &trimmed
+}
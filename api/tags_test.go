@@ -1,6 +1,7 @@
 package api
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
@@ -59,6 +60,200 @@ func Test_GetAllTags(t *testing.T) {
 	}
 }
 
+func Test_GetTagTree(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api, tagDriver := getMockTagsAPI(ctrl)
+	tree := []models.TagNode{
+		{
+			Tag:        "cuisine",
+			TotalCount: 2,
+			Children:   []models.TagNode{{Tag: "italian", Count: 2, TotalCount: 2, Children: []models.TagNode{}}},
+		},
+	}
+	tagDriver.EXPECT().Tree(t.Context()).Return(&tree, nil)
+
+	// Act
+	resp, err := api.GetTagTree(t.Context(), GetTagTreeRequestObject{})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(resp, GetTagTree200JSONResponse(tree)) {
+		t.Errorf("got = %v, want %v", resp, tree)
+	}
+}
+
+func Test_SaveTagInfo(t *testing.T) {
+	type testArgs struct {
+		name             string
+		tag              string
+		parentTag        *string
+		expectedParent   *string
+		dbError          error
+		expectedError    error
+		expectedResponse SaveTagInfoResponseObject
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", "italian", new(" cuisine "), new("cuisine"), nil, nil, SaveTagInfo204Response{}},
+		{"Without parent", "italian", nil, nil, nil, nil, SaveTagInfo204Response{}},
+		{"Empty tag", " ", nil, nil, nil, nil, SaveTagInfo400Response{}},
+		{"Nested under itself", "cuisine", new("italian"), new("italian"), db.ErrTagCycle, nil, SaveTagInfo400Response{}},
+		{"Database error", "italian", nil, nil, sql.ErrConnDone, sql.ErrConnDone, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, tagDriver := getMockTagsAPI(ctrl)
+			if test.expectedResponse != (SaveTagInfo400Response{}) || test.dbError != nil {
+				expectedInfo := &models.TagInfo{ParentTag: test.expectedParent, Description: new("Dishes")}
+				tagDriver.EXPECT().SaveInfo(t.Context(), test.tag, expectedInfo).Return(test.dbError)
+			}
+
+			// Act
+			resp, err := api.SaveTagInfo(t.Context(), SaveTagInfoRequestObject{
+				Tag:  test.tag,
+				Body: &SaveTagInfoJSONRequestBody{ParentTag: test.parentTag, Description: new("Dishes ")},
+			})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if resp != test.expectedResponse {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
+
+func Test_RenameTag(t *testing.T) {
+	type testArgs struct {
+		name             string
+		tag              string
+		newName          string
+		expectedNewTag   string
+		dbError          error
+		expectedError    error
+		expectedResponse RenameTagResponseObject
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", "Chicken", " chicken ", "chicken", nil, nil, RenameTag204Response{}},
+		{"Empty name", "Chicken", "  ", "", nil, nil, RenameTag400Response{}},
+		{"Not found", "Chicken", "chicken", "chicken", db.ErrNotFound, nil, RenameTag404Response{}},
+		{"Database error", "Chicken", "chicken", "chicken", sql.ErrConnDone, sql.ErrConnDone, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, tagDriver := getMockTagsAPI(ctrl)
+			if test.expectedNewTag != "" {
+				tagDriver.EXPECT().Rename(t.Context(), test.tag, test.expectedNewTag).Return(test.dbError)
+			}
+
+			// Act
+			resp, err := api.RenameTag(t.Context(), RenameTagRequestObject{Tag: test.tag, Body: &RenameTagJSONRequestBody{Name: test.newName}})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if resp != test.expectedResponse {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
+
+func Test_MergeTags(t *testing.T) {
+	type testArgs struct {
+		name             string
+		tags             []string
+		into             string
+		dbError          error
+		expectedError    error
+		expectedResponse MergeTagsResponseObject
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", []string{"Chicken", "chickn"}, "chicken", nil, nil, MergeTags204Response{}},
+		{"No tags", []string{}, "chicken", nil, nil, MergeTags400Response{}},
+		{"Empty into", []string{"Chicken"}, "", nil, nil, MergeTags400Response{}},
+		{"Not found", []string{"Chicken"}, "chicken", db.ErrNotFound, nil, MergeTags404Response{}},
+		{"Database error", []string{"Chicken"}, "chicken", sql.ErrConnDone, sql.ErrConnDone, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, tagDriver := getMockTagsAPI(ctrl)
+			if test.into != "" && len(test.tags) > 0 {
+				tagDriver.EXPECT().Merge(t.Context(), test.tags, test.into).Return(test.dbError)
+			}
+
+			// Act
+			resp, err := api.MergeTags(t.Context(), MergeTagsRequestObject{Body: &MergeTagsJSONRequestBody{Tags: test.tags, Into: test.into}})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if resp != test.expectedResponse {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
+
+func Test_DeleteTag(t *testing.T) {
+	type testArgs struct {
+		name             string
+		dbError          error
+		expectedError    error
+		expectedResponse DeleteTagResponseObject
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", nil, nil, DeleteTag204Response{}},
+		{"Not found", db.ErrNotFound, nil, DeleteTag404Response{}},
+		{"Database error", sql.ErrConnDone, sql.ErrConnDone, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, tagDriver := getMockTagsAPI(ctrl)
+			tagDriver.EXPECT().Delete(t.Context(), "chickn").Return(test.dbError)
+
+			// Act
+			resp, err := api.DeleteTag(t.Context(), DeleteTagRequestObject{Tag: "chickn"})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if resp != test.expectedResponse {
+				t.Errorf("expected response: %v, received response: %v", test.expectedResponse, resp)
+			}
+		})
+	}
+}
+
 func getMockTagsAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockTagDriver) {
 	dbDriver := dbmock.NewMockDriver(ctrl)
 	tagDriver := dbmock.NewMockTagDriver(ctrl)
@@ -70,7 +265,7 @@ func getMockTagsAPI(ctrl *gomock.Controller) (apiHandler, *dbmock.MockTagDriver)
 		ThumbnailQuality: models.ImageQualityMedium,
 		ThumbnailSize:    500,
 	}
-	upl, _ := fileaccess.CreateImageUploader(uplDriver, imgCfg)
+	upl, _ := fileaccess.CreateImageUploader(uplDriver, fileaccessmock.NewMockImageReferences(ctrl), imgCfg)
 
 	api := apiHandler{
 		secureKeys: []string{"secure-key"},
@@ -3,12 +3,20 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"path/filepath"
+	"slices"
 
 	"github.com/chadweimer/gomp/fileaccess"
-	"github.com/google/uuid"
+	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/jobs"
+	"github.com/chadweimer/gomp/models"
+	"github.com/samber/lo"
 )
 
 func (h apiHandler) Upload(_ context.Context, request UploadRequestObject) (UploadResponseObject, error) {
@@ -29,6 +37,226 @@ func (h apiHandler) Upload(_ context.Context, request UploadRequestObject) (Uplo
 	}, nil
 }
 
+func (h apiHandler) CheckUploads(ctx context.Context, request CheckUploadsRequestObject) (CheckUploadsResponseObject, error) {
+	payload := uploadCheckJobPayload{Repair: request.Params.Repair != nil && *request.Params.Repair}
+	job, err := h.enqueueJob(ctx, models.JobCheckUploads, payload, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return CheckUploads202JSONResponse{
+		Body: *job,
+		Headers: CheckUploads202ResponseHeaders{
+			Location: getJobLocation(job),
+		},
+	}, nil
+}
+
+// runCheckUploads checks the uploaded images of all recipes against the database, and optionally repairs
+// the problems that are found, as the work of a job. The result is a JSON encoded report of the problems.
+func (h apiHandler) runCheckUploads(ctx context.Context, task *jobs.Task) (string, error) {
+	var payload uploadCheckJobPayload
+	if err := task.Decode(&payload); err != nil {
+		return "", err
+	}
+
+	// List the uploads first, so that the images of a recipe created in the meantime aren't seen as left behind
+	uploadedRecipeIDs, err := h.upl.ListRecipeIDs()
+	if err != nil {
+		return "", err
+	}
+	recipes, err := h.db.Recipes().List(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list recipes: %w", err)
+	}
+
+	// Deleting a recipe doesn't delete its images, so they may be left behind
+	recipeIDs := lo.Map(*recipes, func(recipe models.Recipe, _ int) int64 { return *recipe.ID })
+	orphanedRecipeIDs := lo.Without(uploadedRecipeIDs, recipeIDs...)
+
+	report := models.UploadCheckReport{
+		Repair:             payload.Repair,
+		OrphanedRecipes:    make([]models.UploadCheckIssue, 0),
+		OrphanedContent:    make([]models.UploadCheckContentIssue, 0),
+		StaleReferences:    make([]models.UploadCheckIssue, 0),
+		MissingContent:     make([]models.UploadCheckIssue, 0),
+		MissingImages:      make([]models.UploadCheckIssue, 0),
+		MissingThumbnails:  make([]models.UploadCheckIssue, 0),
+		DanglingMainImages: make([]models.UploadCheckIssue, 0),
+	}
+	// Checking the stored content counts as one more step
+	total := len(orphanedRecipeIDs) + 1 + len(*recipes)
+	checked := 0
+
+	for _, recipeID := range orphanedRecipeIDs {
+		issue := models.UploadCheckIssue{RecipeID: recipeID}
+		if payload.Repair {
+			err := h.upl.DeleteAll(ctx, recipeID)
+			if err := recordRepairError(ctx, &issue.RepairError, err, "recipe-id", recipeID); err != nil {
+				return "", err
+			}
+		}
+		report.OrphanedRecipes = append(report.OrphanedRecipes, issue)
+
+		checked++
+		task.SetProgress(checked * 100 / total)
+	}
+
+	// Check the content after deleting the images of the orphaned recipes, which may leave content unused
+	contentResult, err := h.upl.CheckContent(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range contentResult.StaleReferences {
+		issue := models.UploadCheckIssue{RecipeID: ref.RecipeID, Name: new(ref.Name)}
+		if payload.Repair {
+			err := h.upl.RepairReference(ctx, ref.RecipeID, ref.Name)
+			if err := recordRepairError(ctx, &issue.RepairError, err, "recipe-id", ref.RecipeID, "name", ref.Name); err != nil {
+				return "", err
+			}
+		}
+		report.StaleReferences = append(report.StaleReferences, issue)
+	}
+	for _, ref := range contentResult.MissingContent {
+		// Any image details, notes and steps that use the image are repaired along with the rest of the recipe
+		issue := models.UploadCheckIssue{RecipeID: ref.RecipeID, Name: new(ref.Name)}
+		if payload.Repair {
+			err := h.upl.RepairReference(ctx, ref.RecipeID, ref.Name)
+			if err := recordRepairError(ctx, &issue.RepairError, err, "recipe-id", ref.RecipeID, "name", ref.Name); err != nil {
+				return "", err
+			}
+		}
+		report.MissingContent = append(report.MissingContent, issue)
+	}
+	for _, name := range contentResult.OrphanedContent {
+		issue := models.UploadCheckContentIssue{Name: name}
+		if payload.Repair {
+			err := h.upl.DeleteContent(ctx, name)
+			if err := recordRepairError(ctx, &issue.RepairError, err, "name", name); err != nil {
+				return "", err
+			}
+		}
+		report.OrphanedContent = append(report.OrphanedContent, issue)
+	}
+	checked++
+	task.SetProgress(checked * 100 / total)
+
+	// The thumbnails of images without content are reported as missing content instead
+	missingContent := lo.SliceToMap(contentResult.MissingContent, func(ref fileaccess.ContentReference) (fileaccess.ContentReference, bool) {
+		return ref, true
+	})
+
+	for _, recipe := range *recipes {
+		names, err := h.upl.List(*recipe.ID)
+		if err != nil {
+			return "", err
+		}
+
+		for _, name := range names {
+			if missingContent[fileaccess.ContentReference{RecipeID: *recipe.ID, Name: name}] {
+				continue
+			}
+
+			hasThumbnail, err := h.upl.HasThumbnail(*recipe.ID, name)
+			if err != nil {
+				return "", err
+			}
+			if hasThumbnail {
+				continue
+			}
+
+			issue := models.UploadCheckIssue{RecipeID: *recipe.ID, Name: new(name)}
+			if payload.Repair {
+				err := h.upl.RegenerateThumbnail(ctx, *recipe.ID, name)
+				if err := recordRepairError(ctx, &issue.RepairError, err, "recipe-id", *recipe.ID, "name", name); err != nil {
+					return "", err
+				}
+			}
+			report.MissingThumbnails = append(report.MissingThumbnails, issue)
+		}
+
+		usedNames, err := h.listUsedImageNames(ctx, recipe)
+		if err != nil {
+			return "", err
+		}
+		for _, name := range lo.Without(usedNames, names...) {
+			issue := models.UploadCheckIssue{RecipeID: *recipe.ID, Name: new(name)}
+			if payload.Repair {
+				// Which also removes the image from the notes and steps
+				err := h.db.Images().Delete(ctx, *recipe.ID, name)
+				if err := recordRepairError(ctx, &issue.RepairError, err, "recipe-id", *recipe.ID, "name", name); err != nil {
+					return "", err
+				}
+			}
+			report.MissingImages = append(report.MissingImages, issue)
+		}
+
+		if recipe.MainImageName != "" && !slices.Contains(names, recipe.MainImageName) {
+			issue := models.UploadCheckIssue{RecipeID: *recipe.ID, Name: new(recipe.MainImageName)}
+			if payload.Repair {
+				err := h.setMainImageIfNecessary(ctx, *recipe.ID, &recipe.MainImageName)
+				if err := recordRepairError(ctx, &issue.RepairError, err, "recipe-id", *recipe.ID); err != nil {
+					return "", err
+				}
+			}
+			report.DanglingMainImages = append(report.DanglingMainImages, issue)
+		}
+
+		checked++
+		task.SetProgress(checked * 100 / total)
+	}
+
+	result, err := json.Marshal(report)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode report: %w", err)
+	}
+	return string(result), nil
+}
+
+// listUsedImageNames returns the names of the images used by the recipe's image details, notes and steps
+func (h apiHandler) listUsedImageNames(ctx context.Context, recipe models.Recipe) ([]string, error) {
+	images, err := h.db.Images().List(ctx, *recipe.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images of recipe %d: %w", *recipe.ID, err)
+	}
+	notes, err := h.db.Notes().List(ctx, *recipe.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes of recipe %d: %w", *recipe.ID, err)
+	}
+
+	names := lo.Map(*images, func(image models.RecipeImage, _ int) string { return image.Name })
+	for _, note := range *notes {
+		if note.ImageName != nil && *note.ImageName != "" {
+			names = append(names, *note.ImageName)
+		}
+	}
+	if recipe.Steps != nil {
+		for _, step := range *recipe.Steps {
+			if step.ImageName != nil && *step.ImageName != "" {
+				names = append(names, *step.ImageName)
+			}
+		}
+	}
+	return lo.Uniq(names), nil
+}
+
+// recordRepairError records why the problem couldn't be repaired, if the repair failed, along with any
+// attributes that identify the problem in the log.
+// The returned error is only set if the job should stop, i.e., because it was interrupted.
+func recordRepairError(ctx context.Context, repairError **string, err error, attrs ...any) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	infra.GetLoggerFromContext(ctx).WarnContext(ctx, "Failed to repair upload. Skipping...",
+		append([]any{"error", err}, attrs...)...)
+	*repairError = new(err.Error())
+	return nil
+}
+
 func readFile(reader *multipart.Reader) ([]byte, string, error) {
 	if reader == nil {
 		return nil, "", io.EOF
@@ -46,8 +274,8 @@ func readFile(reader *multipart.Reader) ([]byte, string, error) {
 		return nil, "", err
 	}
 
-	// Generate a unique name for the image
-	imageExt := filepath.Ext(fileName)
-	imageName := uuid.New().String() + imageExt
+	// Name the file by its content, so that uploading the same file again doesn't store it twice
+	sum := sha256.Sum256(uploadedFileData)
+	imageName := hex.EncodeToString(sum[:]) + filepath.Ext(fileName)
 	return uploadedFileData, imageName, nil
 }
@@ -2,17 +2,23 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
+	"io"
+	"io/fs"
 	"mime/multipart"
+	"reflect"
 	"testing"
 
 	"github.com/chadweimer/gomp/fileaccess"
+	"github.com/chadweimer/gomp/jobs"
 	dbmock "github.com/chadweimer/gomp/mocks/db"
 	fileaccessmock "github.com/chadweimer/gomp/mocks/fileaccess"
 	"github.com/chadweimer/gomp/models"
+	"github.com/samber/lo"
 	"go.uber.org/mock/gomock"
 )
 
@@ -59,6 +65,186 @@ func Test_Upload(t *testing.T) {
 	}
 }
 
+func Test_CheckUploads(t *testing.T) {
+	type testArgs struct {
+		name            string
+		repair          *bool
+		expectedPayload string
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Default", nil, `{"repair":false}`},
+		{"Check Only", new(false), `{"repair":false}`},
+		{"Repair", new(true), `{"repair":true}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, _ := getMockUploadsAPI(ctrl)
+			queue, jobDriver := getMockJobQueue(t, ctrl)
+			api.jobs = queue
+			expectJobQueued(jobDriver, models.JobCheckUploads, gomock.Eq(test.expectedPayload), nil)
+
+			// Act
+			resp, err := api.CheckUploads(t.Context(), CheckUploadsRequestObject{Params: CheckUploadsParams{Repair: test.repair}})
+
+			// Assert
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if got, ok := resp.(CheckUploads202JSONResponse); !ok {
+				t.Errorf("unexpected response type %T", resp)
+			} else if got.Headers.Location != "/api/v1/jobs/7" || *got.Body.ID != 7 {
+				t.Errorf("unexpected job: %v, %v", got.Headers.Location, got.Body)
+			}
+		})
+	}
+}
+
+func Test_runCheckUploads(t *testing.T) {
+	type testArgs struct {
+		name   string
+		repair bool
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Check Only", false},
+		{"Repair", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			api, recipeDriver, imageDriver, noteDriver, imageRefs, uplDriver := getMockCheckUploadsAPI(t, ctrl)
+			img := getMockJPEG(t)
+			saveMockFiles(t, uplDriver, map[string][]byte{
+				// The first recipe is fine, other than not being recorded as using one of its images
+				"uploads/recipes/1/images/img.jpeg":   img,
+				"uploads/recipes/1/thumbs/img.jpeg":   img,
+				"uploads/recipes/1/refs/ok.jpeg":      nil,
+				"uploads/recipes/1/refs/unrec.jpeg":   nil,
+				"uploads/content/images/ok.jpeg":      img,
+				"uploads/content/thumbs/ok.jpeg":      img,
+				"uploads/content/images/unrec.jpeg":   img,
+				"uploads/content/thumbs/unrec.jpeg":   img,
+				"uploads/content/images/orphan.jpeg":  img,
+				"uploads/recipes/2/images/bad.jpeg":   img,
+				"uploads/recipes/2/refs/missing.jpeg": nil,
+				"uploads/recipes/9/images/old.jpeg":   img,
+				"uploads/content/thumbs/missing.jpeg": img,
+			})
+			recipeDriver.EXPECT().List(gomock.Any()).Return(&[]models.Recipe{
+				{ID: new(int64(1)), MainImageName: "img.jpeg", Steps: &[]models.RecipeStep{{ImageName: new("img.jpeg")}}},
+				// The second is missing the thumbnail and content of its images, its details, notes and steps
+				// use images that don't exist, and its main image doesn't exist
+				{ID: new(int64(2)), MainImageName: "gone.jpeg", Steps: &[]models.RecipeStep{{Text: "Mix"}, {ImageName: new("step.jpeg")}}},
+			}, nil)
+			// And the third no longer exists
+			imageRefs.EXPECT().List(gomock.Any()).AnyTimes().Return(map[string][]int64{"ok.jpeg": {1}, "missing.jpeg": {2}}, nil)
+			imageDriver.EXPECT().List(gomock.Any(), int64(1)).AnyTimes().Return(&[]models.RecipeImage{{Name: "img.jpeg"}, {Name: "ok.jpeg"}}, nil)
+			noteDriver.EXPECT().List(gomock.Any(), int64(1)).Return(&[]models.Note{{ImageName: new("ok.jpeg")}}, nil)
+			imageDriver.EXPECT().List(gomock.Any(), int64(2)).AnyTimes().Return(&[]models.RecipeImage{{Name: "bad.jpeg"}, {Name: "missing.jpeg"}, {Name: "lost.jpeg"}}, nil)
+			noteDriver.EXPECT().List(gomock.Any(), int64(2)).Return(&[]models.Note{{}, {ImageName: new("note.jpeg")}}, nil)
+
+			expectedMissingImages := []string{"lost.jpeg", "note.jpeg", "step.jpeg"}
+			if test.repair {
+				// The missing reference is recorded, and the reference to the missing content is removed
+				imageRefs.EXPECT().Lock(gomock.Any(), gomock.Any()).AnyTimes().Return(func() {}, nil)
+				imageRefs.EXPECT().Add(gomock.Any(), "unrec.jpeg", int64(1)).Return(nil)
+				imageRefs.EXPECT().Remove(gomock.Any(), "missing.jpeg", int64(2)).Return(int64(0), nil)
+
+				// Which leaves the image of the missing content missing as well, and the details of one can't be deleted
+				expectedMissingImages = []string{"missing.jpeg", "lost.jpeg", "note.jpeg", "step.jpeg"}
+				imageDriver.EXPECT().Delete(gomock.Any(), int64(2), "missing.jpeg").Return(nil)
+				imageDriver.EXPECT().Delete(gomock.Any(), int64(2), "lost.jpeg").Return(io.ErrUnexpectedEOF)
+				imageDriver.EXPECT().Delete(gomock.Any(), int64(2), "note.jpeg").Return(nil)
+				imageDriver.EXPECT().Delete(gomock.Any(), int64(2), "step.jpeg").Return(nil)
+
+				// And the main image is set to the image it has
+				recipeDriver.EXPECT().Read(gomock.Any(), int64(2)).Return(&models.Recipe{ID: new(int64(2)), MainImageName: "gone.jpeg"}, nil)
+				recipeDriver.EXPECT().Update(gomock.Any(), gomock.Cond(func(recipe *models.Recipe) bool {
+					return recipe.MainImageName == "bad.jpeg"
+				})).Return(nil)
+			}
+
+			task := &jobs.Task{
+				Job:     models.Job{ID: new(int64(7)), Kind: models.JobCheckUploads},
+				Payload: fmt.Sprintf(`{"repair":%v}`, test.repair),
+			}
+
+			// Act
+			result, err := api.runCheckUploads(t.Context(), task)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var report models.UploadCheckReport
+			if err := json.Unmarshal([]byte(result), &report); err != nil {
+				t.Fatalf("failed to decode report: %v", err)
+			}
+			expected := models.UploadCheckReport{
+				Repair:          test.repair,
+				OrphanedRecipes: []models.UploadCheckIssue{{RecipeID: 9}},
+				OrphanedContent: []models.UploadCheckContentIssue{{Name: "orphan.jpeg"}},
+				StaleReferences: []models.UploadCheckIssue{{RecipeID: 1, Name: new("unrec.jpeg")}},
+				MissingContent:  []models.UploadCheckIssue{{RecipeID: 2, Name: new("missing.jpeg")}},
+				MissingImages: lo.Map(expectedMissingImages, func(name string, _ int) models.UploadCheckIssue {
+					issue := models.UploadCheckIssue{RecipeID: 2, Name: new(name)}
+					if name == "lost.jpeg" && test.repair {
+						issue.RepairError = new(fmt.Sprintf("%v", io.ErrUnexpectedEOF))
+					}
+					return issue
+				}),
+				MissingThumbnails:  []models.UploadCheckIssue{{RecipeID: 2, Name: new("bad.jpeg")}},
+				DanglingMainImages: []models.UploadCheckIssue{{RecipeID: 2, Name: new("gone.jpeg")}},
+			}
+			if !reflect.DeepEqual(report, expected) {
+				t.Errorf("expected report: %+v, received report: %s", expected, result)
+			}
+
+			// Repairing changes what's stored
+			for filePath, expectedExists := range map[string]bool{
+				"uploads/recipes/9":                   !test.repair,
+				"uploads/content/images/orphan.jpeg":  !test.repair,
+				"uploads/recipes/2/refs/missing.jpeg": !test.repair,
+				"uploads/content/thumbs/missing.jpeg": !test.repair,
+				"uploads/recipes/2/thumbs/bad.jpeg":   test.repair,
+				"uploads/recipes/2/images/bad.jpeg":   true,
+				"uploads/recipes/1/refs/unrec.jpeg":   true,
+			} {
+				if _, err := uplDriver.Stat(filePath); (err == nil) != expectedExists {
+					t.Errorf("%s: expected exists: %v, received error: %v", filePath, expectedExists, err)
+				}
+			}
+			if data, _ := fs.ReadFile(uplDriver, "uploads/recipes/2/images/bad.jpeg"); !bytes.Equal(data, img) {
+				t.Error("expected the image to be left as-is")
+			}
+		})
+	}
+}
+
+func Test_runCheckUploads_ListError(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	api, _, _, uplDriver, _ := getMockImagesAPI(ctrl)
+	uplDriver.EXPECT().Open("uploads/recipes").Return(nil, io.ErrUnexpectedEOF)
+
+	// Act
+	_, err := api.runCheckUploads(t.Context(), &jobs.Task{Payload: `{}`})
+
+	// Assert
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected error: %v, received error: %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
 func getMockUploadsAPI(ctrl *gomock.Controller) (apiHandler, *fileaccessmock.MockDriver) {
 	dbDriver := dbmock.NewMockDriver(ctrl)
 	fsDriver := fileaccessmock.NewMockDriver(ctrl)
@@ -68,7 +254,7 @@ func getMockUploadsAPI(ctrl *gomock.Controller) (apiHandler, *fileaccessmock.Moc
 		ThumbnailQuality: models.ImageQualityMedium,
 		ThumbnailSize:    500,
 	}
-	upl, _ := fileaccess.CreateImageUploader(fsDriver, imgCfg)
+	upl, _ := fileaccess.CreateImageUploader(fsDriver, fileaccessmock.NewMockImageReferences(ctrl), imgCfg)
 
 	api := apiHandler{
 		secureKeys: []string{"secure-key"},
@@ -78,3 +264,48 @@ func getMockUploadsAPI(ctrl *gomock.Controller) (apiHandler, *fileaccessmock.Moc
 	}
 	return api, fsDriver
 }
+
+func getMockCheckUploadsAPI(t *testing.T, ctrl *gomock.Controller) (apiHandler, *dbmock.MockRecipeDriver, *dbmock.MockImageDriver, *dbmock.MockNoteDriver, *fileaccessmock.MockImageReferences, fileaccess.Driver) {
+	dbDriver := dbmock.NewMockDriver(ctrl)
+	recipeDriver := dbmock.NewMockRecipeDriver(ctrl)
+	dbDriver.EXPECT().Recipes().AnyTimes().Return(recipeDriver)
+	imageDriver := dbmock.NewMockImageDriver(ctrl)
+	dbDriver.EXPECT().Images().AnyTimes().Return(imageDriver)
+	noteDriver := dbmock.NewMockNoteDriver(ctrl)
+	dbDriver.EXPECT().Notes().AnyTimes().Return(noteDriver)
+	uplDriver, err := fileaccess.CreateDriver(fileaccess.FilesConfig{Driver: fileaccess.FilesDriverFS, Path: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create upload driver: %v", err)
+	}
+	imgCfg := fileaccess.ImageConfig{
+		ImageQuality:     models.ImageQualityOriginal,
+		ImageSize:        2000,
+		ThumbnailQuality: models.ImageQualityMedium,
+		ThumbnailSize:    50,
+	}
+	imageRefs := fileaccessmock.NewMockImageReferences(ctrl)
+	upl, _ := fileaccess.CreateImageUploader(uplDriver, imageRefs, imgCfg)
+
+	api := apiHandler{
+		secureKeys: []string{"secure-key"},
+		upl:        upl,
+		db:         dbDriver,
+	}
+	return api, recipeDriver, imageDriver, noteDriver, imageRefs, uplDriver
+}
+
+func saveMockFiles(t *testing.T, drv fileaccess.Driver, files map[string][]byte) {
+	for filePath, data := range files {
+		if err := drv.Save(filePath, bytes.NewReader(data)); err != nil {
+			t.Fatalf("failed to save %s: %v", filePath, err)
+		}
+	}
+}
+
+func getMockJPEG(t *testing.T) []byte {
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, image.NewRGBA(image.Rect(0, 0, 100, 80)), nil); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	return buf.Bytes()
+}
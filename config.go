@@ -8,6 +8,8 @@ import (
 
 	"github.com/chadweimer/gomp/db"
 	"github.com/chadweimer/gomp/fileaccess"
+	"github.com/chadweimer/gomp/jobs"
+	"github.com/chadweimer/gomp/nutrition"
 	"github.com/samber/lo"
 )
 
@@ -21,6 +23,12 @@ type Config struct {
 	// Database contains the database configuration settings
 	Database db.Config
 
+	// Nutrition contains the nutrition estimate configuration settings
+	Nutrition nutrition.Config
+
+	// Jobs contains the background job configuration settings
+	Jobs jobs.Config
+
 	// Port gets the port number under which the site is being hosted.
 	Port int `env:"PORT" default:"5000"`
 
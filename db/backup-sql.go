@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"regexp"
 	"strings"
@@ -45,6 +46,9 @@ func (b *sqlBackupDriver) Export(ctx context.Context) (*models.BackupData, error
 			if err != nil {
 				return err
 			}
+			if err := encodeBinaryColumns(tableName, rowData); err != nil {
+				return err
+			}
 
 			backup = append(backup, models.TableData{
 				TableName: tableName,
@@ -89,13 +93,20 @@ func (b *sqlBackupDriver) Import(ctx context.Context, backup *models.BackupData)
 			}
 
 			if tableData.TableName != b.migrationsTableName {
+				if err := decodeBinaryColumns(sanitizedTableName, tableData.Data); err != nil {
+					return err
+				}
 				sanitizedBackup[sanitizedTableName] = tableData.Data
 			}
 		}
 
 		// Delete everything first
 		for tableName := range sanitizedBackup {
-			if _, err := db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", tableName)); err != nil {
+			stmt := fmt.Sprintf("DELETE FROM %s", tableName)
+			if exclusion, ok := backupExclusions[tableName]; ok {
+				stmt += fmt.Sprintf(" WHERE NOT (%s)", exclusion)
+			}
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
 				return fmt.Errorf("deleting from table %s: %w", tableName, err)
 			}
 		}
@@ -115,8 +126,25 @@ func (b *sqlBackupDriver) Import(ctx context.Context, backup *models.BackupData)
 	return nil
 }
 
+// backupExclusions are the conditions for the rows of each table that are excluded from backups,
+// and left alone when restoring from one
+var backupExclusions = map[string]string{
+	fileBlobTableName: backupBlobExclusion,
+	jobTableName:      backupJobExclusion,
+}
+
+// backupBinaryColumns are the columns of each table that contain binary data,
+// which is base64 encoded in backups so that it survives being serialized to JSON
+var backupBinaryColumns = map[string][]string{
+	fileBlobTableName: {"content"},
+}
+
 func getRows(ctx context.Context, db sqlx.QueryerContext, tableName string) ([]models.RowData, error) {
-	rows, err := db.QueryxContext(ctx, fmt.Sprintf("SELECT * FROM %s", tableName))
+	stmt := fmt.Sprintf("SELECT * FROM %s", tableName)
+	if exclusion, ok := backupExclusions[tableName]; ok {
+		stmt += fmt.Sprintf(" WHERE NOT (%s)", exclusion)
+	}
+	rows, err := db.QueryxContext(ctx, stmt)
 	if err != nil {
 		return nil, fmt.Errorf("querying %s: %w", tableName, err)
 	}
@@ -137,6 +165,36 @@ func getRows(ctx context.Context, db sqlx.QueryerContext, tableName string) ([]m
 	return data, nil
 }
 
+func encodeBinaryColumns(tableName string, rowData []models.RowData) error {
+	for _, column := range backupBinaryColumns[tableName] {
+		for _, row := range rowData {
+			value, ok := row[column].([]byte)
+			if !ok {
+				return fmt.Errorf("column %s of table %s is not binary", column, tableName)
+			}
+			row[column] = base64.StdEncoding.EncodeToString(value)
+		}
+	}
+	return nil
+}
+
+func decodeBinaryColumns(tableName string, rowData []models.RowData) error {
+	for _, column := range backupBinaryColumns[tableName] {
+		for _, row := range rowData {
+			value, ok := row[column].(string)
+			if !ok {
+				return fmt.Errorf("column %s of table %s is not base64 encoded", column, tableName)
+			}
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return fmt.Errorf("decoding column %s of table %s: %w", column, tableName, err)
+			}
+			row[column] = decoded
+		}
+	}
+	return nil
+}
+
 func insertRows(ctx context.Context, db *sqlx.Tx, tableName string, rowData []models.RowData, insertStmtPrefix string) error {
 	// Check if there is anything to insert
 	if len(rowData) == 0 {
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// dataMigration is a change to the existing data that can't be made by the SQL migrations alone,
+// e.g., because it depends on normalizing text the same way as the application does
+type dataMigration struct {
+	name  string
+	apply func(context.Context, *sqlx.Tx) error
+}
+
+// dataMigrations are applied in order, after the SQL migrations, and each only ever once.
+// Once added, a migration must not be renamed, or it will be applied again.
+var dataMigrations = []dataMigration{
+	{name: "normalize_tag_keys", apply: normalizeTagKeys},
+	{name: "fill_missing_recipe_times", apply: fillMissingTimes},
+	{name: "fill_missing_recipe_steps", apply: fillMissingSteps},
+}
+
+// applyDataMigrations applies each of the migrations that hasn't already been applied.
+// Each migration is recorded in the same transaction it's applied in,
+// so that instances opening the database at the same time don't both apply it.
+func applyDataMigrations(ctx context.Context, db *sqlx.DB, migrations []dataMigration) error {
+	for _, migration := range migrations {
+		err := tx(ctx, db, func(db *sqlx.Tx) error {
+			result, err := db.ExecContext(ctx,
+				"INSERT INTO data_migration (name) VALUES ($1) ON CONFLICT (name) DO NOTHING", migration.name)
+			if err != nil {
+				return fmt.Errorf("recording data migration: %w", err)
+			}
+			recorded, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("recording data migration: %w", err)
+			}
+			if recorded == 0 {
+				return nil
+			}
+
+			slog.Info("Applying data migration", "name", migration.name)
+			return migration.apply(ctx, db)
+		})
+		if err != nil {
+			return fmt.Errorf("applying data migration %s: %w", migration.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_applyDataMigrations(t *testing.T) {
+	type testArgs struct {
+		name          string
+		recorded      int64
+		applyError    error
+		expectApplied bool
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Not yet applied", 1, nil, true, nil},
+		{"Already applied", 0, nil, false, nil},
+		{"Apply error", 1, sql.ErrConnDone, true, sql.ErrConnDone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			dbmock.ExpectExec("INSERT INTO data_migration \\(name\\) VALUES \\(\\$1\\) ON CONFLICT \\(name\\) DO NOTHING").
+				WithArgs("test").WillReturnResult(driver.RowsAffected(test.recorded))
+			if test.expectedError == nil {
+				dbmock.ExpectCommit()
+			} else {
+				dbmock.ExpectRollback()
+			}
+
+			applied := false
+			migrations := []dataMigration{
+				{name: "test", apply: func(context.Context, *sqlx.Tx) error {
+					applied = true
+					return test.applyError
+				}},
+			}
+
+			// Act
+			err := applyDataMigrations(t.Context(), sut.Db, migrations)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if applied != test.expectApplied {
+				t.Errorf("expected applied: %v, received: %v", test.expectApplied, applied)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
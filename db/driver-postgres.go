@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -25,6 +26,10 @@ const PostgresDriverName string = "postgres"
 
 type postgresDriverAdapter struct{}
 
+// imageContentLockClass is the first of the two keys of the advisory locks on content-addressed images,
+// which keeps them apart from the lock taken while migrating
+const imageContentLockClass = 1
+
 func (postgresDriverAdapter) GetSearchFields(filterFields []models.SearchField, query string) (string, []any) {
 	fieldStr := ""
 	fieldArgs := make([]any, 0)
@@ -40,6 +45,33 @@ func (postgresDriverAdapter) GetSearchFields(filterFields []models.SearchField,
 	return fieldStr, fieldArgs
 }
 
+func (postgresDriverAdapter) GetSearchRank(filterFields []models.SearchField, query string) (string, []any) {
+	rankStr := ""
+	rankArgs := make([]any, 0)
+
+	for _, field := range lo.Intersect(filterFields, supportedSearchFields[:]) {
+		if rankStr != "" {
+			rankStr += " + "
+		}
+		rankStr += fmt.Sprintf("ts_rank(to_tsvector('english', COALESCE(r.%s, '')), websearch_to_wildcard_tsquery('english', ?))", field)
+		rankArgs = append(rankArgs, query)
+	}
+	if rankStr == "" {
+		return "", nil
+	}
+
+	return "(" + rankStr + ")", rankArgs
+}
+
+func (postgresDriverAdapter) GetSearchHighlight(field models.SearchField, query string) (string, []any) {
+	if !lo.Contains(supportedSearchFields[:], field) {
+		return "", nil
+	}
+
+	return fmt.Sprintf("ts_headline('english', r.%s, websearch_to_wildcard_tsquery('english', ?), 'StartSel=\"%s\", StopSel=\"%s\", MaxWords=16, MinWords=8, MaxFragments=1')",
+		field, highlightStartDelimiter, highlightStopDelimiter), []any{query}
+}
+
 func (postgresDriverAdapter) PreImport(ctx context.Context, db sqlx.ExecerContext) error {
 	if _, err := db.ExecContext(ctx, "SET CONSTRAINTS ALL DEFERRED"); err != nil {
 		return fmt.Errorf("deferring constraints: %w", err)
@@ -79,7 +111,7 @@ func (postgresDriverAdapter) StandardizeExport(_ context.Context, backup *models
 				if byteValue, ok := value.([]byte); ok {
 					// Postgres can return []byte for enum fields, which isn't JSON serializable. Convert those to strings.
 					// In a general purpose implementation, we'd want to check the column type to make sure we're only converting enum fields,
-					// but since we don't otherwise store binary data, we can get away with just converting any []byte we encounter.
+					// but since binary data is already base64 encoded by now, we can get away with just converting any []byte we encounter.
 					row[key] = string(byteValue)
 				} else {
 					row[key] = value
@@ -122,6 +154,10 @@ func openPostgres(connectionURL url.URL, migrationsTableName string, migrationsF
 		return nil, fmt.Errorf("failed to migrate database: '%w'", err)
 	}
 
+	if err := applyDataMigrations(context.Background(), db, dataMigrations); err != nil {
+		return nil, fmt.Errorf("failed to migrate data: '%w'", err)
+	}
+
 	drv := newSQLDriver(db, postgresDriverAdapter{}, migrationsTableName)
 	return drv, nil
 }
@@ -155,6 +191,31 @@ func migratePostgresDatabase(db *sqlx.DB, migrationsTableName string, migrations
 	return migrateDatabase(driver, PostgresDriverName, migrationsForceVersion)
 }
 
+func (postgresDriverAdapter) LockImageContent(ctx context.Context, db *sqlx.DB, contentName string) (func(), error) {
+	// The upload store is changed while the lock is held, so it's held by a session rather than a transaction.
+	// This requires the same connection to be used for both locking and unlocking.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting connection: %w", err)
+	}
+	// This should block until the lock has been acquired
+	stmt := "SELECT pg_advisory_lock($1, hashtext($2))"
+	if _, err := conn.ExecContext(ctx, stmt, imageContentLockClass, contentName); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("locking image content: %w", err)
+	}
+
+	return func() {
+		stmt := "SELECT pg_advisory_unlock($1, hashtext($2))"
+		if _, err := conn.ExecContext(context.Background(), stmt, imageContentLockClass, contentName); err != nil {
+			slog.Error("Failed to unlock image content", "name", contentName, "error", err)
+			// Discard the connection, rather than returning it to the pool while it still holds the lock
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		_ = conn.Close()
+	}, nil
+}
+
 func lockPostgres(conn *sql.Conn) error {
 	stmt := "SELECT pg_advisory_lock(1)"
 	_, err := conn.ExecContext(context.Background(), stmt)
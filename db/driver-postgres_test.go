@@ -62,6 +62,51 @@ func Test_postgres_GetSearchFields(t *testing.T) {
 	}
 }
 
+func Test_postgres_GetSearchRank(t *testing.T) {
+	type testArgs struct {
+		fields []models.SearchField
+		query  string
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{[]models.SearchField{models.SearchFieldName}, "query"},
+		{[]models.SearchField{models.SearchFieldName, models.SearchFieldDirections}, "query"},
+		{supportedSearchFields[:], "query"},
+		{[]models.SearchField{models.SearchFieldName, "invalid"}, "query"},
+		{[]models.SearchField{"invalid"}, "query"},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			sut := postgresDriverAdapter{}
+
+			// Act
+			stmt, args := sut.GetSearchRank(test.fields, test.query)
+
+			// Assert
+			expectedFields := lo.Intersect(test.fields, supportedSearchFields[:])
+			if len(args) != len(expectedFields) {
+				t.Errorf("expected %d args, received %d", len(expectedFields), len(args))
+			}
+			for index, arg := range args {
+				if arg != test.query {
+					t.Errorf("arg at index %d, expected %v, received %v", index, test.query, arg)
+				}
+			}
+			if stmt == "" {
+				if len(expectedFields) > 0 {
+					t.Error("rank should not be empty")
+				}
+			} else {
+				segments := strings.Split(stmt, " + ")
+				if len(segments) != len(expectedFields) {
+					t.Errorf("expected %d segments, received %d", len(expectedFields), len(segments))
+				}
+			}
+		})
+	}
+}
+
 func Test_lockPostgres(t *testing.T) {
 	type testArgs struct {
 		lock          bool
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/chadweimer/gomp/fileaccess"
 	"github.com/chadweimer/gomp/models"
 	"github.com/jmoiron/sqlx"
 )
@@ -14,6 +15,7 @@ import (
 type sqlDriverAdapter interface {
 	sqlRecipeDriverAdapter
 	sqlBackupDriverAdapter
+	sqlImageReferenceDriverAdapter
 }
 
 // UserWithPasswordHash reprents a user including the password hash in the database
@@ -23,11 +25,26 @@ type UserWithPasswordHash struct {
 	PasswordHash string `json:"-" db:"password_hash"`
 }
 
+// JobWithInput represents a job including what it operates on in the database
+type JobWithInput struct {
+	models.Job
+
+	// Payload is the JSON encoded parameters of the job
+	Payload string `json:"-" db:"payload"`
+
+	// Data is the content the job operates on, if any, e.g., an uploaded file
+	Data []byte `json:"-" db:"data"`
+}
+
 type sqlDriver struct {
 	Db *sqlx.DB
 
 	app               *sqlAppConfigurationDriver
 	backups           *sqlBackupDriver
+	files             *sqlFileBlobDriver
+	images            *sqlImageDriver
+	imageReferences   *sqlImageReferenceDriver
+	jobs              *sqlJobDriver
 	links             *sqlLinkDriver
 	notes             *sqlNoteDriver
 	recipes           *sqlRecipeDriver
@@ -43,6 +60,10 @@ func newSQLDriver(db *sqlx.DB, adapter sqlDriverAdapter, migrationsTableName str
 
 		app:               &sqlAppConfigurationDriver{db},
 		backups:           &sqlBackupDriver{db, adapter, migrationsTableName},
+		files:             &sqlFileBlobDriver{db},
+		images:            &sqlImageDriver{db},
+		imageReferences:   &sqlImageReferenceDriver{db, adapter},
+		jobs:              &sqlJobDriver{db},
 		links:             &sqlLinkDriver{db},
 		notes:             &sqlNoteDriver{db},
 		recipes:           &sqlRecipeDriver{db, adapter},
@@ -61,6 +82,22 @@ func (d *sqlDriver) Backups() BackupDriver {
 	return d.backups
 }
 
+func (d *sqlDriver) Files() fileaccess.Driver {
+	return d.files
+}
+
+func (d *sqlDriver) Images() ImageDriver {
+	return d.images
+}
+
+func (d *sqlDriver) ImageReferences() fileaccess.ImageReferences {
+	return d.imageReferences
+}
+
+func (d *sqlDriver) Jobs() JobDriver {
+	return d.jobs
+}
+
 func (d *sqlDriver) Links() LinkDriver {
 	return d.links
 }
@@ -30,10 +30,22 @@ func (mockDriverAdapter) GetSearchFields(_ []models.SearchField, _ string) (stri
 	return "", make([]any, 0)
 }
 
+func (mockDriverAdapter) GetSearchRank(_ []models.SearchField, _ string) (string, []any) {
+	return "", make([]any, 0)
+}
+
+func (mockDriverAdapter) GetSearchHighlight(_ models.SearchField, _ string) (string, []any) {
+	return "", make([]any, 0)
+}
+
 func (m mockDriverAdapter) GetTableNames(_ context.Context, _ sqlx.QueryerContext) ([]string, error) {
 	return m.tableNames, nil
 }
 
+func (mockDriverAdapter) LockImageContent(_ context.Context, _ *sqlx.DB, _ string) (func(), error) {
+	return func() {}, nil
+}
+
 func (mockDriverAdapter) PreImport(_ context.Context, _ sqlx.ExecerContext) error {
 	return nil
 }
@@ -6,7 +6,10 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/chadweimer/gomp/models"
 	"github.com/golang-migrate/migrate/v4/database/sqlite"
@@ -23,22 +26,161 @@ import (
 // SQLiteDriverName is the name to use for this driver
 const SQLiteDriverName string = "sqlite"
 
-type sqliteDriverAdapter struct{}
+type sqliteDriverAdapter struct {
+	// imageContentMu serializes changes to the references to content-addressed images.
+	// A SQLite database is only ever used by a single instance, so a lock within the process is enough.
+	imageContentMu *sync.Mutex
+}
 
 func (sqliteDriverAdapter) GetSearchFields(filterFields []models.SearchField, query string) (string, []any) {
-	fieldStr := ""
-	fieldArgs := make([]any, 0)
+	match, negated := getFTSMatchExpression(filterFields, query)
+	if match == "" {
+		return "", nil
+	}
+
+	stmt := "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)"
+	if negated {
+		stmt = "r.id NOT IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)"
+	}
+	return stmt, []any{match}
+}
+
+func (sqliteDriverAdapter) GetSearchRank(filterFields []models.SearchField, query string) (string, []any) {
+	match, negated := getFTSMatchExpression(filterFields, query)
+	if match == "" || negated {
+		// There's nothing to rank against if the query only excludes terms
+		return "", nil
+	}
+
+	// bm25 returns smaller values for better matches, so negate it to make it consistent with other drivers
+	return "COALESCE((SELECT -bm25(recipe_fts) FROM recipe_fts WHERE recipe_fts MATCH ? AND rowid = r.id), 0)", []any{match}
+}
+
+func (sqliteDriverAdapter) GetSearchHighlight(field models.SearchField, query string) (string, []any) {
+	column := lo.IndexOf(supportedSearchFields[:], field)
+	if column < 0 {
+		return "", nil
+	}
+
+	match, negated := getFTSMatchExpression([]models.SearchField{field}, query)
+	if match == "" || negated {
+		// There's nothing to highlight if the query only excludes terms
+		return "", nil
+	}
+
+	return fmt.Sprintf("(SELECT snippet(recipe_fts, %d, '%s', '%s', '...', 16) FROM recipe_fts WHERE recipe_fts MATCH ? AND rowid = r.id)",
+		column, highlightStartDelimiter, highlightStopDelimiter), []any{match}
+}
+
+// getFTSMatchExpression converts a web search style query into an FTS5 MATCH expression
+// that is restricted to the specified fields. Bare words are treated as prefixes,
+// quoted text as phrases, "OR" as a disjunction, and words prefixed with "-" as exclusions.
+// If the query only contains exclusions, the returned expression matches the excluded terms
+// and negated is true, since FTS5 does not support a standalone NOT.
+func getFTSMatchExpression(filterFields []models.SearchField, query string) (match string, negated bool) {
+	columns := make([]string, 0)
 	for _, field := range supportedSearchFields {
 		if lo.Contains(filterFields, field) {
-			if fieldStr != "" {
-				fieldStr += " OR "
+			columns = append(columns, string(field))
+		}
+	}
+	if len(columns) == 0 {
+		return "", false
+	}
+
+	included := ""
+	excluded := make([]string, 0)
+	pendingOr := false
+	for _, term := range splitSearchTerms(query) {
+		if !term.quoted && term.text == "OR" {
+			pendingOr = included != ""
+			continue
+		}
+
+		phrase := `"` + strings.ReplaceAll(term.text, `"`, `""`) + `"`
+		if !term.quoted {
+			phrase += "*"
+		}
+
+		if term.excluded {
+			excluded = append(excluded, phrase)
+			continue
+		}
+
+		if included != "" {
+			if pendingOr {
+				included += " OR "
+			} else {
+				included += " AND "
 			}
-			fieldStr += "r." + string(field) + " LIKE ?"
-			fieldArgs = append(fieldArgs, "%"+query+"%")
 		}
+		included += phrase
+		pendingOr = false
+	}
+
+	columnFilter := "{" + strings.Join(columns, " ") + "} : "
+	switch {
+	case included != "" && len(excluded) > 0:
+		return columnFilter + "((" + included + ") NOT (" + strings.Join(excluded, " OR ") + "))", false
+	case included != "":
+		return columnFilter + "(" + included + ")", false
+	case len(excluded) > 0:
+		return columnFilter + "(" + strings.Join(excluded, " OR ") + ")", true
+	default:
+		return "", false
 	}
+}
 
-	return fieldStr, fieldArgs
+type searchTerm struct {
+	text     string
+	quoted   bool
+	excluded bool
+}
+
+func splitSearchTerms(query string) []searchTerm {
+	terms := make([]searchTerm, 0)
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		term := searchTerm{}
+		if runes[i] == '-' {
+			term.excluded = true
+			i++
+		}
+
+		if i < len(runes) && runes[i] == '"' {
+			term.quoted = true
+			i++
+			start := i
+			for i < len(runes) && runes[i] != '"' {
+				i++
+			}
+			term.text = string(runes[start:i])
+			// Skip the closing quote, if there is one
+			i++
+		} else {
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) {
+				i++
+			}
+			term.text = string(runes[start:i])
+		}
+
+		if strings.TrimSpace(term.text) != "" {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+func (a sqliteDriverAdapter) LockImageContent(_ context.Context, _ *sqlx.DB, _ string) (func(), error) {
+	a.imageContentMu.Lock()
+	return a.imageContentMu.Unlock, nil
 }
 
 func (sqliteDriverAdapter) PreImport(ctx context.Context, db sqlx.ExecerContext) error {
@@ -52,13 +194,17 @@ func (sqliteDriverAdapter) GetImportInsertStatement() string {
 	return "INSERT OR REPLACE"
 }
 
-func (sqliteDriverAdapter) PostImport(_ context.Context, _ sqlx.ExecerContext) error {
+func (sqliteDriverAdapter) PostImport(ctx context.Context, db sqlx.ExecerContext) error {
+	// The full-text index isn't reliably maintained by triggers during the import, so rebuild it
+	if _, err := db.ExecContext(ctx, "INSERT INTO recipe_fts(recipe_fts) VALUES('rebuild')"); err != nil {
+		return fmt.Errorf("rebuilding full-text index: %w", err)
+	}
 	return nil
 }
 
 func (sqliteDriverAdapter) GetTableNames(ctx context.Context, db sqlx.QueryerContext) ([]string, error) {
 	tables := make([]string, 0)
-	if err := sqlx.SelectContext(ctx, db, &tables, "SELECT name FROM sqlite_schema WHERE type='table' AND name NOT LIKE 'sqlite_%'"); err != nil {
+	if err := sqlx.SelectContext(ctx, db, &tables, "SELECT name FROM pragma_table_list WHERE schema = 'main' AND type = 'table' AND name NOT LIKE 'sqlite_%'"); err != nil {
 		return nil, err
 	}
 
@@ -99,7 +245,11 @@ func openSQLite(connectionURL url.URL, migrationsTableName string, migrationsFor
 		return nil, fmt.Errorf("failed to migrate database: '%w'", err)
 	}
 
-	drv := newSQLDriver(db, sqliteDriverAdapter{}, migrationsTableName)
+	if err := applyDataMigrations(context.Background(), db, dataMigrations); err != nil {
+		return nil, fmt.Errorf("failed to migrate data: '%w'", err)
+	}
+
+	drv := newSQLDriver(db, sqliteDriverAdapter{new(sync.Mutex)}, migrationsTableName)
 	return drv, nil
 }
 
@@ -1,58 +1,118 @@
 package db
 
 import (
-	"fmt"
-	"strings"
+	"reflect"
 	"testing"
 
 	"github.com/chadweimer/gomp/models"
-	"github.com/samber/lo"
 )
 
 func Test_sqlite_GetSearchFields(t *testing.T) {
 	type testArgs struct {
-		fields []models.SearchField
-		query  string
+		name         string
+		fields       []models.SearchField
+		query        string
+		expectedStmt string
+		expectedArgs []any
 	}
 
 	// Arrange
 	tests := []testArgs{
-		{[]models.SearchField{models.SearchFieldName}, "query"},
-		{[]models.SearchField{models.SearchFieldName, models.SearchFieldDirections}, "query"},
-		{supportedSearchFields[:], "query"},
-		{[]models.SearchField{models.SearchFieldName, "invalid"}, "query"},
-		{[]models.SearchField{"invalid"}, "query"},
-	}
-	for i, test := range tests {
-		t.Run(fmt.Sprint(i), func(t *testing.T) {
+		{"Single field", []models.SearchField{models.SearchFieldName}, "query", "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name} : ("query"*)`}},
+		{"Multiple fields", []models.SearchField{models.SearchFieldName, models.SearchFieldDirections}, "query", "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name directions} : ("query"*)`}},
+		{"All fields", supportedSearchFields[:], "query", "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name ingredients directions storage_instructions nutrition_info} : ("query"*)`}},
+		{"Some invalid fields", []models.SearchField{models.SearchFieldName, "invalid"}, "query", "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name} : ("query"*)`}},
+		{"Only invalid fields", []models.SearchField{"invalid"}, "query", "", nil},
+		{"Multiple words", []models.SearchField{models.SearchFieldName}, "chicken soup", "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name} : ("chicken"* AND "soup"*)`}},
+		{"Phrase", []models.SearchField{models.SearchFieldName}, `"coconut milk" soup`, "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name} : ("coconut milk" AND "soup"*)`}},
+		{"Or", []models.SearchField{models.SearchFieldName}, "chicken OR beef", "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name} : ("chicken"* OR "beef"*)`}},
+		{"Leading or", []models.SearchField{models.SearchFieldName}, "OR beef", "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name} : ("beef"*)`}},
+		{"Exclusion", []models.SearchField{models.SearchFieldName}, "soup -spicy", "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name} : (("soup"*) NOT ("spicy"*))`}},
+		{"Only exclusions", []models.SearchField{models.SearchFieldName}, `-spicy -"hot sauce"`, "r.id NOT IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name} : ("spicy"* OR "hot sauce")`}},
+		{"Special characters", []models.SearchField{models.SearchFieldName}, `mac'n"cheese name:foo`, "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name} : ("mac'n""cheese"* AND "name:foo"*)`}},
+		{"Unterminated phrase", []models.SearchField{models.SearchFieldName}, `"coconut milk`, "r.id IN (SELECT rowid FROM recipe_fts WHERE recipe_fts MATCH ?)", []any{`{name} : ("coconut milk")`}},
+		{"Whitespace only", []models.SearchField{models.SearchFieldName}, `  "" - `, "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
 			sut := sqliteDriverAdapter{}
 
 			// Act
 			stmt, args := sut.GetSearchFields(test.fields, test.query)
 
 			// Assert
-			expectedFields := lo.Intersect(test.fields, supportedSearchFields[:])
-			if len(args) != len(expectedFields) {
-				t.Errorf("expected %d args, received %d", len(expectedFields), len(args))
+			if stmt != test.expectedStmt {
+				t.Errorf("expected stmt %s, received %s", test.expectedStmt, stmt)
+			}
+			if !reflect.DeepEqual(args, test.expectedArgs) {
+				t.Errorf("expected args %v, received %v", test.expectedArgs, args)
+			}
+		})
+	}
+}
+
+func Test_sqlite_GetSearchRank(t *testing.T) {
+	type testArgs struct {
+		name         string
+		fields       []models.SearchField
+		query        string
+		expectedStmt string
+		expectedArgs []any
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Single field", []models.SearchField{models.SearchFieldName}, "query", "COALESCE((SELECT -bm25(recipe_fts) FROM recipe_fts WHERE recipe_fts MATCH ? AND rowid = r.id), 0)", []any{`{name} : ("query"*)`}},
+		{"Only invalid fields", []models.SearchField{"invalid"}, "query", "", nil},
+		{"Only exclusions", []models.SearchField{models.SearchFieldName}, "-query", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sut := sqliteDriverAdapter{}
+
+			// Act
+			stmt, args := sut.GetSearchRank(test.fields, test.query)
+
+			// Assert
+			if stmt != test.expectedStmt {
+				t.Errorf("expected stmt %s, received %s", test.expectedStmt, stmt)
+			}
+			if !reflect.DeepEqual(args, test.expectedArgs) {
+				t.Errorf("expected args %v, received %v", test.expectedArgs, args)
 			}
-			for index, arg := range args {
-				strArg, ok := arg.(string)
-				if !ok {
-					t.Errorf("invalid argument type: %v", arg)
-				}
-				if strArg != "%"+test.query+"%" {
-					t.Errorf("arg at index %d, expected %v, received %v", index, test.query, arg)
-				}
+		})
+	}
+}
+
+func Test_sqlite_GetSearchHighlight(t *testing.T) {
+	type testArgs struct {
+		name         string
+		field        models.SearchField
+		query        string
+		expectedStmt string
+		expectedArgs []any
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Name", models.SearchFieldName, "query", "(SELECT snippet(recipe_fts, 0, '\x02', '\x03', '...', 16) FROM recipe_fts WHERE recipe_fts MATCH ? AND rowid = r.id)", []any{`{name} : ("query"*)`}},
+		{"Directions", models.SearchFieldDirections, "query", "(SELECT snippet(recipe_fts, 2, '\x02', '\x03', '...', 16) FROM recipe_fts WHERE recipe_fts MATCH ? AND rowid = r.id)", []any{`{directions} : ("query"*)`}},
+		{"Invalid field", "invalid", "query", "", nil},
+		{"Only exclusions", models.SearchFieldName, "-query", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sut := sqliteDriverAdapter{}
+
+			// Act
+			stmt, args := sut.GetSearchHighlight(test.field, test.query)
+
+			// Assert
+			if stmt != test.expectedStmt {
+				t.Errorf("expected stmt %s, received %s", test.expectedStmt, stmt)
 			}
-			if stmt == "" {
-				if len(expectedFields) > 0 {
-					t.Error("filter should not be empty")
-				}
-			} else {
-				segments := strings.Split(stmt, " OR ")
-				if len(segments) != len(expectedFields) {
-					t.Errorf("expected %d segments, received %d", len(expectedFields), len(segments))
-				}
+			if !reflect.DeepEqual(args, test.expectedArgs) {
+				t.Errorf("expected args %v, received %v", test.expectedArgs, args)
 			}
 		})
 	}
@@ -1,6 +1,6 @@
 package db
 
-//go:generate go tool mockgen -destination=../mocks/db/mocks.gen.go -package=db . Driver,AppConfigurationDriver,BackupDriver,LinkDriver,NoteDriver,RecipeDriver,UserDriver,UserSearchFilterDriver,UserSettingsDriver,TagDriver
+//go:generate go tool mockgen -destination=../mocks/db/mocks.gen.go -package=db . Driver,AppConfigurationDriver,BackupDriver,ImageDriver,JobDriver,LinkDriver,NoteDriver,RecipeDriver,UserDriver,UserSearchFilterDriver,UserSettingsDriver,TagDriver
 
 import (
 	"context"
@@ -10,7 +10,9 @@ import (
 	"log/slog"
 	"net/url"
 	"path/filepath"
+	"time"
 
+	"github.com/chadweimer/gomp/fileaccess"
 	"github.com/chadweimer/gomp/models"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
@@ -28,6 +30,13 @@ var ErrAuthenticationFailed = errors.New("username or password invalid")
 // ErrMissingID represents the error when no id is provided on an operation that requires it
 var ErrMissingID = errors.New("id is required")
 
+// ErrTagCycle represents the error when a tag would be nested under itself,
+// directly or through any of the tags nested under it
+var ErrTagCycle = errors.New("tag cannot be nested under itself")
+
+// ErrJobRunning represents the error when a job cannot be changed because it's running
+var ErrJobRunning = errors.New("job is running")
+
 // ---- End Standard Errors ----
 
 // Driver represents the interface of a backing data store
@@ -36,6 +45,10 @@ type Driver interface {
 
 	AppConfiguration() AppConfigurationDriver
 	Backups() BackupDriver
+	Files() fileaccess.Driver
+	Images() ImageDriver
+	ImageReferences() fileaccess.ImageReferences
+	Jobs() JobDriver
 	Links() LinkDriver
 	Notes() NoteDriver
 	Recipes() RecipeDriver
@@ -133,6 +146,93 @@ type BackupDriver interface {
 	Import(ctx context.Context, backup *models.BackupData) error
 }
 
+// ImageDriver provides functionality to edit and retrieve the details of recipe images.
+// The images themselves are stored as files, so the details of an image may not exist,
+// e.g., for images uploaded before the details were recorded.
+type ImageDriver interface {
+	// Create stores the details of the image in the database as a new record, after any
+	// other images of the recipe, using a dedicated transaction that is committed if there are not errors.
+	// If details already exist for an image with the same name, only its dimensions are updated.
+	Create(ctx context.Context, recipeID int64, image *models.RecipeImage) error
+
+	// Update stores the caption and alt text of the image in the database, creating a record
+	// after any other images of the recipe if necessary, using a dedicated transaction
+	// that is committed if there are not errors.
+	Update(ctx context.Context, recipeID int64, name string, info *models.RecipeImageInfo) error
+
+	// Rename changes the name of the image in the database, e.g., after its content changes,
+	// along with the notes and steps of the recipe that use it,
+	// using a dedicated transaction that is committed if there are not errors.
+	// If details already exist for an image with the new name, those are kept instead.
+	Rename(ctx context.Context, recipeID int64, name, newName string) error
+
+	// Delete removes the details of the image from the database, and detaches it from the notes
+	// and steps of the recipe that use it, using a dedicated transaction that is committed if there are not errors.
+	Delete(ctx context.Context, recipeID int64, name string) error
+
+	// Reorder sets the order of the images of the recipe to the order of the specified names,
+	// creating records for any that don't have details, using a dedicated transaction
+	// that is committed if there are not errors.
+	Reorder(ctx context.Context, recipeID int64, names []string) error
+
+	// List retrieves the details of all images of the recipe with the specified id, in order.
+	List(ctx context.Context, recipeID int64) (*[]models.RecipeImage, error)
+}
+
+// JobDriver provides functionality to queue, claim and track background jobs.
+type JobDriver interface {
+	// Create stores the job, along with what it operates on, in the database as a new pending record
+	// using a dedicated transaction that is committed if there are not errors.
+	Create(ctx context.Context, job *JobWithInput) error
+
+	// Read retrieves the information about the job from the database, if found.
+	// If no job exists with the specified ID, a NoRecordFound error is returned.
+	Read(ctx context.Context, id int64) (*models.Job, error)
+
+	// List retrieves all jobs in the database, most recent first.
+	List(ctx context.Context) (*[]models.Job, error)
+
+	// Delete removes the specified job from the database using a dedicated transaction
+	// that is committed if there are not errors. Running jobs are not deleted,
+	// and ErrJobRunning is returned instead.
+	Delete(ctx context.Context, id int64) error
+
+	// Claim marks the oldest pending job that is ready to run at the specified time as running,
+	// counting it as another attempt, and records the time as its heartbeat,
+	// using a dedicated transaction that is committed if there are not errors.
+	// If no job is ready to run, a NoRecordFound error is returned.
+	Claim(ctx context.Context, now time.Time) (*JobWithInput, error)
+
+	// Heartbeat records that the specified attempt of the running job is still in progress at the specified time
+	// using a dedicated transaction that is committed if there are not errors.
+	Heartbeat(ctx context.Context, id int64, attempt int, now time.Time) error
+
+	// UpdateProgress stores how much of the work of the specified attempt of the running job is done
+	// using a dedicated transaction that is committed if there are not errors.
+	UpdateProgress(ctx context.Context, id int64, attempt int, progress int) error
+
+	// Complete marks the specified attempt of the running job as succeeded with the specified result,
+	// discarding the data it operated on, using a dedicated transaction that is committed if there are not errors.
+	Complete(ctx context.Context, id int64, attempt int, result string) error
+
+	// Fail records why the specified attempt of the running job failed
+	// using a dedicated transaction that is committed if there are not errors.
+	// If retryAt is specified, the job is pending again until then. Otherwise, it is marked as failed,
+	// discarding the data it operated on.
+	Fail(ctx context.Context, id int64, attempt int, message string, retryAt *time.Time) error
+
+	// Requeue marks the running jobs whose last heartbeat was before the specified time as pending again,
+	// or as failed if they are out of attempts, recording the specified message as the reason,
+	// using a dedicated transaction that is committed if there are not errors.
+	// This is meant for jobs that were interrupted, e.g., when the instance running them stopped.
+	Requeue(ctx context.Context, staleBefore time.Time, message string) error
+
+	// Prune removes the jobs that finished before the specified time from the database
+	// using a dedicated transaction that is committed if there are not errors.
+	// The number of jobs removed is returned.
+	Prune(ctx context.Context, finishedBefore time.Time) (int64, error)
+}
+
 // LinkDriver provides functionality to edit and retrieve recipe links.
 type LinkDriver interface {
 	// Create stores a link between 2 recipes in the database as a new record
@@ -151,17 +251,23 @@ type LinkDriver interface {
 type NoteDriver interface {
 	// Create stores the note in the database as a new record using
 	// a dedicated transaction that is committed if there are not errors.
+	// If the note is a reply, the parent note must belong to the same recipe.
 	Create(ctx context.Context, note *models.Note) error
 
+	// Read retrieves the information about the note from the database, if found.
+	// If no note exists with the specified ID on the recipe, a NoRecordFound error is returned.
+	Read(ctx context.Context, recipeID, noteID int64) (*models.Note, error)
+
 	// Update stores the note in the database by updating the existing record with the specified
 	// id using a dedicated transaction that is committed if there are not errors.
+	// The parent and creating user of the note are not modified.
 	Update(ctx context.Context, note *models.Note) error
 
-	// Delete removes the specified note from the database using a dedicated transaction
-	// that is committed if there are not errors.
+	// Delete removes the specified note, along with any replies to it, from the database
+	// using a dedicated transaction that is committed if there are not errors.
 	Delete(ctx context.Context, recipeID, noteID int64) error
 
-	// List retrieves all notes associated with the recipe with the specified id.
+	// List retrieves all notes, including replies, associated with the recipe with the specified id.
 	List(ctx context.Context, recipeID int64) (*[]models.Note, error)
 }
 
@@ -175,6 +281,12 @@ type RecipeDriver interface {
 	// If no recipe exists with the specified ID, a NoRecordFound error is returned.
 	Read(ctx context.Context, id int64) (*models.Recipe, error)
 
+	// List retrieves the information about all recipes from the database, including their tags.
+	List(ctx context.Context) (*[]models.Recipe, error)
+
+	// ListIDs retrieves the IDs of all recipes from the database, in ascending order.
+	ListIDs(ctx context.Context) ([]int64, error)
+
 	// Update stores the specified recipe in the database by updating the
 	// existing record with the specified id using a dedicated transaction
 	// that is committed if there are not errors.
@@ -185,6 +297,9 @@ type RecipeDriver interface {
 	// - State: this field is expected to be updated using the Patch method, not this method
 	// - MainImageName: this field is expected to be updated using the Patch method, not this method
 	// - Rating: this field is expected to be updated using the Patch method, not this method
+	//
+	// If Steps is nil, the steps are split from Directions, keeping the details of any steps whose text is unchanged.
+	// Otherwise, Directions is replaced with the text of the steps.
 	Update(ctx context.Context, recipe *models.Recipe) error
 
 	// Patch updates the specified fields on the recipe in the database by updating the
@@ -199,8 +314,20 @@ type RecipeDriver interface {
 	// any attachments that we associated with the deleted recipe.
 	Delete(ctx context.Context, id int64) error
 
+	// Merge combines the tags, notes, links, rating, and main image of the duplicate recipe into the recipe
+	// with the specified id, and then deletes the duplicate, using a dedicated transaction that is committed
+	// if there are not errors. renamedImages maps the names of any images of the duplicate that were renamed
+	// when they were moved to the surviving recipe, so that references to them can be updated.
+	// If either recipe doesn't exist, a NoRecordFound error is returned.
+	Merge(ctx context.Context, id int64, duplicateID int64, renamedImages map[string]string) error
+
 	// Find retrieves all recipes matching the specified search filter and within the range specified.
-	Find(ctx context.Context, filter *models.SearchFilter, page int64, count int64) (*[]models.RecipeCompact, int64, error)
+	// If withHighlights is true, each recipe includes its relevance and snippets from the fields that matched the query.
+	Find(ctx context.Context, filter *models.SearchFilter, withHighlights bool, page int64, count int64) (*[]models.RecipeCompact, int64, error)
+
+	// GetFacets retrieves the number of recipes matching the specified search filter,
+	// broken down by tag, state, whether they have pictures, rating, and cook time.
+	GetFacets(ctx context.Context, filter *models.SearchFilter) (*models.SearchFacets, error)
 }
 
 // UserDriver provides functionality to edit and authenticate users.
@@ -265,10 +392,36 @@ type UserSettingsDriver interface {
 	Update(ctx context.Context, settings *models.UserSettings) error
 }
 
-// TagDriver provides functionality to retrieve tags across recipes.
+// TagDriver provides functionality to retrieve and edit tags across recipes.
 type TagDriver interface {
 	// List retrieves all tags across all recipes in the database.
 	// The returned map contains the tag as the key and the number of recipes
 	// associated with that tag as the value.
 	List(ctx context.Context) (*map[string]int, error)
+
+	// Tree retrieves all tags, both those used by recipes and those with saved info,
+	// arranged by the tags they're nested under. Each tag includes the number of recipes
+	// with the tag, and the number of recipes with the tag or any tag nested under it.
+	Tree(ctx context.Context) (*[]models.TagNode, error)
+
+	// SaveInfo creates or updates the info of the tag, including the tag it's nested under,
+	// using a dedicated transaction that is committed if there are not errors.
+	// If the tag would be nested under itself, a TagCycle error is returned.
+	SaveInfo(ctx context.Context, tag string, info *models.TagInfo) error
+
+	// Rename changes the tag to the new tag on all recipes, user favorites, saved search filters, and the tag hierarchy
+	// using a dedicated transaction that is committed if there are not errors.
+	// If the tag isn't used anywhere, a NoRecordFound error is returned.
+	Rename(ctx context.Context, tag string, newTag string) error
+
+	// Merge replaces all the specified tags with a single tag on all recipes, user favorites,
+	// saved search filters, and the tag hierarchy using a dedicated transaction that is committed if there are not errors.
+	// If none of the tags are used anywhere, a NoRecordFound error is returned.
+	Merge(ctx context.Context, tags []string, intoTag string) error
+
+	// Delete removes the tag from all recipes, user favorites, saved search filters, and the tag hierarchy
+	// using a dedicated transaction that is committed if there are not errors.
+	// Any tags nested under the tag are moved up to the tag it was nested under.
+	// If the tag isn't used anywhere, a NoRecordFound error is returned.
+	Delete(ctx context.Context, tag string) error
 }
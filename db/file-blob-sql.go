@@ -0,0 +1,429 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chadweimer/gomp/fileaccess"
+	"github.com/jmoiron/sqlx"
+)
+
+const fileBlobTableName = "file_blob"
+
+// fileBlobChunkSize is how much of the content of a file is read from the database at a time
+const fileBlobChunkSize = 256 * 1024
+
+// sqlFileBlobDriver is an implementation of fileaccess.Driver that stores files in the database.
+// Directories are implied by the slashes in the paths of the files, so they exist exactly as long as they contain files.
+type sqlFileBlobDriver struct {
+	Db *sqlx.DB
+}
+
+type fileBlobInfo struct {
+	Path       string    `db:"path"`
+	Size       int64     `db:"size"`
+	ModifiedAt time.Time `db:"modified_at"`
+}
+
+func (d *sqlFileBlobDriver) Open(name string) (fs.File, error) {
+	// Unlike the other methods, Open is held to the stricter requirements of fs.FS
+	name = filepath.ToSlash(name)
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &blobDir{driver: d, name: name, info: blobFileInfo{name: name, isDir: true}}, nil
+	}
+
+	info, err := d.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if info.isDir {
+		return &blobDir{driver: d, name: name, info: info}, nil
+	}
+	return &blobFile{driver: d, path: name, info: info}, nil
+}
+
+func (d *sqlFileBlobDriver) Create(filePath string) (io.WriteCloser, error) {
+	cleanedPath, err := cleanBlobPath("create", filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The content is written in a single statement, so buffer it until then
+	return &blobWriter{driver: d, path: cleanedPath}, nil
+}
+
+func (d *sqlFileBlobDriver) Save(filePath string, reader io.Reader) error {
+	cleanedPath, err := cleanBlobPath("save", filePath)
+	if err != nil {
+		return err
+	}
+
+	// Make sure we're at the beginning of the content
+	if seeker, ok := reader.(io.Seeker); ok {
+		_, err := seeker.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return d.write(cleanedPath, content)
+}
+
+func (d *sqlFileBlobDriver) Delete(filePath string) error {
+	cleanedPath, err := cleanBlobPath("remove", filePath)
+	if err != nil {
+		return err
+	}
+
+	res, err := d.Db.Exec("DELETE FROM file_blob WHERE path = $1", cleanedPath)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: filePath, Err: err}
+	}
+	if rows, err := res.RowsAffected(); err == nil && rows == 0 {
+		return &fs.PathError{Op: "remove", Path: filePath, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+func (d *sqlFileBlobDriver) DeleteAll(dirPath string) error {
+	cleanedPath := path.Clean(filepath.ToSlash(dirPath))
+	if !fs.ValidPath(cleanedPath) {
+		return &fs.PathError{Op: "removeall", Path: dirPath, Err: fs.ErrInvalid}
+	}
+
+	var err error
+	if cleanedPath == "." {
+		_, err = d.Db.Exec("DELETE FROM file_blob")
+	} else {
+		prefix := cleanedPath + "/"
+		_, err = d.Db.Exec("DELETE FROM file_blob WHERE path = $1 OR substr(path, 1, $2) = $3",
+			cleanedPath, utf8.RuneCountInString(prefix), prefix)
+	}
+	if err != nil {
+		return &fs.PathError{Op: "removeall", Path: dirPath, Err: err}
+	}
+	return nil
+}
+
+func (d *sqlFileBlobDriver) Stat(name string) (fs.FileInfo, error) {
+	cleanedPath, err := cleanBlobPath("stat", name)
+	if err != nil {
+		if path.Clean(filepath.ToSlash(name)) == "." {
+			return blobFileInfo{name: ".", isDir: true}, nil
+		}
+		return nil, err
+	}
+
+	info, err := d.stat(cleanedPath)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+func (d *sqlFileBlobDriver) List(dirPath string) ([]fs.DirEntry, error) {
+	entries, err := d.ReadDir(path.Clean(filepath.ToSlash(dirPath)))
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter out directories, only return files
+	return slices.DeleteFunc(entries, func(entry fs.DirEntry) bool {
+		return entry.IsDir()
+	}), nil
+}
+
+// ReadDir implements fs.ReadDirFS, so that fs.WalkDir and the like don't need to open each directory
+func (d *sqlFileBlobDriver) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	blobs := make([]fileBlobInfo, 0)
+	var err error
+	prefix := ""
+	if name == "." {
+		err = d.Db.Select(&blobs, "SELECT path, size, modified_at FROM file_blob ORDER BY path")
+	} else {
+		prefix = name + "/"
+		err = d.Db.Select(&blobs, "SELECT path, size, modified_at FROM file_blob WHERE substr(path, 1, $1) = $2 ORDER BY path",
+			utf8.RuneCountInString(prefix), prefix)
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if len(blobs) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0)
+	for _, blob := range blobs {
+		entryName := strings.TrimPrefix(blob.Path, prefix)
+		if dirName, _, isNested := strings.Cut(entryName, "/"); isNested {
+			// Files in subdirectories are listed as the subdirectory, once
+			if !slices.ContainsFunc(entries, func(entry fs.DirEntry) bool { return entry.Name() == dirName }) {
+				entries = append(entries, blobFileInfo{name: dirName, isDir: true})
+			}
+			continue
+		}
+		entries = append(entries, blobFileInfo{name: entryName, size: blob.Size, modTime: blob.ModifiedAt})
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+// stat returns the info of the file or directory at the cleaned path
+func (d *sqlFileBlobDriver) stat(cleanedPath string) (blobFileInfo, error) {
+	var blob fileBlobInfo
+	err := d.Db.Get(&blob, "SELECT path, size, modified_at FROM file_blob WHERE path = $1", cleanedPath)
+	if err == nil {
+		return blobFileInfo{name: path.Base(cleanedPath), size: blob.Size, modTime: blob.ModifiedAt}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return blobFileInfo{}, err
+	}
+
+	// It may be a directory instead
+	prefix := cleanedPath + "/"
+	var count int
+	if err := d.Db.Get(&count, "SELECT count(*) FROM file_blob WHERE substr(path, 1, $1) = $2",
+		utf8.RuneCountInString(prefix), prefix); err != nil {
+		return blobFileInfo{}, err
+	}
+	if count == 0 {
+		return blobFileInfo{}, fs.ErrNotExist
+	}
+	return blobFileInfo{name: path.Base(cleanedPath), isDir: true}, nil
+}
+
+// write creates or overwrites the file at the cleaned path with the content
+func (d *sqlFileBlobDriver) write(cleanedPath string, content []byte) error {
+	return tx(context.Background(), d.Db, func(db *sqlx.Tx) error {
+		_, err := db.Exec("INSERT INTO file_blob (path, content, size, modified_at) VALUES ($1, $2, $3, $4) "+
+			"ON CONFLICT (path) DO UPDATE SET content = excluded.content, size = excluded.size, modified_at = excluded.modified_at",
+			cleanedPath, content, len(content), time.Now().UTC())
+		return err
+	})
+}
+
+// readChunk reads the content of the file at the cleaned path, starting at the offset, up to the specified length
+func (d *sqlFileBlobDriver) readChunk(cleanedPath string, offset int64, length int) ([]byte, error) {
+	var chunk []byte
+	// substr is 1-based
+	err := d.Db.Get(&chunk, "SELECT substr(content, $1, $2) FROM file_blob WHERE path = $3", offset+1, length, cleanedPath)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fs.ErrNotExist
+	}
+	return chunk, err
+}
+
+func cleanBlobPath(op string, name string) (string, error) {
+	cleanedPath := path.Clean(filepath.ToSlash(name))
+	if !fs.ValidPath(cleanedPath) || cleanedPath == "." {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return cleanedPath, nil
+}
+
+// blobFile is a file read from the database. The content is read in chunks as needed,
+// so that large files (e.g., backups) don't need to be read into memory all at once.
+type blobFile struct {
+	driver *sqlFileBlobDriver
+	path   string
+	info   blobFileInfo
+	offset int64
+
+	// buf is the chunk of content starting at bufOffset
+	buf       []byte
+	bufOffset int64
+}
+
+func (f *blobFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *blobFile) Read(p []byte) (int, error) {
+	if f.offset >= f.info.size {
+		return 0, io.EOF
+	}
+
+	// Read the next chunk if the buffer doesn't contain the current offset
+	if f.offset < f.bufOffset || f.offset >= f.bufOffset+int64(len(f.buf)) {
+		chunk, err := f.driver.readChunk(f.path, f.offset, fileBlobChunkSize)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.path, Err: err}
+		}
+		if len(chunk) == 0 {
+			// The file was truncated since it was opened
+			return 0, io.EOF
+		}
+		f.buf = chunk
+		f.bufOffset = f.offset
+	}
+
+	n := copy(p, f.buf[f.offset-f.bufOffset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *blobFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.path, Err: fs.ErrInvalid}
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *blobFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.info.size {
+		return 0, io.EOF
+	}
+
+	chunk, err := f.driver.readChunk(f.path, off, len(p))
+	if err != nil {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: err}
+	}
+	n := copy(p, chunk)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (*blobFile) Close() error {
+	return nil
+}
+
+// blobDir is a directory implied by the paths of the files in the database
+type blobDir struct {
+	driver *sqlFileBlobDriver
+	name   string
+	info   fs.FileInfo
+
+	// entries are the entries that haven't been read yet, or nil if they haven't been listed yet
+	entries []fs.DirEntry
+}
+
+func (d *blobDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *blobDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+func (d *blobDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		entries, err := d.driver.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = d.entries[len(d.entries):]
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+func (*blobDir) Close() error {
+	return nil
+}
+
+// blobWriter buffers the content of a file, and writes it to the database when closed
+type blobWriter struct {
+	driver *sqlFileBlobDriver
+	path   string
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *blobWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, &fs.PathError{Op: "write", Path: w.path, Err: fs.ErrClosed}
+	}
+	return w.buf.Write(p)
+}
+
+func (w *blobWriter) Close() error {
+	if w.closed {
+		return &fs.PathError{Op: "close", Path: w.path, Err: fs.ErrClosed}
+	}
+	w.closed = true
+
+	if err := w.driver.write(w.path, w.buf.Bytes()); err != nil {
+		return &fs.PathError{Op: "write", Path: w.path, Err: err}
+	}
+	return nil
+}
+
+// blobFileInfo describes a file, or a directory implied by the paths of the files
+type blobFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (i blobFileInfo) Name() string       { return i.name }
+func (i blobFileInfo) Size() int64        { return i.size }
+func (i blobFileInfo) ModTime() time.Time { return i.modTime }
+func (i blobFileInfo) IsDir() bool        { return i.isDir }
+func (blobFileInfo) Sys() any             { return nil }
+
+func (i blobFileInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0750
+	}
+	return 0640
+}
+
+func (i blobFileInfo) Type() fs.FileMode {
+	return i.Mode().Type()
+}
+
+func (i blobFileInfo) Info() (fs.FileInfo, error) {
+	return i, nil
+}
+
+// backupBlobExclusion is the condition for the files that are excluded from backups, and left alone when restoring from one.
+// Otherwise, every backup would contain all the ones before it, and restoring would delete the backup being restored from.
+var backupBlobExclusion = fmt.Sprintf("substr(path, 1, %d) = '%s/'",
+	utf8.RuneCountInString(fileaccess.BackupDirectoryName)+1, fileaccess.BackupDirectoryName)
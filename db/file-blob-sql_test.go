@@ -0,0 +1,459 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chadweimer/gomp/models"
+)
+
+func Test_FileBlob_Save(t *testing.T) {
+	type testArgs struct {
+		filePath      string
+		expectedPath  string
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"uploads/recipes/1/images/a.jpeg", "uploads/recipes/1/images/a.jpeg", nil, nil},
+		{"uploads/recipes/1/../2/images/a.jpeg", "uploads/recipes/2/images/a.jpeg", nil, nil},
+		{"../a.jpeg", "", nil, fs.ErrInvalid},
+		{"uploads/a.jpeg", "uploads/a.jpeg", sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			if test.expectedPath != "" {
+				dbmock.ExpectBegin()
+				exec := dbmock.ExpectExec("INSERT INTO file_blob \\(path, content, size, modified_at\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\) ON CONFLICT \\(path\\) DO UPDATE").
+					WithArgs(test.expectedPath, []byte("content"), 7, sqlmock.AnyArg())
+				if test.dbError == nil {
+					exec.WillReturnResult(driver.RowsAffected(1))
+					dbmock.ExpectCommit()
+				} else {
+					exec.WillReturnError(test.dbError)
+					dbmock.ExpectRollback()
+				}
+			}
+
+			// Act
+			reader := strings.NewReader("content")
+			_, _ = reader.Seek(3, io.SeekStart)
+			err := sut.Files().Save(test.filePath, reader)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_FileBlob_Create(t *testing.T) {
+	// Arrange
+	sut, dbmock := getMockDb(t, nil)
+	defer sut.Close()
+
+	dbmock.ExpectBegin()
+	dbmock.ExpectExec("INSERT INTO file_blob \\(path, content, size, modified_at\\)").
+		WithArgs("backups/backup.zip", []byte("part 1, part 2"), 14, sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	dbmock.ExpectCommit()
+
+	// Act
+	writer, err := sut.Files().Create("backups/backup.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _ = writer.Write([]byte("part 1, "))
+	_, _ = writer.Write([]byte("part 2"))
+	err = writer.Close()
+
+	// Assert
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := writer.Close(); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("expected error: %v, received error: %v", fs.ErrClosed, err)
+	}
+	if err := dbmock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_FileBlob_Delete(t *testing.T) {
+	type testArgs struct {
+		rowsAffected  int64
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{1, nil, nil},
+		{0, nil, fs.ErrNotExist},
+		{0, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			exec := dbmock.ExpectExec("DELETE FROM file_blob WHERE path = \\$1").WithArgs("uploads/a.jpeg")
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(test.rowsAffected))
+			} else {
+				exec.WillReturnError(test.dbError)
+			}
+
+			// Act
+			err := sut.Files().Delete("uploads/a.jpeg")
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_FileBlob_DeleteAll(t *testing.T) {
+	type testArgs struct {
+		dirPath       string
+		expectedStmt  string
+		expectedArgs  []driver.Value
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"uploads/recipes/1", "DELETE FROM file_blob WHERE path = \\$1 OR substr\\(path, 1, \\$2\\) = \\$3", []driver.Value{"uploads/recipes/1", 18, "uploads/recipes/1/"}, nil, nil},
+		{"uploads/recettes/crème", "DELETE FROM file_blob WHERE path = \\$1 OR substr\\(path, 1, \\$2\\) = \\$3", []driver.Value{"uploads/recettes/crème", 23, "uploads/recettes/crème/"}, nil, nil},
+		{".", "DELETE FROM file_blob", []driver.Value{}, nil, nil},
+		{"../uploads", "", nil, nil, fs.ErrInvalid},
+		{"uploads", "DELETE FROM file_blob WHERE", []driver.Value{"uploads", 8, "uploads/"}, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			if test.expectedStmt != "" {
+				exec := dbmock.ExpectExec(test.expectedStmt).WithArgs(test.expectedArgs...)
+				if test.dbError == nil {
+					exec.WillReturnResult(driver.RowsAffected(1))
+				} else {
+					exec.WillReturnError(test.dbError)
+				}
+			}
+
+			// Act
+			err := sut.Files().DeleteAll(test.dirPath)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_FileBlob_Stat(t *testing.T) {
+	modifiedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	type testArgs struct {
+		name          string
+		path          string
+		fileRows      *sqlmock.Rows
+		dirCount      int
+		expectedDir   bool
+		expectedSize  int64
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name:         "File",
+			path:         "uploads/a.jpeg",
+			fileRows:     sqlmock.NewRows([]string{"path", "size", "modified_at"}).AddRow("uploads/a.jpeg", 10, modifiedAt),
+			expectedSize: 10,
+		},
+		{
+			name:        "Directory",
+			path:        "uploads",
+			fileRows:    sqlmock.NewRows([]string{"path", "size", "modified_at"}),
+			dirCount:    2,
+			expectedDir: true,
+		},
+		{
+			name:          "Missing",
+			path:          "uploads/b.jpeg",
+			fileRows:      sqlmock.NewRows([]string{"path", "size", "modified_at"}),
+			expectedError: fs.ErrNotExist,
+		},
+		{
+			name:        "Root",
+			path:        ".",
+			expectedDir: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			if test.fileRows != nil {
+				dbmock.ExpectQuery("SELECT path, size, modified_at FROM file_blob WHERE path = \\$1").
+					WithArgs(test.path).
+					WillReturnRows(test.fileRows)
+				if test.expectedSize == 0 {
+					dbmock.ExpectQuery("SELECT count\\(\\*\\) FROM file_blob WHERE substr\\(path, 1, \\$1\\) = \\$2").
+						WithArgs(len(test.path)+1, test.path+"/").
+						WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(test.dirCount))
+				}
+			}
+
+			// Act
+			info, err := sut.Files().Stat(test.path)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err == nil {
+				if info.IsDir() != test.expectedDir {
+					t.Errorf("expected dir: %v, received dir: %v", test.expectedDir, info.IsDir())
+				}
+				if info.Size() != test.expectedSize {
+					t.Errorf("expected size: %d, received size: %d", test.expectedSize, info.Size())
+				}
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_FileBlob_List(t *testing.T) {
+	modifiedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	type testArgs struct {
+		name          string
+		rows          *sqlmock.Rows
+		expectedNames []string
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name: "Files only",
+			rows: sqlmock.NewRows([]string{"path", "size", "modified_at"}).
+				AddRow("uploads/recipes/1/images/a.jpeg", 1, modifiedAt).
+				AddRow("uploads/recipes/1/notes.txt", 1, modifiedAt).
+				AddRow("uploads/recipes/1/thumbs/a.jpeg", 1, modifiedAt),
+			expectedNames: []string{"notes.txt"},
+		},
+		{
+			name:          "Missing",
+			rows:          sqlmock.NewRows([]string{"path", "size", "modified_at"}),
+			expectedError: fs.ErrNotExist,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectQuery("SELECT path, size, modified_at FROM file_blob WHERE substr\\(path, 1, \\$1\\) = \\$2 ORDER BY path").
+				WithArgs(18, "uploads/recipes/1/").
+				WillReturnRows(test.rows)
+
+			// Act
+			entries, err := sut.Files().List("uploads/recipes/1")
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			names := make([]string, 0)
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if err == nil && !slices.Equal(names, test.expectedNames) {
+				t.Errorf("expected names: %v, received names: %v", test.expectedNames, names)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_FileBlob_ReadDir(t *testing.T) {
+	// Arrange
+	sut, dbmock := getMockDb(t, nil)
+	defer sut.Close()
+
+	modifiedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	dbmock.ExpectQuery("SELECT path, size, modified_at FROM file_blob ORDER BY path").
+		WillReturnRows(sqlmock.NewRows([]string{"path", "size", "modified_at"}).
+			AddRow("backups/backup.zip", 1, modifiedAt).
+			AddRow("uploads/recipes/1/images/a.jpeg", 1, modifiedAt).
+			AddRow("uploads/recipes/2/images/b.jpeg", 1, modifiedAt))
+
+	// Act
+	entries, err := sut.files.ReadDir(".")
+
+	// Assert
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "backups" || !entries[0].IsDir() || entries[1].Name() != "uploads" || !entries[1].IsDir() {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+	if err := dbmock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_FileBlob_Open(t *testing.T) {
+	// Arrange
+	sut, dbmock := getMockDb(t, nil)
+	defer sut.Close()
+
+	content := strings.Repeat("x", fileBlobChunkSize) + "tail"
+	dbmock.ExpectQuery("SELECT path, size, modified_at FROM file_blob WHERE path = \\$1").
+		WithArgs("backups/backup.zip").
+		WillReturnRows(sqlmock.NewRows([]string{"path", "size", "modified_at"}).AddRow("backups/backup.zip", len(content), time.Now()))
+	dbmock.ExpectQuery("SELECT substr\\(content, \\$1, \\$2\\) FROM file_blob WHERE path = \\$3").
+		WithArgs(1, fileBlobChunkSize, "backups/backup.zip").
+		WillReturnRows(sqlmock.NewRows([]string{"content"}).AddRow([]byte(content[:fileBlobChunkSize])))
+	dbmock.ExpectQuery("SELECT substr\\(content, \\$1, \\$2\\) FROM file_blob WHERE path = \\$3").
+		WithArgs(fileBlobChunkSize+1, fileBlobChunkSize, "backups/backup.zip").
+		WillReturnRows(sqlmock.NewRows([]string{"content"}).AddRow([]byte("tail")))
+	dbmock.ExpectQuery("SELECT substr\\(content, \\$1, \\$2\\) FROM file_blob WHERE path = \\$3").
+		WithArgs(3, 2, "backups/backup.zip").
+		WillReturnRows(sqlmock.NewRows([]string{"content"}).AddRow([]byte("xx")))
+
+	// Act
+	file, err := sut.Files().Open("backups/backup.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer file.Close()
+	read, err := io.ReadAll(file)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	buf := make([]byte, 2)
+	n, err := file.(io.ReaderAt).ReadAt(buf, 2)
+
+	// Assert
+	if string(read) != content {
+		t.Errorf("expected %d bytes, received %d bytes", len(content), len(read))
+	}
+	if n != 2 || err != nil || string(buf) != "xx" {
+		t.Errorf("unexpected ReadAt result: %d, %v, %q", n, err, buf)
+	}
+	if err := dbmock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_Backup_ExportFileBlobs(t *testing.T) {
+	// Arrange
+	sut, dbmock := getMockDb(t, mockDriverAdapter{tableNames: []string{fileBlobTableName}})
+	defer sut.Close()
+
+	dbmock.ExpectBegin()
+	dbmock.ExpectQuery("SELECT \\* FROM file_blob WHERE NOT \\(substr\\(path, 1, 8\\) = 'backups/'\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"path", "content"}).AddRow("uploads/a.jpeg", []byte{0xff, 0xd8}))
+	dbmock.ExpectCommit()
+
+	// Act
+	backup, err := sut.Backups().Export(t.Context())
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*backup) != 1 || (*backup)[0].Data[0]["content"] != "/9g=" {
+		t.Errorf("unexpected backup: %v", *backup)
+	}
+	if err := dbmock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_Backup_ImportFileBlobs(t *testing.T) {
+	type testArgs struct {
+		name          string
+		content       any
+		expectedError bool
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", "/9g=", false},
+		{"Not base64", "not base64!", true},
+		{"Not a string", 42, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			if !test.expectedError {
+				dbmock.ExpectExec("DELETE FROM file_blob WHERE NOT \\(substr\\(path, 1, 8\\) = 'backups/'\\)").
+					WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectPrepare("INSERT INTO file_blob \\(content\\) VALUES \\(.*\\)").
+					WillBeClosed().
+					ExpectExec().
+					WithArgs([]byte{0xff, 0xd8}).
+					WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			backup := models.BackupData{{TableName: fileBlobTableName, Data: []models.RowData{{"content": test.content}}}}
+			err := sut.Backups().Import(t.Context(), &backup)
+
+			// Assert
+			if (err != nil) != test.expectedError {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
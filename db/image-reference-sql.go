@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type sqlImageReferenceDriverAdapter interface {
+	// LockImageContent prevents any other changes to the references to the content, by any instance
+	// using the database, until the returned function is called
+	LockImageContent(ctx context.Context, db *sqlx.DB, contentName string) (unlock func(), err error)
+}
+
+// sqlImageReferenceDriver is an implementation of fileaccess.ImageReferences that records the references in the database,
+// so that they're shared by every instance using it
+type sqlImageReferenceDriver struct {
+	Db      *sqlx.DB
+	adapter sqlImageReferenceDriverAdapter
+}
+
+func (d *sqlImageReferenceDriver) Lock(ctx context.Context, contentName string) (func(), error) {
+	return d.adapter.LockImageContent(ctx, d.Db, contentName)
+}
+
+func (d *sqlImageReferenceDriver) Add(ctx context.Context, contentName string, recipeID int64) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		_, err := db.ExecContext(ctx,
+			"INSERT INTO image_content_ref (content_name, recipe_id) VALUES ($1, $2) "+
+				"ON CONFLICT (content_name, recipe_id) DO NOTHING",
+			contentName, recipeID)
+		return err
+	})
+}
+
+func (d *sqlImageReferenceDriver) Remove(ctx context.Context, contentName string, recipeID int64) (int64, error) {
+	var remaining int64
+	err := tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		if _, err := db.ExecContext(ctx,
+			"DELETE FROM image_content_ref WHERE content_name = $1 AND recipe_id = $2", contentName, recipeID); err != nil {
+			return fmt.Errorf("deleting reference: %w", err)
+		}
+		if err := db.GetContext(ctx, &remaining,
+			"SELECT COUNT(*) FROM image_content_ref WHERE content_name = $1", contentName); err != nil {
+			return fmt.Errorf("counting remaining references: %w", err)
+		}
+		return nil
+	})
+	return remaining, err
+}
+
+func (d *sqlImageReferenceDriver) List(ctx context.Context) (map[string][]int64, error) {
+	var refs []struct {
+		ContentName string `db:"content_name"`
+		RecipeID    int64  `db:"recipe_id"`
+	}
+	if err := d.Db.SelectContext(ctx, &refs,
+		"SELECT content_name, recipe_id FROM image_content_ref ORDER BY content_name, recipe_id"); err != nil {
+		return nil, err
+	}
+
+	recipeIDs := make(map[string][]int64)
+	for _, ref := range refs {
+		recipeIDs[ref.ContentName] = append(recipeIDs[ref.ContentName], ref.RecipeID)
+	}
+	return recipeIDs, nil
+}
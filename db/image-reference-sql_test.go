@@ -0,0 +1,152 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func Test_ImageReference_Add(t *testing.T) {
+	type testArgs struct {
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{nil, nil},
+		{sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			exec := dbmock.ExpectExec("INSERT INTO image_content_ref \\(content_name, recipe_id\\) VALUES \\(\\$1, \\$2\\) "+
+				"ON CONFLICT \\(content_name, recipe_id\\) DO NOTHING").WithArgs("a.jpeg", 1)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.ImageReferences().Add(t.Context(), "a.jpeg", 1)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_ImageReference_Remove(t *testing.T) {
+	type testArgs struct {
+		remaining     int64
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{0, nil, nil},
+		{2, nil, nil},
+		{0, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			exec := dbmock.ExpectExec("DELETE FROM image_content_ref WHERE content_name = \\$1 AND recipe_id = \\$2").
+				WithArgs("a.jpeg", 1)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM image_content_ref WHERE content_name = \\$1").
+					WithArgs("a.jpeg").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(test.remaining))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			remaining, err := sut.ImageReferences().Remove(t.Context(), "a.jpeg", 1)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if remaining != test.remaining {
+				t.Errorf("expected remaining: %d, received: %d", test.remaining, remaining)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_ImageReference_List(t *testing.T) {
+	type testArgs struct {
+		rows          [][]driver.Value
+		dbError       error
+		expected      map[string][]int64
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{nil, nil, map[string][]int64{}, nil},
+		{[][]driver.Value{{"a.jpeg", 1}, {"a.jpeg", 3}, {"b.jpeg", 2}}, nil, map[string][]int64{"a.jpeg": {1, 3}, "b.jpeg": {2}}, nil},
+		{nil, sql.ErrConnDone, nil, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			query := dbmock.ExpectQuery("SELECT content_name, recipe_id FROM image_content_ref ORDER BY content_name, recipe_id")
+			if test.dbError == nil {
+				rows := sqlmock.NewRows([]string{"content_name", "recipe_id"})
+				for _, row := range test.rows {
+					rows.AddRow(row...)
+				}
+				query.WillReturnRows(rows)
+			} else {
+				query.WillReturnError(test.dbError)
+			}
+
+			// Act
+			result, err := sut.ImageReferences().List(t.Context())
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected: %v, received: %v", test.expected, result)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chadweimer/gomp/models"
+	"github.com/jmoiron/sqlx"
+)
+
+type sqlImageDriver struct {
+	Db *sqlx.DB
+}
+
+// imageNextSortOrderStmt selects the sort order that places an image after all other images of the recipe in $1
+const imageNextSortOrderStmt = "(SELECT COALESCE(MAX(sort_order) + 1, 0) FROM recipe_image WHERE recipe_id = $1)"
+
+func (d *sqlImageDriver) Create(ctx context.Context, recipeID int64, image *models.RecipeImage) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.createImpl(ctx, recipeID, image, db)
+	})
+}
+
+func (*sqlImageDriver) createImpl(ctx context.Context, recipeID int64, image *models.RecipeImage, db sqlx.ExecerContext) error {
+	stmt := "INSERT INTO recipe_image (recipe_id, name, caption, alt_text, sort_order, width, height, uploaded_by) " +
+		"VALUES ($1, $2, $3, $4, " + imageNextSortOrderStmt + ", $5, $6, $7) " +
+		"ON CONFLICT (recipe_id, name) DO UPDATE SET width = excluded.width, height = excluded.height"
+
+	_, err := db.ExecContext(ctx, stmt,
+		recipeID, image.Name, image.Caption, image.AltText, image.Width, image.Height, image.UploadedBy)
+	return err
+}
+
+func (d *sqlImageDriver) Update(ctx context.Context, recipeID int64, name string, info *models.RecipeImageInfo) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.updateImpl(ctx, recipeID, name, info, db)
+	})
+}
+
+func (*sqlImageDriver) updateImpl(ctx context.Context, recipeID int64, name string, info *models.RecipeImageInfo, db sqlx.ExecerContext) error {
+	stmt := "INSERT INTO recipe_image (recipe_id, name, caption, alt_text, sort_order) " +
+		"VALUES ($1, $2, $3, $4, " + imageNextSortOrderStmt + ") " +
+		"ON CONFLICT (recipe_id, name) DO UPDATE SET caption = excluded.caption, alt_text = excluded.alt_text"
+
+	_, err := db.ExecContext(ctx, stmt, recipeID, name, info.Caption, info.AltText)
+	return err
+}
+
+func (d *sqlImageDriver) Rename(ctx context.Context, recipeID int64, name, newName string) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.renameImpl(ctx, recipeID, name, newName, db)
+	})
+}
+
+func (*sqlImageDriver) renameImpl(ctx context.Context, recipeID int64, name, newName string, db sqlx.ExecerContext) error {
+	if name == newName {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx,
+		"UPDATE recipe_image SET name = $1 WHERE recipe_id = $2 AND name = $3 "+
+			"AND NOT EXISTS (SELECT 1 FROM recipe_image WHERE recipe_id = $2 AND name = $1)",
+		newName, recipeID, name)
+	if err != nil {
+		return fmt.Errorf("renaming image: %w", err)
+	}
+
+	// If the new name already had details, the old ones are no longer needed
+	if _, err := db.ExecContext(ctx, "DELETE FROM recipe_image WHERE recipe_id = $1 AND name = $2", recipeID, name); err != nil {
+		return fmt.Errorf("deleting replaced image details: %w", err)
+	}
+
+	// Keep the notes and steps that use the image pointing at it
+	if _, err := db.ExecContext(ctx,
+		"UPDATE recipe_note SET image_name = $1 WHERE recipe_id = $2 AND image_name = $3",
+		newName, recipeID, name); err != nil {
+		return fmt.Errorf("renaming note images: %w", err)
+	}
+	if _, err := db.ExecContext(ctx,
+		"UPDATE recipe_step SET image_name = $1 WHERE recipe_id = $2 AND image_name = $3",
+		newName, recipeID, name); err != nil {
+		return fmt.Errorf("renaming step images: %w", err)
+	}
+
+	return nil
+}
+
+func (d *sqlImageDriver) Delete(ctx context.Context, recipeID int64, name string) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.deleteImpl(ctx, recipeID, name, db)
+	})
+}
+
+func (*sqlImageDriver) deleteImpl(ctx context.Context, recipeID int64, name string, db sqlx.ExecerContext) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM recipe_image WHERE recipe_id = $1 AND name = $2", recipeID, name); err != nil {
+		return fmt.Errorf("deleting image details: %w", err)
+	}
+
+	// The notes and steps that used the image no longer have one
+	if _, err := db.ExecContext(ctx,
+		"UPDATE recipe_note SET image_name = NULL WHERE recipe_id = $1 AND image_name = $2",
+		recipeID, name); err != nil {
+		return fmt.Errorf("clearing note images: %w", err)
+	}
+	if _, err := db.ExecContext(ctx,
+		"UPDATE recipe_step SET image_name = NULL WHERE recipe_id = $1 AND image_name = $2",
+		recipeID, name); err != nil {
+		return fmt.Errorf("clearing step images: %w", err)
+	}
+
+	return nil
+}
+
+func (d *sqlImageDriver) Reorder(ctx context.Context, recipeID int64, names []string) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.reorderImpl(ctx, recipeID, names, db)
+	})
+}
+
+func (*sqlImageDriver) reorderImpl(ctx context.Context, recipeID int64, names []string, db sqlx.ExecerContext) error {
+	stmt := "INSERT INTO recipe_image (recipe_id, name, sort_order) VALUES ($1, $2, $3) " +
+		"ON CONFLICT (recipe_id, name) DO UPDATE SET sort_order = excluded.sort_order"
+	for i, name := range names {
+		if _, err := db.ExecContext(ctx, stmt, recipeID, name, i); err != nil {
+			return fmt.Errorf("ordering image '%s': %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *sqlImageDriver) List(ctx context.Context, recipeID int64) (*[]models.RecipeImage, error) {
+	return get(d.Db, func(db sqlx.QueryerContext) (*[]models.RecipeImage, error) {
+		images := make([]models.RecipeImage, 0)
+
+		selectStmt := "SELECT name, caption, alt_text, sort_order, width, height, uploaded_by, created_at " +
+			"FROM recipe_image WHERE recipe_id = $1 ORDER BY sort_order, created_at, name"
+		if err := sqlx.SelectContext(ctx, db, &images, selectStmt, recipeID); err != nil {
+			return nil, err
+		}
+
+		return &images, nil
+	})
+}
@@ -0,0 +1,325 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chadweimer/gomp/models"
+)
+
+func Test_Image_Create(t *testing.T) {
+	type testArgs struct {
+		recipeID      int64
+		image         models.RecipeImage
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{1, models.RecipeImage{Name: "a.jpeg", Width: new(640), Height: new(480), UploadedBy: new(int64(2))}, nil, nil},
+		{1, models.RecipeImage{Name: "a.jpeg"}, nil, nil},
+		{0, models.RecipeImage{Name: "a.jpeg"}, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			exec := dbmock.ExpectExec("INSERT INTO recipe_image \\(recipe_id, name, caption, alt_text, sort_order, width, height, uploaded_by\\) "+
+				"VALUES \\(\\$1, \\$2, \\$3, \\$4, \\(SELECT COALESCE\\(MAX\\(sort_order\\) \\+ 1, 0\\) FROM recipe_image WHERE recipe_id = \\$1\\), \\$5, \\$6, \\$7\\) "+
+				"ON CONFLICT \\(recipe_id, name\\) DO UPDATE SET width = excluded\\.width, height = excluded\\.height").
+				WithArgs(test.recipeID, test.image.Name, "", "", test.image.Width, test.image.Height, test.image.UploadedBy)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Images().Create(t.Context(), test.recipeID, &test.image)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Image_Update(t *testing.T) {
+	type testArgs struct {
+		recipeID      int64
+		name          string
+		info          models.RecipeImageInfo
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{1, "a.jpeg", models.RecipeImageInfo{Caption: "Caption", AltText: "Alt"}, nil, nil},
+		{1, "a.jpeg", models.RecipeImageInfo{}, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			exec := dbmock.ExpectExec("INSERT INTO recipe_image \\(recipe_id, name, caption, alt_text, sort_order\\) "+
+				"VALUES \\(\\$1, \\$2, \\$3, \\$4, \\(SELECT COALESCE\\(MAX\\(sort_order\\) \\+ 1, 0\\) FROM recipe_image WHERE recipe_id = \\$1\\)\\) "+
+				"ON CONFLICT \\(recipe_id, name\\) DO UPDATE SET caption = excluded\\.caption, alt_text = excluded\\.alt_text").
+				WithArgs(test.recipeID, test.name, test.info.Caption, test.info.AltText)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Images().Update(t.Context(), test.recipeID, test.name, &test.info)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Image_Rename(t *testing.T) {
+	type testArgs struct {
+		name          string
+		newName       string
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"a.png", "b.jpeg", nil, nil},
+		{"a.jpeg", "a.jpeg", nil, nil},
+		{"a.png", "b.jpeg", sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			if test.name == test.newName {
+				dbmock.ExpectCommit()
+			} else {
+				exec := dbmock.ExpectExec("UPDATE recipe_image SET name = \\$1 WHERE recipe_id = \\$2 AND name = \\$3 "+
+					"AND NOT EXISTS \\(SELECT 1 FROM recipe_image WHERE recipe_id = \\$2 AND name = \\$1\\)").
+					WithArgs(test.newName, 1, test.name)
+				if test.dbError == nil {
+					exec.WillReturnResult(driver.RowsAffected(1))
+					dbmock.ExpectExec("DELETE FROM recipe_image WHERE recipe_id = \\$1 AND name = \\$2").
+						WithArgs(1, test.name).WillReturnResult(driver.RowsAffected(0))
+					dbmock.ExpectExec("UPDATE recipe_note SET image_name = \\$1 WHERE recipe_id = \\$2 AND image_name = \\$3").
+						WithArgs(test.newName, 1, test.name).WillReturnResult(driver.RowsAffected(1))
+					dbmock.ExpectExec("UPDATE recipe_step SET image_name = \\$1 WHERE recipe_id = \\$2 AND image_name = \\$3").
+						WithArgs(test.newName, 1, test.name).WillReturnResult(driver.RowsAffected(2))
+					dbmock.ExpectCommit()
+				} else {
+					exec.WillReturnError(test.dbError)
+					dbmock.ExpectRollback()
+				}
+			}
+
+			// Act
+			err := sut.Images().Rename(t.Context(), 1, test.name, test.newName)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Image_Delete(t *testing.T) {
+	type testArgs struct {
+		deleteError   error
+		noteError     error
+		stepError     error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{nil, nil, nil, nil},
+		{sql.ErrConnDone, nil, nil, sql.ErrConnDone},
+		{nil, sql.ErrConnDone, nil, sql.ErrConnDone},
+		{nil, nil, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			execs := []struct {
+				query string
+				err   error
+			}{
+				{"DELETE FROM recipe_image WHERE recipe_id = \\$1 AND name = \\$2", test.deleteError},
+				{"UPDATE recipe_note SET image_name = NULL WHERE recipe_id = \\$1 AND image_name = \\$2", test.noteError},
+				{"UPDATE recipe_step SET image_name = NULL WHERE recipe_id = \\$1 AND image_name = \\$2", test.stepError},
+			}
+			for _, e := range execs {
+				exec := dbmock.ExpectExec(e.query).WithArgs(1, "a.jpeg")
+				if e.err != nil {
+					exec.WillReturnError(e.err)
+					break
+				}
+				exec.WillReturnResult(driver.RowsAffected(1))
+			}
+			if test.expectedError == nil {
+				dbmock.ExpectCommit()
+			} else {
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Images().Delete(t.Context(), 1, "a.jpeg")
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Image_Reorder(t *testing.T) {
+	type testArgs struct {
+		names         []string
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{[]string{"b.jpeg", "a.jpeg", "c.jpeg"}, nil, nil},
+		{[]string{}, nil, nil},
+		{[]string{"b.jpeg", "a.jpeg"}, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			for i, name := range test.names {
+				exec := dbmock.ExpectExec("INSERT INTO recipe_image \\(recipe_id, name, sort_order\\) VALUES \\(\\$1, \\$2, \\$3\\) "+
+					"ON CONFLICT \\(recipe_id, name\\) DO UPDATE SET sort_order = excluded\\.sort_order").
+					WithArgs(1, name, i)
+				if test.dbError != nil {
+					exec.WillReturnError(test.dbError)
+					break
+				}
+				exec.WillReturnResult(driver.RowsAffected(1))
+			}
+			if test.dbError == nil {
+				dbmock.ExpectCommit()
+			} else {
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Images().Reorder(t.Context(), 1, test.names)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Image_List(t *testing.T) {
+	type testArgs struct {
+		expected      []models.RecipeImage
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	now := time.Now()
+	tests := []testArgs{
+		{
+			expected: []models.RecipeImage{
+				{Name: "b.jpeg", Caption: "Caption", AltText: "Alt", SortOrder: new(0), Width: new(640), Height: new(480), UploadedBy: new(int64(2)), CreatedAt: &now},
+				{Name: "a.jpeg", SortOrder: new(1), CreatedAt: &now},
+			},
+		},
+		{expected: []models.RecipeImage{}},
+		{dbError: sql.ErrConnDone, expectedError: sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			query := dbmock.ExpectQuery("SELECT name, caption, alt_text, sort_order, width, height, uploaded_by, created_at " +
+				"FROM recipe_image WHERE recipe_id = \\$1 ORDER BY sort_order, created_at, name").WithArgs(1)
+			if test.dbError == nil {
+				rows := sqlmock.NewRows([]string{"name", "caption", "alt_text", "sort_order", "width", "height", "uploaded_by", "created_at"})
+				for _, image := range test.expected {
+					rows.AddRow(image.Name, image.Caption, image.AltText, *image.SortOrder, image.Width, image.Height, image.UploadedBy, *image.CreatedAt)
+				}
+				query.WillReturnRows(rows)
+			} else {
+				query.WillReturnError(test.dbError)
+			}
+
+			// Act
+			result, err := sut.Images().List(t.Context(), 1)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			} else if err == nil && !reflect.DeepEqual(*result, test.expected) {
+				t.Errorf("expected images: %v, received: %v", test.expected, *result)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
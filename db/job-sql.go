@@ -0,0 +1,222 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/chadweimer/gomp/models"
+	"github.com/jmoiron/sqlx"
+)
+
+const jobTableName = "job"
+
+// backupJobExclusion is the condition for the jobs that are excluded from backups, and left alone when restoring from one,
+// which is all of them. Jobs only make sense for the data they were created for, and restoring is itself a job.
+const backupJobExclusion = "1 = 1"
+
+type sqlJobDriver struct {
+	Db *sqlx.DB
+}
+
+const jobColumnsStmt = "id, kind, state, progress, attempts, max_attempts, error, result, created_by, created_at, started_at, finished_at"
+
+func (d *sqlJobDriver) Create(ctx context.Context, job *JobWithInput) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.createImpl(ctx, job, db)
+	})
+}
+
+func (*sqlJobDriver) createImpl(ctx context.Context, job *JobWithInput, db sqlx.QueryerContext) error {
+	stmt := "INSERT INTO job (kind, payload, data, max_attempts, created_by) " +
+		"VALUES ($1, $2, $3, $4, $5) RETURNING " + jobColumnsStmt
+
+	return sqlx.GetContext(ctx, db, &job.Job, stmt, job.Kind, job.Payload, job.Data, job.MaxAttempts, job.CreatedBy)
+}
+
+func (d *sqlJobDriver) Read(ctx context.Context, id int64) (*models.Job, error) {
+	return get(d.Db, func(db sqlx.QueryerContext) (*models.Job, error) {
+		job := new(models.Job)
+		if err := sqlx.GetContext(ctx, db, job, "SELECT "+jobColumnsStmt+" FROM job WHERE id = $1", id); err != nil {
+			return nil, err
+		}
+
+		return job, nil
+	})
+}
+
+func (d *sqlJobDriver) List(ctx context.Context) (*[]models.Job, error) {
+	return get(d.Db, func(db sqlx.QueryerContext) (*[]models.Job, error) {
+		jobs := make([]models.Job, 0)
+
+		if err := sqlx.SelectContext(ctx, db, &jobs, "SELECT "+jobColumnsStmt+" FROM job ORDER BY id DESC"); err != nil {
+			return nil, err
+		}
+
+		return &jobs, nil
+	})
+}
+
+func (d *sqlJobDriver) Delete(ctx context.Context, id int64) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.deleteImpl(ctx, id, db)
+	})
+}
+
+func (*sqlJobDriver) deleteImpl(ctx context.Context, id int64, db sqlx.ExtContext) error {
+	// The state is checked as part of the delete, in case a worker claims the job in the meantime
+	result, err := db.ExecContext(ctx, "DELETE FROM job WHERE id = $1 AND state <> 'running'", id)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	// Nothing was deleted, either because the job is running or because it doesn't exist
+	var exists bool
+	if err := sqlx.GetContext(ctx, db, &exists, "SELECT EXISTS (SELECT 1 FROM job WHERE id = $1)", id); err != nil {
+		return err
+	}
+	if exists {
+		return ErrJobRunning
+	}
+	return ErrNotFound
+}
+
+func (d *sqlJobDriver) Claim(ctx context.Context, now time.Time) (*JobWithInput, error) {
+	var job *JobWithInput
+	err := tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		var err error
+		job, err = d.claimImpl(ctx, now, db)
+		return err
+	})
+	return job, err
+}
+
+func (*sqlJobDriver) claimImpl(ctx context.Context, now time.Time, db sqlx.QueryerContext) (*JobWithInput, error) {
+	// The state is checked again, in case another worker claims the same job first
+	stmt := "UPDATE job SET state = 'running', attempts = attempts + 1, started_at = CURRENT_TIMESTAMP, heartbeat_at = $1 " +
+		"WHERE id = (SELECT id FROM job WHERE state = 'pending' AND (run_after IS NULL OR run_after <= $1) ORDER BY id LIMIT 1) " +
+		"AND state = 'pending' " +
+		"RETURNING " + jobColumnsStmt + ", payload, data"
+
+	job := new(JobWithInput)
+	if err := sqlx.GetContext(ctx, db, job, stmt, now); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (d *sqlJobDriver) Heartbeat(ctx context.Context, id int64, attempt int, now time.Time) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.heartbeatImpl(ctx, id, attempt, now, db)
+	})
+}
+
+func (*sqlJobDriver) heartbeatImpl(ctx context.Context, id int64, attempt int, now time.Time, db sqlx.ExecerContext) error {
+	// The attempt is checked along with the state for every change to a running job, so that an attempt that was requeued,
+	// e.g., because its instance stopped reporting heartbeats, can't change the job once it runs again elsewhere
+	_, err := db.ExecContext(ctx,
+		"UPDATE job SET heartbeat_at = $1 WHERE id = $2 AND attempts = $3 AND state = 'running'",
+		now, id, attempt)
+	return err
+}
+
+func (d *sqlJobDriver) UpdateProgress(ctx context.Context, id int64, attempt int, progress int) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.updateProgressImpl(ctx, id, attempt, progress, db)
+	})
+}
+
+func (*sqlJobDriver) updateProgressImpl(ctx context.Context, id int64, attempt int, progress int, db sqlx.ExecerContext) error {
+	_, err := db.ExecContext(ctx,
+		"UPDATE job SET progress = $1 WHERE id = $2 AND attempts = $3 AND state = 'running'",
+		progress, id, attempt)
+	return err
+}
+
+func (d *sqlJobDriver) Complete(ctx context.Context, id int64, attempt int, result string) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.completeImpl(ctx, id, attempt, result, db)
+	})
+}
+
+func (*sqlJobDriver) completeImpl(ctx context.Context, id int64, attempt int, result string, db sqlx.ExecerContext) error {
+	_, err := db.ExecContext(ctx,
+		"UPDATE job SET state = 'succeeded', progress = 100, result = $1, error = NULL, data = NULL, finished_at = CURRENT_TIMESTAMP "+
+			"WHERE id = $2 AND attempts = $3 AND state = 'running'",
+		result, id, attempt)
+	return err
+}
+
+func (d *sqlJobDriver) Fail(ctx context.Context, id int64, attempt int, message string, retryAt *time.Time) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.failImpl(ctx, id, attempt, message, retryAt, db)
+	})
+}
+
+func (*sqlJobDriver) failImpl(ctx context.Context, id int64, attempt int, message string, retryAt *time.Time, db sqlx.ExecerContext) error {
+	if retryAt != nil {
+		_, err := db.ExecContext(ctx,
+			"UPDATE job SET state = 'pending', progress = 0, error = $1, run_after = $2 "+
+				"WHERE id = $3 AND attempts = $4 AND state = 'running'",
+			message, *retryAt, id, attempt)
+		return err
+	}
+
+	_, err := db.ExecContext(ctx,
+		"UPDATE job SET state = 'failed', error = $1, data = NULL, finished_at = CURRENT_TIMESTAMP "+
+			"WHERE id = $2 AND attempts = $3 AND state = 'running'",
+		message, id, attempt)
+	return err
+}
+
+func (d *sqlJobDriver) Requeue(ctx context.Context, staleBefore time.Time, message string) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.requeueImpl(ctx, staleBefore, message, db)
+	})
+}
+
+func (*sqlJobDriver) requeueImpl(ctx context.Context, staleBefore time.Time, message string, db sqlx.ExecerContext) error {
+	// Only jobs that stopped reporting heartbeats are touched, as the rest are still running somewhere.
+	// Jobs that were interrupted on their last attempt won't be started again...
+	_, err := db.ExecContext(ctx,
+		"UPDATE job SET state = 'failed', error = $1, data = NULL, finished_at = CURRENT_TIMESTAMP "+
+			"WHERE state = 'running' AND (heartbeat_at IS NULL OR heartbeat_at < $2) AND attempts >= max_attempts",
+		message, staleBefore)
+	if err != nil {
+		return err
+	}
+
+	// ... but the rest will
+	_, err = db.ExecContext(ctx,
+		"UPDATE job SET state = 'pending', progress = 0, error = $1 "+
+			"WHERE state = 'running' AND (heartbeat_at IS NULL OR heartbeat_at < $2)",
+		message, staleBefore)
+	return err
+}
+
+func (d *sqlJobDriver) Prune(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	var pruned int64
+	err := tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		var err error
+		pruned, err = d.pruneImpl(ctx, finishedBefore, db)
+		return err
+	})
+	return pruned, err
+}
+
+func (*sqlJobDriver) pruneImpl(ctx context.Context, finishedBefore time.Time, db sqlx.ExecerContext) (int64, error) {
+	result, err := db.ExecContext(ctx,
+		"DELETE FROM job WHERE state IN ('succeeded', 'failed') AND finished_at < $1",
+		finishedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
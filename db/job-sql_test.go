@@ -0,0 +1,601 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chadweimer/gomp/models"
+)
+
+var jobColumns = []string{"id", "kind", "state", "progress", "attempts", "max_attempts", "error", "result", "created_by", "created_at", "started_at", "finished_at"}
+
+func Test_Job_Create(t *testing.T) {
+	type testArgs struct {
+		data          []byte
+		createdBy     *int64
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{[]byte{0xff, 0xd8}, new(int64(2)), nil, nil},
+		{nil, nil, nil, nil},
+		{nil, nil, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			job := &JobWithInput{
+				Job:     models.Job{Kind: models.JobUploadImage, MaxAttempts: 3, CreatedBy: test.createdBy},
+				Payload: `{"recipeId":1}`,
+				Data:    test.data,
+			}
+			expectedID := rand.Int63()
+
+			dbmock.ExpectBegin()
+			query := dbmock.ExpectQuery("INSERT INTO job \\(kind, payload, data, max_attempts, created_by\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5\\) RETURNING id, kind, state, (.+)").
+				WithArgs(job.Kind, job.Payload, job.Data, job.MaxAttempts, job.CreatedBy)
+			if test.dbError == nil {
+				query.WillReturnRows(sqlmock.NewRows(jobColumns).
+					AddRow(expectedID, job.Kind, models.JobPending, 0, 0, 3, nil, nil, test.createdBy, time.Now(), nil, nil))
+				dbmock.ExpectCommit()
+			} else {
+				query.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Jobs().Create(t.Context(), job)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+			if test.expectedError == nil {
+				if *job.ID != expectedID {
+					t.Errorf("expected job id %d, received %d", expectedID, *job.ID)
+				}
+				if job.State != models.JobPending {
+					t.Errorf("expected job state %s, received %s", models.JobPending, job.State)
+				}
+			}
+		})
+	}
+}
+
+func Test_Job_Read(t *testing.T) {
+	type testArgs struct {
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{nil, nil},
+		{sql.ErrNoRows, ErrNotFound},
+		{sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			now := time.Now()
+			expected := models.Job{
+				ID:          new(int64(1)),
+				Kind:        models.JobCreateBackup,
+				State:       models.JobFailed,
+				Progress:    25,
+				Attempts:    3,
+				MaxAttempts: 3,
+				Error:       new("disk full"),
+				CreatedBy:   new(int64(2)),
+				CreatedAt:   &now,
+				StartedAt:   &now,
+				FinishedAt:  &now,
+			}
+
+			query := dbmock.ExpectQuery("SELECT id, kind, state, (.+) FROM job WHERE id = \\$1").WithArgs(1)
+			if test.dbError == nil {
+				query.WillReturnRows(sqlmock.NewRows(jobColumns).
+					AddRow(*expected.ID, expected.Kind, expected.State, expected.Progress, expected.Attempts, expected.MaxAttempts,
+						*expected.Error, nil, *expected.CreatedBy, now, now, now))
+			} else {
+				query.WillReturnError(test.dbError)
+			}
+
+			// Act
+			job, err := sut.Jobs().Read(t.Context(), 1)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			} else if err == nil && !reflect.DeepEqual(*job, expected) {
+				t.Errorf("expected job: %v, received: %v", expected, *job)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Job_List(t *testing.T) {
+	type testArgs struct {
+		ids           []int64
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{[]int64{2, 1}, nil, nil},
+		{[]int64{}, nil, nil},
+		{nil, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			query := dbmock.ExpectQuery("SELECT id, kind, state, (.+) FROM job ORDER BY id DESC")
+			if test.dbError == nil {
+				rows := sqlmock.NewRows(jobColumns)
+				for _, id := range test.ids {
+					rows.AddRow(id, models.JobOptimizeImage, models.JobSucceeded, 100, 1, 3, nil, "/uploads/a.jpeg", nil, time.Now(), nil, nil)
+				}
+				query.WillReturnRows(rows)
+			} else {
+				query.WillReturnError(test.dbError)
+			}
+
+			// Act
+			jobs, err := sut.Jobs().List(t.Context())
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			} else if err == nil {
+				if len(*jobs) != len(test.ids) {
+					t.Fatalf("expected %d jobs, received %d", len(test.ids), len(*jobs))
+				}
+				for i, id := range test.ids {
+					if *(*jobs)[i].ID != id {
+						t.Errorf("expected job id %d at index %d, received %d", id, i, *(*jobs)[i].ID)
+					}
+				}
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Job_Delete(t *testing.T) {
+	type testArgs struct {
+		rowsAffected  int64
+		exists        bool
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{1, true, nil, nil},
+		{0, true, nil, ErrJobRunning},
+		{0, false, nil, ErrNotFound},
+		{0, false, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			exec := dbmock.ExpectExec("DELETE FROM job WHERE id = \\$1 AND state <> 'running'").WithArgs(1)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(test.rowsAffected))
+				if test.rowsAffected == 0 {
+					dbmock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM job WHERE id = \\$1\\)").WithArgs(1).
+						WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(test.exists))
+				}
+			} else {
+				exec.WillReturnError(test.dbError)
+			}
+			if test.expectedError == nil {
+				dbmock.ExpectCommit()
+			} else {
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Jobs().Delete(t.Context(), 1)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Job_Claim(t *testing.T) {
+	type testArgs struct {
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{nil, nil},
+		{sql.ErrNoRows, ErrNotFound},
+		{sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			now := time.Now()
+			dbmock.ExpectBegin()
+			query := dbmock.ExpectQuery("UPDATE job SET state = 'running', attempts = attempts \\+ 1, started_at = CURRENT_TIMESTAMP, heartbeat_at = \\$1 " +
+				"WHERE id = \\(SELECT id FROM job WHERE state = 'pending' AND \\(run_after IS NULL OR run_after <= \\$1\\) ORDER BY id LIMIT 1\\) " +
+				"AND state = 'pending' RETURNING id, kind, state, (.+), payload, data").
+				WithArgs(now)
+			if test.dbError == nil {
+				query.WillReturnRows(sqlmock.NewRows(append(jobColumns, "payload", "data")).
+					AddRow(5, models.JobUploadImage, models.JobRunning, 0, 1, 3, nil, nil, nil, now, now, nil, `{"recipeId":1}`, []byte{0xff, 0xd8}))
+				dbmock.ExpectCommit()
+			} else {
+				query.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			job, err := sut.Jobs().Claim(t.Context(), now)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			} else if err == nil {
+				if *job.ID != 5 || job.State != models.JobRunning || job.Attempts != 1 {
+					t.Errorf("unexpected job: %v", job.Job)
+				}
+				if job.Payload != `{"recipeId":1}` || !reflect.DeepEqual(job.Data, []byte{0xff, 0xd8}) {
+					t.Errorf("unexpected job input: %s, %v", job.Payload, job.Data)
+				}
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Job_Heartbeat(t *testing.T) {
+	type testArgs struct {
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{nil, nil},
+		{sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			now := time.Now()
+			dbmock.ExpectBegin()
+			exec := dbmock.ExpectExec("UPDATE job SET heartbeat_at = \\$1 WHERE id = \\$2 AND attempts = \\$3 AND state = 'running'").
+				WithArgs(now, 1, 2)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Jobs().Heartbeat(t.Context(), 1, 2, now)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Job_UpdateProgress(t *testing.T) {
+	type testArgs struct {
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{nil, nil},
+		{sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			exec := dbmock.ExpectExec("UPDATE job SET progress = \\$1 WHERE id = \\$2 AND attempts = \\$3 AND state = 'running'").WithArgs(50, 1, 2)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Jobs().UpdateProgress(t.Context(), 1, 2, 50)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Job_Complete(t *testing.T) {
+	type testArgs struct {
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{nil, nil},
+		{sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			exec := dbmock.ExpectExec("UPDATE job SET state = 'succeeded', progress = 100, result = \\$1, error = NULL, data = NULL, finished_at = CURRENT_TIMESTAMP "+
+				"WHERE id = \\$2 AND attempts = \\$3 AND state = 'running'").
+				WithArgs("/uploads/a.jpeg", 1, 2)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Jobs().Complete(t.Context(), 1, 2, "/uploads/a.jpeg")
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Job_Fail(t *testing.T) {
+	type testArgs struct {
+		retryAt       *time.Time
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	now := time.Now()
+	tests := []testArgs{
+		{&now, nil, nil},
+		{nil, nil, nil},
+		{&now, sql.ErrConnDone, sql.ErrConnDone},
+		{nil, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			var exec *sqlmock.ExpectedExec
+			if test.retryAt != nil {
+				exec = dbmock.ExpectExec("UPDATE job SET state = 'pending', progress = 0, error = \\$1, run_after = \\$2 "+
+					"WHERE id = \\$3 AND attempts = \\$4 AND state = 'running'").
+					WithArgs("oops", *test.retryAt, 1, 2)
+			} else {
+				exec = dbmock.ExpectExec("UPDATE job SET state = 'failed', error = \\$1, data = NULL, finished_at = CURRENT_TIMESTAMP "+
+					"WHERE id = \\$2 AND attempts = \\$3 AND state = 'running'").
+					WithArgs("oops", 1, 2)
+			}
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Jobs().Fail(t.Context(), 1, 2, "oops", test.retryAt)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Job_Requeue(t *testing.T) {
+	type testArgs struct {
+		failError     error
+		requeueError  error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{nil, nil, nil},
+		{sql.ErrConnDone, nil, sql.ErrConnDone},
+		{nil, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			staleBefore := time.Now()
+			dbmock.ExpectBegin()
+			exec := dbmock.ExpectExec("UPDATE job SET state = 'failed', error = \\$1, data = NULL, finished_at = CURRENT_TIMESTAMP "+
+				"WHERE state = 'running' AND \\(heartbeat_at IS NULL OR heartbeat_at < \\$2\\) AND attempts >= max_attempts").
+				WithArgs("interrupted", staleBefore)
+			if test.failError != nil {
+				exec.WillReturnError(test.failError)
+				dbmock.ExpectRollback()
+			} else {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				exec = dbmock.ExpectExec("UPDATE job SET state = 'pending', progress = 0, error = \\$1 "+
+					"WHERE state = 'running' AND \\(heartbeat_at IS NULL OR heartbeat_at < \\$2\\)").
+					WithArgs("interrupted", staleBefore)
+				if test.requeueError != nil {
+					exec.WillReturnError(test.requeueError)
+					dbmock.ExpectRollback()
+				} else {
+					exec.WillReturnResult(driver.RowsAffected(2))
+					dbmock.ExpectCommit()
+				}
+			}
+
+			// Act
+			err := sut.Jobs().Requeue(t.Context(), staleBefore, "interrupted")
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Job_Prune(t *testing.T) {
+	type testArgs struct {
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{nil, nil},
+		{sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			finishedBefore := time.Now()
+			dbmock.ExpectBegin()
+			exec := dbmock.ExpectExec("DELETE FROM job WHERE state IN \\('succeeded', 'failed'\\) AND finished_at < \\$1").
+				WithArgs(finishedBefore)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(3))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			pruned, err := sut.Jobs().Prune(t.Context(), finishedBefore)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			} else if err == nil && pruned != 3 {
+				t.Errorf("expected 3 jobs to be pruned, received %d", pruned)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Backup_ExportJobs(t *testing.T) {
+	// Arrange
+	sut, dbmock := getMockDb(t, mockDriverAdapter{tableNames: []string{jobTableName}})
+	defer sut.Close()
+
+	dbmock.ExpectBegin()
+	dbmock.ExpectQuery("SELECT \\* FROM job WHERE NOT \\(1 = 1\\)").
+		WillReturnRows(sqlmock.NewRows(jobColumns))
+	dbmock.ExpectCommit()
+
+	// Act
+	backup, err := sut.Backups().Export(t.Context())
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*backup) != 1 || len((*backup)[0].Data) != 0 {
+		t.Errorf("unexpected backup: %v", *backup)
+	}
+	if err := dbmock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
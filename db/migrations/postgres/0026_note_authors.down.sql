@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX recipe_note_parent_id_idx;
+
+ALTER TABLE recipe_note
+DROP COLUMN parent_id,
+DROP COLUMN image_name,
+DROP COLUMN created_by,
+DROP COLUMN modified_by;
+
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+-- Postgres can't remove a value from an enum, so recreate the type without it
+UPDATE search_filter SET sort_by = 'name' WHERE sort_by = 'relevance';
+
+ALTER TYPE recipe_sort_by RENAME TO recipe_sort_by_old;
+CREATE TYPE recipe_sort_by AS ENUM ('id', 'name', 'created', 'modified', 'rating', 'random');
+
+ALTER TABLE search_filter
+ALTER COLUMN sort_by TYPE recipe_sort_by USING sort_by::text::recipe_sort_by;
+
+DROP TYPE recipe_sort_by_old;
+
+COMMIT;
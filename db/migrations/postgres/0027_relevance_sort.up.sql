@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TYPE recipe_sort_by ADD VALUE 'relevance';
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+DELETE FROM search_filter_tag WHERE excluded = TRUE;
+
+ALTER TABLE search_filter_tag
+DROP COLUMN excluded;
+
+ALTER TABLE search_filter
+DROP COLUMN tag_match;
+
+DROP TYPE recipe_tag_match;
+
+COMMIT;
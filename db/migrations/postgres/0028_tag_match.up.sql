@@ -0,0 +1,11 @@
+BEGIN;
+
+CREATE TYPE recipe_tag_match AS ENUM ('any', 'all');
+
+ALTER TABLE search_filter
+ADD COLUMN tag_match recipe_tag_match NOT NULL DEFAULT 'any';
+
+ALTER TABLE search_filter_tag
+ADD COLUMN excluded BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+
+-- Drop the whitespace around tags, along with any tags that were only whitespace
+UPDATE recipe_tag SET tag = btrim(tag, E' \t\n\r');
+DELETE FROM recipe_tag WHERE tag = '';
+
+ALTER TABLE recipe_tag
+ADD COLUMN tag_key TEXT;
+UPDATE recipe_tag SET tag_key = lower(tag);
+ALTER TABLE recipe_tag
+ALTER COLUMN tag_key SET NOT NULL;
+
+-- Keep only the first of any tags on the same recipe that differ only by case
+DELETE FROM recipe_tag AS a
+USING recipe_tag AS b
+WHERE a.recipe_id = b.recipe_id AND a.tag_key = b.tag_key AND a.ctid > b.ctid;
+
+CREATE UNIQUE INDEX recipe_tag_recipe_id_tag_key_idx ON recipe_tag(recipe_id, tag_key);
+CREATE INDEX recipe_tag_tag_key_idx ON recipe_tag(tag_key);
+
+COMMIT;
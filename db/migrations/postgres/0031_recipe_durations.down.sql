@@ -0,0 +1,32 @@
+BEGIN;
+
+-- Postgres can't remove a value from an enum, so recreate the type without it
+UPDATE search_filter SET sort_by = 'name' WHERE sort_by = 'total_time';
+
+ALTER TYPE recipe_sort_by RENAME TO recipe_sort_by_old;
+CREATE TYPE recipe_sort_by AS ENUM ('id', 'name', 'created', 'modified', 'rating', 'random', 'relevance');
+
+ALTER TABLE search_filter
+ALTER COLUMN sort_by TYPE recipe_sort_by USING sort_by::text::recipe_sort_by;
+
+DROP TYPE recipe_sort_by_old;
+
+ALTER TABLE search_filter
+DROP COLUMN max_total_time;
+
+DROP TRIGGER on_recipe_update ON recipe;
+CREATE TRIGGER on_recipe_update
+    AFTER UPDATE ON recipe
+    FOR EACH ROW
+    WHEN (OLD.* IS DISTINCT FROM NEW.*)
+    EXECUTE FUNCTION on_recipe_update();
+
+DROP INDEX recipe_total_time_idx;
+
+ALTER TABLE recipe
+DROP COLUMN prep_time,
+DROP COLUMN cook_time,
+DROP COLUMN active_time,
+DROP COLUMN total_time;
+
+COMMIT;
@@ -0,0 +1,26 @@
+BEGIN;
+
+-- Stored as a number of seconds
+ALTER TABLE recipe
+ADD COLUMN prep_time BIGINT,
+ADD COLUMN cook_time BIGINT,
+ADD COLUMN active_time BIGINT,
+ADD COLUMN total_time BIGINT;
+
+CREATE INDEX recipe_total_time_idx ON recipe(total_time);
+
+-- The durations of existing recipes are filled in from their free-form time when the database is opened,
+-- which shouldn't mark every recipe as modified, so updates that only set the durations leave the modified date alone
+DROP TRIGGER on_recipe_update ON recipe;
+CREATE TRIGGER on_recipe_update
+    AFTER UPDATE OF name, serving_size, nutrition_info, ingredients, directions, storage_instructions, source_url, recipe_time, current_state, main_image_name ON recipe
+    FOR EACH ROW
+    WHEN (OLD.* IS DISTINCT FROM NEW.*)
+    EXECUTE FUNCTION on_recipe_update();
+
+ALTER TABLE search_filter
+ADD COLUMN max_total_time BIGINT;
+
+ALTER TYPE recipe_sort_by ADD VALUE 'total_time';
+
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+
+-- Per serving, with energy in kilocalories, sodium in milligrams, and everything else in grams
+CREATE TABLE recipe_nutrition (
+    recipe_id BIGINT NOT NULL PRIMARY KEY REFERENCES recipe(id) ON DELETE CASCADE,
+    calories REAL,
+    protein REAL,
+    fat REAL,
+    carbohydrates REAL,
+    fiber REAL,
+    sodium REAL,
+    sugar REAL
+);
+
+ALTER TYPE recipe_sort_by ADD VALUE 'calories';
+ALTER TYPE recipe_sort_by ADD VALUE 'protein';
+ALTER TYPE recipe_sort_by ADD VALUE 'fat';
+ALTER TYPE recipe_sort_by ADD VALUE 'carbohydrates';
+ALTER TYPE recipe_sort_by ADD VALUE 'fiber';
+ALTER TYPE recipe_sort_by ADD VALUE 'sodium';
+ALTER TYPE recipe_sort_by ADD VALUE 'sugar';
+
+COMMIT;
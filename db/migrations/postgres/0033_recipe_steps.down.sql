@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE recipe_step;
+
+DROP TYPE temperature_unit;
+
+COMMIT;
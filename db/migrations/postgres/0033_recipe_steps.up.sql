@@ -0,0 +1,19 @@
+BEGIN;
+
+CREATE TYPE temperature_unit AS ENUM ('fahrenheit', 'celsius');
+
+-- The directions of each recipe, split into ordered steps.
+-- The steps of existing recipes are split from their directions when the database is opened.
+-- Durations are stored as a number of seconds.
+CREATE TABLE recipe_step (
+    recipe_id BIGINT NOT NULL REFERENCES recipe(id) ON DELETE CASCADE,
+    step_number INTEGER NOT NULL,
+    step_text TEXT NOT NULL,
+    duration BIGINT,
+    temperature REAL,
+    temperature_unit temperature_unit,
+    image_name TEXT,
+    PRIMARY KEY(recipe_id, step_number)
+);
+
+COMMIT;
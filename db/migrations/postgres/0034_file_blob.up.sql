@@ -0,0 +1,16 @@
+BEGIN;
+
+-- The content of files (e.g., uploads and backups) when they are stored in the database.
+-- Directories aren't stored, but are implied by the slashes in the paths of the files.
+CREATE TABLE file_blob (
+    path TEXT NOT NULL PRIMARY KEY,
+    content BYTEA NOT NULL,
+    size BIGINT NOT NULL,
+    modified_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Files are read in chunks, which is only efficient if the content isn't compressed.
+-- Images and backups are already compressed anyway.
+ALTER TABLE file_blob ALTER COLUMN content SET STORAGE EXTERNAL;
+
+COMMIT;
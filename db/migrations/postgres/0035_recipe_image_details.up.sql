@@ -0,0 +1,18 @@
+BEGIN;
+
+-- The details of the images uploaded to each recipe, which are otherwise only stored as files.
+-- Images uploaded before the details were recorded have none until they are edited or reordered.
+CREATE TABLE recipe_image (
+    recipe_id BIGINT NOT NULL REFERENCES recipe(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    caption TEXT NOT NULL DEFAULT '',
+    alt_text TEXT NOT NULL DEFAULT '',
+    sort_order INTEGER NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    uploaded_by INTEGER REFERENCES app_user(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(recipe_id, name)
+);
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+DROP INDEX search_filter_tag_tag_key_idx;
+ALTER TABLE search_filter_tag
+DROP COLUMN tag_key;
+
+DROP INDEX app_user_favorite_tag_tag_key_idx;
+ALTER TABLE app_user_favorite_tag
+DROP COLUMN tag_key;
+
+DROP INDEX tag_tag_key_idx;
+ALTER TABLE tag
+DROP COLUMN tag_key;
+
+DROP TABLE data_migration;
+
+COMMIT;
@@ -0,0 +1,33 @@
+BEGIN;
+
+-- Changes to the data that can't be made in SQL alone, e.g., normalizing text the same way as the application.
+-- Each is recorded here once it has been made, so that it's only ever made once.
+CREATE TABLE data_migration (
+    name TEXT NOT NULL PRIMARY KEY,
+    applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The keys start out as the tags themselves, which are already unique,
+-- and are replaced with the normalized keys the next time the database is opened
+ALTER TABLE tag
+ADD COLUMN tag_key TEXT;
+UPDATE tag SET tag_key = tag;
+ALTER TABLE tag
+ALTER COLUMN tag_key SET NOT NULL;
+CREATE UNIQUE INDEX tag_tag_key_idx ON tag(tag_key);
+
+ALTER TABLE app_user_favorite_tag
+ADD COLUMN tag_key TEXT;
+UPDATE app_user_favorite_tag SET tag_key = tag;
+ALTER TABLE app_user_favorite_tag
+ALTER COLUMN tag_key SET NOT NULL;
+CREATE INDEX app_user_favorite_tag_tag_key_idx ON app_user_favorite_tag(tag_key);
+
+ALTER TABLE search_filter_tag
+ADD COLUMN tag_key TEXT;
+UPDATE search_filter_tag SET tag_key = tag;
+ALTER TABLE search_filter_tag
+ALTER COLUMN tag_key SET NOT NULL;
+CREATE INDEX search_filter_tag_tag_key_idx ON search_filter_tag(tag_key);
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX job_finished_at_idx;
+ALTER TABLE job
+DROP COLUMN heartbeat_at;
+
+COMMIT;
@@ -0,0 +1,33 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+-- SQLite cannot drop columns used in foreign keys, so rebuild the table instead
+CREATE TABLE recipe_note_new (
+    id INTEGER NOT NULL PRIMARY KEY,
+    recipe_id INTEGER NOT NULL,
+    note TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(recipe_id) REFERENCES recipe(id) ON DELETE CASCADE
+);
+
+INSERT INTO recipe_note_new (id, recipe_id, note, created_at, modified_at)
+  SELECT id, recipe_id, note, created_at, modified_at
+  FROM recipe_note;
+
+DROP TABLE recipe_note;
+
+ALTER TABLE recipe_note_new RENAME TO recipe_note;
+
+CREATE INDEX recipe_note_recipe_id_idx ON recipe_note(recipe_id);
+
+CREATE TRIGGER on_recipe_note_update
+    AFTER UPDATE ON recipe_note
+BEGIN
+    UPDATE recipe_note SET modified_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
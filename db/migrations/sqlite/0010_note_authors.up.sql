@@ -0,0 +1,15 @@
+BEGIN;
+
+-- Existing notes intentionally remain authorless
+ALTER TABLE recipe_note
+ADD COLUMN parent_id INTEGER REFERENCES recipe_note(id) ON DELETE CASCADE;
+ALTER TABLE recipe_note
+ADD COLUMN image_name TEXT;
+ALTER TABLE recipe_note
+ADD COLUMN created_by INTEGER REFERENCES app_user(id) ON DELETE SET NULL;
+ALTER TABLE recipe_note
+ADD COLUMN modified_by INTEGER REFERENCES app_user(id) ON DELETE SET NULL;
+
+CREATE INDEX recipe_note_parent_id_idx ON recipe_note(parent_id);
+
+COMMIT;
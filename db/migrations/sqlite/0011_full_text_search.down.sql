@@ -0,0 +1,37 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+DROP TRIGGER on_recipe_fts_insert;
+DROP TRIGGER on_recipe_fts_delete;
+DROP TRIGGER on_recipe_fts_update;
+
+DROP TABLE recipe_fts;
+
+UPDATE search_filter SET sort_by = 'name' WHERE sort_by = 'relevance';
+
+CREATE TABLE search_filter_new (
+    id INTEGER NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    query TEXT,
+    with_pictures BOOLEAN,
+    sort_by TEXT CHECK(sort_by IN ('id', 'name', 'created', 'modified', 'rating', 'random')),
+    sort_dir TEXT CHECK(sort_dir IN ('asc', 'desc')),
+    FOREIGN KEY(user_id) REFERENCES app_user(id) ON DELETE CASCADE
+);
+
+INSERT INTO search_filter_new (id, user_id, name, query, with_pictures, sort_by, sort_dir)
+  SELECT id, user_id, name, query, with_pictures, sort_by, sort_dir
+  FROM search_filter;
+
+DROP TABLE search_filter;
+
+ALTER TABLE search_filter_new RENAME TO search_filter;
+
+CREATE INDEX search_filter_name_idx ON search_filter(name);
+CREATE INDEX search_filter_user_id_idx ON search_filter(user_id);
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
@@ -0,0 +1,68 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+-- Full text index of the searchable recipe fields, kept in sync with the recipe table by the triggers below
+CREATE VIRTUAL TABLE recipe_fts USING fts5(
+    name,
+    ingredients,
+    directions,
+    storage_instructions,
+    nutrition_info,
+    content='recipe',
+    content_rowid='id',
+    tokenize='porter unicode61 remove_diacritics 2'
+);
+
+INSERT INTO recipe_fts(recipe_fts) VALUES('rebuild');
+
+CREATE TRIGGER on_recipe_fts_insert
+    AFTER INSERT ON recipe
+BEGIN
+    INSERT INTO recipe_fts(rowid, name, ingredients, directions, storage_instructions, nutrition_info)
+    VALUES (NEW.id, NEW.name, NEW.ingredients, NEW.directions, NEW.storage_instructions, NEW.nutrition_info);
+END;
+
+CREATE TRIGGER on_recipe_fts_delete
+    AFTER DELETE ON recipe
+BEGIN
+    INSERT INTO recipe_fts(recipe_fts, rowid, name, ingredients, directions, storage_instructions, nutrition_info)
+    VALUES ('delete', OLD.id, OLD.name, OLD.ingredients, OLD.directions, OLD.storage_instructions, OLD.nutrition_info);
+END;
+
+-- Limited to the indexed columns so that the modified_at update in on_recipe_update doesn't re-index the recipe
+CREATE TRIGGER on_recipe_fts_update
+    AFTER UPDATE OF name, ingredients, directions, storage_instructions, nutrition_info ON recipe
+BEGIN
+    INSERT INTO recipe_fts(recipe_fts, rowid, name, ingredients, directions, storage_instructions, nutrition_info)
+    VALUES ('delete', OLD.id, OLD.name, OLD.ingredients, OLD.directions, OLD.storage_instructions, OLD.nutrition_info);
+    INSERT INTO recipe_fts(rowid, name, ingredients, directions, storage_instructions, nutrition_info)
+    VALUES (NEW.id, NEW.name, NEW.ingredients, NEW.directions, NEW.storage_instructions, NEW.nutrition_info);
+END;
+
+-- Allow saved searches to sort by relevance
+CREATE TABLE search_filter_new (
+    id INTEGER NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    query TEXT,
+    with_pictures BOOLEAN,
+    sort_by TEXT CHECK(sort_by IN ('id', 'name', 'created', 'modified', 'rating', 'random', 'relevance')),
+    sort_dir TEXT CHECK(sort_dir IN ('asc', 'desc')),
+    FOREIGN KEY(user_id) REFERENCES app_user(id) ON DELETE CASCADE
+);
+
+INSERT INTO search_filter_new (id, user_id, name, query, with_pictures, sort_by, sort_dir)
+  SELECT id, user_id, name, query, with_pictures, sort_by, sort_dir
+  FROM search_filter;
+
+DROP TABLE search_filter;
+
+ALTER TABLE search_filter_new RENAME TO search_filter;
+
+CREATE INDEX search_filter_name_idx ON search_filter(name);
+CREATE INDEX search_filter_user_id_idx ON search_filter(user_id);
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
@@ -0,0 +1,11 @@
+BEGIN;
+
+DELETE FROM search_filter_tag WHERE excluded = 1;
+
+ALTER TABLE search_filter_tag
+DROP COLUMN excluded;
+
+ALTER TABLE search_filter
+DROP COLUMN tag_match;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE search_filter
+ADD COLUMN tag_match TEXT NOT NULL DEFAULT 'any' CHECK(tag_match IN ('any', 'all'));
+
+ALTER TABLE search_filter_tag
+ADD COLUMN excluded BOOLEAN NOT NULL DEFAULT 0;
+
+COMMIT;
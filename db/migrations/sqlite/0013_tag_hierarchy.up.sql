@@ -0,0 +1,14 @@
+BEGIN;
+
+CREATE TABLE tag (
+    tag TEXT NOT NULL PRIMARY KEY,
+    parent_tag TEXT,
+    description TEXT NOT NULL DEFAULT '',
+    color TEXT NOT NULL DEFAULT '',
+    icon TEXT NOT NULL DEFAULT '',
+    CHECK(parent_tag <> tag),
+    FOREIGN KEY(parent_tag) REFERENCES tag(tag) ON DELETE SET NULL ON UPDATE CASCADE
+);
+CREATE INDEX tag_parent_tag_idx ON tag(parent_tag);
+
+COMMIT;
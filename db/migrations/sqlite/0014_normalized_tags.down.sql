@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX recipe_tag_tag_key_idx;
+DROP INDEX recipe_tag_recipe_id_tag_key_idx;
+
+ALTER TABLE recipe_tag
+DROP COLUMN tag_key;
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN;
+
+-- Drop the whitespace around tags, along with any tags that were only whitespace
+UPDATE recipe_tag SET tag = trim(tag, ' ' || char(9) || char(10) || char(13));
+DELETE FROM recipe_tag WHERE tag = '';
+
+-- SQLite only folds the case of ASCII characters,
+-- so the keys of any other tags are corrected the next time their recipe is saved
+ALTER TABLE recipe_tag
+ADD COLUMN tag_key TEXT NOT NULL DEFAULT '';
+UPDATE recipe_tag SET tag_key = lower(tag);
+
+-- Keep only the first of any tags on the same recipe that differ only by case
+DELETE FROM recipe_tag
+WHERE rowid NOT IN (SELECT min(rowid) FROM recipe_tag GROUP BY recipe_id, tag_key);
+
+CREATE UNIQUE INDEX recipe_tag_recipe_id_tag_key_idx ON recipe_tag(recipe_id, tag_key);
+CREATE INDEX recipe_tag_tag_key_idx ON recipe_tag(tag_key);
+
+COMMIT;
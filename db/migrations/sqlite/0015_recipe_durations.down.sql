@@ -0,0 +1,46 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+UPDATE search_filter SET sort_by = 'name' WHERE sort_by = 'total_time';
+
+CREATE TABLE search_filter_new (
+    id INTEGER NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    query TEXT,
+    with_pictures BOOLEAN,
+    sort_by TEXT CHECK(sort_by IN ('id', 'name', 'created', 'modified', 'rating', 'random', 'relevance')),
+    sort_dir TEXT CHECK(sort_dir IN ('asc', 'desc')),
+    tag_match TEXT NOT NULL DEFAULT 'any' CHECK(tag_match IN ('any', 'all')),
+    FOREIGN KEY(user_id) REFERENCES app_user(id) ON DELETE CASCADE
+);
+
+INSERT INTO search_filter_new (id, user_id, name, query, with_pictures, sort_by, sort_dir, tag_match)
+  SELECT id, user_id, name, query, with_pictures, sort_by, sort_dir, tag_match
+  FROM search_filter;
+
+DROP TABLE search_filter;
+
+ALTER TABLE search_filter_new RENAME TO search_filter;
+
+CREATE INDEX search_filter_name_idx ON search_filter(name);
+CREATE INDEX search_filter_user_id_idx ON search_filter(user_id);
+
+DROP TRIGGER on_recipe_update;
+CREATE TRIGGER on_recipe_update
+    AFTER UPDATE ON recipe
+BEGIN
+    UPDATE recipe SET modified_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+DROP INDEX recipe_total_time_idx;
+
+ALTER TABLE recipe DROP COLUMN total_time;
+ALTER TABLE recipe DROP COLUMN active_time;
+ALTER TABLE recipe DROP COLUMN cook_time;
+ALTER TABLE recipe DROP COLUMN prep_time;
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
@@ -0,0 +1,49 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+-- Stored as a number of seconds
+ALTER TABLE recipe ADD COLUMN prep_time INTEGER;
+ALTER TABLE recipe ADD COLUMN cook_time INTEGER;
+ALTER TABLE recipe ADD COLUMN active_time INTEGER;
+ALTER TABLE recipe ADD COLUMN total_time INTEGER;
+
+CREATE INDEX recipe_total_time_idx ON recipe(total_time);
+
+-- The durations of existing recipes are filled in from their free-form time when the database is opened,
+-- which shouldn't mark every recipe as modified, so updates that only set the durations leave the modified date alone
+DROP TRIGGER on_recipe_update;
+CREATE TRIGGER on_recipe_update
+    AFTER UPDATE OF name, serving_size, nutrition_info, ingredients, directions, storage_instructions, source_url, recipe_time, current_state, main_image_name ON recipe
+BEGIN
+    UPDATE recipe SET modified_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+-- Allow saved searches to filter and sort by total time
+CREATE TABLE search_filter_new (
+    id INTEGER NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    query TEXT,
+    with_pictures BOOLEAN,
+    sort_by TEXT CHECK(sort_by IN ('id', 'name', 'created', 'modified', 'rating', 'random', 'relevance', 'total_time')),
+    sort_dir TEXT CHECK(sort_dir IN ('asc', 'desc')),
+    tag_match TEXT NOT NULL DEFAULT 'any' CHECK(tag_match IN ('any', 'all')),
+    max_total_time INTEGER,
+    FOREIGN KEY(user_id) REFERENCES app_user(id) ON DELETE CASCADE
+);
+
+INSERT INTO search_filter_new (id, user_id, name, query, with_pictures, sort_by, sort_dir, tag_match)
+  SELECT id, user_id, name, query, with_pictures, sort_by, sort_dir, tag_match
+  FROM search_filter;
+
+DROP TABLE search_filter;
+
+ALTER TABLE search_filter_new RENAME TO search_filter;
+
+CREATE INDEX search_filter_name_idx ON search_filter(name);
+CREATE INDEX search_filter_user_id_idx ON search_filter(user_id);
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
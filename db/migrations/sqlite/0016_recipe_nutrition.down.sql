@@ -0,0 +1,35 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+UPDATE search_filter SET sort_by = 'name' WHERE sort_by IN ('calories', 'protein', 'fat', 'carbohydrates', 'fiber', 'sodium', 'sugar');
+
+CREATE TABLE search_filter_new (
+    id INTEGER NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    query TEXT,
+    with_pictures BOOLEAN,
+    sort_by TEXT CHECK(sort_by IN ('id', 'name', 'created', 'modified', 'rating', 'random', 'relevance', 'total_time')),
+    sort_dir TEXT CHECK(sort_dir IN ('asc', 'desc')),
+    tag_match TEXT NOT NULL DEFAULT 'any' CHECK(tag_match IN ('any', 'all')),
+    max_total_time INTEGER,
+    FOREIGN KEY(user_id) REFERENCES app_user(id) ON DELETE CASCADE
+);
+
+INSERT INTO search_filter_new (id, user_id, name, query, with_pictures, sort_by, sort_dir, tag_match, max_total_time)
+  SELECT id, user_id, name, query, with_pictures, sort_by, sort_dir, tag_match, max_total_time
+  FROM search_filter;
+
+DROP TABLE search_filter;
+
+ALTER TABLE search_filter_new RENAME TO search_filter;
+
+CREATE INDEX search_filter_name_idx ON search_filter(name);
+CREATE INDEX search_filter_user_id_idx ON search_filter(user_id);
+
+DROP TABLE recipe_nutrition;
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
@@ -0,0 +1,9 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+DROP TABLE recipe_step;
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
@@ -0,0 +1,22 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+-- The directions of each recipe, split into ordered steps.
+-- The steps of existing recipes are split from their directions when the database is opened.
+-- Durations are stored as a number of seconds.
+CREATE TABLE recipe_step (
+    recipe_id INTEGER NOT NULL,
+    step_number INTEGER NOT NULL,
+    step_text TEXT NOT NULL,
+    duration INTEGER,
+    temperature REAL,
+    temperature_unit TEXT CHECK(temperature_unit IN ('fahrenheit', 'celsius')),
+    image_name TEXT,
+    FOREIGN KEY(recipe_id) REFERENCES recipe(id) ON DELETE CASCADE,
+    PRIMARY KEY(recipe_id, step_number)
+);
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
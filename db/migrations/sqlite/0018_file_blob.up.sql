@@ -0,0 +1,12 @@
+BEGIN;
+
+-- The content of files (e.g., uploads and backups) when they are stored in the database.
+-- Directories aren't stored, but are implied by the slashes in the paths of the files.
+CREATE TABLE file_blob (
+    path TEXT NOT NULL PRIMARY KEY,
+    content BLOB NOT NULL,
+    size INTEGER NOT NULL,
+    modified_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMIT;
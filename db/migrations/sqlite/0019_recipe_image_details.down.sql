@@ -0,0 +1,9 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+DROP TABLE recipe_image;
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
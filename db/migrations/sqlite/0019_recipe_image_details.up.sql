@@ -0,0 +1,23 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+-- The details of the images uploaded to each recipe, which are otherwise only stored as files.
+-- Images uploaded before the details were recorded have none until they are edited or reordered.
+CREATE TABLE recipe_image (
+    recipe_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    caption TEXT NOT NULL DEFAULT '',
+    alt_text TEXT NOT NULL DEFAULT '',
+    sort_order INTEGER NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    uploaded_by INTEGER REFERENCES app_user(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(recipe_id) REFERENCES recipe(id) ON DELETE CASCADE,
+    PRIMARY KEY(recipe_id, name)
+);
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
@@ -0,0 +1,9 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+DROP TABLE job;
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
@@ -0,0 +1,29 @@
+PRAGMA foreign_keys=off;
+
+BEGIN;
+
+-- Work that is done in the background, e.g., processing uploaded images and creating backups.
+-- What each job operates on is stored along with it, so that pending jobs survive restarts.
+-- The data, e.g., an uploaded file, is only kept until the job finishes.
+CREATE TABLE job (
+    id INTEGER NOT NULL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    state TEXT NOT NULL DEFAULT 'pending',
+    payload TEXT NOT NULL,
+    data BLOB,
+    progress INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    error TEXT,
+    result TEXT,
+    run_after DATETIME,
+    created_by INTEGER REFERENCES app_user(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at DATETIME,
+    finished_at DATETIME
+);
+CREATE INDEX job_state_idx ON job(state);
+
+COMMIT;
+
+PRAGMA foreign_keys=on;
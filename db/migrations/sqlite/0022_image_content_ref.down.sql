@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE image_content_ref;
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+-- The recipes that use each content-addressed image in the upload store, so that the content is only removed
+-- once no recipe uses it. There's deliberately no foreign key to the recipe, since the references are only
+-- removed along with the recipe's uploads, which is after the recipe itself is deleted.
+CREATE TABLE image_content_ref (
+    content_name TEXT NOT NULL,
+    recipe_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (content_name, recipe_id)
+);
+
+COMMIT;
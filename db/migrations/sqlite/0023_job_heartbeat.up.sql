@@ -0,0 +1,11 @@
+BEGIN;
+
+-- When the instance running a job last reported that it is still working on it.
+-- Jobs that stop reporting are run again by any instance, without disturbing those that are still running.
+ALTER TABLE job
+ADD COLUMN heartbeat_at DATETIME;
+
+-- Finished jobs are pruned once they are old enough
+CREATE INDEX job_finished_at_idx ON job(finished_at);
+
+COMMIT;
@@ -11,6 +11,10 @@ type sqlNoteDriver struct {
 	Db *sqlx.DB
 }
 
+const noteSelectStmt = "SELECT n.id, n.recipe_id, n.parent_id, n.note, n.image_name, n.created_by, u.username AS created_by_username, n.modified_by, n.created_at, n.modified_at " +
+	"FROM recipe_note AS n " +
+	"LEFT OUTER JOIN app_user AS u ON n.created_by = u.id "
+
 func (d *sqlNoteDriver) Create(ctx context.Context, note *models.Note) error {
 	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
 		return d.createImpl(ctx, note, db)
@@ -18,10 +22,29 @@ func (d *sqlNoteDriver) Create(ctx context.Context, note *models.Note) error {
 }
 
 func (*sqlNoteDriver) createImpl(ctx context.Context, note *models.Note, db sqlx.QueryerContext) error {
-	stmt := "INSERT INTO recipe_note (recipe_id, note) " +
-		"VALUES ($1, $2) RETURNING id"
+	// Replies must be to a note on the same recipe
+	if note.ParentID != nil {
+		var parentID int64
+		if err := sqlx.GetContext(ctx, db, &parentID, "SELECT id FROM recipe_note WHERE id = $1 AND recipe_id = $2", note.ParentID, note.RecipeID); err != nil {
+			return err
+		}
+	}
+
+	stmt := "INSERT INTO recipe_note (recipe_id, parent_id, note, image_name, created_by, modified_by) " +
+		"VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+
+	return sqlx.GetContext(ctx, db, note, stmt, note.RecipeID, note.ParentID, note.Text, note.ImageName, note.CreatedBy, note.ModifiedBy)
+}
 
-	return sqlx.GetContext(ctx, db, note, stmt, note.RecipeID, note.Text)
+func (d *sqlNoteDriver) Read(ctx context.Context, recipeID, noteID int64) (*models.Note, error) {
+	return get(d.Db, func(db sqlx.QueryerContext) (*models.Note, error) {
+		note := new(models.Note)
+		if err := sqlx.GetContext(ctx, db, note, noteSelectStmt+"WHERE n.id = $1 AND n.recipe_id = $2", noteID, recipeID); err != nil {
+			return nil, err
+		}
+
+		return note, nil
+	})
 }
 
 func (d *sqlNoteDriver) Update(ctx context.Context, note *models.Note) error {
@@ -31,8 +54,8 @@ func (d *sqlNoteDriver) Update(ctx context.Context, note *models.Note) error {
 }
 
 func (*sqlNoteDriver) updateImpl(ctx context.Context, note *models.Note, db sqlx.ExecerContext) error {
-	_, err := db.ExecContext(ctx, "UPDATE recipe_note SET note = $1 WHERE ID = $2 AND recipe_id = $3",
-		note.Text, note.ID, note.RecipeID)
+	_, err := db.ExecContext(ctx, "UPDATE recipe_note SET note = $1, image_name = $2, modified_by = $3 WHERE ID = $4 AND recipe_id = $5",
+		note.Text, note.ImageName, note.ModifiedBy, note.ID, note.RecipeID)
 	return err
 }
 
@@ -43,6 +66,7 @@ func (d *sqlNoteDriver) Delete(ctx context.Context, recipeID, noteID int64) erro
 }
 
 func (*sqlNoteDriver) deleteImpl(ctx context.Context, recipeID, noteID int64, db sqlx.ExecerContext) error {
+	// Any replies are removed along with the note via the cascading foreign key
 	_, err := db.ExecContext(ctx, "DELETE FROM recipe_note WHERE id = $1 AND recipe_id = $2", noteID, recipeID)
 	return err
 }
@@ -51,7 +75,7 @@ func (d *sqlNoteDriver) List(ctx context.Context, recipeID int64) (*[]models.Not
 	return get(d.Db, func(db sqlx.QueryerContext) (*[]models.Note, error) {
 		notes := make([]models.Note, 0)
 
-		if err := sqlx.SelectContext(ctx, db, &notes, "SELECT * FROM recipe_note WHERE recipe_id = $1 ORDER BY created_at DESC", recipeID); err != nil {
+		if err := sqlx.SelectContext(ctx, db, &notes, noteSelectStmt+"WHERE n.recipe_id = $1 ORDER BY n.created_at DESC", recipeID); err != nil {
 			return nil, err
 		}
 
@@ -17,16 +17,20 @@ import (
 func Test_Note_Create(t *testing.T) {
 	type testArgs struct {
 		recipeID      int64
+		parentID      *int64
 		text          string
+		parentError   error
 		dbError       error
 		expectedError error
 	}
 
 	// Arrange
 	tests := []testArgs{
-		{1, "My note", nil, nil},
-		{0, "", sql.ErrNoRows, ErrNotFound},
-		{0, "", sql.ErrConnDone, sql.ErrConnDone},
+		{1, nil, "My note", nil, nil, nil},
+		{1, new(int64(2)), "My reply", nil, nil, nil},
+		{1, new(int64(2)), "My reply", sql.ErrNoRows, nil, ErrNotFound},
+		{0, nil, "", nil, sql.ErrNoRows, ErrNotFound},
+		{0, nil, "", nil, sql.ErrConnDone, sql.ErrConnDone},
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprint(i), func(t *testing.T) {
@@ -37,17 +41,30 @@ func Test_Note_Create(t *testing.T) {
 			sut, dbmock := getMockDb(t, nil)
 			defer sut.Close()
 
-			note := &models.Note{RecipeID: &test.recipeID, Text: test.text}
+			userID := int64(3)
+			note := &models.Note{RecipeID: &test.recipeID, ParentID: test.parentID, Text: test.text, CreatedBy: &userID, ModifiedBy: &userID}
 			expectedID := rand.Int63()
 
 			dbmock.ExpectBegin()
-			query := dbmock.ExpectQuery("INSERT INTO recipe_note \\(recipe_id, note\\) VALUES \\(\\$1, \\$2\\) RETURNING id").WithArgs(note.RecipeID, note.Text)
-			if test.dbError == nil {
-				query.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(expectedID))
-				dbmock.ExpectCommit()
-			} else {
-				query.WillReturnError(test.dbError)
-				dbmock.ExpectRollback()
+			if test.parentID != nil {
+				parentQuery := dbmock.ExpectQuery("SELECT id FROM recipe_note WHERE id = \\$1 AND recipe_id = \\$2").WithArgs(test.parentID, test.recipeID)
+				if test.parentError != nil {
+					parentQuery.WillReturnError(test.parentError)
+					dbmock.ExpectRollback()
+				} else {
+					parentQuery.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(*test.parentID))
+				}
+			}
+			if test.parentError == nil {
+				query := dbmock.ExpectQuery("INSERT INTO recipe_note \\(recipe_id, parent_id, note, image_name, created_by, modified_by\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6\\) RETURNING id").
+					WithArgs(note.RecipeID, note.ParentID, note.Text, note.ImageName, note.CreatedBy, note.ModifiedBy)
+				if test.dbError == nil {
+					query.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(expectedID))
+					dbmock.ExpectCommit()
+				} else {
+					query.WillReturnError(test.dbError)
+					dbmock.ExpectRollback()
+				}
 			}
 
 			// Act
@@ -67,6 +84,67 @@ func Test_Note_Create(t *testing.T) {
 	}
 }
 
+func Test_Note_Read(t *testing.T) {
+	type testArgs struct {
+		recipeID      int64
+		noteID        int64
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{1, 2, nil, nil},
+		{1, 2, sql.ErrNoRows, ErrNotFound},
+		{1, 2, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			// Arrange
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			now := time.Now()
+			query := dbmock.ExpectQuery("SELECT (.+) FROM recipe_note AS n LEFT OUTER JOIN app_user AS u ON n.created_by = u.id WHERE n.id = \\$1 AND n.recipe_id = \\$2").WithArgs(test.noteID, test.recipeID)
+			if test.dbError == nil {
+				rows := sqlmock.NewRows([]string{"id", "recipe_id", "parent_id", "note", "image_name", "created_by", "created_by_username", "modified_by", "created_at", "modified_at"}).
+					AddRow(test.noteID, test.recipeID, nil, "My note", nil, 3, "user3", 3, now, now)
+				query.WillReturnRows(rows)
+			} else {
+				query.WillReturnError(test.dbError)
+			}
+
+			// Act
+			result, err := sut.Notes().Read(t.Context(), test.recipeID, test.noteID)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+			if test.expectedError == nil {
+				if result == nil {
+					t.Fatal("expected a result, but did not receive one")
+				}
+				if *result.ID != test.noteID {
+					t.Errorf("expected note id %d, received %d", test.noteID, *result.ID)
+				}
+				if result.CreatedBy == nil || *result.CreatedBy != 3 {
+					t.Errorf("expected created by %d, received %v", 3, result.CreatedBy)
+				}
+				if result.CreatedByUsername == nil || *result.CreatedByUsername != "user3" {
+					t.Errorf("expected created by username %s, received %v", "user3", result.CreatedByUsername)
+				}
+			}
+		})
+	}
+}
+
 func Test_Note_Update(t *testing.T) {
 	type testArgs struct {
 		recipeID      int64
@@ -91,10 +169,13 @@ func Test_Note_Update(t *testing.T) {
 			sut, dbmock := getMockDb(t, nil)
 			defer sut.Close()
 
-			note := &models.Note{ID: &test.noteID, RecipeID: &test.recipeID, Text: test.text}
+			userID := int64(3)
+			imageName := "image.jpeg"
+			note := &models.Note{ID: &test.noteID, RecipeID: &test.recipeID, Text: test.text, ImageName: &imageName, ModifiedBy: &userID}
 
 			dbmock.ExpectBegin()
-			exec := dbmock.ExpectExec("UPDATE recipe_note SET note = \\$1 WHERE ID = \\$2 AND recipe_id = \\$3").WithArgs(note.Text, note.ID, note.RecipeID)
+			exec := dbmock.ExpectExec("UPDATE recipe_note SET note = \\$1, image_name = \\$2, modified_by = \\$3 WHERE ID = \\$4 AND recipe_id = \\$5").
+				WithArgs(note.Text, note.ImageName, note.ModifiedBy, note.ID, note.RecipeID)
 			if test.dbError == nil {
 				exec.WillReturnResult(driver.RowsAffected(1))
 				dbmock.ExpectCommit()
@@ -183,10 +264,14 @@ func Test_Note_List(t *testing.T) {
 				ModifiedAt: &now,
 			},
 			{
-				ID:         new(int64(2)),
-				Text:       "My Other Note",
-				CreatedAt:  &now,
-				ModifiedAt: &now,
+				ID:                new(int64(2)),
+				ParentID:          new(int64(1)),
+				Text:              "My Other Note",
+				CreatedBy:         new(int64(3)),
+				CreatedByUsername: new("user3"),
+				ModifiedBy:        new(int64(3)),
+				CreatedAt:         &now,
+				ModifiedAt:        &now,
 			},
 		}, nil, nil},
 		{0, nil, sql.ErrNoRows, ErrNotFound},
@@ -201,11 +286,11 @@ func Test_Note_List(t *testing.T) {
 			sut, dbmock := getMockDb(t, nil)
 			defer sut.Close()
 
-			query := dbmock.ExpectQuery("SELECT \\* FROM recipe_note WHERE recipe_id = \\$1 ORDER BY created_at DESC").WithArgs(test.recipeID)
+			query := dbmock.ExpectQuery("SELECT (.+) FROM recipe_note AS n LEFT OUTER JOIN app_user AS u ON n.created_by = u.id WHERE n.recipe_id = \\$1 ORDER BY n.created_at DESC").WithArgs(test.recipeID)
 			if test.dbError == nil {
-				rows := sqlmock.NewRows([]string{"id", "recipe_id", "note", "created_at", "modified_at"})
+				rows := sqlmock.NewRows([]string{"id", "recipe_id", "parent_id", "note", "image_name", "created_by", "created_by_username", "modified_by", "created_at", "modified_at"})
 				for _, note := range test.expectedResult {
-					rows.AddRow(note.ID, test.recipeID, note.Text, note.CreatedAt, note.ModifiedAt)
+					rows.AddRow(note.ID, test.recipeID, note.ParentID, note.Text, note.ImageName, note.CreatedBy, note.CreatedByUsername, note.ModifiedBy, note.CreatedAt, note.ModifiedAt)
 				}
 				query.WillReturnRows(rows)
 			} else {
@@ -0,0 +1,545 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/chadweimer/gomp/models"
+)
+
+// ErrInvalidQuery represents the error when a search query cannot be parsed
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// The supported field prefixes in a search query, and the recipe fields they search
+var queryTextFields = map[string]models.SearchField{
+	"name":                 models.SearchFieldName,
+	"ingredients":          models.SearchFieldIngredients,
+	"directions":           models.SearchFieldDirections,
+	"storage":              models.SearchFieldStorageInstructions,
+	"storage_instructions": models.SearchFieldStorageInstructions,
+	"nutrition":            models.SearchFieldNutrition,
+	"nutrition_info":       models.SearchFieldNutrition,
+}
+
+// The supported nutrition prefixes in a search query, and the recipe_nutrition columns they compare against
+var queryNutritionFields = map[string]string{
+	"calories":      "calories",
+	"protein":       "protein",
+	"fat":           "fat",
+	"carbs":         "carbohydrates",
+	"carbohydrates": "carbohydrates",
+	"fiber":         "fiber",
+	"sodium":        "sodium",
+	"sugar":         "sugar",
+}
+
+const (
+	queryFieldTag      = "tag"
+	queryFieldRating   = "rating"
+	queryFieldCreated  = "created"
+	queryFieldModified = "modified"
+)
+
+var queryComparisonOperators = []string{">=", "<=", ">", "<", "="}
+
+type queryNode interface{}
+
+// queryAnd matches when all of its children match
+type queryAnd struct {
+	children []queryNode
+}
+
+// queryOr matches when any of its children match
+type queryOr struct {
+	children []queryNode
+}
+
+// queryNot matches when its child doesn't match
+type queryNot struct {
+	child queryNode
+}
+
+// queryTerm is a single condition, optionally restricted to a field
+type queryTerm struct {
+	field    string
+	operator string
+	value    string
+	quoted   bool
+}
+
+// text returns the value of the term in a form suitable for the full-text search adapters
+func (t queryTerm) text() string {
+	if t.quoted {
+		return `"` + t.value + `"`
+	}
+	return t.value
+}
+
+type queryTokenKind int
+
+const (
+	queryTokenTerm queryTokenKind = iota
+	queryTokenAnd
+	queryTokenOr
+	queryTokenNot
+	queryTokenOpen
+	queryTokenClose
+)
+
+type queryToken struct {
+	kind     queryTokenKind
+	term     queryTerm
+	position int
+}
+
+// parseSearchQuery parses a search query such as
+// `name:soup ingredients:"coconut milk" -tag:spicy rating:>=4 calories:<500 created:>2025-01-01 OR (chicken stew)`.
+// Terms are implicitly combined with AND, which takes precedence over OR.
+// A nil node is returned for an empty query.
+func parseSearchQuery(query string) (queryNode, error) {
+	tokens, err := tokenizeSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := queryParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("%w: unexpected ')' at position %d", ErrInvalidQuery, p.peek().position+1)
+	}
+
+	return node, nil
+}
+
+func tokenizeSearchQuery(query string) ([]queryToken, error) {
+	tokens := make([]queryToken, 0)
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: queryTokenOpen, position: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: queryTokenClose, position: i})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			tokens = append(tokens, queryToken{kind: queryTokenNot, position: i})
+			i++
+		default:
+			token, next, err := readQueryTerm(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			i = next
+		}
+	}
+
+	return tokens, nil
+}
+
+func readQueryTerm(runes []rune, start int) (queryToken, int, error) {
+	token := queryToken{kind: queryTokenTerm, position: start}
+
+	// Read up to the end of the word, or the start of a quoted value
+	i := start
+	for i < len(runes) && !isQueryTermBoundary(runes[i]) {
+		i++
+	}
+	word := string(runes[start:i])
+
+	// Check for a field prefix. Anything else with a colon, e.g., "Tip:", is searched for as it is.
+	if prefix, rest, found := strings.Cut(word, ":"); found {
+		if field, ok := getQueryField(prefix); ok {
+			token.term.field = field
+			word = rest
+
+			if isQueryComparisonField(field) {
+				for _, op := range queryComparisonOperators {
+					if strings.HasPrefix(word, op) {
+						token.term.operator = op
+						word = strings.TrimPrefix(word, op)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	// Check for a quoted value
+	if word == "" && i < len(runes) && runes[i] == '"' {
+		end := i + 1
+		for end < len(runes) && runes[end] != '"' {
+			end++
+		}
+		if end >= len(runes) {
+			return token, end, fmt.Errorf("%w: unterminated quote at position %d", ErrInvalidQuery, i+1)
+		}
+		word = string(runes[i+1 : end])
+		token.term.quoted = true
+		i = end + 1
+	} else if word != "" && i < len(runes) && runes[i] == '"' {
+		return token, i, fmt.Errorf("%w: unexpected quote at position %d", ErrInvalidQuery, i+1)
+	}
+
+	if strings.TrimSpace(word) == "" {
+		return token, i, fmt.Errorf("%w: missing value at position %d", ErrInvalidQuery, start+1)
+	}
+	token.term.value = word
+
+	if token.term.field == "" && !token.term.quoted {
+		switch word {
+		case "AND":
+			token.kind = queryTokenAnd
+		case "OR":
+			token.kind = queryTokenOr
+		}
+	}
+
+	return token, i, nil
+}
+
+func isQueryTermBoundary(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+}
+
+// getQueryField returns the field that the prefix restricts a term to, if it is one of the supported prefixes
+func getQueryField(prefix string) (string, bool) {
+	field := strings.ToLower(prefix)
+	if _, ok := queryTextFields[field]; ok || queryNutritionFields[field] != "" {
+		return field, true
+	}
+	switch field {
+	case "tags":
+		return queryFieldTag, true
+	case queryFieldTag, queryFieldRating, queryFieldCreated, queryFieldModified:
+		return field, true
+	default:
+		return "", false
+	}
+}
+
+func isQueryComparisonField(field string) bool {
+	return field == queryFieldRating || field == queryFieldCreated || field == queryFieldModified || queryNutritionFields[field] != ""
+}
+
+type queryParser struct {
+	tokens []queryToken
+	index  int
+}
+
+func (p *queryParser) done() bool {
+	return p.index >= len(p.tokens)
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.index]
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	children := make([]queryNode, 0)
+	for {
+		child, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+
+		if p.done() || p.peek().kind != queryTokenOr {
+			break
+		}
+		p.index++
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return queryOr{children: children}, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	children := make([]queryNode, 0)
+	for !p.done() {
+		token := p.peek()
+		if token.kind == queryTokenOr || token.kind == queryTokenClose {
+			break
+		}
+		if token.kind == queryTokenAnd {
+			if len(children) == 0 {
+				return nil, fmt.Errorf("%w: unexpected AND at position %d", ErrInvalidQuery, token.position+1)
+			}
+			p.index++
+			if p.done() || p.peek().kind == queryTokenOr || p.peek().kind == queryTokenClose {
+				return nil, fmt.Errorf("%w: missing term after AND at position %d", ErrInvalidQuery, token.position+1)
+			}
+			continue
+		}
+
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	if len(children) == 0 {
+		position := len(p.tokens)
+		if !p.done() {
+			position = p.peek().position
+		} else if len(p.tokens) > 0 {
+			position = p.tokens[len(p.tokens)-1].position
+		}
+		return nil, fmt.Errorf("%w: missing term at position %d", ErrInvalidQuery, position+1)
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return queryAnd{children: children}, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	token := p.peek()
+	p.index++
+
+	switch token.kind {
+	case queryTokenNot:
+		if p.done() {
+			return nil, fmt.Errorf("%w: missing term after '-' at position %d", ErrInvalidQuery, token.position+1)
+		}
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{child: child}, nil
+	case queryTokenOpen:
+		child, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.done() || p.peek().kind != queryTokenClose {
+			return nil, fmt.Errorf("%w: missing ')' for '(' at position %d", ErrInvalidQuery, token.position+1)
+		}
+		p.index++
+		return child, nil
+	case queryTokenTerm:
+		if err := validateQueryTerm(token); err != nil {
+			return nil, err
+		}
+		return token.term, nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected token at position %d", ErrInvalidQuery, token.position+1)
+	}
+}
+
+func validateQueryTerm(token queryToken) error {
+	switch token.term.field {
+	case queryFieldRating:
+		if _, err := strconv.ParseFloat(token.term.value, 64); err != nil {
+			return fmt.Errorf("%w: invalid rating '%s' at position %d", ErrInvalidQuery, token.term.value, token.position+1)
+		}
+	case queryFieldCreated, queryFieldModified:
+		if _, _, err := parseQueryDate(token.term.value); err != nil {
+			return fmt.Errorf("%w: invalid date '%s' at position %d; expected YYYY-MM-DD or RFC 3339", ErrInvalidQuery, token.term.value, token.position+1)
+		}
+	default:
+		if queryNutritionFields[token.term.field] != "" {
+			if _, err := strconv.ParseFloat(token.term.value, 64); err != nil {
+				return fmt.Errorf("%w: invalid %s '%s' at position %d", ErrInvalidQuery, token.term.field, token.term.value, token.position+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseQueryDate parses either a date or a timestamp, returning whether the value was a date only
+func parseQueryDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// getQueryText returns the terms of the query that positively match text,
+// combined with OR, for use in ranking and highlighting results.
+func getQueryText(node queryNode) string {
+	terms := make([]string, 0)
+	var collect func(node queryNode)
+	collect = func(node queryNode) {
+		switch n := node.(type) {
+		case queryAnd:
+			for _, child := range n.children {
+				collect(child)
+			}
+		case queryOr:
+			for _, child := range n.children {
+				collect(child)
+			}
+		case queryTerm:
+			if n.field == "" || queryTextFields[n.field] != "" {
+				terms = append(terms, n.text())
+			}
+		}
+	}
+	collect(node)
+
+	return strings.Join(terms, " OR ")
+}
+
+// queryCompiler converts a parsed query into a SQL condition
+type queryCompiler struct {
+	fields  []models.SearchField
+	adapter sqlRecipeDriverAdapter
+}
+
+func (c queryCompiler) compile(node queryNode) (string, []any) {
+	switch n := node.(type) {
+	case queryAnd:
+		return c.compileAnd(n)
+	case queryOr:
+		stmts := make([]string, 0, len(n.children))
+		args := make([]any, 0)
+		for _, child := range n.children {
+			stmt, childArgs := c.compile(child)
+			if stmt == "" {
+				// This branch matches everything, so the whole condition does too
+				return "", nil
+			}
+			stmts = append(stmts, "("+stmt+")")
+			args = append(args, childArgs...)
+		}
+		return strings.Join(stmts, " OR "), args
+	case queryNot:
+		stmt, args := c.compile(n.child)
+		if stmt == "" {
+			return "", nil
+		}
+		return "NOT (" + stmt + ")", args
+	case queryTerm:
+		return c.compileTerm(n)
+	default:
+		return "", nil
+	}
+}
+
+func (c queryCompiler) compileAnd(n queryAnd) (string, []any) {
+	// Combine the text terms for the same fields, so that they are searched for together
+	textTerms := make(map[string][]string)
+	textFields := make([]string, 0)
+	others := make([]queryNode, 0)
+	for _, child := range n.children {
+		term, ok := child.(queryTerm)
+		if ok && (term.field == "" || queryTextFields[term.field] != "") {
+			field := string(queryTextFields[term.field])
+			if _, ok := textTerms[field]; !ok {
+				textFields = append(textFields, field)
+			}
+			textTerms[field] = append(textTerms[field], term.text())
+			continue
+		}
+		others = append(others, child)
+	}
+
+	stmts := make([]string, 0)
+	args := make([]any, 0)
+	for _, field := range textFields {
+		stmt, fieldArgs := c.compileText(models.SearchField(field), strings.Join(textTerms[field], " "))
+		if stmt != "" {
+			stmts = append(stmts, stmt)
+			args = append(args, fieldArgs...)
+		}
+	}
+	for _, child := range others {
+		stmt, childArgs := c.compile(child)
+		if stmt != "" {
+			stmts = append(stmts, stmt)
+			args = append(args, childArgs...)
+		}
+	}
+
+	if len(stmts) == 1 {
+		return stmts[0], args
+	}
+	for i := range stmts {
+		stmts[i] = "(" + stmts[i] + ")"
+	}
+	return strings.Join(stmts, " AND "), args
+}
+
+func (c queryCompiler) compileText(field models.SearchField, text string) (string, []any) {
+	if field == "" {
+		return c.adapter.GetSearchFields(getFilterFields(c.fields), text)
+	}
+	return c.adapter.GetSearchFields([]models.SearchField{field}, text)
+}
+
+func (c queryCompiler) compileTerm(term queryTerm) (string, []any) {
+	operator := term.operator
+	if operator == "" {
+		operator = "="
+	}
+
+	switch term.field {
+	case queryFieldTag:
+		// A single tag can always be expanded
+		stmt, args, _ := getTagMatchStmt([]string{term.value})
+		return "EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND " + stmt + ")", args
+	case queryFieldRating:
+		// The value was already validated when parsing
+		rating, _ := strconv.ParseFloat(term.value, 64)
+		return "COALESCE((SELECT g.rating FROM recipe_rating AS g WHERE g.recipe_id = r.id), 0) " + operator + " ?", []any{rating}
+	case queryFieldCreated:
+		return compileDateTerm("r.created_at", operator, term.value)
+	case queryFieldModified:
+		return compileDateTerm("r.modified_at", operator, term.value)
+	default:
+		if column := queryNutritionFields[term.field]; column != "" {
+			// The value was already validated when parsing.
+			// Recipes without the nutrient never match, since comparisons against NULL are never true.
+			amount, _ := strconv.ParseFloat(term.value, 64)
+			return getNutritionStmt(column) + " " + operator + " ?", []any{amount}
+		}
+		return c.compileText(queryTextFields[term.field], term.text())
+	}
+}
+
+func compileDateTerm(column string, operator string, value string) (string, []any) {
+	// The value was already validated when parsing
+	t, dateOnly, _ := parseQueryDate(value)
+	const format = time.DateTime
+	start := t.UTC().Format(format)
+	if !dateOnly {
+		return column + " " + operator + " ?", []any{start}
+	}
+
+	// A date covers the whole day
+	end := t.AddDate(0, 0, 1).UTC().Format(format)
+	switch operator {
+	case ">":
+		return column + " >= ?", []any{end}
+	case ">=":
+		return column + " >= ?", []any{start}
+	case "<":
+		return column + " < ?", []any{start}
+	case "<=":
+		return column + " < ?", []any{end}
+	default:
+		return column + " >= ? AND " + column + " < ?", []any{start, end}
+	}
+}
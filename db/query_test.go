@@ -0,0 +1,189 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/chadweimer/gomp/models"
+)
+
+func Test_getFieldsStmt_Query(t *testing.T) {
+	type testArgs struct {
+		name         string
+		query        string
+		fields       []models.SearchField
+		expectedStmt string
+		expectedArgs []any
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name:         "Plain words are searched together",
+			query:        "chicken soup",
+			fields:       []models.SearchField{models.SearchFieldName},
+			expectedStmt: "name = ? ",
+			expectedArgs: []any{"chicken soup"},
+		},
+		{
+			name:         "Field prefixes",
+			query:        `name:soup ingredients:"coconut milk"`,
+			expectedStmt: "(name = ? ) AND (ingredients = ? )",
+			expectedArgs: []any{"soup", `"coconut milk"`},
+		},
+		{
+			name:         "Short field prefixes",
+			query:        "storage:fridge nutrition:protein",
+			expectedStmt: "(storage_instructions = ? ) AND (nutrition_info = ? )",
+			expectedArgs: []any{"fridge", "protein"},
+		},
+		{
+			name:         "Excluded tag",
+			query:        "soup -tag:spicy",
+			fields:       []models.SearchField{models.SearchFieldName},
+			expectedStmt: "(name = ? ) AND (NOT (EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)))))",
+			expectedArgs: []any{"soup", "spicy", "spicy"},
+		},
+		{
+			name:         "Tag prefix",
+			query:        "tag:dessert*",
+			expectedStmt: "EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND t.tag_key LIKE ? ESCAPE '\\')",
+			expectedArgs: []any{"dessert%"},
+		},
+		{
+			name:         "Rating",
+			query:        "rating:>=4",
+			expectedStmt: "COALESCE((SELECT g.rating FROM recipe_rating AS g WHERE g.recipe_id = r.id), 0) >= ?",
+			expectedArgs: []any{4.0},
+		},
+		{
+			name:         "Nutrition",
+			query:        "calories:<500 carbs:<=30.5",
+			expectedStmt: "((SELECT n.calories FROM recipe_nutrition AS n WHERE n.recipe_id = r.id) < ?) AND ((SELECT n.carbohydrates FROM recipe_nutrition AS n WHERE n.recipe_id = r.id) <= ?)",
+			expectedArgs: []any{500.0, 30.5},
+		},
+		{
+			name:         "Created after date",
+			query:        "created:>2025-01-01",
+			expectedStmt: "r.created_at >= ?",
+			expectedArgs: []any{"2025-01-02 00:00:00"},
+		},
+		{
+			name:         "Modified on date",
+			query:        "modified:2025-01-01",
+			expectedStmt: "r.modified_at >= ? AND r.modified_at < ?",
+			expectedArgs: []any{"2025-01-01 00:00:00", "2025-01-02 00:00:00"},
+		},
+		{
+			name:         "Created before timestamp",
+			query:        "created:<2025-01-01T12:30:00-05:00",
+			expectedStmt: "r.created_at < ?",
+			expectedArgs: []any{"2025-01-01 17:30:00"},
+		},
+		{
+			name:         "Or",
+			query:        "tag:soup OR tag:stew",
+			expectedStmt: "(EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)))) OR (EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag))))",
+			expectedArgs: []any{"soup", "soup", "stew", "stew"},
+		},
+		{
+			name:         "And takes precedence over or",
+			query:        "tag:soup OR tag:stew rating:5",
+			expectedStmt: "(EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)))) OR ((EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)))) AND (COALESCE((SELECT g.rating FROM recipe_rating AS g WHERE g.recipe_id = r.id), 0) = ?))",
+			expectedArgs: []any{"soup", "soup", "stew", "stew", 5.0},
+		},
+		{
+			name:         "Groups",
+			query:        "(tag:soup OR tag:stew) AND rating:5",
+			expectedStmt: "((EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)))) OR (EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag))))) AND (COALESCE((SELECT g.rating FROM recipe_rating AS g WHERE g.recipe_id = r.id), 0) = ?)",
+			expectedArgs: []any{"soup", "soup", "stew", "stew", 5.0},
+		},
+		{
+			name:         "Words with colons that aren't fields",
+			query:        "3:30",
+			fields:       []models.SearchField{models.SearchFieldName},
+			expectedStmt: "name = ? ",
+			expectedArgs: []any{"3:30"},
+		},
+		{
+			name:         "Words with prefixes that aren't fields",
+			query:        "Tip: name:soup",
+			fields:       []models.SearchField{models.SearchFieldName},
+			expectedStmt: "(name = ? ) AND (name = ? )",
+			expectedArgs: []any{"Tip:", "soup"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Act
+			stmt, args, err := getFieldsStmt(test.query, test.fields, new(simpleSQLRecipeDriverAdapter))
+
+			// Assert
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if stmt != test.expectedStmt {
+				t.Errorf("expected stmt %s, received %s", test.expectedStmt, stmt)
+			}
+			if !reflect.DeepEqual(args, test.expectedArgs) {
+				t.Errorf("expected args %v, received %v", test.expectedArgs, args)
+			}
+		})
+	}
+}
+
+func Test_parseSearchQuery_Errors(t *testing.T) {
+	// Arrange
+	tests := []string{
+		`ingredients:"coconut milk`,
+		"name:",
+		"rating:high",
+		"protein:lots",
+		"created:yesterday",
+		"(soup",
+		"soup)",
+		"()",
+		"soup OR",
+		"OR soup",
+		"AND soup",
+		"soup AND",
+		`soup"`,
+	}
+	for _, query := range tests {
+		t.Run(query, func(t *testing.T) {
+			// Act
+			_, err := parseSearchQuery(query)
+
+			// Assert
+			if !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("expected error: %v, received error: %v", ErrInvalidQuery, err)
+			}
+		})
+	}
+}
+
+func Test_getSearchText(t *testing.T) {
+	// Arrange
+	tests := map[string]string{
+		"":                               "",
+		"chicken soup":                   "chicken OR soup",
+		`name:soup ingredients:"a b"`:    `soup OR "a b"`,
+		"soup -spicy tag:dinner":         "soup",
+		"(chicken OR beef) rating:>=4":   "chicken OR beef",
+		"rating:>=4 created:>2025-01-01": "",
+		"soup sodium:<600":               "soup",
+		"malformed (":                    "",
+	}
+	for query, expected := range tests {
+		t.Run(query, func(t *testing.T) {
+			// Act
+			text := getSearchText(query)
+
+			// Assert
+			if text != expected {
+				t.Errorf("expected %s, received %s", expected, text)
+			}
+		})
+	}
+}
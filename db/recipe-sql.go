@@ -5,13 +5,30 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/chadweimer/gomp/models"
+	"github.com/chadweimer/gomp/plaintext"
 	"github.com/jmoiron/sqlx"
 )
 
 type sqlRecipeDriverAdapter interface {
+	// GetSearchFields returns the condition, and associated arguments, used to match recipes
+	// where any of the specified fields matches the query.
 	GetSearchFields(filterFields []models.SearchField, query string) (string, []any)
+
+	// GetSearchRank returns the expression, and associated arguments, used to compute how relevant
+	// each recipe is to the query across the specified fields. Larger values are more relevant.
+	GetSearchRank(filterFields []models.SearchField, query string) (string, []any)
+
+	// GetSearchHighlight returns the expression, and associated arguments, used to extract a snippet
+	// of the specified field with the terms matching the query wrapped in the highlight delimiters.
+	GetSearchHighlight(field models.SearchField, query string) (string, []any)
 }
 
 type sqlRecipeDriver struct {
@@ -19,6 +36,15 @@ type sqlRecipeDriver struct {
 	adapter sqlRecipeDriverAdapter
 }
 
+// The delimiters that surround matching terms in highlighted snippets.
+// These are control characters that won't appear in user input,
+// so that the rest of the snippet can be safely escaped.
+const (
+	highlightStartDelimiter = "\x02"
+	highlightStopDelimiter  = "\x03"
+)
+
+// Note that the order of these fields must match the order of the columns in the recipe_fts SQLite table.
 var supportedSearchFields = [...]models.SearchField{
 	models.SearchFieldName,
 	models.SearchFieldIngredients,
@@ -34,11 +60,15 @@ func (d *sqlRecipeDriver) Create(ctx context.Context, recipe *models.Recipe) err
 }
 
 func (*sqlRecipeDriver) createImpl(ctx context.Context, recipe *models.Recipe, db sqlx.ExtContext) error {
-	stmt := "INSERT INTO recipe (name, serving_size, nutrition_info, ingredients, directions, storage_instructions, source_url, recipe_time) " +
-		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+	fillRecipeTimes(recipe)
+	fillRecipeSteps(recipe, nil)
+
+	stmt := "INSERT INTO recipe (name, serving_size, nutrition_info, ingredients, directions, storage_instructions, source_url, recipe_time, prep_time, cook_time, active_time, total_time) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id"
 
 	err := sqlx.GetContext(ctx, db, recipe, stmt,
-		recipe.Name, recipe.ServingSize, recipe.NutritionInfo, recipe.Ingredients, recipe.Directions, recipe.StorageInstructions, recipe.SourceURL, recipe.Time)
+		recipe.Name, recipe.ServingSize, recipe.NutritionInfo, recipe.Ingredients, recipe.Directions, recipe.StorageInstructions, recipe.SourceURL, recipe.Time,
+		recipe.PrepTime, recipe.CookTime, recipe.ActiveTime, recipe.TotalTime)
 	if err != nil {
 		return fmt.Errorf("creating recipe: %w", err)
 	}
@@ -49,12 +79,20 @@ func (*sqlRecipeDriver) createImpl(ctx context.Context, recipe *models.Recipe, d
 		}
 	}
 
+	if err := saveNutritionForRecipe(ctx, *recipe.ID, recipe.Nutrition, db); err != nil {
+		return fmt.Errorf("adding nutrition to new recipe: %w", err)
+	}
+
+	if err := saveStepsForRecipe(ctx, *recipe.ID, *recipe.Steps, db); err != nil {
+		return fmt.Errorf("adding steps to new recipe: %w", err)
+	}
+
 	return nil
 }
 
 func (d *sqlRecipeDriver) Read(ctx context.Context, id int64) (*models.Recipe, error) {
 	return get(d.Db, func(q sqlx.QueryerContext) (*models.Recipe, error) {
-		stmt := "SELECT r.id, r.name, r.serving_size, r.nutrition_info, r.ingredients, r.directions, r.storage_instructions, r.source_url, r.recipe_time, r.current_state, r.main_image_name, COALESCE(g.rating, 0) AS rating, r.created_at, r.modified_at " +
+		stmt := "SELECT r.id, r.name, r.serving_size, r.nutrition_info, r.ingredients, r.directions, r.storage_instructions, r.source_url, r.recipe_time, r.prep_time, r.cook_time, r.active_time, r.total_time, r.current_state, r.main_image_name, COALESCE(g.rating, 0) AS rating, r.created_at, r.modified_at " +
 			"FROM recipe as r " +
 			"LEFT OUTER JOIN recipe_rating as g ON r.id = g.recipe_id " +
 			"WHERE r.id = $1"
@@ -69,26 +107,138 @@ func (d *sqlRecipeDriver) Read(ctx context.Context, id int64) (*models.Recipe, e
 		}
 		recipe.Tags = *tags
 
+		nutrition := new(models.Nutrition)
+		err = sqlx.GetContext(ctx, q, nutrition,
+			"SELECT "+nutritionColumnsStmt+" FROM recipe_nutrition WHERE recipe_id = $1", id)
+		if err == nil {
+			recipe.Nutrition = nutrition
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("reading nutrition for recipe: %w", err)
+		}
+
+		steps, err := listStepsForRecipe(ctx, id, q)
+		if err != nil {
+			return nil, fmt.Errorf("reading steps for recipe: %w", err)
+		}
+		recipe.Steps = &steps
+
 		return recipe, nil
 	})
 }
 
+func (d *sqlRecipeDriver) List(ctx context.Context) (*[]models.Recipe, error) {
+	return get(d.Db, func(q sqlx.QueryerContext) (*[]models.Recipe, error) {
+		stmt := "SELECT r.id, r.name, r.serving_size, r.nutrition_info, r.ingredients, r.directions, r.storage_instructions, r.source_url, r.recipe_time, r.prep_time, r.cook_time, r.active_time, r.total_time, r.current_state, r.main_image_name, COALESCE(g.rating, 0) AS rating, r.created_at, r.modified_at " +
+			"FROM recipe as r " +
+			"LEFT OUTER JOIN recipe_rating as g ON r.id = g.recipe_id " +
+			"ORDER BY r.id"
+		recipes := make([]models.Recipe, 0)
+		if err := sqlx.SelectContext(ctx, q, &recipes, stmt); err != nil {
+			return nil, err
+		}
+
+		// Load the tags for all recipes at once, rather than one query per recipe
+		var recipeTags []struct {
+			RecipeID int64  `db:"recipe_id"`
+			Tag      string `db:"tag"`
+		}
+		if err := sqlx.SelectContext(ctx, q, &recipeTags, "SELECT recipe_id, tag FROM recipe_tag"); err != nil {
+			return nil, fmt.Errorf("reading tags for recipes: %w", err)
+		}
+		tagsByRecipe := make(map[int64][]string)
+		for _, recipeTag := range recipeTags {
+			tagsByRecipe[recipeTag.RecipeID] = append(tagsByRecipe[recipeTag.RecipeID], recipeTag.Tag)
+		}
+		for i := range recipes {
+			recipes[i].Tags = tagsByRecipe[*recipes[i].ID]
+			if recipes[i].Tags == nil {
+				recipes[i].Tags = make([]string, 0)
+			}
+		}
+
+		// Likewise for the nutrition
+		var recipeNutrition []struct {
+			RecipeID int64 `db:"recipe_id"`
+			models.Nutrition
+		}
+		if err := sqlx.SelectContext(ctx, q, &recipeNutrition, "SELECT recipe_id, "+nutritionColumnsStmt+" FROM recipe_nutrition"); err != nil {
+			return nil, fmt.Errorf("reading nutrition for recipes: %w", err)
+		}
+		nutritionByRecipe := make(map[int64]*models.Nutrition)
+		for i := range recipeNutrition {
+			nutritionByRecipe[recipeNutrition[i].RecipeID] = &recipeNutrition[i].Nutrition
+		}
+		for i := range recipes {
+			recipes[i].Nutrition = nutritionByRecipe[*recipes[i].ID]
+		}
+
+		// And the steps
+		var recipeSteps []struct {
+			RecipeID int64 `db:"recipe_id"`
+			models.RecipeStep
+		}
+		if err := sqlx.SelectContext(ctx, q, &recipeSteps, "SELECT recipe_id, "+stepColumnsStmt+" FROM recipe_step ORDER BY recipe_id, step_number"); err != nil {
+			return nil, fmt.Errorf("reading steps for recipes: %w", err)
+		}
+		stepsByRecipe := make(map[int64][]models.RecipeStep)
+		for _, recipeStep := range recipeSteps {
+			stepsByRecipe[recipeStep.RecipeID] = append(stepsByRecipe[recipeStep.RecipeID], recipeStep.RecipeStep)
+		}
+		for i := range recipes {
+			steps := stepsByRecipe[*recipes[i].ID]
+			if steps == nil {
+				steps = make([]models.RecipeStep, 0)
+			}
+			recipes[i].Steps = &steps
+		}
+
+		return &recipes, nil
+	})
+}
+
+func (d *sqlRecipeDriver) ListIDs(ctx context.Context) ([]int64, error) {
+	return get(d.Db, func(q sqlx.QueryerContext) ([]int64, error) {
+		ids := make([]int64, 0)
+		if err := sqlx.SelectContext(ctx, q, &ids, "SELECT id FROM recipe ORDER BY id"); err != nil {
+			return nil, err
+		}
+		return ids, nil
+	})
+}
+
 func (d *sqlRecipeDriver) Update(ctx context.Context, recipe *models.Recipe) error {
 	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
 		return d.updateImpl(ctx, recipe, db)
 	})
 }
 
-func (*sqlRecipeDriver) updateImpl(ctx context.Context, recipe *models.Recipe, db sqlx.ExecerContext) error {
+func (*sqlRecipeDriver) updateImpl(ctx context.Context, recipe *models.Recipe, db sqlx.ExtContext) error {
 	if recipe.ID == nil {
 		return ErrMissingID
 	}
 
-	_, err := db.ExecContext(ctx,
+	var existing models.Recipe
+	if err := sqlx.GetContext(ctx, db, &existing,
+		"SELECT directions, recipe_time, prep_time, cook_time, active_time, total_time FROM recipe WHERE id = $1", recipe.ID); err != nil {
+		return fmt.Errorf("reading directions and times before updating recipe: %w", err)
+	}
+	clearStaleRecipeTimes(recipe, &existing)
+	fillRecipeTimes(recipe)
+
+	existingSteps, err := listStepsForRecipe(ctx, *recipe.ID, db)
+	if err != nil {
+		return fmt.Errorf("reading steps before updating recipe: %w", err)
+	}
+	clearStaleRecipeSteps(recipe, &existing, existingSteps)
+	fillRecipeSteps(recipe, existingSteps)
+
+	_, err = db.ExecContext(ctx,
 		"UPDATE recipe "+
-			"SET name = $1, serving_size = $2, nutrition_info = $3, ingredients = $4, directions = $5, storage_instructions = $6, source_url = $7, recipe_time = $8, main_image_name = $9 "+
-			"WHERE id = $10",
-		recipe.Name, recipe.ServingSize, recipe.NutritionInfo, recipe.Ingredients, recipe.Directions, recipe.StorageInstructions, recipe.SourceURL, recipe.Time, recipe.MainImageName, recipe.ID)
+			"SET name = $1, serving_size = $2, nutrition_info = $3, ingredients = $4, directions = $5, storage_instructions = $6, source_url = $7, recipe_time = $8, main_image_name = $9, "+
+			"prep_time = $10, cook_time = $11, active_time = $12, total_time = $13 "+
+			"WHERE id = $14",
+		recipe.Name, recipe.ServingSize, recipe.NutritionInfo, recipe.Ingredients, recipe.Directions, recipe.StorageInstructions, recipe.SourceURL, recipe.Time, recipe.MainImageName,
+		recipe.PrepTime, recipe.CookTime, recipe.ActiveTime, recipe.TotalTime, recipe.ID)
 	if err != nil {
 		return fmt.Errorf("updating recipe: %w", err)
 	}
@@ -103,9 +253,43 @@ func (*sqlRecipeDriver) updateImpl(ctx context.Context, recipe *models.Recipe, d
 		}
 	}
 
+	if _, err = db.ExecContext(ctx, "DELETE FROM recipe_nutrition WHERE recipe_id = $1", recipe.ID); err != nil {
+		return fmt.Errorf("deleting nutrition before updating on recipe: %w", err)
+	}
+	if err = saveNutritionForRecipe(ctx, *recipe.ID, recipe.Nutrition, db); err != nil {
+		return fmt.Errorf("updating nutrition on recipe: %w", err)
+	}
+
+	if _, err = db.ExecContext(ctx, "DELETE FROM recipe_step WHERE recipe_id = $1", recipe.ID); err != nil {
+		return fmt.Errorf("deleting steps before updating on recipe: %w", err)
+	}
+	if err = saveStepsForRecipe(ctx, *recipe.ID, *recipe.Steps, db); err != nil {
+		return fmt.Errorf("updating steps on recipe: %w", err)
+	}
+
 	return nil
 }
 
+// The columns of the recipe_nutrition table, in the order they are read and written
+const nutritionColumnsStmt = "calories, protein, fat, carbohydrates, fiber, sodium, sugar"
+
+func saveNutritionForRecipe(ctx context.Context, recipeID int64, nutrition *models.Nutrition, db sqlx.ExecerContext) error {
+	if nutrition == nil {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO recipe_nutrition (recipe_id, "+nutritionColumnsStmt+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		recipeID, nutrition.Calories, nutrition.Protein, nutrition.Fat, nutrition.Carbohydrates, nutrition.Fiber, nutrition.Sodium, nutrition.Sugar)
+	return err
+}
+
+// getNutritionStmt returns the expression for the specified nutrient of each recipe,
+// which is NULL when the recipe doesn't have it
+func getNutritionStmt(column string) string {
+	return "(SELECT n." + column + " FROM recipe_nutrition AS n WHERE n.recipe_id = r.id)"
+}
+
 func (d *sqlRecipeDriver) Patch(ctx context.Context, id int64, patch *models.RecipePatch) error {
 	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
 		return d.patchImpl(ctx, id, patch, db)
@@ -164,6 +348,137 @@ func (*sqlRecipeDriver) deleteImpl(ctx context.Context, id int64, db sqlx.Execer
 	return nil
 }
 
+func (d *sqlRecipeDriver) Merge(ctx context.Context, id int64, duplicateID int64, renamedImages map[string]string) error {
+	if id == duplicateID {
+		return errors.New("cannot merge a recipe with itself")
+	}
+
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.mergeImpl(ctx, id, duplicateID, renamedImages, db)
+	})
+}
+
+func (d *sqlRecipeDriver) mergeImpl(ctx context.Context, id int64, duplicateID int64, renamedImages map[string]string, db *sqlx.Tx) error {
+	var recipes []struct {
+		ID            int64    `db:"id"`
+		MainImageName string   `db:"main_image_name"`
+		Rating        *float32 `db:"rating"`
+	}
+	err := sqlx.SelectContext(ctx, db, &recipes,
+		"SELECT r.id, r.main_image_name, g.rating FROM recipe AS r "+
+			"LEFT OUTER JOIN recipe_rating AS g ON r.id = g.recipe_id "+
+			"WHERE r.id = $1 OR r.id = $2", id, duplicateID)
+	if err != nil {
+		return fmt.Errorf("reading recipes to merge: %w", err)
+	}
+	if len(recipes) != 2 {
+		return ErrNotFound
+	}
+	survivor, duplicate := recipes[0], recipes[1]
+	if survivor.ID != id {
+		survivor, duplicate = duplicate, survivor
+	}
+
+	// Keep the nutrition of the surviving recipe, unless it doesn't have any
+	_, err = db.ExecContext(ctx,
+		"UPDATE recipe_nutrition SET recipe_id = $1 "+
+			"WHERE recipe_id = $2 AND NOT EXISTS (SELECT 1 FROM recipe_nutrition WHERE recipe_id = $1)",
+		id, duplicateID)
+	if err != nil {
+		return fmt.Errorf("merging nutrition: %w", err)
+	}
+
+	// Add the tags that the surviving recipe doesn't already have
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO recipe_tag (recipe_id, tag, tag_key) "+
+			"SELECT CAST($1 AS INTEGER), t.tag, t.tag_key FROM recipe_tag AS t "+
+			"WHERE t.recipe_id = $2 AND t.tag_key NOT IN (SELECT tag_key FROM recipe_tag WHERE recipe_id = $1)",
+		id, duplicateID)
+	if err != nil {
+		return fmt.Errorf("merging tags: %w", err)
+	}
+
+	// Keep the images attached to notes pointing at the right files before moving them
+	for name, newName := range renamedImages {
+		if name == newName {
+			continue
+		}
+		_, err = db.ExecContext(ctx,
+			"UPDATE recipe_note SET image_name = $1 WHERE recipe_id = $2 AND image_name = $3",
+			newName, duplicateID, name)
+		if err != nil {
+			return fmt.Errorf("renaming note images: %w", err)
+		}
+		_, err = db.ExecContext(ctx,
+			"UPDATE recipe_image SET name = $1 WHERE recipe_id = $2 AND name = $3",
+			newName, duplicateID, name)
+		if err != nil {
+			return fmt.Errorf("renaming image details: %w", err)
+		}
+	}
+	if _, err = db.ExecContext(ctx, "UPDATE recipe_note SET recipe_id = $1 WHERE recipe_id = $2", id, duplicateID); err != nil {
+		return fmt.Errorf("merging notes: %w", err)
+	}
+
+	// The images of the duplicate go after those of the surviving recipe, skipping any that it already has
+	var nextSortOrder int
+	if err = sqlx.GetContext(ctx, db, &nextSortOrder, "SELECT "+imageNextSortOrderStmt, id); err != nil {
+		return fmt.Errorf("reading image order: %w", err)
+	}
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO recipe_image (recipe_id, name, caption, alt_text, sort_order, width, height, uploaded_by, created_at) "+
+			"SELECT CAST($1 AS INTEGER), i.name, i.caption, i.alt_text, i.sort_order + $3, i.width, i.height, i.uploaded_by, i.created_at "+
+			"FROM recipe_image AS i "+
+			"WHERE i.recipe_id = $2 AND i.name NOT IN (SELECT name FROM recipe_image WHERE recipe_id = $1)",
+		id, duplicateID, nextSortOrder)
+	if err != nil {
+		return fmt.Errorf("merging image details: %w", err)
+	}
+
+	// Links in both directions, skipping any that the surviving recipe already has or that would link it to itself
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO recipe_link (recipe_id, dest_recipe_id) "+
+			"SELECT DISTINCT CAST($1 AS INTEGER), l.dest_recipe_id FROM recipe_link AS l "+
+			"WHERE l.recipe_id = $2 AND l.dest_recipe_id != $1 "+
+			"AND l.dest_recipe_id NOT IN (SELECT dest_recipe_id FROM recipe_link WHERE recipe_id = $1)",
+		id, duplicateID)
+	if err != nil {
+		return fmt.Errorf("merging links: %w", err)
+	}
+	_, err = db.ExecContext(ctx,
+		"INSERT INTO recipe_link (recipe_id, dest_recipe_id) "+
+			"SELECT DISTINCT l.recipe_id, CAST($1 AS INTEGER) FROM recipe_link AS l "+
+			"WHERE l.dest_recipe_id = $2 AND l.recipe_id != $1 "+
+			"AND l.recipe_id NOT IN (SELECT recipe_id FROM recipe_link WHERE dest_recipe_id = $1)",
+		id, duplicateID)
+	if err != nil {
+		return fmt.Errorf("merging links: %w", err)
+	}
+
+	// Average the ratings if both recipes were rated
+	if duplicate.Rating != nil {
+		rating := *duplicate.Rating
+		if survivor.Rating != nil {
+			rating = (*survivor.Rating + *duplicate.Rating) / 2
+		}
+		if err = d.setRatingImpl(ctx, id, rating, db); err != nil {
+			return fmt.Errorf("merging ratings: %w", err)
+		}
+	}
+
+	if survivor.MainImageName == "" && duplicate.MainImageName != "" {
+		mainImageName := duplicate.MainImageName
+		if newName, ok := renamedImages[mainImageName]; ok {
+			mainImageName = newName
+		}
+		if _, err = db.ExecContext(ctx, "UPDATE recipe SET main_image_name = $1 WHERE id = $2", mainImageName, id); err != nil {
+			return fmt.Errorf("merging main image: %w", err)
+		}
+	}
+
+	return d.deleteImpl(ctx, duplicateID, db)
+}
+
 func (*sqlRecipeDriver) setRatingImpl(ctx context.Context, id int64, rating float32, db *sqlx.Tx) error {
 	count := -1
 	err := sqlx.GetContext(ctx, db, &count, "SELECT count(*) FROM recipe_rating WHERE recipe_id = $1", id)
@@ -186,7 +501,193 @@ func (*sqlRecipeDriver) setRatingImpl(ctx context.Context, id int64, rating floa
 	return nil
 }
 
-func (d *sqlRecipeDriver) Find(ctx context.Context, filter *models.SearchFilter, page int64, count int64) (*[]models.RecipeCompact, int64, error) {
+func (d *sqlRecipeDriver) Find(ctx context.Context, filter *models.SearchFilter, withHighlights bool, page int64, count int64) (*[]models.RecipeCompact, int64, error) {
+	whereStmt, whereArgs, err := getWhereStmt(filter, d.adapter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	countStmt := d.Db.Rebind("SELECT count(r.id) FROM recipe AS r " + whereStmt)
+	if err := sqlx.Get(d.Db, &total, countStmt, whereArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	// Only compute the relevance when it's needed, since it can be expensive
+	rankStmt := ""
+	rankArgs := make([]any, 0)
+	if withHighlights || filter.SortBy == models.SortByRelevance {
+		if stmt, args := getRankStmt(filter.Query, filter.Fields, d.adapter); stmt != "" {
+			rankStmt = fmt.Sprintf(", %s AS relevance", stmt)
+			rankArgs = args
+		}
+	}
+
+	orderStmt := getOrderStmt(filter.SortBy, filter.SortDir, rankStmt != "")
+
+	// Build the offset and limit
+	limitStmt := ""
+	limitArgs := make([]any, 0)
+	if count >= 0 {
+		limitStmt = "LIMIT ? OFFSET ?"
+		limitArgs = append(limitArgs, count, count*(page-1))
+	}
+
+	combinedStr :=
+		"SELECT r.id, r.name, r.current_state, r.created_at, r.modified_at, COALESCE(g.rating, 0) AS rating, r.main_image_name" + rankStmt + " " +
+			"FROM recipe AS r " +
+			"LEFT OUTER JOIN recipe_rating as g ON r.id = g.recipe_id " +
+			fmt.Sprintf("%s %s %s", whereStmt, orderStmt, limitStmt)
+
+	selectArgs := append(append(rankArgs, whereArgs...), limitArgs...)
+	selectStmt := d.Db.Rebind(combinedStr)
+
+	recipes := make([]models.RecipeCompact, 0)
+	if err = sqlx.SelectContext(ctx, d.Db, &recipes, selectStmt, selectArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	if withHighlights {
+		if err = d.loadHighlights(ctx, filter, recipes); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return &recipes, total, nil
+}
+
+func (d *sqlRecipeDriver) GetFacets(ctx context.Context, filter *models.SearchFilter) (*models.SearchFacets, error) {
+	whereStmt, whereArgs, err := getWhereStmt(filter, d.adapter)
+	if err != nil {
+		return nil, err
+	}
+
+	facets := &models.SearchFacets{
+		Tags:      make([]models.FacetCount, 0),
+		States:    make([]models.FacetCount, 0),
+		Pictures:  make([]models.FacetCount, 0),
+		Ratings:   make([]models.FacetCount, 0),
+		CookTimes: make([]models.FacetCount, 0),
+	}
+
+	// Tags that differ only by case are counted together
+	tagsStmt := "SELECT min(t.tag) AS value, count(t.recipe_id) AS count " +
+		"FROM recipe_tag AS t " +
+		"WHERE t.recipe_id IN (SELECT r.id FROM recipe AS r " + whereStmt + ") " +
+		"GROUP BY t.tag_key ORDER BY count DESC, value"
+	if err = sqlx.SelectContext(ctx, d.Db, &facets.Tags, d.Db.Rebind(tagsStmt), whereArgs...); err != nil {
+		return nil, err
+	}
+
+	// The remaining facets are all computed from a single pass over the matching recipes,
+	// grouped on the distinct combinations of values, which are then bucketed here
+	type recipeGroup struct {
+		State       models.RecipeState `db:"current_state"`
+		Rating      float32            `db:"rating"`
+		TotalTime   *models.Duration   `db:"total_time"`
+		HasPictures bool               `db:"has_pictures"`
+		Count       int64              `db:"count"`
+	}
+	groupsStmt := "SELECT r.current_state, COALESCE(g.rating, 0) AS rating, r.total_time, " +
+		"CASE WHEN " + getPicturesStmt(new(true)) + " THEN 1 ELSE 0 END AS has_pictures, count(r.id) AS count " +
+		"FROM recipe AS r " +
+		"LEFT OUTER JOIN recipe_rating as g ON r.id = g.recipe_id " +
+		whereStmt + " " +
+		"GROUP BY r.current_state, COALESCE(g.rating, 0), r.total_time, " +
+		"CASE WHEN " + getPicturesStmt(new(true)) + " THEN 1 ELSE 0 END"
+	groups := make([]recipeGroup, 0)
+	if err = sqlx.SelectContext(ctx, d.Db, &groups, d.Db.Rebind(groupsStmt), whereArgs...); err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]int64)
+	pictures := make(map[string]int64)
+	ratings := make(map[string]int64)
+	cookTimes := make(map[string]int64)
+	for _, group := range groups {
+		states[string(group.State)] += group.Count
+		if group.HasPictures {
+			pictures["with"] += group.Count
+		} else {
+			pictures["without"] += group.Count
+		}
+		ratings[getRatingBucket(group.Rating)] += group.Count
+		cookTimes[getCookTimeBucket(group.TotalTime)] += group.Count
+	}
+
+	facets.States = getFacetCounts(states, []string{string(models.Active), string(models.Archived)})
+	facets.Pictures = getFacetCounts(pictures, []string{"with", "without"})
+	facets.Ratings = getFacetCounts(ratings, []string{"0", "1", "2", "3", "4", "5"})
+	facets.CookTimes = getFacetCounts(cookTimes, cookTimeBucketNames)
+
+	return facets, nil
+}
+
+func (d *sqlRecipeDriver) loadHighlights(ctx context.Context, filter *models.SearchFilter, recipes []models.RecipeCompact) error {
+	text := getSearchText(filter.Query)
+	if text == "" || len(recipes) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(recipes))
+	for _, recipe := range recipes {
+		ids = append(ids, *recipe.ID)
+	}
+
+	// Build a single query that returns a snippet for each field that matched on each recipe
+	highlightStmts := make([]string, 0)
+	highlightArgs := make([]any, 0)
+	for _, field := range getFilterFields(filter.Fields) {
+		snippetStmt, snippetArgs := d.adapter.GetSearchHighlight(field, text)
+		fieldStmt, fieldArgs := d.adapter.GetSearchFields([]models.SearchField{field}, text)
+		if snippetStmt == "" || fieldStmt == "" {
+			continue
+		}
+
+		stmt, args, err := sqlx.In(
+			fmt.Sprintf("SELECT r.id AS recipe_id, '%s' AS field, %s AS snippet FROM recipe AS r WHERE r.id IN (?) AND (%s)", field, snippetStmt, fieldStmt),
+			append(append(snippetArgs, ids), fieldArgs...)...)
+		if err != nil {
+			return err
+		}
+		highlightStmts = append(highlightStmts, stmt)
+		highlightArgs = append(highlightArgs, args...)
+	}
+	if len(highlightStmts) == 0 {
+		return nil
+	}
+
+	type recipeHighlight struct {
+		RecipeID int64              `db:"recipe_id"`
+		Field    models.SearchField `db:"field"`
+		Snippet  sql.NullString     `db:"snippet"`
+	}
+	rows := make([]recipeHighlight, 0)
+	stmt := d.Db.Rebind(strings.Join(highlightStmts, " UNION ALL "))
+	if err := sqlx.SelectContext(ctx, d.Db, &rows, stmt, highlightArgs...); err != nil {
+		return fmt.Errorf("loading highlights: %w", err)
+	}
+
+	highlights := make(map[int64][]models.SearchHighlight)
+	for _, row := range rows {
+		if !row.Snippet.Valid || row.Snippet.String == "" {
+			continue
+		}
+		highlights[row.RecipeID] = append(highlights[row.RecipeID], models.SearchHighlight{
+			Field:   row.Field,
+			Snippet: formatHighlight(row.Field, row.Snippet.String),
+		})
+	}
+	for i := range recipes {
+		if recipeHighlights, ok := highlights[*recipes[i].ID]; ok {
+			recipes[i].Highlights = &recipeHighlights
+		}
+	}
+
+	return nil
+}
+
+func getWhereStmt(filter *models.SearchFilter, adapter sqlRecipeDriverAdapter) (string, []any, error) {
 	whereStmt := "WHERE r.current_state IS NOT NULL"
 	whereArgs := make([]any, 0)
 	var err error
@@ -195,20 +696,24 @@ func (d *sqlRecipeDriver) Find(ctx context.Context, filter *models.SearchFilter,
 	if len(states) > 0 {
 		whereStmt, whereArgs, err = sqlx.In("WHERE r.current_state IN (?)", states)
 		if err != nil {
-			return nil, 0, err
+			return "", nil, err
 		}
 	}
 
 	const appendFmtStr = " AND (%s)"
 
-	if fieldsStmt, fieldsArgs := getFieldsStmt(filter.Query, filter.Fields, d.adapter); fieldsStmt != "" {
+	fieldsStmt, fieldsArgs, err := getFieldsStmt(filter.Query, filter.Fields, adapter)
+	if err != nil {
+		return "", nil, err
+	}
+	if fieldsStmt != "" {
 		whereStmt += fmt.Sprintf(appendFmtStr, fieldsStmt)
 		whereArgs = append(whereArgs, fieldsArgs...)
 	}
 
-	tagsStmt, tagsArgs, err := getTagsStmt(filter.Tags)
+	tagsStmt, tagsArgs, err := getTagsStmt(filter.Tags, filter.TagMatch, filter.ExcludedTags)
 	if err != nil {
-		return nil, 0, err
+		return "", nil, err
 	}
 	if tagsStmt != "" {
 		whereStmt += fmt.Sprintf(appendFmtStr, tagsStmt)
@@ -219,59 +724,187 @@ func (d *sqlRecipeDriver) Find(ctx context.Context, filter *models.SearchFilter,
 		whereStmt += fmt.Sprintf(appendFmtStr, picturesStmt)
 	}
 
-	var total int64
-	countStmt := d.Db.Rebind("SELECT count(r.id) FROM recipe AS r " + whereStmt)
-	if err := sqlx.Get(d.Db, &total, countStmt, whereArgs...); err != nil {
-		return nil, 0, err
+	if filter.MaxTotalTime != nil {
+		whereStmt += fmt.Sprintf(appendFmtStr, "r.total_time <= ?")
+		whereArgs = append(whereArgs, *filter.MaxTotalTime)
 	}
 
-	orderStmt := getOrderStmt(filter.SortBy, filter.SortDir)
+	return whereStmt, whereArgs, nil
+}
 
-	// Build the offset and limit
-	limitStmt := ""
-	limitArgs := make([]any, 0)
-	if count >= 0 {
-		limitStmt = "LIMIT ? OFFSET ?"
-		limitArgs = append(limitArgs, count, count*(page-1))
+// The names of the cook time facet buckets, in order, along with the exclusive upper bound of each
+var (
+	cookTimeBucketNames  = []string{"0-15m", "15-30m", "30-60m", "1-2h", "2h+", "unknown"}
+	cookTimeBucketLimits = []time.Duration{15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour}
+)
+
+func getCookTimeBucket(totalTime *models.Duration) string {
+	if totalTime == nil {
+		return "unknown"
+	}
+	for i, limit := range cookTimeBucketLimits {
+		if time.Duration(*totalTime) < limit {
+			return cookTimeBucketNames[i]
+		}
 	}
+	return cookTimeBucketNames[len(cookTimeBucketLimits)]
+}
 
-	combinedStr :=
-		"SELECT r.id, r.name, r.current_state, r.created_at, r.modified_at, COALESCE(g.rating, 0) AS rating, r.main_image_name " +
-			"FROM recipe AS r " +
-			"LEFT OUTER JOIN recipe_rating as g ON r.id = g.recipe_id " +
-			fmt.Sprintf("%s %s %s", whereStmt, orderStmt, limitStmt)
+func getRatingBucket(rating float32) string {
+	return strconv.Itoa(min(max(int(rating), 0), 5))
+}
 
-	selectArgs := append(whereArgs, limitArgs...)
-	selectStmt := d.Db.Rebind(combinedStr)
+// getFacetCounts converts the counts to a list in the specified order, omitting any values without a count
+func getFacetCounts(counts map[string]int64, order []string) []models.FacetCount {
+	facetCounts := make([]models.FacetCount, 0, len(counts))
+	for _, value := range order {
+		if count := counts[value]; count > 0 {
+			facetCounts = append(facetCounts, models.FacetCount{Value: value, Count: count})
+		}
+	}
+	return facetCounts
+}
 
-	recipes := make([]models.RecipeCompact, 0)
-	if err = sqlx.SelectContext(ctx, d.Db, &recipes, selectStmt, selectArgs...); err != nil {
-		return nil, 0, err
+// snippetPartialTagPattern matches what's left of a tag that a snippet was cut off in the middle of,
+// at either end of it, e.g., the "li>" of "...li>Mix the flour", while keeping any ellipsis
+var snippetPartialTagPattern = regexp.MustCompile(`^(\.\.\.)?/?[a-zA-Z][a-zA-Z0-9]*(?:\s[^<>]*)?>|<[^<>]*?(\.\.\.)?$`)
+
+// formatHighlight removes any markup from snippets of the fields that are edited as HTML, i.e., all but the name,
+// escapes the snippet so that it's safe to render as HTML, and then replaces the highlight delimiters with <mark> elements.
+func formatHighlight(field models.SearchField, snippet string) string {
+	if field != models.SearchFieldName {
+		snippet = plaintext.Plain(snippetPartialTagPattern.ReplaceAllString(snippet, "$1$2"))
+	}
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, highlightStartDelimiter, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStopDelimiter, "</mark>")
+}
+
+func getFieldsStmt(query string, fields []models.SearchField, adapter sqlRecipeDriverAdapter) (string, []any, error) {
+	node, err := parseSearchQuery(query)
+	if err != nil || node == nil {
+		return "", nil, err
 	}
 
-	return &recipes, total, nil
+	compiler := queryCompiler{fields: fields, adapter: adapter}
+	stmt, args := compiler.compile(node)
+	return stmt, args, nil
 }
 
-func getFieldsStmt(query string, fields []models.SearchField, adapter sqlRecipeDriverAdapter) (string, []any) {
-	if query == "" {
+func getRankStmt(query string, fields []models.SearchField, adapter sqlRecipeDriverAdapter) (string, []any) {
+	text := getSearchText(query)
+	if text == "" {
 		return "", nil
 	}
 
+	return adapter.GetSearchRank(getFilterFields(fields), text)
+}
+
+// getSearchText returns the text that should be used to rank and highlight results for the query
+func getSearchText(query string) string {
+	node, err := parseSearchQuery(query)
+	if err != nil || node == nil {
+		return ""
+	}
+
+	return getQueryText(node)
+}
+
+func getFilterFields(fields []models.SearchField) []models.SearchField {
 	// If the filter didn't specify the fields to search on, use all of them
-	filterFields := fields
-	if len(filterFields) == 0 {
-		filterFields = supportedSearchFields[:]
+	if len(fields) == 0 {
+		return supportedSearchFields[:]
 	}
 
-	return adapter.GetSearchFields(filterFields, query)
+	return fields
 }
 
-func getTagsStmt(tags []string) (string, []any, error) {
-	if len(tags) == 0 {
+func getTagsStmt(tags []string, tagMatch models.TagMatch, excludedTags []string) (string, []any, error) {
+	const existsFmtStr = "EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND %s)"
+
+	stmts := make([]string, 0)
+	args := make([]any, 0)
+	if len(tags) > 0 {
+		if tagMatch == models.All {
+			for _, tag := range tags {
+				matchStmt, matchArgs, err := getTagMatchStmt([]string{tag})
+				if err != nil {
+					return "", nil, err
+				}
+				stmts = append(stmts, fmt.Sprintf(existsFmtStr, matchStmt))
+				args = append(args, matchArgs...)
+			}
+		} else {
+			matchStmt, matchArgs, err := getTagMatchStmt(tags)
+			if err != nil {
+				return "", nil, err
+			}
+			stmts = append(stmts, fmt.Sprintf(existsFmtStr, matchStmt))
+			args = append(args, matchArgs...)
+		}
+	}
+
+	if len(excludedTags) > 0 {
+		matchStmt, matchArgs, err := getTagMatchStmt(excludedTags)
+		if err != nil {
+			return "", nil, err
+		}
+		stmts = append(stmts, "NOT "+fmt.Sprintf(existsFmtStr, matchStmt))
+		args = append(args, matchArgs...)
+	}
+
+	if len(stmts) == 0 {
 		return "", nil, nil
 	}
 
-	return sqlx.In("EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND t.tag IN (?))", tags)
+	return strings.Join(stmts, " AND "), args, nil
+}
+
+// tagDescendantsStmt selects the keys of all the tags nested under any of the tags with the specified keys, however deeply
+const tagDescendantsStmt = "WITH RECURSIVE d(tag) AS (" +
+	"SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) " +
+	"UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag" +
+	") SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag"
+
+// getTagMatchStmt returns the condition, and associated arguments, used to match any of the specified tags,
+// regardless of case. A tag also matches any of the tags nested under it,
+// and a tag ending in * matches any tag with that prefix.
+func getTagMatchStmt(tags []string) (string, []any, error) {
+	exactKeys := make([]string, 0)
+	prefixes := make([]string, 0)
+	for _, tag := range tags {
+		if prefix, ok := strings.CutSuffix(tag, "*"); ok {
+			_, key := normalizeTag(prefix)
+			prefixes = append(prefixes, key)
+		} else {
+			_, key := normalizeTag(tag)
+			exactKeys = append(exactKeys, key)
+		}
+	}
+
+	stmts := make([]string, 0)
+	args := make([]any, 0)
+	if len(exactKeys) > 0 {
+		stmt, exactArgs, err := sqlx.In("(t.tag_key IN (?) OR t.tag_key IN ("+tagDescendantsStmt+"))", exactKeys, exactKeys)
+		if err != nil {
+			return "", nil, err
+		}
+		stmts = append(stmts, stmt)
+		args = append(args, exactArgs...)
+	}
+	for _, prefix := range prefixes {
+		stmts = append(stmts, "t.tag_key LIKE ? ESCAPE '\\'")
+		args = append(args, escapeLikePattern(prefix)+"%")
+	}
+
+	if len(stmts) == 1 {
+		return stmts[0], args, nil
+	}
+	return "(" + strings.Join(stmts, " OR ") + ")", args, nil
+}
+
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
 }
 
 func getPicturesStmt(withPictures *bool) string {
@@ -286,7 +919,18 @@ func getPicturesStmt(withPictures *bool) string {
 	return "r.main_image_name IS NOT NULL AND r.main_image_name != ''"
 }
 
-func getOrderStmt(sortBy models.SortBy, sortDir models.SortDir) string {
+// The ways of sorting by nutrition, each of which is named for the column it sorts by
+var nutritionSortBys = []models.SortBy{
+	models.SortByCalories,
+	models.SortByProtein,
+	models.SortByFat,
+	models.SortByCarbohydrates,
+	models.SortByFiber,
+	models.SortBySodium,
+	models.SortBySugar,
+}
+
+func getOrderStmt(sortBy models.SortBy, sortDir models.SortDir, ranked bool) string {
 	stmt := "ORDER BY "
 	switch sortBy {
 	case models.SortByID:
@@ -299,6 +943,22 @@ func getOrderStmt(sortBy models.SortBy, sortDir models.SortDir) string {
 		stmt += "rating"
 	case models.SortByRandom:
 		stmt += "RANDOM()"
+	case models.SortByTotalTime:
+		// Recipes without a total time go last, regardless of the direction
+		stmt += "r.total_time IS NULL, r.total_time"
+	case models.SortByCalories, models.SortByProtein, models.SortByFat, models.SortByCarbohydrates,
+		models.SortByFiber, models.SortBySodium, models.SortBySugar:
+		// Likewise for recipes without the nutrient
+		nutritionStmt := getNutritionStmt(string(sortBy))
+		stmt += nutritionStmt + " IS NULL, " + nutritionStmt
+	case models.SortByRelevance:
+		if ranked {
+			stmt += "relevance"
+			break
+		}
+		// Without a query, there's nothing to rank on, so use the default sort
+		sortBy = models.SortByName
+		fallthrough
 	case models.SortByName:
 		fallthrough
 	default:
@@ -308,11 +968,12 @@ func getOrderStmt(sortBy models.SortBy, sortDir models.SortDir) string {
 		stmt += " DESC"
 	}
 
-	// Need a special case for rating, since the way the execution plan works can
-	// cause uncertain results due to many recipes having the same rating (ties).
+	// Need a special case for rating, relevance, total time, and nutrition, since the way the execution plan works can
+	// cause uncertain results due to many recipes having the same value (ties).
 	// By adding an additional sort to show recently modified recipes first,
 	// this ensures a consistent result.
-	if sortBy == models.SortByRating {
+	if sortBy == models.SortByRating || sortBy == models.SortByRelevance || sortBy == models.SortByTotalTime ||
+		slices.Contains(nutritionSortBys, sortBy) {
 		stmt += ", r.modified_at DESC"
 	}
 
@@ -23,6 +23,7 @@ func recipeFixtureLemonGarlicChicken() models.Recipe {
 		Ingredients:         "1.5 lb chicken thighs\n2 tbsp olive oil\n3 cloves garlic\n1 lemon",
 		Directions:          "Marinate chicken, then roast at 400F until cooked through.",
 		NutritionInfo:       "420 kcal per serving",
+		Nutrition:           &models.Nutrition{Calories: new(float32(420)), Protein: new(float32(38)), Sodium: new(float32(540))},
 		ServingSize:         "4 servings",
 		StorageInstructions: "Refrigerate in an airtight container for up to 3 days.",
 		SourceURL:           "https://example.com/recipes/lemon-garlic-chicken",
@@ -76,26 +77,62 @@ func (simpleSQLRecipeDriverAdapter) GetSearchFields(filterFields []models.Search
 	return stmt, args
 }
 
+func (simpleSQLRecipeDriverAdapter) GetSearchRank(filterFields []models.SearchField, query string) (string, []any) {
+	stmt := ""
+	args := make([]any, 0)
+	for _, field := range filterFields {
+		if stmt != "" {
+			stmt += " + "
+		}
+		stmt += fmt.Sprintf("rank(%s, ?)", field)
+		args = append(args, query)
+	}
+
+	return stmt, args
+}
+
+func (simpleSQLRecipeDriverAdapter) GetSearchHighlight(field models.SearchField, query string) (string, []any) {
+	return fmt.Sprintf("highlight(%s, ?)", field), []any{query}
+}
+
+type mockSearchDriverAdapter struct {
+	mockDriverAdapter
+	simple simpleSQLRecipeDriverAdapter
+}
+
+func (m mockSearchDriverAdapter) GetSearchFields(filterFields []models.SearchField, query string) (string, []any) {
+	return m.simple.GetSearchFields(filterFields, query)
+}
+
+func (m mockSearchDriverAdapter) GetSearchRank(filterFields []models.SearchField, query string) (string, []any) {
+	return m.simple.GetSearchRank(filterFields, query)
+}
+
+func (m mockSearchDriverAdapter) GetSearchHighlight(field models.SearchField, query string) (string, []any) {
+	return m.simple.GetSearchHighlight(field, query)
+}
+
 func Test_Recipe_Create(t *testing.T) {
 	type testArgs struct {
-		recipe        models.Recipe
-		dbError       error
-		expectedError error
+		recipe            models.Recipe
+		expectedTotalTime int64
+		dbError           error
+		expectedError     error
 	}
 
 	// Arrange
 	tests := []testArgs{
 		{
-			recipeFixtureLemonGarlicChicken(), nil, nil,
+			recipeFixtureLemonGarlicChicken(), 2700, nil, nil,
 		},
 		{
-			recipeFixtureSheetPanSausage(), nil, nil,
+			recipeFixtureSheetPanSausage(), 2100, nil, nil,
 		},
 		{
-			recipeFixtureChickpeaSaladWraps(), sql.ErrNoRows, ErrNotFound,
+			recipeFixtureChickpeaSaladWraps(), 1200, sql.ErrNoRows, ErrNotFound,
 		},
 		{
-			recipeFixtureSheetPanSausage(), sql.ErrConnDone, sql.ErrConnDone,
+			recipeFixtureSheetPanSausage(), 2100, sql.ErrConnDone, sql.ErrConnDone,
 		},
 	}
 	for i, test := range tests {
@@ -109,12 +146,23 @@ func Test_Recipe_Create(t *testing.T) {
 			expectedID := rand.Int63()
 
 			dbmock.ExpectBegin()
-			query := dbmock.ExpectQuery("INSERT INTO recipe \\(name, serving_size, nutrition_info, ingredients, directions, storage_instructions, source_url, recipe_time\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7\\, \\$8\\) RETURNING id").
-				WithArgs(test.recipe.Name, test.recipe.ServingSize, test.recipe.NutritionInfo, test.recipe.Ingredients, test.recipe.Directions, test.recipe.StorageInstructions, test.recipe.SourceURL, test.recipe.Time)
+			query := dbmock.ExpectQuery("INSERT INTO recipe \\(name, serving_size, nutrition_info, ingredients, directions, storage_instructions, source_url, recipe_time, prep_time, cook_time, active_time, total_time\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7, \\$8, \\$9, \\$10, \\$11, \\$12\\) RETURNING id").
+				WithArgs(test.recipe.Name, test.recipe.ServingSize, test.recipe.NutritionInfo, test.recipe.Ingredients, test.recipe.Directions, test.recipe.StorageInstructions, test.recipe.SourceURL, test.recipe.Time,
+					nil, nil, nil, test.expectedTotalTime)
 			if test.dbError == nil {
 				query.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(expectedID))
 				for _, tag := range test.recipe.Tags {
-					dbmock.ExpectExec("INSERT INTO recipe_tag \\(recipe_id, tag\\) VALUES \\(\\$1, \\$2\\)").WithArgs(expectedID, tag).
+					dbmock.ExpectExec("INSERT INTO recipe_tag \\(recipe_id, tag, tag_key\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT \\(recipe_id, tag_key\\) DO NOTHING").WithArgs(expectedID, tag, tag).
+						WillReturnResult(driver.RowsAffected(1))
+				}
+				if n := test.recipe.Nutrition; n != nil {
+					dbmock.ExpectExec("INSERT INTO recipe_nutrition \\(recipe_id, calories, protein, fat, carbohydrates, fiber, sodium, sugar\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7, \\$8\\)").
+						WithArgs(expectedID, n.Calories, n.Protein, n.Fat, n.Carbohydrates, n.Fiber, n.Sodium, n.Sugar).
+						WillReturnResult(driver.RowsAffected(1))
+				}
+				for i, step := range splitDirections(test.recipe.Directions) {
+					dbmock.ExpectExec("INSERT INTO recipe_step \\(recipe_id, step_number, step_text, duration, temperature, temperature_unit, image_name\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7\\)").
+						WithArgs(expectedID, i+1, step.Text, step.Duration, step.Temperature, step.TemperatureUnit, step.ImageName).
 						WillReturnResult(driver.RowsAffected(1))
 				}
 				dbmock.ExpectCommit()
@@ -162,14 +210,20 @@ func Test_Recipe_Read(t *testing.T) {
 			sut, dbmock := getMockDb(t, nil)
 			defer sut.Close()
 
-			query := dbmock.ExpectQuery("SELECT r\\.id, r\\.name, r\\.serving_size, r\\.nutrition_info, r\\.ingredients, r\\.directions, r\\.storage_instructions, r\\.source_url, r\\.recipe_time, r\\.current_state, r\\.main_image_name, COALESCE\\(g\\.rating, 0\\) AS rating, r\\.created_at, r\\.modified_at FROM recipe as r LEFT OUTER JOIN recipe_rating as g ON r\\.id = g\\.recipe_id WHERE r\\.id = \\$1").
+			query := dbmock.ExpectQuery("SELECT r\\.id, r\\.name, r\\.serving_size, r\\.nutrition_info, r\\.ingredients, r\\.directions, r\\.storage_instructions, r\\.source_url, r\\.recipe_time, r\\.prep_time, r\\.cook_time, r\\.active_time, r\\.total_time, r\\.current_state, r\\.main_image_name, COALESCE\\(g\\.rating, 0\\) AS rating, r\\.created_at, r\\.modified_at FROM recipe as r LEFT OUTER JOIN recipe_rating as g ON r\\.id = g\\.recipe_id WHERE r\\.id = \\$1").
 				WithArgs(test.recipeID)
 			if test.dbError == nil {
 				fixture := recipeFixtureLemonGarlicChicken()
-				rows := sqlmock.NewRows([]string{"id", "name", "serving_size", "nutrition_info", "ingredients", "directions", "storage_instructions", "source_url", "recipe_time", "current_state", "main_image_name", "rating", "created_at", "modified_at"}).
-					AddRow(test.recipeID, fixture.Name, fixture.ServingSize, fixture.NutritionInfo, fixture.Ingredients, fixture.Directions, fixture.StorageInstructions, fixture.SourceURL, fixture.Time, models.Active, fixture.MainImageName, fixture.Rating, time.Now(), time.Now())
+				rows := sqlmock.NewRows([]string{"id", "name", "serving_size", "nutrition_info", "ingredients", "directions", "storage_instructions", "source_url", "recipe_time", "prep_time", "cook_time", "active_time", "total_time", "current_state", "main_image_name", "rating", "created_at", "modified_at"}).
+					AddRow(test.recipeID, fixture.Name, fixture.ServingSize, fixture.NutritionInfo, fixture.Ingredients, fixture.Directions, fixture.StorageInstructions, fixture.SourceURL, fixture.Time, nil, nil, nil, 2700, models.Active, fixture.MainImageName, fixture.Rating, time.Now(), time.Now())
 				query.WillReturnRows(rows)
 				dbmock.ExpectQuery("SELECT tag FROM recipe_tag WHERE recipe_id = \\$1").WithArgs(test.recipeID).WillReturnRows(&sqlmock.Rows{})
+				dbmock.ExpectQuery("SELECT calories, protein, fat, carbohydrates, fiber, sodium, sugar FROM recipe_nutrition WHERE recipe_id = \\$1").WithArgs(test.recipeID).
+					WillReturnRows(sqlmock.NewRows([]string{"calories", "protein", "fat", "carbohydrates", "fiber", "sodium", "sugar"}).AddRow(420, 38, nil, nil, nil, 540, nil))
+				dbmock.ExpectQuery("SELECT step_text, duration, temperature, temperature_unit, image_name FROM recipe_step WHERE recipe_id = \\$1 ORDER BY step_number").WithArgs(test.recipeID).
+					WillReturnRows(sqlmock.NewRows([]string{"step_text", "duration", "temperature", "temperature_unit", "image_name"}).
+						AddRow("Marinate chicken for 30 minutes.", 1800, nil, nil, nil).
+						AddRow("Roast at 400F until cooked through.", nil, 400, "fahrenheit", "chicken.jpeg"))
 			} else {
 				query.WillReturnError(test.dbError)
 			}
@@ -184,20 +238,179 @@ func Test_Recipe_Read(t *testing.T) {
 			if err := dbmock.ExpectationsWereMet(); err != nil {
 				t.Errorf("there were unfulfilled expectations: %s", err)
 			}
-			if test.expectedError == nil && *recipe.ID != test.recipeID {
-				t.Errorf("ids don't match, expected: %d, received: %d", test.recipeID, *recipe.ID)
+			if test.expectedError == nil {
+				if *recipe.ID != test.recipeID {
+					t.Errorf("ids don't match, expected: %d, received: %d", test.recipeID, *recipe.ID)
+				}
+				if recipe.TotalTime == nil || time.Duration(*recipe.TotalTime) != 45*time.Minute {
+					t.Errorf("expected total time of 45 minutes, received: %v", recipe.TotalTime)
+				}
+				if recipe.Nutrition == nil || *recipe.Nutrition.Calories != 420 || recipe.Nutrition.Fat != nil {
+					t.Errorf("unexpected nutrition: %v", recipe.Nutrition)
+				}
+				expectedSteps := []models.RecipeStep{
+					{Text: "Marinate chicken for 30 minutes.", Duration: new(models.Duration(30 * time.Minute))},
+					{Text: "Roast at 400F until cooked through.", Temperature: new(float32(400)), TemperatureUnit: new(models.Fahrenheit), ImageName: new("chicken.jpeg")},
+				}
+				if recipe.Steps == nil || !reflect.DeepEqual(*recipe.Steps, expectedSteps) {
+					t.Errorf("unexpected steps: %v", recipe.Steps)
+				}
 			}
 		})
 	}
 }
 
-func Test_Recipe_Update(t *testing.T) {
+func Test_Recipe_List(t *testing.T) {
+	type testArgs struct {
+		name           string
+		recipesError   error
+		tagsError      error
+		nutritionError error
+		stepsError     error
+		expectedError  error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", nil, nil, nil, nil, nil},
+		{"Error reading recipes", sql.ErrConnDone, nil, nil, nil, sql.ErrConnDone},
+		{"Error reading tags", nil, sql.ErrConnDone, nil, nil, sql.ErrConnDone},
+		{"Error reading nutrition", nil, nil, sql.ErrConnDone, nil, sql.ErrConnDone},
+		{"Error reading steps", nil, nil, nil, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			query := dbmock.ExpectQuery("SELECT r\\.id, r\\.name, r\\.serving_size, r\\.nutrition_info, r\\.ingredients, r\\.directions, r\\.storage_instructions, r\\.source_url, r\\.recipe_time, r\\.prep_time, r\\.cook_time, r\\.active_time, r\\.total_time, r\\.current_state, r\\.main_image_name, COALESCE\\(g\\.rating, 0\\) AS rating, r\\.created_at, r\\.modified_at FROM recipe as r LEFT OUTER JOIN recipe_rating as g ON r\\.id = g\\.recipe_id ORDER BY r\\.id")
+			if test.recipesError != nil {
+				query.WillReturnError(test.recipesError)
+			} else {
+				chicken := recipeFixtureLemonGarlicChicken()
+				sausage := recipeFixtureSheetPanSausage()
+				query.WillReturnRows(sqlmock.NewRows([]string{"id", "name", "serving_size", "nutrition_info", "ingredients", "directions", "storage_instructions", "source_url", "recipe_time", "prep_time", "cook_time", "active_time", "total_time", "current_state", "main_image_name", "rating", "created_at", "modified_at"}).
+					AddRow(1, chicken.Name, chicken.ServingSize, chicken.NutritionInfo, chicken.Ingredients, chicken.Directions, chicken.StorageInstructions, chicken.SourceURL, chicken.Time, 600, 1800, nil, 2700, models.Active, chicken.MainImageName, chicken.Rating, time.Now(), time.Now()).
+					AddRow(2, sausage.Name, sausage.ServingSize, sausage.NutritionInfo, sausage.Ingredients, sausage.Directions, sausage.StorageInstructions, sausage.SourceURL, sausage.Time, nil, nil, nil, nil, models.Active, sausage.MainImageName, sausage.Rating, time.Now(), time.Now()))
+				tagsQuery := dbmock.ExpectQuery("SELECT recipe_id, tag FROM recipe_tag")
+				if test.tagsError != nil {
+					tagsQuery.WillReturnError(test.tagsError)
+				} else {
+					tagsQuery.WillReturnRows(sqlmock.NewRows([]string{"recipe_id", "tag"}).AddRow(1, "chicken").AddRow(1, "weeknight"))
+					nutritionQuery := dbmock.ExpectQuery("SELECT recipe_id, calories, protein, fat, carbohydrates, fiber, sodium, sugar FROM recipe_nutrition")
+					if test.nutritionError != nil {
+						nutritionQuery.WillReturnError(test.nutritionError)
+					} else {
+						nutritionQuery.WillReturnRows(sqlmock.NewRows([]string{"recipe_id", "calories", "protein", "fat", "carbohydrates", "fiber", "sodium", "sugar"}).
+							AddRow(1, 420, 38, nil, nil, nil, 540, nil))
+						stepsQuery := dbmock.ExpectQuery("SELECT recipe_id, step_text, duration, temperature, temperature_unit, image_name FROM recipe_step ORDER BY recipe_id, step_number")
+						if test.stepsError != nil {
+							stepsQuery.WillReturnError(test.stepsError)
+						} else {
+							stepsQuery.WillReturnRows(sqlmock.NewRows([]string{"recipe_id", "step_text", "duration", "temperature", "temperature_unit", "image_name"}).
+								AddRow(1, "Marinate chicken.", nil, nil, nil, nil).
+								AddRow(1, "Roast at 400F.", nil, 400, "fahrenheit", nil))
+						}
+					}
+				}
+			}
+
+			// Act
+			recipes, err := sut.Recipes().List(t.Context())
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+			if test.expectedError == nil {
+				if len(*recipes) != 2 {
+					t.Fatalf("expected 2 recipes, received %d", len(*recipes))
+				}
+				if !reflect.DeepEqual((*recipes)[0].Tags, []string{"chicken", "weeknight"}) {
+					t.Errorf("unexpected tags on first recipe: %v", (*recipes)[0].Tags)
+				}
+				if !reflect.DeepEqual((*recipes)[1].Tags, []string{}) {
+					t.Errorf("unexpected tags on second recipe: %v", (*recipes)[1].Tags)
+				}
+				if (*recipes)[0].CookTime == nil || time.Duration(*(*recipes)[0].CookTime) != 30*time.Minute {
+					t.Errorf("unexpected cook time on first recipe: %v", (*recipes)[0].CookTime)
+				}
+				if (*recipes)[1].TotalTime != nil {
+					t.Errorf("unexpected total time on second recipe: %v", *(*recipes)[1].TotalTime)
+				}
+				if (*recipes)[0].Nutrition == nil || *(*recipes)[0].Nutrition.Protein != 38 {
+					t.Errorf("unexpected nutrition on first recipe: %v", (*recipes)[0].Nutrition)
+				}
+				if (*recipes)[1].Nutrition != nil {
+					t.Errorf("unexpected nutrition on second recipe: %v", *(*recipes)[1].Nutrition)
+				}
+				if steps := (*recipes)[0].Steps; steps == nil || len(*steps) != 2 || (*steps)[1].Text != "Roast at 400F." {
+					t.Errorf("unexpected steps on first recipe: %v", steps)
+				}
+				if steps := (*recipes)[1].Steps; steps == nil || len(*steps) != 0 {
+					t.Errorf("unexpected steps on second recipe: %v", steps)
+				}
+			}
+		})
+	}
+}
+
+func Test_Recipe_ListIDs(t *testing.T) {
 	type testArgs struct {
-		recipe        models.Recipe
+		name          string
 		dbError       error
 		expectedError error
 	}
 
+	// Arrange
+	tests := []testArgs{
+		{"Success", nil, nil},
+		{"Error", sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			query := dbmock.ExpectQuery("SELECT id FROM recipe ORDER BY id")
+			if test.dbError != nil {
+				query.WillReturnError(test.dbError)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(3))
+			}
+
+			// Act
+			ids, err := sut.Recipes().ListIDs(t.Context())
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			} else if err == nil && !reflect.DeepEqual(ids, []int64{1, 3}) {
+				t.Errorf("unexpected ids: %v", ids)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Recipe_Update(t *testing.T) {
+	type testArgs struct {
+		recipe            models.Recipe
+		existing          *models.Recipe
+		expectedTotalTime any
+		existingSteps     []models.RecipeStep
+		expectedSteps     []models.RecipeStep
+		dbError           error
+		expectedError     error
+	}
+
 	// Arrange
 	tests := []testArgs{
 		{
@@ -205,31 +418,85 @@ func Test_Recipe_Update(t *testing.T) {
 				recipe := recipeFixtureLemonGarlicChicken()
 				recipe.ID = new(int64(1))
 				return recipe
-			}(), nil, nil,
+			}(), nil, int64(2700),
+			[]models.RecipeStep{{Text: "Marinate chicken, then roast at 400F until cooked through.", ImageName: new("chicken.jpeg")}},
+			[]models.RecipeStep{{Text: "Marinate chicken, then roast at 400F until cooked through.", ImageName: new("chicken.jpeg")}},
+			nil, nil,
 		},
 		{
 			func() models.Recipe {
 				recipe := recipeFixtureSheetPanSausage()
 				recipe.ID = new(int64(1))
+				recipe.PrepTime = new(models.Duration(10 * time.Minute))
+				recipe.CookTime = new(models.Duration(25 * time.Minute))
+				recipe.Steps = &[]models.RecipeStep{
+					{Text: "Slice the vegetables and sausage."},
+					{Text: "Roast for 25 minutes.", Duration: new(models.Duration(25 * time.Minute)), Temperature: new(float32(425)), TemperatureUnit: new(models.Fahrenheit)},
+				}
 				return recipe
-			}(), nil, nil,
+			}(), nil, int64(2100),
+			nil,
+			[]models.RecipeStep{
+				{Text: "Slice the vegetables and sausage."},
+				{Text: "Roast for 25 minutes.", Duration: new(models.Duration(25 * time.Minute)), Temperature: new(float32(425)), TemperatureUnit: new(models.Fahrenheit)},
+			},
+			nil, nil,
 		},
 		{
 			func() models.Recipe {
 				recipe := recipeFixtureChickpeaSaladWraps()
 				recipe.ID = new(int64(2))
 				return recipe
-			}(), sql.ErrNoRows, ErrNotFound,
+			}(), nil, int64(1200), nil, nil, sql.ErrNoRows, ErrNotFound,
 		},
 		{
 			func() models.Recipe {
 				recipe := recipeFixtureSheetPanSausage()
 				recipe.ID = new(int64(3))
+				recipe.Time = "overnight"
+				return recipe
+			}(), nil, nil, nil, nil, sql.ErrConnDone, sql.ErrConnDone,
+		},
+		{
+			func() models.Recipe {
+				recipe := recipeFixtureLemonGarlicChicken()
+				recipe.ID = new(int64(4))
+				recipe.Time = "1 hour"
+				recipe.TotalTime = new(models.Duration(45 * time.Minute))
+				recipe.Steps = &[]models.RecipeStep{{Text: "Roast the chicken."}}
 				return recipe
-			}(), sql.ErrConnDone, sql.ErrConnDone,
+			}(), &models.Recipe{Time: "45 minutes", TotalTime: new(models.Duration(45 * time.Minute))}, int64(3600),
+			nil, []models.RecipeStep{{Text: "Roast the chicken."}}, nil, nil,
 		},
 		{
-			func() models.Recipe { recipe := recipeFixtureChickpeaSaladWraps(); return recipe }(), nil, ErrMissingID,
+			// The steps that were loaded are sent back along with the edited directions, so they're split again
+			func() models.Recipe {
+				recipe := recipeFixtureLemonGarlicChicken()
+				recipe.ID = new(int64(5))
+				recipe.Directions = "<ol><li>Marinate the chicken.</li><li>Roast at 400F for 45 minutes.</li></ol>"
+				recipe.Steps = &[]models.RecipeStep{
+					{Text: "Marinate the chicken.", ImageName: new("chicken.jpeg")},
+					{Text: "Roast at 400F.", Temperature: new(float32(400)), TemperatureUnit: new(models.Fahrenheit)},
+				}
+				return recipe
+			}(),
+			func() *models.Recipe {
+				recipe := recipeFixtureLemonGarlicChicken()
+				recipe.Directions = "<ol><li>Marinate the chicken.</li><li>Roast at 400F.</li></ol>"
+				return &recipe
+			}(), int64(2700),
+			[]models.RecipeStep{
+				{Text: "Marinate the chicken.", ImageName: new("chicken.jpeg")},
+				{Text: "Roast at 400F.", Temperature: new(float32(400)), TemperatureUnit: new(models.Fahrenheit)},
+			},
+			[]models.RecipeStep{
+				{Text: "Marinate the chicken.", ImageName: new("chicken.jpeg")},
+				{Text: "Roast at 400F for 45 minutes.", Duration: new(models.Duration(45 * time.Minute)), Temperature: new(float32(400)), TemperatureUnit: new(models.Fahrenheit)},
+			},
+			nil, nil,
+		},
+		{
+			func() models.Recipe { recipe := recipeFixtureChickpeaSaladWraps(); return recipe }(), nil, nil, nil, nil, nil, ErrMissingID,
 		},
 	}
 	for i, test := range tests {
@@ -245,13 +512,46 @@ func Test_Recipe_Update(t *testing.T) {
 			if test.expectedError != nil && test.dbError == nil {
 				dbmock.ExpectRollback()
 			} else {
-				exec := dbmock.ExpectExec("UPDATE recipe SET name = \\$1, serving_size = \\$2, nutrition_info = \\$3, ingredients = \\$4, directions = \\$5, storage_instructions = \\$6, source_url = \\$7, recipe_time = \\$8, main_image_name = \\$9 WHERE id = \\$10").
-					WithArgs(test.recipe.Name, test.recipe.ServingSize, test.recipe.NutritionInfo, test.recipe.Ingredients, test.recipe.Directions, test.recipe.StorageInstructions, test.recipe.SourceURL, test.recipe.Time, test.recipe.MainImageName, test.recipe.ID)
+				existing := test.existing
+				if existing == nil {
+					existing = &test.recipe
+				}
+				dbmock.ExpectQuery("SELECT directions, recipe_time, prep_time, cook_time, active_time, total_time FROM recipe WHERE id = \\$1").
+					WithArgs(test.recipe.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"directions", "recipe_time", "prep_time", "cook_time", "active_time", "total_time"}).
+						AddRow(existing.Directions, existing.Time, existing.PrepTime, existing.CookTime, existing.ActiveTime, existing.TotalTime))
+				existingRows := sqlmock.NewRows([]string{"step_text", "duration", "temperature", "temperature_unit", "image_name"})
+				for _, step := range test.existingSteps {
+					existingRows.AddRow(step.Text, step.Duration, step.Temperature, step.TemperatureUnit, step.ImageName)
+				}
+				dbmock.ExpectQuery("SELECT step_text, duration, temperature, temperature_unit, image_name FROM recipe_step WHERE recipe_id = \\$1 ORDER BY step_number").
+					WithArgs(test.recipe.ID).WillReturnRows(existingRows)
+				// The directions are replaced with the text of any specified steps,
+				// unless they're the existing steps sent back along with edited directions
+				expectedDirections := test.recipe.Directions
+				if test.recipe.Steps != nil && (existing.Directions == test.recipe.Directions || !reflect.DeepEqual(*test.recipe.Steps, test.existingSteps)) {
+					expectedDirections = joinSteps(*test.recipe.Steps)
+				}
+				exec := dbmock.ExpectExec("UPDATE recipe SET name = \\$1, serving_size = \\$2, nutrition_info = \\$3, ingredients = \\$4, directions = \\$5, storage_instructions = \\$6, source_url = \\$7, recipe_time = \\$8, main_image_name = \\$9, prep_time = \\$10, cook_time = \\$11, active_time = \\$12, total_time = \\$13 WHERE id = \\$14").
+					WithArgs(test.recipe.Name, test.recipe.ServingSize, test.recipe.NutritionInfo, test.recipe.Ingredients, expectedDirections, test.recipe.StorageInstructions, test.recipe.SourceURL, test.recipe.Time, test.recipe.MainImageName,
+						test.recipe.PrepTime, test.recipe.CookTime, test.recipe.ActiveTime, test.expectedTotalTime, test.recipe.ID)
 				if test.dbError == nil {
 					exec.WillReturnResult(driver.RowsAffected(1))
 					dbmock.ExpectExec("DELETE FROM recipe_tag WHERE recipe_id = \\$1").WithArgs(test.recipe.ID).WillReturnResult(driver.RowsAffected(0))
 					for _, tag := range test.recipe.Tags {
-						dbmock.ExpectExec("INSERT INTO recipe_tag \\(recipe_id, tag\\) VALUES \\(\\$1, \\$2\\)").WithArgs(test.recipe.ID, tag).
+						dbmock.ExpectExec("INSERT INTO recipe_tag \\(recipe_id, tag, tag_key\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT \\(recipe_id, tag_key\\) DO NOTHING").WithArgs(test.recipe.ID, tag, tag).
+							WillReturnResult(driver.RowsAffected(1))
+					}
+					dbmock.ExpectExec("DELETE FROM recipe_nutrition WHERE recipe_id = \\$1").WithArgs(test.recipe.ID).WillReturnResult(driver.RowsAffected(0))
+					if n := test.recipe.Nutrition; n != nil {
+						dbmock.ExpectExec("INSERT INTO recipe_nutrition \\(recipe_id, calories, protein, fat, carbohydrates, fiber, sodium, sugar\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7, \\$8\\)").
+							WithArgs(test.recipe.ID, n.Calories, n.Protein, n.Fat, n.Carbohydrates, n.Fiber, n.Sodium, n.Sugar).
+							WillReturnResult(driver.RowsAffected(1))
+					}
+					dbmock.ExpectExec("DELETE FROM recipe_step WHERE recipe_id = \\$1").WithArgs(test.recipe.ID).WillReturnResult(driver.RowsAffected(0))
+					for i, step := range test.expectedSteps {
+						dbmock.ExpectExec("INSERT INTO recipe_step \\(recipe_id, step_number, step_text, duration, temperature, temperature_unit, image_name\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7\\)").
+							WithArgs(test.recipe.ID, i+1, step.Text, step.Duration, step.Temperature, step.TemperatureUnit, step.ImageName).
 							WillReturnResult(driver.RowsAffected(1))
 					}
 					dbmock.ExpectCommit()
@@ -455,6 +755,96 @@ func Test_Recipe_Delete(t *testing.T) {
 	}
 }
 
+func Test_Recipe_Merge(t *testing.T) {
+	type testArgs struct {
+		name             string
+		rows             [][]driver.Value
+		expectedRating   *float32
+		expectedMainName *string
+		expectedError    error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name:             "Ratings averaged and main image taken from duplicate",
+			rows:             [][]driver.Value{{2, "b.jpeg", 2.0}, {1, "", 4.0}},
+			expectedRating:   new(float32(3)),
+			expectedMainName: new("2-b.jpeg"),
+		},
+		{
+			name: "Survivor keeps its main image and rating",
+			rows: [][]driver.Value{{1, "a.jpeg", 4.0}, {2, "b.jpeg", nil}},
+		},
+		{
+			name:          "Recipe not found",
+			rows:          [][]driver.Value{{1, "", nil}},
+			expectedError: ErrNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			rows := sqlmock.NewRows([]string{"id", "main_image_name", "rating"})
+			for _, row := range test.rows {
+				rows.AddRow(row...)
+			}
+			dbmock.ExpectBegin()
+			dbmock.ExpectQuery("SELECT r\\.id, r\\.main_image_name, g\\.rating FROM recipe AS r LEFT OUTER JOIN recipe_rating AS g ON r\\.id = g\\.recipe_id WHERE r\\.id = \\$1 OR r\\.id = \\$2").
+				WithArgs(1, 2).
+				WillReturnRows(rows)
+			if test.expectedError != nil {
+				dbmock.ExpectRollback()
+			} else {
+				dbmock.ExpectExec("UPDATE recipe_nutrition SET recipe_id = \\$1 WHERE recipe_id = \\$2 AND NOT EXISTS \\(SELECT 1 FROM recipe_nutrition WHERE recipe_id = \\$1\\)").
+					WithArgs(1, 2).WillReturnResult(driver.RowsAffected(0))
+				dbmock.ExpectExec("INSERT INTO recipe_tag \\(recipe_id, tag, tag_key\\) SELECT CAST\\(\\$1 AS INTEGER\\), t\\.tag, t\\.tag_key FROM recipe_tag AS t WHERE t\\.recipe_id = \\$2 AND t\\.tag_key NOT IN \\(SELECT tag_key FROM recipe_tag WHERE recipe_id = \\$1\\)").
+					WithArgs(1, 2).WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectExec("UPDATE recipe_note SET image_name = \\$1 WHERE recipe_id = \\$2 AND image_name = \\$3").
+					WithArgs("2-b.jpeg", 2, "b.jpeg").WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectExec("UPDATE recipe_image SET name = \\$1 WHERE recipe_id = \\$2 AND name = \\$3").
+					WithArgs("2-b.jpeg", 2, "b.jpeg").WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectExec("UPDATE recipe_note SET recipe_id = \\$1 WHERE recipe_id = \\$2").
+					WithArgs(1, 2).WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectQuery("SELECT \\(SELECT COALESCE\\(MAX\\(sort_order\\) \\+ 1, 0\\) FROM recipe_image WHERE recipe_id = \\$1\\)").
+					WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"sort_order"}).AddRow(3))
+				dbmock.ExpectExec("INSERT INTO recipe_image \\(recipe_id, name, caption, alt_text, sort_order, width, height, uploaded_by, created_at\\) SELECT CAST\\(\\$1 AS INTEGER\\), i\\.name, .* FROM recipe_image AS i WHERE i\\.recipe_id = \\$2 AND i\\.name NOT IN \\(SELECT name FROM recipe_image WHERE recipe_id = \\$1\\)").
+					WithArgs(1, 2, 3).WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectExec("INSERT INTO recipe_link \\(recipe_id, dest_recipe_id\\) SELECT DISTINCT CAST\\(\\$1 AS INTEGER\\), l\\.dest_recipe_id FROM recipe_link AS l WHERE l\\.recipe_id = \\$2").
+					WithArgs(1, 2).WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectExec("INSERT INTO recipe_link \\(recipe_id, dest_recipe_id\\) SELECT DISTINCT l\\.recipe_id, CAST\\(\\$1 AS INTEGER\\) FROM recipe_link AS l WHERE l\\.dest_recipe_id = \\$2").
+					WithArgs(1, 2).WillReturnResult(driver.RowsAffected(1))
+				if test.expectedRating != nil {
+					dbmock.ExpectQuery("SELECT count\\(\\*\\) FROM recipe_rating WHERE recipe_id = \\$1").
+						WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+					dbmock.ExpectExec("UPDATE recipe_rating SET rating = \\$1 WHERE recipe_id = \\$2").
+						WithArgs(*test.expectedRating, 1).WillReturnResult(driver.RowsAffected(1))
+				}
+				if test.expectedMainName != nil {
+					dbmock.ExpectExec("UPDATE recipe SET main_image_name = \\$1 WHERE id = \\$2").
+						WithArgs(*test.expectedMainName, 1).WillReturnResult(driver.RowsAffected(1))
+				}
+				dbmock.ExpectExec("DELETE FROM recipe WHERE id = \\$1").WithArgs(2).WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			}
+
+			// Act
+			err := sut.Recipes().Merge(t.Context(), 1, 2, map[string]string{"b.jpeg": "2-b.jpeg"})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
 func Test_getFieldsStmt(t *testing.T) {
 	type args struct {
 		query   string
@@ -550,7 +940,10 @@ func Test_getFieldsStmt(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotStmt, gotArgs := getFieldsStmt(tt.args.query, tt.args.fields, tt.args.adapter)
+			gotStmt, gotArgs, err := getFieldsStmt(tt.args.query, tt.args.fields, tt.args.adapter)
+			if err != nil {
+				t.Errorf("getFieldsStmt() unexpected error = %v", err)
+			}
 			if gotStmt != tt.wantStmt {
 				t.Errorf("getFieldsStmt() gotStmt = %v, wantStmt %v", gotStmt, tt.wantStmt)
 			}
@@ -563,7 +956,9 @@ func Test_getFieldsStmt(t *testing.T) {
 
 func Test_getTagsStmt(t *testing.T) {
 	type args struct {
-		tags []string
+		tags         []string
+		tagMatch     models.TagMatch
+		excludedTags []string
 	}
 	tests := []struct {
 		name     string
@@ -584,13 +979,56 @@ func Test_getTagsStmt(t *testing.T) {
 			args: args{
 				tags: []string{"foo", "bar"},
 			},
-			wantStmt: "EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND t.tag IN (?, ?))",
-			wantArgs: []any{"foo", "bar"},
+			wantStmt: "EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?, ?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?, ?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)))",
+			wantArgs: []any{"foo", "bar", "foo", "bar"},
+		},
+		{
+			name: "Match any",
+			args: args{
+				tags:     []string{"foo", "bar"},
+				tagMatch: models.Any,
+			},
+			wantStmt: "EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?, ?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?, ?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)))",
+			wantArgs: []any{"foo", "bar", "foo", "bar"},
+		},
+		{
+			name: "Match all",
+			args: args{
+				tags:     []string{"foo", "bar"},
+				tagMatch: models.All,
+			},
+			wantStmt: "EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag))) AND EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)))",
+			wantArgs: []any{"foo", "foo", "bar", "bar"},
+		},
+		{
+			name: "Prefix",
+			args: args{
+				tags: []string{"foo", "bar*", "100%_\\*"},
+			},
+			wantStmt: "EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND ((t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)) OR t.tag_key LIKE ? ESCAPE '\\' OR t.tag_key LIKE ? ESCAPE '\\'))",
+			wantArgs: []any{"foo", "foo", "bar%", "100\\%\\_\\\\%"},
+		},
+		{
+			name: "Excluded",
+			args: args{
+				excludedTags: []string{"foo", "bar*"},
+			},
+			wantStmt: "NOT EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND ((t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)) OR t.tag_key LIKE ? ESCAPE '\\'))",
+			wantArgs: []any{"foo", "foo", "bar%"},
+		},
+		{
+			name: "Included and excluded",
+			args: args{
+				tags:         []string{"foo"},
+				excludedTags: []string{"bar"},
+			},
+			wantStmt: "EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag))) AND NOT EXISTS (SELECT 1 FROM recipe_tag AS t WHERE t.recipe_id = r.id AND (t.tag_key IN (?) OR t.tag_key IN (WITH RECURSIVE d(tag) AS (SELECT c.tag FROM tag AS c JOIN tag AS p ON c.parent_tag = p.tag WHERE p.tag_key IN (?) UNION SELECT c.tag FROM tag AS c JOIN d ON c.parent_tag = d.tag) SELECT e.tag_key FROM tag AS e JOIN d ON e.tag = d.tag)))",
+			wantArgs: []any{"foo", "foo", "bar", "bar"},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotStmt, gotArgs, err := getTagsStmt(tt.args.tags)
+			gotStmt, gotArgs, err := getTagsStmt(tt.args.tags, tt.args.tagMatch, tt.args.excludedTags)
 			if err != nil {
 				t.Error(err)
 			}
@@ -649,6 +1087,7 @@ func Test_getOrderStmt(t *testing.T) {
 	type args struct {
 		sortBy  models.SortBy
 		sortDir models.SortDir
+		ranked  bool
 	}
 	tests := []struct {
 		name string
@@ -751,10 +1190,68 @@ func Test_getOrderStmt(t *testing.T) {
 			},
 			want: "ORDER BY RANDOM() DESC",
 		},
+		{
+			name: "Total time, ASC",
+			args: args{
+				sortBy:  models.SortByTotalTime,
+				sortDir: models.Asc,
+			},
+			want: "ORDER BY r.total_time IS NULL, r.total_time, r.modified_at DESC",
+		},
+		{
+			name: "Total time, DESC",
+			args: args{
+				sortBy:  models.SortByTotalTime,
+				sortDir: models.Desc,
+			},
+			want: "ORDER BY r.total_time IS NULL, r.total_time DESC, r.modified_at DESC",
+		},
+		{
+			name: "Calories, ASC",
+			args: args{
+				sortBy:  models.SortByCalories,
+				sortDir: models.Asc,
+			},
+			want: "ORDER BY (SELECT n.calories FROM recipe_nutrition AS n WHERE n.recipe_id = r.id) IS NULL, (SELECT n.calories FROM recipe_nutrition AS n WHERE n.recipe_id = r.id), r.modified_at DESC",
+		},
+		{
+			name: "Protein, DESC",
+			args: args{
+				sortBy:  models.SortByProtein,
+				sortDir: models.Desc,
+			},
+			want: "ORDER BY (SELECT n.protein FROM recipe_nutrition AS n WHERE n.recipe_id = r.id) IS NULL, (SELECT n.protein FROM recipe_nutrition AS n WHERE n.recipe_id = r.id) DESC, r.modified_at DESC",
+		},
+		{
+			name: "Relevance, ASC",
+			args: args{
+				sortBy:  models.SortByRelevance,
+				sortDir: models.Asc,
+				ranked:  true,
+			},
+			want: "ORDER BY relevance, r.modified_at DESC",
+		},
+		{
+			name: "Relevance, DESC",
+			args: args{
+				sortBy:  models.SortByRelevance,
+				sortDir: models.Desc,
+				ranked:  true,
+			},
+			want: "ORDER BY relevance DESC, r.modified_at DESC",
+		},
+		{
+			name: "Relevance, Not Ranked",
+			args: args{
+				sortBy:  models.SortByRelevance,
+				sortDir: models.Desc,
+			},
+			want: "ORDER BY r.name DESC",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := getOrderStmt(tt.args.sortBy, tt.args.sortDir); got != tt.want {
+			if got := getOrderStmt(tt.args.sortBy, tt.args.sortDir, tt.args.ranked); got != tt.want {
 				t.Errorf("getOrderStmt() = %v, want %v", got, tt.want)
 			}
 		})
@@ -762,9 +1259,10 @@ func Test_getOrderStmt(t *testing.T) {
 }
 func Test_sqlRecipeDriver_Find(t *testing.T) {
 	type args struct {
-		filter *models.SearchFilter
-		page   int64
-		count  int64
+		filter         *models.SearchFilter
+		withHighlights bool
+		page           int64
+		count          int64
 	}
 	type testCase struct {
 		name           string
@@ -833,11 +1331,11 @@ func Test_sqlRecipeDriver_Find(t *testing.T) {
 			},
 			setupMock: func(dbmock sqlmock.Sqlmock) {
 				// sqlx.In expands the IN clause
-				dbmock.ExpectQuery("SELECT count\\(r\\.id\\) FROM recipe AS r WHERE r\\.current_state IS NOT NULL AND \\(EXISTS \\(SELECT 1 FROM recipe_tag AS t WHERE t\\.recipe_id = r\\.id AND t.tag IN \\(\\?, \\?\\)\\)\\)").
-					WithArgs("tag1", "tag2").
+				dbmock.ExpectQuery("SELECT count\\(r\\.id\\) FROM recipe AS r WHERE r\\.current_state IS NOT NULL AND \\(EXISTS \\(SELECT 1 FROM recipe_tag AS t WHERE t\\.recipe_id = r\\.id AND \\(t\\.tag_key IN \\(\\?, \\?\\) OR t\\.tag_key IN \\(WITH RECURSIVE d\\(tag\\) AS \\(SELECT c\\.tag FROM tag AS c JOIN tag AS p ON c\\.parent_tag = p\\.tag WHERE p\\.tag_key IN \\(\\?, \\?\\) UNION SELECT c\\.tag FROM tag AS c JOIN d ON c\\.parent_tag = d\\.tag\\) SELECT e\\.tag_key FROM tag AS e JOIN d ON e\\.tag = d\\.tag\\)\\)\\)\\)").
+					WithArgs("tag1", "tag2", "tag1", "tag2").
 					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
-				dbmock.ExpectQuery("SELECT r\\.id, r\\.name, r\\.current_state, r\\.created_at, r\\.modified_at, COALESCE\\(g\\.rating, 0\\) AS rating, r\\.main_image_name FROM recipe AS r LEFT OUTER JOIN recipe_rating as g ON r\\.id = g\\.recipe_id WHERE r\\.current_state IS NOT NULL AND \\(EXISTS \\(SELECT 1 FROM recipe_tag AS t WHERE t\\.recipe_id = r\\.id AND t\\.tag IN \\(\\?, \\?\\)\\)\\) ORDER BY r\\.name LIMIT \\? OFFSET \\?").
-					WithArgs("tag1", "tag2", 1, 0).
+				dbmock.ExpectQuery("SELECT r\\.id, r\\.name, r\\.current_state, r\\.created_at, r\\.modified_at, COALESCE\\(g\\.rating, 0\\) AS rating, r\\.main_image_name FROM recipe AS r LEFT OUTER JOIN recipe_rating as g ON r\\.id = g\\.recipe_id WHERE r\\.current_state IS NOT NULL AND \\(EXISTS \\(SELECT 1 FROM recipe_tag AS t WHERE t\\.recipe_id = r\\.id AND \\(t\\.tag_key IN \\(\\?, \\?\\) OR t\\.tag_key IN \\(WITH RECURSIVE d\\(tag\\) AS \\(SELECT c\\.tag FROM tag AS c JOIN tag AS p ON c\\.parent_tag = p\\.tag WHERE p\\.tag_key IN \\(\\?, \\?\\) UNION SELECT c\\.tag FROM tag AS c JOIN d ON c\\.parent_tag = d\\.tag\\) SELECT e\\.tag_key FROM tag AS e JOIN d ON e\\.tag = d\\.tag\\)\\)\\)\\) ORDER BY r\\.name LIMIT \\? OFFSET \\?").
+					WithArgs("tag1", "tag2", "tag1", "tag2", 1, 0).
 					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "current_state", "created_at", "modified_at", "rating", "main_image_name"}).
 						AddRow(4, "Recipe4", models.Active, time.Now(), time.Now(), 5.0, "url4"))
 			},
@@ -868,6 +1366,63 @@ func Test_sqlRecipeDriver_Find(t *testing.T) {
 			},
 			expectedTotal: 1,
 		},
+		{
+			name: "Find with max total time, sorted by total time",
+			args: args{
+				filter: &models.SearchFilter{MaxTotalTime: new(models.Duration(30 * time.Minute)), SortBy: models.SortByTotalTime},
+				page:   1,
+				count:  1,
+			},
+			setupMock: func(dbmock sqlmock.Sqlmock) {
+				dbmock.ExpectQuery("SELECT count\\(r\\.id\\) FROM recipe AS r WHERE r\\.current_state IS NOT NULL AND \\(r\\.total_time <= \\?\\)").
+					WithArgs(1800).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				dbmock.ExpectQuery("SELECT r\\.id, r\\.name, r\\.current_state, r\\.created_at, r\\.modified_at, COALESCE\\(g\\.rating, 0\\) AS rating, r\\.main_image_name FROM recipe AS r LEFT OUTER JOIN recipe_rating as g ON r\\.id = g\\.recipe_id WHERE r\\.current_state IS NOT NULL AND \\(r\\.total_time <= \\?\\) ORDER BY r\\.total_time IS NULL, r\\.total_time, r\\.modified_at DESC LIMIT \\? OFFSET \\?").
+					WithArgs(1800, 1, 0).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "current_state", "created_at", "modified_at", "rating", "main_image_name"}).
+						AddRow(7, "Recipe7", models.Active, time.Now(), time.Now(), 3.0, "url7"))
+			},
+			expectedErr: nil,
+			expectedResult: &[]models.RecipeCompact{
+				{ID: new(int64(7)), Name: "Recipe7", State: models.Active, Rating: new(float32(3.0)), MainImageName: "url7"},
+			},
+			expectedTotal: 1,
+		},
+		{
+			name: "Find with relevance and highlights",
+			args: args{
+				filter: &models.SearchFilter{
+					Query:  "chicken",
+					Fields: []models.SearchField{models.SearchFieldName},
+					SortBy: models.SortByRelevance,
+				},
+				withHighlights: true,
+				page:           1,
+				count:          1,
+			},
+			setupMock: func(dbmock sqlmock.Sqlmock) {
+				dbmock.ExpectQuery("SELECT count\\(r\\.id\\) FROM recipe AS r WHERE r\\.current_state IS NOT NULL AND \\(name = \\? \\)").
+					WithArgs("chicken").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				dbmock.ExpectQuery("SELECT r\\.id, r\\.name, r\\.current_state, r\\.created_at, r\\.modified_at, COALESCE\\(g\\.rating, 0\\) AS rating, r\\.main_image_name, rank\\(name, \\?\\) AS relevance FROM recipe AS r LEFT OUTER JOIN recipe_rating as g ON r\\.id = g\\.recipe_id WHERE r\\.current_state IS NOT NULL AND \\(name = \\? \\) ORDER BY relevance, r\\.modified_at DESC LIMIT \\? OFFSET \\?").
+					WithArgs("chicken", "chicken", 1, 0).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "current_state", "created_at", "modified_at", "rating", "main_image_name", "relevance"}).
+						AddRow(6, "Chicken <Soup>", models.Active, time.Now(), time.Now(), 4.0, "url6", 0.75))
+				dbmock.ExpectQuery("SELECT r\\.id AS recipe_id, 'name' AS field, highlight\\(name, \\?\\) AS snippet FROM recipe AS r WHERE r\\.id IN \\(\\?\\) AND \\(name = \\? \\)").
+					WithArgs("chicken", 6, "chicken").
+					WillReturnRows(sqlmock.NewRows([]string{"recipe_id", "field", "snippet"}).
+						AddRow(6, "name", "\x02Chicken\x03 <Soup>"))
+			},
+			expectedErr: nil,
+			expectedResult: &[]models.RecipeCompact{
+				{
+					ID: new(int64(6)), Name: "Chicken <Soup>", State: models.Active, Rating: new(float32(4.0)), MainImageName: "url6",
+					Relevance:  new(float32(0.75)),
+					Highlights: &[]models.SearchHighlight{{Field: models.SearchFieldName, Snippet: "<mark>Chicken</mark> &lt;Soup&gt;"}},
+				},
+			},
+			expectedTotal: 1,
+		},
 		{
 			name: "Find returns error on count",
 			args: args{
@@ -907,12 +1462,12 @@ func Test_sqlRecipeDriver_Find(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
-			sut, dbmock := getMockDb(t, nil)
+			sut, dbmock := getMockDb(t, mockSearchDriverAdapter{})
 			defer sut.Close()
 			if tt.setupMock != nil {
 				tt.setupMock(dbmock)
 			}
-			got, total, err := sut.Recipes().Find(t.Context(), tt.args.filter, tt.args.page, tt.args.count)
+			got, total, err := sut.Recipes().Find(t.Context(), tt.args.filter, tt.args.withHighlights, tt.args.page, tt.args.count)
 			if !errors.Is(err, tt.expectedErr) {
 				t.Errorf("expected error: %v, got: %v", tt.expectedErr, err)
 			}
@@ -941,6 +1496,12 @@ func Test_sqlRecipeDriver_Find(t *testing.T) {
 					if gotItem.MainImageName != wantItem.MainImageName {
 						t.Errorf("result at index %d: MainImageName mismatch: got %v, want %v", i, gotItem.MainImageName, wantItem.MainImageName)
 					}
+					if !reflect.DeepEqual(gotItem.Relevance, wantItem.Relevance) {
+						t.Errorf("result at index %d: Relevance mismatch: got %v, want %v", i, gotItem.Relevance, wantItem.Relevance)
+					}
+					if !reflect.DeepEqual(gotItem.Highlights, wantItem.Highlights) {
+						t.Errorf("result at index %d: Highlights mismatch: got %v, want %v", i, gotItem.Highlights, wantItem.Highlights)
+					}
 				}
 			}
 			if total != tt.expectedTotal {
@@ -952,3 +1513,119 @@ func Test_sqlRecipeDriver_Find(t *testing.T) {
 		})
 	}
 }
+
+func Test_sqlRecipeDriver_GetFacets(t *testing.T) {
+	type testCase struct {
+		name           string
+		filter         *models.SearchFilter
+		setupMock      func(sqlmock.Sqlmock)
+		expectedErr    error
+		expectedResult *models.SearchFacets
+	}
+
+	tests := []testCase{
+		{
+			name:   "Facets are bucketed",
+			filter: &models.SearchFilter{States: []models.RecipeState{models.Active}},
+			setupMock: func(dbmock sqlmock.Sqlmock) {
+				dbmock.ExpectQuery("SELECT min\\(t\\.tag\\) AS value, count\\(t\\.recipe_id\\) AS count FROM recipe_tag AS t WHERE t\\.recipe_id IN \\(SELECT r\\.id FROM recipe AS r WHERE r\\.current_state IN \\(\\?\\)\\) GROUP BY t\\.tag_key ORDER BY count DESC, value").
+					WithArgs(models.Active).
+					WillReturnRows(sqlmock.NewRows([]string{"value", "count"}).AddRow("chicken", 3).AddRow("soup", 1))
+				dbmock.ExpectQuery("SELECT r\\.current_state, COALESCE\\(g\\.rating, 0\\) AS rating, r\\.total_time, CASE WHEN r\\.main_image_name IS NOT NULL AND r\\.main_image_name != '' THEN 1 ELSE 0 END AS has_pictures, count\\(r\\.id\\) AS count FROM recipe AS r LEFT OUTER JOIN recipe_rating as g ON r\\.id = g\\.recipe_id WHERE r\\.current_state IN \\(\\?\\) GROUP BY .+").
+					WithArgs(models.Active).
+					WillReturnRows(sqlmock.NewRows([]string{"current_state", "rating", "total_time", "has_pictures", "count"}).
+						AddRow(models.Active, 4.5, 2700, 1, 2).
+						AddRow(models.Active, 4.0, 3600, 0, 1).
+						AddRow(models.Active, 0, nil, 0, 1))
+			},
+			expectedResult: &models.SearchFacets{
+				Tags:      []models.FacetCount{{Value: "chicken", Count: 3}, {Value: "soup", Count: 1}},
+				States:    []models.FacetCount{{Value: "active", Count: 4}},
+				Pictures:  []models.FacetCount{{Value: "with", Count: 2}, {Value: "without", Count: 2}},
+				Ratings:   []models.FacetCount{{Value: "0", Count: 1}, {Value: "4", Count: 3}},
+				CookTimes: []models.FacetCount{{Value: "30-60m", Count: 2}, {Value: "1-2h", Count: 1}, {Value: "unknown", Count: 1}},
+			},
+		},
+		{
+			name:   "Invalid query",
+			filter: &models.SearchFilter{Query: "(soup"},
+			setupMock: func(sqlmock.Sqlmock) {
+				// No queries expected
+			},
+			expectedErr: ErrInvalidQuery,
+		},
+		{
+			name:   "Error on tags",
+			filter: &models.SearchFilter{},
+			setupMock: func(dbmock sqlmock.Sqlmock) {
+				dbmock.ExpectQuery("SELECT min\\(t\\.tag\\) AS value").
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut, dbmock := getMockDb(t, mockSearchDriverAdapter{})
+			defer sut.Close()
+			tt.setupMock(dbmock)
+
+			got, err := sut.Recipes().GetFacets(t.Context(), tt.filter)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+			if tt.expectedResult != nil && !reflect.DeepEqual(got, tt.expectedResult) {
+				t.Errorf("expected %+v, got %+v", tt.expectedResult, got)
+			}
+		})
+	}
+}
+
+func Test_formatHighlight(t *testing.T) {
+	type args struct {
+		field   models.SearchField
+		snippet string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "Name is escaped",
+			args: args{models.SearchFieldName, "\x02Chicken\x03 <Soup>"},
+			want: "<mark>Chicken</mark> &lt;Soup&gt;",
+		},
+		{
+			name: "Plain text directions",
+			args: args{models.SearchFieldDirections, "Mix the \x02flour\x03 & water"},
+			want: "Mix the <mark>flour</mark> &amp; water",
+		},
+		{
+			name: "HTML directions",
+			args: args{models.SearchFieldDirections, "<ol><li>Mix the \x02flour\x03.</li><li>Bake &amp; cool</li></ol>"},
+			want: "Mix the <mark>flour</mark>. Bake &amp; cool",
+		},
+		{
+			name: "HTML ingredients cut off mid-tag",
+			args: args{models.SearchFieldIngredients, "...li>1 cup \x02flour\x03</li><li>2 eggs</li><li class=..."},
+			want: "...1 cup <mark>flour</mark> 2 eggs ...",
+		},
+		{
+			name: "HTML nutrition info cut off in closing tag",
+			args: args{models.SearchFieldNutrition, "/p><p>200 \x02calories\x03</p"},
+			want: "200 <mark>calories</mark>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatHighlight(tt.args.field, tt.args.snippet); got != tt.want {
+				t.Errorf("formatHighlight() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chadweimer/gomp/models"
+	"github.com/chadweimer/gomp/plaintext"
+	"github.com/jmoiron/sqlx"
+)
+
+// stepNumberPattern matches the numbering or bullet at the start of a step, e.g., "1.", "2)", "Step 3:", "-", or "•"
+var stepNumberPattern = regexp.MustCompile(`^(?:(?i:step)\s*\d+\s*[.:)-]?|\d+[.)]|[-*•])(?:\s+|$)`)
+
+// inlineStepNumberPattern matches numbering in the middle of a line, e.g., the "2." of "1. Mix. 2. Bake.".
+// The number is captured so that only numbering that counts up from the start of the line is split on.
+var inlineStepNumberPattern = regexp.MustCompile(`(?:^|\s)(\d+)[.)]\s+`)
+
+// stepTemperaturePattern matches a temperature, e.g., "400F", "200°C", or "350 degrees Fahrenheit".
+// Without a degree sign or the word "degrees", the unit must immediately follow the number so that, e.g., "12 c" isn't a temperature.
+var stepTemperaturePattern = regexp.MustCompile(`(\d{2,3})(?:\s*(?:°|º|degrees?)\s*)?([fc])(?:ahrenheit|elsius)?\b`)
+
+// splitDirections splits free-form directions into steps, one per line, with any numbering removed.
+// Directions saved by the editor are HTML, where each list item, paragraph, etc., is a line, and any markup is removed.
+// Lines that number several steps, e.g., "1. Mix. 2. Bake.", are split into a step for each number.
+// The duration and temperature of each step are parsed from its text, if mentioned.
+func splitDirections(directions string) []models.RecipeStep {
+	steps := make([]models.RecipeStep, 0)
+	for _, line := range plaintext.Lines(directions) {
+		for _, text := range splitInlineSteps(line) {
+			text = strings.TrimSpace(stepNumberPattern.ReplaceAllString(text, ""))
+			if text == "" {
+				continue
+			}
+			steps = append(steps, parseStep(text))
+		}
+	}
+	return steps
+}
+
+// splitInlineSteps splits a line at each number that counts up from a "1" at the start of the line.
+// Lines that don't number at least two steps are returned as is.
+func splitInlineSteps(line string) []string {
+	starts := make([]int, 0)
+	for _, match := range inlineStepNumberPattern.FindAllStringSubmatchIndex(line, -1) {
+		number, err := strconv.Atoi(line[match[2]:match[3]])
+		if err != nil || number != len(starts)+1 || (number == 1 && match[2] != 0) {
+			continue
+		}
+		starts = append(starts, match[2])
+	}
+	if len(starts) < 2 {
+		return []string{line}
+	}
+
+	parts := make([]string, 0, len(starts))
+	for i, start := range starts {
+		end := len(line)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		parts = append(parts, line[start:end])
+	}
+	return parts
+}
+
+// parseStep returns a step with the specified text, along with the duration and temperature mentioned in it, if any.
+// The duration is the sum of all the amounts of time in the text, using the upper end of any ranges,
+// and the temperature is the first one in the text.
+func parseStep(text string) models.RecipeStep {
+	step := models.RecipeStep{Text: text}
+	lower := strings.ToLower(text)
+
+	var duration models.Duration
+	for _, match := range recipeTimePattern.FindAllStringSubmatchIndex(lower, -1) {
+		if amount, ok := parseTimeMatch(lower, match); ok {
+			duration += models.Duration(amount)
+		}
+	}
+	if duration > 0 {
+		step.Duration = &duration
+	}
+
+	if match := stepTemperaturePattern.FindStringSubmatch(lower); match != nil {
+		if temperature, err := strconv.ParseFloat(match[1], 32); err == nil {
+			step.Temperature = new(float32(temperature))
+			if match[2] == "c" {
+				step.TemperatureUnit = new(models.Celsius)
+			} else {
+				step.TemperatureUnit = new(models.Fahrenheit)
+			}
+		}
+	}
+
+	return step
+}
+
+// joinSteps returns the free-form directions for the steps, one per line
+func joinSteps(steps []models.RecipeStep) string {
+	lines := make([]string, 0, len(steps))
+	for _, step := range steps {
+		lines = append(lines, step.Text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fillRecipeSteps keeps the steps and the free-form directions of the recipe in sync.
+// If the steps weren't specified, e.g., by older clients, they're split from the directions,
+// keeping the duration, temperature, and image of any existing steps whose text didn't change.
+// Otherwise, the directions are replaced with the text of the steps, unless they already split into the same text.
+func fillRecipeSteps(recipe *models.Recipe, existing []models.RecipeStep) {
+	if recipe.Steps == nil {
+		steps := splitDirections(recipe.Directions)
+		used := make([]bool, len(existing))
+		for i := range steps {
+			for j := range existing {
+				if !used[j] && existing[j].Text == steps[i].Text {
+					steps[i] = existing[j]
+					used[j] = true
+					break
+				}
+			}
+		}
+		recipe.Steps = &steps
+		return
+	}
+
+	split := splitDirections(recipe.Directions)
+	if len(split) == len(*recipe.Steps) {
+		same := true
+		for i := range split {
+			if split[i].Text != (*recipe.Steps)[i].Text {
+				same = false
+				break
+			}
+		}
+		if same {
+			return
+		}
+	}
+	recipe.Directions = joinSteps(*recipe.Steps)
+}
+
+// clearStaleRecipeSteps clears the steps of the recipe if its free-form directions changed, but its steps
+// are still the existing ones, e.g., because a client sent back the steps it loaded along with the edited directions,
+// so that fillRecipeSteps splits them again from the new directions.
+func clearStaleRecipeSteps(recipe *models.Recipe, existing *models.Recipe, existingSteps []models.RecipeStep) {
+	if recipe.Steps == nil || recipe.Directions == existing.Directions ||
+		!slices.EqualFunc(*recipe.Steps, existingSteps, func(a, b models.RecipeStep) bool { return reflect.DeepEqual(a, b) }) {
+		return
+	}
+
+	recipe.Steps = nil
+}
+
+// The columns of the recipe_step table, other than the recipe and step number, in the order they are read and written
+const stepColumnsStmt = "step_text, duration, temperature, temperature_unit, image_name"
+
+func listStepsForRecipe(ctx context.Context, recipeID int64, db sqlx.QueryerContext) ([]models.RecipeStep, error) {
+	steps := make([]models.RecipeStep, 0)
+	if err := sqlx.SelectContext(ctx, db, &steps,
+		"SELECT "+stepColumnsStmt+" FROM recipe_step WHERE recipe_id = $1 ORDER BY step_number", recipeID); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+func saveStepsForRecipe(ctx context.Context, recipeID int64, steps []models.RecipeStep, db sqlx.ExecerContext) error {
+	for i, step := range steps {
+		_, err := db.ExecContext(ctx,
+			"INSERT INTO recipe_step (recipe_id, step_number, "+stepColumnsStmt+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			recipeID, i+1, step.Text, step.Duration, step.Temperature, step.TemperatureUnit, step.ImageName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillMissingSteps splits the directions of any recipes without steps,
+// e.g., those that were added before the steps existed
+func fillMissingSteps(ctx context.Context, db *sqlx.Tx) error {
+	var recipes []models.Recipe
+	err := sqlx.SelectContext(ctx, db, &recipes,
+		"SELECT r.id, r.directions FROM recipe AS r "+
+			"WHERE r.directions <> '' AND NOT EXISTS (SELECT 1 FROM recipe_step AS s WHERE s.recipe_id = r.id)")
+	if err != nil {
+		return err
+	}
+
+	for _, recipe := range recipes {
+		fillRecipeSteps(&recipe, nil)
+		if err := saveStepsForRecipe(ctx, *recipe.ID, *recipe.Steps, db); err != nil {
+			return fmt.Errorf("adding steps to recipe %d: %w", *recipe.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chadweimer/gomp/models"
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_splitDirections(t *testing.T) {
+	type testArgs struct {
+		name          string
+		directions    string
+		expectedSteps []models.RecipeStep
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Empty", "", []models.RecipeStep{}},
+		{"Blank lines", "\n  \n", []models.RecipeStep{}},
+		{
+			"Single line",
+			"Mash the chickpeas and roll into wraps.",
+			[]models.RecipeStep{{Text: "Mash the chickpeas and roll into wraps."}},
+		},
+		{
+			"One per line",
+			"Slice the vegetables.\n\nToss with oil.\r\nRoast until browned.",
+			[]models.RecipeStep{{Text: "Slice the vegetables."}, {Text: "Toss with oil."}, {Text: "Roast until browned."}},
+		},
+		{
+			"Numbered",
+			"1. Slice the vegetables.\n2) Toss with oil.\nStep 3: Roast until browned.",
+			[]models.RecipeStep{{Text: "Slice the vegetables."}, {Text: "Toss with oil."}, {Text: "Roast until browned."}},
+		},
+		{
+			"Bulleted",
+			"- Slice the vegetables.\n• Toss with oil.\n* Roast until browned.",
+			[]models.RecipeStep{{Text: "Slice the vegetables."}, {Text: "Toss with oil."}, {Text: "Roast until browned."}},
+		},
+		{
+			"Numbered inline",
+			"1. Slice the vegetables. 2. Toss with 2 tbsp oil. 3. Roast until browned.",
+			[]models.RecipeStep{{Text: "Slice the vegetables."}, {Text: "Toss with 2 tbsp oil."}, {Text: "Roast until browned."}},
+		},
+		{
+			"Numbers that aren't numbering",
+			"Add 2 eggs. Beat 3 minutes.",
+			[]models.RecipeStep{{Text: "Add 2 eggs. Beat 3 minutes.", Duration: new(models.Duration(3 * time.Minute))}},
+		},
+		{
+			"Durations",
+			"Simmer for 1 hour 15 minutes.\nBake 25-30 min.",
+			[]models.RecipeStep{
+				{Text: "Simmer for 1 hour 15 minutes.", Duration: new(models.Duration(75 * time.Minute))},
+				{Text: "Bake 25-30 min.", Duration: new(models.Duration(30 * time.Minute))},
+			},
+		},
+		{
+			"Temperatures",
+			"Preheat the oven to 400F.\nRoast at 200°C.\nBake at 350 degrees Fahrenheit.\nAdd 12 c flour.",
+			[]models.RecipeStep{
+				{Text: "Preheat the oven to 400F.", Temperature: new(float32(400)), TemperatureUnit: new(models.Fahrenheit)},
+				{Text: "Roast at 200°C.", Temperature: new(float32(200)), TemperatureUnit: new(models.Celsius)},
+				{Text: "Bake at 350 degrees Fahrenheit.", Temperature: new(float32(350)), TemperatureUnit: new(models.Fahrenheit)},
+				{Text: "Add 12 c flour."},
+			},
+		},
+		{
+			"HTML list",
+			"<ol><li>Mix the <b>flour</b> &amp; sugar.</li><li>Bake 20 minutes at 350&deg;F.</li></ol>",
+			[]models.RecipeStep{
+				{Text: "Mix the flour & sugar."},
+				{Text: "Bake 20 minutes at 350°F.", Duration: new(models.Duration(20 * time.Minute)), Temperature: new(float32(350)), TemperatureUnit: new(models.Fahrenheit)},
+			},
+		},
+		{
+			"HTML paragraphs",
+			"<p>1. Slice the vegetables.</p><p>2. Toss with oil.<br>3. Roast until browned.</p><p><br></p>",
+			[]models.RecipeStep{{Text: "Slice the vegetables."}, {Text: "Toss with oil."}, {Text: "Roast until browned."}},
+		},
+		{
+			"HTML divs",
+			"<div>Slice the vegetables.</div><div>Roast for&nbsp;25 minutes.</div>",
+			[]models.RecipeStep{{Text: "Slice the vegetables."}, {Text: "Roast for 25 minutes.", Duration: new(models.Duration(25 * time.Minute))}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Act
+			steps := splitDirections(test.directions)
+
+			// Assert
+			if !reflect.DeepEqual(steps, test.expectedSteps) {
+				t.Errorf("expected steps: %v, received steps: %v", test.expectedSteps, steps)
+			}
+		})
+	}
+}
+
+func Test_fillRecipeSteps(t *testing.T) {
+	type testArgs struct {
+		name               string
+		directions         string
+		steps              *[]models.RecipeStep
+		existing           []models.RecipeStep
+		expectedDirections string
+		expectedSteps      []models.RecipeStep
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name:               "Split from directions",
+			directions:         "1. Mix.\n2. Bake for 20 minutes.",
+			expectedDirections: "1. Mix.\n2. Bake for 20 minutes.",
+			expectedSteps: []models.RecipeStep{
+				{Text: "Mix."},
+				{Text: "Bake for 20 minutes.", Duration: new(models.Duration(20 * time.Minute))},
+			},
+		},
+		{
+			name:               "Keeps details of unchanged steps",
+			directions:         "Mix.\nStir in the nuts.\nBake.",
+			existing:           []models.RecipeStep{{Text: "Mix.", ImageName: new("mix.jpeg")}, {Text: "Bake.", Duration: new(models.Duration(time.Hour))}},
+			expectedDirections: "Mix.\nStir in the nuts.\nBake.",
+			expectedSteps: []models.RecipeStep{
+				{Text: "Mix.", ImageName: new("mix.jpeg")},
+				{Text: "Stir in the nuts."},
+				{Text: "Bake.", Duration: new(models.Duration(time.Hour))},
+			},
+		},
+		{
+			name:               "Joined from edited steps",
+			directions:         "Mix and bake.",
+			steps:              &[]models.RecipeStep{{Text: "Mix."}, {Text: "Bake.", Duration: new(models.Duration(time.Hour))}},
+			expectedDirections: "Mix.\nBake.",
+			expectedSteps:      []models.RecipeStep{{Text: "Mix."}, {Text: "Bake.", Duration: new(models.Duration(time.Hour))}},
+		},
+		{
+			name:               "Directions already match steps",
+			directions:         "1. Mix.\n2. Bake.",
+			steps:              &[]models.RecipeStep{{Text: "Mix."}, {Text: "Bake.", Duration: new(models.Duration(time.Hour))}},
+			expectedDirections: "1. Mix.\n2. Bake.",
+			expectedSteps:      []models.RecipeStep{{Text: "Mix."}, {Text: "Bake.", Duration: new(models.Duration(time.Hour))}},
+		},
+		{
+			name:               "HTML directions already match steps",
+			directions:         "<ol><li>Mix.</li><li>Bake.</li></ol>",
+			steps:              &[]models.RecipeStep{{Text: "Mix."}, {Text: "Bake.", Duration: new(models.Duration(time.Hour))}},
+			expectedDirections: "<ol><li>Mix.</li><li>Bake.</li></ol>",
+			expectedSteps:      []models.RecipeStep{{Text: "Mix."}, {Text: "Bake.", Duration: new(models.Duration(time.Hour))}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recipe := models.Recipe{Directions: test.directions, Steps: test.steps}
+
+			// Act
+			fillRecipeSteps(&recipe, test.existing)
+
+			// Assert
+			if recipe.Directions != test.expectedDirections {
+				t.Errorf("expected directions: %q, received directions: %q", test.expectedDirections, recipe.Directions)
+			}
+			if recipe.Steps == nil || !reflect.DeepEqual(*recipe.Steps, test.expectedSteps) {
+				t.Errorf("expected steps: %v, received steps: %v", test.expectedSteps, recipe.Steps)
+			}
+		})
+	}
+}
+
+func Test_clearStaleRecipeSteps(t *testing.T) {
+	type testArgs struct {
+		name          string
+		directions    string
+		steps         *[]models.RecipeStep
+		expectCleared bool
+	}
+
+	// Arrange
+	existing := &models.Recipe{Directions: "<ol><li>Mix.</li><li>Bake.</li></ol>"}
+	existingSteps := []models.RecipeStep{{Text: "Mix.", ImageName: new("mix.jpeg")}, {Text: "Bake."}}
+	tests := []testArgs{
+		{"Existing steps with edited directions", "<ol><li>Mix.</li><li>Bake 1 hour.</li></ol>", &[]models.RecipeStep{{Text: "Mix.", ImageName: new("mix.jpeg")}, {Text: "Bake."}}, true},
+		{"Existing steps with unchanged directions", "<ol><li>Mix.</li><li>Bake.</li></ol>", &[]models.RecipeStep{{Text: "Mix.", ImageName: new("mix.jpeg")}, {Text: "Bake."}}, false},
+		{"Edited steps", "<ol><li>Mix.</li><li>Bake 1 hour.</li></ol>", &[]models.RecipeStep{{Text: "Mix."}, {Text: "Bake."}}, false},
+		{"No steps", "<ol><li>Mix.</li><li>Bake 1 hour.</li></ol>", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recipe := models.Recipe{Directions: test.directions, Steps: test.steps}
+
+			// Act
+			clearStaleRecipeSteps(&recipe, existing, existingSteps)
+
+			// Assert
+			if cleared := recipe.Steps == nil; cleared != test.expectCleared {
+				t.Errorf("expected cleared: %v, received cleared: %v", test.expectCleared, cleared)
+			}
+		})
+	}
+}
+
+func Test_fillMissingSteps(t *testing.T) {
+	type testArgs struct {
+		name          string
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", nil, nil},
+		{"Error inserting", sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			dbmock.ExpectQuery("SELECT r\\.id, r\\.directions FROM recipe AS r WHERE r\\.directions <> '' AND NOT EXISTS \\(SELECT 1 FROM recipe_step AS s WHERE s\\.recipe_id = r\\.id\\)").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "directions"}).
+					AddRow(1, "<ol><li>Preheat the oven to 350F.</li><li>Bake for 30 minutes.</li></ol>"))
+			exec := dbmock.ExpectExec("INSERT INTO recipe_step \\(recipe_id, step_number, step_text, duration, temperature, temperature_unit, image_name\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7\\)").
+				WithArgs(1, 1, "Preheat the oven to 350F.", nil, float64(350), "fahrenheit", nil)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectExec("INSERT INTO recipe_step \\(recipe_id, step_number, step_text, duration, temperature, temperature_unit, image_name\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7\\)").
+					WithArgs(1, 2, "Bake for 30 minutes.", 1800, nil, nil, nil).
+					WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := tx(t.Context(), sut.Db, func(db *sqlx.Tx) error {
+				return fillMissingSteps(t.Context(), db)
+			})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chadweimer/gomp/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// recipeTimePattern matches an amount of time, e.g., "45 minutes", "1 1/2 hrs", "30-40 min", or the "1H" of "PT1H30M".
+// The unit is captured as a run of letters so that it can be checked against the known units.
+var recipeTimePattern = regexp.MustCompile(`(\d+/\d+|\d+(?:\.\d+)?(?:\s+\d+/\d+)?)(?:\s*(?:-|–|to)\s*(\d+/\d+|\d+(?:\.\d+)?(?:\s+\d+/\d+)?))?\s*([a-z]+)`)
+
+var recipeTimeUnits = map[string]time.Duration{
+	"d":       24 * time.Hour,
+	"day":     24 * time.Hour,
+	"days":    24 * time.Hour,
+	"h":       time.Hour,
+	"hr":      time.Hour,
+	"hrs":     time.Hour,
+	"hour":    time.Hour,
+	"hours":   time.Hour,
+	"m":       time.Minute,
+	"min":     time.Minute,
+	"mins":    time.Minute,
+	"minute":  time.Minute,
+	"minutes": time.Minute,
+}
+
+// recipeTimeLabelPattern matches the labels that say which part of making a recipe the amounts of time that follow are for,
+// e.g., the "Prep" of "Prep: 10 min, Cook: 20 min"
+var recipeTimeLabelPattern = regexp.MustCompile(`\b(prep|preparation|cook|cooking|bake|baking|active|hands-on|total|ready in)\b`)
+
+type recipeTimeKind int
+
+const (
+	recipeTimeUnlabeled recipeTimeKind = iota
+	recipeTimePrep
+	recipeTimeCook
+	recipeTimeActive
+	recipeTimeTotal
+)
+
+var recipeTimeLabels = map[string]recipeTimeKind{
+	"prep":        recipeTimePrep,
+	"preparation": recipeTimePrep,
+	"cook":        recipeTimeCook,
+	"cooking":     recipeTimeCook,
+	"bake":        recipeTimeCook,
+	"baking":      recipeTimeCook,
+	"active":      recipeTimeActive,
+	"hands-on":    recipeTimeActive,
+	"total":       recipeTimeTotal,
+	"ready in":    recipeTimeTotal,
+}
+
+// recipeTimes are the durations found in the free-form time of a recipe.
+// Any that weren't found are nil.
+type recipeTimes struct {
+	prep   *models.Duration
+	cook   *models.Duration
+	active *models.Duration
+	total  *models.Duration
+}
+
+// parseRecipeTimes interprets the free-form time of a recipe, e.g., "1 hour 15 minutes" or "Prep: 10 min, Cook: 20 min".
+// Amounts of time following a label, e.g., "Prep:", count toward that part of the recipe, and the amounts for
+// each part are added together, using the upper end of any ranges. Unless a total is labeled, it is the sum
+// of all the amounts, excluding any active time, which overlaps with the rest.
+// Returns false if no amount of time is found.
+func parseRecipeTimes(text string) (recipeTimes, bool) {
+	text = strings.ToLower(text)
+	labels := recipeTimeLabelPattern.FindAllStringSubmatchIndex(text, -1)
+
+	var sums [recipeTimeTotal + 1]time.Duration
+	var found [recipeTimeTotal + 1]bool
+	for _, match := range recipeTimePattern.FindAllStringSubmatchIndex(text, -1) {
+		amount, ok := parseTimeMatch(text, match)
+		if !ok {
+			continue
+		}
+
+		// The amount is for whichever label most recently preceded it
+		kind := recipeTimeUnlabeled
+		for _, label := range labels {
+			if label[1] > match[0] {
+				break
+			}
+			kind = recipeTimeLabels[text[label[2]:label[3]]]
+		}
+
+		sums[kind] += amount
+		found[kind] = true
+	}
+
+	times := recipeTimes{}
+	if found[recipeTimePrep] {
+		times.prep = new(models.Duration(sums[recipeTimePrep]))
+	}
+	if found[recipeTimeCook] {
+		times.cook = new(models.Duration(sums[recipeTimeCook]))
+	}
+	if found[recipeTimeActive] {
+		times.active = new(models.Duration(sums[recipeTimeActive]))
+	}
+	if found[recipeTimeTotal] {
+		times.total = new(models.Duration(sums[recipeTimeTotal]))
+	} else if found[recipeTimeUnlabeled] || found[recipeTimePrep] || found[recipeTimeCook] {
+		times.total = new(models.Duration(sums[recipeTimeUnlabeled] + sums[recipeTimePrep] + sums[recipeTimeCook]))
+	}
+
+	return times, times.prep != nil || times.cook != nil || times.active != nil || times.total != nil
+}
+
+// parseTimeMatch returns the amount of time matched by recipeTimePattern at the specified submatch indexes,
+// using the upper end of a range. Returns false if the unit isn't one of the known units.
+func parseTimeMatch(text string, match []int) (time.Duration, bool) {
+	unit, ok := recipeTimeUnits[text[match[6]:match[7]]]
+	if !ok {
+		return 0, false
+	}
+
+	amountStr := text[match[2]:match[3]]
+	if match[4] >= 0 {
+		amountStr = text[match[4]:match[5]]
+	}
+	amount, ok := parseTimeAmount(amountStr)
+	if !ok {
+		return 0, false
+	}
+
+	return time.Duration(amount * float64(unit)), true
+}
+
+// parseTimeAmount parses a whole, decimal, or mixed number, e.g., "2", "1.5", "1/2", or "1 1/2".
+func parseTimeAmount(text string) (float64, bool) {
+	amount := 0.0
+	for part := range strings.FieldsSeq(text) {
+		if numerator, denominator, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.ParseFloat(numerator, 64)
+			if err != nil {
+				return 0, false
+			}
+			d, err := strconv.ParseFloat(denominator, 64)
+			if err != nil || d == 0 {
+				return 0, false
+			}
+			amount += n / d
+		} else {
+			val, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return 0, false
+			}
+			amount += val
+		}
+	}
+	return amount, true
+}
+
+// fillRecipeTimes fills in the durations of the recipe that weren't specified.
+// If none were, they're parsed from the free-form time of the recipe.
+// Otherwise, a missing total is the sum of the prep and cook times.
+func fillRecipeTimes(recipe *models.Recipe) {
+	if recipe.PrepTime == nil && recipe.CookTime == nil && recipe.ActiveTime == nil && recipe.TotalTime == nil {
+		if times, ok := parseRecipeTimes(recipe.Time); ok {
+			recipe.PrepTime = times.prep
+			recipe.CookTime = times.cook
+			recipe.ActiveTime = times.active
+			recipe.TotalTime = times.total
+		}
+		return
+	}
+
+	if recipe.TotalTime == nil && (recipe.PrepTime != nil || recipe.CookTime != nil) {
+		var total models.Duration
+		if recipe.PrepTime != nil {
+			total += *recipe.PrepTime
+		}
+		if recipe.CookTime != nil {
+			total += *recipe.CookTime
+		}
+		recipe.TotalTime = &total
+	}
+}
+
+// clearStaleRecipeTimes clears the durations of the recipe if its free-form time changed, but its durations
+// are still the ones parsed from its existing time, e.g., because a client sent back the durations it loaded,
+// so that fillRecipeTimes parses them again from the new time.
+// Durations that were specified separately from the time are left alone.
+func clearStaleRecipeTimes(recipe *models.Recipe, existing *models.Recipe) {
+	if recipe.Time == existing.Time || !equalRecipeTimes(recipe, existing) {
+		return
+	}
+
+	parsed := models.Recipe{Time: existing.Time}
+	fillRecipeTimes(&parsed)
+	if !equalRecipeTimes(&parsed, existing) {
+		return
+	}
+
+	recipe.PrepTime = nil
+	recipe.CookTime = nil
+	recipe.ActiveTime = nil
+	recipe.TotalTime = nil
+}
+
+func equalRecipeTimes(a *models.Recipe, b *models.Recipe) bool {
+	return equalDurations(a.PrepTime, b.PrepTime) && equalDurations(a.CookTime, b.CookTime) &&
+		equalDurations(a.ActiveTime, b.ActiveTime) && equalDurations(a.TotalTime, b.TotalTime)
+}
+
+func equalDurations(a *models.Duration, b *models.Duration) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// fillMissingTimes parses the free-form time of any recipes without durations,
+// e.g., those that were added before the durations existed
+func fillMissingTimes(ctx context.Context, db *sqlx.Tx) error {
+	var recipes []models.Recipe
+	err := sqlx.SelectContext(ctx, db, &recipes,
+		"SELECT id, recipe_time FROM recipe "+
+			"WHERE prep_time IS NULL AND cook_time IS NULL AND active_time IS NULL AND total_time IS NULL AND recipe_time <> ''")
+	if err != nil {
+		return err
+	}
+
+	for _, recipe := range recipes {
+		fillRecipeTimes(&recipe)
+		if recipe.TotalTime == nil && recipe.ActiveTime == nil {
+			continue
+		}
+
+		_, err := db.ExecContext(ctx,
+			"UPDATE recipe SET prep_time = $1, cook_time = $2, active_time = $3, total_time = $4 WHERE id = $5",
+			recipe.PrepTime, recipe.CookTime, recipe.ActiveTime, recipe.TotalTime, recipe.ID)
+		if err != nil {
+			return fmt.Errorf("updating times of recipe %d: %w", *recipe.ID, err)
+		}
+	}
+
+	return nil
+}
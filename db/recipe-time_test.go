@@ -0,0 +1,224 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chadweimer/gomp/models"
+	"github.com/jmoiron/sqlx"
+)
+
+func Test_parseRecipeTimes(t *testing.T) {
+	type testArgs struct {
+		text           string
+		expectedPrep   time.Duration
+		expectedCook   time.Duration
+		expectedActive time.Duration
+		expectedTotal  time.Duration
+		expectedOk     bool
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"45 minutes", 0, 0, 0, 45 * time.Minute, true},
+		{"45 min", 0, 0, 0, 45 * time.Minute, true},
+		{"1 hour 15 minutes", 0, 0, 0, 75 * time.Minute, true},
+		{"1 1/2 hrs", 0, 0, 0, 90 * time.Minute, true},
+		{"1.5 Hours", 0, 0, 0, 90 * time.Minute, true},
+		{"1/2 hour", 0, 0, 0, 30 * time.Minute, true},
+		{"30-40 minutes", 0, 0, 0, 40 * time.Minute, true},
+		{"20 to 25 mins", 0, 0, 0, 25 * time.Minute, true},
+		{"1h30m", 0, 0, 0, 90 * time.Minute, true},
+		{"PT2H", 0, 0, 0, 2 * time.Hour, true},
+		{"2 days", 0, 0, 0, 48 * time.Hour, true},
+		{"Prep: 10 min, Cook: 20 min", 10 * time.Minute, 20 * time.Minute, 0, 30 * time.Minute, true},
+		{"Prep 15 mins | Bake 1 hr | Total 1 hr 30 mins", 15 * time.Minute, time.Hour, 0, 90 * time.Minute, true},
+		{"Hands-on: 20 minutes, Ready in: 2 hours", 0, 0, 20 * time.Minute, 2 * time.Hour, true},
+		{"Active 10 min", 0, 0, 10 * time.Minute, 0, true},
+		{"", 0, 0, 0, 0, false},
+		{"45", 0, 0, 0, 0, false},
+		{"overnight", 0, 0, 0, 0, false},
+		{"2 medium potatoes", 0, 0, 0, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			// Act
+			times, ok := parseRecipeTimes(test.text)
+
+			// Assert
+			if ok != test.expectedOk {
+				t.Errorf("expected ok %v, received %v", test.expectedOk, ok)
+			}
+			assertDuration(t, "prep", test.expectedPrep, times.prep)
+			assertDuration(t, "cook", test.expectedCook, times.cook)
+			assertDuration(t, "active", test.expectedActive, times.active)
+			assertDuration(t, "total", test.expectedTotal, times.total)
+		})
+	}
+}
+
+func Test_fillRecipeTimes(t *testing.T) {
+	type testArgs struct {
+		name     string
+		recipe   models.Recipe
+		expected models.Recipe
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name:     "Parsed from time",
+			recipe:   models.Recipe{Time: "Prep: 10 min, Cook: 20 min"},
+			expected: models.Recipe{Time: "Prep: 10 min, Cook: 20 min", PrepTime: durationPtr(10 * time.Minute), CookTime: durationPtr(20 * time.Minute), TotalTime: durationPtr(30 * time.Minute)},
+		},
+		{
+			name:     "Time not parsable",
+			recipe:   models.Recipe{Time: "overnight"},
+			expected: models.Recipe{Time: "overnight"},
+		},
+		{
+			name:     "Total from prep and cook",
+			recipe:   models.Recipe{Time: "1 hour", PrepTime: durationPtr(5 * time.Minute), CookTime: durationPtr(25 * time.Minute)},
+			expected: models.Recipe{Time: "1 hour", PrepTime: durationPtr(5 * time.Minute), CookTime: durationPtr(25 * time.Minute), TotalTime: durationPtr(30 * time.Minute)},
+		},
+		{
+			name:     "Total specified",
+			recipe:   models.Recipe{PrepTime: durationPtr(5 * time.Minute), TotalTime: durationPtr(time.Hour)},
+			expected: models.Recipe{PrepTime: durationPtr(5 * time.Minute), TotalTime: durationPtr(time.Hour)},
+		},
+		{
+			name:     "Only active",
+			recipe:   models.Recipe{Time: "1 hour", ActiveTime: durationPtr(5 * time.Minute)},
+			expected: models.Recipe{Time: "1 hour", ActiveTime: durationPtr(5 * time.Minute)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Act
+			fillRecipeTimes(&test.recipe)
+
+			// Assert
+			if !reflect.DeepEqual(test.recipe, test.expected) {
+				t.Errorf("expected %+v, received %+v", test.expected, test.recipe)
+			}
+		})
+	}
+}
+
+func Test_clearStaleRecipeTimes(t *testing.T) {
+	type testArgs struct {
+		name     string
+		recipe   models.Recipe
+		existing models.Recipe
+		expected models.Recipe
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name:     "Time changed",
+			recipe:   models.Recipe{Time: "1 hour", TotalTime: durationPtr(45 * time.Minute)},
+			existing: models.Recipe{Time: "45 minutes", TotalTime: durationPtr(45 * time.Minute)},
+			expected: models.Recipe{Time: "1 hour"},
+		},
+		{
+			name:     "Time unchanged",
+			recipe:   models.Recipe{Time: "45 minutes", TotalTime: durationPtr(45 * time.Minute)},
+			existing: models.Recipe{Time: "45 minutes", TotalTime: durationPtr(45 * time.Minute)},
+			expected: models.Recipe{Time: "45 minutes", TotalTime: durationPtr(45 * time.Minute)},
+		},
+		{
+			name:     "Durations changed too",
+			recipe:   models.Recipe{Time: "1 hour", TotalTime: durationPtr(50 * time.Minute)},
+			existing: models.Recipe{Time: "45 minutes", TotalTime: durationPtr(45 * time.Minute)},
+			expected: models.Recipe{Time: "1 hour", TotalTime: durationPtr(50 * time.Minute)},
+		},
+		{
+			name:     "Durations specified separately",
+			recipe:   models.Recipe{Time: "overnight", PrepTime: durationPtr(10 * time.Minute), TotalTime: durationPtr(8 * time.Hour)},
+			existing: models.Recipe{Time: "1 night", PrepTime: durationPtr(10 * time.Minute), TotalTime: durationPtr(8 * time.Hour)},
+			expected: models.Recipe{Time: "overnight", PrepTime: durationPtr(10 * time.Minute), TotalTime: durationPtr(8 * time.Hour)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Act
+			clearStaleRecipeTimes(&test.recipe, &test.existing)
+
+			// Assert
+			if !reflect.DeepEqual(test.recipe, test.expected) {
+				t.Errorf("expected %+v, received %+v", test.expected, test.recipe)
+			}
+		})
+	}
+}
+
+func durationPtr(d time.Duration) *models.Duration {
+	return new(models.Duration(d))
+}
+
+func assertDuration(t *testing.T, name string, expected time.Duration, actual *models.Duration) {
+	t.Helper()
+	if expected == 0 {
+		if actual != nil {
+			t.Errorf("expected no %s time, received %v", name, *actual)
+		}
+		return
+	}
+	if actual == nil || time.Duration(*actual) != expected {
+		t.Errorf("expected %s time %v, received %v", name, expected, actual)
+	}
+}
+
+func Test_fillMissingTimes(t *testing.T) {
+	type testArgs struct {
+		name          string
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", nil, nil},
+		{"Error updating", sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			dbmock.ExpectQuery("SELECT id, recipe_time FROM recipe WHERE prep_time IS NULL AND cook_time IS NULL AND active_time IS NULL AND total_time IS NULL AND recipe_time <> ''").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "recipe_time"}).
+					AddRow(1, "overnight").
+					AddRow(2, "Prep: 10 min, Cook: 20 min"))
+			exec := dbmock.ExpectExec("UPDATE recipe SET prep_time = \\$1, cook_time = \\$2, active_time = \\$3, total_time = \\$4 WHERE id = \\$5").
+				WithArgs(600, 1200, nil, 1800, 2)
+			if test.dbError == nil {
+				exec.WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				exec.WillReturnError(test.dbError)
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := tx(t.Context(), sut.Db, func(db *sqlx.Tx) error {
+				return fillMissingTimes(t.Context(), db)
+			})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -3,8 +3,15 @@ package db
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
+	"github.com/chadweimer/gomp/models"
 	"github.com/jmoiron/sqlx"
+	"github.com/samber/lo"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
 )
 
 type sqlTagDriver struct {
@@ -13,7 +20,8 @@ type sqlTagDriver struct {
 
 func (d *sqlTagDriver) List(ctx context.Context) (*map[string]int, error) {
 	return get(d.Db, func(db sqlx.QueryerContext) (*map[string]int, error) {
-		rows, err := db.QueryContext(ctx, "SELECT tag, count(tag) as num FROM recipe_tag GROUP BY tag")
+		// Tags that differ only by case are counted together
+		rows, err := db.QueryContext(ctx, "SELECT min(tag), count(tag_key) as num FROM recipe_tag GROUP BY tag_key")
 		if err != nil {
 			return nil, err
 		}
@@ -36,10 +44,288 @@ func (d *sqlTagDriver) List(ctx context.Context) (*map[string]int, error) {
 	})
 }
 
+func (d *sqlTagDriver) Tree(ctx context.Context) (*[]models.TagNode, error) {
+	return get(d.Db, func(db sqlx.QueryerContext) (*[]models.TagNode, error) {
+		var infos []tagInfoRow
+		if err := sqlx.SelectContext(ctx, db, &infos,
+			"SELECT tag, parent_tag, description, color, icon FROM tag"); err != nil {
+			return nil, fmt.Errorf("reading tag info: %w", err)
+		}
+
+		var recipeTags []struct {
+			RecipeID int64  `db:"recipe_id"`
+			Tag      string `db:"tag"`
+			TagKey   string `db:"tag_key"`
+		}
+		if err := sqlx.SelectContext(ctx, db, &recipeTags, "SELECT recipe_id, tag, tag_key FROM recipe_tag"); err != nil {
+			return nil, fmt.Errorf("reading recipe tags: %w", err)
+		}
+
+		// Tags that differ only by case are counted together, using the case of the tag info if there is any
+		displays := make(map[string]string)
+		for _, recipeTag := range recipeTags {
+			if display, ok := displays[recipeTag.TagKey]; !ok || recipeTag.Tag < display {
+				displays[recipeTag.TagKey] = recipeTag.Tag
+			}
+		}
+		for _, info := range infos {
+			_, key := normalizeTag(info.Tag)
+			displays[key] = info.Tag
+		}
+
+		tree := newTagTree()
+		for _, info := range infos {
+			tree.addInfo(info)
+		}
+		for _, recipeTag := range recipeTags {
+			tree.addRecipe(displays[recipeTag.TagKey], recipeTag.RecipeID)
+		}
+
+		nodes := tree.build()
+		return &nodes, nil
+	})
+}
+
+func (d *sqlTagDriver) SaveInfo(ctx context.Context, tag string, info *models.TagInfo) error {
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.saveInfoImpl(ctx, tag, info, db)
+	})
+}
+
+func (d *sqlTagDriver) saveInfoImpl(ctx context.Context, tag string, info *models.TagInfo, db *sqlx.Tx) error {
+	tag, key := normalizeTag(tag)
+
+	var parentTag *string
+	if info.ParentTag != nil && *info.ParentTag != "" {
+		parent, parentKey := normalizeTag(*info.ParentTag)
+		if _, err := db.ExecContext(ctx,
+			"INSERT INTO tag (tag, tag_key) VALUES ($1, $2) ON CONFLICT (tag_key) DO NOTHING", parent, parentKey); err != nil {
+			return fmt.Errorf("adding parent tag: %w", err)
+		}
+
+		// The parent may already have info, with a different case
+		if err := sqlx.GetContext(ctx, db, &parent, "SELECT tag FROM tag WHERE tag_key = $1", parentKey); err != nil {
+			return fmt.Errorf("reading parent tag: %w", err)
+		}
+		parentTag = &parent
+
+		// The tag can't be nested under itself or any of the tags nested under it
+		var ancestors []string
+		if err := sqlx.SelectContext(ctx, db, &ancestors, d.Db.Rebind(tagAncestorsStmt), *parentTag); err != nil {
+			return fmt.Errorf("reading ancestors of parent tag: %w", err)
+		}
+		if slices.ContainsFunc(ancestors, func(ancestor string) bool {
+			_, ancestorKey := normalizeTag(ancestor)
+			return ancestorKey == key
+		}) {
+			return ErrTagCycle
+		}
+	}
+
+	// Info saved for a tag that already has info with a different case replaces it, including its case
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO tag (tag, tag_key, parent_tag, description, color, icon) VALUES ($1, $2, $3, $4, $5, $6) "+
+			"ON CONFLICT (tag_key) DO UPDATE SET tag = excluded.tag, parent_tag = excluded.parent_tag, "+
+			"description = excluded.description, color = excluded.color, icon = excluded.icon",
+		tag, key, parentTag, valueOrEmpty(info.Description), valueOrEmpty(info.Color), valueOrEmpty(info.Icon))
+	if err != nil {
+		return fmt.Errorf("saving tag info: %w", err)
+	}
+
+	return nil
+}
+
+func (d *sqlTagDriver) Rename(ctx context.Context, tag string, newTag string) error {
+	return d.Merge(ctx, []string{tag}, newTag)
+}
+
+func (d *sqlTagDriver) Merge(ctx context.Context, tags []string, intoTag string) error {
+	// Merging a tag into itself is a no-op, so only the other tags need to be handled.
+	// Tags that only differ by case are still merged, in order to change how they're displayed.
+	intoTag, _ = normalizeTag(intoTag)
+	tags = slices.DeleteFunc(slices.Clone(tags), func(tag string) bool { return tag == intoTag })
+	if len(tags) == 0 {
+		return nil
+	}
+
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		return d.mergeImpl(ctx, tags, intoTag, db)
+	})
+}
+
+func (d *sqlTagDriver) mergeImpl(ctx context.Context, tags []string, intoTag string, db *sqlx.Tx) error {
+	// Tags are matched regardless of case, using their keys
+	_, intoKey := normalizeTag(intoTag)
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if _, key := normalizeTag(tag); key != intoKey && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	// Add the new tag everywhere that any of the old tags are used, unless already there,
+	// so that the old tags can simply be deleted without leaving duplicates behind
+	if len(keys) > 0 {
+		stmts := []struct {
+			stmt string
+			args []any
+		}{
+			{
+				stmt: "INSERT INTO recipe_tag (recipe_id, tag, tag_key) " +
+					"SELECT DISTINCT t.recipe_id, CAST(? AS TEXT), CAST(? AS TEXT) FROM recipe_tag AS t " +
+					"WHERE t.tag_key IN (?) AND NOT EXISTS (SELECT 1 FROM recipe_tag AS o WHERE o.recipe_id = t.recipe_id AND o.tag_key = ?)",
+				args: []any{intoTag, intoKey, keys, intoKey},
+			},
+			{
+				stmt: "INSERT INTO app_user_favorite_tag (user_id, tag, tag_key) " +
+					"SELECT DISTINCT t.user_id, CAST(? AS TEXT), CAST(? AS TEXT) FROM app_user_favorite_tag AS t " +
+					"WHERE t.tag_key IN (?) AND NOT EXISTS (SELECT 1 FROM app_user_favorite_tag AS o WHERE o.user_id = t.user_id AND o.tag_key = ?)",
+				args: []any{intoTag, intoKey, keys, intoKey},
+			},
+			{
+				// If a filter both includes and excludes tags being merged, including them wins
+				stmt: "INSERT INTO search_filter_tag (search_filter_id, tag, tag_key, excluded) " +
+					"SELECT DISTINCT t.search_filter_id, CAST(? AS TEXT), CAST(? AS TEXT), t.excluded FROM search_filter_tag AS t " +
+					"WHERE t.tag_key IN (?) AND NOT EXISTS (SELECT 1 FROM search_filter_tag AS o WHERE o.search_filter_id = t.search_filter_id AND o.tag_key = ?) " +
+					"AND NOT (t.excluded AND EXISTS (SELECT 1 FROM search_filter_tag AS o WHERE o.search_filter_id = t.search_filter_id AND o.tag_key IN (?) AND NOT o.excluded))",
+				args: []any{intoTag, intoKey, keys, intoKey, keys},
+			},
+		}
+		for _, stmt := range stmts {
+			query, args, err := sqlx.In(stmt.stmt, stmt.args...)
+			if err != nil {
+				return err
+			}
+			if _, err = db.ExecContext(ctx, d.Db.Rebind(query), args...); err != nil {
+				return fmt.Errorf("adding merged tag: %w", err)
+			}
+		}
+	}
+
+	// Anywhere that already has the new tag, but with a different case, now uses the case of the new tag.
+	// Renaming the info of the tag also renames it wherever it's the parent of other tags.
+	var updated int64
+	for _, table := range []string{"recipe_tag", "app_user_favorite_tag", "search_filter_tag", "tag"} {
+		result, err := db.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET tag = $1 WHERE tag_key = $2 AND tag <> $1", table),
+			intoTag, intoKey)
+		if err != nil {
+			return fmt.Errorf("updating case of merged tag in %s: %w", table, err)
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("updating case of merged tag in %s: %w", table, err)
+		}
+		updated += count
+	}
+
+	// Keep the info of the old tags, if the new tag doesn't already have its own,
+	// and move the tags nested under the old tags to the new tag
+	if len(keys) > 0 {
+		hierarchyStmts := []struct {
+			stmt string
+			args []any
+		}{
+			{
+				stmt: "INSERT INTO tag (tag, tag_key, parent_tag, description, color, icon) " +
+					"SELECT CAST(? AS TEXT), CAST(? AS TEXT), " +
+					"CASE WHEN t.parent_tag IN (SELECT p.tag FROM tag AS p WHERE p.tag_key = ? OR p.tag_key IN (?)) THEN NULL ELSE t.parent_tag END, " +
+					"t.description, t.color, t.icon FROM tag AS t " +
+					"WHERE t.tag = (SELECT min(o.tag) FROM tag AS o WHERE o.tag_key IN (?)) AND NOT EXISTS (SELECT 1 FROM tag AS o WHERE o.tag_key = ?)",
+				args: []any{intoTag, intoKey, intoKey, keys, keys, intoKey},
+			},
+			{
+				// Tags above the new tag are left out, since that would nest them under themselves
+				stmt: "UPDATE tag SET parent_tag = ? " +
+					"WHERE parent_tag IN (SELECT p.tag FROM tag AS p WHERE p.tag_key IN (?)) AND tag NOT IN (" + tagAncestorsStmt + ")",
+				args: []any{intoTag, keys, intoTag},
+			},
+		}
+		for _, hierarchyStmt := range hierarchyStmts {
+			query, queryArgs, err := sqlx.In(hierarchyStmt.stmt, hierarchyStmt.args...)
+			if err != nil {
+				return err
+			}
+			if _, err = db.ExecContext(ctx, d.Db.Rebind(query), queryArgs...); err != nil {
+				return fmt.Errorf("merging tag hierarchy: %w", err)
+			}
+		}
+	}
+
+	deleted, err := d.deleteImpl(ctx, keys, db)
+	if err != nil {
+		return err
+	}
+	if updated+deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (d *sqlTagDriver) Delete(ctx context.Context, tag string) error {
+	_, key := normalizeTag(tag)
+	return tx(ctx, d.Db, func(db *sqlx.Tx) error {
+		deleted, err := d.deleteImpl(ctx, []string{key}, db)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// deleteImpl deletes the tags with any of the keys everywhere,
+// returning the number of rows deleted
+func (d *sqlTagDriver) deleteImpl(ctx context.Context, keys []string, db *sqlx.Tx) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	// Move any tags nested under the deleted tags up a level, rather than to the top
+	query, args, err := sqlx.In(
+		"UPDATE tag SET parent_tag = (SELECT p.parent_tag FROM tag AS p WHERE p.tag = tag.parent_tag) "+
+			"WHERE parent_tag IN (SELECT p.tag FROM tag AS p WHERE p.tag_key IN (?))",
+		keys)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = db.ExecContext(ctx, d.Db.Rebind(query), args...); err != nil {
+		return 0, fmt.Errorf("moving nested tags: %w", err)
+	}
+
+	var deleted int64
+	for _, table := range []string{"recipe_tag", "app_user_favorite_tag", "search_filter_tag", "tag"} {
+		query, args, err := sqlx.In(fmt.Sprintf("DELETE FROM %s WHERE tag_key IN (?)", table), keys)
+		if err != nil {
+			return 0, err
+		}
+		result, err := db.ExecContext(ctx, d.Db.Rebind(query), args...)
+		if err != nil {
+			return 0, fmt.Errorf("deleting tags from %s: %w", table, err)
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("deleting tags from %s: %w", table, err)
+		}
+		deleted += count
+	}
+
+	return deleted, nil
+}
+
 func createTagForRecipe(ctx context.Context, recipeID int64, tag string, db sqlx.ExecerContext) error {
+	display, key := normalizeTag(tag)
+	if key == "" {
+		return nil
+	}
+
+	// A tag that the recipe already has, regardless of case, is ignored
 	_, err := db.ExecContext(ctx,
-		"INSERT INTO recipe_tag (recipe_id, tag) VALUES ($1, $2)",
-		recipeID, tag)
+		"INSERT INTO recipe_tag (recipe_id, tag, tag_key) VALUES ($1, $2, $3) ON CONFLICT (recipe_id, tag_key) DO NOTHING",
+		recipeID, display, key)
 	return err
 }
 
@@ -58,3 +344,253 @@ func listTagsForRecipe(ctx context.Context, recipeID int64, db sqlx.QueryerConte
 
 	return &tags, nil
 }
+
+// tagAncestorsStmt selects the tag, and all the tags it's nested under
+const tagAncestorsStmt = "WITH RECURSIVE a(tag) AS (" +
+	"SELECT CAST(? AS TEXT) UNION SELECT p.parent_tag FROM tag AS p JOIN a ON p.tag = a.tag WHERE p.parent_tag IS NOT NULL" +
+	") SELECT tag FROM a"
+
+type tagInfoRow struct {
+	Tag         string  `db:"tag"`
+	TagKey      string  `db:"tag_key"`
+	ParentTag   *string `db:"parent_tag"`
+	Description string  `db:"description"`
+	Color       string  `db:"color"`
+	Icon        string  `db:"icon"`
+}
+
+// tagTree collects the info and recipes of each tag, in order to build the tag hierarchy
+type tagTree struct {
+	infos    map[string]tagInfoRow
+	recipes  map[string]map[int64]bool
+	children map[string][]string
+}
+
+func newTagTree() *tagTree {
+	return &tagTree{
+		infos:    make(map[string]tagInfoRow),
+		recipes:  make(map[string]map[int64]bool),
+		children: make(map[string][]string),
+	}
+}
+
+func (t *tagTree) addInfo(info tagInfoRow) {
+	t.infos[info.Tag] = info
+	if _, ok := t.recipes[info.Tag]; !ok {
+		t.recipes[info.Tag] = make(map[int64]bool)
+	}
+	if info.ParentTag != nil {
+		t.children[*info.ParentTag] = append(t.children[*info.ParentTag], info.Tag)
+	}
+}
+
+func (t *tagTree) addRecipe(tag string, recipeID int64) {
+	if _, ok := t.recipes[tag]; !ok {
+		t.recipes[tag] = make(map[int64]bool)
+	}
+	t.recipes[tag][recipeID] = true
+}
+
+// build returns the top level tags, with the tags nested under them, ordered by tag
+func (t *tagTree) build() []models.TagNode {
+	roots := make([]string, 0)
+	for tag := range t.recipes {
+		if info, ok := t.infos[tag]; !ok || info.ParentTag == nil {
+			roots = append(roots, tag)
+		}
+	}
+	slices.Sort(roots)
+
+	visited := make(map[string]bool)
+	nodes := make([]models.TagNode, 0, len(roots))
+	for _, tag := range roots {
+		node, _ := t.buildNode(tag, visited)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// buildNode returns the node for the tag, along with all the recipes with the tag
+// or any of the tags nested under it.
+func (t *tagTree) buildNode(tag string, visited map[string]bool) (models.TagNode, map[int64]bool) {
+	visited[tag] = true
+
+	node := models.TagNode{
+		Tag:      tag,
+		Count:    int64(len(t.recipes[tag])),
+		Children: make([]models.TagNode, 0),
+	}
+	if info, ok := t.infos[tag]; ok {
+		node.Description = emptyToNil(info.Description)
+		node.Color = emptyToNil(info.Color)
+		node.Icon = emptyToNil(info.Icon)
+	}
+
+	recipes := maps.Clone(t.recipes[tag])
+	children := slices.Clone(t.children[tag])
+	slices.Sort(children)
+	for _, child := range children {
+		// Guard against a cycle, even though saving tag info prevents them
+		if visited[child] {
+			continue
+		}
+		childNode, childRecipes := t.buildNode(child, visited)
+		node.Children = append(node.Children, childNode)
+		maps.Copy(recipes, childRecipes)
+	}
+	node.TotalCount = int64(len(recipes))
+
+	return node, recipes
+}
+
+func valueOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func emptyToNil(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// normalizeTag returns the tag as it's displayed, trimmed and in Unicode normalization form C,
+// along with the case-folded key used to compare it to other tags
+func normalizeTag(tag string) (display string, key string) {
+	display = norm.NFC.String(strings.TrimSpace(tag))
+	key = norm.NFC.String(cases.Fold().String(display))
+	return display, key
+}
+
+// normalizeTagKeys replaces the keys of all the tags, which were originally filled in using SQL,
+// with the ones from normalizeTag, removing any tags that turn out to be duplicates
+func normalizeTagKeys(ctx context.Context, db *sqlx.Tx) error {
+	tables := []struct {
+		name        string
+		ownerColumn string
+		hasExcluded bool
+	}{
+		{"recipe_tag", "recipe_id", false},
+		{"app_user_favorite_tag", "user_id", false},
+		{"search_filter_tag", "search_filter_id", true},
+	}
+	for _, table := range tables {
+		if err := normalizeOwnedTagKeys(ctx, db, table.name, table.ownerColumn, table.hasExcluded); err != nil {
+			return fmt.Errorf("normalizing tag keys in %s: %w", table.name, err)
+		}
+	}
+
+	if err := normalizeTagInfoKeys(ctx, db); err != nil {
+		return fmt.Errorf("normalizing tag keys in tag: %w", err)
+	}
+
+	return nil
+}
+
+type ownedTagRow struct {
+	OwnerID  int64  `db:"owner_id"`
+	Tag      string `db:"tag"`
+	TagKey   string `db:"tag_key"`
+	Excluded bool   `db:"excluded"`
+}
+
+// normalizeOwnedTagKeys normalizes the tags of each owner, e.g., recipe, in the table,
+// replacing all the tags of any owner whose tags change
+func normalizeOwnedTagKeys(ctx context.Context, db *sqlx.Tx, table string, ownerColumn string, hasExcluded bool) error {
+	excludedColumn := "FALSE AS excluded"
+	insertStmt := fmt.Sprintf("INSERT INTO %s (%s, tag, tag_key) VALUES ($1, $2, $3)", table, ownerColumn)
+	if hasExcluded {
+		excludedColumn = "excluded"
+		insertStmt = fmt.Sprintf("INSERT INTO %s (%s, tag, tag_key, excluded) VALUES ($1, $2, $3, $4)", table, ownerColumn)
+	}
+
+	// Included tags come first, so that they win over excluded tags that turn out to be the same
+	var rows []ownedTagRow
+	if err := sqlx.SelectContext(ctx, db, &rows, fmt.Sprintf(
+		"SELECT %s AS owner_id, tag, tag_key, %s FROM %s ORDER BY owner_id, excluded, tag",
+		ownerColumn, excludedColumn, table)); err != nil {
+		return fmt.Errorf("reading tags: %w", err)
+	}
+
+	rowsByOwner := lo.GroupBy(rows, func(row ownedTagRow) int64 { return row.OwnerID })
+	for _, ownerID := range slices.Sorted(maps.Keys(rowsByOwner)) {
+		ownerRows := rowsByOwner[ownerID]
+		changed := false
+		seen := make(map[string]bool)
+		normalized := make([]ownedTagRow, 0, len(ownerRows))
+		for _, row := range ownerRows {
+			display, key := normalizeTag(row.Tag)
+			if key == "" || seen[key] {
+				changed = true
+				continue
+			}
+			seen[key] = true
+			changed = changed || display != row.Tag || key != row.TagKey
+			normalized = append(normalized, ownedTagRow{OwnerID: ownerID, Tag: display, TagKey: key, Excluded: row.Excluded})
+		}
+		if !changed {
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx,
+			fmt.Sprintf("DELETE FROM %s WHERE %s = $1", table, ownerColumn), ownerID); err != nil {
+			return fmt.Errorf("deleting tags: %w", err)
+		}
+		for _, row := range normalized {
+			args := []any{row.OwnerID, row.Tag, row.TagKey}
+			if hasExcluded {
+				args = append(args, row.Excluded)
+			}
+			if _, err := db.ExecContext(ctx, insertStmt, args...); err != nil {
+				return fmt.Errorf("inserting tag: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalizeTagInfoKeys normalizes the keys of the tag info,
+// keeping only the first of any tags that turn out to be the same
+func normalizeTagInfoKeys(ctx context.Context, db *sqlx.Tx) error {
+	var infos []tagInfoRow
+	if err := sqlx.SelectContext(ctx, db, &infos, "SELECT tag, tag_key FROM tag ORDER BY tag"); err != nil {
+		return fmt.Errorf("reading tag info: %w", err)
+	}
+
+	// Duplicates are all removed before any keys are changed, since the keys must be unique
+	kept := make(map[string]string)
+	updates := make([]tagInfoRow, 0)
+	for _, info := range infos {
+		_, key := normalizeTag(info.Tag)
+		keptTag, ok := kept[key]
+		if !ok {
+			kept[key] = info.Tag
+			if key != info.TagKey {
+				updates = append(updates, tagInfoRow{Tag: info.Tag, TagKey: key})
+			}
+			continue
+		}
+
+		// Anything nested under the duplicate is nested under the tag that's kept instead
+		if _, err := db.ExecContext(ctx,
+			"UPDATE tag SET parent_tag = CASE WHEN tag = $1 THEN NULL ELSE $1 END WHERE parent_tag = $2",
+			keptTag, info.Tag); err != nil {
+			return fmt.Errorf("moving nested tags: %w", err)
+		}
+		if _, err := db.ExecContext(ctx, "DELETE FROM tag WHERE tag = $1", info.Tag); err != nil {
+			return fmt.Errorf("deleting duplicate tag: %w", err)
+		}
+	}
+
+	for _, update := range updates {
+		if _, err := db.ExecContext(ctx, "UPDATE tag SET tag_key = $1 WHERE tag = $2", update.TagKey, update.Tag); err != nil {
+			return fmt.Errorf("updating tag key: %w", err)
+		}
+	}
+
+	return nil
+}
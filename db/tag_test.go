@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chadweimer/gomp/models"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/mock/gomock"
 )
@@ -35,7 +36,7 @@ func Test_Tag_List(t *testing.T) {
 			sut, dbmock := getMockDb(t, nil)
 			defer sut.Close()
 
-			query := dbmock.ExpectQuery("SELECT tag, count\\(tag\\) as num FROM recipe_tag GROUP BY tag")
+			query := dbmock.ExpectQuery("SELECT min\\(tag\\), count\\(tag_key\\) as num FROM recipe_tag GROUP BY tag_key")
 			if test.dbError == nil {
 				rows := sqlmock.NewRows([]string{"tag", "count"})
 				for tag, count := range test.expectedResult {
@@ -71,6 +72,255 @@ func Test_Tag_List(t *testing.T) {
 	}
 }
 
+func Test_Tag_Tree(t *testing.T) {
+	// Arrange
+	sut, dbmock := getMockDb(t, nil)
+	defer sut.Close()
+
+	dbmock.ExpectQuery("SELECT tag, parent_tag, description, color, icon FROM tag").
+		WillReturnRows(sqlmock.NewRows([]string{"tag", "parent_tag", "description", "color", "icon"}).
+			AddRow("cuisine", nil, "", "", "").
+			AddRow("italian", "cuisine", "Dishes from Italy", "#008c45", "pizza").
+			AddRow("pasta", "italian", "", "", "").
+			AddRow("mexican", "cuisine", "", "", ""))
+	dbmock.ExpectQuery("SELECT recipe_id, tag, tag_key FROM recipe_tag").
+		WillReturnRows(sqlmock.NewRows([]string{"recipe_id", "tag", "tag_key"}).
+			AddRow(1, "italian", "italian").
+			AddRow(1, "pasta", "pasta").
+			AddRow(2, "Pasta", "pasta").
+			AddRow(3, "dessert", "dessert"))
+
+	// Act
+	result, err := sut.Tags().Tree(t.Context())
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := dbmock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	expected := []models.TagNode{
+		{
+			Tag:        "cuisine",
+			Count:      0,
+			TotalCount: 2,
+			Children: []models.TagNode{
+				{
+					Tag:         "italian",
+					Description: new("Dishes from Italy"),
+					Color:       new("#008c45"),
+					Icon:        new("pizza"),
+					Count:       1,
+					TotalCount:  2,
+					Children:    []models.TagNode{{Tag: "pasta", Count: 2, TotalCount: 2, Children: []models.TagNode{}}},
+				},
+				{Tag: "mexican", Count: 0, TotalCount: 0, Children: []models.TagNode{}},
+			},
+		},
+		{Tag: "dessert", Count: 1, TotalCount: 1, Children: []models.TagNode{}},
+	}
+	if !reflect.DeepEqual(*result, expected) {
+		t.Errorf("got = %v, want %v", *result, expected)
+	}
+}
+
+func Test_Tag_SaveInfo(t *testing.T) {
+	type testArgs struct {
+		name          string
+		parentTag     *string
+		storedParent  string
+		ancestors     []string
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Without parent", nil, "", nil, nil},
+		{"With parent", new("cuisine"), "cuisine", []string{"cuisine"}, nil},
+		{"With parent in different case", new("Cuisine"), "cuisine", []string{"cuisine"}, nil},
+		{"Nested under itself", new("pasta"), "pasta", []string{"pasta", "Italian"}, ErrTagCycle},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			var parentTag *string
+			if test.parentTag != nil {
+				parentTag = &test.storedParent
+				dbmock.ExpectExec("INSERT INTO tag \\(tag, tag_key\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT \\(tag_key\\) DO NOTHING").
+					WithArgs(*test.parentTag, test.storedParent).WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectQuery("SELECT tag FROM tag WHERE tag_key = \\$1").
+					WithArgs(test.storedParent).WillReturnRows(sqlmock.NewRows([]string{"tag"}).AddRow(test.storedParent))
+				rows := sqlmock.NewRows([]string{"tag"})
+				for _, ancestor := range test.ancestors {
+					rows.AddRow(ancestor)
+				}
+				dbmock.ExpectQuery("WITH RECURSIVE a\\(tag\\) AS").WithArgs(test.storedParent).WillReturnRows(rows)
+			}
+			if test.expectedError == nil {
+				dbmock.ExpectExec("INSERT INTO tag \\(tag, tag_key, parent_tag, description, color, icon\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6\\) ON CONFLICT \\(tag_key\\) DO UPDATE SET tag = excluded\\.tag").
+					WithArgs("italian", "italian", parentTag, "Dishes from Italy", "", "").
+					WillReturnResult(driver.RowsAffected(1))
+				dbmock.ExpectCommit()
+			} else {
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Tags().SaveInfo(t.Context(), "italian", &models.TagInfo{ParentTag: test.parentTag, Description: new("Dishes from Italy")})
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Tag_Merge(t *testing.T) {
+	type testArgs struct {
+		name          string
+		tags          []string
+		keys          []string
+		updated       int64
+		deleted       int64
+		dbError       error
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", []string{"Chicken", "chickn", "chicken"}, []string{"chickn"}, 1, 3, nil, nil},
+		{"Nothing to merge", []string{"chicken"}, nil, 0, 0, nil, nil},
+		{"Only case differs", []string{"Chicken"}, nil, 2, 0, nil, nil},
+		{"Tags not used", []string{"Chicken", "chickn"}, []string{"chickn"}, 0, 0, nil, ErrNotFound},
+		{"Database error", []string{"chickn"}, []string{"chickn"}, 0, 0, sql.ErrConnDone, sql.ErrConnDone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			if !reflect.DeepEqual(test.tags, []string{"chicken"}) {
+				keyArgs := make([]driver.Value, 0, len(test.keys))
+				for _, key := range test.keys {
+					keyArgs = append(keyArgs, key)
+				}
+
+				dbmock.ExpectBegin()
+				if len(test.keys) > 0 {
+					insert := dbmock.ExpectExec("INSERT INTO recipe_tag \\(recipe_id, tag, tag_key\\) SELECT DISTINCT t\\.recipe_id, CAST\\(\\? AS TEXT\\), CAST\\(\\? AS TEXT\\) FROM recipe_tag AS t WHERE t\\.tag_key IN \\(.+\\) AND NOT EXISTS").
+						WithArgs(append(append([]driver.Value{"chicken", "chicken"}, keyArgs...), "chicken")...)
+					if test.dbError != nil {
+						insert.WillReturnError(test.dbError)
+						dbmock.ExpectRollback()
+					} else {
+						insert.WillReturnResult(driver.RowsAffected(1))
+						dbmock.ExpectExec("INSERT INTO app_user_favorite_tag \\(user_id, tag, tag_key\\)").
+							WithArgs(append(append([]driver.Value{"chicken", "chicken"}, keyArgs...), "chicken")...).
+							WillReturnResult(driver.RowsAffected(0))
+						dbmock.ExpectExec("INSERT INTO search_filter_tag \\(search_filter_id, tag, tag_key, excluded\\)").
+							WithArgs(append(append(append([]driver.Value{"chicken", "chicken"}, keyArgs...), "chicken"), keyArgs...)...).
+							WillReturnResult(driver.RowsAffected(0))
+					}
+				}
+				if test.dbError == nil {
+					dbmock.ExpectExec("UPDATE recipe_tag SET tag = \\$1 WHERE tag_key = \\$2 AND tag <> \\$1").
+						WithArgs("chicken", "chicken").WillReturnResult(driver.RowsAffected(test.updated))
+					for _, table := range []string{"app_user_favorite_tag", "search_filter_tag", "tag"} {
+						dbmock.ExpectExec("UPDATE "+table+" SET tag = \\$1 WHERE tag_key = \\$2 AND tag <> \\$1").
+							WithArgs("chicken", "chicken").WillReturnResult(driver.RowsAffected(0))
+					}
+					if len(test.keys) > 0 {
+						dbmock.ExpectExec("INSERT INTO tag \\(tag, tag_key, parent_tag, description, color, icon\\) SELECT CAST\\(\\? AS TEXT\\), CAST\\(\\? AS TEXT\\)").
+							WithArgs(append(append(append([]driver.Value{"chicken", "chicken", "chicken"}, keyArgs...), keyArgs...), "chicken")...).
+							WillReturnResult(driver.RowsAffected(0))
+						dbmock.ExpectExec("UPDATE tag SET parent_tag = \\? WHERE parent_tag IN \\(SELECT p\\.tag FROM tag AS p WHERE p\\.tag_key IN \\(.+\\)\\) AND tag NOT IN \\(WITH RECURSIVE").
+							WithArgs(append(append([]driver.Value{"chicken"}, keyArgs...), "chicken")...).
+							WillReturnResult(driver.RowsAffected(0))
+						dbmock.ExpectExec("UPDATE tag SET parent_tag = \\(SELECT p\\.parent_tag FROM tag AS p WHERE p\\.tag = tag\\.parent_tag\\) WHERE parent_tag IN").
+							WithArgs(keyArgs...).WillReturnResult(driver.RowsAffected(0))
+						dbmock.ExpectExec("DELETE FROM recipe_tag WHERE tag_key IN \\(\\?\\)").
+							WithArgs(keyArgs...).WillReturnResult(driver.RowsAffected(test.deleted))
+						for _, table := range []string{"app_user_favorite_tag", "search_filter_tag", "tag"} {
+							dbmock.ExpectExec("DELETE FROM " + table + " WHERE tag_key IN \\(\\?\\)").
+								WithArgs(keyArgs...).WillReturnResult(driver.RowsAffected(0))
+						}
+					}
+					if test.expectedError == nil {
+						dbmock.ExpectCommit()
+					} else {
+						dbmock.ExpectRollback()
+					}
+				}
+			}
+
+			// Act
+			err := sut.Tags().Merge(t.Context(), test.tags, "chicken")
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Tag_Delete(t *testing.T) {
+	type testArgs struct {
+		name          string
+		deleted       int64
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", 1, nil},
+		{"Not found", 0, ErrNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange
+			sut, dbmock := getMockDb(t, nil)
+			defer sut.Close()
+
+			dbmock.ExpectBegin()
+			dbmock.ExpectExec("UPDATE tag SET parent_tag = \\(SELECT p\\.parent_tag FROM tag AS p WHERE p\\.tag = tag\\.parent_tag\\) WHERE parent_tag IN \\(SELECT p\\.tag FROM tag AS p WHERE p\\.tag_key IN \\(\\?\\)\\)").
+				WithArgs("chickn").WillReturnResult(driver.RowsAffected(0))
+			dbmock.ExpectExec("DELETE FROM recipe_tag WHERE tag_key IN \\(\\?\\)").WithArgs("chickn").WillReturnResult(driver.RowsAffected(0))
+			dbmock.ExpectExec("DELETE FROM app_user_favorite_tag WHERE tag_key IN \\(\\?\\)").WithArgs("chickn").WillReturnResult(driver.RowsAffected(test.deleted))
+			dbmock.ExpectExec("DELETE FROM search_filter_tag WHERE tag_key IN \\(\\?\\)").WithArgs("chickn").WillReturnResult(driver.RowsAffected(0))
+			dbmock.ExpectExec("DELETE FROM tag WHERE tag_key IN \\(\\?\\)").WithArgs("chickn").WillReturnResult(driver.RowsAffected(0))
+			if test.expectedError == nil {
+				dbmock.ExpectCommit()
+			} else {
+				dbmock.ExpectRollback()
+			}
+
+			// Act
+			err := sut.Tags().Delete(t.Context(), "Chickn")
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if err := dbmock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
 func Test_createTagForRecipe(t *testing.T) {
 	type testArgs struct {
 		recipeID      int64
@@ -81,9 +331,9 @@ func Test_createTagForRecipe(t *testing.T) {
 
 	// Arrange
 	tests := []testArgs{
-		{1, "weeknight", nil, nil},
-		{1, "weeknight", sql.ErrNoRows, ErrNotFound},
-		{1, "weeknight", sql.ErrConnDone, sql.ErrConnDone},
+		{1, " Weeknight ", nil, nil},
+		{1, "Weeknight", sql.ErrNoRows, ErrNotFound},
+		{1, "Weeknight", sql.ErrConnDone, sql.ErrConnDone},
 	}
 	for i, test := range tests {
 		t.Run(fmt.Sprint(i), func(t *testing.T) {
@@ -95,8 +345,8 @@ func Test_createTagForRecipe(t *testing.T) {
 			defer sut.Close()
 
 			dbmock.ExpectBegin()
-			exec := dbmock.ExpectExec("INSERT INTO recipe_tag \\(recipe_id, tag\\) VALUES \\(\\$1, \\$2\\)").
-				WithArgs(test.recipeID, test.tag)
+			exec := dbmock.ExpectExec("INSERT INTO recipe_tag \\(recipe_id, tag, tag_key\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT \\(recipe_id, tag_key\\) DO NOTHING").
+				WithArgs(test.recipeID, "Weeknight", "weeknight")
 			if test.dbError == nil {
 				exec.WillReturnResult(driver.RowsAffected(1))
 				dbmock.ExpectCommit()
@@ -232,3 +482,85 @@ func Test_listTagsForRecipe(t *testing.T) {
 		})
 	}
 }
+
+func Test_normalizeTag(t *testing.T) {
+	type testArgs struct {
+		tag             string
+		expectedDisplay string
+		expectedKey     string
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"weeknight", "weeknight", "weeknight"},
+		{"  Weeknight\t", "Weeknight", "weeknight"},
+		// Decomposed accents are composed
+		{"Cre\u0300me Bru\u0302le\u0301e", "Crème Brûlée", "crème brûlée"},
+		{"STRAẞE", "STRAẞE", "strasse"},
+		{"   ", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.tag, func(t *testing.T) {
+			// Act
+			display, key := normalizeTag(test.tag)
+
+			// Assert
+			if display != test.expectedDisplay {
+				t.Errorf("expected display: %q, received: %q", test.expectedDisplay, display)
+			}
+			if key != test.expectedKey {
+				t.Errorf("expected key: %q, received: %q", test.expectedKey, key)
+			}
+		})
+	}
+}
+
+func Test_normalizeTagKeys(t *testing.T) {
+	// Arrange
+	sut, dbmock := getMockDb(t, nil)
+	defer sut.Close()
+
+	dbmock.ExpectBegin()
+	dbmock.ExpectQuery("SELECT recipe_id AS owner_id, tag, tag_key, FALSE AS excluded FROM recipe_tag ORDER BY owner_id, excluded, tag").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "tag", "tag_key", "excluded"}).
+			AddRow(1, "Äpfel", "Äpfel", false).
+			AddRow(1, "äpfel", "äpfel", false).
+			AddRow(2, "soup", "soup", false))
+	dbmock.ExpectExec("DELETE FROM recipe_tag WHERE recipe_id = \\$1").WithArgs(1).WillReturnResult(driver.RowsAffected(2))
+	dbmock.ExpectExec("INSERT INTO recipe_tag \\(recipe_id, tag, tag_key\\) VALUES \\(\\$1, \\$2, \\$3\\)").
+		WithArgs(1, "Äpfel", "äpfel").WillReturnResult(driver.RowsAffected(1))
+	dbmock.ExpectQuery("SELECT user_id AS owner_id, tag, tag_key, FALSE AS excluded FROM app_user_favorite_tag").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "tag", "tag_key", "excluded"}).
+			AddRow(1, "soup", "soup", false))
+	dbmock.ExpectQuery("SELECT search_filter_id AS owner_id, tag, tag_key, excluded FROM search_filter_tag").
+		WillReturnRows(sqlmock.NewRows([]string{"owner_id", "tag", "tag_key", "excluded"}).
+			AddRow(1, "äpfel", "äpfel", false).
+			AddRow(1, "Äpfel", "Äpfel", true))
+	dbmock.ExpectExec("DELETE FROM search_filter_tag WHERE search_filter_id = \\$1").WithArgs(1).WillReturnResult(driver.RowsAffected(2))
+	dbmock.ExpectExec("INSERT INTO search_filter_tag \\(search_filter_id, tag, tag_key, excluded\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+		WithArgs(1, "äpfel", "äpfel", false).WillReturnResult(driver.RowsAffected(1))
+	dbmock.ExpectQuery("SELECT tag, tag_key FROM tag ORDER BY tag").
+		WillReturnRows(sqlmock.NewRows([]string{"tag", "tag_key"}).
+			AddRow("Obst", "Obst").
+			AddRow("Äpfel", "Äpfel").
+			AddRow("äpfel", "äpfel"))
+	dbmock.ExpectExec("UPDATE tag SET parent_tag = CASE WHEN tag = \\$1 THEN NULL ELSE \\$1 END WHERE parent_tag = \\$2").
+		WithArgs("Äpfel", "äpfel").WillReturnResult(driver.RowsAffected(0))
+	dbmock.ExpectExec("DELETE FROM tag WHERE tag = \\$1").WithArgs("äpfel").WillReturnResult(driver.RowsAffected(1))
+	dbmock.ExpectExec("UPDATE tag SET tag_key = \\$1 WHERE tag = \\$2").WithArgs("obst", "Obst").WillReturnResult(driver.RowsAffected(1))
+	dbmock.ExpectExec("UPDATE tag SET tag_key = \\$1 WHERE tag = \\$2").WithArgs("äpfel", "Äpfel").WillReturnResult(driver.RowsAffected(1))
+	dbmock.ExpectCommit()
+
+	// Act
+	err := tx(t.Context(), sut.Db, func(db *sqlx.Tx) error {
+		return normalizeTagKeys(t.Context(), db)
+	})
+
+	// Assert
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := dbmock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
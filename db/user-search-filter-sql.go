@@ -6,6 +6,7 @@ import (
 
 	"github.com/chadweimer/gomp/models"
 	"github.com/jmoiron/sqlx"
+	"github.com/samber/lo"
 )
 
 type sqlUserSearchFilterDriver struct {
@@ -23,11 +24,11 @@ func (d *sqlUserSearchFilterDriver) createImpl(ctx context.Context, filter *mode
 		return ErrMissingID
 	}
 
-	stmt := "INSERT INTO search_filter (user_id, name, query, with_pictures, sort_by, sort_dir) " +
-		"VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	stmt := "INSERT INTO search_filter (user_id, name, query, with_pictures, tag_match, max_total_time, sort_by, sort_dir) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
 
 	err := sqlx.GetContext(ctx, db, filter,
-		stmt, filter.UserID, filter.Name, filter.Query, filter.WithPictures, filter.SortBy, filter.SortDir)
+		stmt, filter.UserID, filter.Name, filter.Query, filter.WithPictures, getTagMatchOrDefault(filter.TagMatch), filter.MaxTotalTime, filter.SortBy, filter.SortDir)
 	if err != nil {
 		return err
 	}
@@ -40,7 +41,7 @@ func (d *sqlUserSearchFilterDriver) createImpl(ctx context.Context, filter *mode
 		return err
 	}
 
-	return d.setTagsImpl(ctx, *filter.ID, filter.Tags, db)
+	return d.setTagsImpl(ctx, *filter.ID, filter.Tags, filter.ExcludedTags, db)
 }
 
 func (*sqlUserSearchFilterDriver) setFieldsImpl(ctx context.Context, filterID int64, fields []models.SearchField, db sqlx.ExecerContext) error {
@@ -79,16 +80,33 @@ func (*sqlUserSearchFilterDriver) setStatesImpl(ctx context.Context, filterID in
 	return nil
 }
 
-func (*sqlUserSearchFilterDriver) setTagsImpl(ctx context.Context, filterID int64, tags []string, db sqlx.ExecerContext) error {
+func (*sqlUserSearchFilterDriver) setTagsImpl(ctx context.Context, filterID int64, tags []string, excludedTags []string, db sqlx.ExecerContext) error {
 	// Deleting and recreating seems inefficient. Maybe make this smarter.
 	if _, err := db.ExecContext(ctx, "DELETE FROM search_filter_tag WHERE search_filter_id = $1", filterID); err != nil {
 		return err
 	}
 
+	includedKeys := make([]string, 0, len(tags))
 	for _, tag := range tags {
+		_, key := normalizeTag(tag)
+		includedKeys = append(includedKeys, key)
 		_, err := db.ExecContext(ctx,
-			"INSERT INTO search_filter_tag (search_filter_id, tag) VALUES ($1, $2)",
-			filterID, tag)
+			"INSERT INTO search_filter_tag (search_filter_id, tag, tag_key, excluded) VALUES ($1, $2, $3, $4)",
+			filterID, tag, key, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tag := range excludedTags {
+		// A tag can't be both included and excluded, regardless of case, so the inclusion wins
+		_, key := normalizeTag(tag)
+		if lo.Contains(includedKeys, key) {
+			continue
+		}
+		_, err := db.ExecContext(ctx,
+			"INSERT INTO search_filter_tag (search_filter_id, tag, tag_key, excluded) VALUES ($1, $2, $3, $4)",
+			filterID, tag, key, true)
 		if err != nil {
 			return err
 		}
@@ -97,6 +115,13 @@ func (*sqlUserSearchFilterDriver) setTagsImpl(ctx context.Context, filterID int6
 	return nil
 }
 
+func getTagMatchOrDefault(tagMatch models.TagMatch) models.TagMatch {
+	if tagMatch == "" {
+		return models.Any
+	}
+	return tagMatch
+}
+
 func (d *sqlUserSearchFilterDriver) Read(ctx context.Context, userID int64, filterID int64) (*models.SavedSearchFilter, error) {
 	return get(d.Db, func(db sqlx.QueryerContext) (*models.SavedSearchFilter, error) {
 		return d.readImpl(ctx, userID, filterID, db)
@@ -137,12 +162,23 @@ func (*sqlUserSearchFilterDriver) readImpl(ctx context.Context, userID int64, fi
 		ctx,
 		db,
 		&tags,
-		"SELECT tag FROM search_filter_tag WHERE search_filter_id = $1",
-		filterID); err != nil && err != sql.ErrNoRows {
+		"SELECT tag FROM search_filter_tag WHERE search_filter_id = $1 AND excluded = $2",
+		filterID, false); err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
 	filter.Tags = tags
 
+	excludedTags := make([]string, 0)
+	if err := sqlx.SelectContext(
+		ctx,
+		db,
+		&excludedTags,
+		"SELECT tag FROM search_filter_tag WHERE search_filter_id = $1 AND excluded = $2",
+		filterID, true); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	filter.ExcludedTags = excludedTags
+
 	return filter, nil
 }
 
@@ -166,11 +202,11 @@ func (d *sqlUserSearchFilterDriver) updateImpl(ctx context.Context, filter *mode
 		return err
 	}
 
-	stmt := "UPDATE search_filter SET name = $1, query = $2, with_pictures = $3, sort_by = $4, sort_dir = $5 " +
-		"WHERE id = $6 AND user_id = $7"
+	stmt := "UPDATE search_filter SET name = $1, query = $2, with_pictures = $3, tag_match = $4, max_total_time = $5, sort_by = $6, sort_dir = $7 " +
+		"WHERE id = $8 AND user_id = $9"
 
 	_, err := db.ExecContext(
-		ctx, stmt, filter.Name, filter.Query, filter.WithPictures, filter.SortBy, filter.SortDir, filter.ID, filter.UserID)
+		ctx, stmt, filter.Name, filter.Query, filter.WithPictures, getTagMatchOrDefault(filter.TagMatch), filter.MaxTotalTime, filter.SortBy, filter.SortDir, filter.ID, filter.UserID)
 	if err != nil {
 		return err
 	}
@@ -183,7 +219,7 @@ func (d *sqlUserSearchFilterDriver) updateImpl(ctx context.Context, filter *mode
 		return err
 	}
 
-	return d.setTagsImpl(ctx, *filter.ID, filter.Tags, db)
+	return d.setTagsImpl(ctx, *filter.ID, filter.Tags, filter.ExcludedTags, db)
 }
 
 func (d *sqlUserSearchFilterDriver) Delete(ctx context.Context, userID int64, filterID int64) error {
@@ -6,10 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/chadweimer/gomp/models"
+	"github.com/samber/lo"
 	"go.uber.org/mock/gomock"
 )
 
@@ -34,6 +37,9 @@ func Test_UserSearchFilter_Create(t *testing.T) {
 				Fields:       []models.SearchField{models.SearchFieldName, models.SearchFieldIngredients},
 				States:       []models.RecipeState{models.Active, models.Archived},
 				Tags:         []string{"weeknight", "high-protein"},
+				TagMatch:     models.All,
+				ExcludedTags: []string{"spicy", "weeknight"},
+				MaxTotalTime: new(models.Duration(30 * time.Minute)),
 			},
 			nil,
 			nil,
@@ -76,12 +82,14 @@ func Test_UserSearchFilter_Create(t *testing.T) {
 			dbmock.ExpectBegin()
 			if test.preConditionError == nil {
 				query := dbmock.ExpectQuery(
-					"INSERT INTO search_filter \\(user_id, name, query, with_pictures, sort_by, sort_dir\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6\\) RETURNING id").
+					"INSERT INTO search_filter \\(user_id, name, query, with_pictures, tag_match, max_total_time, sort_by, sort_dir\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7, \\$8\\) RETURNING id").
 					WithArgs(
 						test.searchFilter.UserID,
 						test.searchFilter.Name,
 						test.searchFilter.Query,
 						test.searchFilter.WithPictures,
+						getTagMatchOrDefault(test.searchFilter.TagMatch),
+						test.searchFilter.MaxTotalTime,
 						test.searchFilter.SortBy,
 						test.searchFilter.SortDir)
 				if test.dbError == nil {
@@ -109,8 +117,15 @@ func Test_UserSearchFilter_Create(t *testing.T) {
 						WithArgs(expectedID).
 						WillReturnResult(driver.RowsAffected(1))
 					for _, tag := range test.searchFilter.Tags {
-						dbmock.ExpectExec("INSERT INTO search_filter_tag \\(search_filter_id, tag\\) VALUES \\(\\$1, \\$2\\)").
-							WithArgs(expectedID, tag).
+						_, key := normalizeTag(tag)
+						dbmock.ExpectExec("INSERT INTO search_filter_tag \\(search_filter_id, tag, tag_key, excluded\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+							WithArgs(expectedID, tag, key, false).
+							WillReturnResult(driver.RowsAffected(1))
+					}
+					for _, tag := range lo.Without(test.searchFilter.ExcludedTags, test.searchFilter.Tags...) {
+						_, key := normalizeTag(tag)
+						dbmock.ExpectExec("INSERT INTO search_filter_tag \\(search_filter_id, tag, tag_key, excluded\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+							WithArgs(expectedID, tag, key, true).
 							WillReturnResult(driver.RowsAffected(1))
 					}
 
@@ -166,8 +181,8 @@ func Test_UserSearchFilter_Read(t *testing.T) {
 			query := dbmock.ExpectQuery("SELECT \\* FROM search_filter WHERE id = \\$1 AND user_id = \\$2").
 				WithArgs(test.filterID, test.userID)
 			if test.dbError == nil {
-				rows := sqlmock.NewRows([]string{"id", "name", "query", "with_pictures", "sort_by", "sort_dir"}).
-					AddRow(test.filterID, "My Filter", "My Query", true, models.SortByID, models.Asc)
+				rows := sqlmock.NewRows([]string{"id", "name", "query", "with_pictures", "tag_match", "sort_by", "sort_dir"}).
+					AddRow(test.filterID, "My Filter", "My Query", true, models.All, models.SortByID, models.Asc)
 				query.WillReturnRows(rows)
 
 				dbmock.ExpectQuery("SELECT field_name FROM search_filter_field WHERE search_filter_id = \\$1").
@@ -178,20 +193,35 @@ func Test_UserSearchFilter_Read(t *testing.T) {
 					WithArgs(test.filterID).
 					WillReturnRows(&sqlmock.Rows{})
 
-				dbmock.ExpectQuery("SELECT tag FROM search_filter_tag WHERE search_filter_id = \\$1").
-					WithArgs(test.filterID).
-					WillReturnRows(&sqlmock.Rows{})
+				dbmock.ExpectQuery("SELECT tag FROM search_filter_tag WHERE search_filter_id = \\$1 AND excluded = \\$2").
+					WithArgs(test.filterID, false).
+					WillReturnRows(sqlmock.NewRows([]string{"tag"}).AddRow("weeknight"))
+
+				dbmock.ExpectQuery("SELECT tag FROM search_filter_tag WHERE search_filter_id = \\$1 AND excluded = \\$2").
+					WithArgs(test.filterID, true).
+					WillReturnRows(sqlmock.NewRows([]string{"tag"}).AddRow("spicy"))
 			} else {
 				query.WillReturnError(test.dbError)
 			}
 
 			// Act
-			_, err := sut.UserSearchFilters().Read(t.Context(), test.userID, test.filterID)
+			filter, err := sut.UserSearchFilters().Read(t.Context(), test.userID, test.filterID)
 
 			// Assert
 			if !errors.Is(err, test.expectedError) {
 				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
 			}
+			if err == nil {
+				if filter.TagMatch != models.All {
+					t.Errorf("expected tag match %s, received %s", models.All, filter.TagMatch)
+				}
+				if !reflect.DeepEqual(filter.Tags, []string{"weeknight"}) {
+					t.Errorf("unexpected tags: %v", filter.Tags)
+				}
+				if !reflect.DeepEqual(filter.ExcludedTags, []string{"spicy"}) {
+					t.Errorf("unexpected excluded tags: %v", filter.ExcludedTags)
+				}
+			}
 			if err := dbmock.ExpectationsWereMet(); err != nil {
 				t.Errorf("there were unfulfilled expectations: %s", err)
 			}
@@ -216,11 +246,14 @@ func Test_UserSearchFilter_Update(t *testing.T) {
 				Name:         "My Filter",
 				Query:        "My Query",
 				WithPictures: new(bool(true)),
-				SortBy:       models.SortByCreated,
+				SortBy:       models.SortByTotalTime,
 				SortDir:      models.Desc,
 				Fields:       []models.SearchField{models.SearchFieldName, models.SearchFieldIngredients},
 				States:       []models.RecipeState{models.Active, models.Archived},
 				Tags:         []string{"weeknight", "high-protein"},
+				TagMatch:     models.All,
+				ExcludedTags: []string{"spicy", "weeknight"},
+				MaxTotalTime: new(models.Duration(time.Hour)),
 			},
 			nil,
 			nil,
@@ -277,11 +310,13 @@ func Test_UserSearchFilter_Update(t *testing.T) {
 					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(test.searchFilter.ID))
 
 				exec := dbmock.ExpectExec(
-					"UPDATE search_filter SET name = \\$1, query = \\$2, with_pictures = \\$3, sort_by = \\$4, sort_dir = \\$5 WHERE id = \\$6 AND user_id = \\$7").
+					"UPDATE search_filter SET name = \\$1, query = \\$2, with_pictures = \\$3, tag_match = \\$4, max_total_time = \\$5, sort_by = \\$6, sort_dir = \\$7 WHERE id = \\$8 AND user_id = \\$9").
 					WithArgs(
 						test.searchFilter.Name,
 						test.searchFilter.Query,
 						test.searchFilter.WithPictures,
+						getTagMatchOrDefault(test.searchFilter.TagMatch),
+						test.searchFilter.MaxTotalTime,
 						test.searchFilter.SortBy,
 						test.searchFilter.SortDir,
 						test.searchFilter.ID,
@@ -311,8 +346,15 @@ func Test_UserSearchFilter_Update(t *testing.T) {
 						WithArgs(test.searchFilter.ID).
 						WillReturnResult(driver.RowsAffected(1))
 					for _, tag := range test.searchFilter.Tags {
-						dbmock.ExpectExec("INSERT INTO search_filter_tag \\(search_filter_id, tag\\) VALUES \\(\\$1, \\$2\\)").
-							WithArgs(test.searchFilter.ID, tag).
+						_, key := normalizeTag(tag)
+						dbmock.ExpectExec("INSERT INTO search_filter_tag \\(search_filter_id, tag, tag_key, excluded\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+							WithArgs(test.searchFilter.ID, tag, key, false).
+							WillReturnResult(driver.RowsAffected(1))
+					}
+					for _, tag := range lo.Without(test.searchFilter.ExcludedTags, test.searchFilter.Tags...) {
+						_, key := normalizeTag(tag)
+						dbmock.ExpectExec("INSERT INTO search_filter_tag \\(search_filter_id, tag, tag_key, excluded\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+							WithArgs(test.searchFilter.ID, tag, key, true).
 							WillReturnResult(driver.RowsAffected(1))
 					}
 
@@ -57,9 +57,10 @@ func (*sqlUserSettingsDriver) updateImpl(ctx context.Context, settings *models.U
 		return fmt.Errorf("deleting favorite tags before updating on user: %w", err)
 	}
 	for _, tag := range settings.FavoriteTags {
+		_, key := normalizeTag(tag)
 		_, err = db.ExecContext(ctx,
-			"INSERT INTO app_user_favorite_tag (user_id, tag) VALUES ($1, $2)",
-			settings.UserID, tag)
+			"INSERT INTO app_user_favorite_tag (user_id, tag, tag_key) VALUES ($1, $2, $3)",
+			settings.UserID, tag, key)
 		if err != nil {
 			return fmt.Errorf("updating favorite tags on user: %w", err)
 		}
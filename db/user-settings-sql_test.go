@@ -107,8 +107,9 @@ func Test_UserSettings_Update(t *testing.T) {
 					WillReturnResult(driver.RowsAffected(1))
 
 				for _, tag := range test.favoriteTags {
-					dbmock.ExpectExec("INSERT INTO app_user_favorite_tag \\(user_id, tag\\) VALUES \\(\\$1, \\$2\\)").
-						WithArgs(test.userID, tag).
+					_, key := normalizeTag(tag)
+					dbmock.ExpectExec("INSERT INTO app_user_favorite_tag \\(user_id, tag, tag_key\\) VALUES \\(\\$1, \\$2, \\$3\\)").
+						WithArgs(test.userID, tag, key).
 						WillReturnResult(driver.RowsAffected(1))
 				}
 
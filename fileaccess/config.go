@@ -3,6 +3,7 @@ package fileaccess
 import (
 	"errors"
 	"fmt"
+	"net/url"
 
 	"github.com/chadweimer/gomp/models"
 )
@@ -16,17 +17,105 @@ type Config struct {
 	Image ImageConfig
 }
 
+const (
+	// FilesDriverFS stores files in a directory of the local file system
+	FilesDriverFS = "fs"
+
+	// FilesDriverS3 stores files in a bucket of an S3-compatible object store
+	FilesDriverS3 = "s3"
+
+	// FilesDriverDB stores files in the database, alongside everything else
+	FilesDriverDB = "db"
+)
+
 // FilesConfig represents the configuration settings for file storage
 type FilesConfig struct {
+	// Driver gets where to store files.
+	// Supported drivers: fs, s3, db
+	Driver string `env:"FILES_DRIVER" default:"fs"`
+
 	// Path gets the path (full or relative) under which to store files (e.g., uploads and backups).
+	// Only used by the fs driver.
 	Path string `env:"FILES_PATH" default:"data"`
+
+	// S3 contains the settings for the s3 driver
+	S3 S3Config
 }
 
 func (c FilesConfig) validate() error {
 	errs := make([]error, 0)
 
-	if c.Path == "" {
-		errs = append(errs, errors.New("path must be specified"))
+	switch c.Driver {
+	case "", FilesDriverFS:
+		if c.Path == "" {
+			errs = append(errs, errors.New("path must be specified"))
+		}
+	case FilesDriverS3:
+		if err := c.S3.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	case FilesDriverDB:
+		// Nothing to validate; the database has its own configuration
+	default:
+		errs = append(errs, fmt.Errorf("files driver must be one of ('%s', '%s', '%s')", FilesDriverFS, FilesDriverS3, FilesDriverDB))
+	}
+
+	return errors.Join(errs...)
+}
+
+// S3Config represents the configuration settings for storing files in an S3-compatible object store
+type S3Config struct {
+	// Endpoint gets the URL of the object store, e.g., https://s3.us-east-1.amazonaws.com or http://minio:9000.
+	Endpoint url.URL `env:"FILES_S3_ENDPOINT"`
+
+	// Region gets the region of the bucket.
+	Region string `env:"FILES_S3_REGION" default:"us-east-1"`
+
+	// Bucket gets the name of the bucket to store files in.
+	Bucket string `env:"FILES_S3_BUCKET"`
+
+	// Prefix gets an optional prefix for the keys of all files, e.g., to share a bucket with other applications.
+	Prefix string `env:"FILES_S3_PREFIX"`
+
+	// AccessKeyID gets the ID of the access key used to authenticate with the object store.
+	AccessKeyID string `env:"FILES_S3_ACCESS_KEY_ID"`
+
+	// SecretAccessKey gets the secret of the access key used to authenticate with the object store.
+	SecretAccessKey string `env:"FILES_S3_SECRET_ACCESS_KEY"`
+
+	// PathStyle gets whether to address the bucket as part of the path (e.g., http://minio:9000/bucket/key)
+	// rather than as part of the host name (e.g., https://bucket.s3.us-east-1.amazonaws.com/key).
+	PathStyle bool `env:"FILES_S3_PATH_STYLE" default:"true"`
+
+	// PresignedURLs gets whether to redirect requests for files to presigned URLs of the object store,
+	// rather than serving the files through the application.
+	PresignedURLs bool `env:"FILES_S3_PRESIGNED_URLS" default:"false"`
+
+	// PresignedURLExpiry gets the number of seconds that presigned URLs are valid for.
+	PresignedURLExpiry int `env:"FILES_S3_PRESIGNED_URL_EXPIRY" default:"900"`
+}
+
+func (c S3Config) validate() error {
+	errs := make([]error, 0)
+
+	if c.Endpoint.Scheme != "http" && c.Endpoint.Scheme != "https" || c.Endpoint.Host == "" {
+		errs = append(errs, errors.New("s3 endpoint must be an http or https url"))
+	}
+
+	if c.Region == "" {
+		errs = append(errs, errors.New("s3 region must be specified"))
+	}
+
+	if c.Bucket == "" {
+		errs = append(errs, errors.New("s3 bucket must be specified"))
+	}
+
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		errs = append(errs, errors.New("s3 access key id and secret access key must be specified"))
+	}
+
+	if c.PresignedURLs && (c.PresignedURLExpiry <= 0 || c.PresignedURLExpiry > maxPresignedURLExpiry) {
+		errs = append(errs, fmt.Errorf("s3 presigned url expiry must be between 1 and %d seconds", maxPresignedURLExpiry))
 	}
 
 	return errors.Join(errs...)
@@ -46,8 +135,24 @@ type ImageConfig struct {
 
 	// ThumbnailSize gets the size of the bounding box to fit the thumbnails recipe images to.
 	ThumbnailSize int `env:"THUMBNAIL_SIZE" default:"500"`
+
+	// VariantWidths gets the widths of the smaller variants to generate of recipe images, for serving to smaller screens.
+	// Widths that are not smaller than an image are skipped for that image.
+	VariantWidths []int `env:"IMAGE_VARIANT_WIDTHS" default:"320,640,1280"`
+
+	// VariantFormats gets the formats to generate each variant of recipe images in.
+	// Supported formats: jpeg, webp
+	VariantFormats []string `env:"IMAGE_VARIANT_FORMATS" default:"webp,jpeg"`
 }
 
+const (
+	// ImageFormatJPEG encodes image variants as JPEG images
+	ImageFormatJPEG = "jpeg"
+
+	// ImageFormatWebP encodes image variants as lossy WebP images
+	ImageFormatWebP = "webp"
+)
+
 func (cfg ImageConfig) validate() error {
 	errs := make([]error, 0)
 
@@ -71,5 +176,19 @@ func (cfg ImageConfig) validate() error {
 		errs = append(errs, errors.New("thumbnail size must be positive"))
 	}
 
+	for _, width := range cfg.VariantWidths {
+		if width <= 0 {
+			errs = append(errs, errors.New("image variant widths must be positive"))
+			break
+		}
+	}
+
+	for _, format := range cfg.VariantFormats {
+		if format != ImageFormatJPEG && format != ImageFormatWebP {
+			errs = append(errs, fmt.Errorf("image variant formats must be one of ('%s', '%s')", ImageFormatJPEG, ImageFormatWebP))
+			break
+		}
+	}
+
 	return errors.Join(errs...)
 }
@@ -1,6 +1,7 @@
 package fileaccess
 
 import (
+	"net/url"
 	"testing"
 
 	"github.com/chadweimer/gomp/models"
@@ -8,17 +9,32 @@ import (
 
 func TestFilesConfig_validate(t *testing.T) {
 	type fields struct {
-		Path string
+		Driver string
+		Path   string
+		S3     S3Config
 	}
 	init := func(opts ...func(f *fields)) fields {
 		f := fields{
-			Path: "/path/to/data",
+			Driver: FilesDriverFS,
+			Path:   "/path/to/data",
 		}
 		for _, opt := range opts {
 			opt(&f)
 		}
 		return f
 	}
+	validS3 := func(f *fields) {
+		f.Driver = FilesDriverS3
+		f.Path = ""
+		f.S3 = S3Config{
+			Endpoint:           url.URL{Scheme: "http", Host: "minio:9000"},
+			Region:             "us-east-1",
+			Bucket:             "gomp",
+			AccessKeyID:        "key",
+			SecretAccessKey:    "secret",
+			PresignedURLExpiry: 900,
+		}
+	}
 	tests := []struct {
 		name    string
 		fields  fields
@@ -36,11 +52,97 @@ func TestFilesConfig_validate(t *testing.T) {
 			}),
 			wantErr: true,
 		},
+		{
+			name: "Empty Driver",
+			fields: init(func(f *fields) {
+				f.Driver = ""
+			}),
+			wantErr: false,
+		},
+		{
+			name: "DB",
+			fields: init(func(f *fields) {
+				f.Driver = FilesDriverDB
+				f.Path = ""
+			}),
+			wantErr: false,
+		},
+		{
+			name: "Invalid Driver",
+			fields: init(func(f *fields) {
+				f.Driver = "ftp"
+			}),
+			wantErr: true,
+		},
+		{
+			name:    "S3",
+			fields:  init(validS3),
+			wantErr: false,
+		},
+		{
+			name: "S3 Presigned URLs",
+			fields: init(validS3, func(f *fields) {
+				f.S3.PresignedURLs = true
+			}),
+			wantErr: false,
+		},
+		{
+			name: "S3 Invalid Endpoint",
+			fields: init(validS3, func(f *fields) {
+				f.S3.Endpoint = url.URL{Scheme: "ftp", Host: "minio:9000"}
+			}),
+			wantErr: true,
+		},
+		{
+			name: "S3 Empty Endpoint",
+			fields: init(validS3, func(f *fields) {
+				f.S3.Endpoint = url.URL{}
+			}),
+			wantErr: true,
+		},
+		{
+			name: "S3 Empty Region",
+			fields: init(validS3, func(f *fields) {
+				f.S3.Region = ""
+			}),
+			wantErr: true,
+		},
+		{
+			name: "S3 Empty Bucket",
+			fields: init(validS3, func(f *fields) {
+				f.S3.Bucket = ""
+			}),
+			wantErr: true,
+		},
+		{
+			name: "S3 Empty Secret Access Key",
+			fields: init(validS3, func(f *fields) {
+				f.S3.SecretAccessKey = ""
+			}),
+			wantErr: true,
+		},
+		{
+			name: "S3 Presigned URL Expiry Too Long",
+			fields: init(validS3, func(f *fields) {
+				f.S3.PresignedURLs = true
+				f.S3.PresignedURLExpiry = maxPresignedURLExpiry + 1
+			}),
+			wantErr: true,
+		},
+		{
+			name: "S3 Presigned URL Expiry Ignored",
+			fields: init(validS3, func(f *fields) {
+				f.S3.PresignedURLExpiry = 0
+			}),
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &FilesConfig{
-				Path: tt.fields.Path,
+				Driver: tt.fields.Driver,
+				Path:   tt.fields.Path,
+				S3:     tt.fields.S3,
 			}
 			if got := c.validate(); tt.wantErr != (got != nil) {
 				t.Errorf("FilesConfig.validate() = %v, want error? %v", got, tt.wantErr)
@@ -55,6 +157,8 @@ func TestImageConfig_validate(t *testing.T) {
 		ImageSize        int
 		ThumbnailQuality models.ImageQualityLevel
 		ThumbnailSize    int
+		VariantWidths    []int
+		VariantFormats   []string
 	}
 	init := func(opts ...func(f *fields)) fields {
 		f := fields{
@@ -62,6 +166,8 @@ func TestImageConfig_validate(t *testing.T) {
 			ImageSize:        1,
 			ThumbnailQuality: "high",
 			ThumbnailSize:    1,
+			VariantWidths:    []int{320, 640},
+			VariantFormats:   []string{ImageFormatWebP, ImageFormatJPEG},
 		}
 		for _, opt := range opts {
 			opt(&f)
@@ -99,6 +205,28 @@ func TestImageConfig_validate(t *testing.T) {
 			}),
 			wantErr: true,
 		},
+		{
+			name: "No Variants",
+			fields: init(func(f *fields) {
+				f.VariantWidths = nil
+				f.VariantFormats = nil
+			}),
+			wantErr: false,
+		},
+		{
+			name: "Bad Variant Width",
+			fields: init(func(f *fields) {
+				f.VariantWidths = []int{320, 0}
+			}),
+			wantErr: true,
+		},
+		{
+			name: "Bad Variant Format",
+			fields: init(func(f *fields) {
+				f.VariantFormats = []string{ImageFormatWebP, "avif"}
+			}),
+			wantErr: true,
+		},
 		{
 			name:    "Unset",
 			fields:  fields{},
@@ -112,6 +240,8 @@ func TestImageConfig_validate(t *testing.T) {
 				ImageSize:        tt.fields.ImageSize,
 				ThumbnailQuality: tt.fields.ThumbnailQuality,
 				ThumbnailSize:    tt.fields.ThumbnailSize,
+				VariantWidths:    tt.fields.VariantWidths,
+				VariantFormats:   tt.fields.VariantFormats,
 			}
 			if got := c.validate(); tt.wantErr != (got != nil) {
 				t.Errorf("ImageConfig.validate() = %v, want error? %v", got, tt.wantErr)
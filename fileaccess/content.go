@@ -0,0 +1,117 @@
+package fileaccess
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Recipe images are stored once per distinct content, named by the SHA-256 checksum of the content.
+// Each recipe that uses an image has an empty marker file with the same name in its refs directory,
+// and the recipes that use the content are recorded in the ImageReferences, so that the content is only removed
+// once the last recipe stops using it. Any smaller variants of the image are stored with the content as well,
+// and are only available for content-addressed images. Images uploaded before this layout are stored in the recipe's
+// directories directly, and are still supported.
+
+const contentDirectoryName = "content"
+
+// ImageReferences records which recipes use each content-addressed image.
+// It must be shared by every instance that uses the same upload store, e.g., by being kept in the database,
+// so that content isn't removed while a recipe of another instance starts using it.
+type ImageReferences interface {
+	// Lock prevents any other changes to the references to the content, by any instance,
+	// until the returned function is called
+	Lock(ctx context.Context, contentName string) (unlock func(), err error)
+
+	// Add records that the recipe uses the content
+	Add(ctx context.Context, contentName string, recipeID int64) error
+
+	// Remove records that the recipe no longer uses the content,
+	// returning the number of recipes that still do
+	Remove(ctx context.Context, contentName string, recipeID int64) (remaining int64, err error)
+
+	// List returns the recipes that use each content, keyed by the name of the content
+	List(ctx context.Context) (map[string][]int64, error)
+}
+
+func getDirPathForContentImage() string {
+	return filepath.Join(UploadDirectoryName, contentDirectoryName, "images")
+}
+
+func getDirPathForContentThumbnail() string {
+	return filepath.Join(UploadDirectoryName, contentDirectoryName, "thumbs")
+}
+
+func getDirPathForContentVariants(contentName string) string {
+	return filepath.Join(UploadDirectoryName, contentDirectoryName, "variants", contentName)
+}
+
+// getContentName returns the name to store the content under, with the specified extension
+func getContentName(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + ext
+}
+
+// isImageReference returns whether the recipe's image is a reference to a content-addressed image,
+// rather than an image stored in the recipe's directories directly
+func isImageReference(driver Driver, recipeID int64, imageName string) (bool, error) {
+	if _, err := driver.Stat(filepath.Join(getDirPathForReferences(recipeID), imageName)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// resolveImagePath returns the path of the file to read for the specified path, which is the path of the
+// content when it's a recipe image, thumbnail or variant that references a content-addressed image,
+// and the path itself otherwise.
+func resolveImagePath(driver Driver, filePath string) string {
+	// uploads/recipes/{id}/{images|thumbs}/{name} or uploads/recipes/{id}/variants/{name}/{variant}
+	parts := strings.Split(path.Clean(filepath.ToSlash(filePath)), "/")
+	if len(parts) < 5 || parts[0] != UploadDirectoryName || parts[1] != "recipes" {
+		return filePath
+	}
+	recipeID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return filePath
+	}
+
+	var contentPath string
+	switch {
+	case len(parts) == 5 && parts[3] == "images":
+		contentPath = filepath.Join(getDirPathForContentImage(), parts[4])
+	case len(parts) == 5 && parts[3] == "thumbs":
+		contentPath = filepath.Join(getDirPathForContentThumbnail(), parts[4])
+	case len(parts) == 6 && parts[3] == "variants":
+		contentPath = filepath.Join(getDirPathForContentVariants(parts[4]), parts[5])
+	default:
+		return filePath
+	}
+
+	// All are resolved using the marker in the refs directory
+	if isRef, err := isImageReference(driver, recipeID, parts[4]); err != nil || !isRef {
+		return filePath
+	}
+	return contentPath
+}
+
+// contentFS resolves references to content-addressed images when opening files
+type contentFS struct {
+	Driver
+}
+
+func (f contentFS) Open(name string) (fs.File, error) {
+	return f.Driver.Open(resolveImagePath(f.Driver, name))
+}
+
+func (f contentFS) Stat(name string) (fs.FileInfo, error) {
+	return f.Driver.Stat(resolveImagePath(f.Driver, name))
+}
@@ -1,10 +1,13 @@
 package fileaccess
 
-//go:generate go tool mockgen -destination=../mocks/fileaccess/mocks.gen.go -package=fileaccess . Driver,RootFS
+//go:generate go tool mockgen -destination=../mocks/fileaccess/mocks.gen.go -package=fileaccess . Driver,ImageReferences,RootFS
 
 import (
+	"errors"
 	"io"
 	"io/fs"
+	"net/http"
+	"strings"
 )
 
 const (
@@ -39,7 +42,52 @@ type Driver interface {
 	List(dirPath string) ([]fs.DirEntry, error)
 }
 
-// CreateDriver returns a Driver implementation
+// CreateDriver returns a Driver implementation.
+// The db driver isn't supported, since it's provided by the database driver instead.
 func CreateDriver(cfg FilesConfig) (Driver, error) {
-	return newFileSystemDriver(cfg.Path)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Driver {
+	case FilesDriverS3:
+		return newS3Driver(cfg.S3, http.DefaultClient)
+	case FilesDriverDB:
+		return nil, errors.New("the db files driver must be obtained from the database driver")
+	default:
+		return newFileSystemDriver(cfg.Path)
+	}
+}
+
+// NewFileServer returns a handler that serves the files of the driver.
+// Drivers that implement URLSigner are redirected to, rather than serving the files through the handler.
+// Recipe images that reference content-addressed images are served from the content.
+func NewFileServer(driver Driver) http.Handler {
+	signer, ok := driver.(URLSigner)
+	if !ok {
+		return http.FileServerFS(OnlyFiles(contentFS{driver}))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := resolveImagePath(driver, strings.TrimPrefix(r.URL.Path, "/"))
+		info, err := driver.Stat(name)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			http.NotFound(w, r)
+			return
+		case err != nil:
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		case info.IsDir():
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		signedURL, err := signer.SignURL(name)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, signedURL, http.StatusTemporaryRedirect)
+	})
 }
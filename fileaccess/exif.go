@@ -0,0 +1,306 @@
+package fileaccess
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+)
+
+// This file handles the EXIF metadata of uploaded JPEG images,
+// i.e., reading the orientation that cameras record instead of rotating
+// the image itself, and stripping metadata, e.g., the location the photo
+// was taken at, before the image is stored.
+
+// ---- Begin JPEG Markers ----
+
+const (
+	jpegMarkerSOI   = 0xd8
+	jpegMarkerEOI   = 0xd9
+	jpegMarkerSOS   = 0xda
+	jpegMarkerRST0  = 0xd0
+	jpegMarkerRST7  = 0xd7
+	jpegMarkerTEM   = 0x01
+	jpegMarkerAPP0  = 0xe0
+	jpegMarkerAPP1  = 0xe1
+	jpegMarkerAPP2  = 0xe2
+	jpegMarkerAPP14 = 0xee
+	jpegMarkerAPP15 = 0xef
+	jpegMarkerCOM   = 0xfe
+)
+
+// ---- End JPEG Markers ----
+
+// ---- Begin EXIF Orientations ----
+
+const (
+	exifOrientationNormal     = 1
+	exifOrientationFlipH      = 2
+	exifOrientationRotate180  = 3
+	exifOrientationFlipV      = 4
+	exifOrientationTranspose  = 5
+	exifOrientationRotate90   = 6
+	exifOrientationTransverse = 7
+	exifOrientationRotate270  = 8
+)
+
+// ---- End EXIF Orientations ----
+
+const exifTagOrientation = 0x0112
+
+var (
+	exifHeader       = []byte("Exif\x00\x00")
+	iccProfileHeader = []byte("ICC_PROFILE\x00")
+
+	errMalformedJPEG = errors.New("malformed jpeg")
+)
+
+// jpegSegment is a marker segment of a JPEG file, or the entropy-coded data that follows a scan header
+type jpegSegment struct {
+	// marker is the marker of the segment, or 0 for entropy-coded data
+	marker byte
+	// data is the full bytes of the segment, including the marker itself
+	data []byte
+}
+
+// payload returns the data of the segment following its marker and length
+func (s jpegSegment) payload() []byte {
+	if s.marker == 0 || len(s.data) < 4 {
+		return nil
+	}
+	return s.data[4:]
+}
+
+// splitJPEG splits the JPEG data into its segments, up to and including the end of image marker.
+// Anything following the end of the image, e.g., additional images embedded by some cameras, is dropped.
+func splitJPEG(data []byte) ([]jpegSegment, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != jpegMarkerSOI {
+		return nil, errMalformedJPEG
+	}
+
+	segments := []jpegSegment{{marker: jpegMarkerSOI, data: data[:2]}}
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xff {
+			return nil, errMalformedJPEG
+		}
+		// Any number of fill bytes may precede a marker
+		for pos+2 < len(data) && data[pos+1] == 0xff {
+			pos++
+		}
+		start := pos
+		marker := data[pos+1]
+		pos += 2
+
+		switch {
+		case marker == jpegMarkerEOI:
+			return append(segments, jpegSegment{marker: marker, data: data[start:pos]}), nil
+		case marker == jpegMarkerTEM || (marker >= jpegMarkerRST0 && marker <= jpegMarkerRST7):
+			// These markers are standalone, i.e., have no length
+			segments = append(segments, jpegSegment{marker: marker, data: data[start:pos]})
+			continue
+		}
+
+		if pos+2 > len(data) {
+			return nil, errMalformedJPEG
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return nil, errMalformedJPEG
+		}
+		pos += length
+		segments = append(segments, jpegSegment{marker: marker, data: data[start:pos]})
+
+		if marker == jpegMarkerSOS {
+			// The scan header is followed by entropy-coded data, which runs until the next marker
+			// other than a restart marker. Any 0xff bytes in the data itself are followed by a 0x00.
+			start = pos
+			for pos+1 < len(data) {
+				if data[pos] == 0xff && data[pos+1] != 0x00 && (data[pos+1] < jpegMarkerRST0 || data[pos+1] > jpegMarkerRST7) {
+					break
+				}
+				pos++
+			}
+			if pos+1 >= len(data) {
+				return nil, errMalformedJPEG
+			}
+			segments = append(segments, jpegSegment{data: data[start:pos]})
+		}
+	}
+}
+
+// readJPEGOrientation returns the EXIF orientation of the JPEG image,
+// or exifOrientationNormal if the image doesn't specify a valid one.
+func readJPEGOrientation(data []byte) int {
+	segments, err := splitJPEG(data)
+	if err != nil {
+		return exifOrientationNormal
+	}
+
+	for _, segment := range segments {
+		if segment.marker == jpegMarkerSOS {
+			// Metadata comes before the image data
+			break
+		}
+		payload := segment.payload()
+		if segment.marker != jpegMarkerAPP1 || !bytes.HasPrefix(payload, exifHeader) {
+			continue
+		}
+		if orientation, ok := readEXIFOrientation(payload[len(exifHeader):]); ok {
+			return orientation
+		}
+	}
+
+	return exifOrientationNormal
+}
+
+// readEXIFOrientation returns the orientation recorded in the first IFD of the TIFF structured EXIF data
+func readEXIFOrientation(tiff []byte) (int, bool) {
+	if len(tiff) < 8 {
+		return 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0, false
+	}
+
+	ifdOffset := int(order.Uint32(tiff[4:]))
+	if ifdOffset < 8 || ifdOffset+2 > len(tiff) {
+		return 0, false
+	}
+	count := int(order.Uint16(tiff[ifdOffset:]))
+	for i := range count {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:]) != exifTagOrientation {
+			continue
+		}
+		// The orientation is a single SHORT, which is stored in the first bytes of the value
+		const typeShort = 3
+		if order.Uint16(tiff[entry+2:]) != typeShort || order.Uint32(tiff[entry+4:]) != 1 {
+			return 0, false
+		}
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < exifOrientationNormal || orientation > exifOrientationRotate270 {
+			return 0, false
+		}
+		return orientation, true
+	}
+
+	return 0, false
+}
+
+// newEXIFSegment returns an APP1 segment holding nothing but the specified orientation
+func newEXIFSegment(orientation int) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, // Byte order and magic number
+		0, 0, 0, 8, // Offset of the first IFD
+		0, 1, // Number of entries
+		0, 0, 0, 3, 0, 0, 0, 1, 0, 0, 0, 0, // Orientation, as a single SHORT
+		0, 0, 0, 0, // Offset of the next IFD, i.e., none
+	}
+	binary.BigEndian.PutUint16(tiff[10:], exifTagOrientation)
+	binary.BigEndian.PutUint16(tiff[18:], uint16(orientation))
+
+	length := 2 + len(exifHeader) + len(tiff)
+	segment := []byte{0xff, jpegMarkerAPP1, byte(length >> 8), byte(length)}
+	segment = append(segment, exifHeader...)
+	return append(segment, tiff...)
+}
+
+// stripJPEGMetadata returns the JPEG image without any of the metadata it may carry,
+// e.g., EXIF, XMP and IPTC data or comments, without re-encoding it.
+// Only what is necessary to display the image correctly is kept, i.e., the JFIF header,
+// the color profile and, if not normal, the orientation.
+func stripJPEGMetadata(data []byte, orientation int) ([]byte, error) {
+	segments, err := splitJPEG(data)
+	if err != nil {
+		return nil, err
+	}
+
+	stripped := make([]byte, 0, len(data))
+	for _, segment := range segments {
+		if !keepJPEGSegment(segment) {
+			continue
+		}
+		stripped = append(stripped, segment.data...)
+		if segment.marker == jpegMarkerSOI && orientation != exifOrientationNormal {
+			stripped = append(stripped, newEXIFSegment(orientation)...)
+		}
+	}
+	return stripped, nil
+}
+
+// keepJPEGSegment returns whether the segment is kept when stripping metadata
+func keepJPEGSegment(segment jpegSegment) bool {
+	switch {
+	case segment.marker == jpegMarkerAPP0, segment.marker == jpegMarkerAPP14:
+		// JFIF and Adobe headers, which affect how colors are decoded
+		return true
+	case segment.marker == jpegMarkerAPP2:
+		// Also used for other data, e.g., multi-picture information, which is no longer valid once stripped
+		return bytes.HasPrefix(segment.payload(), iccProfileHeader)
+	case segment.marker >= jpegMarkerAPP0 && segment.marker <= jpegMarkerAPP15, segment.marker == jpegMarkerCOM:
+		return false
+	default:
+		return true
+	}
+}
+
+// applyOrientation returns the image rotated and/or flipped such that it displays as intended,
+// according to the specified EXIF orientation
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation <= exifOrientationNormal || orientation > exifOrientationRotate270 {
+		return src
+	}
+
+	// Work with RGBA pixels, so that they can be moved around directly
+	bounds := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || bounds.Min != image.Pt(0, 0) {
+		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	}
+
+	w, h := bounds.Dx(), bounds.Dy()
+	dstW, dstH := w, h
+	if orientation >= exifOrientationTranspose {
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := range dstH {
+		for x := range dstW {
+			var srcX, srcY int
+			switch orientation {
+			case exifOrientationFlipH:
+				srcX, srcY = w-1-x, y
+			case exifOrientationRotate180:
+				srcX, srcY = w-1-x, h-1-y
+			case exifOrientationFlipV:
+				srcX, srcY = x, h-1-y
+			case exifOrientationTranspose:
+				srcX, srcY = y, x
+			case exifOrientationRotate90:
+				srcX, srcY = y, h-1-x
+			case exifOrientationTransverse:
+				srcX, srcY = w-1-y, h-1-x
+			case exifOrientationRotate270:
+				srcX, srcY = w-1-y, x
+			}
+			srcOffset := rgba.PixOffset(srcX, srcY)
+			copy(dst.Pix[dst.PixOffset(x, y):], rgba.Pix[srcOffset:srcOffset+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,192 @@
+package fileaccess
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+const testSecretMake = "SecretPhone"
+
+// addTestJPEGMetadata returns the JPEG with EXIF metadata recording the orientation, along with other
+// metadata that is expected to be stripped, inserted after the start of image marker
+func addTestJPEGMetadata(t *testing.T, data []byte, orientation int, order binary.ByteOrder) []byte {
+	t.Helper()
+
+	// A TIFF structure with the make of the camera and the orientation
+	tiff := make([]byte, 8+2+2*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+	order.PutUint16(tiff[10:], 0x010f) // Make
+	order.PutUint16(tiff[12:], 2)      // ASCII
+	order.PutUint32(tiff[14:], uint32(len(testSecretMake)+1))
+	order.PutUint32(tiff[18:], uint32(len(tiff)))
+	order.PutUint16(tiff[22:], exifTagOrientation)
+	order.PutUint16(tiff[24:], 3) // SHORT
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint16(tiff[30:], uint16(orientation))
+	tiff = append(tiff, testSecretMake+"\x00"...)
+
+	var metadata []byte
+	metadata = append(metadata, newTestJPEGSegment(jpegMarkerAPP0, []byte("JFIF\x00\x01\x02\x00\x00\x01\x00\x01\x00\x00"))...)
+	metadata = append(metadata, newTestJPEGSegment(jpegMarkerAPP1, append(bytes.Clone(exifHeader), tiff...))...)
+	metadata = append(metadata, newTestJPEGSegment(jpegMarkerAPP2, []byte("MPF\x00multi-picture"))...)
+	metadata = append(metadata, newTestJPEGSegment(jpegMarkerAPP2, append(bytes.Clone(iccProfileHeader), "profile"...))...)
+	metadata = append(metadata, newTestJPEGSegment(jpegMarkerCOM, []byte("secret comment"))...)
+
+	result := append(bytes.Clone(data[:2]), metadata...)
+	result = append(result, data[2:]...)
+	return append(result, "trailing secret"...)
+}
+
+func newTestJPEGSegment(marker byte, payload []byte) []byte {
+	length := len(payload) + 2
+	return append([]byte{0xff, marker, byte(length >> 8), byte(length)}, payload...)
+}
+
+func Test_readJPEGOrientation(t *testing.T) {
+	type testArgs struct {
+		caseName string
+		data     []byte
+		expected int
+	}
+
+	// Arrange
+	jpegData := encodeTestImage(t, image.NewRGBA(image.Rect(0, 0, 10, 10)), ".jpeg")
+	tests := []testArgs{
+		{"No Metadata", jpegData, exifOrientationNormal},
+		{"Little Endian", addTestJPEGMetadata(t, jpegData, exifOrientationRotate90, binary.LittleEndian), exifOrientationRotate90},
+		{"Big Endian", addTestJPEGMetadata(t, jpegData, exifOrientationRotate180, binary.BigEndian), exifOrientationRotate180},
+		{"Invalid Orientation", addTestJPEGMetadata(t, jpegData, 9, binary.BigEndian), exifOrientationNormal},
+		{"Minimal Metadata", append(append(bytes.Clone(jpegData[:2]), newEXIFSegment(exifOrientationFlipV)...), jpegData[2:]...), exifOrientationFlipV},
+		{"Truncated", addTestJPEGMetadata(t, jpegData, exifOrientationRotate90, binary.BigEndian)[:40], exifOrientationNormal},
+		{"Not JPEG", encodeTestImage(t, image.NewRGBA(image.Rect(0, 0, 10, 10)), ".png"), exifOrientationNormal},
+	}
+	for _, test := range tests {
+		t.Run(test.caseName, func(t *testing.T) {
+			// Act
+			actual := readJPEGOrientation(test.data)
+
+			// Assert
+			if actual != test.expected {
+				t.Errorf("expected orientation: %d, received: %d", test.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_stripJPEGMetadata(t *testing.T) {
+	type testArgs struct {
+		caseName    string
+		orientation int
+	}
+
+	// Arrange
+	jpegData := encodeTestImage(t, image.NewRGBA(image.Rect(0, 0, 30, 20)), ".jpeg")
+	tests := []testArgs{
+		{"Normal", exifOrientationNormal},
+		{"Rotated", exifOrientationRotate270},
+	}
+	for _, test := range tests {
+		t.Run(test.caseName, func(t *testing.T) {
+			data := addTestJPEGMetadata(t, jpegData, test.orientation, binary.LittleEndian)
+
+			// Act
+			stripped, err := stripJPEGMetadata(data, readJPEGOrientation(data))
+
+			// Assert
+			if err != nil {
+				t.Fatalf("failed to strip metadata: %v", err)
+			}
+			for _, secret := range []string{testSecretMake, "secret comment", "multi-picture", "trailing secret"} {
+				if bytes.Contains(stripped, []byte(secret)) {
+					t.Errorf("expected %q to be stripped", secret)
+				}
+			}
+			for _, kept := range []string{"JFIF", "ICC_PROFILE"} {
+				if !bytes.Contains(stripped, []byte(kept)) {
+					t.Errorf("expected %q to be kept", kept)
+				}
+			}
+			if actual := readJPEGOrientation(stripped); actual != test.orientation {
+				t.Errorf("expected orientation: %d, received: %d", test.orientation, actual)
+			}
+			if !bytes.Contains(stripped, jpegData[2:]) {
+				t.Error("expected the image data to be kept as-is")
+			}
+			if _, _, err := image.Decode(bytes.NewReader(stripped)); err != nil {
+				t.Errorf("failed to decode stripped image: %v", err)
+			}
+		})
+	}
+}
+
+func Test_stripJPEGMetadata_Malformed(t *testing.T) {
+	// Arrange
+	jpegData := encodeTestImage(t, image.NewRGBA(image.Rect(0, 0, 30, 20)), ".jpeg")
+
+	// Act
+	_, err := stripJPEGMetadata(jpegData[:len(jpegData)-2], exifOrientationNormal)
+
+	// Assert
+	if err != errMalformedJPEG {
+		t.Errorf("expected error: %v, received: %v", errMalformedJPEG, err)
+	}
+}
+
+func Test_applyOrientation(t *testing.T) {
+	type testArgs struct {
+		caseName    string
+		orientation int
+		expected    [][]uint8
+	}
+
+	// Arrange
+	// Each pixel of the source is numbered, left to right and then top to bottom
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for y := range 2 {
+		for x := range 3 {
+			src.Set(x, y, color.RGBA{R: uint8(y*3 + x), A: 255})
+		}
+	}
+	tests := []testArgs{
+		{"Normal", exifOrientationNormal, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{"Flip Horizontal", exifOrientationFlipH, [][]uint8{{2, 1, 0}, {5, 4, 3}}},
+		{"Rotate 180", exifOrientationRotate180, [][]uint8{{5, 4, 3}, {2, 1, 0}}},
+		{"Flip Vertical", exifOrientationFlipV, [][]uint8{{3, 4, 5}, {0, 1, 2}}},
+		{"Transpose", exifOrientationTranspose, [][]uint8{{0, 3}, {1, 4}, {2, 5}}},
+		{"Rotate 90", exifOrientationRotate90, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{"Transverse", exifOrientationTransverse, [][]uint8{{5, 2}, {4, 1}, {3, 0}}},
+		{"Rotate 270", exifOrientationRotate270, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+		{"Invalid", 0, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+	}
+	for _, test := range tests {
+		t.Run(test.caseName, func(t *testing.T) {
+			// Act
+			dst := applyOrientation(src, test.orientation)
+
+			// Assert
+			bounds := dst.Bounds()
+			actual := make([][]uint8, bounds.Dy())
+			for y := range actual {
+				actual[y] = make([]uint8, bounds.Dx())
+				for x := range actual[y] {
+					r, _, _, _ := dst.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+					actual[y][x] = uint8(r >> 8)
+				}
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected pixels: %v, received: %v", test.expected, actual)
+			}
+		})
+	}
+}
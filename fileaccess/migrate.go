@@ -0,0 +1,202 @@
+package fileaccess
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+)
+
+// MigrationStatus represents the outcome of migrating a single file
+type MigrationStatus string
+
+const (
+	// MigrationCopied means the file was copied to the destination, or would be in a dry run
+	MigrationCopied MigrationStatus = "copied"
+
+	// MigrationSkipped means the file was already at the destination with the same checksum,
+	// e.g., from a previous migration that was interrupted
+	MigrationSkipped MigrationStatus = "skipped"
+
+	// MigrationFailed means the file could not be copied, or the copy didn't match the checksum of the original
+	MigrationFailed MigrationStatus = "failed"
+)
+
+// MigratedFile describes the migration of a single file
+type MigratedFile struct {
+	// Path is the path of the file, which is the same in the source and destination
+	Path string
+
+	// Size is the size of the file in bytes
+	Size int64
+
+	// Checksum is the hex encoded SHA-256 checksum of the content of the file, if it was read
+	Checksum string
+
+	// Status is the outcome of migrating the file
+	Status MigrationStatus
+
+	// Err is why the file failed to migrate, if it did
+	Err error
+}
+
+// MigrationReport summarizes the migration of all files
+type MigrationReport struct {
+	// DryRun is whether the report is of what would be migrated, rather than of what was
+	DryRun bool
+
+	// Files are the files that were migrated, in the order they were migrated
+	Files []MigratedFile
+}
+
+// Count returns the number of files with the specified status
+func (r *MigrationReport) Count(status MigrationStatus) int {
+	count := 0
+	for _, file := range r.Files {
+		if file.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Size returns the total size in bytes of the files with the specified status
+func (r *MigrationReport) Size(status MigrationStatus) int64 {
+	var size int64
+	for _, file := range r.Files {
+		if file.Status == status {
+			size += file.Size
+		}
+	}
+	return size
+}
+
+// MigrateOptions represents the options for migrating files between drivers
+type MigrateOptions struct {
+	// DryRun reports what would be migrated without copying anything
+	DryRun bool
+
+	// Progress, if set, is called after each file is migrated
+	Progress func(MigratedFile)
+}
+
+// Migrate copies all uploads and backups from one driver to another, verifying the checksum of each copy.
+// Files that are already at the destination with the same checksum are skipped, so an interrupted
+// migration can be resumed by running it again. Files that fail to migrate are included in the report,
+// rather than stopping the migration; an error is only returned if the files to migrate can't be listed.
+func Migrate(ctx context.Context, src, dst Driver, opts MigrateOptions) (*MigrationReport, error) {
+	report := &MigrationReport{DryRun: opts.DryRun, Files: make([]MigratedFile, 0)}
+
+	for _, root := range []string{UploadDirectoryName, BackupDirectoryName} {
+		err := fs.WalkDir(src, root, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				// Nothing to migrate if there aren't any files of this kind yet
+				if filePath == root && errors.Is(err, fs.ErrNotExist) {
+					return fs.SkipDir
+				}
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+
+			file := MigratedFile{Path: filePath}
+			if info, err := entry.Info(); err == nil {
+				file.Size = info.Size()
+			}
+			file.Checksum, file.Status, file.Err = migrateFile(src, dst, filePath, file.Size, opts.DryRun)
+			if file.Err != nil {
+				slog.Warn("Failed to migrate file", "error", file.Err, "path", filePath)
+			}
+
+			report.Files = append(report.Files, file)
+			if opts.Progress != nil {
+				opts.Progress(file)
+			}
+			return nil
+		})
+		if err != nil {
+			return report, fmt.Errorf("listing files in %s: %w", root, err)
+		}
+	}
+
+	return report, nil
+}
+
+func migrateFile(src, dst Driver, filePath string, size int64, dryRun bool) (string, MigrationStatus, error) {
+	// Skip anything that was already migrated, e.g., before being interrupted
+	var srcChecksum string
+	if info, err := dst.Stat(filePath); err == nil && !info.IsDir() && info.Size() == size {
+		var err error
+		srcChecksum, err = checksum(src, filePath)
+		if err != nil {
+			return "", MigrationFailed, fmt.Errorf("reading source: %w", err)
+		}
+		dstChecksum, err := checksum(dst, filePath)
+		if err != nil {
+			return srcChecksum, MigrationFailed, fmt.Errorf("reading destination: %w", err)
+		}
+		if srcChecksum == dstChecksum {
+			return srcChecksum, MigrationSkipped, nil
+		}
+	}
+
+	if dryRun {
+		if srcChecksum == "" {
+			var err error
+			srcChecksum, err = checksum(src, filePath)
+			if err != nil {
+				return "", MigrationFailed, fmt.Errorf("reading source: %w", err)
+			}
+		}
+		return srcChecksum, MigrationCopied, nil
+	}
+
+	// Calculate the checksum of the source as it's copied, so it's only read once
+	file, err := src.Open(filePath)
+	if err != nil {
+		return "", MigrationFailed, fmt.Errorf("reading source: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if err := dst.Save(filePath, io.TeeReader(file, hash)); err != nil {
+		return "", MigrationFailed, fmt.Errorf("writing destination: %w", err)
+	}
+	srcChecksum = hex.EncodeToString(hash.Sum(nil))
+
+	dstChecksum, err := checksum(dst, filePath)
+	if err != nil {
+		return srcChecksum, MigrationFailed, fmt.Errorf("verifying destination: %w", err)
+	}
+	if srcChecksum != dstChecksum {
+		// Don't leave a bad copy behind
+		if err := dst.Delete(filePath); err != nil {
+			slog.Warn("Failed to delete mismatched copy", "error", err, "path", filePath)
+		}
+		return srcChecksum, MigrationFailed, fmt.Errorf("checksum mismatch: expected %s, copied %s", srcChecksum, dstChecksum)
+	}
+
+	return srcChecksum, MigrationCopied, nil
+}
+
+// checksum returns the hex encoded SHA-256 checksum of the content of the file
+func checksum(driver Driver, filePath string) (string, error) {
+	file, err := driver.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
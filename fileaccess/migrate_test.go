@@ -0,0 +1,254 @@
+package fileaccess
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// corruptingDriver is a Driver that saves something other than what it's given
+type corruptingDriver struct {
+	Driver
+}
+
+func (d corruptingDriver) Save(filePath string, reader io.Reader) error {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return d.Driver.Save(filePath, bytes.NewReader(append(content, '!')))
+}
+
+func newTestFileSystemDriver(t *testing.T, files map[string]string) Driver {
+	drv, err := newFileSystemDriver(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for filePath, content := range files {
+		if err := drv.Save(filePath, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return drv
+}
+
+func readTestFile(t *testing.T, drv Driver, filePath string) string {
+	content, err := fs.ReadFile(drv, filePath)
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+func TestMigrate(t *testing.T) {
+	srcFiles := map[string]string{
+		"uploads/recipes/1/images/a.jpeg": "image a",
+		"uploads/recipes/1/thumbs/a.jpeg": "thumb a",
+		"uploads/recipes/2/images/b.jpeg": "image b",
+		"backups/gomp-backup.zip":         "backup",
+		"other/ignored.txt":               "ignored",
+	}
+
+	type testArgs struct {
+		name             string
+		dstFiles         map[string]string
+		dryRun           bool
+		corrupt          bool
+		expectedStatuses map[string]MigrationStatus
+		expectedDst      map[string]string
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			name: "Copies everything",
+			expectedStatuses: map[string]MigrationStatus{
+				"uploads/recipes/1/images/a.jpeg": MigrationCopied,
+				"uploads/recipes/1/thumbs/a.jpeg": MigrationCopied,
+				"uploads/recipes/2/images/b.jpeg": MigrationCopied,
+				"backups/gomp-backup.zip":         MigrationCopied,
+			},
+			expectedDst: map[string]string{
+				"uploads/recipes/1/images/a.jpeg": "image a",
+				"uploads/recipes/2/images/b.jpeg": "image b",
+				"backups/gomp-backup.zip":         "backup",
+				"other/ignored.txt":               "",
+			},
+		},
+		{
+			name: "Resumes",
+			dstFiles: map[string]string{
+				"uploads/recipes/1/images/a.jpeg": "image a",
+				"uploads/recipes/1/thumbs/a.jpeg": "thumb ?",
+				"uploads/recipes/2/images/b.jpeg": "image",
+			},
+			expectedStatuses: map[string]MigrationStatus{
+				"uploads/recipes/1/images/a.jpeg": MigrationSkipped,
+				"uploads/recipes/1/thumbs/a.jpeg": MigrationCopied,
+				"uploads/recipes/2/images/b.jpeg": MigrationCopied,
+				"backups/gomp-backup.zip":         MigrationCopied,
+			},
+			expectedDst: map[string]string{
+				"uploads/recipes/1/thumbs/a.jpeg": "thumb a",
+				"uploads/recipes/2/images/b.jpeg": "image b",
+			},
+		},
+		{
+			name:     "Dry run",
+			dryRun:   true,
+			dstFiles: map[string]string{"uploads/recipes/1/images/a.jpeg": "image a"},
+			expectedStatuses: map[string]MigrationStatus{
+				"uploads/recipes/1/images/a.jpeg": MigrationSkipped,
+				"uploads/recipes/1/thumbs/a.jpeg": MigrationCopied,
+				"uploads/recipes/2/images/b.jpeg": MigrationCopied,
+				"backups/gomp-backup.zip":         MigrationCopied,
+			},
+			expectedDst: map[string]string{
+				"uploads/recipes/1/thumbs/a.jpeg": "",
+				"backups/gomp-backup.zip":         "",
+			},
+		},
+		{
+			name:    "Checksum mismatch",
+			corrupt: true,
+			expectedStatuses: map[string]MigrationStatus{
+				"uploads/recipes/1/images/a.jpeg": MigrationFailed,
+				"uploads/recipes/1/thumbs/a.jpeg": MigrationFailed,
+				"uploads/recipes/2/images/b.jpeg": MigrationFailed,
+				"backups/gomp-backup.zip":         MigrationFailed,
+			},
+			expectedDst: map[string]string{
+				"uploads/recipes/1/images/a.jpeg": "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := newTestFileSystemDriver(t, srcFiles)
+			dst := newTestFileSystemDriver(t, test.dstFiles)
+			var target Driver = dst
+			if test.corrupt {
+				target = corruptingDriver{dst}
+			}
+			progress := 0
+
+			// Act
+			report, err := Migrate(t.Context(), src, target, MigrateOptions{
+				DryRun:   test.dryRun,
+				Progress: func(MigratedFile) { progress++ },
+			})
+
+			// Assert
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if report.DryRun != test.dryRun {
+				t.Errorf("expected dry run: %v, received dry run: %v", test.dryRun, report.DryRun)
+			}
+			if len(report.Files) != len(test.expectedStatuses) || progress != len(report.Files) {
+				t.Errorf("expected %d files, received %d files and %d progress updates", len(test.expectedStatuses), len(report.Files), progress)
+			}
+			for _, file := range report.Files {
+				if expected := test.expectedStatuses[filepath.ToSlash(file.Path)]; file.Status != expected {
+					t.Errorf("%s: expected status: %s, received status: %s (%v)", file.Path, expected, file.Status, file.Err)
+				}
+				if (file.Status == MigrationFailed) != (file.Err != nil) {
+					t.Errorf("%s: unexpected error: %v", file.Path, file.Err)
+				}
+				if file.Status != MigrationFailed && (len(file.Checksum) != 64 || file.Size == 0) {
+					t.Errorf("%s: unexpected checksum %q and size %d", file.Path, file.Checksum, file.Size)
+				}
+			}
+			for filePath, expected := range test.expectedDst {
+				if actual := readTestFile(t, dst, filePath); actual != expected {
+					t.Errorf("%s: expected content: %q, received content: %q", filePath, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrate_NothingToMigrate(t *testing.T) {
+	// Arrange
+	src := newTestFileSystemDriver(t, nil)
+	dst := newTestFileSystemDriver(t, nil)
+
+	// Act
+	report, err := Migrate(t.Context(), src, dst, MigrateOptions{})
+
+	// Assert
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(report.Files) != 0 {
+		t.Errorf("expected no files, received %v", report.Files)
+	}
+}
+
+func TestMigrate_Canceled(t *testing.T) {
+	// Arrange
+	src := newTestFileSystemDriver(t, map[string]string{"uploads/a.jpeg": "a"})
+	dst := newTestFileSystemDriver(t, nil)
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	// Act
+	_, err := Migrate(ctx, src, dst, MigrateOptions{})
+
+	// Assert
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error: %v, received error: %v", context.Canceled, err)
+	}
+}
+
+func TestMigrationReport(t *testing.T) {
+	// Arrange
+	report := MigrationReport{Files: []MigratedFile{
+		{Path: "a", Size: 1, Status: MigrationCopied},
+		{Path: "b", Size: 2, Status: MigrationCopied},
+		{Path: "c", Size: 4, Status: MigrationSkipped},
+	}}
+
+	// Assert
+	if report.Count(MigrationCopied) != 2 || report.Size(MigrationCopied) != 3 {
+		t.Errorf("unexpected copied: %d files, %d bytes", report.Count(MigrationCopied), report.Size(MigrationCopied))
+	}
+	if report.Count(MigrationFailed) != 0 || report.Size(MigrationSkipped) != 4 {
+		t.Errorf("unexpected failed: %d files, skipped %d bytes", report.Count(MigrationFailed), report.Size(MigrationSkipped))
+	}
+}
+
+func TestMigrate_BetweenDrivers(t *testing.T) {
+	// Arrange
+	src := newTestFileSystemDriver(t, map[string]string{
+		"uploads/recipes/1/images/a.jpeg": "image a",
+		"backups/gomp-backup.zip":         "backup",
+	})
+	fake, srv := newFakeS3(t, nil)
+	dst := newTestS3Driver(t, srv, "", false)
+
+	// Act
+	report, err := Migrate(t.Context(), src, dst, MigrateOptions{})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Count(MigrationCopied) != 2 {
+		t.Errorf("expected 2 files copied, received %v", report.Files)
+	}
+	if string(fake.objects["uploads/recipes/1/images/a.jpeg"]) != "image a" || string(fake.objects["backups/gomp-backup.zip"]) != "backup" {
+		t.Errorf("unexpected objects: %v", fake.objects)
+	}
+
+	// Running again skips everything, in the other direction too
+	report, err = Migrate(t.Context(), dst, src, MigrateOptions{})
+	if err != nil || report.Count(MigrationSkipped) != 2 {
+		t.Errorf("expected 2 files skipped, received %v, %v", report.Files, err)
+	}
+}
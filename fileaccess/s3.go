@@ -0,0 +1,732 @@
+package fileaccess
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The longest that S3 allows presigned URLs to be valid for
+const maxPresignedURLExpiry = 7 * 24 * 60 * 60
+
+// The most objects that can be deleted in a single request to S3
+const maxDeleteObjects = 1000
+
+// URLSigner is implemented by drivers that can grant temporary, direct access to their files,
+// so that the files can be served without passing through the application.
+type URLSigner interface {
+	// SignURL returns a URL that grants read access to the file at the specified path until it expires.
+	SignURL(filePath string) (string, error)
+}
+
+// s3Driver is an implementation of Driver that uses an S3-compatible object store.
+// Directories are emulated using the slashes in the keys of the objects, so they
+// exist exactly as long as they contain files.
+type s3Driver struct {
+	client   *http.Client
+	signer   sigV4Signer
+	endpoint url.URL
+	bucket   string
+	prefix   string
+
+	// pathStyle is whether the bucket is part of the path of each URL, rather than the host
+	pathStyle bool
+
+	// now returns the current time, which is included in the signature of each request
+	now func() time.Time
+}
+
+// presigningS3Driver is an s3Driver that redirects requests for files to presigned URLs
+type presigningS3Driver struct {
+	*s3Driver
+
+	expiry time.Duration
+}
+
+func newS3Driver(cfg S3Config, client *http.Client) (Driver, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	drv := &s3Driver{
+		client: client,
+		signer: sigV4Signer{
+			accessKeyID:     cfg.AccessKeyID,
+			secretAccessKey: cfg.SecretAccessKey,
+			region:          cfg.Region,
+		},
+		endpoint:  cfg.Endpoint,
+		bucket:    cfg.Bucket,
+		prefix:    prefix,
+		pathStyle: cfg.PathStyle,
+		now:       time.Now,
+	}
+	if cfg.PresignedURLs {
+		return &presigningS3Driver{drv, time.Duration(cfg.PresignedURLExpiry) * time.Second}, nil
+	}
+	return drv, nil
+}
+
+func (d *s3Driver) Open(name string) (fs.File, error) {
+	// Unlike the other methods, Open is held to the stricter requirements of fs.FS
+	name = filepath.ToSlash(name)
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &s3Dir{driver: d, name: name, info: s3FileInfo{name: name, isDir: true}}, nil
+	}
+
+	key := d.prefix + name
+
+	resp, err := d.getObject(key, 0)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// It may be a directory instead
+			if info, dirErr := d.statDir(name); dirErr == nil {
+				return &s3Dir{driver: d, name: name, info: info}, nil
+			}
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &s3File{
+		driver: d,
+		key:    key,
+		info:   objectInfo(path.Base(name), resp),
+		body:   resp.Body,
+	}, nil
+}
+
+func (d *s3Driver) Create(filePath string) (io.WriteCloser, error) {
+	key, err := d.key("create", filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// S3 needs the length of the content up front, so buffer it in a temporary file
+	tmp, err := os.CreateTemp("", "gomp-s3-*")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Writer{driver: d, key: key, tmp: tmp, hash: sha256.New()}, nil
+}
+
+func (d *s3Driver) Save(filePath string, reader io.Reader) (err error) {
+	// Make sure we're at the beginning of the content
+	if seeker, ok := reader.(io.Seeker); ok {
+		_, err := seeker.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := d.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, reader); err != nil {
+		file.(*s3Writer).abort()
+		return err
+	}
+	return file.Close()
+}
+
+func (d *s3Driver) Delete(filePath string) error {
+	key, err := d.key("remove", filePath)
+	if err != nil {
+		return err
+	}
+
+	// S3 doesn't report deleting a file that doesn't exist as an error, but callers expect it to be
+	resp, err := d.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: filePath, Err: err}
+	}
+	resp.Body.Close()
+
+	resp, err = d.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: filePath, Err: err}
+	}
+	return resp.Body.Close()
+}
+
+func (d *s3Driver) DeleteAll(dirPath string) error {
+	prefix, err := d.dirPrefix("removeall", dirPath)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0)
+	err = d.listObjects(prefix, "", func(result *listBucketResult) {
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+	})
+	if err != nil {
+		return &fs.PathError{Op: "removeall", Path: dirPath, Err: err}
+	}
+
+	for batch := range slices.Chunk(keys, maxDeleteObjects) {
+		if err := d.deleteObjects(batch); err != nil {
+			return &fs.PathError{Op: "removeall", Path: dirPath, Err: err}
+		}
+	}
+	return nil
+}
+
+func (d *s3Driver) Stat(name string) (fs.FileInfo, error) {
+	key, err := d.key("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// It may be a directory instead
+			if info, dirErr := d.statDir(name); dirErr == nil {
+				return info, nil
+			}
+		}
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	resp.Body.Close()
+
+	return objectInfo(path.Base(name), resp), nil
+}
+
+func (d *s3Driver) List(dirPath string) ([]fs.DirEntry, error) {
+	entries, err := d.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter out directories, only return files
+	return slices.DeleteFunc(entries, func(entry fs.DirEntry) bool {
+		return entry.IsDir()
+	}), nil
+}
+
+// ReadDir implements fs.ReadDirFS, so that fs.WalkDir and the like don't need to open each directory
+func (d *s3Driver) ReadDir(name string) ([]fs.DirEntry, error) {
+	prefix, err := d.dirPrefix("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, 0)
+	err = d.listObjects(prefix, "/", func(result *listBucketResult) {
+		for _, object := range result.Contents {
+			entries = append(entries, s3FileInfo{
+				name:    strings.TrimPrefix(object.Key, prefix),
+				size:    object.Size,
+				modTime: object.LastModified,
+			})
+		}
+		for _, common := range result.CommonPrefixes {
+			entries = append(entries, s3FileInfo{
+				name:  strings.TrimSuffix(strings.TrimPrefix(common.Prefix, prefix), "/"),
+				isDir: true,
+			})
+		}
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if len(entries) == 0 && prefix != d.prefix {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+func (d *presigningS3Driver) SignURL(filePath string) (string, error) {
+	key, err := d.key("sign", filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return d.signer.presign(http.MethodGet, d.objectURL(key, nil), d.expiry, d.now()).String(), nil
+}
+
+// key returns the key of the object for the specified file
+func (d *s3Driver) key(op string, name string) (string, error) {
+	name = path.Clean(filepath.ToSlash(name))
+	if !fs.ValidPath(name) || name == "." {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return d.prefix + name, nil
+}
+
+// dirPrefix returns the prefix of the keys of all the objects in the specified directory
+func (d *s3Driver) dirPrefix(op string, name string) (string, error) {
+	name = path.Clean(filepath.ToSlash(name))
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return d.prefix, nil
+	}
+	return d.prefix + name + "/", nil
+}
+
+// statDir returns the info of the specified directory, if it contains any files
+func (d *s3Driver) statDir(name string) (fs.FileInfo, error) {
+	prefix, err := d.dirPrefix("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == d.prefix {
+		return s3FileInfo{name: ".", isDir: true}, nil
+	}
+
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "max-keys": {"1"}}
+	resp, err := d.do(http.MethodGet, "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result listBucketResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Contents) == 0 {
+		return nil, fs.ErrNotExist
+	}
+	return s3FileInfo{name: path.Base(name), isDir: true}, nil
+}
+
+// getObject gets the object with the specified key, starting from the specified offset
+func (d *s3Driver) getObject(key string, offset int64) (*http.Response, error) {
+	headers := http.Header{}
+	if offset > 0 {
+		headers.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	return d.do(http.MethodGet, key, nil, headers, nil)
+}
+
+// listObjects calls handle with each page of the objects whose keys start with the prefix
+func (d *s3Driver) listObjects(prefix string, delimiter string, handle func(*listBucketResult)) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := d.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading list of objects: %w", err)
+		}
+
+		handle(&result)
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// deleteObjects deletes the objects with the specified keys in a single request
+func (d *s3Driver) deleteObjects(keys []string) error {
+	request := deleteRequest{Quiet: true}
+	for _, key := range keys {
+		request.Objects = append(request.Objects, deleteObject{Key: key})
+	}
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	// S3 requires a checksum of the content of delete requests
+	sum := md5.Sum(body) // #nosec G401 -- required by the S3 API, not used for security
+	headers := http.Header{}
+	headers.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	headers.Set("Content-Type", "application/xml")
+
+	resp, err := d.do(http.MethodPost, "", url.Values{"delete": {""}}, headers, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result deleteResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("reading result of deleting objects: %w", err)
+	}
+	errs := make([]error, 0)
+	for _, failed := range result.Errors {
+		errs = append(errs, fmt.Errorf("deleting %s: %s: %s", failed.Key, failed.Code, failed.Message))
+	}
+	return errors.Join(errs...)
+}
+
+// objectURL returns the URL of the object with the specified key, or of the bucket if the key is empty
+func (d *s3Driver) objectURL(key string, query url.Values) *url.URL {
+	u := d.endpoint
+	objectPath := "/" + key
+	if d.pathStyle {
+		objectPath = "/" + d.bucket + objectPath
+	} else {
+		u.Host = d.bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + objectPath
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQueryString(query)
+	return &u
+}
+
+// do sends a signed request for the object with the specified key, or the bucket if the key is empty.
+// Error responses are returned as errors, with those for missing objects matching fs.ErrNotExist.
+func (d *s3Driver) do(method string, key string, query url.Values, headers http.Header, body io.ReadSeeker) (*http.Response, error) {
+	payloadHash := emptyPayloadHash
+	var contentLength int64
+	if body != nil {
+		h := sha256.New()
+		n, err := io.Copy(h, body)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		payloadHash = hex.EncodeToString(h.Sum(nil))
+		contentLength = n
+	}
+	return d.doWithHash(method, key, query, headers, body, contentLength, payloadHash)
+}
+
+func (d *s3Driver) doWithHash(method string, key string, query url.Values, headers http.Header, body io.Reader, contentLength int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequest(method, d.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = contentLength
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	d.signer.sign(req, payloadHash, d.now())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	return nil, responseError(resp)
+}
+
+// responseError returns the error described by an error response from S3
+func responseError(resp *http.Response) error {
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&s3Err)
+
+	var err error
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		err = fs.ErrNotExist
+	case resp.StatusCode == http.StatusForbidden:
+		err = fs.ErrPermission
+	case s3Err.Code != "":
+		err = fmt.Errorf("%s: %s", s3Err.Code, s3Err.Message)
+	default:
+		err = errors.New(resp.Status)
+	}
+	if s3Err.Code != "" && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		err = fmt.Errorf("%w: %s", err, s3Err.Code)
+	}
+	return err
+}
+
+// objectInfo returns the info of an object from the headers of a response for it
+func objectInfo(name string, resp *http.Response) s3FileInfo {
+	info := s3FileInfo{name: name, size: resp.ContentLength}
+	// The full size of a partial response is at the end of the content range, e.g., "bytes 100-199/200"
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		if _, total, ok := strings.Cut(contentRange, "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				info.size = size
+			}
+		}
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.modTime = modTime
+	}
+	return info
+}
+
+// s3File is a file read from S3. The content is streamed, re-requesting it from the new offset after seeking.
+type s3File struct {
+	driver *s3Driver
+	key    string
+	info   s3FileInfo
+	body   io.ReadCloser
+	offset int64
+}
+
+func (f *s3File) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *s3File) Read(p []byte) (int, error) {
+	if f.offset >= f.info.size {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		resp, err := f.driver.getObject(f.key, f.offset)
+		if err != nil {
+			return 0, err
+		}
+		f.body = resp.Body
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, fs.ErrInvalid
+	}
+
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *s3File) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.info.size {
+		return 0, io.EOF
+	}
+
+	headers := http.Header{}
+	headers.Set("Range", "bytes="+strconv.FormatInt(off, 10)+"-"+strconv.FormatInt(off+int64(len(p))-1, 10))
+	resp, err := f.driver.do(http.MethodGet, f.key, nil, headers, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err := io.ReadFull(resp.Body, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *s3File) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	return f.body.Close()
+}
+
+// s3Dir is a directory emulated from the keys of the objects in S3
+type s3Dir struct {
+	driver *s3Driver
+	name   string
+	info   fs.FileInfo
+
+	// entries are the entries that haven't been read yet, or nil if they haven't been listed yet
+	entries []fs.DirEntry
+}
+
+func (d *s3Dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *s3Dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+func (d *s3Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		entries, err := d.driver.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = d.entries[len(d.entries):]
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+func (*s3Dir) Close() error {
+	return nil
+}
+
+// s3Writer buffers the content of a file to a temporary file, and uploads it to S3 when closed
+type s3Writer struct {
+	driver *s3Driver
+	key    string
+	tmp    *os.File
+	hash   hash.Hash
+	size   int64
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	n, err := w.tmp.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *s3Writer) Close() error {
+	defer w.abort()
+
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	headers := http.Header{}
+	if contentType := mime.TypeByExtension(path.Ext(w.key)); contentType != "" {
+		headers.Set("Content-Type", contentType)
+	}
+	resp, err := w.driver.doWithHash(http.MethodPut, w.key, nil, headers, w.tmp, w.size, hex.EncodeToString(w.hash.Sum(nil)))
+	if err != nil {
+		return &fs.PathError{Op: "write", Path: w.key, Err: err}
+	}
+	return resp.Body.Close()
+}
+
+// abort discards the buffered content without uploading it
+func (w *s3Writer) abort() {
+	if err := w.tmp.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		slog.Warn("Failed to close temporary file", "error", err, "file", w.tmp.Name())
+	}
+	if err := os.Remove(w.tmp.Name()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Failed to remove temporary file", "error", err, "file", w.tmp.Name())
+	}
+}
+
+// s3FileInfo describes an object, or a directory emulated from the keys of the objects
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (i s3FileInfo) Name() string       { return i.name }
+func (i s3FileInfo) Size() int64        { return i.size }
+func (i s3FileInfo) ModTime() time.Time { return i.modTime }
+func (i s3FileInfo) IsDir() bool        { return i.isDir }
+func (i s3FileInfo) Sys() any           { return nil }
+
+func (i s3FileInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0750
+	}
+	return 0640
+}
+
+func (i s3FileInfo) Type() fs.FileMode {
+	return i.Mode().Type()
+}
+
+func (i s3FileInfo) Info() (fs.FileInfo, error) {
+	return i, nil
+}
+
+// listBucketResult is the response to a ListObjectsV2 request
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// deleteRequest is the body of a DeleteObjects request
+type deleteRequest struct {
+	XMLName xml.Name       `xml:"Delete"`
+	Quiet   bool           `xml:"Quiet"`
+	Objects []deleteObject `xml:"Object"`
+}
+
+type deleteObject struct {
+	Key string `xml:"Key"`
+}
+
+// deleteResult is the response to a DeleteObjects request
+type deleteResult struct {
+	Errors []struct {
+		Key     string `xml:"Key"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
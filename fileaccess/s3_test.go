@@ -0,0 +1,460 @@
+package fileaccess
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeS3 is an in-memory stand-in for an S3-compatible object store, e.g., MinIO,
+// that supports just enough of the API for the s3Driver
+type fakeS3 struct {
+	bucket  string
+	maxKeys int
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T, files map[string]string) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{bucket: "gomp", maxKeys: 2, objects: map[string][]byte{}}
+	for key, content := range files {
+		f.objects[key] = []byte(content)
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), sigV4Algorithm+" Credential=key/") {
+		writeFakeS3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		writeFakeS3Error(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		writeFakeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	query := r.URL.Query()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, query)
+	case key == "" && r.Method == http.MethodPost && query.Has("delete"):
+		var request deleteRequest
+		if err := xml.Unmarshal(body, &request); err != nil || r.Header.Get("Content-MD5") == "" {
+			writeFakeS3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		for _, object := range request.Objects {
+			delete(f.objects, object.Key)
+		}
+		fmt.Fprint(w, "<DeleteResult></DeleteResult>")
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		content, ok := f.objects[key]
+		if !ok {
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Last-Modified", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Format(http.TimeFormat))
+		http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(content))
+	default:
+		writeFakeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	maxKeys := f.maxKeys
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, _ = strconv.Atoi(value)
+	}
+
+	// Build the sorted list of keys and common prefixes, as S3 does
+	entries := make([]string, 0)
+	for key := range f.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				key = key[:len(prefix)+i+1]
+			}
+		}
+		if !slices.Contains(entries, key) {
+			entries = append(entries, key)
+		}
+	}
+	slices.Sort(entries)
+
+	start := 0
+	if token := query.Get("continuation-token"); token != "" {
+		start, _ = strconv.Atoi(token)
+	}
+	end := min(start+maxKeys, len(entries))
+
+	var result strings.Builder
+	result.WriteString("<ListBucketResult>")
+	if end < len(entries) {
+		fmt.Fprintf(&result, "<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>", end)
+	}
+	for _, entry := range entries[start:end] {
+		if strings.HasSuffix(entry, "/") && delimiter != "" {
+			fmt.Fprintf(&result, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", entry)
+		} else {
+			fmt.Fprintf(&result, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>2024-01-02T03:04:05.000Z</LastModified></Contents>",
+				entry, len(f.objects[entry]))
+		}
+	}
+	result.WriteString("</ListBucketResult>")
+	fmt.Fprint(w, result.String())
+}
+
+func writeFakeS3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func newTestS3Driver(t *testing.T, srv *httptest.Server, prefix string, presigned bool) Driver {
+	endpoint, _ := url.Parse(srv.URL)
+	drv, err := newS3Driver(S3Config{
+		Endpoint:           *endpoint,
+		Region:             "us-east-1",
+		Bucket:             "gomp",
+		Prefix:             prefix,
+		AccessKeyID:        "key",
+		SecretAccessKey:    "secret",
+		PathStyle:          true,
+		PresignedURLs:      presigned,
+		PresignedURLExpiry: 60,
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return drv
+}
+
+func Test_s3Driver_Open(t *testing.T) {
+	_, srv := newFakeS3(t, map[string]string{
+		"gomp/uploads/recipes/1/images/a b.jpeg": "0123456789",
+	})
+	drv := newTestS3Driver(t, srv, "/gomp/", false)
+
+	tests := []struct {
+		name      string
+		path      string
+		wantDir   bool
+		wantErrIs error
+	}{
+		{"File", "uploads/recipes/1/images/a b.jpeg", false, nil},
+		{"Directory", "uploads/recipes/1", true, nil},
+		{"Missing", "uploads/recipes/2/images/a.jpeg", false, fs.ErrNotExist},
+		{"Invalid", "../secret", false, fs.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := drv.Open(tt.path)
+			if tt.wantErrIs != nil {
+				if !errors.Is(err, tt.wantErrIs) {
+					t.Errorf("Open() error = %v, want %v", err, tt.wantErrIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer file.Close()
+
+			info, err := file.Stat()
+			if err != nil {
+				t.Fatalf("Stat() error = %v", err)
+			}
+			if info.IsDir() != tt.wantDir {
+				t.Errorf("IsDir() = %v, want %v", info.IsDir(), tt.wantDir)
+			}
+			if tt.wantDir {
+				return
+			}
+			if info.Size() != 10 {
+				t.Errorf("Size() = %d, want 10", info.Size())
+			}
+
+			// Seeking re-requests the rest of the content
+			buf := make([]byte, 3)
+			if _, err := io.ReadFull(file, buf); err != nil || string(buf) != "012" {
+				t.Errorf("Read() = %q, %v", buf, err)
+			}
+			if _, err := file.(io.Seeker).Seek(-2, io.SeekEnd); err != nil {
+				t.Fatalf("Seek() error = %v", err)
+			}
+			if rest, err := io.ReadAll(file); err != nil || string(rest) != "89" {
+				t.Errorf("ReadAll() after Seek() = %q, %v", rest, err)
+			}
+			if n, err := file.(io.ReaderAt).ReadAt(buf, 4); n != 3 || err != nil || string(buf) != "456" {
+				t.Errorf("ReadAt() = %d, %q, %v", n, buf, err)
+			}
+		})
+	}
+}
+
+func Test_s3Driver_Save(t *testing.T) {
+	fake, srv := newFakeS3(t, nil)
+	drv := newTestS3Driver(t, srv, "", false)
+
+	reader := strings.NewReader("content")
+	_, _ = reader.Seek(3, io.SeekStart)
+	if err := drv.Save("uploads/recipes/1/images/a.jpeg", reader); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got := string(fake.objects["uploads/recipes/1/images/a.jpeg"]); got != "content" {
+		t.Errorf("saved content = %q, want %q", got, "content")
+	}
+
+	info, err := drv.Stat("uploads/recipes/1/images/a.jpeg")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Size() != 7 || info.IsDir() || info.ModTime().IsZero() {
+		t.Errorf("Stat() = %+v", info)
+	}
+}
+
+func Test_s3Driver_Delete(t *testing.T) {
+	fake, srv := newFakeS3(t, map[string]string{"uploads/a.jpeg": "a"})
+	drv := newTestS3Driver(t, srv, "", false)
+
+	if err := drv.Delete("uploads/a.jpeg"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, ok := fake.objects["uploads/a.jpeg"]; ok {
+		t.Error("expected object to be deleted")
+	}
+	if err := drv.Delete("uploads/a.jpeg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Delete() of missing file error = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func Test_s3Driver_DeleteAll(t *testing.T) {
+	fake, srv := newFakeS3(t, map[string]string{
+		"uploads/recipes/1/images/a.jpeg":            "a",
+		"uploads/recipes/1/images/b.jpeg":            "b",
+		"uploads/recipes/1/thumbs/a.jpeg":            "a",
+		"uploads/recipes/10/images/c.jpeg":           "c",
+		"uploads/recipes/1/images/nested/deep.jpeg":  "d",
+		"uploads/recipes/1/images/nested/deep2.jpeg": "e",
+	})
+	drv := newTestS3Driver(t, srv, "", false)
+
+	if err := drv.DeleteAll("uploads/recipes/1"); err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	keys := make([]string, 0)
+	for key := range fake.objects {
+		keys = append(keys, key)
+	}
+	if !slices.Equal(keys, []string{"uploads/recipes/10/images/c.jpeg"}) {
+		t.Errorf("remaining keys = %v", keys)
+	}
+}
+
+func Test_s3Driver_List(t *testing.T) {
+	_, srv := newFakeS3(t, map[string]string{
+		"uploads/recipes/1/images/c.jpeg": "c",
+		"uploads/recipes/1/images/a.jpeg": "a",
+		"uploads/recipes/1/images/b.jpeg": "bb",
+		"uploads/recipes/1/thumbs/a.jpeg": "a",
+		"uploads/recipes/1/notes.txt":     "n",
+	})
+	drv := newTestS3Driver(t, srv, "", false)
+
+	tests := []struct {
+		name      string
+		path      string
+		want      []string
+		wantErrIs error
+	}{
+		{"Files only", "uploads/recipes/1", []string{"notes.txt"}, nil},
+		{"Paged", "uploads/recipes/1/images", []string{"a.jpeg", "b.jpeg", "c.jpeg"}, nil},
+		{"Missing", "uploads/recipes/2", nil, fs.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := drv.List(tt.path)
+			if !errors.Is(err, tt.wantErrIs) {
+				t.Fatalf("List() error = %v, want %v", err, tt.wantErrIs)
+			}
+			names := make([]string, 0)
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if tt.want != nil && !slices.Equal(names, tt.want) {
+				t.Errorf("List() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func Test_s3Driver_FS(t *testing.T) {
+	_, srv := newFakeS3(t, map[string]string{
+		"uploads/recipes/1/images/a.jpeg": "a",
+		"uploads/recipes/1/thumbs/a.jpeg": "a",
+		"backups/backup.zip":              "zip",
+	})
+	drv := newTestS3Driver(t, srv, "", false)
+
+	// Directories are walked, e.g., when backing up, so make sure it behaves like any other fs.FS
+	if err := fstest.TestFS(drv, "uploads/recipes/1/images/a.jpeg", "uploads/recipes/1/thumbs/a.jpeg", "backups/backup.zip"); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_s3Driver_errors(t *testing.T) {
+	_, srv := newFakeS3(t, map[string]string{"uploads/a.jpeg": "a"})
+	endpoint, _ := url.Parse(srv.URL)
+	drv, err := newS3Driver(S3Config{
+		Endpoint:        *endpoint,
+		Region:          "us-east-1",
+		Bucket:          "other",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := drv.Open("uploads/a.jpeg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() error = %v, want %v", err, fs.ErrNotExist)
+	}
+	if err := drv.Save("uploads/a.jpeg", strings.NewReader("a")); err == nil {
+		t.Error("Save() expected error")
+	}
+}
+
+func Test_presigningS3Driver_SignURL(t *testing.T) {
+	_, srv := newFakeS3(t, nil)
+	drv := newTestS3Driver(t, srv, "gomp", true)
+
+	signer, ok := drv.(URLSigner)
+	if !ok {
+		t.Fatal("expected driver to implement URLSigner")
+	}
+	signed, err := signer.SignURL("uploads/recipes/1/images/a b.jpeg")
+	if err != nil {
+		t.Fatalf("SignURL() error = %v", err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.EscapedPath() != "/gomp/gomp/uploads/recipes/1/images/a%20b.jpeg" {
+		t.Errorf("unexpected path %s", u.EscapedPath())
+	}
+	if u.Query().Get("X-Amz-Expires") != "60" || u.Query().Get("X-Amz-Signature") == "" {
+		t.Errorf("unexpected query %s", u.RawQuery)
+	}
+
+	if _, ok := newTestS3Driver(t, srv, "", false).(URLSigner); ok {
+		t.Error("expected driver without presigned urls not to implement URLSigner")
+	}
+}
+
+func Test_s3Driver_objectURL(t *testing.T) {
+	endpoint, _ := url.Parse("https://s3.us-east-1.amazonaws.com")
+	d := &s3Driver{endpoint: *endpoint, bucket: "gomp"}
+
+	if got := d.objectURL("uploads/a b.jpeg", nil).String(); got != "https://gomp.s3.us-east-1.amazonaws.com/uploads/a%20b.jpeg" {
+		t.Errorf("virtual-hosted objectURL() = %s", got)
+	}
+
+	d.pathStyle = true
+	query := url.Values{"list-type": {"2"}, "prefix": {"uploads/"}}
+	if got := d.objectURL("", query).String(); got != "https://s3.us-east-1.amazonaws.com/gomp/?list-type=2&prefix=uploads%2F" {
+		t.Errorf("path-style objectURL() = %s", got)
+	}
+}
+
+func TestNewFileServer(t *testing.T) {
+	_, srv := newFakeS3(t, map[string]string{
+		"uploads/recipes/1/images/a.jpeg":          "a",
+		"uploads/recipes/1/refs/c.jpeg":            "",
+		"uploads/content/images/c.jpeg":            "c",
+		"uploads/content/thumbs/c.jpeg":            "c thumb",
+		"uploads/content/variants/c.jpeg/320.webp": "c variant",
+	})
+
+	tests := []struct {
+		name         string
+		presigned    bool
+		path         string
+		wantStatus   int
+		wantBody     string
+		wantLocation string
+	}{
+		{"Served", false, "/uploads/recipes/1/images/a.jpeg", http.StatusOK, "a", ""},
+		{"Served Missing", false, "/uploads/recipes/1/images/b.jpeg", http.StatusNotFound, "", ""},
+		{"Served Directory", false, "/uploads/recipes/1", http.StatusForbidden, "", ""},
+		{"Served Content", false, "/uploads/recipes/1/images/c.jpeg", http.StatusOK, "c", ""},
+		{"Served Content Thumbnail", false, "/uploads/recipes/1/thumbs/c.jpeg", http.StatusOK, "c thumb", ""},
+		{"Served Content Variant", false, "/uploads/recipes/1/variants/c.jpeg/320.webp", http.StatusOK, "c variant", ""},
+		{"Served Missing Variant", false, "/uploads/recipes/1/variants/c.jpeg/640.webp", http.StatusNotFound, "", ""},
+		{"Served Unreferenced Content", false, "/uploads/recipes/2/images/c.jpeg", http.StatusNotFound, "", ""},
+		{"Redirected", true, "/uploads/recipes/1/images/a.jpeg", http.StatusTemporaryRedirect, "", "/uploads/recipes/1/images/a.jpeg"},
+		{"Redirected Missing", true, "/uploads/recipes/1/images/b.jpeg", http.StatusNotFound, "", ""},
+		{"Redirected Directory", true, "/uploads/recipes/1", http.StatusForbidden, "", ""},
+		{"Redirected Content", true, "/uploads/recipes/1/thumbs/c.jpeg", http.StatusTemporaryRedirect, "", "/uploads/content/thumbs/c.jpeg"},
+		{"Redirected Content Variant", true, "/uploads/recipes/1/variants/c.jpeg/320.webp", http.StatusTemporaryRedirect, "", "/uploads/content/variants/c.jpeg/320.webp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewFileServer(newTestS3Driver(t, srv, "", tt.presigned))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			location := rec.Header().Get("Location")
+			if (tt.wantLocation != "") != strings.HasPrefix(location, srv.URL+"/gomp"+tt.wantLocation+"?") {
+				t.Errorf("unexpected location %q", location)
+			}
+		})
+	}
+}
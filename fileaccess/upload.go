@@ -2,6 +2,8 @@ package fileaccess
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"image"
@@ -10,8 +12,11 @@ import (
 	"io/fs"
 	"math"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/chadweimer/gomp/fileaccess/webp"
 	"github.com/chadweimer/gomp/models"
 	"github.com/samber/lo"
 	"golang.org/x/image/draw"
@@ -34,6 +39,7 @@ var ErrInvalidContentType = errors.New("image is not in a supported format")
 // ImageUploader represents an object to handle image uploads
 type ImageUploader struct {
 	driver Driver
+	refs   ImageReferences
 	imgCfg ImageConfig
 }
 
@@ -45,32 +51,29 @@ type SaveResult struct {
 	URL string
 	// ThumbnailURL is the URL to access the thumbnail image
 	ThumbnailURL string
+	// Width is the width of the saved image, in pixels
+	Width int
+	// Height is the height of the saved image, in pixels
+	Height int
 }
 
-// CreateImageUploader returns an ImageUploader implementation that uses the specified Driver
-func CreateImageUploader(driver Driver, imgCfg ImageConfig) (*ImageUploader, error) {
+// CreateImageUploader returns an ImageUploader implementation that uses the specified Driver,
+// and records which recipes use each content-addressed image in the specified ImageReferences
+func CreateImageUploader(driver Driver, refs ImageReferences, imgCfg ImageConfig) (*ImageUploader, error) {
 	if err := imgCfg.validate(); err != nil {
 		return nil, err
 	}
-	return &ImageUploader{driver, imgCfg}, nil
+	return &ImageUploader{driver, refs, imgCfg}, nil
 }
 
 // Save saves the uploaded image, including generating a thumbnail,
-// to the upload store.
-func (u ImageUploader) Save(recipeID int64, imageName string, data []byte) (result *SaveResult, err error) {
-	// Make sure the file extension is for a JPEG
-	imageExt := filepath.Ext(imageName)
-	switch imageExt {
-	case ".jpeg", ".jpg":
-		// Nothing to do; leave it as-is
-	default:
-		imageName = imageName[0:len(imageName)-len(imageExt)] + ".jpeg"
-	}
-
+// to the upload store. The image is named by its content, so saving
+// the same image more than once, for any recipe, only stores it once.
+// JPEG images are oriented according to their EXIF metadata, and
+// are stored without any of their metadata.
+func (u ImageUploader) Save(ctx context.Context, recipeID int64, data []byte) (result *SaveResult, err error) {
 	// First decode the image
-	dataReader := bytes.NewReader(data)
-	original, format, err := image.Decode(dataReader)
-	// QUESTION: Do we need to auto-detect EXIF orientation and rotate the image accordingly?
+	original, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		if errors.Is(err, image.ErrFormat) {
 			return nil, ErrInvalidContentType
@@ -78,34 +81,100 @@ func (u ImageUploader) Save(recipeID int64, imageName string, data []byte) (resu
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	var imageURL string
-	imgDir := getDirPathForImage(recipeID)
+	// Cameras, especially phones, often record how the image is meant to be oriented rather than rotating it
+	orientation := exifOrientationNormal
+	if format == "jpeg" {
+		orientation = readJPEGOrientation(data)
+		original = applyOrientation(original, orientation)
+	}
+
+	savedSize := u.getSavedSize(original.Bounds())
+
+	var imageData []byte
 	if format == "jpeg" && u.imgCfg.ImageQuality == models.ImageQualityOriginal {
-		// Save the original as-is
-		imageURL, err = u.saveImage(dataReader, imgDir, imageName)
+		// Save the original as-is, other than stripping any metadata, e.g., where it was taken.
+		// The orientation is kept, since the image itself hasn't been rotated.
+		imageData, err = stripJPEGMetadata(data, orientation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to strip image metadata: %w", err)
+		}
 	} else {
-		// Resize and save as jpeg
-		imageURL, err = u.generateFitted(original, imgDir, imageName)
+		// Resize and save as jpeg, which also leaves any metadata behind
+		imageData, err = u.generateFitted(original)
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	// And generate a thumbnail
+	thumbData, err := u.generateThumbnail(original)
+	if err != nil {
+		return nil, err
+	}
+
+	// As well as any smaller variants
+	variants, err := u.generateVariants(original)
 	if err != nil {
 		return nil, err
 	}
 
-	// And generate a thumbnail and save it
-	thumbURL, err := u.generateThumbnail(original, getDirPathForThumbnail(recipeID), imageName)
+	imageName := getContentName(imageData, ".jpeg")
+
+	// The content must not be removed, e.g., by another recipe no longer using it, while it's being saved
+	unlock, err := u.refs.Lock(ctx, imageName)
 	if err != nil {
+		return nil, fmt.Errorf("failed to lock image '%s': %w", imageName, err)
+	}
+	defer unlock()
+
+	// The content may already be stored, e.g., for another recipe
+	contentPath := filepath.Join(getDirPathForContentImage(), imageName)
+	if _, err := u.driver.Stat(contentPath); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to check for existing image '%s': %w", contentPath, err)
+		}
+		if err := u.saveImage(bytes.NewReader(imageData), contentPath); err != nil {
+			return nil, err
+		}
+	}
+	// The thumbnail and variants are always regenerated, in case their settings have changed
+	if err := u.saveImage(bytes.NewReader(thumbData), filepath.Join(getDirPathForContentThumbnail(), imageName)); err != nil {
+		return nil, err
+	}
+	variantsPath := getDirPathForContentVariants(imageName)
+	if err := u.driver.DeleteAll(variantsPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to delete existing variants '%s': %w", variantsPath, err)
+	}
+	for variantName, variantData := range variants {
+		if err := u.saveImage(bytes.NewReader(variantData), filepath.Join(variantsPath, variantName)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := u.addReference(ctx, recipeID, imageName); err != nil {
 		return nil, err
 	}
 
 	return &SaveResult{
 		Name:         imageName,
-		URL:          imageURL,
-		ThumbnailURL: thumbURL,
+		URL:          getURL(filepath.Join(getDirPathForImage(recipeID), imageName)),
+		ThumbnailURL: getURL(filepath.Join(getDirPathForThumbnail(recipeID), imageName)),
+		Width:        savedSize.X,
+		Height:       savedSize.Y,
 	}, nil
 }
 
 // Delete removes the specified image files from the upload store.
-func (u ImageUploader) Delete(recipeID int64, imageName string) error {
+// The content of the image is only removed once no recipe references it.
+func (u ImageUploader) Delete(ctx context.Context, recipeID int64, imageName string) error {
+	isRef, err := isImageReference(u.driver, recipeID, imageName)
+	if err != nil {
+		return err
+	}
+	if isRef {
+		return u.removeReference(ctx, recipeID, imageName)
+	}
+
 	origPath := filepath.Join(getDirPathForImage(recipeID), imageName)
 	if err := u.driver.Delete(origPath); err != nil {
 		return err
@@ -115,22 +184,57 @@ func (u ImageUploader) Delete(recipeID int64, imageName string) error {
 }
 
 // DeleteAll removes all image files for the specified recipe from the upload store.
-func (u ImageUploader) DeleteAll(recipeID int64) error {
+func (u ImageUploader) DeleteAll(ctx context.Context, recipeID int64) error {
+	refNames, err := u.listFiles(getDirPathForReferences(recipeID))
+	if err != nil {
+		return fmt.Errorf("failed to list image references for recipe %d: %w", recipeID, err)
+	}
+	for _, name := range refNames {
+		if err := u.removeReference(ctx, recipeID, name); err != nil {
+			return err
+		}
+	}
+
 	dirPath := getDirPathForRecipe(recipeID)
-	err := u.driver.DeleteAll(dirPath)
+	err = u.driver.DeleteAll(dirPath)
 
 	return err
 }
 
-// List returns a list of image names for the specified recipe
+// List returns a list of image names for the specified recipe,
+// including both the images stored in the recipe's directories and the references to content-addressed images
 func (u ImageUploader) List(recipeID int64) ([]string, error) {
-	dirPath := getDirPathForImage(recipeID)
+	names, refNames, err := u.listImageNames(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.Uniq(append(names, refNames...)), nil
+}
+
+// listImageNames returns the names of the images stored in the recipe's directories
+// and the names of the content-addressed images it references, separately
+func (u ImageUploader) listImageNames(recipeID int64) (names []string, refNames []string, err error) {
+	names, err = u.listFiles(getDirPathForImage(recipeID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list images for recipe %d: %w", recipeID, err)
+	}
+	refNames, err = u.listFiles(getDirPathForReferences(recipeID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list image references for recipe %d: %w", recipeID, err)
+	}
+
+	return names, refNames, nil
+}
+
+// listFiles returns the names of the files in the specified directory, which is empty if it doesn't exist
+func (u ImageUploader) listFiles(dirPath string) ([]string, error) {
 	entries, err := u.driver.List(dirPath)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return []string{}, nil
 		}
-		return nil, fmt.Errorf("failed to list images for recipe %d: %w", recipeID, err)
+		return nil, err
 	}
 
 	return lo.FilterMap(entries, func(entry fs.DirEntry, _ int) (string, bool) {
@@ -141,13 +245,483 @@ func (u ImageUploader) List(recipeID int64) ([]string, error) {
 	}), nil
 }
 
+// ListRecipeIDs returns the IDs of the recipes that have a directory in the upload store, in ascending order
+func (u ImageUploader) ListRecipeIDs() ([]int64, error) {
+	// List only includes files, so read the directory itself
+	dirPath := filepath.Join(UploadDirectoryName, "recipes")
+	entries, err := fs.ReadDir(u.driver, dirPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []int64{}, nil
+		}
+		return nil, fmt.Errorf("failed to list recipe directories: %w", err)
+	}
+
+	recipeIDs := lo.FilterMap(entries, func(entry fs.DirEntry, _ int) (int64, bool) {
+		if !entry.IsDir() {
+			return 0, false
+		}
+		recipeID, err := strconv.ParseInt(entry.Name(), 10, 64)
+		return recipeID, err == nil
+	})
+	slices.Sort(recipeIDs)
+	return recipeIDs, nil
+}
+
+// HasThumbnail returns whether the thumbnail of the specified image exists
+func (u ImageUploader) HasThumbnail(recipeID int64, imageName string) (bool, error) {
+	thumbPath := resolveImagePath(u.driver, filepath.Join(getDirPathForThumbnail(recipeID), imageName))
+	if _, err := u.driver.Stat(thumbPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check for thumbnail '%s': %w", thumbPath, err)
+	}
+	return true, nil
+}
+
+// RegenerateThumbnail generates the thumbnail of the specified image again from the saved image,
+// using the current thumbnail settings. The image itself is left as-is.
+func (u ImageUploader) RegenerateThumbnail(ctx context.Context, recipeID int64, imageName string) error {
+	imagePath := filepath.Join(getDirPathForImage(recipeID), imageName)
+	thumbPath := filepath.Join(getDirPathForThumbnail(recipeID), imageName)
+
+	isRef, err := isImageReference(u.driver, recipeID, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to check for reference to image '%s': %w", imageName, err)
+	}
+	if isRef {
+		// The content must not be removed, e.g., by another recipe no longer using it, while the thumbnail is being saved
+		unlock, err := u.refs.Lock(ctx, imageName)
+		if err != nil {
+			return fmt.Errorf("failed to lock image '%s': %w", imageName, err)
+		}
+		defer unlock()
+
+		imagePath = filepath.Join(getDirPathForContentImage(), imageName)
+		thumbPath = filepath.Join(getDirPathForContentThumbnail(), imageName)
+	}
+
+	data, err := fs.ReadFile(u.driver, imagePath)
+	if err != nil {
+		return fmt.Errorf("failed to read image '%s': %w", imagePath, err)
+	}
+	original, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return ErrInvalidContentType
+		}
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	// Original JPEG images are saved with their orientation
+	if format == "jpeg" {
+		original = applyOrientation(original, readJPEGOrientation(data))
+	}
+
+	thumbData, err := u.generateThumbnail(original)
+	if err != nil {
+		return err
+	}
+	return u.saveImage(bytes.NewReader(thumbData), thumbPath)
+}
+
+// ContentReference is a reference from a recipe to a content-addressed image
+type ContentReference struct {
+	// RecipeID is the ID of the recipe that uses the image
+	RecipeID int64
+	// Name is the name of the image
+	Name string
+}
+
+// ContentCheckResult describes where the stored content-addressed images,
+// the recorded references to them and the markers in the recipes' directories don't agree
+type ContentCheckResult struct {
+	// OrphanedContent is the names of the stored images that no recipe uses
+	OrphanedContent []string
+	// StaleReferences are the references that are either recorded without a marker,
+	// or marked without being recorded
+	StaleReferences []ContentReference
+	// MissingContent are the marked references to images that aren't stored
+	MissingContent []ContentReference
+}
+
+// CheckContent compares the stored content-addressed images with the recorded references to them
+// and the markers in the recipes' directories. Each of the results is sorted.
+func (u ImageUploader) CheckContent(ctx context.Context) (*ContentCheckResult, error) {
+	// The markers are listed first, since images are stored and recorded before they're marked,
+	// so that an image saved during the check is at worst seen as a stale reference, which RepairReference leaves as-is
+	recipeIDs, err := u.ListRecipeIDs()
+	if err != nil {
+		return nil, err
+	}
+	marked := map[ContentReference]bool{}
+	usedNames := map[string]bool{}
+	for _, recipeID := range recipeIDs {
+		refNames, err := u.listFiles(getDirPathForReferences(recipeID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list image references for recipe %d: %w", recipeID, err)
+		}
+		for _, name := range refNames {
+			marked[ContentReference{recipeID, name}] = true
+			usedNames[name] = true
+		}
+	}
+
+	recorded, err := u.refs.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list image references: %w", err)
+	}
+
+	stored := map[string]bool{}
+	storedNames, err := u.listFiles(getDirPathForContentImage())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored images: %w", err)
+	}
+	for _, name := range storedNames {
+		stored[name] = true
+	}
+	// Thumbnails and variants can be left behind without the image itself
+	thumbNames, err := u.listFiles(getDirPathForContentThumbnail())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored thumbnails: %w", err)
+	}
+	// List only includes files, so read the directory itself
+	variantEntries, err := fs.ReadDir(u.driver, filepath.Join(UploadDirectoryName, contentDirectoryName, "variants"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list stored variants: %w", err)
+	}
+	contentNames := slices.Concat(storedNames, thumbNames)
+	for _, entry := range variantEntries {
+		if entry.IsDir() {
+			contentNames = append(contentNames, entry.Name())
+		}
+	}
+
+	result := &ContentCheckResult{
+		OrphanedContent: []string{},
+		StaleReferences: []ContentReference{},
+		MissingContent:  []ContentReference{},
+	}
+	for _, name := range lo.Uniq(contentNames) {
+		if len(recorded[name]) == 0 && !usedNames[name] {
+			result.OrphanedContent = append(result.OrphanedContent, name)
+		}
+	}
+	for ref := range marked {
+		switch {
+		case !stored[ref.Name]:
+			result.MissingContent = append(result.MissingContent, ref)
+		case !slices.Contains(recorded[ref.Name], ref.RecipeID):
+			result.StaleReferences = append(result.StaleReferences, ref)
+		}
+	}
+	for name, ids := range recorded {
+		for _, recipeID := range ids {
+			if ref := (ContentReference{recipeID, name}); !marked[ref] {
+				result.StaleReferences = append(result.StaleReferences, ref)
+			}
+		}
+	}
+
+	slices.Sort(result.OrphanedContent)
+	compareRefs := func(a, b ContentReference) int {
+		if c := cmp.Compare(a.RecipeID, b.RecipeID); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	}
+	slices.SortFunc(result.StaleReferences, compareRefs)
+	slices.SortFunc(result.MissingContent, compareRefs)
+	return result, nil
+}
+
+// RepairReference makes the recorded reference from the recipe to the content-addressed image agree with its marker.
+// A marked reference is recorded, as long as the image is stored; otherwise, both are removed.
+func (u ImageUploader) RepairReference(ctx context.Context, recipeID int64, imageName string) error {
+	unlock, err := u.refs.Lock(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to lock image '%s': %w", imageName, err)
+	}
+	defer unlock()
+
+	// Check again, now that nothing else can change the references
+	isRef, err := isImageReference(u.driver, recipeID, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to check for reference to image '%s': %w", imageName, err)
+	}
+	if isRef {
+		contentPath := filepath.Join(getDirPathForContentImage(), imageName)
+		if _, err := u.driver.Stat(contentPath); err == nil {
+			return u.addReference(ctx, recipeID, imageName)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to check for image '%s': %w", contentPath, err)
+		}
+
+		// There's nothing left to use
+		refPath := filepath.Join(getDirPathForReferences(recipeID), imageName)
+		if err := u.driver.Delete(refPath); err != nil {
+			return fmt.Errorf("failed to delete image reference '%s': %w", refPath, err)
+		}
+	}
+
+	return u.dropReference(ctx, recipeID, imageName)
+}
+
+// DeleteContent removes the content-addressed image, along with its thumbnail and variants,
+// as long as no recipe uses it
+func (u ImageUploader) DeleteContent(ctx context.Context, imageName string) error {
+	unlock, err := u.refs.Lock(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to lock image '%s': %w", imageName, err)
+	}
+	defer unlock()
+
+	// Check again, now that nothing else can start using it
+	recorded, err := u.refs.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list image references: %w", err)
+	}
+	if len(recorded[imageName]) > 0 {
+		return nil
+	}
+
+	return u.deleteContent(imageName)
+}
+
+// ListImages returns the images of the specified recipe, along with the URLs to access them and their variants
+func (u ImageUploader) ListImages(recipeID int64) ([]models.RecipeImage, error) {
+	// Listing the references up front avoids checking for a reference to each image separately
+	names, refNames, err := u.listImageNames(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	names = lo.Uniq(append(names, refNames...))
+	images := make([]models.RecipeImage, 0, len(names))
+	for _, name := range names {
+		variants := []models.ImageVariant{}
+		if slices.Contains(refNames, name) {
+			if variants, err = u.listContentVariants(recipeID, name); err != nil {
+				return nil, err
+			}
+		}
+		images = append(images, models.RecipeImage{
+			Name:         name,
+			URL:          getURL(filepath.Join(getDirPathForImage(recipeID), name)),
+			ThumbnailURL: getURL(filepath.Join(getDirPathForThumbnail(recipeID), name)),
+			Variants:     variants,
+		})
+	}
+	return images, nil
+}
+
+// ListVariants returns the smaller variants of the specified image, ordered by type and then by width.
+// Images that are not named by their content have no variants.
+func (u ImageUploader) ListVariants(recipeID int64, imageName string) ([]models.ImageVariant, error) {
+	isRef, err := isImageReference(u.driver, recipeID, imageName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for reference to image '%s': %w", imageName, err)
+	}
+	if !isRef {
+		return []models.ImageVariant{}, nil
+	}
+
+	return u.listContentVariants(recipeID, imageName)
+}
+
+// listContentVariants returns the variants of the specified content-addressed image,
+// as referenced by the specified recipe, ordered by type and then by width
+func (u ImageUploader) listContentVariants(recipeID int64, imageName string) ([]models.ImageVariant, error) {
+	entries, err := u.driver.List(getDirPathForContentVariants(imageName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []models.ImageVariant{}, nil
+		}
+		return nil, fmt.Errorf("failed to list variants of image '%s': %w", imageName, err)
+	}
+
+	variants := lo.FilterMap(entries, func(entry fs.DirEntry, _ int) (models.ImageVariant, bool) {
+		if entry.IsDir() {
+			return models.ImageVariant{}, false
+		}
+		width, format, ok := parseVariantName(entry.Name())
+		if !ok {
+			return models.ImageVariant{}, false
+		}
+		return models.ImageVariant{
+			URL:   getURL(filepath.Join(getDirPathForVariants(recipeID, imageName), entry.Name())),
+			Width: width,
+			Type:  "image/" + format,
+		}, true
+	})
+	slices.SortFunc(variants, func(a, b models.ImageVariant) int {
+		if a.Type != b.Type {
+			return strings.Compare(a.Type, b.Type)
+		}
+		return a.Width - b.Width
+	})
+	return variants, nil
+}
+
+// CopyAll copies all images, along with their thumbnails, from one recipe to another.
+// Images that are named by their content are referenced rather than copied, and skipped
+// if the destination recipe already references them.
+// Other images with the same name as an existing image of the destination recipe are renamed.
+// Returns the names the images were copied as, keyed by their original names.
+// If an error occurs, any images already copied are removed.
+func (u ImageUploader) CopyAll(ctx context.Context, srcRecipeID int64, destRecipeID int64) (copied map[string]string, err error) {
+	srcImages, err := u.listFiles(getDirPathForImage(srcRecipeID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images for recipe %d: %w", srcRecipeID, err)
+	}
+	srcRefs, err := u.listFiles(getDirPathForReferences(srcRecipeID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list image references for recipe %d: %w", srcRecipeID, err)
+	}
+	destImages, err := u.List(destRecipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	copied = make(map[string]string, len(srcImages)+len(srcRefs))
+	defer func() {
+		if err != nil {
+			for _, name := range copied {
+				_ = u.Delete(ctx, destRecipeID, name)
+			}
+			copied = nil
+		}
+	}()
+
+	for _, name := range srcRefs {
+		if slices.Contains(destImages, name) {
+			continue
+		}
+		if err = u.lockedAddReference(ctx, destRecipeID, name); err != nil {
+			return copied, err
+		}
+		copied[name] = name
+	}
+
+	for _, name := range srcImages {
+		srcPath := filepath.Join(getDirPathForImage(srcRecipeID), name)
+		destName := name
+		if slices.Contains(destImages, destName) {
+			destName = strconv.FormatInt(srcRecipeID, 10) + "-" + name
+		}
+
+		if err = u.copyFile(srcPath, filepath.Join(getDirPathForImage(destRecipeID), destName)); err != nil {
+			return copied, err
+		}
+		copied[name] = destName
+
+		// Not every image necessarily has a thumbnail, e.g., if generating it previously failed
+		err = u.copyFile(filepath.Join(getDirPathForThumbnail(srcRecipeID), name), filepath.Join(getDirPathForThumbnail(destRecipeID), destName))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return copied, err
+		}
+		err = nil
+	}
+
+	return copied, nil
+}
+
+func (u ImageUploader) copyFile(srcPath string, destPath string) error {
+	file, err := u.driver.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := u.driver.Save(destPath, file); err != nil {
+		return fmt.Errorf("failed to copy '%s' to '%s': %w", srcPath, destPath, err)
+	}
+	return nil
+}
+
 // Load reads the image for the given recipe, returning the bytes of the file
 func (u ImageUploader) Load(recipeID int64, imageName string) ([]byte, error) {
 	origPath := filepath.Join(getDirPathForImage(recipeID), imageName)
-	return fs.ReadFile(u.driver, origPath)
+	return fs.ReadFile(u.driver, resolveImagePath(u.driver, origPath))
+}
+
+// addReference records that the recipe uses the content-addressed image.
+// The caller must hold the lock on the image's references.
+func (u ImageUploader) addReference(ctx context.Context, recipeID int64, imageName string) error {
+	// The reference is recorded before the marker is saved, so that a marker never refers to content that can be removed
+	if err := u.refs.Add(ctx, imageName, recipeID); err != nil {
+		return fmt.Errorf("failed to add reference to image '%s': %w", imageName, err)
+	}
+
+	refPath := filepath.Join(getDirPathForReferences(recipeID), imageName)
+	if err := u.driver.Save(refPath, bytes.NewReader(nil)); err != nil {
+		return fmt.Errorf("failed to save image reference to '%s': %w", refPath, err)
+	}
+	return nil
+}
+
+// lockedAddReference records that the recipe uses the content-addressed image, which must already be stored
+func (u ImageUploader) lockedAddReference(ctx context.Context, recipeID int64, imageName string) error {
+	unlock, err := u.refs.Lock(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to lock image '%s': %w", imageName, err)
+	}
+	defer unlock()
+
+	return u.addReference(ctx, recipeID, imageName)
+}
+
+// removeReference records that the recipe no longer uses the content-addressed image,
+// removing the content if no other recipe uses it
+func (u ImageUploader) removeReference(ctx context.Context, recipeID int64, imageName string) error {
+	unlock, err := u.refs.Lock(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to lock image '%s': %w", imageName, err)
+	}
+	defer unlock()
+
+	if err := u.driver.Delete(filepath.Join(getDirPathForReferences(recipeID), imageName)); err != nil {
+		return err
+	}
+
+	return u.dropReference(ctx, recipeID, imageName)
+}
+
+// dropReference removes the recorded reference from the recipe to the content-addressed image,
+// removing the content if no other recipe uses it.
+// The caller must hold the lock on the image's references.
+func (u ImageUploader) dropReference(ctx context.Context, recipeID int64, imageName string) error {
+	remaining, err := u.refs.Remove(ctx, imageName, recipeID)
+	if err != nil {
+		return fmt.Errorf("failed to remove reference to image '%s': %w", imageName, err)
+	}
+	if remaining > 0 {
+		return nil
+	}
+
+	// That was the last reference, so the content can go
+	return u.deleteContent(imageName)
+}
+
+// deleteContent removes the content-addressed image, along with its thumbnail and variants.
+// The caller must hold the lock on the image's references.
+func (u ImageUploader) deleteContent(imageName string) error {
+	for _, filePath := range []string{
+		filepath.Join(getDirPathForContentImage(), imageName),
+		filepath.Join(getDirPathForContentThumbnail(), imageName),
+	} {
+		if err := u.driver.Delete(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete unreferenced '%s': %w", filePath, err)
+		}
+	}
+	variantsPath := getDirPathForContentVariants(imageName)
+	if err := u.driver.DeleteAll(variantsPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete unreferenced '%s': %w", variantsPath, err)
+	}
+	return nil
 }
 
-func (u ImageUploader) generateThumbnail(original image.Image, saveDir string, imageName string) (string, error) {
+func (u ImageUploader) generateThumbnail(original image.Image) ([]byte, error) {
 	resize, crop := cover(original.Bounds(), u.imgCfg.ThumbnailSize)
 	resizedImage := resizeImage(original, resize, getScaler(u.imgCfg.ThumbnailQuality))
 	croppedImage := resizedImage.SubImage(crop)
@@ -155,18 +729,17 @@ func (u ImageUploader) generateThumbnail(original image.Image, saveDir string, i
 	thumbBuf := new(bytes.Buffer)
 	err := jpeg.Encode(thumbBuf, croppedImage, getJPEGOptions(u.imgCfg.ThumbnailQuality))
 	if err != nil {
-		return "", fmt.Errorf("failed to encode thumbnail image: %w", err)
+		return nil, fmt.Errorf("failed to encode thumbnail image: %w", err)
 	}
 
-	return u.saveImage(bytes.NewReader(thumbBuf.Bytes()), saveDir, imageName)
+	return thumbBuf.Bytes(), nil
 }
 
-func (u ImageUploader) generateFitted(original image.Image, saveDir string, imageName string) (string, error) {
+func (u ImageUploader) generateFitted(original image.Image) ([]byte, error) {
 	var fittedImage image.Image
 
 	bounds := original.Bounds()
-	if u.imgCfg.ImageQuality == models.ImageQualityOriginal ||
-		(bounds.Dx() <= u.imgCfg.ImageSize && bounds.Dy() <= u.imgCfg.ImageSize) {
+	if !u.needsFitting(bounds) {
 		fittedImage = original
 	} else {
 		resize := fit(bounds, u.imgCfg.ImageSize)
@@ -176,20 +749,79 @@ func (u ImageUploader) generateFitted(original image.Image, saveDir string, imag
 	fittedBuf := new(bytes.Buffer)
 	err := jpeg.Encode(fittedBuf, fittedImage, getJPEGOptions(u.imgCfg.ImageQuality))
 	if err != nil {
-		return "", fmt.Errorf("failed to encode fitted image: %w", err)
+		return nil, fmt.Errorf("failed to encode fitted image: %w", err)
+	}
+
+	return fittedBuf.Bytes(), nil
+}
+
+// generateVariants returns the smaller variants of the image, keyed by their file names.
+// Variants are only generated for widths smaller than the saved image.
+func (u ImageUploader) generateVariants(original image.Image) (map[string][]byte, error) {
+	bounds := original.Bounds()
+	savedWidth := u.getSavedSize(bounds).X
+
+	// Variants are always re-encoded, so original quality isn't applicable
+	quality := u.imgCfg.ImageQuality
+	if quality == models.ImageQualityOriginal {
+		quality = models.ImageQualityHigh
+	}
+
+	variants := make(map[string][]byte)
+	widths := slices.Compact(slices.Sorted(slices.Values(u.imgCfg.VariantWidths)))
+	for _, width := range widths {
+		if width >= savedWidth {
+			break
+		}
+
+		height := max(int(math.Round(float64(bounds.Dy())*float64(width)/float64(bounds.Dx()))), 1)
+		resizedImage := resizeImage(original, image.Rect(0, 0, width, height), getScaler(quality))
+		for _, format := range u.imgCfg.VariantFormats {
+			buf := new(bytes.Buffer)
+			var err error
+			if format == ImageFormatWebP {
+				err = webp.Encode(buf, resizedImage, getEncodingQuality(quality))
+				if errors.Is(err, webp.ErrImageTooLarge) {
+					// Not every image fits, e.g., extremely tall ones, in which case the other formats will have to do
+					continue
+				}
+			} else {
+				err = jpeg.Encode(buf, resizedImage, getJPEGOptions(quality))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %d pixel wide %s variant: %w", width, format, err)
+			}
+			variants[getVariantName(width, format)] = buf.Bytes()
+		}
+	}
+
+	return variants, nil
+}
+
+// getSavedSize returns the size that an image of the specified size is saved at
+func (u ImageUploader) getSavedSize(bounds image.Rectangle) image.Point {
+	if u.needsFitting(bounds) {
+		return fit(bounds, u.imgCfg.ImageSize).Size()
 	}
+	return bounds.Size()
+}
 
-	return u.saveImage(bytes.NewReader(fittedBuf.Bytes()), saveDir, imageName)
+// needsFitting returns whether an image of the specified size is downscaled when saved
+func (u ImageUploader) needsFitting(bounds image.Rectangle) bool {
+	return u.imgCfg.ImageQuality != models.ImageQualityOriginal &&
+		(bounds.Dx() > u.imgCfg.ImageSize || bounds.Dy() > u.imgCfg.ImageSize)
 }
 
-func (u ImageUploader) saveImage(reader io.ReadSeeker, baseDir string, imageName string) (string, error) {
-	fullPath := filepath.Join(baseDir, imageName)
-	url := filepath.ToSlash(filepath.Join("/", fullPath))
+func (u ImageUploader) saveImage(reader io.ReadSeeker, fullPath string) error {
 	err := u.driver.Save(fullPath, reader)
 	if err != nil {
-		return "", fmt.Errorf("failed to save image to '%s' using configured upload driver: %w", fullPath, err)
+		return fmt.Errorf("failed to save image to '%s' using configured upload driver: %w", fullPath, err)
 	}
-	return url, nil
+	return nil
+}
+
+func getURL(fullPath string) string {
+	return filepath.ToSlash(filepath.Join("/", fullPath))
 }
 
 func getDirPathForRecipe(recipeID int64) string {
@@ -200,10 +832,37 @@ func getDirPathForImage(recipeID int64) string {
 	return filepath.Join(getDirPathForRecipe(recipeID), "images")
 }
 
+// getDirPathForReferences returns the path of the directory with the markers of the content-addressed images the recipe uses
+func getDirPathForReferences(recipeID int64) string {
+	return filepath.Join(getDirPathForRecipe(recipeID), "refs")
+}
+
 func getDirPathForThumbnail(recipeID int64) string {
 	return filepath.Join(getDirPathForRecipe(recipeID), "thumbs")
 }
 
+func getDirPathForVariants(recipeID int64, imageName string) string {
+	return filepath.Join(getDirPathForRecipe(recipeID), "variants", imageName)
+}
+
+// getVariantName returns the file name of a variant with the specified width and format, e.g., 640.webp
+func getVariantName(width int, format string) string {
+	return strconv.Itoa(width) + "." + format
+}
+
+// parseVariantName returns the width and format of a variant from its file name
+func parseVariantName(name string) (width int, format string, ok bool) {
+	widthStr, format, ok := strings.Cut(name, ".")
+	if !ok {
+		return 0, "", false
+	}
+	width, err := strconv.Atoi(widthStr)
+	if err != nil {
+		return 0, "", false
+	}
+	return width, format, true
+}
+
 func fit(src image.Rectangle, size int) (resize image.Rectangle) {
 	srcW := src.Dx()
 	srcH := src.Dy()
@@ -261,12 +920,17 @@ func getScaler(quality models.ImageQualityLevel) draw.Scaler {
 }
 
 func getJPEGOptions(quality models.ImageQualityLevel) *jpeg.Options {
+	return &jpeg.Options{Quality: getEncodingQuality(quality)}
+}
+
+// getEncodingQuality returns the quality (1-100) to encode images with for the quality level
+func getEncodingQuality(quality models.ImageQualityLevel) int {
 	switch quality {
 	case models.ImageQualityMedium:
-		return &jpeg.Options{Quality: 80}
+		return 80
 	case models.ImageQualityLow:
-		return &jpeg.Options{Quality: 70}
+		return 70
 	default:
-		return &jpeg.Options{Quality: 92}
+		return 92
 	}
 }
@@ -2,32 +2,121 @@ package fileaccess
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"image/jpeg"
 	"image/png"
 	"io/fs"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"testing"
+	"testing/fstest"
 
 	fileaccessmock "github.com/chadweimer/gomp/mocks/fileaccess"
 	"github.com/chadweimer/gomp/models"
 	"go.uber.org/mock/gomock"
 )
 
+func encodeTestImage(t *testing.T, src image.Image, ext string) []byte {
+	buf := new(bytes.Buffer)
+	var err error
+	switch ext {
+	case ".png":
+		err = png.Encode(buf, src)
+	default:
+		err = jpeg.Encode(buf, src, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testImageReferences is an in-memory ImageReferences,
+// which fails any change to the references to content that isn't locked
+type testImageReferences struct {
+	recipeIDs map[string][]int64
+	locked    map[string]bool
+}
+
+func newTestImageReferences(recipeIDs map[string][]int64) *testImageReferences {
+	if recipeIDs == nil {
+		recipeIDs = map[string][]int64{}
+	}
+	return &testImageReferences{recipeIDs: recipeIDs, locked: map[string]bool{}}
+}
+
+func (r *testImageReferences) Lock(_ context.Context, contentName string) (func(), error) {
+	if r.locked[contentName] {
+		return nil, fmt.Errorf("'%s' is already locked", contentName)
+	}
+	r.locked[contentName] = true
+	return func() { delete(r.locked, contentName) }, nil
+}
+
+func (r *testImageReferences) Add(_ context.Context, contentName string, recipeID int64) error {
+	if !r.locked[contentName] {
+		return fmt.Errorf("'%s' is not locked", contentName)
+	}
+	if !slices.Contains(r.recipeIDs[contentName], recipeID) {
+		r.recipeIDs[contentName] = append(r.recipeIDs[contentName], recipeID)
+		slices.Sort(r.recipeIDs[contentName])
+	}
+	return nil
+}
+
+func (r *testImageReferences) Remove(_ context.Context, contentName string, recipeID int64) (int64, error) {
+	if !r.locked[contentName] {
+		return 0, fmt.Errorf("'%s' is not locked", contentName)
+	}
+	r.recipeIDs[contentName] = slices.DeleteFunc(r.recipeIDs[contentName], func(id int64) bool { return id == recipeID })
+	remaining := len(r.recipeIDs[contentName])
+	if remaining == 0 {
+		delete(r.recipeIDs, contentName)
+	}
+	return int64(remaining), nil
+}
+
+func (r *testImageReferences) List(context.Context) (map[string][]int64, error) {
+	recipeIDs := make(map[string][]int64, len(r.recipeIDs))
+	for contentName, ids := range r.recipeIDs {
+		recipeIDs[contentName] = slices.Clone(ids)
+	}
+	return recipeIDs, nil
+}
+
+func newTestImageUploader(t *testing.T, drv Driver, refs ImageReferences) *ImageUploader {
+	if refs == nil {
+		refs = newTestImageReferences(nil)
+	}
+	uploader, err := CreateImageUploader(drv, refs, ImageConfig{
+		ImageQuality:     models.ImageQualityOriginal,
+		ImageSize:        200,
+		ThumbnailQuality: models.ImageQualityMedium,
+		ThumbnailSize:    50,
+	})
+	if err != nil {
+		t.Fatalf("CreateImageUploader: %v", err)
+	}
+	return uploader
+}
+
 func Test_Save(t *testing.T) {
 	type testArgs struct {
-		caseName              string
-		cfg                   ImageConfig
-		recipeID              int64
-		originalName          string
-		srcImage              image.Image
-		expectedName          string
-		expectedImagePath     string
-		expectedThumbnailPath string
-		expectedURL           string
-		expectedThumbnailURL  string
-		expectedSaveError     error
+		caseName          string
+		cfg               ImageConfig
+		recipeID          int64
+		ext               string
+		srcImage          image.Image
+		expectedOriginal  bool
+		expectedSize      image.Point
+		expectedSaveError error
 	}
 
 	// Arrange
@@ -40,15 +129,11 @@ func Test_Save(t *testing.T) {
 				ThumbnailQuality: models.ImageQualityMedium,
 				ThumbnailSize:    50,
 			},
-			recipeID:              42,
-			originalName:          "picture.jpeg",
-			srcImage:              image.NewRGBA(image.Rect(0, 0, 500, 300)),
-			expectedName:          "picture.jpeg",
-			expectedImagePath:     "uploads/recipes/42/images/picture.jpeg",
-			expectedThumbnailPath: "uploads/recipes/42/thumbs/picture.jpeg",
-			expectedURL:           "/uploads/recipes/42/images/picture.jpeg",
-			expectedThumbnailURL:  "/uploads/recipes/42/thumbs/picture.jpeg",
-			expectedSaveError:     nil,
+			recipeID:         42,
+			ext:              ".jpeg",
+			srcImage:         image.NewRGBA(image.Rect(0, 0, 500, 300)),
+			expectedOriginal: true,
+			expectedSize:     image.Pt(500, 300),
 		},
 		{
 			caseName: "High Quality",
@@ -58,15 +143,10 @@ func Test_Save(t *testing.T) {
 				ThumbnailQuality: models.ImageQualityMedium,
 				ThumbnailSize:    50,
 			},
-			recipeID:              42,
-			originalName:          "picture.jpeg",
-			srcImage:              image.NewRGBA(image.Rect(0, 0, 500, 300)),
-			expectedName:          "picture.jpeg",
-			expectedImagePath:     "uploads/recipes/42/images/picture.jpeg",
-			expectedThumbnailPath: "uploads/recipes/42/thumbs/picture.jpeg",
-			expectedURL:           "/uploads/recipes/42/images/picture.jpeg",
-			expectedThumbnailURL:  "/uploads/recipes/42/thumbs/picture.jpeg",
-			expectedSaveError:     nil,
+			recipeID:     42,
+			ext:          ".jpeg",
+			srcImage:     image.NewRGBA(image.Rect(0, 0, 500, 300)),
+			expectedSize: image.Pt(200, 120),
 		},
 		{
 			caseName: "PNG Input",
@@ -76,33 +156,10 @@ func Test_Save(t *testing.T) {
 				ThumbnailQuality: models.ImageQualityMedium,
 				ThumbnailSize:    50,
 			},
-			recipeID:              42,
-			originalName:          "picture.png",
-			srcImage:              image.NewRGBA(image.Rect(0, 0, 500, 300)),
-			expectedName:          "picture.jpeg",
-			expectedImagePath:     "uploads/recipes/42/images/picture.jpeg",
-			expectedThumbnailPath: "uploads/recipes/42/thumbs/picture.jpeg",
-			expectedURL:           "/uploads/recipes/42/images/picture.jpeg",
-			expectedThumbnailURL:  "/uploads/recipes/42/thumbs/picture.jpeg",
-			expectedSaveError:     nil,
-		},
-		{
-			caseName: "JPG File Extension",
-			cfg: ImageConfig{
-				ImageQuality:     models.ImageQualityOriginal,
-				ImageSize:        200,
-				ThumbnailQuality: models.ImageQualityMedium,
-				ThumbnailSize:    50,
-			},
-			recipeID:              42,
-			originalName:          "picture.jpg",
-			srcImage:              image.NewRGBA(image.Rect(0, 0, 500, 300)),
-			expectedName:          "picture.jpg",
-			expectedImagePath:     "uploads/recipes/42/images/picture.jpg",
-			expectedThumbnailPath: "uploads/recipes/42/thumbs/picture.jpg",
-			expectedURL:           "/uploads/recipes/42/images/picture.jpg",
-			expectedThumbnailURL:  "/uploads/recipes/42/thumbs/picture.jpg",
-			expectedSaveError:     nil,
+			recipeID:     42,
+			ext:          ".png",
+			srcImage:     image.NewRGBA(image.Rect(0, 0, 500, 300)),
+			expectedSize: image.Pt(500, 300),
 		},
 		{
 			caseName: "Invalid Image",
@@ -113,7 +170,6 @@ func Test_Save(t *testing.T) {
 				ThumbnailSize:    50,
 			},
 			recipeID:          42,
-			originalName:      "picture.jpg",
 			srcImage:          nil,
 			expectedSaveError: ErrInvalidContentType,
 		},
@@ -121,39 +177,24 @@ func Test_Save(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.caseName, func(t *testing.T) {
 			// Arrange
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			drv := fileaccessmock.NewMockDriver(ctrl)
-			if test.expectedSaveError == nil {
-				drv.EXPECT().Save(test.expectedImagePath, gomock.Any()).Return(nil).Times(1)
-				drv.EXPECT().Save(test.expectedThumbnailPath, gomock.Any()).Return(nil).Times(1)
-			}
-
-			uploader, err := CreateImageUploader(drv, test.cfg)
+			drv := newTestFileSystemDriver(t, nil)
+			refs := newTestImageReferences(nil)
+			uploader, err := CreateImageUploader(drv, refs, test.cfg)
 			if err != nil {
 				t.Fatalf("CreateImageUploader: %v", err)
 			}
 
 			var data []byte
 			if test.srcImage != nil {
-				// Create a simple image in memory
-				buf := new(bytes.Buffer)
-				switch filepath.Ext(test.originalName) {
-				case ".png":
-					err = png.Encode(buf, test.srcImage)
-				default:
-					err = jpeg.Encode(buf, test.srcImage, &jpeg.Options{Quality: 85})
-				}
-				if err != nil {
-					t.Fatalf("failed to encode image: %v", err)
-				}
-				data = buf.Bytes()
+				data = encodeTestImage(t, test.srcImage, test.ext)
 			} else {
 				data = []byte("this is not an image")
 			}
 
-			res, err := uploader.Save(test.recipeID, test.originalName, data)
+			// Act
+			res, err := uploader.Save(t.Context(), test.recipeID, data)
+
+			// Assert
 			if !errors.Is(err, test.expectedSaveError) {
 				t.Fatalf("expected error: %v, received error: %v", test.expectedSaveError, err)
 			}
@@ -161,86 +202,506 @@ func Test_Save(t *testing.T) {
 				return
 			}
 
-			if res.Name != test.expectedName {
-				t.Fatalf("unexpected saved name: %s", res.Name)
+			// The image is named by the content that was saved
+			content, err := fs.ReadFile(drv, "uploads/content/images/"+res.Name)
+			if err != nil {
+				t.Fatalf("failed to read saved image: %v", err)
+			}
+			if expected := getContentName(content, ".jpeg"); res.Name != expected {
+				t.Errorf("expected name: %s, received name: %s", expected, res.Name)
+			}
+			if bytes.Equal(content, data) != test.expectedOriginal {
+				t.Errorf("expected original to be saved as-is: %v", test.expectedOriginal)
+			}
+			if cfg, _, err := image.DecodeConfig(bytes.NewReader(content)); err != nil || image.Pt(cfg.Width, cfg.Height) != test.expectedSize {
+				t.Errorf("expected saved image of size %v, received %dx%d: %v", test.expectedSize, cfg.Width, cfg.Height, err)
+			}
+			if actual := image.Pt(res.Width, res.Height); actual != test.expectedSize {
+				t.Errorf("expected reported size %v, received %v", test.expectedSize, actual)
+			}
+			if _, err := drv.Stat("uploads/content/thumbs/" + res.Name); err != nil {
+				t.Errorf("expected thumbnail to be saved: %v", err)
+			}
+			if actual := refs.recipeIDs[res.Name]; !slices.Equal(actual, []int64{42}) {
+				t.Errorf("unexpected references: %v", actual)
+			}
+			if isRef, err := isImageReference(drv, 42, res.Name); err != nil || !isRef {
+				t.Errorf("expected image reference to be saved: %v", err)
+			}
+			if len(refs.locked) > 0 {
+				t.Errorf("expected all locks to be released, received %v", refs.locked)
 			}
 
-			// Check URLs are what saveImage constructs (note driver prepends root)
-			if res.URL != test.expectedURL {
-				t.Fatalf("unexpected image url: %s != %s", res.URL, test.expectedURL)
+			// Check URLs are for the recipe, which resolve to the content
+			if expected := "/uploads/recipes/42/images/" + res.Name; res.URL != expected {
+				t.Errorf("unexpected image url: %s != %s", res.URL, expected)
 			}
-			if res.ThumbnailURL != test.expectedThumbnailURL {
-				t.Fatalf("unexpected thumbnail url: %s != %s", res.ThumbnailURL, test.expectedThumbnailURL)
+			if expected := "/uploads/recipes/42/thumbs/" + res.Name; res.ThumbnailURL != expected {
+				t.Errorf("unexpected thumbnail url: %s != %s", res.ThumbnailURL, expected)
+			}
+			loaded, err := uploader.Load(test.recipeID, res.Name)
+			if err != nil || !bytes.Equal(loaded, content) {
+				t.Errorf("expected to load the saved image: %v", err)
 			}
 		})
 	}
 }
 
-func Test_Delete(t *testing.T) {
+func Test_Save_Deduplicates(t *testing.T) {
+	// Arrange
+	drv := newTestFileSystemDriver(t, nil)
+	refs := newTestImageReferences(nil)
+	uploader := newTestImageUploader(t, drv, refs)
+	data := encodeTestImage(t, image.NewRGBA(image.Rect(0, 0, 100, 100)), ".jpeg")
+
+	// Act
+	first, err := uploader.Save(t.Context(), 1, data)
+	if err != nil {
+		t.Fatalf("failed to save first image: %v", err)
+	}
+	second, err := uploader.Save(t.Context(), 2, data)
+	if err != nil {
+		t.Fatalf("failed to save second image: %v", err)
+	}
+	again, err := uploader.Save(t.Context(), 2, data)
+	if err != nil {
+		t.Fatalf("failed to save image again: %v", err)
+	}
+
+	// Assert
+	if first.Name != second.Name || second.Name != again.Name {
+		t.Errorf("expected the same name, received %s, %s and %s", first.Name, second.Name, again.Name)
+	}
+	entries, err := drv.List("uploads/content/images")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected the image to be stored once, received %v, %v", entries, err)
+	}
+	if actual := refs.recipeIDs[first.Name]; !slices.Equal(actual, []int64{1, 2}) {
+		t.Errorf("unexpected references: %v", actual)
+	}
+}
+
+func Test_Save_Orientation(t *testing.T) {
 	type testArgs struct {
-		caseName              string
-		recipeID              int64
-		originalName          string
-		expectedName          string
-		expectedImagePath     string
-		expectedThumbnailPath string
-		expectedURL           string
-		expectedThumbnailURL  string
+		caseName         string
+		quality          models.ImageQualityLevel
+		expectedOriginal bool
 	}
 
 	// Arrange
+	// The left of the image is red, and the right is blue, such that the top is red once rotated
+	src := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	draw.Draw(src, image.Rect(0, 0, 150, 100), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(150, 0, 300, 100), image.NewUniform(color.RGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+	data := addTestJPEGMetadata(t, encodeTestImage(t, src, ".jpeg"), exifOrientationRotate90, binary.BigEndian)
 	tests := []testArgs{
-		{
-			caseName:              "Nominal Case",
-			recipeID:              42,
-			originalName:          "picture.jpeg",
-			expectedImagePath:     "uploads/recipes/42/images/picture.jpeg",
-			expectedThumbnailPath: "uploads/recipes/42/thumbs/picture.jpeg",
-		},
+		{"Original Quality", models.ImageQualityOriginal, true},
+		{"High Quality", models.ImageQualityHigh, false},
 	}
 	for _, test := range tests {
 		t.Run(test.caseName, func(t *testing.T) {
-			// Arrange
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			drv := fileaccessmock.NewMockDriver(ctrl)
-			// Delete should remove both files
-			drv.EXPECT().Delete(test.expectedImagePath).Return(nil).Times(1)
-			drv.EXPECT().Delete(test.expectedThumbnailPath).Return(nil).Times(1)
-
-			imgCfg := ImageConfig{
-				ImageQuality:     models.ImageQualityOriginal,
+			drv := newTestFileSystemDriver(t, nil)
+			uploader, err := CreateImageUploader(drv, newTestImageReferences(nil), ImageConfig{
+				ImageQuality:     test.quality,
 				ImageSize:        200,
 				ThumbnailQuality: models.ImageQualityMedium,
 				ThumbnailSize:    50,
+				VariantWidths:    []int{20},
+				VariantFormats:   []string{ImageFormatJPEG},
+			})
+			if err != nil {
+				t.Fatalf("CreateImageUploader: %v", err)
 			}
 
-			uploader, err := CreateImageUploader(drv, imgCfg)
+			// Act
+			res, err := uploader.Save(t.Context(), 1, data)
+
+			// Assert
 			if err != nil {
-				t.Fatalf("CreateImageUploader: %v", err)
+				t.Fatalf("failed to save image: %v", err)
+			}
+			content, err := fs.ReadFile(drv, "uploads/content/images/"+res.Name)
+			if err != nil {
+				t.Fatalf("failed to read saved image: %v", err)
+			}
+			for _, secret := range []string{testSecretMake, "secret comment", "trailing secret"} {
+				if bytes.Contains(content, []byte(secret)) {
+					t.Errorf("expected %q to be stripped", secret)
+				}
+			}
+
+			// The original isn't rotated itself, but still records how it is meant to be
+			saved, _, err := image.Decode(bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("failed to decode saved image: %v", err)
+			}
+			if test.expectedOriginal {
+				if orientation := readJPEGOrientation(content); orientation != exifOrientationRotate90 {
+					t.Errorf("expected orientation to be kept, received %d", orientation)
+				}
+				saved = applyOrientation(saved, readJPEGOrientation(content))
 			}
 
-			if err := uploader.Delete(test.recipeID, test.originalName); err != nil {
-				t.Fatalf("Delete returned error: %v", err)
+			for _, filePath := range []string{
+				"uploads/content/thumbs/" + res.Name,
+				"uploads/content/variants/" + res.Name + "/20.jpeg",
+			} {
+				fileData, err := fs.ReadFile(drv, filePath)
+				if err != nil {
+					t.Fatalf("failed to read %s: %v", filePath, err)
+				}
+				img, _, err := image.Decode(bytes.NewReader(fileData))
+				if err != nil {
+					t.Fatalf("failed to decode %s: %v", filePath, err)
+				}
+				checkTestImageRotated(t, filePath, img)
+			}
+			checkTestImageRotated(t, "image", saved)
+		})
+	}
+}
+
+func checkTestImageRotated(t *testing.T, name string, img image.Image) {
+	t.Helper()
+
+	bounds := img.Bounds()
+	if bounds.Dx() > bounds.Dy() {
+		t.Errorf("%s: expected to be rotated to portrait, received %v", name, bounds)
+	}
+	top, _, _, _ := img.At(bounds.Min.X+bounds.Dx()/2, bounds.Min.Y+1).RGBA()
+	bottom, _, _, _ := img.At(bounds.Min.X+bounds.Dx()/2, bounds.Max.Y-2).RGBA()
+	if top < 0x8000 || bottom > 0x8000 {
+		t.Errorf("%s: expected red at the top only, received %x and %x", name, top, bottom)
+	}
+}
+
+func Test_Save_Variants(t *testing.T) {
+	// Arrange
+	drv := newTestFileSystemDriver(t, nil)
+	uploader, err := CreateImageUploader(drv, newTestImageReferences(nil), ImageConfig{
+		ImageQuality:     models.ImageQualityHigh,
+		ImageSize:        200,
+		ThumbnailQuality: models.ImageQualityMedium,
+		ThumbnailSize:    50,
+		VariantWidths:    []int{640, 100, 20, 100},
+		VariantFormats:   []string{ImageFormatWebP, ImageFormatJPEG},
+	})
+	if err != nil {
+		t.Fatalf("CreateImageUploader: %v", err)
+	}
+	data := encodeTestImage(t, image.NewRGBA(image.Rect(0, 0, 400, 300)), ".png")
+
+	// Act
+	res, err := uploader.Save(t.Context(), 1, data)
+	if err != nil {
+		t.Fatalf("failed to save image: %v", err)
+	}
+	variants, err := uploader.ListVariants(1, res.Name)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("failed to list variants: %v", err)
+	}
+	// The saved image is only 200 pixels wide, so there is no 640 pixel wide variant
+	expected := []models.ImageVariant{
+		{URL: "/uploads/recipes/1/variants/" + res.Name + "/20.jpeg", Width: 20, Type: "image/jpeg"},
+		{URL: "/uploads/recipes/1/variants/" + res.Name + "/100.jpeg", Width: 100, Type: "image/jpeg"},
+		{URL: "/uploads/recipes/1/variants/" + res.Name + "/20.webp", Width: 20, Type: "image/webp"},
+		{URL: "/uploads/recipes/1/variants/" + res.Name + "/100.webp", Width: 100, Type: "image/webp"},
+	}
+	if !reflect.DeepEqual(variants, expected) {
+		t.Errorf("expected variants: %v, received: %v", expected, variants)
+	}
+	for _, variant := range variants {
+		data, err := fs.ReadFile(contentFS{drv}, variant.URL[1:])
+		if err != nil {
+			t.Fatalf("failed to read variant %s: %v", variant.URL, err)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed to decode variant %s: %v", variant.URL, err)
+		}
+		if cfg.Width != variant.Width || cfg.Height != variant.Width*3/4 || "image/"+format != variant.Type {
+			t.Errorf("%s: unexpected %s image of %dx%d", variant.URL, format, cfg.Width, cfg.Height)
+		}
+	}
+}
+
+func Test_ListVariants(t *testing.T) {
+	type testArgs struct {
+		caseName      string
+		files         map[string]string
+		expected      []models.ImageVariant
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			caseName: "Content",
+			files: map[string]string{
+				"uploads/recipes/1/refs/a.jpeg":              "",
+				"uploads/content/images/a.jpeg":              "image",
+				"uploads/content/variants/a.jpeg/640.webp":   "variant",
+				"uploads/content/variants/a.jpeg/320.webp":   "variant",
+				"uploads/content/variants/a.jpeg/320.jpeg":   "variant",
+				"uploads/content/variants/a.jpeg/unexpected": "other",
+			},
+			expected: []models.ImageVariant{
+				{URL: "/uploads/recipes/1/variants/a.jpeg/320.jpeg", Width: 320, Type: "image/jpeg"},
+				{URL: "/uploads/recipes/1/variants/a.jpeg/320.webp", Width: 320, Type: "image/webp"},
+				{URL: "/uploads/recipes/1/variants/a.jpeg/640.webp", Width: 640, Type: "image/webp"},
+			},
+		},
+		{
+			caseName: "No Variants",
+			files: map[string]string{
+				"uploads/recipes/1/refs/a.jpeg": "",
+				"uploads/content/images/a.jpeg": "image",
+			},
+			expected: []models.ImageVariant{},
+		},
+		{
+			caseName: "Stored in Recipe",
+			files: map[string]string{
+				"uploads/recipes/1/images/a.jpeg": "image",
+			},
+			expected: []models.ImageVariant{},
+		},
+		{
+			caseName: "Legacy Empty Image",
+			files: map[string]string{
+				"uploads/recipes/1/images/a.jpeg": "",
+			},
+			expected: []models.ImageVariant{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.caseName, func(t *testing.T) {
+			uploader := newTestImageUploader(t, newTestFileSystemDriver(t, test.files), nil)
+
+			// Act
+			variants, err := uploader.ListVariants(1, "a.jpeg")
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if !reflect.DeepEqual(variants, test.expected) {
+				t.Errorf("expected variants: %v, received: %v", test.expected, variants)
+			}
+		})
+	}
+}
+
+func Test_ListImages(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	drv := fileaccessmock.NewMockDriver(ctrl)
+	// The references are listed once, rather than checked for each image
+	drv.EXPECT().List("uploads/recipes/1/images").Return([]fs.DirEntry{testDirEntry{name: "a.jpeg"}}, nil)
+	drv.EXPECT().List("uploads/recipes/1/refs").Return([]fs.DirEntry{testDirEntry{name: "0123.jpeg"}}, nil)
+	drv.EXPECT().List("uploads/content/variants/0123.jpeg").Return([]fs.DirEntry{
+		testDirEntry{name: "640.jpeg"},
+		testDirEntry{name: "320.jpeg"},
+	}, nil)
+	uploader := newTestImageUploader(t, drv, nil)
+
+	// Act
+	images, err := uploader.ListImages(1)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []models.RecipeImage{
+		{
+			Name:         "a.jpeg",
+			URL:          "/uploads/recipes/1/images/a.jpeg",
+			ThumbnailURL: "/uploads/recipes/1/thumbs/a.jpeg",
+			Variants:     []models.ImageVariant{},
+		},
+		{
+			Name:         "0123.jpeg",
+			URL:          "/uploads/recipes/1/images/0123.jpeg",
+			ThumbnailURL: "/uploads/recipes/1/thumbs/0123.jpeg",
+			Variants: []models.ImageVariant{
+				{URL: "/uploads/recipes/1/variants/0123.jpeg/320.jpeg", Width: 320, Type: "image/jpeg"},
+				{URL: "/uploads/recipes/1/variants/0123.jpeg/640.jpeg", Width: 640, Type: "image/jpeg"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected images: %v, received: %v", expected, images)
+	}
+}
+
+func Test_Delete(t *testing.T) {
+	const name = "0123.jpeg"
+	type testArgs struct {
+		caseName      string
+		files         map[string]string
+		refs          map[string][]int64
+		expectedError error
+		expectedFiles map[string]string
+		expectedRefs  map[string][]int64
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			caseName: "Referenced by Other Recipes",
+			files: map[string]string{
+				"uploads/recipes/42/refs/" + name: "",
+				"uploads/recipes/43/refs/" + name: "",
+				"uploads/content/images/" + name:  "image",
+				"uploads/content/thumbs/" + name:  "thumb",
+			},
+			refs: map[string][]int64{name: {42, 43}},
+			expectedFiles: map[string]string{
+				"uploads/recipes/43/refs/" + name: "",
+				"uploads/content/images/" + name:  "image",
+				"uploads/content/thumbs/" + name:  "thumb",
+			},
+			expectedRefs: map[string][]int64{name: {43}},
+		},
+		{
+			caseName: "Last Reference",
+			files: map[string]string{
+				"uploads/recipes/42/refs/" + name:                "",
+				"uploads/content/images/" + name:                 "image",
+				"uploads/content/thumbs/" + name:                 "thumb",
+				"uploads/content/variants/" + name + "/320.webp": "variant",
+			},
+			refs: map[string][]int64{name: {42}},
+			expectedFiles: map[string]string{
+				"uploads/content/images/" + name:                 "",
+				"uploads/content/thumbs/" + name:                 "",
+				"uploads/content/variants/" + name + "/320.webp": "",
+			},
+			expectedRefs: map[string][]int64{},
+		},
+		{
+			caseName: "Stored in Recipe",
+			files: map[string]string{
+				"uploads/recipes/42/images/" + name: "image",
+				"uploads/recipes/42/thumbs/" + name: "thumb",
+			},
+			expectedFiles: map[string]string{
+				"uploads/recipes/42/images/" + name: "",
+				"uploads/recipes/42/thumbs/" + name: "",
+			},
+			expectedRefs: map[string][]int64{},
+		},
+		{
+			// An empty image, e.g., one that was truncated, isn't mistaken for a reference
+			caseName: "Empty Image Stored in Recipe",
+			files: map[string]string{
+				"uploads/recipes/42/images/" + name: "",
+				"uploads/recipes/42/thumbs/" + name: "thumb",
+				"uploads/content/images/" + name:    "image",
+			},
+			refs: map[string][]int64{name: {43}},
+			expectedFiles: map[string]string{
+				"uploads/recipes/42/thumbs/" + name: "",
+				"uploads/content/images/" + name:    "image",
+			},
+			expectedRefs: map[string][]int64{name: {43}},
+		},
+		{
+			caseName:      "Not Found",
+			expectedError: fs.ErrNotExist,
+			expectedRefs:  map[string][]int64{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.caseName, func(t *testing.T) {
+			drv := newTestFileSystemDriver(t, test.files)
+			refs := newTestImageReferences(test.refs)
+			uploader := newTestImageUploader(t, drv, refs)
+
+			// Act
+			err := uploader.Delete(t.Context(), 42, name)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			for _, dirPath := range []string{"uploads/recipes/42/images/", "uploads/recipes/42/refs/"} {
+				if _, err := drv.Stat(dirPath + name); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("expected %s to be deleted, received %v", dirPath+name, err)
+				}
+			}
+			for filePath, expected := range test.expectedFiles {
+				if actual := readTestFile(t, drv, filePath); actual != expected {
+					t.Errorf("%s: expected content: %q, received content: %q", filePath, expected, actual)
+				}
+			}
+			if !reflect.DeepEqual(refs.recipeIDs, test.expectedRefs) {
+				t.Errorf("expected references: %v, received: %v", test.expectedRefs, refs.recipeIDs)
 			}
 		})
 	}
 }
 
 func Test_DeleteAll(t *testing.T) {
+	// Arrange
+	drv := newTestFileSystemDriver(t, map[string]string{
+		"uploads/recipes/42/refs/shared.jpeg":   "",
+		"uploads/recipes/42/refs/only.jpeg":     "",
+		"uploads/recipes/42/images/legacy.jpeg": "legacy",
+		"uploads/recipes/42/thumbs/legacy.jpeg": "legacy thumb",
+		"uploads/recipes/43/refs/shared.jpeg":   "",
+		"uploads/content/images/shared.jpeg":    "shared",
+		"uploads/content/images/only.jpeg":      "only",
+	})
+	refs := newTestImageReferences(map[string][]int64{
+		"shared.jpeg": {42, 43},
+		"only.jpeg":   {42},
+	})
+	uploader := newTestImageUploader(t, drv, refs)
+
+	// Act
+	err := uploader.DeleteAll(t.Context(), 42)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("DeleteAll returned error: %v", err)
+	}
+	if _, err := drv.Stat("uploads/recipes/42"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected recipe directory to be deleted, received %v", err)
+	}
+	for filePath, expected := range map[string]string{
+		"uploads/content/images/shared.jpeg": "shared",
+		"uploads/content/images/only.jpeg":   "",
+	} {
+		if actual := readTestFile(t, drv, filePath); actual != expected {
+			t.Errorf("%s: expected content: %q, received content: %q", filePath, expected, actual)
+		}
+	}
+	if expected := map[string][]int64{"shared.jpeg": {43}}; !reflect.DeepEqual(refs.recipeIDs, expected) {
+		t.Errorf("expected references: %v, received: %v", expected, refs.recipeIDs)
+	}
+}
+
+func Test_CopyAll(t *testing.T) {
 	type testArgs struct {
-		caseName        string
-		recipeID        int64
-		expectedDirPath string
+		caseName       string
+		saveErr        error
+		expectedCopied map[string]string
+		expectError    bool
 	}
 
 	// Arrange
 	tests := []testArgs{
 		{
-			caseName:        "Nominal Case",
-			recipeID:        42,
-			expectedDirPath: "uploads/recipes/42",
+			caseName:       "Conflicting names are renamed",
+			expectedCopied: map[string]string{"a.jpeg": "1-a.jpeg", "b.jpeg": "b.jpeg"},
+		},
+		{
+			caseName:    "Copied images removed on failure",
+			saveErr:     errors.New("disk full"),
+			expectError: true,
 		},
 	}
 	for _, test := range tests {
@@ -249,34 +710,88 @@ func Test_DeleteAll(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			drv := fileaccessmock.NewMockDriver(ctrl)
-			// Delete all should remove the entire directory
-			drv.EXPECT().DeleteAll(test.expectedDirPath).Return(nil).Times(1)
+			files := fstest.MapFS{"file": {Data: []byte("image")}}
+			openFile := func(string) (fs.File, error) { return files.Open("file") }
 
-			imgCfg := ImageConfig{
-				ImageQuality:     models.ImageQualityOriginal,
-				ImageSize:        200,
-				ThumbnailQuality: models.ImageQualityMedium,
-				ThumbnailSize:    50,
+			drv := fileaccessmock.NewMockDriver(ctrl)
+			drv.EXPECT().List("uploads/recipes/1/images").Return([]fs.DirEntry{
+				testDirEntry{name: "a.jpeg"},
+				testDirEntry{name: "b.jpeg"},
+			}, nil)
+			drv.EXPECT().List("uploads/recipes/1/refs").Return(nil, fs.ErrNotExist)
+			drv.EXPECT().List("uploads/recipes/2/images").Return([]fs.DirEntry{testDirEntry{name: "a.jpeg"}}, nil)
+			drv.EXPECT().List("uploads/recipes/2/refs").Return(nil, fs.ErrNotExist)
+			drv.EXPECT().Open("uploads/recipes/1/images/a.jpeg").DoAndReturn(openFile)
+			drv.EXPECT().Save("uploads/recipes/2/images/1-a.jpeg", gomock.Any()).Return(nil)
+			drv.EXPECT().Open("uploads/recipes/1/thumbs/a.jpeg").DoAndReturn(openFile)
+			drv.EXPECT().Save("uploads/recipes/2/thumbs/1-a.jpeg", gomock.Any()).Return(nil)
+			drv.EXPECT().Open("uploads/recipes/1/images/b.jpeg").DoAndReturn(openFile)
+			drv.EXPECT().Save("uploads/recipes/2/images/b.jpeg", gomock.Any()).Return(test.saveErr)
+			if test.saveErr == nil {
+				// A missing thumbnail isn't an error
+				drv.EXPECT().Open("uploads/recipes/1/thumbs/b.jpeg").Return(nil, fs.ErrNotExist)
+			} else {
+				drv.EXPECT().Stat("uploads/recipes/2/refs/1-a.jpeg").Return(nil, fs.ErrNotExist)
+				drv.EXPECT().Delete("uploads/recipes/2/images/1-a.jpeg").Return(nil)
+				drv.EXPECT().Delete("uploads/recipes/2/thumbs/1-a.jpeg").Return(nil)
 			}
 
-			uploader, err := CreateImageUploader(drv, imgCfg)
-			if err != nil {
-				t.Fatalf("CreateImageUploader: %v", err)
-			}
+			uploader := newTestImageUploader(t, drv, nil)
+
+			// Act
+			copied, err := uploader.CopyAll(t.Context(), 1, 2)
 
-			if err := uploader.DeleteAll(test.recipeID); err != nil {
-				t.Fatalf("Delete returned error: %v", err)
+			// Assert
+			if (err != nil) != test.expectError {
+				t.Fatalf("unexpected error state: %v", err)
+			}
+			if !reflect.DeepEqual(copied, test.expectedCopied) {
+				t.Errorf("expected %v, got %v", test.expectedCopied, copied)
 			}
 		})
 	}
 }
 
+func Test_CopyAll_References(t *testing.T) {
+	// Arrange
+	drv := newTestFileSystemDriver(t, map[string]string{
+		"uploads/recipes/1/refs/shared.jpeg": "",
+		"uploads/recipes/1/refs/new.jpeg":    "",
+		"uploads/recipes/2/refs/shared.jpeg": "",
+		"uploads/content/images/shared.jpeg": "shared",
+		"uploads/content/images/new.jpeg":    "new",
+	})
+	refs := newTestImageReferences(map[string][]int64{
+		"shared.jpeg": {1, 2},
+		"new.jpeg":    {1},
+	})
+	uploader := newTestImageUploader(t, drv, refs)
+
+	// Act
+	copied, err := uploader.CopyAll(t.Context(), 1, 2)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("CopyAll returned error: %v", err)
+	}
+	if expected := map[string]string{"new.jpeg": "new.jpeg"}; !reflect.DeepEqual(copied, expected) {
+		t.Errorf("expected %v, got %v", expected, copied)
+	}
+	if expected := map[string][]int64{"shared.jpeg": {1, 2}, "new.jpeg": {1, 2}}; !reflect.DeepEqual(refs.recipeIDs, expected) {
+		t.Errorf("expected references: %v, received: %v", expected, refs.recipeIDs)
+	}
+	loaded, err := uploader.Load(2, "new.jpeg")
+	if err != nil || string(loaded) != "new" {
+		t.Errorf("expected to load the copied image, received %q, %v", loaded, err)
+	}
+}
+
 func Test_List(t *testing.T) {
 	tests := []struct {
 		name        string
 		recipeID    int64
 		entries     []fs.DirEntry
+		refEntries  []fs.DirEntry
 		listErr     error
 		expectError bool
 		expected    []string
@@ -303,6 +818,17 @@ func Test_List(t *testing.T) {
 			},
 			expected: []string{"a.jpeg", "b.png"},
 		},
+		{
+			name:     "With References",
+			recipeID: 42,
+			entries: []fs.DirEntry{
+				testDirEntry{name: "a.jpeg", dir: false},
+			},
+			refEntries: []fs.DirEntry{
+				testDirEntry{name: "0123.jpeg", dir: false},
+			},
+			expected: []string{"a.jpeg", "0123.jpeg"},
+		},
 		{name: "Error", recipeID: 7, listErr: errors.New("driver failure"), expectError: true},
 		{name: "Not Found", recipeID: 7, listErr: fs.ErrNotExist, expectError: false, expected: []string{}},
 	}
@@ -321,6 +847,9 @@ func Test_List(t *testing.T) {
 			} else {
 				drv.EXPECT().List(dirPath).Return(tt.entries, nil).Times(1)
 			}
+			if !tt.expectError {
+				drv.EXPECT().List(getDirPathForReferences(tt.recipeID)).Return(tt.refEntries, nil).Times(1)
+			}
 
 			imgCfg := ImageConfig{
 				ImageQuality:     models.ImageQualityOriginal,
@@ -328,7 +857,7 @@ func Test_List(t *testing.T) {
 				ThumbnailQuality: models.ImageQualityMedium,
 				ThumbnailSize:    50,
 			}
-			uploader, err := CreateImageUploader(drv, imgCfg)
+			uploader, err := CreateImageUploader(drv, newTestImageReferences(nil), imgCfg)
 			if err != nil {
 				t.Fatalf("CreateImageUploader: %v", err)
 			}
@@ -359,6 +888,326 @@ func Test_List(t *testing.T) {
 	}
 }
 
+func Test_ListRecipeIDs(t *testing.T) {
+	type testArgs struct {
+		name     string
+		files    map[string]string
+		expected []int64
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"No Uploads", nil, []int64{}},
+		{
+			"With Recipes",
+			map[string]string{
+				"uploads/recipes/10/images/a.jpeg": "a",
+				"uploads/recipes/2/images/b.jpeg":  "b",
+				"uploads/recipes/other/c.jpeg":     "c",
+				"uploads/recipes/3":                "not a directory",
+				"uploads/content/images/d.jpeg":    "d",
+			},
+			[]int64{2, 10},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uploader := newTestImageUploader(t, newTestFileSystemDriver(t, test.files), nil)
+
+			// Act
+			actual, err := uploader.ListRecipeIDs()
+
+			// Assert
+			if err != nil {
+				t.Fatalf("ListRecipeIDs returned error: %v", err)
+			}
+			if !slices.Equal(actual, test.expected) {
+				t.Errorf("expected: %v, received: %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_ListRecipeIDs_Error(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	drv := fileaccessmock.NewMockDriver(ctrl)
+	testErr := errors.New("driver failure")
+	drv.EXPECT().Open(filepath.Join(UploadDirectoryName, "recipes")).Return(nil, testErr)
+	uploader := newTestImageUploader(t, drv, nil)
+
+	// Act
+	_, err := uploader.ListRecipeIDs()
+
+	// Assert
+	if !errors.Is(err, testErr) {
+		t.Errorf("expected wrapped error: %v, received: %v", testErr, err)
+	}
+}
+
+func Test_HasThumbnail(t *testing.T) {
+	type testArgs struct {
+		name      string
+		imageName string
+		expected  bool
+	}
+
+	// Arrange
+	drv := newTestFileSystemDriver(t, map[string]string{
+		"uploads/recipes/42/images/legacy.jpeg": "legacy",
+		"uploads/recipes/42/thumbs/legacy.jpeg": "legacy thumb",
+		"uploads/recipes/42/refs/shared.jpeg":   "",
+		"uploads/content/images/shared.jpeg":    "shared",
+		"uploads/content/thumbs/shared.jpeg":    "shared thumb",
+		"uploads/recipes/42/refs/nothumb.jpeg":  "",
+		"uploads/content/images/nothumb.jpeg":   "no thumb",
+		"uploads/recipes/42/images/lost.jpeg":   "lost",
+	})
+	uploader := newTestImageUploader(t, drv, nil)
+
+	tests := []testArgs{
+		{"Legacy", "legacy.jpeg", true},
+		{"Content", "shared.jpeg", true},
+		{"Content Missing Thumbnail", "nothumb.jpeg", false},
+		{"Legacy Missing Thumbnail", "lost.jpeg", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Act
+			actual, err := uploader.HasThumbnail(42, test.imageName)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("HasThumbnail returned error: %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("expected: %v, received: %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_RegenerateThumbnail(t *testing.T) {
+	type testArgs struct {
+		name          string
+		imageName     string
+		imagePath     string
+		thumbPath     string
+		expectedError error
+	}
+
+	// Arrange
+	data := encodeTestImage(t, image.NewRGBA(image.Rect(0, 0, 100, 80)), ".jpeg")
+	tests := []testArgs{
+		{"Legacy", "legacy.jpeg", "uploads/recipes/42/images/legacy.jpeg", "uploads/recipes/42/thumbs/legacy.jpeg", nil},
+		{"Content", "shared.jpeg", "uploads/content/images/shared.jpeg", "uploads/content/thumbs/shared.jpeg", nil},
+		{"Not Found", "missing.jpeg", "", "", fs.ErrNotExist},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			drv := newTestFileSystemDriver(t, map[string]string{
+				"uploads/recipes/42/images/legacy.jpeg": string(data),
+				"uploads/recipes/42/refs/shared.jpeg":   "",
+				"uploads/content/images/shared.jpeg":    string(data),
+			})
+			refs := newTestImageReferences(map[string][]int64{"shared.jpeg": {42}})
+			uploader := newTestImageUploader(t, drv, refs)
+
+			// Act
+			err := uploader.RegenerateThumbnail(t.Context(), 42, test.imageName)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if test.expectedError != nil {
+				return
+			}
+			thumb, _, err := image.Decode(bytes.NewReader([]byte(readTestFile(t, drv, test.thumbPath))))
+			if err != nil {
+				t.Fatalf("failed to decode thumbnail: %v", err)
+			}
+			if size := thumb.Bounds().Size(); size != image.Pt(50, 50) {
+				t.Errorf("expected thumbnail size: 50x50, received: %v", size)
+			}
+			// The image itself is left as-is
+			if actual := readTestFile(t, drv, test.imagePath); actual != string(data) {
+				t.Errorf("expected %s to be unchanged", test.imagePath)
+			}
+			if len(refs.locked) > 0 {
+				t.Errorf("expected all locks to be released, received %v", refs.locked)
+			}
+		})
+	}
+}
+
+func Test_CheckContent(t *testing.T) {
+	// Arrange
+	drv := newTestFileSystemDriver(t, map[string]string{
+		"uploads/recipes/42/refs/ok.jpeg":                "",
+		"uploads/recipes/42/refs/unrecorded.jpeg":        "",
+		"uploads/recipes/42/refs/missing.jpeg":           "",
+		"uploads/recipes/42/images/legacy.jpeg":          "legacy",
+		"uploads/recipes/43/refs/ok.jpeg":                "",
+		"uploads/content/images/ok.jpeg":                 "ok",
+		"uploads/content/images/unrecorded.jpeg":         "unrecorded",
+		"uploads/content/images/unmarked.jpeg":           "unmarked",
+		"uploads/content/images/orphan.jpeg":             "orphan",
+		"uploads/content/thumbs/thumb.jpeg":              "thumb",
+		"uploads/content/variants/variant.jpeg/320.webp": "variant",
+	})
+	refs := newTestImageReferences(map[string][]int64{
+		"ok.jpeg":       {42, 43},
+		"unmarked.jpeg": {44},
+		"missing.jpeg":  {42},
+	})
+	uploader := newTestImageUploader(t, drv, refs)
+
+	// Act
+	result, err := uploader.CheckContent(t.Context())
+
+	// Assert
+	if err != nil {
+		t.Fatalf("CheckContent returned error: %v", err)
+	}
+	expected := &ContentCheckResult{
+		OrphanedContent: []string{"orphan.jpeg", "thumb.jpeg", "variant.jpeg"},
+		StaleReferences: []ContentReference{{42, "unrecorded.jpeg"}, {44, "unmarked.jpeg"}},
+		MissingContent:  []ContentReference{{42, "missing.jpeg"}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected: %+v, received: %+v", expected, result)
+	}
+}
+
+func Test_RepairReference(t *testing.T) {
+	const name = "0123.jpeg"
+	type testArgs struct {
+		caseName       string
+		files          map[string]string
+		refs           map[string][]int64
+		expectedMarked bool
+		expectedFiles  map[string]string
+		expectedRefs   map[string][]int64
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{
+			caseName: "Marked but not Recorded",
+			files: map[string]string{
+				"uploads/recipes/42/refs/" + name: "",
+				"uploads/content/images/" + name:  "image",
+			},
+			expectedMarked: true,
+			expectedFiles: map[string]string{
+				"uploads/content/images/" + name: "image",
+			},
+			expectedRefs: map[string][]int64{name: {42}},
+		},
+		{
+			caseName: "Recorded but not Marked",
+			files: map[string]string{
+				"uploads/recipes/43/refs/" + name: "",
+				"uploads/content/images/" + name:  "image",
+			},
+			refs: map[string][]int64{name: {42, 43}},
+			expectedFiles: map[string]string{
+				"uploads/content/images/" + name: "image",
+			},
+			expectedRefs: map[string][]int64{name: {43}},
+		},
+		{
+			caseName: "Last Recorded but not Marked",
+			files: map[string]string{
+				"uploads/content/images/" + name: "image",
+				"uploads/content/thumbs/" + name: "thumb",
+			},
+			refs: map[string][]int64{name: {42}},
+			expectedFiles: map[string]string{
+				"uploads/content/images/" + name: "",
+				"uploads/content/thumbs/" + name: "",
+			},
+			expectedRefs: map[string][]int64{},
+		},
+		{
+			caseName: "Missing Content",
+			files: map[string]string{
+				"uploads/recipes/42/refs/" + name: "",
+				"uploads/content/thumbs/" + name:  "thumb",
+			},
+			refs: map[string][]int64{name: {42}},
+			expectedFiles: map[string]string{
+				"uploads/content/thumbs/" + name: "",
+			},
+			expectedRefs: map[string][]int64{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.caseName, func(t *testing.T) {
+			drv := newTestFileSystemDriver(t, test.files)
+			refs := newTestImageReferences(test.refs)
+			uploader := newTestImageUploader(t, drv, refs)
+
+			// Act
+			err := uploader.RepairReference(t.Context(), 42, name)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("RepairReference returned error: %v", err)
+			}
+			isRef, err := isImageReference(drv, 42, name)
+			if err != nil || isRef != test.expectedMarked {
+				t.Errorf("expected marked: %v, received: %v, %v", test.expectedMarked, isRef, err)
+			}
+			for filePath, expected := range test.expectedFiles {
+				if actual := readTestFile(t, drv, filePath); actual != expected {
+					t.Errorf("%s: expected content: %q, received content: %q", filePath, expected, actual)
+				}
+			}
+			if !reflect.DeepEqual(refs.recipeIDs, test.expectedRefs) {
+				t.Errorf("expected references: %v, received: %v", test.expectedRefs, refs.recipeIDs)
+			}
+		})
+	}
+}
+
+func Test_DeleteContent(t *testing.T) {
+	const name = "0123.jpeg"
+	type testArgs struct {
+		caseName      string
+		refs          map[string][]int64
+		expectedImage string
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Unreferenced", nil, ""},
+		// e.g., a recipe started using it since it was checked
+		{"Referenced", map[string][]int64{name: {42}}, "image"},
+	}
+	for _, test := range tests {
+		t.Run(test.caseName, func(t *testing.T) {
+			drv := newTestFileSystemDriver(t, map[string]string{
+				"uploads/content/images/" + name:                 "image",
+				"uploads/content/variants/" + name + "/320.webp": "variant",
+			})
+			uploader := newTestImageUploader(t, drv, newTestImageReferences(test.refs))
+
+			// Act
+			err := uploader.DeleteContent(t.Context(), name)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("DeleteContent returned error: %v", err)
+			}
+			if actual := readTestFile(t, drv, "uploads/content/images/"+name); actual != test.expectedImage {
+				t.Errorf("expected image content: %q, received content: %q", test.expectedImage, actual)
+			}
+		})
+	}
+}
+
 func Test_fit(t *testing.T) {
 	type testArgs struct {
 		caseName string
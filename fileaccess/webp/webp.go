@@ -0,0 +1,796 @@
+// Package webp implements a lossy WebP encoder, i.e., a VP8 key frame in a RIFF container, as specified in RFC 6386.
+// It favors simplicity over compression: every macroblock is predicted as a whole, using the mode that best
+// matches the source, and the default token probabilities are used as-is.
+package webp
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"math/bits"
+
+	"golang.org/x/image/draw"
+)
+
+// maxSize is the largest width or height of a lossy WebP image
+const maxSize = 1<<14 - 1
+
+// ErrImageTooLarge indicates that the image cannot be encoded as a WebP image
+var ErrImageTooLarge = errors.New("image is too large to encode as webp")
+
+// The prediction modes, in the order they are numbered by the decoder
+const (
+	vp8PredDC = iota
+	vp8PredTM
+	vp8PredVE
+	vp8PredHE
+	vp8NumPredModes
+)
+
+// The token planes
+const (
+	vp8PlaneYAfterY2 = iota
+	vp8PlaneY2
+	vp8PlaneUV
+)
+
+// Encode writes the image to w as a lossy WebP image, using the specified quality (1-100)
+func Encode(w io.Writer, m image.Image, quality int) error {
+	data, err := newVP8Encoder(m, quality).encode()
+	if err != nil {
+		return err
+	}
+	return writeContainer(w, data)
+}
+
+// writeContainer writes the VP8 key frame to w in the RIFF container of a WebP image
+func writeContainer(w io.Writer, data []byte) error {
+	header := make([]byte, 20)
+	size := len(data) + len(data)%2
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(12+size))
+	copy(header[8:12], "WEBP")
+	copy(header[12:16], "VP8 ")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if len(data)%2 != 0 {
+		// Chunks are padded to an even size
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vp8NzContext records which blocks along an edge of a macroblock have non-zero coefficients
+type vp8NzContext struct {
+	y  [4]uint8
+	u  [2]uint8
+	v  [2]uint8
+	y2 uint8
+}
+
+// vp8Macroblock records what is written to the first partition for a macroblock
+type vp8Macroblock struct {
+	skip   bool
+	yMode  int
+	uvMode int
+}
+
+type vp8Encoder struct {
+	width, height int
+	mbw, mbh      int
+
+	// The source and reconstructed planes, padded to a whole number of macroblocks
+	srcY, srcU, srcV []uint8
+	recY, recU, recV []uint8
+	yStride, cStride int
+
+	qIndex      int
+	filterLevel int
+	y1, y2, uv  [2]int32
+
+	mbs    []vp8Macroblock
+	top    []vp8NzContext
+	left   vp8NzContext
+	tokens vp8BoolEncoder
+}
+
+func newVP8Encoder(m image.Image, quality int) *vp8Encoder {
+	qIndex := clampInt((100-quality)*127/100, 0, 127)
+	e := &vp8Encoder{
+		width:       m.Bounds().Dx(),
+		height:      m.Bounds().Dy(),
+		qIndex:      qIndex,
+		filterLevel: min(qIndex/3, 63),
+	}
+	e.mbw = (e.width + 15) / 16
+	e.mbh = (e.height + 15) / 16
+
+	// These are the same factors the decoder derives from the quantizer index (section 9.6)
+	e.y1 = [2]int32{int32(vp8DequantTableDC[qIndex]), int32(vp8DequantTableAC[qIndex])}
+	e.y2 = [2]int32{int32(vp8DequantTableDC[qIndex]) * 2, max(int32(vp8DequantTableAC[qIndex])*155/100, 8)}
+	e.uv = [2]int32{int32(vp8DequantTableDC[min(qIndex, 117)]), int32(vp8DequantTableAC[qIndex])}
+
+	if e.width > 0 && e.height > 0 {
+		e.importImage(m)
+	}
+	return e
+}
+
+// importImage converts the image to padded YUV 4:2:0 planes, in the studio range that VP8 decoders expect
+func (e *vp8Encoder) importImage(m image.Image) {
+	rgba, ok := m.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(image.Rect(0, 0, e.width, e.height))
+		draw.Draw(rgba, rgba.Bounds(), m, m.Bounds().Min, draw.Src)
+	}
+	bounds := rgba.Bounds()
+	pixel := func(x, y int) (r, g, b int) {
+		// Pad by repeating the last row and column
+		i := rgba.PixOffset(bounds.Min.X+min(x, e.width-1), bounds.Min.Y+min(y, e.height-1))
+		return int(rgba.Pix[i]), int(rgba.Pix[i+1]), int(rgba.Pix[i+2])
+	}
+
+	e.yStride = e.mbw * 16
+	e.cStride = e.mbw * 8
+	e.srcY = make([]uint8, e.yStride*e.mbh*16)
+	e.srcU = make([]uint8, e.cStride*e.mbh*8)
+	e.srcV = make([]uint8, e.cStride*e.mbh*8)
+	for y := 0; y < e.mbh*16; y++ {
+		for x := 0; x < e.mbw*16; x++ {
+			r, g, b := pixel(x, y)
+			e.srcY[y*e.yStride+x] = uint8((16839*r + 33059*g + 6420*b + 1<<15 + 16<<16) >> 16)
+		}
+	}
+	for y := 0; y < e.mbh*8; y++ {
+		for x := 0; x < e.mbw*8; x++ {
+			// Chroma is computed from the sum of each 2x2 block of pixels
+			var r, g, b int
+			for _, p := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := pixel(2*x+p[0], 2*y+p[1])
+				r, g, b = r+pr, g+pg, b+pb
+			}
+			e.srcU[y*e.cStride+x] = uint8(clampInt((-9719*r-19081*g+28800*b+1<<17+128<<18)>>18, 0, 255))
+			e.srcV[y*e.cStride+x] = uint8(clampInt((28800*r-24116*g-4684*b+1<<17+128<<18)>>18, 0, 255))
+		}
+	}
+	e.recY = make([]uint8, len(e.srcY))
+	e.recU = make([]uint8, len(e.srcU))
+	e.recV = make([]uint8, len(e.srcV))
+}
+
+// encode returns the VP8 key frame for the image
+func (e *vp8Encoder) encode() ([]byte, error) {
+	if e.width == 0 || e.height == 0 {
+		return nil, errors.New("image is empty")
+	}
+	if e.width > maxSize || e.height > maxSize {
+		return nil, ErrImageTooLarge
+	}
+
+	e.mbs = make([]vp8Macroblock, 0, e.mbw*e.mbh)
+	e.top = make([]vp8NzContext, e.mbw)
+	e.tokens = newVP8BoolEncoder()
+	for mby := 0; mby < e.mbh; mby++ {
+		e.left = vp8NzContext{}
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			e.mbs = append(e.mbs, e.encodeMacroblock(mbx, mby))
+		}
+	}
+	tokens := e.tokens.flush()
+	first := e.encodeFirstPartition()
+	if len(first) >= 1<<19 {
+		return nil, ErrImageTooLarge
+	}
+
+	// The frame header (section 9.1), as a shown key frame of version 0
+	frame := make([]byte, 10, 10+len(first)+len(tokens))
+	tag := uint32(1<<4) | uint32(len(first))<<5
+	frame[0], frame[1], frame[2] = byte(tag), byte(tag>>8), byte(tag>>16)
+	frame[3], frame[4], frame[5] = 0x9d, 0x01, 0x2a
+	binary.LittleEndian.PutUint16(frame[6:8], uint16(e.width))
+	binary.LittleEndian.PutUint16(frame[8:10], uint16(e.height))
+	frame = append(frame, first...)
+	return append(frame, tokens...), nil
+}
+
+// encodeFirstPartition returns the frame's header and the modes of all macroblocks (sections 9.2 - 9.11 and 19.2)
+func (e *vp8Encoder) encodeFirstPartition() []byte {
+	skipped := 0
+	for _, mb := range e.mbs {
+		if mb.skip {
+			skipped++
+		}
+	}
+	// The probability of a macroblock not being skipped
+	skipProb := uint8(clampInt((len(e.mbs)-skipped)*256/len(e.mbs), 1, 255))
+
+	p := newVP8BoolEncoder()
+	p.putLiteral(0, 1) // Color space
+	p.putLiteral(0, 1) // Clamping type
+	p.putLiteral(0, 1) // Segmentation
+	p.putLiteral(0, 1) // Normal loop filter
+	p.putLiteral(uint32(e.filterLevel), 6)
+	p.putLiteral(0, 3) // Sharpness
+	p.putLiteral(0, 1) // Loop filter deltas
+	p.putLiteral(0, 2) // Single token partition
+	p.putLiteral(uint32(e.qIndex), 7)
+	for range 5 {
+		p.putLiteral(0, 1) // No quantizer deltas
+	}
+	p.putLiteral(0, 1) // Refresh entropy probabilities
+	for i := range vp8TokenProbUpdateProb {
+		for j := range vp8TokenProbUpdateProb[i] {
+			for k := range vp8TokenProbUpdateProb[i][j] {
+				for l := range vp8TokenProbUpdateProb[i][j][k] {
+					p.putBit(false, vp8TokenProbUpdateProb[i][j][k][l])
+				}
+			}
+		}
+	}
+	p.putLiteral(1, 1) // Macroblocks can be skipped
+	p.putLiteral(uint32(skipProb), 8)
+
+	for _, mb := range e.mbs {
+		p.putBit(mb.skip, skipProb)
+		p.putBit(true, 145) // Not split into 4x4 blocks
+		switch mb.yMode {
+		case vp8PredDC:
+			p.putBit(false, 156)
+			p.putBit(false, 163)
+		case vp8PredVE:
+			p.putBit(false, 156)
+			p.putBit(true, 163)
+		case vp8PredHE:
+			p.putBit(true, 156)
+			p.putBit(false, 128)
+		case vp8PredTM:
+			p.putBit(true, 156)
+			p.putBit(true, 128)
+		}
+		p.putBit(mb.uvMode != vp8PredDC, 142)
+		if mb.uvMode != vp8PredDC {
+			p.putBit(mb.uvMode != vp8PredVE, 114)
+			if mb.uvMode != vp8PredVE {
+				p.putBit(mb.uvMode != vp8PredHE, 183)
+			}
+		}
+	}
+	return p.flush()
+}
+
+// encodeMacroblock picks the prediction modes of the macroblock, writes its coefficients,
+// and reconstructs it the same way the decoder will, for predicting the macroblocks that follow
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int) vp8Macroblock {
+	mb := vp8Macroblock{}
+
+	// Luma
+	yOffset := mby*16*e.yStride + mbx*16
+	var yPred [256]uint8
+	mb.yMode = e.bestMode(16, e.srcY[yOffset:], e.recY, yOffset, e.yStride, mbx, mby, yPred[:])
+	var yCoeffs [16][16]int32
+	var dcs [16]int32
+	for n := range 16 {
+		var res [16]int32
+		for j := range 4 {
+			for i := range 4 {
+				x, y := (n%4)*4+i, (n/4)*4+j
+				res[j*4+i] = int32(e.srcY[yOffset+y*e.yStride+x]) - int32(yPred[y*16+x])
+			}
+		}
+		vp8FDCT(&res, &yCoeffs[n])
+		dcs[n] = yCoeffs[n][0]
+		yCoeffs[n][0] = 0
+		for k := 1; k < 16; k++ {
+			yCoeffs[n][k] = vp8Quantize(yCoeffs[n][k], e.y1[1], 3)
+		}
+	}
+	var y2Coeffs [16]int32
+	vp8FWHT(&dcs, &y2Coeffs)
+	for k := range y2Coeffs {
+		y2Coeffs[k] = vp8Quantize(y2Coeffs[k], e.y2[min(k, 1)], 4)
+	}
+
+	// Chroma
+	cOffset := mby*8*e.cStride + mbx*8
+	var uPred, vPred [64]uint8
+	mb.uvMode = e.bestChromaMode(cOffset, mbx, mby, uPred[:], vPred[:])
+	uCoeffs := e.chromaCoeffs(e.srcU[cOffset:], uPred[:])
+	vCoeffs := e.chromaCoeffs(e.srcV[cOffset:], vPred[:])
+
+	mb.skip = isZero(y2Coeffs[:]) && isZero(yCoeffs[:]) && isZero(uCoeffs[:]) && isZero(vCoeffs[:])
+	if mb.skip {
+		// The decoder resets the contexts of skipped macroblocks
+		e.left = vp8NzContext{}
+		e.top[mbx] = vp8NzContext{}
+	} else {
+		e.putMacroblockCoeffs(mbx, &y2Coeffs, &yCoeffs, &uCoeffs, &vCoeffs)
+	}
+
+	// Reconstruct
+	var y2Dequant [16]int32
+	for k := range y2Coeffs {
+		y2Dequant[k] = y2Coeffs[k] * e.y2[min(k, 1)]
+	}
+	vp8IWHT(&y2Dequant, &dcs)
+	for n := range 16 {
+		block := yCoeffs[n]
+		block[0] = dcs[n]
+		for k := 1; k < 16; k++ {
+			block[k] *= e.y1[1]
+		}
+		off := ((n/4)*4)*16 + (n%4)*4
+		vp8IDCT(&block, yPred[off:], 16, e.recY[yOffset+((n/4)*4)*e.yStride+(n%4)*4:], e.yStride)
+	}
+	e.reconstructChroma(&uCoeffs, uPred[:], e.recU[cOffset:])
+	e.reconstructChroma(&vCoeffs, vPred[:], e.recV[cOffset:])
+
+	return mb
+}
+
+func (e *vp8Encoder) chromaCoeffs(src []uint8, pred []uint8) (coeffs [4][16]int32) {
+	for n := range 4 {
+		var res [16]int32
+		for j := range 4 {
+			for i := range 4 {
+				x, y := (n%2)*4+i, (n/2)*4+j
+				res[j*4+i] = int32(src[y*e.cStride+x]) - int32(pred[y*8+x])
+			}
+		}
+		vp8FDCT(&res, &coeffs[n])
+		coeffs[n][0] = vp8Quantize(coeffs[n][0], e.uv[0], 4)
+		for k := 1; k < 16; k++ {
+			coeffs[n][k] = vp8Quantize(coeffs[n][k], e.uv[1], 3)
+		}
+	}
+	return coeffs
+}
+
+func (e *vp8Encoder) reconstructChroma(coeffs *[4][16]int32, pred []uint8, rec []uint8) {
+	for n := range 4 {
+		block := coeffs[n]
+		block[0] *= e.uv[0]
+		for k := 1; k < 16; k++ {
+			block[k] *= e.uv[1]
+		}
+		off := ((n/2)*4)*8 + (n%2)*4
+		vp8IDCT(&block, pred[off:], 8, rec[((n/2)*4)*e.cStride+(n%2)*4:], e.cStride)
+	}
+}
+
+// putMacroblockCoeffs writes the coefficients of the macroblock to the token partition (section 13)
+func (e *vp8Encoder) putMacroblockCoeffs(mbx int, y2 *[16]int32, y *[16][16]int32, u, v *[4][16]int32) {
+	top := &e.top[mbx]
+	left := &e.left
+
+	nz := e.tokens.putCoeffs(vp8PlaneY2, top.y2+left.y2, y2, 0)
+	top.y2, left.y2 = nz, nz
+	for j := range 4 {
+		for i := range 4 {
+			nz := e.tokens.putCoeffs(vp8PlaneYAfterY2, top.y[i]+left.y[j], &y[j*4+i], 1)
+			top.y[i], left.y[j] = nz, nz
+		}
+	}
+	for _, c := range []struct {
+		coeffs    *[4][16]int32
+		top, left *[2]uint8
+	}{
+		{u, &top.u, &left.u},
+		{v, &top.v, &left.v},
+	} {
+		for j := range 2 {
+			for i := range 2 {
+				nz := e.tokens.putCoeffs(vp8PlaneUV, c.top[i]+c.left[j], &c.coeffs[j*2+i], 0)
+				c.top[i], c.left[j] = nz, nz
+			}
+		}
+	}
+}
+
+// vp8Edges returns the reconstructed pixels above, left of and above-left of the block at the offset,
+// with the values the decoder uses for the edges of the frame (section 12.2)
+func vp8Edges(size int, rec []uint8, offset, stride, mbx, mby int) (top, left []uint8, corner uint8) {
+	top = make([]uint8, size)
+	left = make([]uint8, size)
+	for i := range size {
+		if mby == 0 {
+			top[i] = 0x7f
+		} else {
+			top[i] = rec[offset-stride+i]
+		}
+		if mbx == 0 {
+			left[i] = 0x81
+		} else {
+			left[i] = rec[offset+i*stride-1]
+		}
+	}
+	switch {
+	case mby == 0:
+		corner = 0x7f
+	case mbx == 0:
+		corner = 0x81
+	default:
+		corner = rec[offset-stride-1]
+	}
+	return top, left, corner
+}
+
+// vp8Predict fills pred with the prediction of a size x size block (section 12.2)
+func vp8Predict(mode, size int, top, left []uint8, corner uint8, mbx, mby int, pred []uint8) {
+	for j := range size {
+		for i := range size {
+			var p int
+			switch mode {
+			case vp8PredTM:
+				p = clampInt(int(left[j])+int(top[i])-int(corner), 0, 255)
+			case vp8PredVE:
+				p = int(top[i])
+			case vp8PredHE:
+				p = int(left[j])
+			}
+			pred[j*size+i] = uint8(p)
+		}
+	}
+	if mode != vp8PredDC {
+		return
+	}
+
+	// DC only averages the edges that are inside the frame
+	shift := bits.Len(uint(size)) - 1
+	sum, count := 0, 0
+	if mby > 0 {
+		for _, p := range top {
+			sum += int(p)
+		}
+		count++
+	}
+	if mbx > 0 {
+		for _, p := range left {
+			sum += int(p)
+		}
+		count++
+	}
+	dc := 0x80
+	if count > 0 {
+		shift += count - 1
+		dc = (sum + 1<<(shift-1)) >> shift
+	}
+	for i := range pred[:size*size] {
+		pred[i] = uint8(dc)
+	}
+}
+
+// bestMode returns the luma prediction mode that best matches the source, filling pred with its prediction
+func (e *vp8Encoder) bestMode(size int, src []uint8, rec []uint8, offset, stride, mbx, mby int, pred []uint8) int {
+	top, left, corner := vp8Edges(size, rec, offset, stride, mbx, mby)
+	best, bestCost := 0, -1
+	candidate := make([]uint8, size*size)
+	for mode := range vp8NumPredModes {
+		vp8Predict(mode, size, top, left, corner, mbx, mby, candidate)
+		if cost := vp8SAD(src, stride, candidate, size); bestCost < 0 || cost < bestCost {
+			best, bestCost = mode, cost
+			copy(pred, candidate)
+		}
+	}
+	return best
+}
+
+// bestChromaMode returns the chroma prediction mode that best matches the source, filling the predictions
+func (e *vp8Encoder) bestChromaMode(offset, mbx, mby int, uPred, vPred []uint8) int {
+	uTop, uLeft, uCorner := vp8Edges(8, e.recU, offset, e.cStride, mbx, mby)
+	vTop, vLeft, vCorner := vp8Edges(8, e.recV, offset, e.cStride, mbx, mby)
+	best, bestCost := 0, -1
+	u := make([]uint8, 64)
+	v := make([]uint8, 64)
+	for mode := range vp8NumPredModes {
+		vp8Predict(mode, 8, uTop, uLeft, uCorner, mbx, mby, u)
+		vp8Predict(mode, 8, vTop, vLeft, vCorner, mbx, mby, v)
+		cost := vp8SAD(e.srcU[offset:], e.cStride, u, 8) + vp8SAD(e.srcV[offset:], e.cStride, v, 8)
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = mode, cost
+			copy(uPred, u)
+			copy(vPred, v)
+		}
+	}
+	return best
+}
+
+// vp8SAD returns the sum of absolute differences between the source and a size x size prediction
+func vp8SAD(src []uint8, stride int, pred []uint8, size int) int {
+	sum := 0
+	for j := range size {
+		for i := range size {
+			d := int(src[j*stride+i]) - int(pred[j*size+i])
+			sum += max(d, -d)
+		}
+	}
+	return sum
+}
+
+// vp8Quantize quantizes the coefficient to the step, rounding up from the specified number of eighths
+func vp8Quantize(c, step, roundEighths int32) int32 {
+	q := (max(c, -c) + step*roundEighths/8) / step
+	q = min(q, 2048)
+	if c < 0 {
+		return -q
+	}
+	return q
+}
+
+// vp8FDCT is the forward transform that the inverse transform of section 14.3 undoes
+func vp8FDCT(in, out *[16]int32) {
+	var tmp [16]int32
+	for i := range 4 {
+		a := (in[i*4+0] + in[i*4+3]) * 8
+		b := (in[i*4+1] + in[i*4+2]) * 8
+		c := (in[i*4+1] - in[i*4+2]) * 8
+		d := (in[i*4+0] - in[i*4+3]) * 8
+		tmp[i*4+0] = a + b
+		tmp[i*4+2] = a - b
+		tmp[i*4+1] = (c*2217 + d*5352 + 14500) >> 12
+		tmp[i*4+3] = (d*2217 - c*5352 + 7500) >> 12
+	}
+	for i := range 4 {
+		a := tmp[i] + tmp[12+i]
+		b := tmp[4+i] + tmp[8+i]
+		c := tmp[4+i] - tmp[8+i]
+		d := tmp[i] - tmp[12+i]
+		out[i] = (a + b + 7) >> 4
+		out[8+i] = (a - b + 7) >> 4
+		out[4+i] = (c*2217+d*5352+12000)>>16 + btoi(d != 0)
+		out[12+i] = (d*2217 - c*5352 + 51000) >> 16
+	}
+}
+
+// vp8IDCT adds the inverse transform of the coefficients to the prediction (section 14.3)
+func vp8IDCT(in *[16]int32, pred []uint8, predStride int, out []uint8, outStride int) {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2)
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2)
+	)
+	var m [4][4]int32
+	for i := range 4 {
+		a := in[i] + in[8+i]
+		b := in[i] - in[8+i]
+		c := (in[4+i]*c2)>>16 - (in[12+i]*c1)>>16
+		d := (in[4+i]*c1)>>16 + (in[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+	for j := range 4 {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		for i, r := range [4]int32{(a + d) >> 3, (b + c) >> 3, (b - c) >> 3, (a - d) >> 3} {
+			out[j*outStride+i] = uint8(clampInt(int(pred[j*predStride+i])+int(r), 0, 255))
+		}
+	}
+}
+
+// vp8FWHT is the forward transform that the inverse transform of section 14.3 undoes
+func vp8FWHT(in, out *[16]int32) {
+	var tmp [16]int32
+	for i := range 4 {
+		a := (in[i*4+0] + in[i*4+2]) * 4
+		d := (in[i*4+1] + in[i*4+3]) * 4
+		c := (in[i*4+1] - in[i*4+3]) * 4
+		b := (in[i*4+0] - in[i*4+2]) * 4
+		tmp[i*4+0] = a + d + btoi(a != 0)
+		tmp[i*4+1] = b + c
+		tmp[i*4+2] = b - c
+		tmp[i*4+3] = a - d
+	}
+	for i := range 4 {
+		a := tmp[i] + tmp[8+i]
+		d := tmp[4+i] + tmp[12+i]
+		c := tmp[4+i] - tmp[12+i]
+		b := tmp[i] - tmp[8+i]
+		for k, v := range [4]int32{a + d, b + c, b - c, a - d} {
+			if v < 0 {
+				v++
+			}
+			out[k*4+i] = (v + 3) >> 3
+		}
+	}
+}
+
+// vp8IWHT is the inverse Walsh-Hadamard transform of the DC coefficients of the luma blocks (section 14.3)
+func vp8IWHT(in, out *[16]int32) {
+	var m [16]int32
+	for i := range 4 {
+		a0 := in[i] + in[12+i]
+		a1 := in[4+i] + in[8+i]
+		a2 := in[4+i] - in[8+i]
+		a3 := in[i] - in[12+i]
+		m[i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	for i := range 4 {
+		dc := m[i*4] + 3
+		a0 := dc + m[i*4+3]
+		a1 := m[i*4+1] + m[i*4+2]
+		a2 := m[i*4+1] - m[i*4+2]
+		a3 := dc - m[i*4+3]
+		out[i*4+0] = (a0 + a1) >> 3
+		out[i*4+1] = (a3 + a2) >> 3
+		out[i*4+2] = (a0 - a1) >> 3
+		out[i*4+3] = (a3 - a2) >> 3
+	}
+}
+
+// vp8BoolEncoder is the boolean entropy encoder of section 7
+type vp8BoolEncoder struct {
+	buf   []byte
+	rng   uint32
+	low   uint32
+	count int
+}
+
+func newVP8BoolEncoder() vp8BoolEncoder {
+	return vp8BoolEncoder{rng: 255, count: -24}
+}
+
+// putBit writes the bit, where prob is the probability, out of 256, of the bit being false
+func (e *vp8BoolEncoder) putBit(bit bool, prob uint8) {
+	split := 1 + ((e.rng-1)*uint32(prob))>>8
+	if bit {
+		e.low += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+
+	shift := bits.LeadingZeros32(e.rng) - 24
+	e.rng <<= shift
+	e.count += shift
+	if e.count >= 0 {
+		offset := shift - e.count
+		if (e.low<<(offset-1))&0x80000000 != 0 {
+			// Propagate the carry
+			i := len(e.buf) - 1
+			for ; i >= 0 && e.buf[i] == 0xff; i-- {
+				e.buf[i] = 0
+			}
+			e.buf[i]++
+		}
+		e.buf = append(e.buf, byte(e.low>>(24-offset)))
+		e.low <<= offset
+		shift = e.count
+		e.low &= 0xffffff
+		e.count -= 8
+	}
+	e.low <<= shift
+}
+
+// putLiteral writes the n-bit unsigned value, most significant bit first
+func (e *vp8BoolEncoder) putLiteral(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.putBit(v&(1<<i) != 0, 128)
+	}
+}
+
+// flush writes out any remaining bits, and returns the encoded data
+func (e *vp8BoolEncoder) flush() []byte {
+	for range 32 {
+		e.putBit(false, 128)
+	}
+	return e.buf
+}
+
+// putCoeffs writes the tokens of a block's quantized coefficients, starting at the first (section 13.2),
+// and returns whether any were non-zero
+func (e *vp8BoolEncoder) putCoeffs(plane int, ctx uint8, coeffs *[16]int32, first int) uint8 {
+	last := -1
+	for n := 15; n >= first; n-- {
+		if coeffs[vp8Zigzag[n]] != 0 {
+			last = n
+			break
+		}
+	}
+
+	probs := &vp8DefaultTokenProb[plane]
+	p := &probs[vp8Bands[first]][ctx]
+	if last < 0 {
+		e.putBit(false, p[0])
+		return 0
+	}
+	e.putBit(true, p[0])
+
+	for n := first; n < 16; {
+		c := coeffs[vp8Zigzag[n]]
+		n++
+		if c == 0 {
+			e.putBit(false, p[1])
+			p = &probs[vp8Bands[n]][0]
+			continue
+		}
+		e.putBit(true, p[1])
+
+		v := max(c, -c)
+		if v == 1 {
+			e.putBit(false, p[2])
+			p = &probs[vp8Bands[n]][1]
+		} else {
+			e.putBit(true, p[2])
+			switch {
+			case v <= 4:
+				e.putBit(false, p[3])
+				e.putBit(v != 2, p[4])
+				if v != 2 {
+					e.putBit(v == 4, p[5])
+				}
+			case v <= 10:
+				e.putBit(true, p[3])
+				e.putBit(false, p[6])
+				e.putBit(v > 6, p[7])
+				if v <= 6 {
+					e.putBit(v == 6, 159)
+				} else {
+					e.putBit((v-7)&2 != 0, 165)
+					e.putBit((v-7)&1 != 0, 145)
+				}
+			default:
+				e.putBit(true, p[3])
+				e.putBit(true, p[6])
+				cat := 3
+				switch {
+				case v <= 18:
+					cat = 0
+				case v <= 34:
+					cat = 1
+				case v <= 66:
+					cat = 2
+				}
+				e.putBit(cat >= 2, p[8])
+				e.putBit(cat&1 != 0, p[9+cat/2])
+				extra := uint32(v) - (3 + 8<<cat)
+				tab := vp8Cat3456[cat]
+				for i, prob := range tab {
+					e.putBit(extra&(1<<(len(tab)-1-i)) != 0, prob)
+				}
+			}
+			p = &probs[vp8Bands[n]][2]
+		}
+		e.putBit(c < 0, 128)
+
+		if n == 16 {
+			break
+		}
+		e.putBit(n <= last, p[0])
+		if n > last {
+			break
+		}
+	}
+	return 1
+}
+
+func isZero[T [16]int32 | int32](values []T) bool {
+	var zero T
+	for _, v := range values {
+		if v != zero {
+			return false
+		}
+	}
+	return true
+}
+
+func clampInt(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+func btoi(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,211 @@
+package webp
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+func newTestGradient(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{uint8(x * 3), uint8(y * 5), uint8((x*y)%256 ^ 0x55), 255})
+		}
+	}
+	return img
+}
+
+// lumaPSNR returns the peak signal-to-noise ratio, in dB, of the luma of the decoded image.
+// VP8 stores the studio range, which the decoder doesn't expand, so the luma is compared in that range.
+func lumaPSNR(src *image.RGBA, decoded image.Image) float64 {
+	img := decoded.(*image.YCbCr)
+	var sum float64
+	bounds := src.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := src.RGBAAt(x, y)
+			expected := 16 + (0.2570*float64(c.R) + 0.5044*float64(c.G) + 0.0980*float64(c.B))
+			diff := expected - float64(img.Y[img.YOffset(x, y)])
+			sum += diff * diff
+		}
+	}
+	mse := sum / float64(bounds.Dx()*bounds.Dy())
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+func Test_Encode(t *testing.T) {
+	type testArgs struct {
+		caseName string
+		width    int
+		height   int
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Single Pixel", 1, 1},
+		{"Single Macroblock", 16, 16},
+		{"Partial Macroblocks", 17, 9},
+		{"Single Row", 250, 1},
+		{"Single Column", 1, 250},
+		{"Odd Size", 333, 211},
+		{"Large", 1280, 853},
+	}
+	// The minimum peak signal-to-noise ratio of the luma, in dB, of the decoded image at each quality
+	qualities := []struct {
+		quality int
+		minPSNR float64
+	}{
+		{1, 25},
+		{50, 28},
+		{80, 33},
+		{100, 45},
+	}
+	for _, test := range tests {
+		for _, q := range qualities {
+			t.Run(fmt.Sprintf("%s - Quality %d", test.caseName, q.quality), func(t *testing.T) {
+				src := newTestGradient(test.width, test.height)
+				buf := new(bytes.Buffer)
+
+				// Act
+				err := Encode(buf, src, q.quality)
+
+				// Assert
+				if err != nil {
+					t.Fatalf("failed to encode: %v", err)
+				}
+				if buf.Len()%2 != 0 {
+					t.Errorf("expected an even length, received %d", buf.Len())
+				}
+				decoded, err := xwebp.Decode(buf)
+				if err != nil {
+					t.Fatalf("failed to decode: %v", err)
+				}
+				if decoded.Bounds() != src.Bounds() {
+					t.Fatalf("expected bounds %v, received %v", src.Bounds(), decoded.Bounds())
+				}
+				if psnr := lumaPSNR(src, decoded); psnr < q.minPSNR {
+					t.Errorf("expected a PSNR of at least %.1f dB, received %.1f dB", q.minPSNR, psnr)
+				}
+			})
+		}
+	}
+}
+
+func Test_Encode_HigherQualityIsMoreFaithful(t *testing.T) {
+	// Arrange
+	src := newTestGradient(333, 211)
+	prevPSNR := 0.0
+	prevSize := 0
+	for _, quality := range []int{1, 25, 50, 75, 100} {
+		buf := new(bytes.Buffer)
+
+		// Act
+		if err := Encode(buf, src, quality); err != nil {
+			t.Fatalf("failed to encode at quality %d: %v", quality, err)
+		}
+		size := buf.Len()
+		decoded, err := xwebp.Decode(buf)
+		if err != nil {
+			t.Fatalf("failed to decode at quality %d: %v", quality, err)
+		}
+
+		// Assert
+		psnr := lumaPSNR(src, decoded)
+		if psnr < prevPSNR {
+			t.Errorf("quality %d: expected a PSNR of at least %.1f dB, received %.1f dB", quality, prevPSNR, psnr)
+		}
+		if size < prevSize {
+			t.Errorf("quality %d: expected at least %d bytes, received %d", quality, prevSize, size)
+		}
+		prevPSNR = psnr
+		prevSize = size
+	}
+}
+
+func Test_vp8Encoder_reconstruction(t *testing.T) {
+	// Arrange
+	src := newTestGradient(100, 70)
+	e := newVP8Encoder(src, 80)
+	// The decoder's loop filter would change the pixels after reconstruction
+	e.filterLevel = 0
+
+	// Act
+	data, err := e.encode()
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := writeContainer(buf, data); err != nil {
+		t.Fatalf("failed to write container: %v", err)
+	}
+	decoded, err := xwebp.Decode(buf)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+
+	// Assert
+	// The decoder must arrive at the same pixels the encoder predicted from
+	img := decoded.(*image.YCbCr)
+	for y := range 70 {
+		for x := range 100 {
+			if actual, expected := img.Y[img.YOffset(x, y)], e.recY[y*e.yStride+x]; actual != expected {
+				t.Fatalf("luma at (%d, %d): expected %d, received %d", x, y, expected, actual)
+			}
+			if actual, expected := img.Cb[img.COffset(x, y)], e.recU[(y/2)*e.cStride+x/2]; actual != expected {
+				t.Fatalf("blue chroma at (%d, %d): expected %d, received %d", x, y, expected, actual)
+			}
+			if actual, expected := img.Cr[img.COffset(x, y)], e.recV[(y/2)*e.cStride+x/2]; actual != expected {
+				t.Fatalf("red chroma at (%d, %d): expected %d, received %d", x, y, expected, actual)
+			}
+		}
+	}
+}
+
+func Test_Encode_TooLarge(t *testing.T) {
+	// Arrange
+	src := image.NewRGBA(image.Rect(0, 0, 1, maxSize+1))
+
+	// Act
+	err := Encode(new(bytes.Buffer), src, 92)
+
+	// Assert
+	if err != ErrImageTooLarge {
+		t.Errorf("expected error: %v, received: %v", ErrImageTooLarge, err)
+	}
+}
+
+func Test_Encode_NonRGBASource(t *testing.T) {
+	// Arrange
+	gradient := newTestGradient(120, 90)
+	src := image.NewNRGBA(image.Rect(10, 20, 130, 110))
+	draw.Draw(src, src.Bounds(), gradient, image.Point{}, draw.Src)
+	buf := new(bytes.Buffer)
+
+	// Act
+	err := Encode(buf, src, 80)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	decoded, err := xwebp.Decode(buf)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if decoded.Bounds().Size() != src.Bounds().Size() {
+		t.Fatalf("expected size %v, received %v", src.Bounds().Size(), decoded.Bounds().Size())
+	}
+	if psnr := lumaPSNR(gradient, decoded); psnr < 33 {
+		t.Errorf("expected a PSNR of at least 33.0 dB, received %.1f dB", psnr)
+	}
+}
@@ -14,9 +14,11 @@ import (
 	"github.com/chadweimer/gomp/api"
 	"github.com/chadweimer/gomp/db"
 	"github.com/chadweimer/gomp/fileaccess"
+	"github.com/chadweimer/gomp/jobs"
 	"github.com/chadweimer/gomp/metadata"
 	"github.com/chadweimer/gomp/middleware"
 	"github.com/chadweimer/gomp/models"
+	"github.com/chadweimer/gomp/nutrition"
 	"github.com/chadweimer/vary"
 )
 
@@ -30,6 +32,11 @@ func main() {
 	// Write the app metadata to logs
 	slog.Info("Starting application", "version", metadata.BuildVersion)
 
+	// Run a command instead of the server, if one was specified
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// Load configuration
 	vary.SetPrefix("GOMP")
 	cfg := &Config{}
@@ -49,25 +56,42 @@ func main() {
 		os.Exit(1)
 	}
 
-	fsDriver, err := fileaccess.CreateDriver(cfg.FileAccess.Files)
+	dbDriver, err := db.CreateDriver(cfg.Database)
 	if err != nil {
-		slog.Error("Establishing file access driver failed. Exiting...", "error", err)
+		slog.Error("Establishing database driver failed. Exiting...", "error", err)
 		os.Exit(1)
 	}
-	fileServer := http.FileServerFS(fileaccess.OnlyFiles(fsDriver))
+	defer dbDriver.Close()
 
-	uploader, err := fileaccess.CreateImageUploader(fsDriver, cfg.FileAccess.Image)
+	var fsDriver fileaccess.Driver
+	if cfg.FileAccess.Files.Driver == fileaccess.FilesDriverDB {
+		fsDriver = dbDriver.Files()
+	} else {
+		fsDriver, err = fileaccess.CreateDriver(cfg.FileAccess.Files)
+		if err != nil {
+			slog.Error("Establishing file access driver failed. Exiting...", "error", err)
+			os.Exit(1)
+		}
+	}
+	fileServer := fileaccess.NewFileServer(fsDriver)
+
+	uploader, err := fileaccess.CreateImageUploader(fsDriver, dbDriver.ImageReferences(), cfg.FileAccess.Image)
 	if err != nil {
 		slog.Error("Establishing uploader failed. Exiting...", "error", err)
 		os.Exit(1)
 	}
 
-	dbDriver, err := db.CreateDriver(cfg.Database)
+	nutritionDb, err := nutrition.CreateDatabase(cfg.Nutrition)
 	if err != nil {
-		slog.Error("Establishing database driver failed. Exiting...", "error", err)
+		slog.Error("Loading nutrient database failed. Exiting...", "error", err)
+		os.Exit(1)
+	}
+
+	jobQueue, err := jobs.CreateQueue(dbDriver.Jobs(), cfg.Jobs)
+	if err != nil {
+		slog.Error("Establishing job queue failed. Exiting...", "error", err)
 		os.Exit(1)
 	}
-	defer dbDriver.Close()
 
 	baseAssetsRoot, err := os.OpenRoot(cfg.BaseAssetsPath)
 	if err != nil {
@@ -83,7 +107,7 @@ func main() {
 	}
 
 	mux := http.NewServeMux()
-	handlePrefixStripped(mux, "api", api.NewHandler(cfg.SecureKeys, uploader, dbDriver, fsDriver))
+	handlePrefixStripped(mux, "api", api.NewHandler(cfg.SecureKeys, uploader, dbDriver, fsDriver, nutritionDb, jobQueue))
 	handlePrefixStripped(mux, "static", http.FileServerFS(fileaccess.OnlyFiles(baseAssetsRoot.FS())))
 	// Uploaded files require authentication
 	handlePrefixed(mux, fileaccess.UploadDirectoryName, middleware.VerifyScopes(
@@ -101,6 +125,14 @@ func main() {
 		middleware.Recover("Recovered from panic"),
 	)
 
+	// Run background jobs until the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if err := jobQueue.Start(jobsCtx); err != nil {
+		slog.Error("Starting job queue failed. Exiting...", "error", err)
+		os.Exit(1)
+	}
+
 	// subscribe to SIGINT signals
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
@@ -126,4 +158,9 @@ func main() {
 		// We're already going down. Time to panic
 		panic(err)
 	}
+
+	// Then stop the jobs, which are run again the next time the server starts if they're interrupted
+	slog.Info("Stopping background jobs...")
+	stopJobs()
+	jobQueue.Wait()
 }
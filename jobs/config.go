@@ -0,0 +1,36 @@
+package jobs
+
+import (
+	"errors"
+)
+
+// Config represents the background job configuration settings
+type Config struct {
+	// Workers gets the number of jobs that can run at the same time.
+	Workers int `env:"JOB_WORKERS" default:"2"`
+
+	// MaxAttempts gets the number of times a job is started before it is considered failed.
+	MaxAttempts int `env:"JOB_MAX_ATTEMPTS" default:"3"`
+
+	// RetentionDays gets the number of days that finished jobs are kept before they are removed.
+	// A value of 0 keeps them indefinitely.
+	RetentionDays int `env:"JOB_RETENTION_DAYS" default:"7"`
+}
+
+func (c Config) validate() error {
+	errs := make([]error, 0)
+
+	if c.Workers <= 0 {
+		errs = append(errs, errors.New("job workers must be a positive integer"))
+	}
+
+	if c.MaxAttempts <= 0 {
+		errs = append(errs, errors.New("job max attempts must be a positive integer"))
+	}
+
+	if c.RetentionDays < 0 {
+		errs = append(errs, errors.New("job retention days must be a non-negative integer"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import "testing"
+
+func TestConfig_validate(t *testing.T) {
+	tests := []struct {
+		name          string
+		workers       int
+		maxAttempts   int
+		retentionDays int
+		wantErr       bool
+	}{
+		{
+			name:        "Valid",
+			workers:     2,
+			maxAttempts: 3,
+			wantErr:     false,
+		},
+		{
+			name:        "Single Attempt",
+			workers:     1,
+			maxAttempts: 1,
+			wantErr:     false,
+		},
+		{
+			name:        "No Workers",
+			workers:     0,
+			maxAttempts: 3,
+			wantErr:     true,
+		},
+		{
+			name:        "No Attempts",
+			workers:     2,
+			maxAttempts: 0,
+			wantErr:     true,
+		},
+		{
+			name:          "Kept Indefinitely",
+			workers:       2,
+			maxAttempts:   3,
+			retentionDays: 0,
+			wantErr:       false,
+		},
+		{
+			name:          "Negative Retention",
+			workers:       2,
+			maxAttempts:   3,
+			retentionDays: -1,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{
+				Workers:       tt.workers,
+				MaxAttempts:   tt.maxAttempts,
+				RetentionDays: tt.retentionDays,
+			}
+			if got := c.validate(); tt.wantErr != (got != nil) {
+				t.Errorf("Config.validate() = %v, want error? %v", got, tt.wantErr)
+			}
+		})
+	}
+}
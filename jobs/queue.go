@@ -0,0 +1,360 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/infra"
+	"github.com/chadweimer/gomp/models"
+)
+
+// pollInterval is how often idle workers check for jobs that are ready to run,
+// e.g., those waiting to be retried, or queued by another instance of the application
+const pollInterval = 5 * time.Second
+
+// retryDelay is how long a failed job waits before its first retry.
+// The delay doubles with each attempt after that, up to maxRetryDelay.
+const retryDelay = 10 * time.Second
+
+// maxRetryDelay is the longest a failed job waits before it is retried
+const maxRetryDelay = time.Hour
+
+// heartbeatInterval is how often a running job is reported as still in progress,
+// and how often jobs that stopped being reported are looked for
+const heartbeatInterval = 30 * time.Second
+
+// staleAfter is how long a running job can go without being reported as in progress before it is
+// considered interrupted, e.g., because the instance running it stopped, and run again by any instance
+const staleAfter = 4 * heartbeatInterval
+
+// pruneInterval is how often finished jobs that are older than the retention period are removed
+const pruneInterval = time.Hour
+
+// interruptedMessage is recorded on jobs that were running when the instance running them stopped
+const interruptedMessage = "interrupted before finishing"
+
+// HandlerFunc does the work of a job. The returned result is recorded on the job
+// once it succeeds, e.g., the location of what it produced.
+type HandlerFunc func(ctx context.Context, task *Task) (string, error)
+
+// Task is a job that is being run, along with what it operates on
+type Task struct {
+	// Job is the job being run
+	Job models.Job
+
+	// Payload is the JSON encoded parameters of the job
+	Payload string
+
+	// Data is the content the job operates on, if any, e.g., an uploaded file
+	Data []byte
+
+	progress func(int)
+}
+
+// Decode parses the parameters of the job into v
+func (t *Task) Decode(v any) error {
+	if err := json.Unmarshal([]byte(t.Payload), v); err != nil {
+		return Permanent(fmt.Errorf("decoding job payload: %w", err))
+	}
+	return nil
+}
+
+// SetProgress records how much of the work of the job is done, from 0 to 100
+func (t *Task) SetProgress(progress int) {
+	if t.progress != nil {
+		t.progress(min(max(progress, 0), 100))
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks the error as one that retrying the job won't fix, e.g., invalid input,
+// so that the job fails without using any of its remaining attempts
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// IsPermanent reports whether the error, or any error it wraps, was marked by Permanent
+func IsPermanent(err error) bool {
+	var permanentErr *permanentError
+	return errors.As(err, &permanentErr)
+}
+
+// Queue runs jobs in the background, using a fixed number of workers.
+// Jobs are stored in the database, so that those that are pending survive restarts.
+// Any number of instances of the application can share the same jobs, as each job is claimed by one of them
+// and reported as in progress until it finishes.
+type Queue struct {
+	db       db.JobDriver
+	cfg      Config
+	handlers map[models.JobKind]HandlerFunc
+	wake     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// CreateQueue returns a Queue that stores its jobs using the specified driver
+func CreateQueue(jobDriver db.JobDriver, cfg Config) (*Queue, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &Queue{
+		db:       jobDriver,
+		cfg:      cfg,
+		handlers: make(map[models.JobKind]HandlerFunc),
+		wake:     make(chan struct{}, 1),
+	}, nil
+}
+
+// Register sets the function that does the work of jobs of the specified kind.
+// All handlers must be registered before the queue is started.
+func (q *Queue) Register(kind models.JobKind, handler HandlerFunc) {
+	q.handlers[kind] = handler
+}
+
+// Enqueue stores a new job of the specified kind, which runs once a worker is available.
+// The payload is JSON encoded, and the data is kept until the job finishes.
+func (q *Queue) Enqueue(ctx context.Context, kind models.JobKind, createdBy *int64, payload any, data []byte) (*models.Job, error) {
+	encodedPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encoding job payload: %w", err)
+	}
+
+	job := &db.JobWithInput{
+		Job: models.Job{
+			Kind:        kind,
+			MaxAttempts: q.cfg.MaxAttempts,
+			CreatedBy:   createdBy,
+		},
+		Payload: string(encodedPayload),
+		Data:    data,
+	}
+	if err := q.db.Create(ctx, job); err != nil {
+		return nil, fmt.Errorf("creating job: %w", err)
+	}
+
+	// Let an idle worker know there's something to do, if one isn't already about to check
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return &job.Job, nil
+}
+
+// Start runs the workers until the context is cancelled. Any jobs that were left running,
+// e.g., by an instance of the application stopping unexpectedly, are run again once they are stale.
+func (q *Queue) Start(ctx context.Context) error {
+	if err := q.requeueStale(ctx); err != nil {
+		return err
+	}
+	q.prune(ctx)
+
+	for range q.cfg.Workers {
+		q.wg.Go(func() {
+			q.work(ctx)
+		})
+	}
+	q.wg.Go(func() {
+		q.maintain(ctx)
+	})
+
+	return nil
+}
+
+// Wait blocks until all workers have stopped after the context used to start the queue is cancelled.
+// Jobs that are interrupted are run again once they are stale, by this or any other instance.
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// maintain periodically requeues stale jobs and prunes old ones until the context is cancelled
+func (q *Queue) maintain(ctx context.Context) {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	requeueTicker := time.NewTicker(heartbeatInterval)
+	defer requeueTicker.Stop()
+	pruneTicker := time.NewTicker(pruneInterval)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-requeueTicker.C:
+			if err := q.requeueStale(ctx); err != nil && ctx.Err() == nil {
+				logger.ErrorContext(ctx, "Failed to requeue interrupted jobs", "error", err)
+			}
+		case <-pruneTicker.C:
+			q.prune(ctx)
+		}
+	}
+}
+
+// requeueStale runs the jobs that stopped being reported as in progress again
+func (q *Queue) requeueStale(ctx context.Context) error {
+	if err := q.db.Requeue(ctx, time.Now().UTC().Add(-staleAfter), interruptedMessage); err != nil {
+		return fmt.Errorf("requeuing interrupted jobs: %w", err)
+	}
+
+	// Let an idle worker know there may be something to do
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// prune removes the jobs that finished longer ago than the retention period, if there is one
+func (q *Queue) prune(ctx context.Context) {
+	if q.cfg.RetentionDays == 0 {
+		return
+	}
+
+	logger := infra.GetLoggerFromContext(ctx)
+	finishedBefore := time.Now().UTC().AddDate(0, 0, -q.cfg.RetentionDays)
+	pruned, err := q.db.Prune(ctx, finishedBefore)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.ErrorContext(ctx, "Failed to prune finished jobs", "error", err)
+		}
+		return
+	}
+	if pruned > 0 {
+		logger.InfoContext(ctx, "Pruned finished jobs", "count", pruned)
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		if q.runNext(ctx) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-q.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// runNext runs the next job that is ready to run, if any, and records its outcome.
+// The return value indicates whether there was a job to run.
+func (q *Queue) runNext(ctx context.Context) bool {
+	logger := infra.GetLoggerFromContext(ctx)
+
+	job, err := q.db.Claim(ctx, time.Now().UTC())
+	if err != nil {
+		if !errors.Is(err, db.ErrNotFound) && ctx.Err() == nil {
+			logger.ErrorContext(ctx, "Failed to claim next job", "error", err)
+		}
+		return false
+	}
+
+	logger = logger.With("job-id", *job.ID, "job-kind", job.Kind, "attempt", job.Attempts)
+	ctx = infra.AddLoggerToContext(ctx, logger)
+	logger.InfoContext(ctx, "Starting job")
+
+	stopHeartbeat := q.startHeartbeat(ctx, job)
+	result, err := q.run(ctx, job)
+	stopHeartbeat()
+	if err == nil {
+		logger.InfoContext(ctx, "Job succeeded")
+		// Even if the queue is stopping, the work is done
+		if err := q.db.Complete(context.WithoutCancel(ctx), *job.ID, job.Attempts, result); err != nil {
+			logger.ErrorContext(ctx, "Failed to record job success", "error", err)
+		}
+		return true
+	}
+	if ctx.Err() != nil {
+		// The job is left running, and is run again once it is stale
+		logger.WarnContext(ctx, "Job interrupted", "error", err)
+		return true
+	}
+
+	var retryAt *time.Time
+	if job.Attempts < job.MaxAttempts && !IsPermanent(err) {
+		retryAt = new(time.Now().UTC().Add(getRetryDelay(job.Attempts)))
+		logger.WarnContext(ctx, "Job failed. Will retry...", "error", err, "retry-at", *retryAt)
+	} else {
+		logger.ErrorContext(ctx, "Job failed", "error", err)
+	}
+	if err := q.db.Fail(ctx, *job.ID, job.Attempts, err.Error(), retryAt); err != nil {
+		logger.ErrorContext(ctx, "Failed to record job failure", "error", err)
+	}
+	return true
+}
+
+// startHeartbeat periodically reports that the job is still in progress, until the returned function is called
+func (q *Queue) startHeartbeat(ctx context.Context, job *db.JobWithInput) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := q.db.Heartbeat(ctx, *job.ID, job.Attempts, time.Now().UTC()); err != nil && ctx.Err() == nil {
+					infra.GetLoggerFromContext(ctx).WarnContext(ctx, "Failed to record job heartbeat", "error", err)
+				}
+			}
+		}
+	})
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func (q *Queue) run(ctx context.Context, job *db.JobWithInput) (result string, err error) {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		return "", Permanent(fmt.Errorf("no handler for jobs of kind %s", job.Kind))
+	}
+
+	defer func() {
+		if recv := recover(); recv != nil {
+			err = fmt.Errorf("job panicked: %v", recv)
+		}
+	}()
+
+	task := &Task{
+		Job:     job.Job,
+		Payload: job.Payload,
+		Data:    job.Data,
+		progress: func(progress int) {
+			if err := q.db.UpdateProgress(ctx, *job.ID, job.Attempts, progress); err != nil {
+				infra.GetLoggerFromContext(ctx).WarnContext(ctx, "Failed to record job progress", "error", err)
+			}
+		},
+	}
+	return handler(ctx, task)
+}
+
+// getRetryDelay returns how long to wait before retrying a job that failed after the specified number of attempts
+func getRetryDelay(attempts int) time.Duration {
+	// Keep the shift small enough that it can't overflow
+	return min(retryDelay<<min(max(attempts-1, 0), 16), maxRetryDelay)
+}
@@ -0,0 +1,338 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chadweimer/gomp/db"
+	dbmock "github.com/chadweimer/gomp/mocks/db"
+	"github.com/chadweimer/gomp/models"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_CreateQueue(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	jobDriver := dbmock.NewMockJobDriver(ctrl)
+
+	// Act
+	_, err := CreateQueue(jobDriver, Config{Workers: 0, MaxAttempts: 3})
+
+	// Assert
+	if err == nil {
+		t.Error("expected an error for an invalid configuration")
+	}
+}
+
+func Test_Enqueue(t *testing.T) {
+	type testArgs struct {
+		name          string
+		payload       any
+		dbError       error
+		expectError   bool
+		expectPayload string
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", map[string]int64{"recipeId": 1}, nil, false, `{"recipeId":1}`},
+		{"Invalid Payload", make(chan int), nil, true, ""},
+		{"DB Error", map[string]int64{"recipeId": 1}, errors.New("db error"), true, `{"recipeId":1}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			sut, jobDriver := getMockQueue(t, ctrl)
+
+			createdBy := new(int64(2))
+			data := []byte{0xff, 0xd8}
+			if test.expectPayload != "" {
+				jobDriver.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, job *db.JobWithInput) error {
+					if job.Kind != models.JobUploadImage || job.MaxAttempts != 3 || job.CreatedBy != createdBy {
+						t.Errorf("unexpected job: %v", job.Job)
+					}
+					if job.Payload != test.expectPayload || string(job.Data) != string(data) {
+						t.Errorf("unexpected job input: %s, %v", job.Payload, job.Data)
+					}
+					if test.dbError == nil {
+						job.ID = new(int64(5))
+						job.State = models.JobPending
+					}
+					return test.dbError
+				})
+			}
+
+			// Act
+			job, err := sut.Enqueue(t.Context(), models.JobUploadImage, createdBy, test.payload, data)
+
+			// Assert
+			if (err != nil) != test.expectError {
+				t.Errorf("expected error: %v, received error: %v", test.expectError, err)
+			} else if err == nil {
+				if *job.ID != 5 || job.State != models.JobPending {
+					t.Errorf("unexpected job: %v", job)
+				}
+				select {
+				case <-sut.wake:
+				default:
+					t.Error("expected the workers to be woken")
+				}
+			}
+		})
+	}
+}
+
+func Test_runNext(t *testing.T) {
+	type testArgs struct {
+		name          string
+		kind          models.JobKind
+		attempts      int
+		handlerResult string
+		handlerError  error
+		handlerPanic  bool
+		expectRetry   bool
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", models.JobUploadImage, 1, "/uploads/a.jpeg", nil, false, false},
+		{"Failure", models.JobUploadImage, 1, "", errors.New("oops"), false, true},
+		{"Failure on Last Attempt", models.JobUploadImage, 3, "", errors.New("oops"), false, false},
+		{"Permanent Failure", models.JobUploadImage, 1, "", Permanent(errors.New("invalid")), false, false},
+		{"Panic", models.JobUploadImage, 1, "", nil, true, true},
+		{"Unknown Kind", models.JobCreateBackup, 1, "", nil, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			sut, jobDriver := getMockQueue(t, ctrl)
+
+			sut.Register(models.JobUploadImage, func(_ context.Context, task *Task) (string, error) {
+				var payload struct {
+					RecipeID int64 `json:"recipeId"`
+				}
+				if err := task.Decode(&payload); err != nil || payload.RecipeID != 1 {
+					t.Errorf("unexpected payload: %v, %v", payload, err)
+				}
+				task.SetProgress(150)
+				if test.handlerPanic {
+					panic("boom")
+				}
+				return test.handlerResult, test.handlerError
+			})
+
+			job := &db.JobWithInput{
+				Job:     models.Job{ID: new(int64(5)), Kind: test.kind, State: models.JobRunning, Attempts: test.attempts, MaxAttempts: 3},
+				Payload: `{"recipeId":1}`,
+			}
+			jobDriver.EXPECT().Claim(gomock.Any(), gomock.Any()).Return(job, nil)
+			if test.kind == models.JobUploadImage {
+				jobDriver.EXPECT().UpdateProgress(gomock.Any(), int64(5), test.attempts, 100).Return(nil)
+			}
+			switch {
+			case test.handlerError == nil && !test.handlerPanic && test.kind == models.JobUploadImage:
+				jobDriver.EXPECT().Complete(gomock.Any(), int64(5), test.attempts, test.handlerResult).Return(nil)
+			case test.expectRetry:
+				jobDriver.EXPECT().Fail(gomock.Any(), int64(5), test.attempts, gomock.Any(), gomock.Not(gomock.Nil())).Return(nil)
+			default:
+				jobDriver.EXPECT().Fail(gomock.Any(), int64(5), test.attempts, gomock.Any(), gomock.Nil()).Return(nil)
+			}
+
+			// Act
+			ran := sut.runNext(t.Context())
+
+			// Assert
+			if !ran {
+				t.Error("expected a job to run")
+			}
+		})
+	}
+}
+
+func Test_runNext_NoJobs(t *testing.T) {
+	type testArgs struct {
+		name    string
+		dbError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"None Ready", db.ErrNotFound},
+		{"DB Error", errors.New("db error")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			sut, jobDriver := getMockQueue(t, ctrl)
+
+			jobDriver.EXPECT().Claim(gomock.Any(), gomock.Any()).Return(nil, test.dbError)
+
+			// Act
+			ran := sut.runNext(t.Context())
+
+			// Assert
+			if ran {
+				t.Error("expected no job to run")
+			}
+		})
+	}
+}
+
+func Test_runNext_Interrupted(t *testing.T) {
+	// Arrange
+	ctrl := gomock.NewController(t)
+	sut, jobDriver := getMockQueue(t, ctrl)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	sut.Register(models.JobCreateBackup, func(ctx context.Context, _ *Task) (string, error) {
+		cancel()
+		return "", ctx.Err()
+	})
+
+	job := &db.JobWithInput{Job: models.Job{ID: new(int64(5)), Kind: models.JobCreateBackup, Attempts: 1, MaxAttempts: 3}}
+	jobDriver.EXPECT().Claim(gomock.Any(), gomock.Any()).Return(job, nil)
+	// The job is neither completed nor failed, so that it runs again once it is stale
+
+	// Act
+	ran := sut.runNext(ctx)
+
+	// Assert
+	if !ran {
+		t.Error("expected a job to run")
+	}
+}
+
+func Test_Start(t *testing.T) {
+	type testArgs struct {
+		name          string
+		retentionDays int
+		dbError       error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Success", 0, nil},
+		{"With Retention", 7, nil},
+		{"Requeue Error", 0, errors.New("db error")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			sut, jobDriver := getMockQueue(t, ctrl)
+			sut.cfg.RetentionDays = test.retentionDays
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+
+			// Only the jobs that stopped being reported as in progress are requeued
+			start := time.Now().UTC()
+			jobDriver.EXPECT().Requeue(gomock.Any(), gomock.Any(), interruptedMessage).DoAndReturn(func(_ context.Context, staleBefore time.Time, _ string) error {
+				if expected := start.Add(-staleAfter); staleBefore.Before(expected) || staleBefore.After(expected.Add(time.Minute)) {
+					t.Errorf("unexpected stale time: %v", staleBefore)
+				}
+				return test.dbError
+			})
+			if test.dbError == nil && test.retentionDays > 0 {
+				jobDriver.EXPECT().Prune(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, finishedBefore time.Time) (int64, error) {
+					if expected := start.AddDate(0, 0, -test.retentionDays); finishedBefore.Before(expected) || finishedBefore.After(expected.Add(time.Minute)) {
+						t.Errorf("unexpected finish time: %v", finishedBefore)
+					}
+					return 2, nil
+				})
+			}
+			claimed := make(chan struct{}, 2)
+			if test.dbError == nil {
+				jobDriver.EXPECT().Claim(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(context.Context, time.Time) (*db.JobWithInput, error) {
+					select {
+					case claimed <- struct{}{}:
+					default:
+					}
+					return nil, db.ErrNotFound
+				})
+			}
+
+			// Act
+			err := sut.Start(ctx)
+
+			// Assert
+			if (err != nil) != (test.dbError != nil) {
+				t.Errorf("expected error: %v, received error: %v", test.dbError, err)
+			}
+			if err == nil {
+				// Both workers check for jobs right away
+				for range 2 {
+					<-claimed
+				}
+			}
+			cancel()
+			sut.Wait()
+		})
+	}
+}
+
+func Test_getRetryDelay(t *testing.T) {
+	type testArgs struct {
+		attempts int
+		expected time.Duration
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{1, retryDelay},
+		{2, 2 * retryDelay},
+		{3, 4 * retryDelay},
+		{100, maxRetryDelay},
+	}
+	for _, test := range tests {
+		t.Run(test.expected.String(), func(t *testing.T) {
+			// Act
+			actual := getRetryDelay(test.attempts)
+
+			// Assert
+			if actual != test.expected {
+				t.Errorf("expected delay: %v, received: %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_IsPermanent(t *testing.T) {
+	type testArgs struct {
+		name     string
+		err      error
+		expected bool
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Plain", errors.New("oops"), false},
+		{"Permanent", Permanent(errors.New("invalid")), true},
+		{"Wrapped", fmt.Errorf("saving: %w", Permanent(errors.New("invalid"))), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Act
+			actual := IsPermanent(test.err)
+
+			// Assert
+			if actual != test.expected {
+				t.Errorf("expected: %v, received: %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func getMockQueue(t *testing.T, ctrl *gomock.Controller) (*Queue, *dbmock.MockJobDriver) {
+	t.Helper()
+
+	jobDriver := dbmock.NewMockJobDriver(ctrl)
+	queue, err := CreateQueue(jobDriver, Config{Workers: 2, MaxAttempts: 3})
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+	return queue, jobDriver
+}
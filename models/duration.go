@@ -0,0 +1,150 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration represents an amount of time, such as the time it takes to make a recipe.
+// It is represented as an ISO 8601 duration (e.g., "PT1H30M") in JSON and query parameters,
+// and as a whole number of seconds in the database.
+type Duration time.Duration
+
+// ErrInvalidDuration is returned when a value cannot be parsed as an ISO 8601 duration
+var ErrInvalidDuration = errors.New("invalid ISO 8601 duration")
+
+// The ISO 8601 designators that are supported, along with the amount of time each represents.
+// Years and months are not supported, since they don't represent a fixed amount of time.
+var (
+	durationDateUnits = map[byte]time.Duration{
+		'W': 7 * 24 * time.Hour,
+		'D': 24 * time.Hour,
+	}
+	durationTimeUnits = map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+	}
+)
+
+// ParseDuration parses an ISO 8601 duration, e.g., "PT45M", "PT1H30M", or "P1DT2H".
+// Only weeks, days, hours, minutes, and seconds are supported, and only the smallest
+// designator specified may have a fractional value.
+func ParseDuration(text string) (Duration, error) {
+	rest, ok := strings.CutPrefix(strings.ToUpper(strings.TrimSpace(text)), "P")
+	if !ok || rest == "" || strings.HasSuffix(rest, "T") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidDuration, text)
+	}
+
+	var total time.Duration
+	units := durationDateUnits
+	inTime := false
+	fractional := false
+	for rest != "" {
+		if after, ok := strings.CutPrefix(rest, "T"); ok {
+			if inTime {
+				return 0, fmt.Errorf("%w: %q", ErrInvalidDuration, text)
+			}
+			units = durationTimeUnits
+			inTime = true
+			rest = after
+			continue
+		}
+
+		end := strings.IndexFunc(rest, func(r rune) bool { return (r < '0' || r > '9') && r != '.' && r != ',' })
+		if end <= 0 || fractional {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidDuration, text)
+		}
+		unit, ok := units[rest[end]]
+		if !ok {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidDuration, text)
+		}
+		amount, err := strconv.ParseFloat(strings.ReplaceAll(rest[:end], ",", "."), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidDuration, text)
+		}
+
+		total += time.Duration(amount * float64(unit))
+		fractional = amount != float64(int64(amount))
+		rest = rest[end+1:]
+	}
+
+	return Duration(total), nil
+}
+
+// String formats the duration in ISO 8601, e.g., "PT1H30M".
+// Durations longer than a day include the number of days, e.g., "P1DT2H".
+func (d Duration) String() string {
+	remaining := time.Duration(d).Round(time.Second)
+	if remaining <= 0 {
+		return "PT0S"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("P")
+	if days := remaining / (24 * time.Hour); days > 0 {
+		fmt.Fprintf(&sb, "%dD", days)
+		remaining -= days * 24 * time.Hour
+	}
+	if remaining > 0 {
+		sb.WriteString("T")
+		for _, unit := range []struct {
+			designator string
+			size       time.Duration
+		}{{"H", time.Hour}, {"M", time.Minute}, {"S", time.Second}} {
+			if amount := remaining / unit.size; amount > 0 {
+				fmt.Fprintf(&sb, "%d%s", amount, unit.designator)
+				remaining -= amount * unit.size
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner, reading the duration as a number of seconds
+func (d *Duration) Scan(src any) error {
+	var seconds int64
+	switch val := src.(type) {
+	case int64:
+		seconds = val
+	case float64:
+		seconds = int64(val)
+	case []byte:
+		parsed, err := strconv.ParseInt(string(val), 10, 64)
+		if err != nil {
+			return err
+		}
+		seconds = parsed
+	default:
+		return fmt.Errorf("unsupported type for duration: %T", src)
+	}
+
+	*d = Duration(time.Duration(seconds) * time.Second)
+	return nil
+}
+
+// Value implements driver.Valuer, storing the duration as a number of seconds
+func (d Duration) Value() (driver.Value, error) {
+	return int64(time.Duration(d) / time.Second), nil
+}
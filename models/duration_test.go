@@ -0,0 +1,148 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_ParseDuration(t *testing.T) {
+	type testArgs struct {
+		text          string
+		expected      time.Duration
+		expectedError error
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"PT45M", 45 * time.Minute, nil},
+		{"PT1H30M", 90 * time.Minute, nil},
+		{"pt1h30m", 90 * time.Minute, nil},
+		{"P1DT2H", 26 * time.Hour, nil},
+		{"P1W", 7 * 24 * time.Hour, nil},
+		{"PT1.5H", 90 * time.Minute, nil},
+		{"PT0,5M", 30 * time.Second, nil},
+		{"PT90S", 90 * time.Second, nil},
+		{"PT0S", 0, nil},
+		{"", 0, ErrInvalidDuration},
+		{"P", 0, ErrInvalidDuration},
+		{"PT", 0, ErrInvalidDuration},
+		{"P1DT", 0, ErrInvalidDuration},
+		{"45M", 0, ErrInvalidDuration},
+		{"P1M", 0, ErrInvalidDuration},
+		{"P1Y", 0, ErrInvalidDuration},
+		{"PT1.5H30M", 0, ErrInvalidDuration},
+		{"PT1HT30M", 0, ErrInvalidDuration},
+		{"PTH", 0, ErrInvalidDuration},
+		{"PT-5M", 0, ErrInvalidDuration},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			// Act
+			d, err := ParseDuration(test.text)
+
+			// Assert
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error: %v, received error: %v", test.expectedError, err)
+			}
+			if time.Duration(d) != test.expected {
+				t.Errorf("expected %v, received %v", test.expected, time.Duration(d))
+			}
+		})
+	}
+}
+
+func Test_Duration_String(t *testing.T) {
+	type testArgs struct {
+		duration time.Duration
+		expected string
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{0, "PT0S"},
+		{45 * time.Minute, "PT45M"},
+		{90 * time.Minute, "PT1H30M"},
+		{2 * time.Hour, "PT2H"},
+		{26*time.Hour + 5*time.Second, "P1DT2H5S"},
+		{48 * time.Hour, "P2D"},
+		{1500 * time.Millisecond, "PT2S"},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			// Act
+			actual := Duration(test.duration).String()
+
+			// Assert
+			if actual != test.expected {
+				t.Errorf("expected %s, received %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_Duration_JSON(t *testing.T) {
+	// Arrange
+	recipe := Recipe{Name: "Soup", TotalTime: new(Duration(75 * time.Minute))}
+
+	// Act
+	data, err := json.Marshal(recipe)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded Recipe
+	err = json.Unmarshal(data, &decoded)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded.TotalTime == nil || *decoded.TotalTime != *recipe.TotalTime {
+		t.Errorf("expected %v, received %v", *recipe.TotalTime, decoded.TotalTime)
+	}
+	if decoded.PrepTime != nil {
+		t.Errorf("expected no prep time, received %v", *decoded.PrepTime)
+	}
+	if err := json.Unmarshal([]byte(`{"totalTime":"45 minutes"}`), &decoded); !errors.Is(err, ErrInvalidDuration) {
+		t.Errorf("expected error: %v, received error: %v", ErrInvalidDuration, err)
+	}
+}
+
+func Test_Duration_Scan(t *testing.T) {
+	type testArgs struct {
+		name        string
+		src         any
+		expected    time.Duration
+		expectError bool
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"int64", int64(2700), 45 * time.Minute, false},
+		{"float64", float64(60), time.Minute, false},
+		{"bytes", []byte("3600"), time.Hour, false},
+		{"string", "PT1H", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var d Duration
+
+			// Act
+			err := d.Scan(test.src)
+
+			// Assert
+			if (err != nil) != test.expectError {
+				t.Errorf("expected error: %v, received error: %v", test.expectError, err)
+			}
+			if time.Duration(d) != test.expected {
+				t.Errorf("expected %v, received %v", test.expected, time.Duration(d))
+			}
+			if !test.expectError {
+				if value, _ := d.Value(); value != int64(test.expected/time.Second) {
+					t.Errorf("expected value %d, received %v", int64(test.expected/time.Second), value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package nutrition
+
+import (
+	"errors"
+)
+
+const (
+	// DatabaseUSDA is the name of the bundled nutrient database
+	DatabaseUSDA = "usda"
+
+	// DatabaseNone disables nutrition estimates
+	DatabaseNone = "none"
+)
+
+// Config represents the nutrition estimate configuration settings
+type Config struct {
+	// Database gets the nutrient database used to estimate the nutrition of recipes from their ingredients.
+	// Use "usda" for the bundled subset of the USDA FoodData Central database, "none" to disable estimates,
+	// or the path to a CSV file in the same format as the bundled database.
+	Database string `env:"NUTRITION_DATABASE" default:"usda"`
+}
+
+func (c Config) validate() error {
+	errs := make([]error, 0)
+
+	if c.Database == "" {
+		errs = append(errs, errors.New("nutrition database must be specified"))
+	}
+
+	return errors.Join(errs...)
+}
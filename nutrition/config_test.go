@@ -0,0 +1,42 @@
+package nutrition
+
+import "testing"
+
+func TestConfig_validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string
+		wantErr  bool
+	}{
+		{
+			name:     "Bundled",
+			database: DatabaseUSDA,
+			wantErr:  false,
+		},
+		{
+			name:     "Disabled",
+			database: DatabaseNone,
+			wantErr:  false,
+		},
+		{
+			name:     "Custom",
+			database: "/path/to/foods.csv",
+			wantErr:  false,
+		},
+		{
+			name:     "Empty",
+			database: "",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{
+				Database: tt.database,
+			}
+			if got := c.validate(); tt.wantErr != (got != nil) {
+				t.Errorf("Config.validate() = %v, want error? %v", got, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package nutrition
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chadweimer/gomp/plaintext"
+)
+
+// usdaCSV is a subset of common foods from the USDA FoodData Central database (https://fdc.nal.usda.gov/),
+// in the format that LoadDatabase expects
+//
+//go:embed usda.csv
+var usdaCSV []byte
+
+// The columns that every nutrient database must include
+var requiredColumns = []string{"name", "calories", "protein", "fat", "carbohydrates", "fiber", "sodium", "sugar"}
+
+// nutrients are the amounts of each nutrient in some quantity of food
+type nutrients struct {
+	calories      float64
+	protein       float64
+	fat           float64
+	carbohydrates float64
+	fiber         float64
+	sodium        float64
+	sugar         float64
+}
+
+func (n nutrients) add(other nutrients) nutrients {
+	return nutrients{
+		calories:      n.calories + other.calories,
+		protein:       n.protein + other.protein,
+		fat:           n.fat + other.fat,
+		carbohydrates: n.carbohydrates + other.carbohydrates,
+		fiber:         n.fiber + other.fiber,
+		sodium:        n.sodium + other.sodium,
+		sugar:         n.sugar + other.sugar,
+	}
+}
+
+func (n nutrients) scale(factor float64) nutrients {
+	return nutrients{
+		calories:      n.calories * factor,
+		protein:       n.protein * factor,
+		fat:           n.fat * factor,
+		carbohydrates: n.carbohydrates * factor,
+		fiber:         n.fiber * factor,
+		sodium:        n.sodium * factor,
+		sugar:         n.sugar * factor,
+	}
+}
+
+// food is an entry in a nutrient database
+type food struct {
+	name string
+
+	// per100g are the nutrients in 100 grams of the food
+	per100g nutrients
+
+	// gramsPerEach is the weight of a single item of the food (e.g., an egg or a clove of garlic),
+	// or zero if the food isn't measured by count
+	gramsPerEach float64
+
+	// gramsPerCup is the weight of a cup of the food, or zero if the food isn't measured by volume
+	gramsPerCup float64
+}
+
+// foodName is one of the names a food can be referred to by in an ingredient
+type foodName struct {
+	words []string
+	food  *food
+}
+
+// Database is a set of foods and their nutrients, used to estimate the nutrition of recipes
+type Database struct {
+	// The names of all the foods, with the longest names first
+	// so that the most specific match is always found first
+	names []foodName
+}
+
+// CreateDatabase returns the nutrient database specified by the configuration,
+// or nil if nutrition estimates are disabled
+func CreateDatabase(cfg Config) (*Database, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Database {
+	case DatabaseNone:
+		return nil, nil
+	case DatabaseUSDA:
+		return LoadDatabase(bytes.NewReader(usdaCSV))
+	default:
+		f, err := os.Open(cfg.Database)
+		if err != nil {
+			return nil, fmt.Errorf("opening nutrient database: %w", err)
+		}
+		defer f.Close()
+
+		return LoadDatabase(f)
+	}
+}
+
+// LoadDatabase reads a nutrient database from CSV, with a header row naming the columns.
+// The name, calories, protein, fat, carbohydrates, fiber, sodium, and sugar columns are required.
+// Nutrients are per 100 grams of the food, with energy in kilocalories, sodium in milligrams,
+// and everything else in grams. The optional aliases column lists other names for the food,
+// separated by semicolons, and the optional grams_per_each and grams_per_cup columns
+// allow the food to be measured by count and by volume, respectively.
+func LoadDatabase(r io.Reader) (*Database, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading nutrient database header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	missing := make([]error, 0)
+	for _, column := range requiredColumns {
+		if _, ok := columns[column]; !ok {
+			missing = append(missing, fmt.Errorf("nutrient database is missing the %s column", column))
+		}
+	}
+	if err := errors.Join(missing...); err != nil {
+		return nil, err
+	}
+
+	db := &Database{names: make([]foodName, 0)}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading nutrient database: %w", err)
+		}
+
+		f, aliases, err := parseFood(record, columns)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("reading nutrient database line %d: %w", line, err)
+		}
+
+		for _, name := range append([]string{f.name}, aliases...) {
+			if words := plaintext.Words(name); len(words) > 0 {
+				db.names = append(db.names, foodName{words: words, food: f})
+			}
+		}
+	}
+
+	slices.SortStableFunc(db.names, func(a, b foodName) int {
+		return len(b.words) - len(a.words)
+	})
+
+	return db, nil
+}
+
+func parseFood(record []string, columns map[string]int) (*food, []string, error) {
+	value := func(column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	number := func(column string) (float64, error) {
+		text := value(column)
+		if text == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid %s '%s'", column, text)
+		}
+		return n, nil
+	}
+
+	f := &food{name: value("name")}
+	if f.name == "" {
+		return nil, nil, errors.New("name is required")
+	}
+
+	errs := make([]error, 0)
+	for _, field := range []struct {
+		column string
+		dest   *float64
+	}{
+		{"calories", &f.per100g.calories},
+		{"protein", &f.per100g.protein},
+		{"fat", &f.per100g.fat},
+		{"carbohydrates", &f.per100g.carbohydrates},
+		{"fiber", &f.per100g.fiber},
+		{"sodium", &f.per100g.sodium},
+		{"sugar", &f.per100g.sugar},
+		{"grams_per_each", &f.gramsPerEach},
+		{"grams_per_cup", &f.gramsPerCup},
+	} {
+		n, err := number(field.column)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		*field.dest = n
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+
+	aliases := make([]string, 0)
+	for alias := range strings.SplitSeq(value("aliases"), ";") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	return f, aliases, nil
+}
+
+// find returns the food with the longest name that appears in the words, if any
+func (db *Database) find(words []string) *food {
+	for _, name := range db.names {
+		for i := 0; i+len(name.words) <= len(words); i++ {
+			if slices.Equal(words[i:i+len(name.words)], name.words) {
+				return name.food
+			}
+		}
+	}
+	return nil
+}
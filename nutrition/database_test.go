@@ -0,0 +1,103 @@
+package nutrition
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chadweimer/gomp/plaintext"
+)
+
+func Test_CreateDatabase(t *testing.T) {
+	custom := filepath.Join(t.TempDir(), "foods.csv")
+	if err := os.WriteFile(custom, []byte("name,calories,protein,fat,carbohydrates,fiber,sodium,sugar\nwidget,100,1,2,3,4,5,6\n"), 0o600); err != nil {
+		t.Fatalf("failed to write custom database: %v", err)
+	}
+
+	type testArgs struct {
+		name        string
+		database    string
+		expectedNil bool
+		expectedErr bool
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{name: "Bundled", database: DatabaseUSDA},
+		{name: "Disabled", database: DatabaseNone, expectedNil: true},
+		{name: "Custom", database: custom},
+		{name: "Missing file", database: filepath.Join(t.TempDir(), "missing.csv"), expectedNil: true, expectedErr: true},
+		{name: "Invalid configuration", database: "", expectedNil: true, expectedErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Act
+			db, err := CreateDatabase(Config{Database: test.database})
+
+			// Assert
+			if test.expectedErr != (err != nil) {
+				t.Errorf("expected error? %v, received error: %v", test.expectedErr, err)
+			}
+			if test.expectedNil != (db == nil) {
+				t.Errorf("expected nil database? %v, received: %v", test.expectedNil, db)
+			}
+		})
+	}
+}
+
+func Test_LoadDatabase_Errors(t *testing.T) {
+	// Arrange
+	tests := map[string]string{
+		"Empty":            "",
+		"Missing column":   "name,calories,protein,fat,carbohydrates,fiber,sodium\nwidget,1,1,1,1,1,1\n",
+		"Missing name":     "name,calories,protein,fat,carbohydrates,fiber,sodium,sugar\n,1,1,1,1,1,1,1\n",
+		"Invalid number":   "name,calories,protein,fat,carbohydrates,fiber,sodium,sugar\nwidget,lots,1,1,1,1,1,1\n",
+		"Negative number":  "name,calories,protein,fat,carbohydrates,fiber,sodium,sugar\nwidget,-1,1,1,1,1,1,1\n",
+		"Malformed record": "name,calories,protein,fat,carbohydrates,fiber,sodium,sugar\n\"widget,1,1,1,1,1,1,1\n",
+	}
+	for name, csv := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			db, err := LoadDatabase(strings.NewReader(csv))
+
+			// Assert
+			if err == nil {
+				t.Errorf("expected an error, received database: %v", db)
+			}
+		})
+	}
+}
+
+func Test_Database_find(t *testing.T) {
+	db, err := LoadDatabase(strings.NewReader(string(usdaCSV)))
+	if err != nil {
+		t.Fatalf("failed to load bundled database: %v", err)
+	}
+
+	// Arrange
+	tests := map[string]string{
+		"boneless chicken thighs":  "chicken thigh",
+		"chicken":                  "chicken",
+		"low sodium chicken broth": "chicken broth",
+		"extra virgin olive oil":   "olive oil",
+		"garbanzo beans, drained":  "chickpeas",
+		"packed brown sugar":       "brown sugar",
+		"unobtainium":              "",
+	}
+	for text, expected := range tests {
+		t.Run(text, func(t *testing.T) {
+			// Act
+			f := db.find(plaintext.Words(text))
+
+			// Assert
+			name := ""
+			if f != nil {
+				name = f.name
+			}
+			if name != expected {
+				t.Errorf("expected food: '%s', received: '%s'", expected, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package nutrition
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/chadweimer/gomp/models"
+	"github.com/chadweimer/gomp/plaintext"
+)
+
+type unitKind int
+
+const (
+	unitMass unitKind = iota
+	unitVolume
+	unitCount
+)
+
+// unit is a unit of measure in an ingredient, along with how much it represents
+// in grams, cups, or items, depending on its kind
+type unit struct {
+	kind   unitKind
+	amount float64
+}
+
+// The supported units of measure, keyed by each way they can be written
+var units = map[string]unit{
+	"g":          {unitMass, 1},
+	"gram":       {unitMass, 1},
+	"kg":         {unitMass, 1000},
+	"kilogram":   {unitMass, 1000},
+	"oz":         {unitMass, 28.35},
+	"ounce":      {unitMass, 28.35},
+	"lb":         {unitMass, 453.6},
+	"lbs":        {unitMass, 453.6},
+	"pound":      {unitMass, 453.6},
+	"ml":         {unitVolume, 1 / 236.6},
+	"milliliter": {unitVolume, 1 / 236.6},
+	"l":          {unitVolume, 1000 / 236.6},
+	"liter":      {unitVolume, 1000 / 236.6},
+	"tsp":        {unitVolume, 1.0 / 48},
+	"teaspoon":   {unitVolume, 1.0 / 48},
+	"tbsp":       {unitVolume, 1.0 / 16},
+	"tablespoon": {unitVolume, 1.0 / 16},
+	"c":          {unitVolume, 1},
+	"cup":        {unitVolume, 1},
+	"pint":       {unitVolume, 2},
+	"pt":         {unitVolume, 2},
+	"quart":      {unitVolume, 4},
+	"qt":         {unitVolume, 4},
+	"gallon":     {unitVolume, 16},
+	"gal":        {unitVolume, 16},
+	"can":        {unitCount, 1},
+	"clove":      {unitCount, 1},
+	"slice":      {unitCount, 1},
+	"stalk":      {unitCount, 1},
+	"stick":      {unitCount, 1},
+	"head":       {unitCount, 1},
+	"whole":      {unitCount, 1},
+	"large":      {unitCount, 1},
+	"medium":     {unitCount, 1},
+	"small":      {unitCount, 1},
+	"piece":      {unitCount, 1},
+	"fillet":     {unitCount, 1},
+	"ear":        {unitCount, 1},
+	"package":    {unitCount, 1},
+	"pkg":        {unitCount, 1},
+	"block":      {unitCount, 1},
+	"bunch":      {unitCount, 1},
+	"container":  {unitCount, 1},
+	"jar":        {unitCount, 1},
+	"bag":        {unitCount, 1},
+}
+
+// The values of the unicode vulgar fractions
+var unicodeFractions = map[rune]float64{
+	'¼': 1.0 / 4, '½': 1.0 / 2, '¾': 3.0 / 4,
+	'⅓': 1.0 / 3, '⅔': 2.0 / 3,
+	'⅕': 1.0 / 5, '⅖': 2.0 / 5, '⅗': 3.0 / 5, '⅘': 4.0 / 5,
+	'⅙': 1.0 / 6, '⅚': 5.0 / 6,
+	'⅛': 1.0 / 8, '⅜': 3.0 / 8, '⅝': 5.0 / 8, '⅞': 7.0 / 8,
+}
+
+// Matches parenthetical notes in an ingredient, e.g., the "(15 oz)" in "1 (15 oz) can chickpeas"
+var parentheticalPattern = regexp.MustCompile(`\([^)]*\)`)
+
+// Estimate estimates the nutrition of a single serving of a recipe from its ingredients, one per line or list item,
+// and its serving size (e.g., "4 servings"). A recipe is assumed to make a single serving
+// if the number of servings can't be determined.
+func (db *Database) Estimate(ingredients string, servingSize string) models.NutritionEstimate {
+	estimate := models.NutritionEstimate{
+		Servings:    float32(parseServings(servingSize)),
+		Ingredients: make([]models.IngredientEstimate, 0),
+		Unmatched:   make([]string, 0),
+	}
+
+	var total nutrients
+	for _, line := range plaintext.Lines(ingredients) {
+		// Skip section headings, e.g., "For the sauce:"
+		if strings.HasSuffix(line, ":") {
+			continue
+		}
+
+		f, grams, ok := db.estimateIngredient(line)
+		if !ok {
+			estimate.Unmatched = append(estimate.Unmatched, line)
+			continue
+		}
+
+		total = total.add(f.per100g.scale(grams / 100))
+		estimate.Ingredients = append(estimate.Ingredients, models.IngredientEstimate{
+			Ingredient: line,
+			Food:       f.name,
+			Grams:      round(grams),
+		})
+	}
+
+	perServing := total.scale(1 / float64(estimate.Servings))
+	estimate.Nutrition = models.Nutrition{
+		Calories:      new(round(perServing.calories)),
+		Protein:       new(round(perServing.protein)),
+		Fat:           new(round(perServing.fat)),
+		Carbohydrates: new(round(perServing.carbohydrates)),
+		Fiber:         new(round(perServing.fiber)),
+		Sodium:        new(round(perServing.sodium)),
+		Sugar:         new(round(perServing.sugar)),
+	}
+
+	return estimate
+}
+
+// estimateIngredient returns the food that the ingredient refers to, along with its weight in grams
+func (db *Database) estimateIngredient(ingredient string) (*food, float64, bool) {
+	text := parentheticalPattern.ReplaceAllString(strings.ToLower(ingredient), " ")
+	quantity, rest, ok := parseQuantity(text)
+	if !ok {
+		return nil, 0, false
+	}
+
+	// The unit, if any, is the next word
+	u := unit{unitCount, 1}
+	if word, after, _ := strings.Cut(strings.TrimSpace(rest), " "); word != "" {
+		word = strings.TrimRight(word, ".,")
+		if known, ok := units[plaintext.Singularize(word)]; ok {
+			u = known
+			rest = after
+		}
+	}
+
+	f := db.find(plaintext.Words(rest))
+	if f == nil {
+		return nil, 0, false
+	}
+
+	var grams float64
+	switch u.kind {
+	case unitMass:
+		grams = quantity * u.amount
+	case unitVolume:
+		grams = quantity * u.amount * f.gramsPerCup
+	case unitCount:
+		grams = quantity * u.amount * f.gramsPerEach
+	}
+	if grams <= 0 {
+		return nil, 0, false
+	}
+
+	return f, grams, true
+}
+
+// parseQuantity parses the amount at the start of the text, e.g., "2", "1.5", "1 1/2", "1½", or "2-3",
+// returning the amount along with the rest of the text. Ranges are averaged.
+func parseQuantity(text string) (float64, string, bool) {
+	amount, rest, ok := parseNumber(text)
+	if !ok {
+		return 0, text, false
+	}
+
+	// Mixed numbers, e.g., "1 1/2"
+	if trimmed := strings.TrimLeft(rest, " "); trimmed != rest {
+		if fraction, after, ok := parseNumber(trimmed); ok && fraction < 1 {
+			amount += fraction
+			rest = after
+		}
+	}
+
+	// Ranges, e.g., "2-3" or "2 to 3"
+	for _, separator := range []string{"-", "–", " - ", " to "} {
+		if after, found := strings.CutPrefix(rest, separator); found {
+			if upper, after, ok := parseQuantity(strings.TrimLeft(after, " ")); ok && upper >= amount {
+				return (amount + upper) / 2, after, true
+			}
+		}
+	}
+
+	return amount, rest, amount > 0
+}
+
+// parseNumber parses a single number at the start of the text, e.g., "2", "1.5", "1/2", "½", or "1½"
+func parseNumber(text string) (float64, string, bool) {
+	end := strings.IndexFunc(text, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.' && r != '/'
+	})
+	if end < 0 {
+		end = len(text)
+	}
+	digits, rest := text[:end], text[end:]
+
+	var amount float64
+	if digits != "" {
+		numerator, denominator, isFraction := strings.Cut(digits, "/")
+		n, err := strconv.ParseFloat(numerator, 64)
+		if err != nil {
+			return 0, text, false
+		}
+		if isFraction {
+			d, err := strconv.ParseFloat(denominator, 64)
+			if err != nil || d == 0 {
+				return 0, text, false
+			}
+			n /= d
+		}
+		amount = n
+	}
+
+	// A trailing unicode fraction, e.g., "½" or "1½"
+	for r, value := range unicodeFractions {
+		if after, found := strings.CutPrefix(rest, string(r)); found {
+			amount += value
+			rest = after
+			digits += string(r)
+			break
+		}
+	}
+
+	if digits == "" {
+		return 0, text, false
+	}
+	return amount, rest, true
+}
+
+// parseServings returns the first number in the serving size, e.g., 4 for "Serves 4", or 1 if there isn't one
+func parseServings(servingSize string) float64 {
+	text := strings.ToLower(servingSize)
+	for i := range text {
+		if amount, _, ok := parseQuantity(text[i:]); ok && amount > 0 {
+			return amount
+		}
+	}
+	return 1
+}
+
+// round rounds the value to a single decimal place
+func round(value float64) float32 {
+	return float32(math.Round(value*10) / 10)
+}
@@ -0,0 +1,136 @@
+package nutrition
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chadweimer/gomp/models"
+)
+
+const testDatabaseCSV = `name,aliases,calories,protein,fat,carbohydrates,fiber,sodium,sugar,grams_per_each,grams_per_cup
+chicken thigh,,121,19.7,4.1,0,0,95,0,110,140
+olive oil,,884,0,100,0,0,2,0,,216
+garlic,,149,6.4,0.5,33.1,2.1,17,1,3,136
+lemon,,29,1.1,0.3,9.3,2.8,2,2.5,58,
+salt,,0,0,0,0,0,38758,0,,292
+`
+
+func Test_Database_Estimate(t *testing.T) {
+	type testArgs struct {
+		name        string
+		ingredients string
+	}
+
+	// Arrange
+	db, err := LoadDatabase(strings.NewReader(testDatabaseCSV))
+	if err != nil {
+		t.Fatalf("failed to load database: %v", err)
+	}
+	tests := []testArgs{
+		{"Plain Text", "For the chicken:\n1.5 lb chicken thighs\n2 tbsp olive oil\n3 cloves garlic\n\n1 lemon\nsalt to taste\n1 cup unobtainium"},
+		{
+			"HTML",
+			"<p>For the chicken:</p><ul><li>1.5 lb chicken thighs</li><li>2 tbsp <b>olive oil</b></li><li>3 cloves&nbsp;garlic</li></ul>" +
+				"<p><br></p><ul><li>1 lemon</li><li>salt to taste</li><li>1 cup unobtainium</li></ul>",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Act
+			estimate := db.Estimate(test.ingredients, "4 servings")
+
+			// Assert
+			if estimate.Servings != 4 {
+				t.Errorf("expected 4 servings, received %v", estimate.Servings)
+			}
+			expectedIngredients := []models.IngredientEstimate{
+				{Ingredient: "1.5 lb chicken thighs", Food: "chicken thigh", Grams: 680.4},
+				{Ingredient: "2 tbsp olive oil", Food: "olive oil", Grams: 27},
+				{Ingredient: "3 cloves garlic", Food: "garlic", Grams: 9},
+				{Ingredient: "1 lemon", Food: "lemon", Grams: 58},
+			}
+			if !reflect.DeepEqual(estimate.Ingredients, expectedIngredients) {
+				t.Errorf("expected ingredients: %v, received: %v", expectedIngredients, estimate.Ingredients)
+			}
+			expectedUnmatched := []string{"salt to taste", "1 cup unobtainium"}
+			if !reflect.DeepEqual(estimate.Unmatched, expectedUnmatched) {
+				t.Errorf("expected unmatched: %v, received: %v", expectedUnmatched, estimate.Unmatched)
+			}
+			// (680.4*1.21 + 27*8.84 + 9*1.49 + 58*0.29) / 4
+			if calories := *estimate.Nutrition.Calories; math.Abs(float64(calories)-273.0) > 0.1 {
+				t.Errorf("expected 273 calories, received %v", calories)
+			}
+			// (680.4*0.197 + 9*0.064 + 58*0.011) / 4
+			if protein := *estimate.Nutrition.Protein; math.Abs(float64(protein)-33.8) > 0.1 {
+				t.Errorf("expected 33.8 g of protein, received %v", protein)
+			}
+		})
+	}
+}
+
+func Test_parseQuantity(t *testing.T) {
+	type testArgs struct {
+		text         string
+		expected     float64
+		expectedRest string
+		expectedOk   bool
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"2 cups flour", 2, " cups flour", true},
+		{"1.5 lb chicken", 1.5, " lb chicken", true},
+		{"1/2 tsp salt", 0.5, " tsp salt", true},
+		{"1 1/2 cups milk", 1.5, " cups milk", true},
+		{"½ cup sugar", 0.5, " cup sugar", true},
+		{"1½ cups water", 1.5, " cups water", true},
+		{"1 ½ cups water", 1.5, " cups water", true},
+		{"2-3 cloves garlic", 2.5, " cloves garlic", true},
+		{"2 to 4 eggs", 3, " eggs", true},
+		{"2 12 oz cans", 2, " 12 oz cans", true},
+		{"salt to taste", 0, "salt to taste", false},
+		{"1/0 cup", 0, "1/0 cup", false},
+		{"0 eggs", 0, " eggs", false},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			// Act
+			amount, rest, ok := parseQuantity(test.text)
+
+			// Assert
+			if ok != test.expectedOk {
+				t.Fatalf("expected ok: %v, received: %v", test.expectedOk, ok)
+			}
+			if math.Abs(amount-test.expected) > 1e-9 {
+				t.Errorf("expected amount: %v, received: %v", test.expected, amount)
+			}
+			if rest != test.expectedRest {
+				t.Errorf("expected rest: '%s', received: '%s'", test.expectedRest, rest)
+			}
+		})
+	}
+}
+
+func Test_parseServings(t *testing.T) {
+	// Arrange
+	tests := map[string]float64{
+		"4 servings": 4,
+		"Serves 6-8": 7,
+		"12 cookies": 12,
+		"one pan":    1,
+		"":           1,
+	}
+	for servingSize, expected := range tests {
+		t.Run(servingSize, func(t *testing.T) {
+			// Act
+			servings := parseServings(servingSize)
+
+			// Assert
+			if servings != expected {
+				t.Errorf("expected %v servings, received %v", expected, servings)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package plaintext
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// blockTagPattern matches the tags of elements that start a new line, e.g., the "<li>" and "</li>" of a list item
+var blockTagPattern = regexp.MustCompile(`(?i)</?(?:address|article|blockquote|br|dd|div|dl|dt|h[1-6]|hr|li|ol|p|pre|section|table|td|th|tr|ul)\b[^<>]*>`)
+
+// tagPattern matches any other tag, e.g., "<b>", or comment. A "<" that isn't followed by a letter, e.g., "< 5 minutes", isn't a tag.
+var tagPattern = regexp.MustCompile(`(?s)</?[a-zA-Z][^<>]*>|<!--.*?-->`)
+
+// Lines splits free-form text into lines of plain text, with any extra whitespace removed and blank lines skipped.
+// The text is either HTML, as saved by the editor, where each block element, e.g., a list item or paragraph,
+// and each line break is a separate line, or plain text, as saved by older versions, with one line per line.
+func Lines(text string) []string {
+	text = blockTagPattern.ReplaceAllString(text, "\n")
+	text = html.UnescapeString(tagPattern.ReplaceAllString(text, ""))
+
+	lines := make([]string, 0)
+	for line := range strings.Lines(text) {
+		// Fields also splits on non-breaking spaces, e.g., from "&nbsp;"
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Plain returns free-form text as a single line of plain text, with the lines of the text separated by spaces
+func Plain(text string) string {
+	return strings.Join(Lines(text), " ")
+}
@@ -0,0 +1,50 @@
+package plaintext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Lines(t *testing.T) {
+	type testArgs struct {
+		name     string
+		text     string
+		expected []string
+	}
+
+	// Arrange
+	tests := []testArgs{
+		{"Empty", "", []string{}},
+		{"Plain Text", "1 cup flour\n\n  2 eggs \r\n", []string{"1 cup flour", "2 eggs"}},
+		{"List", "<ul><li>1 cup flour</li><li>2 eggs</li></ul>", []string{"1 cup flour", "2 eggs"}},
+		{"Paragraphs", "<p>Mix.</p><p>Bake 20 minutes.</p>", []string{"Mix.", "Bake 20 minutes."}},
+		{"Divs and Breaks", "<div>For the sauce:</div><div>1 can tomatoes<br>1 clove garlic<br/></div>", []string{"For the sauce:", "1 can tomatoes", "1 clove garlic"}},
+		{"Inline Tags", "<ol><li><b>Mix</b> the <i>flour</i>.</li></ol>", []string{"Mix the flour."}},
+		{"Attributes", `<ol class="steps"><li data-step="1">Mix.</li></ol>`, []string{"Mix."}},
+		{"Entities", "<p>Salt &amp; pepper&nbsp;&nbsp;to taste</p>", []string{"Salt & pepper to taste"}},
+		{"Not a Tag", "Bake < 5 minutes, until > 160F", []string{"Bake < 5 minutes, until > 160F"}},
+		{"Comment", "<p>Mix.<!-- <li>not a step</li> --></p>", []string{"Mix."}},
+		{"Mixed", "1. Mix.\n<p>2. Bake.</p>", []string{"1. Mix.", "2. Bake."}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Act
+			lines := Lines(test.text)
+
+			// Assert
+			if !reflect.DeepEqual(lines, test.expected) {
+				t.Errorf("expected %q, received %q", test.expected, lines)
+			}
+		})
+	}
+}
+
+func Test_Plain(t *testing.T) {
+	// Act
+	text := Plain("<ul><li>1 cup flour</li><li>2 <b>eggs</b></li></ul>")
+
+	// Assert
+	if expected := "1 cup flour 2 eggs"; text != expected {
+		t.Errorf("expected %q, received %q", expected, text)
+	}
+}
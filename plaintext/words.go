@@ -0,0 +1,41 @@
+// Package plaintext splits the free-form text of recipes, e.g., their ingredients and directions,
+// into the lines and words they're made of.
+package plaintext
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Words splits the text into lowercase words, reducing plurals to their singular form
+func Words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	words := make([]string, 0, len(fields))
+	for _, field := range fields {
+		words = append(words, Singularize(field))
+	}
+	return words
+}
+
+// Singularize reduces a lowercase plural word to its singular form, e.g., "berries" to "berry"
+func Singularize(word string) string {
+	switch {
+	case len(word) <= 3 || strings.HasSuffix(word, "ss"):
+		return word
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "oes"),
+		strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"),
+		strings.HasSuffix(word, "sses"),
+		strings.HasSuffix(word, "xes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "s"):
+		return strings.TrimSuffix(word, "s")
+	default:
+		return word
+	}
+}
@@ -0,0 +1,30 @@
+package plaintext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Words(t *testing.T) {
+	// Arrange
+	tests := map[string][]string{
+		"2 cans chickpeas":      {"2", "can", "chickpea"},
+		"3 Tomatoes, diced":     {"3", "tomato", "diced"},
+		"1 cup fresh berries":   {"1", "cup", "fresh", "berry"},
+		"2 bunches of radishes": {"2", "bunch", "of", "radish"},
+		"2 glasses of water":    {"2", "glass", "of", "water"},
+		"1 tsp cress":           {"1", "tsp", "cress"},
+		"8 eggs":                {"8", "egg"},
+	}
+	for text, expected := range tests {
+		t.Run(text, func(t *testing.T) {
+			// Act
+			words := Words(text)
+
+			// Assert
+			if !reflect.DeepEqual(words, expected) {
+				t.Errorf("expected %v, received %v", expected, words)
+			}
+		})
+	}
+}
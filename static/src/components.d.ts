@@ -5,9 +5,9 @@
  * It contains typing information for all components that exist in this project.
  */
 import { HTMLStencilElement, JSXBase } from "@stencil/core/internal";
-import { Note, Recipe, RecipeCompact, SearchFilter, User } from "./generated";
+import { Note, Recipe, RecipeCompact, RecipeImage, SearchFilter, User } from "./generated";
 import { Color } from "@ionic/core";
-export { Note, Recipe, RecipeCompact, SearchFilter, User } from "./generated";
+export { Note, Recipe, RecipeCompact, RecipeImage, SearchFilter, User } from "./generated";
 export { Color } from "@ionic/core";
 export namespace Components {
     interface AppRoot {
@@ -158,6 +158,10 @@ export namespace Components {
           * @default []
          */
         "links": RecipeCompact[];
+        /**
+          * @default null
+         */
+        "mainImage": RecipeImage | null;
         /**
           * @default false
          */
@@ -658,6 +662,10 @@ declare namespace LocalJSX {
           * @default []
          */
         "links"?: RecipeCompact[];
+        /**
+          * @default null
+         */
+        "mainImage"?: RecipeImage | null;
         "onDeleteLinkClicked"?: (event: RecipeViewerCustomEvent<RecipeCompact>) => void;
         "onRatingSelected"?: (event: RecipeViewerCustomEvent<number>) => void;
         "onTagClicked"?: (event: RecipeViewerCustomEvent<string>) => void;
@@ -22,6 +22,8 @@ export class NoteCard {
             <ion-card-title class="title">
               <ion-icon icon="chatbox" />&nbsp;{formatDate(this.note?.createdAt)}
             </ion-card-title>
+            {this.note?.createdByUsername &&
+              <ion-card-subtitle>By: {this.note.createdByUsername}</ion-card-subtitle>}
             {this.note?.createdAt?.getTime() !== this.note?.modifiedAt?.getTime() &&
               <ion-card-subtitle>Last Modified: {formatDate(this.note?.modifiedAt)}</ion-card-subtitle>}
           </ion-card-header>
@@ -1,9 +1,38 @@
 import { actionSheetController, alertController, modalController } from '@ionic/core';
 import { Component, Host, Method, State, h } from '@stencil/core';
-import { Backup, RecipeState, SortBy, SortDir } from '../../../generated';
-import { performRecipeSearch, appApi, recipesApi } from '../../../helpers/api';
+import { Backup } from '../../../generated';
+import { appApi, recipesApi, waitForJob } from '../../../helpers/api';
 import { ComponentWithActivatedCallback, enableBackForOverlay, isNull, scaleValue, showLoading, showToast } from '../../../helpers/utils';
 
+// The result of the job that optimizes all images, which is described by imageOptimizationReport in models.yaml
+interface ImageOptimizationReport {
+  total: number;
+  optimized: number;
+  renamed: number;
+  failures: { recipeId: number, name: string, error: string }[];
+}
+
+// The result of the job that checks the uploads, which is described by uploadCheckReport in models.yaml
+interface UploadCheckIssue {
+  recipeId: number;
+  name?: string;
+  repairError?: string;
+}
+interface UploadCheckContentIssue {
+  name: string;
+  repairError?: string;
+}
+interface UploadCheckReport {
+  repair: boolean;
+  orphanedRecipes: UploadCheckIssue[];
+  orphanedContent: UploadCheckContentIssue[];
+  staleReferences: UploadCheckIssue[];
+  missingContent: UploadCheckIssue[];
+  missingImages: UploadCheckIssue[];
+  missingThumbnails: UploadCheckIssue[];
+  danglingMainImages: UploadCheckIssue[];
+}
+
 @Component({
   tag: 'page-admin-maintenance',
   styleUrl: 'page-admin-maintenance.css',
@@ -42,6 +71,28 @@ export class PageAdminMaintenance implements ComponentWithActivatedCallback {
                 </ion-card>
               </ion-col>
             </ion-row>
+            <ion-row>
+              <ion-col>
+                <ion-card>
+                  <ion-card-header>
+                    <ion-card-title>Upload Check</ion-card-title>
+                  </ion-card-header>
+                  <ion-card-content>
+                    <p>
+                      <ion-note>
+                        Checking uploads will compare all uploaded recipe images against the recipes they belong to,
+                        finding images of recipes that no longer exist, images without thumbnails, and main images that no longer exist.
+                        Any problems that are found can then be repaired.
+                      </ion-note>
+                    </p>
+                  </ion-card-content>
+                  <ion-button fill="clear" onClick={() => this.checkUploadsClicked()}>
+                    <ion-icon slot="start" name="construct" />
+                    Check Now
+                  </ion-button>
+                </ion-card>
+              </ion-col>
+            </ion-row>
             <ion-row>
               <ion-col>
                 <ion-card>
@@ -114,29 +165,19 @@ export class PageAdminMaintenance implements ComponentWithActivatedCallback {
 
   private async optimizeImages() {
     try {
+      let report: ImageOptimizationReport | undefined;
       await showLoading(
         async () => {
-          const { recipes } = await performRecipeSearch({
-            sortBy: SortBy.Id,
-            sortDir: SortDir.Asc,
-            query: '',
-            withPictures: true,
-            fields: [],
-            states: [RecipeState.Active, RecipeState.Archived],
-            tags: []
-          }, 1, -1,);
-          for (const recipe of recipes ?? []) {
-            if (isNull(recipe.id)) continue;
-
-            const images = await recipesApi.getImages({ recipeId: recipe.id });
-            for (const image of images) {
-              await recipesApi.optimizeImage({
-                recipeId: recipe.id,
-                name: image
-              });
-            }
+          const job = await waitForJob(await recipesApi.optimizeAllImages());
+          if (!isNull(job.result)) {
+            report = JSON.parse(job.result) as ImageOptimizationReport;
           }
         }, 'Optimizing images. This might take a while...');
+
+      if (!isNull(report) && report.failures.length > 0) {
+        console.error('Failed to optimize images', report.failures);
+        await showToast(`Optimized ${report.optimized} of ${report.total} images. ${report.failures.length} failed.`, 5000);
+      }
     } catch (ex) {
       console.error(ex);
       await showToast('Failed to optimize images.');
@@ -164,10 +205,76 @@ export class PageAdminMaintenance implements ComponentWithActivatedCallback {
     });
   }
 
+  private async checkUploads(repair: boolean) {
+    try {
+      let report: UploadCheckReport | undefined;
+      await showLoading(
+        async () => {
+          const job = await waitForJob(await appApi.checkUploads({ repair }));
+          if (!isNull(job.result)) {
+            report = JSON.parse(job.result) as UploadCheckReport;
+          }
+        }, repair ? 'Repairing uploads. This might take a while...' : 'Checking uploads. This might take a while...');
+      return report;
+    } catch (ex) {
+      console.error(ex);
+      await showToast(repair ? 'Failed to repair uploads.' : 'Failed to check uploads.');
+      return undefined;
+    }
+  }
+
+  private async checkUploadsClicked() {
+    const report = await this.checkUploads(false);
+    if (isNull(report)) {
+      return;
+    }
+
+    const brokenImages = report.staleReferences.length + report.missingContent.length + report.missingImages.length;
+    const problems = report.orphanedRecipes.length + report.orphanedContent.length + brokenImages
+      + report.missingThumbnails.length + report.danglingMainImages.length;
+    if (problems === 0) {
+      await showToast('No problems found.');
+      return;
+    }
+
+    await enableBackForOverlay(async () => {
+      const confirmation = await alertController.create({
+        header: 'Repair Uploads?',
+        message: `Found images of ${report.orphanedRecipes.length} deleted recipes, ${report.orphanedContent.length} unused images, `
+          + `${brokenImages} broken references to images, ${report.missingThumbnails.length} images without thumbnails, `
+          + `and ${report.danglingMainImages.length} missing main images. Are you sure you want to repair them? This operation cannot be undone.`,
+        buttons: [
+          { text: 'No', role: 'cancel' },
+          { text: 'Yes', role: 'confirm' }
+        ],
+      });
+
+      await confirmation.present();
+
+      const { role } = await confirmation.onDidDismiss();
+
+      if (role === 'confirm') {
+        const repairReport = await this.checkUploads(true);
+        if (isNull(repairReport)) {
+          return;
+        }
+        const failures = [
+          ...repairReport.orphanedRecipes, ...repairReport.orphanedContent, ...repairReport.staleReferences,
+          ...repairReport.missingContent, ...repairReport.missingImages, ...repairReport.missingThumbnails,
+          ...repairReport.danglingMainImages]
+          .filter(issue => !isNull(issue.repairError));
+        if (failures.length > 0) {
+          console.error('Failed to repair uploads', failures);
+          await showToast(`${failures.length} problems could not be repaired.`, 5000);
+        }
+      }
+    });
+  }
+
   private async createBackup() {
     try {
       await showLoading(
-        async () => await appApi.createBackup(), 'Creating backup...');
+        async () => await waitForJob(await appApi.createBackup()), 'Creating backup...');
     } catch (ex) {
       console.error(ex);
       await showToast('Failed to create backup.');
@@ -231,7 +338,7 @@ export class PageAdminMaintenance implements ComponentWithActivatedCallback {
   private async restoreBackup(backupFileName: string) {
     try {
       await showLoading(
-        async () => await appApi.restoreFromBackup({ name: backupFileName }), 'Restoring backup...');
+        async () => await waitForJob(await appApi.restoreFromBackup({ name: backupFileName })), 'Restoring backup...');
     } catch (ex) {
       console.error(ex);
       await showToast('Failed to restore from backup.');
@@ -263,7 +370,7 @@ export class PageAdminMaintenance implements ComponentWithActivatedCallback {
   private async uploadBackup(file: File) {
     try {
       await showLoading(
-        async () => await appApi.createBackup({ fileContent: file }), 'Uploading backup....');
+        async () => await waitForJob(await appApi.createBackup({ fileContent: file })), 'Uploading backup....');
     } catch (ex) {
       console.error(ex);
       await showToast('Failed to upload backup.');
@@ -1,7 +1,7 @@
 import { Component, Element, Fragment, h, Host, Method, State } from '@stencil/core';
 import { getDefaultSearchFilter } from '../../../models';
 import { modalController } from '@ionic/core';
-import { loadUserSettings, performRecipeSearch, recipesApi, refreshSearchResults, usersApi } from '../../../helpers/api';
+import { loadUserSettings, performRecipeSearch, recipesApi, refreshSearchResults, usersApi, waitForJob } from '../../../helpers/api';
 import { redirect, showToast, enableBackForOverlay, showLoading, isNull, isNullOrEmpty, ComponentWithActivatedCallback, isAuthorized } from '../../../helpers/utils';
 import state from '../../../stores/state';
 import { AccessLevel, Recipe, RecipeCompact, SearchFilter, SortBy, UserSettings } from '../../../generated';
@@ -142,10 +142,11 @@ export class PageHome implements ComponentWithActivatedCallback {
               throw new Error('Failed to upload image: recipe ID is null.');
             }
 
-            await recipesApi.uploadImage({
+            const job = await recipesApi.uploadImage({
               recipeId: newRecipe.id,
               fileContent: file
             });
+            await waitForJob(job);
           },
           'Uploading picture...');
       }
@@ -1,8 +1,8 @@
 import { actionSheetController, alertController, modalController } from '@ionic/core';
 import { Component, Element, Fragment, h, Host, Method, Prop, State } from '@stencil/core';
-import { AccessLevel, Note, Recipe, RecipeCompact, RecipeState } from '../../../generated';
-import { recipesApi, refreshSearchResults } from '../../../helpers/api';
-import { ComponentWithActivatedCallback, enableBackForOverlay, getRecipeImageUrl, getRecipeThumbnailUrl, isAuthorized, isNull, redirect, showLoading, showToast } from '../../../helpers/utils';
+import { AccessLevel, Note, Recipe, RecipeCompact, RecipeImage, RecipeImageInfo, RecipeState } from '../../../generated';
+import { recipesApi, refreshSearchResults, waitForJob } from '../../../helpers/api';
+import { ComponentWithActivatedCallback, enableBackForOverlay, isAuthorized, isNull, redirect, showLoading, showToast } from '../../../helpers/utils';
 import state from '../../../stores/state';
 import { getDefaultSearchFilter } from '../../../models';
 
@@ -15,7 +15,7 @@ export class PageRecipe implements ComponentWithActivatedCallback {
 
   @State() recipe: Recipe | null = null;
   @State() links: RecipeCompact[] = [];
-  @State() images: string[] = [];
+  @State() images: RecipeImage[] = [];
   @State() notes: Note[] = [];
 
   @Element() el!: HTMLPageRecipeElement;
@@ -39,6 +39,7 @@ export class PageRecipe implements ComponentWithActivatedCallback {
               <ion-col size="12" size-lg="9" size-xl="8" offset-xl="2">
                 <recipe-viewer
                   recipe={this.recipe}
+                  mainImage={this.images.find(image => image.name === this.recipe?.mainImageName) ?? null}
                   links={this.links}
                   readonly={!isAuthorized(state.currentUser, AccessLevel.Editor)}
                   onRatingSelected={e => void this.onRatingSelected(e.detail)}
@@ -94,21 +95,33 @@ export class PageRecipe implements ComponentWithActivatedCallback {
                 <h4 class="tab ion-text-center ion-margin-horizontal"><ion-text color="primary">Pictures</ion-text></h4>
                 <ion-grid class="no-pad">
                   <ion-row class="ion-justify-content-center">
-                    {this.images?.map(image =>
-                      <ion-col key={image} size="auto">
+                    {this.images?.map((image, index) =>
+                      <ion-col key={image.name} size="auto">
                         <ion-card class="zoom">
-                          <a href={getRecipeImageUrl(this.recipeId, image)} target="_blank" rel="noopener noreferrer">
+                          <a href={image.url} target="_blank" rel="noopener noreferrer">
                             <ion-thumbnail class="upload">
-                              <ion-img alt={image} class="thumb" src={getRecipeThumbnailUrl(this.recipeId, image)} />
+                              <ion-img alt={image.altText || image.name} class="thumb" src={image.thumbnailUrl} />
                             </ion-thumbnail>
                           </a>
+                          {image.caption &&
+                            <ion-card-subtitle class="ion-text-center">{image.caption}</ion-card-subtitle>
+                          }
                           {isAuthorized(state.currentUser, AccessLevel.Editor) &&
                             <ion-card-content class="ion-no-padding">
                               <ion-buttons>
-                                <ion-button size="small" onClick={() => this.onSetMainImageClicked(image)}>
+                                <ion-button size="small" disabled={index === 0} onClick={() => this.onMoveImageClicked(index, -1)}>
+                                  <ion-icon slot="icon-only" icon="chevron-back" size="small" />
+                                </ion-button>
+                                <ion-button size="small" disabled={index === this.images.length - 1} onClick={() => this.onMoveImageClicked(index, 1)}>
+                                  <ion-icon slot="icon-only" icon="chevron-forward" size="small" />
+                                </ion-button>
+                                <ion-button size="small" onClick={() => this.onEditImageClicked(image)}>
+                                  <ion-icon slot="icon-only" icon="create" size="small" />
+                                </ion-button>
+                                <ion-button size="small" onClick={() => this.onSetMainImageClicked(image.name)}>
                                   <ion-icon slot="icon-only" icon="star" size="small" />
                                 </ion-button>
-                                <ion-button size="small" color="danger" onClick={() => this.onDeleteImageClicked(image)}>
+                                <ion-button size="small" color="danger" onClick={() => this.onDeleteImageClicked(image.name)}>
                                   <ion-icon slot="icon-only" icon="trash" size="small" />
                                 </ion-button>
                               </ion-buttons>
@@ -338,10 +351,11 @@ export class PageRecipe implements ComponentWithActivatedCallback {
     try {
       await showLoading(
         async () => {
-          await recipesApi.uploadImage({
+          const job = await recipesApi.uploadImage({
             recipeId: this.recipeId,
             fileContent: file
           });
+          await waitForJob(job);
         },
         'Uploading picture...');
     } catch (ex) {
@@ -362,6 +376,31 @@ export class PageRecipe implements ComponentWithActivatedCallback {
     }
   }
 
+  private async updateImage(image: string, info: RecipeImageInfo) {
+    try {
+      await recipesApi.updateImage({
+        recipeId: this.recipeId,
+        name: image,
+        recipeImageInfo: info
+      });
+    } catch (ex) {
+      console.error(ex);
+      await showToast('Failed to save picture details.');
+    }
+  }
+
+  private async reorderImages(images: string[]) {
+    try {
+      await recipesApi.reorderImages({
+        recipeId: this.recipeId,
+        requestBody: images
+      });
+    } catch (ex) {
+      console.error(ex);
+      await showToast('Failed to reorder pictures.');
+    }
+  }
+
   private async setRating(value: number) {
     try {
       await recipesApi.patchRecipe({
@@ -701,6 +740,52 @@ export class PageRecipe implements ComponentWithActivatedCallback {
     });
   }
 
+  private async onEditImageClicked(image: RecipeImage) {
+    await enableBackForOverlay(async () => {
+      const editor = await alertController.create({
+        header: 'Edit Picture',
+        inputs: [
+          {
+            name: 'caption',
+            type: 'text',
+            label: 'Caption',
+            placeholder: 'Caption',
+            value: image.caption
+          },
+          {
+            name: 'altText',
+            type: 'textarea',
+            label: 'Description',
+            placeholder: 'Description, for those who can\'t see the picture',
+            value: image.altText
+          }
+        ],
+        buttons: [
+          { text: 'Cancel', role: 'cancel' },
+          { text: 'Save', role: 'confirm' }
+        ],
+      });
+
+      await editor.present();
+
+      const { data, role } = await editor.onDidDismiss<{ values: RecipeImageInfo }>();
+
+      if (role === 'confirm' && !isNull(data)) {
+        await this.updateImage(image.name, data.values);
+        await this.loadImages();
+      }
+    });
+  }
+
+  private async onMoveImageClicked(index: number, offset: number) {
+    const images = this.images.map(image => image.name);
+    const [moved] = images.splice(index, 1);
+    images.splice(index + offset, 0, moved);
+
+    await this.reorderImages(images);
+    await this.loadImages();
+  }
+
   private async onDeleteImageClicked(image: string) {
     await enableBackForOverlay(async () => {
       const confirmation = await alertController.create({
@@ -1,7 +1,7 @@
 import { alertController, Gesture, modalController, ScrollBaseDetail } from '@ionic/core';
 import { Component, Element, h, Host } from '@stencil/core';
 import { AccessLevel, Recipe, RecipeState, SortBy, SortDir } from '../../../generated';
-import { recipesApi, refreshSearchResults } from '../../../helpers/api';
+import { recipesApi, refreshSearchResults, waitForJob } from '../../../helpers/api';
 import { redirect, showToast, enableBackForOverlay, showLoading, createSwipeGesture, enumKeyFromValue, insertSpacesBetweenWords, isNull, isNullOrEmpty, isAuthorized, getRecipeThumbnailUrl } from '../../../helpers/utils';
 import { SearchViewMode, SwipeDirection } from '../../../models';
 import state from '../../../stores/state';
@@ -169,10 +169,11 @@ export class PageSearch {
               throw new Error('Failed to upload image: recipe ID is null.');
             }
 
-            await recipesApi.uploadImage({
+            const job = await recipesApi.uploadImage({
               recipeId: newRecipe.id,
               fileContent: file
             });
+            await waitForJob(job);
           },
           'Uploading picture...');
       }
@@ -1,6 +1,6 @@
 import { Component, Event, EventEmitter, Host, Prop, h } from '@stencil/core';
-import { Recipe, RecipeCompact, RecipeState } from '../../generated';
-import { formatDate, getRecipeImageUrl, getRecipeThumbnailUrl, isNullOrEmpty } from '../../helpers/utils';
+import { Recipe, RecipeCompact, RecipeImage, RecipeState } from '../../generated';
+import { formatDate, getImageSrcSet, getImageVariantTypes, getRecipeImageUrl, getRecipeThumbnailUrl, isNullOrEmpty } from '../../helpers/utils';
 
 @Component({
   tag: 'recipe-viewer',
@@ -9,6 +9,7 @@ import { formatDate, getRecipeImageUrl, getRecipeThumbnailUrl, isNullOrEmpty } f
 })
 export class RecipeViewer {
   @Prop() recipe: Recipe | null = null;
+  @Prop() mainImage: RecipeImage | null = null;
   @Prop() links: RecipeCompact[] = [];
   @Prop() readonly = false;
 
@@ -22,19 +23,25 @@ export class RecipeViewer {
         <ion-card>
           {!isNullOrEmpty(this.recipe?.mainImageName) && (
             <a href={getRecipeImageUrl(this.recipe?.id, this.recipe?.mainImageName)} target="_blank" rel="noopener noreferrer">
-              <img
-                class="main"
-                alt={this.recipe?.name}
-                src={getRecipeThumbnailUrl(this.recipe?.id, this.recipe?.mainImageName)}
-                onLoad={e => {
-                  const img = e.currentTarget as HTMLImageElement;
-                  if (!isNullOrEmpty(this.recipe?.mainImageName) && img.src.endsWith(getRecipeThumbnailUrl(this.recipe?.id, this.recipe?.mainImageName))) {
-                    const fullImg = new Image();
-                    fullImg.src = getRecipeImageUrl(this.recipe?.id, this.recipe?.mainImageName);
-                    fullImg.onload = () => img.src = getRecipeImageUrl(this.recipe?.id, this.recipe?.mainImageName);
-                  }
-                }}
-              />
+              <picture>
+                {/* When there are variants, the browser picks the best one, rather than swapping in the full image below */}
+                {getImageVariantTypes(this.mainImage).map(type =>
+                  <source type={type} srcset={getImageSrcSet(this.mainImage, type)} sizes="(min-width: 992px) 50vw, 100vw" />
+                )}
+                <img
+                  class="main"
+                  alt={this.mainImage?.altText || this.recipe?.name}
+                  src={getRecipeThumbnailUrl(this.recipe?.id, this.recipe?.mainImageName)}
+                  onLoad={e => {
+                    const img = e.currentTarget as HTMLImageElement;
+                    if (!isNullOrEmpty(this.recipe?.mainImageName) && img.currentSrc.endsWith(getRecipeThumbnailUrl(this.recipe?.id, this.recipe?.mainImageName))) {
+                      const fullImg = new Image();
+                      fullImg.src = getRecipeImageUrl(this.recipe?.id, this.recipe?.mainImageName);
+                      fullImg.onload = () => img.src = getRecipeImageUrl(this.recipe?.id, this.recipe?.mainImageName);
+                    }
+                  }}
+                />
+              </picture>
             </a>
           )}
           <ion-card-header>
@@ -1,5 +1,5 @@
 import { Component, Element, Host, h, Prop, State } from '@stencil/core';
-import { RecipeState, SavedSearchFilterCompact, SearchField, SearchFilter, SortBy, SortDir, UserSettings, YesNoAny } from '../../generated';
+import { RecipeState, SavedSearchFilterCompact, SearchField, SearchFilter, SortBy, SortDir, TagMatch, UserSettings, YesNoAny } from '../../generated';
 import { loadSearchFilters, loadUserSettings, usersApi } from '../../helpers/api';
 import { configureModalAutofocus, dismissContainingModal, fromYesNoAny, toYesNoAny, insertSpacesBetweenWords, isNull } from '../../helpers/utils';
 import { getDefaultSearchFilter } from '../../models';
@@ -86,6 +86,21 @@ export class SearchFilterEditor {
                 <ion-input enterkeyhint="enter" />
               </tags-input>
             </ion-item>
+            <ion-item lines="full">
+              <ion-select label="Tag Match" label-placement="stacked" value={this.searchFilter?.tagMatch}
+                onIonChange={(e: CustomEvent<{ value: TagMatch }>) => this.searchFilter = { ...this.searchFilter, tagMatch: e.detail.value }}>
+                {Object.keys(TagMatch).map(item =>
+                  <ion-select-option key={item} value={TagMatch[item as keyof typeof TagMatch]}>{insertSpacesBetweenWords(item)}</ion-select-option>
+                )}
+              </ion-select>
+            </ion-item>
+            <ion-item lines="full">
+              <tags-input label="Excluded Tags" label-placement="stacked" value={this.searchFilter?.excludedTags}
+                suggestions={this.currentUserSettings?.favoriteTags ?? []}
+                onValueChanged={(e: CustomEvent<string[]>) => this.searchFilter = { ...this.searchFilter, excludedTags: e.detail }}>
+                <ion-input enterkeyhint="enter" />
+              </tags-input>
+            </ion-item>
             <ion-item lines="full">
               <ion-select label="Sort By" label-placement="stacked" value={this.searchFilter?.sortBy}
                 onIonChange={(e: CustomEvent<{ value: SortBy }>) => this.searchFilter = { ...this.searchFilter, sortBy: e.detail.value }}>
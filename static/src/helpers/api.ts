@@ -1,5 +1,5 @@
-import { AppApi, Configuration, FetchAPI, FetchParams, Middleware, RecipesApi, SearchFilter, UsersApi } from '../generated';
-import { getDefaultSearchFilter } from '../models';
+import { AppApi, Configuration, FetchAPI, FetchParams, Job, JobState, Middleware, RecipesApi, SearchFilter, UsersApi } from '../generated';
+import { withSearchFilterDefaults } from '../models';
 import state, { onStateChange } from '../stores/state';
 import { isNull, toYesNoAny } from './utils';
 
@@ -65,6 +65,24 @@ export const appApi = new AppApi(configuration);
 export const recipesApi = new RecipesApi(configuration);
 export const usersApi = new UsersApi(configuration);
 
+const jobPollIntervalMs = 1000;
+
+// Waits for a background job to finish, throwing if it fails
+export async function waitForJob(job: Job) {
+  while (job.state !== JobState.Succeeded) {
+    if (job.state === JobState.Failed) {
+      throw new Error(`Job failed: ${job.error ?? 'unknown error'}`);
+    }
+    if (isNull(job.id)) {
+      throw new Error('Cannot wait for job: job ID is null.');
+    }
+
+    await new Promise(resolve => setTimeout(resolve, jobPollIntervalMs));
+    job = await appApi.getJob({ jobId: job.id });
+  }
+  return job;
+}
+
 export async function loadUserSettings() {
   try {
     return await usersApi.getSettings();
@@ -85,8 +103,7 @@ export async function loadSearchFilters() {
 
 export async function performRecipeSearch(filter: SearchFilter, page: number, count: number) {
   // Make sure to fill in any missing fields
-  const defaultFilter = getDefaultSearchFilter();
-  filter = { ...defaultFilter, ...filter };
+  filter = withSearchFilterDefaults(filter);
 
   return recipesApi.find({
     sort: filter.sortBy,
@@ -97,7 +114,10 @@ export async function performRecipeSearch(filter: SearchFilter, page: number, co
     pictures: toYesNoAny(filter.withPictures),
     fields: filter.fields.length > 0 ? filter.fields : undefined,
     states: filter.states.length > 0 ? filter.states : undefined,
-    tags: filter.tags.length > 0 ? filter.tags : undefined
+    tags: filter.tags.length > 0 || filter.excludedTags.length > 0
+      ? [...filter.tags, ...filter.excludedTags.map(tag => `-${tag}`)]
+      : undefined,
+    tagMatch: filter.tagMatch
   });
 }
 
@@ -1,6 +1,6 @@
 import { createGesture, GestureDetail, loadingController, toastController } from '@ionic/core';
 import DOMPurify from 'dompurify';
-import { AccessLevel, User, YesNoAny } from '../generated';
+import { AccessLevel, RecipeImage, User, YesNoAny } from '../generated';
 import { SwipeDirection } from '../models';
 
 export interface ComponentWithActivatedCallback {
@@ -273,3 +273,14 @@ export function getRecipeThumbnailUrl(recipeId: number | null | undefined, image
   const encodedName = encodeURIComponent(imageName);
   return `/uploads/recipes/${recipeId}/thumbs/${encodedName}`;
 }
+
+export function getImageVariantTypes(image: RecipeImage | null | undefined) {
+  return [...new Set((image?.variants ?? []).map(variant => variant.type))];
+}
+
+export function getImageSrcSet(image: RecipeImage | null | undefined, type: string) {
+  return (image?.variants ?? [])
+    .filter(variant => variant.type === type)
+    .map(variant => `${variant.url} ${variant.width}w`)
+    .join(', ');
+}
@@ -1,4 +1,4 @@
-import { RecipeState, SearchField, SearchFilter, SortBy, SortDir } from './generated';
+import { RecipeState, SearchField, SearchFilter, SortBy, SortDir, TagMatch } from './generated';
 
 export const SearchViewMode = {
   Card: 'card',
@@ -19,11 +19,24 @@ export function getDefaultSearchFilter(): SearchFilter {
     fields: [SearchField.Name, SearchField.Ingredients, SearchField.Directions],
     states: [RecipeState.Active],
     tags: [],
+    tagMatch: TagMatch.Any,
+    excludedTags: [],
     sortBy: SortBy.Name,
     sortDir: SortDir.Asc
   };
 }
 
+// Fills in any fields missing from the filter, e.g., one that was stored before the fields were added
+export function withSearchFilterDefaults(filter: Partial<SearchFilter>): SearchFilter {
+  const defaultFilter = getDefaultSearchFilter();
+  return {
+    ...defaultFilter,
+    ...filter,
+    tagMatch: filter.tagMatch ?? defaultFilter.tagMatch,
+    excludedTags: filter.excludedTags ?? defaultFilter.excludedTags
+  };
+}
+
 export function getDefaultSearchSettings(): SearchSettings {
   return {
     viewMode: SearchViewMode.Card
@@ -1,7 +1,7 @@
 import { createStore } from '@stencil/store';
 import { RecipeCompact, SearchFilter, User } from '../generated';
 import { isNull } from '../helpers/utils';
-import { getDefaultSearchFilter, getDefaultSearchSettings, SearchSettings } from '../models';
+import { getDefaultSearchFilter, getDefaultSearchSettings, SearchSettings, withSearchFilterDefaults } from '../models';
 
 interface AppState {
   currentUser?: User;
@@ -40,7 +40,11 @@ for (const prop of propsToSync) {
   const val = prop.storage.getItem(prop.key);
   if (!isNull(val)) {
     try {
-      const parsedVal = JSON.parse(val) as number | SearchFilter | SearchSettings | RecipeCompact[] | User | undefined;
+      let parsedVal = JSON.parse(val) as number | SearchFilter | SearchSettings | RecipeCompact[] | User | undefined;
+      if (prop.key === 'searchFilter' && !isNull(parsedVal)) {
+        // Filters stored by an earlier version may be missing newer fields
+        parsedVal = withSearchFilterDefaults(parsedVal as Partial<SearchFilter>);
+      }
       set(prop.key, parsedVal);
     } catch (e) {
       prop.storage.removeItem(prop.key);
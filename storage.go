@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/fileaccess"
+	"github.com/chadweimer/vary"
+)
+
+const storageUsage = `Usage: gomp storage migrate --to PREFIX [--from PREFIX] [--dry-run]
+
+Copies all uploads and backups from one file storage location to another, verifying the checksum of each copy.
+Files already at the destination with the same checksum are skipped, so an interrupted migration can be resumed
+by running it again.
+
+Each location is configured the same way as the application, using environment variables with the specified
+prefix (e.g., --to NEW reads NEW_FILES_DRIVER, NEW_FILES_PATH, etc.), falling back to the unprefixed variables.
+`
+
+// storageConfig represents the configuration of a file storage location
+type storageConfig struct {
+	// Files contains the file storage configuration settings
+	Files fileaccess.FilesConfig
+
+	// Database contains the database configuration settings, which are only used by the db files driver
+	Database db.Config
+}
+
+// isSameLocation returns whether both configurations store files in the same place
+func (c storageConfig) isSameLocation(other storageConfig) bool {
+	if c.Files.Driver != other.Files.Driver {
+		return false
+	}
+
+	switch c.Files.Driver {
+	case fileaccess.FilesDriverS3:
+		return c.Files.S3.Endpoint.String() == other.Files.S3.Endpoint.String() &&
+			c.Files.S3.Bucket == other.Files.S3.Bucket &&
+			c.Files.S3.Prefix == other.Files.S3.Prefix
+	case fileaccess.FilesDriverDB:
+		return c.Database.URL.String() == other.Database.URL.String()
+	default:
+		path, err := filepath.Abs(c.Files.Path)
+		if err != nil {
+			return false
+		}
+		otherPath, err := filepath.Abs(other.Files.Path)
+		if err != nil {
+			return false
+		}
+		return path == otherPath
+	}
+}
+
+// runStorageCommand runs the storage subcommand with the specified arguments, and returns the exit code
+func runStorageCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "migrate" {
+		fmt.Fprint(stderr, storageUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("gomp storage migrate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, storageUsage)
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+	from := flags.String("from", "GOMP", "The prefix of the environment variables that configure the location to copy from.")
+	to := flags.String("to", "", "The prefix of the environment variables that configure the location to copy to.")
+	dryRun := flags.Bool("dry-run", false, "Report what would be copied, without copying anything.")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *to == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	srcCfg, err := loadStorageConfig(*from)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to load configuration for %s: %v\n", *from, err)
+		return 1
+	}
+	dstCfg, err := loadStorageConfig(*to)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to load configuration for %s: %v\n", *to, err)
+		return 1
+	}
+	if srcCfg.isSameLocation(dstCfg) {
+		fmt.Fprintf(stderr, "%s and %s are the same location\n", *from, *to)
+		return 1
+	}
+
+	src, closeSrc, err := openStorage(srcCfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to open %s: %v\n", *from, err)
+		return 1
+	}
+	defer closeSrc()
+	dst, closeDst, err := openStorage(dstCfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to open %s: %v\n", *to, err)
+		return 1
+	}
+	defer closeDst()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	report, err := fileaccess.Migrate(ctx, src, dst, fileaccess.MigrateOptions{
+		DryRun: *dryRun,
+		Progress: func(file fileaccess.MigratedFile) {
+			if file.Err != nil {
+				fmt.Fprintf(stdout, "%-7s %s: %v\n", file.Status, file.Path, file.Err)
+			} else {
+				fmt.Fprintf(stdout, "%-7s %s (%d bytes, sha256 %s)\n", file.Status, file.Path, file.Size, file.Checksum)
+			}
+		},
+	})
+	writeMigrationSummary(stdout, report)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(stderr, "Migration interrupted. Run it again to resume.")
+		} else {
+			fmt.Fprintf(stderr, "Migration failed: %v\n", err)
+		}
+		return 1
+	}
+	if report.Count(fileaccess.MigrationFailed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func writeMigrationSummary(w io.Writer, report *fileaccess.MigrationReport) {
+	if report == nil {
+		return
+	}
+
+	copied := "Copied"
+	if report.DryRun {
+		copied = "Would copy"
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%s: %d files (%d bytes)\n", copied,
+		report.Count(fileaccess.MigrationCopied), report.Size(fileaccess.MigrationCopied))
+	fmt.Fprintf(w, "Skipped (already migrated): %d files (%d bytes)\n",
+		report.Count(fileaccess.MigrationSkipped), report.Size(fileaccess.MigrationSkipped))
+	fmt.Fprintf(w, "Failed: %d files (%d bytes)\n",
+		report.Count(fileaccess.MigrationFailed), report.Size(fileaccess.MigrationFailed))
+}
+
+// loadStorageConfig loads the configuration of a file storage location from the environment variables with the prefix
+func loadStorageConfig(prefix string) (storageConfig, error) {
+	vary.SetPrefix(prefix)
+	cfg := storageConfig{}
+	if err := vary.Bind(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// openStorage returns the driver for a file storage location, and a function to close it when done
+func openStorage(cfg storageConfig) (fileaccess.Driver, func(), error) {
+	if cfg.Files.Driver != fileaccess.FilesDriverDB {
+		drv, err := fileaccess.CreateDriver(cfg.Files)
+		return drv, func() {}, err
+	}
+
+	dbDriver, err := db.CreateDriver(cfg.Database)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dbDriver.Files(), func() { _ = dbDriver.Close() }, nil
+}
+
+// runCommand runs the subcommand with the specified arguments, and returns the exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "storage":
+		return runStorageCommand(args[1:], os.Stdout, os.Stderr)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", args[0], storageUsage)
+		return 2
+	}
+}
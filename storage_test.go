@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/chadweimer/gomp/db"
+	"github.com/chadweimer/gomp/fileaccess"
+)
+
+func TestStorageConfig_isSameLocation(t *testing.T) {
+	fsConfig := func(path string) storageConfig {
+		return storageConfig{Files: fileaccess.FilesConfig{Driver: fileaccess.FilesDriverFS, Path: path}}
+	}
+	s3Config := func(bucket, prefix string) storageConfig {
+		return storageConfig{Files: fileaccess.FilesConfig{
+			Driver: fileaccess.FilesDriverS3,
+			S3: fileaccess.S3Config{
+				Endpoint: url.URL{Scheme: "http", Host: "minio:9000"},
+				Bucket:   bucket,
+				Prefix:   prefix,
+			},
+		}}
+	}
+	dbConfig := func(path string) storageConfig {
+		return storageConfig{
+			Files:    fileaccess.FilesConfig{Driver: fileaccess.FilesDriverDB},
+			Database: db.Config{URL: url.URL{Scheme: "file", Opaque: path}},
+		}
+	}
+	tests := []struct {
+		name string
+		a    storageConfig
+		b    storageConfig
+		want bool
+	}{
+		{"Same Path", fsConfig("data"), fsConfig("./data/"), true},
+		{"Different Path", fsConfig("data"), fsConfig("data2"), false},
+		{"Same Bucket", s3Config("gomp", ""), s3Config("gomp", ""), true},
+		{"Different Prefix", s3Config("gomp", ""), s3Config("gomp", "files"), false},
+		{"Different Bucket", s3Config("gomp", ""), s3Config("gomp2", ""), false},
+		{"Same Database", dbConfig("data/data.db"), dbConfig("data/data.db"), true},
+		{"Different Database", dbConfig("data/data.db"), dbConfig("data/other.db"), false},
+		{"Different Driver", fsConfig("data"), dbConfig("data/data.db"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.isSameLocation(tt.b); got != tt.want {
+				t.Errorf("storageConfig.isSameLocation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}